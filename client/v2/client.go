@@ -464,7 +464,12 @@ type Message struct {
 
 // Result represents a resultset returned from a single statement.
 type Result struct {
-	Series   []models.Row
+	Series []models.Row
+
+	// Tags are shared by every series in the result. They are only set when
+	// the query asks for constant tags to be omitted from the series.
+	Tags map[string]string `json:"tags,omitempty"`
+
 	Messages []*Message
 	Err      string `json:"error,omitempty"`
 }
@@ -7,11 +7,13 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"text/tabwriter"
 	"time"
 
+	"github.com/lucaswiersma/influxdb/models"
 	"github.com/lucaswiersma/influxdb/tsdb/engine/tsm1"
 )
 
@@ -87,6 +89,7 @@ func (cmd *Command) dump() error {
 	keyCount := r.KeyCount()
 
 	blockStats := &blockStats{}
+	fieldStats := fieldStats{}
 
 	println("Summary:")
 	fmt.Printf("  File: %s\n", cmd.path)
@@ -194,6 +197,7 @@ func (cmd *Command) dump() error {
 			blockStats.inc(0, ts[0]>>4)
 			blockStats.inc(int(blockType+1), values[0]>>4)
 			blockStats.size(len(buf))
+			fieldStats.add(key, v, len(buf))
 
 			if cmd.dumpBlocks {
 				fmt.Fprintln(tw, "  "+strings.Join([]string{
@@ -248,6 +252,11 @@ func (cmd *Command) dump() error {
 	fmt.Printf("  Compression:\n")
 	fmt.Printf("    Per block: %0.2f bytes/point\n", float64(blockSize)/float64(pointCount))
 	fmt.Printf("    Total: %0.2f bytes/point\n", float64(stat.Size())/float64(pointCount))
+	fmt.Printf("    Per field (raw/encoded bytes):\n")
+	for _, name := range fieldStats.names() {
+		fs := fieldStats[name]
+		fmt.Printf("      %s: %d/%d (%0.2fx)\n", name, fs.raw, fs.encoded, fs.ratio())
+	}
 
 	if len(errors) > 0 {
 		println()
@@ -300,7 +309,7 @@ var (
 		"none", "bp",
 	}
 	stringEnc = []string{
-		"none", "snpy",
+		"none", "snpy", "dict",
 	}
 	encDescs = [][]string{
 		timeEnc, floatEnc, intEnc, boolEnc, stringEnc,
@@ -330,3 +339,56 @@ func (b *blockStats) size(sz int) {
 		b.max = sz
 	}
 }
+
+// fieldCompression tracks the size of a field's values before and after encoding.
+type fieldCompression struct {
+	raw, encoded int64
+}
+
+// ratio returns the compression ratio of the field's encoded blocks.
+func (f *fieldCompression) ratio() float64 {
+	if f.encoded == 0 {
+		return 0
+	}
+	return float64(f.raw) / float64(f.encoded)
+}
+
+// fieldStats holds the compression of each field keyed by "measurement.field".
+type fieldStats map[string]*fieldCompression
+
+// add records a block of values of the given composite key and encoded size.
+// The raw size of a value is its 8 byte timestamp plus the size of its value.
+func (f fieldStats) add(key []byte, values []tsm1.Value, sz int) {
+	seriesKey, field := tsm1.SeriesAndFieldFromCompositeKey(key)
+	measurement, _, _ := models.ParseKey(seriesKey)
+
+	name := measurement + "." + field
+	fs, ok := f[name]
+	if !ok {
+		fs = &fieldCompression{}
+		f[name] = fs
+	}
+
+	for _, v := range values {
+		fs.raw += 8
+		switch v := v.Value().(type) {
+		case string:
+			fs.raw += int64(len(v))
+		case bool:
+			fs.raw++
+		default:
+			fs.raw += 8
+		}
+	}
+	fs.encoded += int64(sz)
+}
+
+// names returns the sorted field names.
+func (f fieldStats) names() []string {
+	names := make([]string, 0, len(f))
+	for name := range f {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,317 @@
+// Package exportcq exports continuous query definitions and the databases and
+// retention policies they depend on as a re-importable InfluxQL manifest.
+package exportcq
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/lucaswiersma/influxdb/influxql"
+	"github.com/lucaswiersma/influxdb/services/meta"
+)
+
+// Command represents the program execution for "influx_inspect exportcq".
+type Command struct {
+	// Standard input/output, overridden for testing.
+	Stderr io.Writer
+	Stdout io.Writer
+
+	metaDir  string
+	out      string
+	database string
+}
+
+// NewCommand returns a new instance of Command.
+func NewCommand() *Command {
+	return &Command{
+		Stderr: os.Stderr,
+		Stdout: os.Stdout,
+	}
+}
+
+// Run executes the command.
+func (cmd *Command) Run(args ...string) error {
+	fs := flag.NewFlagSet("exportcq", flag.ExitOnError)
+	fs.StringVar(&cmd.metaDir, "metadir", os.Getenv("HOME")+"/.influxdb/meta", "Meta storage path")
+	fs.StringVar(&cmd.out, "out", "", "Optional: destination file to export to, defaults to stdout")
+	fs.StringVar(&cmd.database, "database", "", "Optional: only export continuous queries on this database")
+
+	fs.SetOutput(cmd.Stdout)
+	fs.Usage = func() {
+		fmt.Fprintf(cmd.Stdout, "Exports continuous queries and the databases and retention policies they use.\n\n")
+		fmt.Fprintf(cmd.Stdout, "Usage: %s exportcq [flags]\n\n", filepath.Base(os.Args[0]))
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	data, err := cmd.readMetaData()
+	if err != nil {
+		return err
+	}
+
+	cqs, err := continuousQueries(data, cmd.database)
+	if err != nil {
+		return err
+	}
+
+	w := cmd.Stdout
+	if cmd.out != "" {
+		f, err := os.Create(cmd.out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	return writeManifest(w, data, sortContinuousQueries(cqs))
+}
+
+// readMetaData reads the meta store snapshot from the meta directory.
+func (cmd *Command) readMetaData() (*meta.Data, error) {
+	buf, err := ioutil.ReadFile(filepath.Join(cmd.metaDir, "meta.db"))
+	if err != nil {
+		return nil, err
+	}
+
+	var data meta.Data
+	if err := data.UnmarshalBinary(buf); err != nil {
+		return nil, fmt.Errorf("unmarshal: %s", err)
+	}
+	return &data, nil
+}
+
+// retentionPolicyKey identifies a retention policy within a database.
+type retentionPolicyKey struct {
+	Database        string
+	RetentionPolicy string
+}
+
+func (k retentionPolicyKey) String() string {
+	return influxql.QuoteIdent(k.Database, k.RetentionPolicy)
+}
+
+// continuousQuery is a continuous query along with the retention policies it
+// reads from and writes into.
+type continuousQuery struct {
+	Statement *influxql.CreateContinuousQueryStatement
+	Sources   []retentionPolicyKey
+	Target    retentionPolicyKey
+}
+
+// continuousQueries parses the continuous queries in data, optionally only
+// those on database, and resolves the retention policies they use.
+func continuousQueries(data *meta.Data, database string) ([]*continuousQuery, error) {
+	var cqs []*continuousQuery
+	for _, dbi := range data.Databases {
+		if database != "" && dbi.Name != database {
+			continue
+		}
+
+		for _, cqi := range dbi.ContinuousQueries {
+			stmt, err := influxql.ParseStatement(cqi.Query)
+			if err != nil {
+				return nil, fmt.Errorf("unable to parse continuous query %s on %s: %s", cqi.Name, dbi.Name, err)
+			}
+			cq, ok := stmt.(*influxql.CreateContinuousQueryStatement)
+			if !ok {
+				return nil, fmt.Errorf("continuous query %s on %s is not a CREATE CONTINUOUS QUERY statement", cqi.Name, dbi.Name)
+			}
+
+			var target *influxql.Measurement
+			if cq.Source.Target != nil {
+				target = cq.Source.Target.Measurement
+			}
+			cqs = append(cqs, &continuousQuery{
+				Statement: cq,
+				Sources:   sourceRetentionPolicies(data, dbi.Name, cq.Source.Sources),
+				Target:    resolveRetentionPolicy(data, dbi.Name, target),
+			})
+		}
+	}
+	return cqs, nil
+}
+
+// sourceRetentionPolicies returns the distinct retention policies read by
+// sources, including those read by subqueries.
+func sourceRetentionPolicies(data *meta.Data, database string, sources influxql.Sources) []retentionPolicyKey {
+	var keys []retentionPolicyKey
+	seen := make(map[retentionPolicyKey]struct{})
+	var walk func(influxql.Sources)
+	walk = func(sources influxql.Sources) {
+		for _, src := range sources {
+			switch src := src.(type) {
+			case *influxql.Measurement:
+				key := resolveRetentionPolicy(data, database, src)
+				if _, ok := seen[key]; !ok {
+					seen[key] = struct{}{}
+					keys = append(keys, key)
+				}
+			case *influxql.SubQuery:
+				walk(src.Statement.Sources)
+			}
+		}
+	}
+	walk(sources)
+	return keys
+}
+
+// resolveRetentionPolicy returns the retention policy referenced by m,
+// defaulting to database and its default retention policy.
+func resolveRetentionPolicy(data *meta.Data, database string, m *influxql.Measurement) retentionPolicyKey {
+	key := retentionPolicyKey{Database: database}
+	if m != nil {
+		if m.Database != "" {
+			key.Database = m.Database
+		}
+		key.RetentionPolicy = m.RetentionPolicy
+	}
+	if key.RetentionPolicy == "" {
+		if dbi := data.Database(key.Database); dbi != nil {
+			key.RetentionPolicy = dbi.DefaultRetentionPolicy
+		}
+	}
+	return key
+}
+
+// sortContinuousQueries orders cqs so that a continuous query comes after
+// every continuous query that writes into a retention policy it reads from.
+// Ties, and queries that depend on each other, are ordered by database and name.
+func sortContinuousQueries(cqs []*continuousQuery) []*continuousQuery {
+	remaining := make([]*continuousQuery, len(cqs))
+	copy(remaining, cqs)
+	sort.Sort(continuousQueriesByName(remaining))
+
+	// ready returns true if no remaining query other than cq writes into
+	// one of the retention policies read by cq.
+	ready := func(cq *continuousQuery) bool {
+		for _, other := range remaining {
+			if other == cq {
+				continue
+			}
+			for _, src := range cq.Sources {
+				if other.Target == src {
+					return false
+				}
+			}
+		}
+		return true
+	}
+
+	sorted := make([]*continuousQuery, 0, len(cqs))
+	for len(remaining) > 0 {
+		// Fall back to the first query if there is a cycle.
+		next := 0
+		for i, cq := range remaining {
+			if ready(cq) {
+				next = i
+				break
+			}
+		}
+		sorted = append(sorted, remaining[next])
+		remaining = append(remaining[:next], remaining[next+1:]...)
+	}
+	return sorted
+}
+
+// continuousQueriesByName sorts continuous queries by database and name.
+type continuousQueriesByName []*continuousQuery
+
+func (a continuousQueriesByName) Len() int      { return len(a) }
+func (a continuousQueriesByName) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a continuousQueriesByName) Less(i, j int) bool {
+	if a[i].Statement.Database != a[j].Statement.Database {
+		return a[i].Statement.Database < a[j].Statement.Database
+	}
+	return a[i].Statement.Name < a[j].Statement.Name
+}
+
+// writeManifest writes the statements needed to recreate cqs in order. The
+// output uses the format read by "influx -import".
+func writeManifest(w io.Writer, data *meta.Data, cqs []*continuousQuery) error {
+	// Collect the retention policies used by each database.
+	policies := make(map[string]map[string]struct{})
+	for _, cq := range cqs {
+		for _, key := range append([]retentionPolicyKey{cq.Target}, cq.Sources...) {
+			if policies[key.Database] == nil {
+				policies[key.Database] = make(map[string]struct{})
+			}
+			if key.RetentionPolicy != "" {
+				policies[key.Database][key.RetentionPolicy] = struct{}{}
+			}
+		}
+	}
+
+	databases := make([]string, 0, len(policies))
+	for name := range policies {
+		databases = append(databases, name)
+	}
+	sort.Strings(databases)
+
+	if _, err := fmt.Fprintln(w, "# INFLUXDB CONTINUOUS QUERY EXPORT"); err != nil {
+		return err
+	}
+	fmt.Fprintln(w, "# DDL")
+
+	for _, name := range databases {
+		dbi := data.Database(name)
+		if dbi == nil {
+			fmt.Fprintf(w, "# database %s does not exist\n", influxql.QuoteIdent(name))
+			continue
+		}
+
+		// Create the database along with its default retention policy.
+		if rpi := dbi.RetentionPolicy(dbi.DefaultRetentionPolicy); rpi != nil {
+			fmt.Fprintf(w, "CREATE DATABASE %s WITH DURATION %s REPLICATION %d SHARD DURATION %s NAME %s\n",
+				influxql.QuoteIdent(dbi.Name), influxql.FormatDuration(rpi.Duration), rpi.ReplicaN,
+				influxql.FormatDuration(rpi.ShardGroupDuration), influxql.QuoteIdent(rpi.Name))
+		} else {
+			fmt.Fprintf(w, "CREATE DATABASE %s\n", influxql.QuoteIdent(dbi.Name))
+		}
+
+		rps := make([]string, 0, len(policies[name]))
+		for rp := range policies[name] {
+			if rp != dbi.DefaultRetentionPolicy {
+				rps = append(rps, rp)
+			}
+		}
+		sort.Strings(rps)
+
+		for _, rp := range rps {
+			rpi := dbi.RetentionPolicy(rp)
+			if rpi == nil {
+				fmt.Fprintf(w, "# retention policy %s does not exist\n", influxql.QuoteIdent(name, rp))
+				continue
+			}
+			stmt := &influxql.CreateRetentionPolicyStatement{
+				Name:               rpi.Name,
+				Database:           dbi.Name,
+				Duration:           rpi.Duration,
+				Replication:        rpi.ReplicaN,
+				ShardGroupDuration: rpi.ShardGroupDuration,
+			}
+			fmt.Fprintln(w, stmt.String())
+		}
+	}
+
+	for _, cq := range cqs {
+		sources := make([]string, len(cq.Sources))
+		for i, src := range cq.Sources {
+			sources[i] = src.String()
+		}
+		fmt.Fprintf(w, "# %s: %s -> %s\n", influxql.QuoteIdent(cq.Statement.Database, cq.Statement.Name),
+			strings.Join(sources, ", "), cq.Target)
+		if _, err := fmt.Fprintln(w, cq.Statement.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
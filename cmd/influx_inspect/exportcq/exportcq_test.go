@@ -0,0 +1,87 @@
+package exportcq
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lucaswiersma/influxdb/services/meta"
+)
+
+func TestCommand_Run(t *testing.T) {
+	dir, err := ioutil.TempDir("", "exportcq")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	data := &meta.Data{}
+	if err := data.CreateDatabase("telegraf"); err != nil {
+		t.Fatal(err)
+	}
+	for _, rpi := range []*meta.RetentionPolicyInfo{
+		{Name: "autogen", ReplicaN: 1, ShardGroupDuration: 7 * 24 * time.Hour},
+		{Name: "1h", ReplicaN: 1, Duration: 52 * 7 * 24 * time.Hour, ShardGroupDuration: 7 * 24 * time.Hour},
+		{Name: "1d", ReplicaN: 1, ShardGroupDuration: 7 * 24 * time.Hour},
+		{Name: "unused", ReplicaN: 1, Duration: 24 * time.Hour, ShardGroupDuration: time.Hour},
+	} {
+		if err := data.CreateRetentionPolicy("telegraf", rpi, rpi.Name == "autogen"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The daily query reads the output of the hourly query so it must be
+	// exported after it even though it sorts first by name.
+	for _, cq := range []struct{ name, query string }{
+		{"a_1d", `CREATE CONTINUOUS QUERY a_1d ON telegraf BEGIN SELECT mean(usage) AS usage INTO "1d".cpu FROM "1h".cpu GROUP BY time(1d) END`},
+		{"b_1h", `CREATE CONTINUOUS QUERY b_1h ON telegraf BEGIN SELECT mean(usage) AS usage INTO "1h".cpu FROM cpu GROUP BY time(1h) END`},
+	} {
+		if err := data.CreateContinuousQuery("telegraf", cq.name, cq.query); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	buf, err := data.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	} else if err := ioutil.WriteFile(filepath.Join(dir, "meta.db"), buf, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	cmd := NewCommand()
+	cmd.Stdout = &out
+	if err := cmd.Run("-metadir", dir); err != nil {
+		t.Fatal(err)
+	}
+
+	var statements []string
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		if !strings.HasPrefix(line, "#") {
+			statements = append(statements, line)
+		}
+	}
+	if len(statements) != 5 {
+		t.Fatalf("unexpected statements:\n%s", out.String())
+	}
+
+	for i, exp := range []string{
+		`CREATE DATABASE telegraf WITH DURATION 0s REPLICATION 1 SHARD DURATION 1w NAME autogen`,
+		`CREATE RETENTION POLICY "1d" ON telegraf DURATION 0s REPLICATION 1 SHARD DURATION 1w`,
+		`CREATE RETENTION POLICY "1h" ON telegraf DURATION 52w REPLICATION 1 SHARD DURATION 1w`,
+		`CREATE CONTINUOUS QUERY b_1h ON telegraf `,
+		`CREATE CONTINUOUS QUERY a_1d ON telegraf `,
+	} {
+		if !strings.HasPrefix(statements[i], exp) {
+			t.Fatalf("unexpected statement %d: %s", i, statements[i])
+		}
+	}
+
+	if !strings.Contains(out.String(), `# "telegraf".a_1d: "telegraf"."1h" -> "telegraf"."1d"`) {
+		t.Fatalf("expected dependency comment:\n%s", out.String())
+	}
+}
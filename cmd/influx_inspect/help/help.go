@@ -33,6 +33,7 @@ The commands are:
 
     dumptsm              dumps low-level details about tsm1 files.
     export               exports raw data from a shard to line protocol
+    exportcq             exports continuous queries and the databases they use
     help                 display this help message
     report               displays a shard level report
     verify               verifies integrity of TSM files
@@ -10,6 +10,7 @@ import (
 	"github.com/lucaswiersma/influxdb/cmd"
 	"github.com/lucaswiersma/influxdb/cmd/influx_inspect/dumptsm"
 	"github.com/lucaswiersma/influxdb/cmd/influx_inspect/export"
+	"github.com/lucaswiersma/influxdb/cmd/influx_inspect/exportcq"
 	"github.com/lucaswiersma/influxdb/cmd/influx_inspect/help"
 	"github.com/lucaswiersma/influxdb/cmd/influx_inspect/report"
 	"github.com/lucaswiersma/influxdb/cmd/influx_inspect/verify"
@@ -66,6 +67,11 @@ func (m *Main) Run(args ...string) error {
 		if err := name.Run(args...); err != nil {
 			return fmt.Errorf("export: %s", err)
 		}
+	case "exportcq":
+		name := exportcq.NewCommand()
+		if err := name.Run(args...); err != nil {
+			return fmt.Errorf("exportcq: %s", err)
+		}
 	case "report":
 		name := report.NewCommand()
 		if err := name.Run(args...); err != nil {
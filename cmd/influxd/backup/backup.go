@@ -44,6 +44,9 @@ type Command struct {
 	host     string
 	path     string
 	database string
+
+	// verifier checks completed backup files when -verify is set.
+	verifier *verifier
 }
 
 // NewCommand returns a new instance of Command with default settings.
@@ -60,11 +63,15 @@ func (cmd *Command) Run(args ...string) error {
 	cmd.Logger = log.New(cmd.Stderr, "", log.LstdFlags)
 
 	// Parse command line arguments.
-	retentionPolicy, shardID, since, err := cmd.parseFlags(args)
+	retentionPolicy, shardID, since, verify, err := cmd.parseFlags(args)
 	if err != nil {
 		return err
 	}
 
+	if verify {
+		cmd.verifier = newVerifier(cmd.Logger)
+	}
+
 	// based on the arguments passed in we only backup the minimum
 	if shardID != "" {
 		// always backup the metastore
@@ -80,6 +87,12 @@ func (cmd *Command) Run(args ...string) error {
 		err = cmd.backupMetastore()
 	}
 
+	if cmd.verifier != nil {
+		if verr := cmd.verifier.wait(); err == nil {
+			err = verr
+		}
+	}
+
 	if err != nil {
 		cmd.Logger.Printf("backup failed: %v", err)
 		return err
@@ -91,7 +104,7 @@ func (cmd *Command) Run(args ...string) error {
 }
 
 // parseFlags parses and validates the command line arguments into a request object.
-func (cmd *Command) parseFlags(args []string) (retentionPolicy, shardID string, since time.Time, err error) {
+func (cmd *Command) parseFlags(args []string) (retentionPolicy, shardID string, since time.Time, verify bool, err error) {
 	fs := flag.NewFlagSet("", flag.ContinueOnError)
 
 	fs.StringVar(&cmd.host, "host", "localhost:8088", "")
@@ -100,6 +113,7 @@ func (cmd *Command) parseFlags(args []string) (retentionPolicy, shardID string,
 	fs.StringVar(&shardID, "shard", "", "")
 	var sinceArg string
 	fs.StringVar(&sinceArg, "since", "", "")
+	fs.BoolVar(&verify, "verify", false, "")
 
 	fs.SetOutput(cmd.Stderr)
 	fs.Usage = cmd.printUsage
@@ -117,9 +131,9 @@ func (cmd *Command) parseFlags(args []string) (retentionPolicy, shardID string,
 
 	// Ensure that only one arg is specified.
 	if fs.NArg() == 0 {
-		return "", "", time.Unix(0, 0), errors.New("backup destination path required")
+		return "", "", time.Unix(0, 0), false, errors.New("backup destination path required")
 	} else if fs.NArg() != 1 {
-		return "", "", time.Unix(0, 0), errors.New("only one backup path allowed")
+		return "", "", time.Unix(0, 0), false, errors.New("only one backup path allowed")
 	}
 	cmd.path = fs.Arg(0)
 
@@ -289,6 +303,9 @@ func (cmd *Command) downloadAndVerify(req *snapshotter.Request, path string, val
 		return fmt.Errorf("rename: %s", err)
 	}
 
+	if cmd.verifier != nil {
+		cmd.verifier.add(path, req)
+	}
 	return nil
 }
 
@@ -371,6 +388,11 @@ Usage: influxd backup [flags] PATH
     -since <2015-12-24T08:12:23>
             Optional. Do an incremental backup since the passed in RFC3339
             formatted time.
+    -verify
+            Optional. Read back each backup file once it is written, checking
+            the checksum of every TSM block and that the metastore backup can
+            be restored and contains every backed up shard. The backup fails
+            if any corruption is found.
 
 `)
 }
@@ -0,0 +1,214 @@
+package backup
+
+import (
+	"archive/tar"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/lucaswiersma/influxdb/services/meta"
+	"github.com/lucaswiersma/influxdb/services/snapshotter"
+	"github.com/lucaswiersma/influxdb/tsdb/engine/tsm1"
+)
+
+// verifier reads back backup files in the background while the rest of the
+// backup downloads, checking the CRC of every TSM block and that the
+// metastore can be restored and references every backed up shard.
+type verifier struct {
+	logger *log.Logger
+
+	files chan verifyFile
+	done  chan struct{}
+
+	// Only accessed by the verifying goroutine until done is closed.
+	data    *meta.Data
+	shards  []*snapshotter.Request
+	checked int
+	blocks  int
+	broken  []string
+}
+
+// verifyFile is a backup file and the request that downloaded it.
+type verifyFile struct {
+	path string
+	req  *snapshotter.Request
+}
+
+func newVerifier(logger *log.Logger) *verifier {
+	v := &verifier{
+		logger: logger,
+		files:  make(chan verifyFile, 16),
+		done:   make(chan struct{}),
+	}
+	go v.run()
+	return v
+}
+
+// add queues a completed backup file for verification.
+func (v *verifier) add(path string, req *snapshotter.Request) {
+	v.files <- verifyFile{path: path, req: req}
+}
+
+// wait waits for the queued files to be verified, reports the results and
+// returns an error if any of the backup is corrupt.
+func (v *verifier) wait() error {
+	close(v.files)
+	<-v.done
+
+	// Backed up shards must be known to the backed up metastore so they can
+	// be restored.
+	if v.data != nil {
+		for _, req := range v.shards {
+			if !hasShard(v.data, req.Database, req.RetentionPolicy, req.ShardID) {
+				v.broken = append(v.broken, fmt.Sprintf("shard %d of %s.%s", req.ShardID, req.Database, req.RetentionPolicy))
+				v.logger.Printf("verify: shard %d of db=%s rp=%s is missing from the metastore backup", req.ShardID, req.Database, req.RetentionPolicy)
+			}
+		}
+	}
+
+	v.logger.Printf("verify: checked %d files and %d blocks, %d corrupt", v.checked, v.blocks, len(v.broken))
+	if len(v.broken) > 0 {
+		return fmt.Errorf("backup verification failed: %d corrupt", len(v.broken))
+	}
+	return nil
+}
+
+func (v *verifier) run() {
+	defer close(v.done)
+	for f := range v.files {
+		var err error
+		switch f.req.Type {
+		case snapshotter.RequestMetastoreBackup:
+			err = v.verifyMetastore(f.path)
+		case snapshotter.RequestShardBackup:
+			err = v.verifyShard(f.path)
+			v.shards = append(v.shards, f.req)
+		}
+		v.checked++
+
+		if err != nil {
+			v.broken = append(v.broken, f.path)
+			v.logger.Printf("verify: %s: %v", f.path, err)
+			continue
+		}
+		v.logger.Printf("verify: %s: healthy", f.path)
+	}
+}
+
+// verifyMetastore checks a metastore backup can be unpacked as restore does.
+func (v *verifier) verifyMetastore(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	if len(b) < 24 || binary.BigEndian.Uint64(b[:8]) != snapshotter.BackupMagicHeader {
+		return errors.New("invalid metadata file")
+	}
+	length := binary.BigEndian.Uint64(b[8:16])
+	if length > uint64(len(b)-24) {
+		return errors.New("metadata truncated")
+	}
+	metaBytes := b[16 : 16+length]
+
+	b = b[16+length:]
+	length = binary.BigEndian.Uint64(b[:8])
+	if uint64(len(b)-8) != length {
+		return errors.New("node info truncated")
+	}
+
+	var data meta.Data
+	if err := data.UnmarshalBinary(metaBytes); err != nil {
+		return fmt.Errorf("unmarshal metadata: %s", err)
+	}
+	var node map[string]interface{}
+	if err := json.Unmarshal(b[8:], &node); err != nil {
+		return fmt.Errorf("unmarshal node info: %s", err)
+	}
+
+	v.data = &data
+	return nil
+}
+
+// verifyShard checks the CRC of every block of every TSM file in a shard
+// archive.
+func (v *verifier) verifyShard(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("read archive: %s", err)
+		}
+
+		if filepath.Ext(hdr.Name) != "."+tsm1.TSMFileExtension {
+			continue
+		}
+		if err := v.verifyTSM(tr, filepath.Dir(path)); err != nil {
+			return fmt.Errorf("%s: %s", hdr.Name, err)
+		}
+	}
+}
+
+// verifyTSM copies a TSM file out of an archive into dir and checks the CRC
+// of each of its blocks.
+func (v *verifier) verifyTSM(r io.Reader, dir string) error {
+	tmp, err := ioutil.TempFile(dir, "verify")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		return fmt.Errorf("read archive: %s", err)
+	}
+
+	tsm, err := tsm1.NewTSMReader(tmp)
+	if err != nil {
+		return err
+	}
+	defer tsm.Close()
+
+	itr := tsm.BlockIterator()
+	for itr.Next() {
+		v.blocks++
+		key, _, _, _, checksum, buf, err := itr.Read()
+		if err != nil {
+			return fmt.Errorf("could not read block for key %v: %s", key, err)
+		} else if expected := crc32.ChecksumIEEE(buf); checksum != expected {
+			return fmt.Errorf("got checksum %d but expected %d for key %v", checksum, expected, key)
+		}
+	}
+	return nil
+}
+
+// hasShard returns true if data contains the shard in the retention policy.
+func hasShard(data *meta.Data, database, retentionPolicy string, id uint64) bool {
+	rpi, err := data.RetentionPolicy(database, retentionPolicy)
+	if err != nil || rpi == nil {
+		return false
+	}
+	for _, sg := range rpi.ShardGroups {
+		for _, sh := range sg.Shards {
+			if sh.ID == id {
+				return true
+			}
+		}
+	}
+	return false
+}
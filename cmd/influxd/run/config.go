@@ -19,16 +19,19 @@ import (
 	"github.com/lucaswiersma/influxdb/monitor"
 	"github.com/lucaswiersma/influxdb/monitor/diagnostics"
 	"github.com/lucaswiersma/influxdb/services/admin"
+	"github.com/lucaswiersma/influxdb/services/backup"
 	"github.com/lucaswiersma/influxdb/services/collectd"
 	"github.com/lucaswiersma/influxdb/services/continuous_querier"
 	"github.com/lucaswiersma/influxdb/services/graphite"
 	"github.com/lucaswiersma/influxdb/services/httpd"
+	"github.com/lucaswiersma/influxdb/services/integrity"
 	"github.com/lucaswiersma/influxdb/services/meta"
 	"github.com/lucaswiersma/influxdb/services/opentsdb"
 	"github.com/lucaswiersma/influxdb/services/precreator"
 	"github.com/lucaswiersma/influxdb/services/retention"
 	"github.com/lucaswiersma/influxdb/services/subscriber"
 	"github.com/lucaswiersma/influxdb/services/udp"
+	"github.com/lucaswiersma/influxdb/services/wavefront"
 	"github.com/lucaswiersma/influxdb/tsdb"
 )
 
@@ -44,15 +47,18 @@ type Config struct {
 	Coordinator coordinator.Config `toml:"coordinator"`
 	Retention   retention.Config   `toml:"retention"`
 	Precreator  precreator.Config  `toml:"shard-precreation"`
-
-	Admin          admin.Config      `toml:"admin"`
-	Monitor        monitor.Config    `toml:"monitor"`
-	Subscriber     subscriber.Config `toml:"subscriber"`
-	HTTPD          httpd.Config      `toml:"http"`
-	GraphiteInputs []graphite.Config `toml:"graphite"`
-	CollectdInputs []collectd.Config `toml:"collectd"`
-	OpenTSDBInputs []opentsdb.Config `toml:"opentsdb"`
-	UDPInputs      []udp.Config      `toml:"udp"`
+	Backup      backup.Config      `toml:"backup"`
+	Integrity   integrity.Config   `toml:"integrity"`
+
+	Admin           admin.Config       `toml:"admin"`
+	Monitor         monitor.Config     `toml:"monitor"`
+	Subscriber      subscriber.Config  `toml:"subscriber"`
+	HTTPD           httpd.Config       `toml:"http"`
+	GraphiteInputs  []graphite.Config  `toml:"graphite"`
+	CollectdInputs  []collectd.Config  `toml:"collectd"`
+	OpenTSDBInputs  []opentsdb.Config  `toml:"opentsdb"`
+	WavefrontInputs []wavefront.Config `toml:"wavefront"`
+	UDPInputs       []udp.Config       `toml:"udp"`
 
 	ContinuousQuery continuous_querier.Config `toml:"continuous_queries"`
 
@@ -70,6 +76,8 @@ func NewConfig() *Config {
 	c.Data = tsdb.NewConfig()
 	c.Coordinator = coordinator.NewConfig()
 	c.Precreator = precreator.NewConfig()
+	c.Backup = backup.NewConfig()
+	c.Integrity = integrity.NewConfig()
 
 	c.Admin = admin.NewConfig()
 	c.Monitor = monitor.NewConfig()
@@ -79,6 +87,7 @@ func NewConfig() *Config {
 	c.GraphiteInputs = []graphite.Config{graphite.NewConfig()}
 	c.CollectdInputs = []collectd.Config{collectd.NewConfig()}
 	c.OpenTSDBInputs = []opentsdb.Config{opentsdb.NewConfig()}
+	c.WavefrontInputs = []wavefront.Config{wavefront.NewConfig()}
 	c.UDPInputs = []udp.Config{udp.NewConfig()}
 
 	c.ContinuousQuery = continuous_querier.NewConfig()
@@ -152,6 +161,14 @@ func (c *Config) Validate() error {
 		return err
 	}
 
+	if err := c.Coordinator.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.HTTPD.Validate(); err != nil {
+		return err
+	}
+
 	if err := c.Monitor.Validate(); err != nil {
 		return err
 	}
@@ -168,6 +185,14 @@ func (c *Config) Validate() error {
 		return err
 	}
 
+	if err := c.Backup.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.Integrity.Validate(); err != nil {
+		return err
+	}
+
 	if err := c.Subscriber.Validate(); err != nil {
 		return err
 	}
@@ -326,6 +351,8 @@ func (c *Config) diagnosticsClients() map[string]diagnostics.Client {
 		"config-coordinator": c.Coordinator,
 		"config-retention":   c.Retention,
 		"config-precreator":  c.Precreator,
+		"config-backup":      c.Backup,
+		"config-integrity":   c.Integrity,
 
 		"config-monitor":    c.Monitor,
 		"config-subscriber": c.Subscriber,
@@ -344,6 +371,9 @@ func (c *Config) diagnosticsClients() map[string]diagnostics.Client {
 	if t := opentsdb.Configs(c.OpenTSDBInputs); t.Enabled() {
 		m["config-opentsdb"] = t
 	}
+	if w := wavefront.Configs(c.WavefrontInputs); w.Enabled() {
+		m["config-wavefront"] = w
+	}
 	if u := udp.Configs(c.UDPInputs); u.Enabled() {
 		m["config-udp"] = u
 	}
@@ -16,11 +16,14 @@ import (
 	"github.com/lucaswiersma/influxdb/influxql"
 	"github.com/lucaswiersma/influxdb/models"
 	"github.com/lucaswiersma/influxdb/monitor"
+	"github.com/lucaswiersma/influxdb/monitor/diagnostics"
 	"github.com/lucaswiersma/influxdb/services/admin"
+	"github.com/lucaswiersma/influxdb/services/backup"
 	"github.com/lucaswiersma/influxdb/services/collectd"
 	"github.com/lucaswiersma/influxdb/services/continuous_querier"
 	"github.com/lucaswiersma/influxdb/services/graphite"
 	"github.com/lucaswiersma/influxdb/services/httpd"
+	"github.com/lucaswiersma/influxdb/services/integrity"
 	"github.com/lucaswiersma/influxdb/services/meta"
 	"github.com/lucaswiersma/influxdb/services/opentsdb"
 	"github.com/lucaswiersma/influxdb/services/precreator"
@@ -28,6 +31,7 @@ import (
 	"github.com/lucaswiersma/influxdb/services/snapshotter"
 	"github.com/lucaswiersma/influxdb/services/subscriber"
 	"github.com/lucaswiersma/influxdb/services/udp"
+	"github.com/lucaswiersma/influxdb/services/wavefront"
 	"github.com/lucaswiersma/influxdb/tcp"
 	"github.com/lucaswiersma/influxdb/tsdb"
 	client "github.com/influxdata/usage-client/v1"
@@ -71,6 +75,12 @@ type Server struct {
 	PointsWriter  *coordinator.PointsWriter
 	Subscriber    *subscriber.Service
 
+	// MetaQueryLimiter limits the rate of metadata queries, if enabled.
+	MetaQueryLimiter *coordinator.MetaQueryLimiter
+
+	// ReadRollups materializes query results, if enabled.
+	ReadRollups *coordinator.ReadRollups
+
 	Services []Service
 
 	// These references are required for the tcp muxer.
@@ -168,15 +178,43 @@ func NewServer(c *Config, buildInfo *BuildInfo) (*Server, error) {
 	// Copy TSDB configuration.
 	s.TSDBStore.EngineOptions.EngineVersion = c.Data.Engine
 
+	// Report write hotspots in SHOW DIAGNOSTICS, if enabled.
+	if c.Data.WriteHotspotSampleRate > 0 {
+		s.Monitor.RegisterDiagnosticsClient("write-hotspots", diagnostics.ClientFunc(s.TSDBStore.WriteHotspotDiagnostics))
+	}
+
 	// Create the Subscriber service
 	s.Subscriber = subscriber.NewService(c.Subscriber)
 
 	// Initialize points writer.
 	s.PointsWriter = coordinator.NewPointsWriter()
 	s.PointsWriter.WriteTimeout = time.Duration(c.Coordinator.WriteTimeout)
+	s.PointsWriter.WriteSampling = c.Coordinator.WriteSampling
+	s.PointsWriter.MetaRetryTimeout = time.Duration(c.Coordinator.MetaRetryTimeout)
+	s.PointsWriter.MetaRetryInterval = time.Duration(c.Coordinator.MetaRetryInterval)
 	s.PointsWriter.TSDBStore = s.TSDBStore
 	s.PointsWriter.Subscriber = s.Subscriber
 
+	// Initialize the metadata query rate limiter, if enabled.
+	if c.Coordinator.MaxMetaQueryRate > 0 {
+		s.MetaQueryLimiter = coordinator.NewMetaQueryLimiter(c.Coordinator.MaxMetaQueryRate, c.Coordinator.MaxMetaQueryBurst)
+	}
+
+	// Initialize the materialized query results, if enabled.
+	if c.Coordinator.ReadRollupsEnabled {
+		s.ReadRollups = coordinator.NewReadRollups(c.Coordinator.MaxReadRollups, c.Coordinator.MaxReadRollupPoints, time.Duration(c.Coordinator.ReadRollupMinRange))
+		s.ReadRollups.MetaClient = s.MetaClient
+		s.ReadRollups.TSDBStore = s.TSDBStore
+		s.PointsWriter.ReadRollups = s.ReadRollups
+	}
+
+	// Coordinate queries with schema changes, if enabled.
+	var schemaGuard *coordinator.SchemaGuard
+	switch c.Coordinator.SchemaChangePolicy {
+	case coordinator.SchemaChangeSnapshot, coordinator.SchemaChangeError:
+		schemaGuard = coordinator.NewSchemaGuard(c.Coordinator.SchemaChangePolicy)
+	}
+
 	// Initialize query executor.
 	s.QueryExecutor = influxql.NewQueryExecutor()
 	s.QueryExecutor.StatementExecutor = &coordinator.StatementExecutor{
@@ -184,19 +222,46 @@ func NewServer(c *Config, buildInfo *BuildInfo) (*Server, error) {
 		TaskManager: s.QueryExecutor.TaskManager,
 		TSDBStore:   coordinator.LocalTSDBStore{Store: s.TSDBStore},
 		ShardMapper: &coordinator.LocalShardMapper{
-			MetaClient: s.MetaClient,
-			TSDBStore:  coordinator.LocalTSDBStore{Store: s.TSDBStore},
+			MetaClient:           s.MetaClient,
+			TSDBStore:            coordinator.LocalTSDBStore{Store: s.TSDBStore},
+			SkipUnreadableShards: c.Coordinator.SkipUnreadableShards,
+		},
+		Monitor:                  s.Monitor,
+		PointsWriter:             s.PointsWriter,
+		MaxSelectPointN:          c.Coordinator.MaxSelectPointN,
+		MaxSelectSeriesN:         c.Coordinator.MaxSelectSeriesN,
+		MaxSelectBucketsN:        c.Coordinator.MaxSelectBucketsN,
+		MaxSelectCost:            c.Coordinator.MaxSelectCost,
+		IteratorBufferSize:       c.Coordinator.IteratorBufferSize,
+		MaxTagValues:             c.Coordinator.MaxTagValues,
+		StrictTypeCasts:          c.Coordinator.StrictTypeCasts,
+		ProjectionOrderedColumns: c.Coordinator.ProjectionOrderedColumns,
+		DuplicateColumns:         c.Coordinator.DuplicateColumns,
+		DefaultSelectLimit:       c.Coordinator.DefaultSelectLimit,
+		MaxSelectSeriesRows:      c.Coordinator.MaxSelectSeriesRows,
+		MaxSelectRows:            c.Coordinator.MaxSelectRows,
+		SampleSeries:             c.Coordinator.SampleSeries,
+		SampleSeriesBy:           c.Coordinator.SampleSeriesBy,
+		MetaQueryLimiter:         s.MetaQueryLimiter,
+		SchemaGuard:              schemaGuard,
+
+		MaxShardGroupsPerRetentionPolicy: c.Coordinator.MaxShardGroupsPerRetentionPolicy,
+		ReadRollups:                      s.ReadRollups,
+		SelectCostWeights: coordinator.SelectCostWeights{
+			Series: c.Coordinator.SelectCostSeriesWeight,
+			Hour:   c.Coordinator.SelectCostHourWeight,
+			Bucket: c.Coordinator.SelectCostBucketWeight,
 		},
-		Monitor:           s.Monitor,
-		PointsWriter:      s.PointsWriter,
-		MaxSelectPointN:   c.Coordinator.MaxSelectPointN,
-		MaxSelectSeriesN:  c.Coordinator.MaxSelectSeriesN,
-		MaxSelectBucketsN: c.Coordinator.MaxSelectBucketsN,
 	}
 	s.QueryExecutor.TaskManager.QueryTimeout = time.Duration(c.Coordinator.QueryTimeout)
 	s.QueryExecutor.TaskManager.LogQueriesAfter = time.Duration(c.Coordinator.LogQueriesAfter)
 	s.QueryExecutor.TaskManager.MaxConcurrentQueries = c.Coordinator.MaxConcurrentQueries
 
+	// Back off compactions under query load, if enabled.
+	if c.Data.CompactionBackoffQueries > 0 {
+		s.TSDBStore.EngineOptions.ActiveQueries = s.QueryExecutor.ActiveQueries
+	}
+
 	// Initialize the monitor
 	s.Monitor.Version = s.buildInfo.Version
 	s.Monitor.Commit = s.buildInfo.Commit
@@ -213,6 +278,13 @@ func (s *Server) Statistics(tags map[string]string) []models.Statistic {
 	statistics = append(statistics, s.TSDBStore.Statistics(tags)...)
 	statistics = append(statistics, s.PointsWriter.Statistics(tags)...)
 	statistics = append(statistics, s.Subscriber.Statistics(tags)...)
+	statistics = append(statistics, s.MetaClient.Statistics(tags)...)
+	if s.MetaQueryLimiter != nil {
+		statistics = append(statistics, s.MetaQueryLimiter.Statistics(tags)...)
+	}
+	if s.ReadRollups != nil {
+		statistics = append(statistics, s.ReadRollups.Statistics(tags)...)
+	}
 	for _, srv := range s.Services {
 		if m, ok := srv.(monitor.Reporter); ok {
 			statistics = append(statistics, m.Statistics(tags)...)
@@ -249,6 +321,26 @@ func (s *Server) appendRetentionPolicyService(c retention.Config) {
 	s.Services = append(s.Services, srv)
 }
 
+func (s *Server) appendBackupService(c backup.Config) {
+	if !c.Enabled {
+		return
+	}
+	srv := backup.NewService(c)
+	srv.MetaClient = s.MetaClient
+	srv.TSDBStore = s.TSDBStore
+	srv.Snapshotter = s.SnapshotterService
+	s.Services = append(s.Services, srv)
+}
+
+func (s *Server) appendIntegrityService(c integrity.Config) {
+	if !c.Enabled {
+		return
+	}
+	srv := integrity.NewService(c)
+	srv.TSDBStore = s.TSDBStore
+	s.Services = append(s.Services, srv)
+}
+
 func (s *Server) appendAdminService(c admin.Config) {
 	if !c.Enabled {
 		return
@@ -298,6 +390,20 @@ func (s *Server) appendOpenTSDBService(c opentsdb.Config) error {
 	return nil
 }
 
+func (s *Server) appendWavefrontService(c wavefront.Config) error {
+	if !c.Enabled {
+		return nil
+	}
+	srv, err := wavefront.NewService(c)
+	if err != nil {
+		return err
+	}
+	srv.PointsWriter = s.PointsWriter
+	srv.MetaClient = s.MetaClient
+	s.Services = append(s.Services, srv)
+	return nil
+}
+
 func (s *Server) appendGraphiteService(c graphite.Config) error {
 	if !c.Enabled {
 		return nil
@@ -371,6 +477,8 @@ func (s *Server) Open() error {
 	s.appendMonitorService()
 	s.appendPrecreatorService(s.config.Precreator)
 	s.appendSnapshotterService()
+	s.appendBackupService(s.config.Backup)
+	s.appendIntegrityService(s.config.Integrity)
 	s.appendAdminService(s.config.Admin)
 	s.appendContinuousQueryService(s.config.ContinuousQuery)
 	s.appendHTTPDService(s.config.HTTPD)
@@ -388,6 +496,11 @@ func (s *Server) Open() error {
 			return err
 		}
 	}
+	for _, i := range s.config.WavefrontInputs {
+		if err := s.appendWavefrontService(i); err != nil {
+			return err
+		}
+	}
 	for _, i := range s.config.UDPInputs {
 		s.appendUDPService(i)
 	}
@@ -408,6 +521,9 @@ func (s *Server) Open() error {
 		s.QueryExecutor.WithLogger(s.Logger)
 	}
 	s.PointsWriter.WithLogger(s.Logger)
+	if s.ReadRollups != nil {
+		s.ReadRollups.WithLogger(s.Logger)
+	}
 	s.Subscriber.WithLogger(s.Logger)
 	for _, svc := range s.Services {
 		svc.WithLogger(s.Logger)
@@ -430,6 +546,13 @@ func (s *Server) Open() error {
 		return fmt.Errorf("open points writer: %s", err)
 	}
 
+	// Create the rollup database and drop the rollups of a previous run.
+	if s.ReadRollups != nil {
+		if err := s.ReadRollups.Open(); err != nil {
+			return fmt.Errorf("open read rollups: %s", err)
+		}
+	}
+
 	for _, service := range s.Services {
 		if err := service.Open(); err != nil {
 			return fmt.Errorf("open service: %s", err)
@@ -460,6 +583,7 @@ func (s *Server) Close() error {
 	}
 
 	s.config.deregisterDiagnostics(s.Monitor)
+	s.Monitor.DeregisterDiagnosticsClient("write-hotspots")
 
 	if s.PointsWriter != nil {
 		s.PointsWriter.Close()
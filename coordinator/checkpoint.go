@@ -0,0 +1,140 @@
+package coordinator
+
+import (
+	"time"
+
+	"github.com/lucaswiersma/influxdb/influxql"
+	"github.com/lucaswiersma/influxdb/models"
+)
+
+// checkpointer tracks the last point of the rows of a SELECT returned to the
+// client, and skips the points that were returned before a checkpoint the
+// query resumes from. Rows are expected in the order they are emitted, so a
+// query resumes correctly if it is run again over the same data.
+type checkpointer struct {
+	ascending bool
+
+	// last is the last point returned.
+	last    influxql.Checkpoint
+	hasLast bool
+
+	// resume is the checkpoint points are skipped up to. It is cleared once
+	// a point after it is found.
+	resume  *influxql.Checkpoint
+	skipped int
+	found   bool
+}
+
+// newCheckpointer returns a checkpointer for rows emitted in ascending or
+// descending time order that resumes after resume, if it is not nil.
+func newCheckpointer(ascending bool, resume *influxql.Checkpoint) *checkpointer {
+	c := &checkpointer{ascending: ascending, resume: resume}
+	if resume != nil {
+		// Points at the time of the checkpoint continue to be counted.
+		c.last, c.hasLast = *resume, true
+	}
+	return c
+}
+
+// filter removes the points of row up to the checkpoint being resumed from.
+// Returns nil if no points are left.
+func (c *checkpointer) filter(row *models.Row) *models.Row {
+	if c.resume == nil {
+		return row
+	}
+
+	if !c.sameSeries(row, c.resume) {
+		if c.found {
+			// All points of the checkpoint's series were returned before.
+			c.resume = nil
+			return row
+		}
+		return nil
+	}
+	c.found = true
+
+	ti := timeColumn(row.Columns)
+	if ti < 0 {
+		return nil
+	}
+
+	values := row.Values
+	for len(values) > 0 {
+		t := pointTime(values[0], ti)
+		if (c.ascending && t < c.resume.Time) || (!c.ascending && t > c.resume.Time) {
+			values = values[1:]
+			continue
+		} else if t == c.resume.Time && c.skipped < c.resume.N {
+			c.skipped++
+			values = values[1:]
+			continue
+		}
+		c.resume = nil
+		break
+	}
+
+	if len(values) == 0 {
+		return nil
+	}
+	row.Values = values
+	return row
+}
+
+// record updates the last point returned with the points of row.
+func (c *checkpointer) record(row *models.Row) {
+	ti := timeColumn(row.Columns)
+	if ti < 0 {
+		return
+	}
+
+	if !c.hasLast || !c.sameSeries(row, &c.last) {
+		c.last = influxql.Checkpoint{Name: row.Name, Tags: row.Tags}
+		c.hasLast = false
+	}
+	for _, values := range row.Values {
+		if t := pointTime(values, ti); c.hasLast && t == c.last.Time {
+			c.last.N++
+		} else {
+			c.last.Time, c.last.N = t, 1
+			c.hasLast = true
+		}
+	}
+}
+
+// checkpoint returns the token of the last point returned, or an empty
+// string if no point has been returned.
+func (c *checkpointer) checkpoint() string {
+	if !c.hasLast {
+		return ""
+	}
+	return c.last.String()
+}
+
+// sameSeries returns true if row belongs to the series of checkpoint cp.
+func (c *checkpointer) sameSeries(row *models.Row, cp *influxql.Checkpoint) bool {
+	if row.Name != cp.Name || len(row.Tags) != len(cp.Tags) {
+		return false
+	}
+	for k, v := range row.Tags {
+		if cv, ok := cp.Tags[k]; !ok || cv != v {
+			return false
+		}
+	}
+	return true
+}
+
+// timeColumn returns the index of the time column, or -1 if there is none.
+func timeColumn(columns []string) int {
+	for i, name := range columns {
+		if name == "time" {
+			return i
+		}
+	}
+	return -1
+}
+
+// pointTime returns the time of a point in nanoseconds.
+func pointTime(values []interface{}, ti int) int64 {
+	t, _ := values[ti].(time.Time)
+	return t.UnixNano()
+}
@@ -0,0 +1,244 @@
+package coordinator
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/lucaswiersma/influxdb/influxql"
+	"github.com/lucaswiersma/influxdb/models"
+)
+
+// compareStatement is a SELECT statement with a COMPARE clause. The statement
+// is executed over its own time range and over the same time range shifted
+// back by the offset of the clause, such as the week before, and the buckets
+// of both are aligned by time.
+type compareStatement struct {
+	stmt   *influxql.SelectStatement
+	offset time.Duration
+	op     influxql.CompareOp
+
+	// current and previous read the current and the earlier time range.
+	current, previous *influxql.SelectStatement
+}
+
+// newCompareStatement returns the statements that read both time ranges of
+// stmt. The time range must have a lower bound and ends at now if it has no
+// upper bound.
+func newCompareStatement(stmt *influxql.SelectStatement, now time.Time) (*compareStatement, error) {
+	s := stmt.Reduce(&influxql.NowValuer{Now: now})
+	min, max, err := influxql.TimeRange(s.Condition)
+	if err != nil {
+		return nil, err
+	} else if min.IsZero() {
+		return nil, errors.New("COMPARE requires a lower bound on time")
+	} else if max.IsZero() {
+		max = now
+	}
+	s.Compare = nil
+
+	cs := &compareStatement{
+		stmt:   stmt,
+		offset: stmt.Compare.Offset,
+		op:     stmt.Compare.Op,
+	}
+	if cs.current, err = shiftTimeRange(s, min, max, 0); err != nil {
+		return nil, err
+	}
+	if cs.previous, err = shiftTimeRange(s, min, max, cs.offset); err != nil {
+		return nil, err
+	}
+	return cs, nil
+}
+
+// shiftTimeRange returns a copy of stmt that reads the time range between min
+// and max, both inclusive, moved back by offset.
+func shiftTimeRange(stmt *influxql.SelectStatement, min, max time.Time, offset time.Duration) (*influxql.SelectStatement, error) {
+	other := stmt.Clone()
+	if err := other.SetTimeRange(min.Add(-offset), max.Add(-offset).Add(time.Nanosecond)); err != nil {
+		return nil, err
+	}
+	return other, nil
+}
+
+// merge aligns the rows of the earlier time range with the rows of the
+// current time range. columns are the columns of the current time range.
+// Columns found only in the earlier time range are left out.
+func (cs *compareStatement) merge(columns []string, rows [2][]*models.Row) []*models.Row {
+	fields := columns[1:]
+	index := make(map[string]int, len(fields))
+	for i, name := range fields {
+		index[name] = i
+	}
+
+	type comparePoint struct {
+		values [2][]interface{}
+		seen   [2]bool
+	}
+	type compareSeries struct {
+		name   string
+		tags   map[string]string
+		points map[int64]*comparePoint
+	}
+
+	// Series are returned in the order they are first read.
+	series := make(map[string]*compareSeries)
+	var keys []string
+	for i := range rows {
+		for _, row := range rows[i] {
+			key := row.Name + string(models.NewTags(row.Tags).HashKey())
+			s := series[key]
+			if s == nil {
+				s = &compareSeries{name: row.Name, tags: row.Tags, points: make(map[int64]*comparePoint)}
+				series[key] = s
+				keys = append(keys, key)
+			}
+
+			for _, v := range row.Values {
+				t := v[0].(time.Time).UnixNano()
+				if i == 1 {
+					t += int64(cs.offset)
+				}
+				p := s.points[t]
+				if p == nil {
+					p = &comparePoint{}
+					p.values[0] = make([]interface{}, len(fields))
+					p.values[1] = make([]interface{}, len(fields))
+					s.points[t] = p
+				}
+				if p.seen[i] {
+					continue
+				}
+				for j, name := range row.Columns[1:] {
+					if k, ok := index[name]; ok {
+						p.values[i][k] = v[j+1]
+					}
+				}
+				p.seen[i] = true
+			}
+		}
+	}
+
+	// Add a column with the previous value of each column, followed by a
+	// column with the computed value, if any.
+	out := append([]string(nil), columns...)
+	for _, name := range fields {
+		out = append(out, name+"_previous")
+	}
+	switch cs.op {
+	case influxql.CompareDifference:
+		for _, name := range fields {
+			out = append(out, name+"_difference")
+		}
+	case influxql.CompareRatio:
+		for _, name := range fields {
+			out = append(out, name+"_ratio")
+		}
+	}
+
+	result := make([]*models.Row, 0, len(keys))
+	for _, key := range keys {
+		s := series[key]
+
+		times := make([]int64, 0, len(s.points))
+		for t := range s.points {
+			times = append(times, t)
+		}
+		if cs.stmt.TimeAscending() {
+			sort.Sort(int64Slice(times))
+		} else {
+			sort.Sort(sort.Reverse(int64Slice(times)))
+		}
+
+		row := &models.Row{
+			Name:    s.name,
+			Tags:    s.tags,
+			Columns: out,
+			Values:  make([][]interface{}, len(times)),
+		}
+		for i, t := range times {
+			p := s.points[t]
+			values := make([]interface{}, 0, len(out))
+			values = append(values, time.Unix(0, t).UTC())
+			values = append(values, p.values[0]...)
+			values = append(values, p.values[1]...)
+			if cs.op != influxql.CompareNone {
+				for j := range fields {
+					values = append(values, compareValues(cs.op, p.values[0][j], p.values[1][j]))
+				}
+			}
+			row.Values[i] = values
+		}
+		result = append(result, row)
+	}
+	return result
+}
+
+// compareValues returns the difference or ratio of the current and previous
+// value of a column. Returns nil unless both values are numbers or if the
+// ratio divides by zero. The difference of two integers is an integer.
+func compareValues(op influxql.CompareOp, cur, prev interface{}) interface{} {
+	if !isNumeric(cur) || !isNumeric(prev) {
+		return nil
+	}
+
+	switch op {
+	case influxql.CompareDifference:
+		if a, ok := cur.(int64); ok {
+			if b, ok := prev.(int64); ok {
+				return a - b
+			}
+		}
+		return toFloat(cur) - toFloat(prev)
+	case influxql.CompareRatio:
+		if b := toFloat(prev); b != 0 {
+			return toFloat(cur) / b
+		}
+	}
+	return nil
+}
+
+// executeCompareStatement reads both time ranges of a comparison and sends
+// the aligned rows as a single result.
+func (e *StatementExecutor) executeCompareStatement(cs *compareStatement, ctx *influxql.ExecutionContext, schema *schemaRead) error {
+	var rows [2][]*models.Row
+	var columns []string
+	var messages []*influxql.Message
+	seen := make(map[string]bool)
+	for i, stmt := range []*influxql.SelectStatement{cs.current, cs.previous} {
+		stmt, msgs, err := e.readRows(stmt, ctx, func(row *models.Row) {
+			rows[i] = append(rows[i], row)
+		})
+		if err != nil {
+			return err
+		}
+		messages = appendUniqueMessages(messages, seen, msgs)
+
+		// Cast and convert each time range before the columns are moved.
+		casts := columnCasts(stmt)
+		conversions := columnConversions(stmt)
+		for _, row := range rows[i] {
+			if casts != nil {
+				if err := e.castRow(row, casts); err != nil {
+					return err
+				}
+			}
+			if conversions != nil {
+				convertRow(row, conversions)
+			}
+		}
+
+		if i == 0 {
+			columns = stmt.ColumnNames()
+		}
+	}
+
+	if err := schema.check(); err != nil {
+		return err
+	}
+	return ctx.Send(&influxql.Result{
+		StatementID: ctx.StatementID,
+		Messages:    messages,
+		Series:      cs.merge(columns, rows),
+	})
+}
@@ -3,6 +3,8 @@
 package coordinator
 
 import (
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/lucaswiersma/influxdb/influxql"
@@ -25,6 +27,86 @@ const (
 	// DefaultMaxSelectSeriesN is the maximum number of series a SELECT can run.
 	// A value of zero will make the maximum series count unlimited.
 	DefaultMaxSelectSeriesN = 0
+
+	// DefaultMaxSelectCost is the maximum estimated cost of a SELECT.
+	// A value of zero disables cost estimation.
+	DefaultMaxSelectCost = 0
+
+	// DefaultSelectCostWeight is the default weight of each factor of the
+	// estimated cost of a SELECT.
+	DefaultSelectCostWeight = 1.0
+
+	// DefaultMaxShardGroupsPerRetentionPolicy is the maximum number of shard
+	// groups a retention policy can span. A value of zero makes it unlimited.
+	DefaultMaxShardGroupsPerRetentionPolicy = 0
+
+	// DefaultMaxReadRollups is the default maximum number of materialized
+	// query results kept.
+	DefaultMaxReadRollups = 100
+
+	// DefaultMaxReadRollupPoints is the default maximum number of points in a
+	// materialized query result.
+	DefaultMaxReadRollupPoints = 100000
+
+	// DefaultReadRollupMinRange is the default shortest time range of a query
+	// that is materialized.
+	DefaultReadRollupMinRange = 24 * time.Hour
+
+	// DefaultMaxMetaQueryRate is the maximum number of metadata queries that
+	// can run per second. A value of zero will make the rate unlimited.
+	DefaultMaxMetaQueryRate = 0
+
+	// DefaultMaxTagValues is the maximum number of tag values SHOW TAG VALUES
+	// returns for each measurement. A value of zero makes it unlimited.
+	DefaultMaxTagValues = 0
+
+	// DefaultMetaRetryInterval is the default wait before the first retry of
+	// a metadata operation of a write.
+	DefaultMetaRetryInterval = 100 * time.Millisecond
+
+	// DefaultDuplicateColumns is how duplicate column names of a SELECT are
+	// handled by default.
+	DefaultDuplicateColumns = DuplicateColumnsAllow
+
+	// DefaultSampleSeriesBy is how the series of a sampled SELECT are ranked
+	// by default.
+	DefaultSampleSeriesBy = influxql.SampleSeriesPoints
+
+	// DefaultSchemaChangePolicy is how SELECT statements running while the
+	// schema of their database changes are handled by default.
+	DefaultSchemaChangePolicy = SchemaChangeIgnore
+)
+
+const (
+	// DuplicateColumnsAllow keeps the repeated aliases of a SELECT. Names
+	// generated from expressions are always suffixed, such as "value_1".
+	DuplicateColumnsAllow = "allow"
+
+	// DuplicateColumnsSuffix renames each repeated column name of a SELECT,
+	// including aliases, by adding a numbered suffix, such as "value_1".
+	DuplicateColumnsSuffix = "suffix"
+
+	// DuplicateColumnsError rejects a SELECT with repeated column names.
+	DuplicateColumnsError = "error"
+)
+
+// Policies for SELECT statements that run while a statement changes the schema
+// of a database they read, such as DROP MEASUREMENT, DROP SERIES, DELETE, DROP
+// RETENTION POLICY, DROP SHARD or DROP DATABASE.
+const (
+	// SchemaChangeIgnore runs both statements at once. The SELECT may return
+	// some of the data that is being removed and not the rest.
+	SchemaChangeIgnore = "ignore"
+
+	// SchemaChangeSnapshot makes a schema change wait for the SELECT
+	// statements reading the database to finish, and SELECT statements that
+	// start later wait for the change, so every SELECT reads the schema as
+	// it was when it started.
+	SchemaChangeSnapshot = "snapshot"
+
+	// SchemaChangeError fails a SELECT with ErrSchemaChanged when the schema
+	// of a database it reads changes while it runs.
+	SchemaChangeError = "error"
 )
 
 // Config represents the configuration for the coordinator service.
@@ -36,6 +118,97 @@ type Config struct {
 	MaxSelectPointN      int           `toml:"max-select-point"`
 	MaxSelectSeriesN     int           `toml:"max-select-series"`
 	MaxSelectBucketsN    int           `toml:"max-select-buckets"`
+	StrictTypeCasts      bool          `toml:"strict-type-casts"`
+
+	// MaxSelectCost rejects a SELECT before it is executed when its
+	// estimated cost exceeds the budget. The cost is the product of one
+	// factor each for the series, hours and GROUP BY buckets the query
+	// covers, where each factor is 1 + weight*quantity.
+	MaxSelectCost          float64 `toml:"max-select-cost"`
+	SelectCostSeriesWeight float64 `toml:"select-cost-series-weight"`
+	SelectCostHourWeight   float64 `toml:"select-cost-hour-weight"`
+	SelectCostBucketWeight float64 `toml:"select-cost-bucket-weight"`
+
+	// MaxShardGroupsPerRetentionPolicy rejects CREATE and ALTER RETENTION
+	// POLICY statements whose duration spans more shard groups than this,
+	// counting the shard groups of isolated measurements.
+	MaxShardGroupsPerRetentionPolicy int `toml:"max-shard-groups-per-retention-policy"`
+
+	// ReadRollupsEnabled materializes the result of a GROUP BY time query over
+	// a fixed, past time range into a rollup measurement the first time it is
+	// run. Identical queries read the rollup until points are written to the
+	// source measurement within the time range.
+	ReadRollupsEnabled  bool          `toml:"read-rollups-enabled"`
+	MaxReadRollups      int           `toml:"max-read-rollups"`
+	MaxReadRollupPoints int           `toml:"max-read-rollup-points"`
+	ReadRollupMinRange  toml.Duration `toml:"read-rollup-min-range"`
+
+	// MaxMetaQueryRate limits the number of SHOW SERIES, MEASUREMENTS,
+	// TAG KEYS, TAG VALUES and FIELD KEYS queries per second. Bursts of up
+	// to MaxMetaQueryBurst queries are allowed.
+	MaxMetaQueryRate  float64 `toml:"max-meta-query-rate"`
+	MaxMetaQueryBurst int     `toml:"max-meta-query-burst"`
+
+	// MaxTagValues truncates the values SHOW TAG VALUES returns for each
+	// measurement to this many, adding a warning to the results.
+	MaxTagValues int `toml:"max-tag-values"`
+
+	// ProjectionOrderedColumns emits result columns in the order given in the
+	// SELECT projection, including an explicitly selected time column.
+	ProjectionOrderedColumns bool `toml:"projection-ordered-columns"`
+
+	// DuplicateColumns determines how a SELECT with more than one column of
+	// the same name, such as SELECT a AS v, b AS v, is handled. It is one of
+	// "allow", "suffix" or "error".
+	DuplicateColumns string `toml:"duplicate-columns"`
+
+	// DefaultSelectLimit is added as the LIMIT of raw SELECT statements that
+	// have none, limiting the points returned for each series. Queries can
+	// opt out. Zero disables it.
+	DefaultSelectLimit int `toml:"default-select-limit"`
+
+	// MaxSelectSeriesRows truncates each series a SELECT returns to this
+	// many rows and MaxSelectRows truncates the rows of all of its series
+	// together, adding a warning to the results. Both are applied after
+	// the statement's own LIMIT, OFFSET, SLIMIT and SOFFSET. Zero disables
+	// them.
+	MaxSelectSeriesRows int `toml:"max-select-series-rows"`
+	MaxSelectRows       int `toml:"max-select-rows"`
+
+	// SampleSeries limits a SELECT from a single measurement with more
+	// series than this to that many of them, ranked by the points they have
+	// in the queried time range or by how recent their last point is, as set
+	// by SampleSeriesBy. The results end with a warning saying they were
+	// sampled. Queries can override both. Zero disables sampling.
+	SampleSeries   int    `toml:"sample-series"`
+	SampleSeriesBy string `toml:"sample-series-by"`
+
+	// SchemaChangePolicy determines how a SELECT is handled when a statement
+	// changes the schema of a database it reads while it runs. It is one of
+	// "ignore", "snapshot" or "error".
+	SchemaChangePolicy string `toml:"schema-change-policy"`
+
+	// SkipUnreadableShards lets queries read the remaining shards when some
+	// of the shards they cover failed to open, adding a warning to the
+	// results. Otherwise those queries return an error.
+	SkipUnreadableShards bool `toml:"skip-unreadable-shards"`
+
+	// IteratorBufferSize is the number of points iterators running in a
+	// separate goroutine read ahead. Larger buffers can improve throughput
+	// at the cost of memory. Queries can override it. Zero uses
+	// influxql.DefaultIteratorBufferSize.
+	IteratorBufferSize int `toml:"iterator-buffer-size"`
+
+	// WriteSampling keeps one in every N points written to each series of the
+	// configured measurements. Keys are of the form "database.measurement".
+	WriteSampling map[string]int `toml:"write-sampling"`
+
+	// MetaRetryTimeout is how long writes retry metadata operations, such as
+	// creating a shard group, that fail with a temporary error while the
+	// meta store changes leaders. The wait between attempts starts at
+	// MetaRetryInterval and doubles. Zero disables retries.
+	MetaRetryTimeout  toml.Duration `toml:"meta-retry-timeout"`
+	MetaRetryInterval toml.Duration `toml:"meta-retry-interval"`
 }
 
 // NewConfig returns an instance of Config with defaults.
@@ -46,18 +219,112 @@ func NewConfig() Config {
 		MaxConcurrentQueries: DefaultMaxConcurrentQueries,
 		MaxSelectPointN:      DefaultMaxSelectPointN,
 		MaxSelectSeriesN:     DefaultMaxSelectSeriesN,
+		MaxMetaQueryRate:     DefaultMaxMetaQueryRate,
+		MaxTagValues:         DefaultMaxTagValues,
+		DuplicateColumns:     DefaultDuplicateColumns,
+		SampleSeriesBy:       DefaultSampleSeriesBy,
+		SchemaChangePolicy:   DefaultSchemaChangePolicy,
+
+		MaxSelectCost:          DefaultMaxSelectCost,
+		SelectCostSeriesWeight: DefaultSelectCostWeight,
+		SelectCostHourWeight:   DefaultSelectCostWeight,
+		SelectCostBucketWeight: DefaultSelectCostWeight,
+
+		MaxShardGroupsPerRetentionPolicy: DefaultMaxShardGroupsPerRetentionPolicy,
+
+		MaxReadRollups:      DefaultMaxReadRollups,
+		MaxReadRollupPoints: DefaultMaxReadRollupPoints,
+		ReadRollupMinRange:  toml.Duration(DefaultReadRollupMinRange),
+
+		IteratorBufferSize: influxql.DefaultIteratorBufferSize,
+
+		MetaRetryInterval: toml.Duration(DefaultMetaRetryInterval),
+	}
+}
+
+// Validate returns an error if the Config is invalid.
+func (c Config) Validate() error {
+	if c.MaxMetaQueryRate < 0 {
+		return errors.New("max-meta-query-rate must be non-negative")
+	} else if c.MaxMetaQueryBurst < 0 {
+		return errors.New("max-meta-query-burst must be non-negative")
+	} else if c.MaxSelectCost < 0 {
+		return errors.New("max-select-cost must be non-negative")
+	} else if c.SelectCostSeriesWeight < 0 || c.SelectCostHourWeight < 0 || c.SelectCostBucketWeight < 0 {
+		return errors.New("select cost weights must be non-negative")
+	} else if c.DefaultSelectLimit < 0 {
+		return errors.New("default-select-limit must be non-negative")
+	} else if c.MaxSelectSeriesRows < 0 {
+		return errors.New("max-select-series-rows must be non-negative")
+	} else if c.MaxSelectRows < 0 {
+		return errors.New("max-select-rows must be non-negative")
+	} else if c.SampleSeries < 0 {
+		return errors.New("sample-series must be non-negative")
+	} else if c.MaxTagValues < 0 {
+		return errors.New("max-tag-values must be non-negative")
+	} else if c.MaxShardGroupsPerRetentionPolicy < 0 {
+		return errors.New("max-shard-groups-per-retention-policy must be non-negative")
+	} else if c.ReadRollupsEnabled && (c.MaxReadRollups <= 0 || c.MaxReadRollupPoints <= 0) {
+		return errors.New("max-read-rollups and max-read-rollup-points must be positive when read rollups are enabled")
+	} else if c.ReadRollupMinRange < 0 {
+		return errors.New("read-rollup-min-range must be non-negative")
+	} else if c.IteratorBufferSize < 0 || c.IteratorBufferSize > influxql.MaxIteratorBufferSize {
+		return fmt.Errorf("iterator-buffer-size must be between 0 and %d", influxql.MaxIteratorBufferSize)
+	} else if c.MetaRetryTimeout < 0 {
+		return errors.New("meta-retry-timeout must be non-negative")
+	} else if c.MetaRetryTimeout > 0 && c.MetaRetryInterval <= 0 {
+		return errors.New("meta-retry-interval must be positive when meta-retry-timeout is set")
+	}
+	switch c.DuplicateColumns {
+	case DuplicateColumnsAllow, DuplicateColumnsSuffix, DuplicateColumnsError:
+	default:
+		return fmt.Errorf("invalid duplicate-columns %q: must be %s, %s or %s", c.DuplicateColumns, DuplicateColumnsAllow, DuplicateColumnsSuffix, DuplicateColumnsError)
+	}
+	switch c.SampleSeriesBy {
+	case "", influxql.SampleSeriesPoints, influxql.SampleSeriesRecent:
+	default:
+		return fmt.Errorf("invalid sample-series-by %q: must be %s or %s", c.SampleSeriesBy, influxql.SampleSeriesPoints, influxql.SampleSeriesRecent)
+	}
+	switch c.SchemaChangePolicy {
+	case "", SchemaChangeIgnore, SchemaChangeSnapshot, SchemaChangeError:
+	default:
+		return fmt.Errorf("invalid schema-change-policy %q: must be %s, %s or %s", c.SchemaChangePolicy, SchemaChangeIgnore, SchemaChangeSnapshot, SchemaChangeError)
+	}
+	for key, n := range c.WriteSampling {
+		if n < 1 {
+			return fmt.Errorf("write-sampling rate for %s must be at least 1", key)
+		}
 	}
+	return nil
 }
 
 // Diagnostics returns a diagnostics representation of a subset of the Config.
 func (c Config) Diagnostics() (*diagnostics.Diagnostics, error) {
 	return diagnostics.RowFromMap(map[string]interface{}{
-		"write-timeout":          c.WriteTimeout,
-		"max-concurrent-queries": c.MaxConcurrentQueries,
-		"query-timeout":          c.QueryTimeout,
-		"log-queries-after":      c.LogQueriesAfter,
-		"max-select-point":       c.MaxSelectPointN,
-		"max-select-series":      c.MaxSelectSeriesN,
-		"max-select-buckets":     c.MaxSelectBucketsN,
+		"write-timeout":                         c.WriteTimeout,
+		"max-concurrent-queries":                c.MaxConcurrentQueries,
+		"query-timeout":                         c.QueryTimeout,
+		"log-queries-after":                     c.LogQueriesAfter,
+		"max-select-point":                      c.MaxSelectPointN,
+		"max-select-series":                     c.MaxSelectSeriesN,
+		"max-select-buckets":                    c.MaxSelectBucketsN,
+		"iterator-buffer-size":                  c.IteratorBufferSize,
+		"strict-type-casts":                     c.StrictTypeCasts,
+		"max-select-cost":                       c.MaxSelectCost,
+		"max-shard-groups-per-retention-policy": c.MaxShardGroupsPerRetentionPolicy,
+		"read-rollups-enabled":                  c.ReadRollupsEnabled,
+		"max-meta-query-rate":                   c.MaxMetaQueryRate,
+		"max-meta-query-burst":                  c.MaxMetaQueryBurst,
+		"max-tag-values":                        c.MaxTagValues,
+		"projection-ordered-columns":            c.ProjectionOrderedColumns,
+		"duplicate-columns":                     c.DuplicateColumns,
+		"default-select-limit":                  c.DefaultSelectLimit,
+		"max-select-series-rows":                c.MaxSelectSeriesRows,
+		"max-select-rows":                       c.MaxSelectRows,
+		"sample-series":                         c.SampleSeries,
+		"sample-series-by":                      c.SampleSeriesBy,
+		"schema-change-policy":                  c.SchemaChangePolicy,
+		"skip-unreadable-shards":                c.SkipUnreadableShards,
+		"meta-retry-timeout":                    c.MetaRetryTimeout,
 	}), nil
 }
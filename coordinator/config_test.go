@@ -6,6 +6,8 @@ import (
 
 	"github.com/BurntSushi/toml"
 	"github.com/lucaswiersma/influxdb/coordinator"
+	"github.com/lucaswiersma/influxdb/influxql"
+	itoml "github.com/lucaswiersma/influxdb/toml"
 )
 
 func TestConfig_Parse(t *testing.T) {
@@ -13,6 +15,9 @@ func TestConfig_Parse(t *testing.T) {
 	var c coordinator.Config
 	if _, err := toml.Decode(`
 write-timeout = "20s"
+
+[write-sampling]
+"db0.cpu" = 10
 `, &c); err != nil {
 		t.Fatal(err)
 	}
@@ -20,5 +25,50 @@ write-timeout = "20s"
 	// Validate configuration.
 	if time.Duration(c.WriteTimeout) != 20*time.Second {
 		t.Fatalf("unexpected write timeout s: %s", c.WriteTimeout)
+	} else if c.WriteSampling["db0.cpu"] != 10 {
+		t.Fatalf("unexpected write sampling: %v", c.WriteSampling)
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	c := coordinator.NewConfig()
+	if err := c.Validate(); err != nil {
+		t.Fatalf("unexpected validation error: %s", err)
+	}
+
+	c.WriteSampling = map[string]int{"db0.cpu": 0}
+	if err := c.Validate(); err == nil {
+		t.Fatal("expected error for invalid write-sampling rate")
+	}
+
+	c = coordinator.NewConfig()
+	c.MaxMetaQueryRate = -1
+	if err := c.Validate(); err == nil {
+		t.Fatal("expected error for negative max-meta-query-rate")
+	}
+
+	c = coordinator.NewConfig()
+	c.SelectCostHourWeight = -1
+	if err := c.Validate(); err == nil {
+		t.Fatal("expected error for negative select-cost-hour-weight")
+	}
+
+	c = coordinator.NewConfig()
+	c.MaxShardGroupsPerRetentionPolicy = -1
+	if err := c.Validate(); err == nil {
+		t.Fatal("expected error for negative max-shard-groups-per-retention-policy")
+	}
+
+	c = coordinator.NewConfig()
+	c.IteratorBufferSize = influxql.MaxIteratorBufferSize + 1
+	if err := c.Validate(); err == nil {
+		t.Fatal("expected error for iterator-buffer-size above the maximum")
+	}
+
+	c = coordinator.NewConfig()
+	c.MetaRetryTimeout = itoml.Duration(time.Second)
+	c.MetaRetryInterval = 0
+	if err := c.Validate(); err == nil {
+		t.Fatal("expected error for zero meta-retry-interval")
 	}
 }
@@ -0,0 +1,78 @@
+package coordinator
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/lucaswiersma/influxdb/influxql"
+)
+
+// SelectCostWeights weights the factors of the estimated cost of a SELECT
+// statement. A weight of zero removes the factor from the estimate.
+type SelectCostWeights struct {
+	Series float64
+	Hour   float64
+	Bucket float64
+}
+
+// selectCost is an estimate of the work a SELECT statement performs,
+// determined from the shards it maps to before any cursors are created.
+type selectCost struct {
+	SeriesN int
+	Range   time.Duration
+	BucketN int64
+}
+
+// Cost returns the estimated cost using the given weights. Each factor is
+// 1 + weight*quantity so a query is never estimated to be free.
+func (c selectCost) Cost(w SelectCostWeights) float64 {
+	return (1 + w.Series*float64(c.SeriesN)) *
+		(1 + w.Hour*c.Range.Hours()) *
+		(1 + w.Bucket*float64(c.BucketN))
+}
+
+func (c selectCost) String() string {
+	return fmt.Sprintf("series=%d range=%.1fh buckets=%d", c.SeriesN, c.Range.Hours(), c.BucketN)
+}
+
+// estimateSelectCost estimates the cost of stmt over the time range of opt.
+// Open ended time ranges are estimated up to now.
+func estimateSelectCost(stmt *influxql.SelectStatement, ic IteratorCreator, opt *influxql.SelectOptions, now time.Time, buckets int64) (selectCost, error) {
+	seriesN, err := sourcesSeriesN(ic, stmt.Sources, stmt.Condition)
+	if err != nil {
+		return selectCost{}, err
+	}
+
+	max := opt.MaxTime
+	if max.After(now) {
+		max = now
+	}
+	var d time.Duration
+	if max.After(opt.MinTime) {
+		d = max.Sub(opt.MinTime)
+	}
+	return selectCost{SeriesN: seriesN, Range: d, BucketN: buckets}, nil
+}
+
+// sourcesSeriesN returns the number of series read from sources, including
+// the sources of subqueries.
+func sourcesSeriesN(ic IteratorCreator, sources influxql.Sources, condition influxql.Expr) (int, error) {
+	var n int
+	for _, source := range sources {
+		switch source := source.(type) {
+		case *influxql.Measurement:
+			sn, err := ic.SeriesN(source, condition)
+			if err != nil {
+				return 0, err
+			}
+			n += sn
+		case *influxql.SubQuery:
+			sn, err := sourcesSeriesN(ic, source.Statement.Sources, source.Statement.Condition)
+			if err != nil {
+				return 0, err
+			}
+			n += sn
+		}
+	}
+	return n, nil
+}
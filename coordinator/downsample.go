@@ -0,0 +1,247 @@
+package coordinator
+
+import (
+	"github.com/lucaswiersma/influxdb/influxql"
+	"github.com/lucaswiersma/influxdb/models"
+)
+
+// downsampler reduces each series of a SELECT result to at most n points by
+// splitting it into n buckets of consecutive rows and aggregating each bucket
+// into a single row.
+type downsampler struct {
+	n         int
+	aggregate string
+
+	// aggregates holds the aggregate used for each column in auto mode.
+	aggregates map[string]string
+
+	// buf holds the rows of a series that has not been completely emitted.
+	buf *models.Row
+}
+
+// newDownsampler returns a downsampler for the results of stmt. Columns are
+// the result columns in the order they are emitted, with time first.
+func newDownsampler(stmt *influxql.SelectStatement, columns []string, n int, aggregate string) *downsampler {
+	if aggregate == "" {
+		aggregate = influxql.DownsampleAuto
+	}
+	d := &downsampler{n: n, aggregate: aggregate}
+	if aggregate != influxql.DownsampleAuto {
+		return d
+	}
+
+	// Pick the aggregate for each field from the function that produced it so
+	// selectors keep their extremes and counts keep their totals.
+	d.aggregates = make(map[string]string)
+	i := 0
+	if !stmt.OmitTime {
+		i++
+	}
+	for _, f := range stmt.Fields {
+		if i >= len(columns) {
+			break
+		}
+
+		agg := influxql.DownsampleMean
+		call, ok := f.Expr.(*influxql.Call)
+		if ok {
+			switch call.Name {
+			case "max", "top":
+				agg = influxql.DownsampleMax
+			case "min", "bottom":
+				agg = influxql.DownsampleMin
+			case "count", "sum":
+				agg = downsampleSum
+			}
+		}
+		d.aggregates[columns[i]] = agg
+		i++
+
+		// Top and bottom add a column for each of their extra arguments.
+		if ok && (call.Name == "top" || call.Name == "bottom") {
+			for _, arg := range call.Args[1:] {
+				if _, ok := arg.(*influxql.VarRef); ok {
+					i++
+				}
+			}
+		}
+	}
+	return d
+}
+
+// downsampleSum sums the values in a bucket. It is only chosen automatically.
+const downsampleSum = "sum"
+
+// add buffers row until the series is complete and then returns the series
+// downsampled. Returns nil while more rows for the series are expected.
+func (d *downsampler) add(row *models.Row, partial bool) *models.Row {
+	if d.buf == nil {
+		d.buf = row
+	} else {
+		d.buf.Values = append(d.buf.Values, row.Values...)
+	}
+	if partial {
+		return nil
+	}
+
+	row, d.buf = d.buf, nil
+	d.downsample(row)
+	return row
+}
+
+// downsample replaces the values of row with one value per bucket.
+func (d *downsampler) downsample(row *models.Row) {
+	band := d.aggregate == influxql.DownsampleBand
+
+	// Find the numeric columns. In band mode each gets a minimum and maximum
+	// column following it.
+	numeric := make([]bool, len(row.Columns))
+	for _, values := range row.Values {
+		for i, v := range values {
+			if i < len(numeric) && isNumeric(v) {
+				numeric[i] = true
+			}
+		}
+	}
+	columns := row.Columns
+	if band {
+		columns = make([]string, 0, len(row.Columns)*3)
+		for i, name := range row.Columns {
+			columns = append(columns, name)
+			if numeric[i] {
+				columns = append(columns, name+"_min", name+"_max")
+			}
+		}
+	}
+
+	if len(row.Values) <= d.n && !band {
+		return
+	}
+
+	size := (len(row.Values) + d.n - 1) / d.n
+	values := make([][]interface{}, 0, d.n)
+	for start := 0; start < len(row.Values); start += size {
+		end := start + size
+		if end > len(row.Values) {
+			end = len(row.Values)
+		}
+		bucket := row.Values[start:end]
+
+		out := make([]interface{}, 0, len(columns))
+		for i, name := range row.Columns {
+			if !numeric[i] {
+				out = append(out, firstValue(bucket, i))
+				continue
+			}
+
+			switch {
+			case band:
+				out = append(out,
+					aggregateBucket(bucket, i, influxql.DownsampleMean),
+					aggregateBucket(bucket, i, influxql.DownsampleMin),
+					aggregateBucket(bucket, i, influxql.DownsampleMax),
+				)
+			case d.aggregates != nil:
+				agg, ok := d.aggregates[name]
+				if !ok {
+					agg = influxql.DownsampleMean
+				}
+				out = append(out, aggregateBucket(bucket, i, agg))
+			default:
+				out = append(out, aggregateBucket(bucket, i, d.aggregate))
+			}
+		}
+		values = append(values, out)
+	}
+
+	row.Columns = columns
+	row.Values = values
+}
+
+// isNumeric returns true if v is a float or integer value.
+func isNumeric(v interface{}) bool {
+	switch v.(type) {
+	case float64, int64:
+		return true
+	}
+	return false
+}
+
+// firstValue returns the first non-nil value of column i in bucket. Since
+// every row has a time, each bucket is labeled with the time it starts at.
+func firstValue(bucket [][]interface{}, i int) interface{} {
+	for _, values := range bucket {
+		if i < len(values) && values[i] != nil {
+			return values[i]
+		}
+	}
+	return nil
+}
+
+// aggregateBucket aggregates the numeric values of column i in bucket. Nil
+// values are ignored and nil is returned if the bucket has no values. Means
+// are always floats while the other aggregates keep integers as integers.
+func aggregateBucket(bucket [][]interface{}, i int, agg string) interface{} {
+	var (
+		n        int
+		sum      float64
+		isum     int64
+		integers = true
+		result   interface{}
+	)
+	for _, values := range bucket {
+		if i >= len(values) {
+			continue
+		}
+
+		var f float64
+		switch v := values[i].(type) {
+		case float64:
+			f, integers = v, false
+		case int64:
+			f = float64(v)
+			isum += v
+		default:
+			continue
+		}
+		n++
+		sum += f
+
+		switch agg {
+		case influxql.DownsampleMin:
+			if result == nil || f < toFloat(result) {
+				result = values[i]
+			}
+		case influxql.DownsampleMax:
+			if result == nil || f > toFloat(result) {
+				result = values[i]
+			}
+		}
+	}
+	if n == 0 {
+		return nil
+	}
+
+	switch agg {
+	case influxql.DownsampleMin, influxql.DownsampleMax:
+		return result
+	case downsampleSum:
+		if integers {
+			return isum
+		}
+		return sum
+	default:
+		return sum / float64(n)
+	}
+}
+
+// toFloat returns a numeric value as a float.
+func toFloat(v interface{}) float64 {
+	switch v := v.(type) {
+	case float64:
+		return v
+	case int64:
+		return float64(v)
+	}
+	return 0
+}
@@ -0,0 +1,57 @@
+package coordinator
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lucaswiersma/influxdb/influxql"
+	"github.com/lucaswiersma/influxdb/models"
+)
+
+func TestDownsampler_Auto(t *testing.T) {
+	stmt := influxql.MustParseStatement(`SELECT max(value), count(value), mean(value) FROM cpu WHERE time >= 0 AND time < 4m GROUP BY time(1m)`).(*influxql.SelectStatement)
+	d := newDownsampler(stmt, []string{"time", "max", "count", "mean"}, 2, "")
+
+	ts := func(n int) time.Time { return time.Unix(int64(n*60), 0).UTC() }
+	rows := []*models.Row{
+		{Name: "cpu", Columns: []string{"time", "max", "count", "mean"}, Values: [][]interface{}{
+			{ts(0), float64(1), int64(2), float64(1)},
+			{ts(1), float64(5), int64(3), float64(3)},
+		}},
+		{Name: "cpu", Columns: []string{"time", "max", "count", "mean"}, Values: [][]interface{}{
+			{ts(2), float64(2), int64(1), nil},
+			{ts(3), nil, nil, nil},
+		}},
+	}
+
+	// Rows of a series are buffered until the series is complete.
+	if row := d.add(rows[0], true); row != nil {
+		t.Fatalf("unexpected row: %v", row)
+	}
+	row := d.add(rows[1], false)
+	if exp := [][]interface{}{
+		{ts(0), float64(5), int64(5), float64(2)},
+		{ts(2), float64(2), int64(1), nil},
+	}; !reflect.DeepEqual(row.Values, exp) {
+		t.Fatalf("unexpected values: %v", row.Values)
+	}
+}
+
+func TestDownsampler_Band(t *testing.T) {
+	stmt := influxql.MustParseStatement(`SELECT value, host FROM cpu`).(*influxql.SelectStatement)
+	d := newDownsampler(stmt, []string{"time", "value", "host"}, 1, influxql.DownsampleBand)
+
+	ts := func(n int) time.Time { return time.Unix(int64(n), 0).UTC() }
+	row := d.add(&models.Row{Name: "cpu", Columns: []string{"time", "value", "host"}, Values: [][]interface{}{
+		{ts(0), int64(1), "a"},
+		{ts(1), int64(4), "a"},
+		{ts(2), int64(7), "a"},
+	}}, false)
+
+	if exp := []string{"time", "value", "value_min", "value_max", "host"}; !reflect.DeepEqual(row.Columns, exp) {
+		t.Fatalf("unexpected columns: %v", row.Columns)
+	} else if exp := [][]interface{}{{ts(0), float64(4), int64(1), int64(7), "a"}}; !reflect.DeepEqual(row.Values, exp) {
+		t.Fatalf("unexpected values: %v", row.Values)
+	}
+}
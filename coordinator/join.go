@@ -0,0 +1,474 @@
+package coordinator
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lucaswiersma/influxdb/influxql"
+	"github.com/lucaswiersma/influxdb/models"
+)
+
+// joinStatement is a SELECT statement that joins the series of two
+// measurements on equal tag values and aligns their points by time.
+//
+// A statement is a join when it selects from exactly two measurements and its
+// condition compares a tag of one measurement to a tag of the other, such as
+// "a.host = b.host". Each measurement is queried separately and the rows of
+// both are joined by the values of the joined tags and by time.
+type joinStatement struct {
+	stmt  *influxql.SelectStatement
+	sides [2]*joinSide
+
+	// name and columns of the joined rows.
+	name    string
+	columns []string
+}
+
+// joinSide is the statement that reads one of the measurements of a join.
+type joinSide struct {
+	stmt *influxql.SelectStatement
+
+	// keys are the joined tag keys of the measurement in the order of the
+	// join conditions.
+	keys []string
+
+	// columns are the positions in a joined row of each field of stmt.
+	columns []int
+}
+
+// newJoinStatement returns the join described by stmt. Returns nil if stmt is
+// not a join and an error if it is a join that cannot be executed.
+func newJoinStatement(stmt *influxql.SelectStatement) (*joinStatement, error) {
+	if len(stmt.Sources) != 2 {
+		return nil, nil
+	}
+
+	var names [2]string
+	for i, src := range stmt.Sources {
+		m, ok := src.(*influxql.Measurement)
+		if !ok || m.Regex != nil || m.Name == "" {
+			return nil, nil
+		}
+		names[i] = m.Name
+	}
+	if names[0] == names[1] {
+		return nil, nil
+	}
+	js := &joinStatement{stmt: stmt, name: strings.Join(names[:], ",")}
+
+	// Separate the join conditions from the conditions that filter the
+	// points of either measurement. Only statements with join conditions
+	// are joins.
+	var keys [2][]string
+	var conds [2][]influxql.Expr
+	for _, expr := range conjuncts(stmt.Condition) {
+		if lhs, rhs, ok := joinCondition(expr, names); ok {
+			side := qualifier(lhs, names)
+			keys[side] = append(keys[side], unqualify(lhs, names))
+			keys[1-side] = append(keys[1-side], unqualify(rhs, names))
+			continue
+		}
+
+		side, err := exprSide(expr, names)
+		if err != nil {
+			return nil, err
+		}
+		for i := range conds {
+			if side < 0 || side == i {
+				conds[i] = append(conds[i], unqualifyExpr(expr, names))
+			}
+		}
+	}
+	if len(keys[0]) == 0 {
+		return nil, nil
+	}
+
+	if stmt.Target != nil {
+		return nil, errors.New("SELECT INTO is not supported in joins")
+	} else if stmt.Limit > 0 || stmt.Offset > 0 || stmt.SLimit > 0 || stmt.SOffset > 0 {
+		return nil, errors.New("LIMIT and OFFSET are not supported in joins")
+	} else if stmt.Compare != nil {
+		return nil, errors.New("COMPARE is not supported in joins")
+	}
+
+	// Points are only grouped into time buckets. The series of each
+	// measurement are grouped by the joined tags.
+	var dimensions influxql.Dimensions
+	for _, d := range stmt.Dimensions {
+		if call, ok := d.Expr.(*influxql.Call); !ok || call.Name != "time" {
+			return nil, fmt.Errorf("GROUP BY %s is not supported in joins, rows are grouped by the joined tags", d)
+		}
+		dimensions = append(dimensions, d)
+	}
+
+	// Split the fields between the measurements they select from.
+	var fields [2]influxql.Fields
+	var columns [2][]int
+	for i, f := range stmt.Fields {
+		side, err := fieldSide(f, names)
+		if err != nil {
+			return nil, err
+		}
+		other := *f
+		other.Expr = unqualifyExpr(f.Expr, names)
+		fields[side] = append(fields[side], &other)
+		columns[side] = append(columns[side], i)
+	}
+
+	for i, m := range stmt.Sources {
+		if len(fields[i]) == 0 {
+			return nil, fmt.Errorf("join must select at least one field from %s", names[i])
+		}
+
+		s := &influxql.SelectStatement{
+			Fields:     fields[i],
+			Sources:    influxql.Sources{m},
+			Condition:  conjunction(conds[i]),
+			Dimensions: append(influxql.Dimensions(nil), dimensions...),
+			SortFields: stmt.SortFields,
+			IsRawQuery: stmt.IsRawQuery,
+			Fill:       stmt.Fill,
+			FillValue:  stmt.FillValue,
+		}
+		seen := make(map[string]bool)
+		for _, key := range keys[i] {
+			if !seen[key] {
+				s.Dimensions = append(s.Dimensions, &influxql.Dimension{Expr: &influxql.VarRef{Val: key}})
+				seen[key] = true
+			}
+		}
+		js.sides[i] = &joinSide{stmt: s, keys: keys[i], columns: columns[i]}
+	}
+
+	js.columns = stmt.ColumnNames()
+	return js, nil
+}
+
+// fieldSide returns the measurement a field selects from. Every variable of
+// the field must be qualified by the same measurement.
+func fieldSide(f *influxql.Field, names [2]string) (int, error) {
+	var err error
+	side := -1
+	influxql.WalkFunc(f.Expr, func(n influxql.Node) {
+		if err != nil {
+			return
+		}
+		switch n := n.(type) {
+		case *influxql.Wildcard, *influxql.RegexLiteral:
+			err = errors.New("wildcards are not supported in joins")
+		case *influxql.Call:
+			if n.Name == "top" || n.Name == "bottom" {
+				for _, arg := range n.Args[1:] {
+					if _, ok := arg.(*influxql.VarRef); ok {
+						err = fmt.Errorf("%s with tags is not supported in joins", n.Name)
+					}
+				}
+			}
+		case *influxql.VarRef:
+			i := qualifier(n, names)
+			if i < 0 {
+				err = fmt.Errorf("field %s must be qualified by %s or %s in a join", f, names[0], names[1])
+			} else if side >= 0 && side != i {
+				err = fmt.Errorf("field %s cannot select from both %s and %s", f, names[0], names[1])
+			}
+			side = i
+		}
+	})
+	if err != nil {
+		return -1, err
+	} else if side < 0 {
+		return -1, fmt.Errorf("field %s must select from %s or %s in a join", f, names[0], names[1])
+	}
+	return side, nil
+}
+
+// exprSide returns the measurement a condition filters or -1 if the
+// condition filters both, such as a time condition.
+func exprSide(expr influxql.Expr, names [2]string) (int, error) {
+	var err error
+	side := -1
+	influxql.WalkFunc(expr, func(n influxql.Node) {
+		ref, ok := n.(*influxql.VarRef)
+		if !ok || err != nil {
+			return
+		}
+		i := qualifier(ref, names)
+		if i < 0 {
+			return
+		} else if side >= 0 && side != i {
+			err = fmt.Errorf("condition %s cannot compare %s and %s, only tags can be joined with =", expr, names[0], names[1])
+		}
+		side = i
+	})
+	return side, err
+}
+
+// joinCondition returns the tags of a condition such as "a.host = b.host"
+// that joins the two measurements.
+func joinCondition(expr influxql.Expr, names [2]string) (lhs, rhs *influxql.VarRef, ok bool) {
+	for {
+		paren, ok := expr.(*influxql.ParenExpr)
+		if !ok {
+			break
+		}
+		expr = paren.Expr
+	}
+
+	binary, ok := expr.(*influxql.BinaryExpr)
+	if !ok || binary.Op != influxql.EQ {
+		return nil, nil, false
+	}
+	lhs, ok = binary.LHS.(*influxql.VarRef)
+	if !ok {
+		return nil, nil, false
+	}
+	rhs, ok = binary.RHS.(*influxql.VarRef)
+	if !ok {
+		return nil, nil, false
+	}
+
+	l, r := qualifier(lhs, names), qualifier(rhs, names)
+	if l < 0 || r < 0 || l == r {
+		return nil, nil, false
+	}
+	return lhs, rhs, true
+}
+
+// qualifier returns the measurement that qualifies a variable, such as "a" in
+// "a.host", or -1 if the variable is not qualified.
+func qualifier(ref *influxql.VarRef, names [2]string) int {
+	side := -1
+	for i, name := range names {
+		if strings.HasPrefix(ref.Val, name+".") && len(ref.Val) > len(name)+1 {
+			if side < 0 || len(name) > len(names[side]) {
+				side = i
+			}
+		}
+	}
+	return side
+}
+
+// unqualify returns the name of a variable without its measurement.
+func unqualify(ref *influxql.VarRef, names [2]string) string {
+	if side := qualifier(ref, names); side >= 0 {
+		return ref.Val[len(names[side])+1:]
+	}
+	return ref.Val
+}
+
+// unqualifyExpr returns a copy of expr with the measurement removed from each
+// of its variables.
+func unqualifyExpr(expr influxql.Expr, names [2]string) influxql.Expr {
+	return influxql.RewriteExpr(influxql.CloneExpr(expr), func(e influxql.Expr) influxql.Expr {
+		if ref, ok := e.(*influxql.VarRef); ok {
+			return &influxql.VarRef{Val: unqualify(ref, names), Type: ref.Type}
+		}
+		return e
+	})
+}
+
+// conjuncts splits a condition into the expressions joined by AND.
+func conjuncts(expr influxql.Expr) []influxql.Expr {
+	switch e := expr.(type) {
+	case nil:
+		return nil
+	case *influxql.ParenExpr:
+		if inner, ok := e.Expr.(*influxql.BinaryExpr); ok && inner.Op == influxql.AND {
+			return conjuncts(inner)
+		}
+	case *influxql.BinaryExpr:
+		if e.Op == influxql.AND {
+			return append(conjuncts(e.LHS), conjuncts(e.RHS)...)
+		}
+	}
+	return []influxql.Expr{expr}
+}
+
+// conjunction joins expressions with AND.
+func conjunction(exprs []influxql.Expr) influxql.Expr {
+	var cond influxql.Expr
+	for _, expr := range exprs {
+		if cond == nil {
+			cond = expr
+		} else {
+			cond = &influxql.BinaryExpr{Op: influxql.AND, LHS: cond, RHS: expr}
+		}
+	}
+	return cond
+}
+
+// joinIterator joins the rows read from both measurements of a join. Rows are
+// buffered until both measurements have been read.
+type joinIterator struct {
+	js        *joinStatement
+	ascending bool
+
+	series map[string]*joinSeries
+	keys   []string
+}
+
+// joinSeries holds the joined points of the series with the same values of
+// the joined tags.
+type joinSeries struct {
+	tags   map[string]string
+	points map[int64]*joinPoint
+}
+
+// joinPoint is a joined row of values without the time.
+type joinPoint struct {
+	values []interface{}
+	seen   [2]bool
+}
+
+func newJoinIterator(js *joinStatement) *joinIterator {
+	return &joinIterator{
+		js:        js,
+		ascending: js.stmt.TimeAscending(),
+		series:    make(map[string]*joinSeries),
+	}
+}
+
+// add joins a row read from one side of the join. The joined tags take the
+// keys of the first measurement. If a measurement has more than one value for
+// the same tags and time, the first is kept.
+func (itr *joinIterator) add(i int, row *models.Row) {
+	side := itr.js.sides[i]
+	left := itr.js.sides[0].keys
+
+	tags := make(map[string]string, len(left))
+	values := make([]string, len(left))
+	for j, key := range side.keys {
+		values[j] = row.Tags[key]
+		if values[j] != "" {
+			tags[left[j]] = values[j]
+		}
+	}
+	id := strings.Join(values, "\x00")
+
+	s := itr.series[id]
+	if s == nil {
+		s = &joinSeries{tags: tags, points: make(map[int64]*joinPoint)}
+		itr.series[id] = s
+	}
+
+	for _, v := range row.Values {
+		t := v[0].(time.Time).UnixNano()
+		p := s.points[t]
+		if p == nil {
+			p = &joinPoint{values: make([]interface{}, len(itr.js.columns)-1)}
+			s.points[t] = p
+		}
+		if p.seen[i] {
+			continue
+		}
+		for j, col := range side.columns {
+			p.values[col] = v[j+1]
+		}
+		p.seen[i] = true
+	}
+}
+
+// Next returns the next joined series. Series are returned in order of their
+// tags and each series contains every time found in either measurement.
+// Returns nil when there are no more series.
+func (itr *joinIterator) Next() *models.Row {
+	if itr.keys == nil {
+		itr.keys = make([]string, 0, len(itr.series))
+		for id := range itr.series {
+			itr.keys = append(itr.keys, id)
+		}
+		sort.Strings(itr.keys)
+	}
+	if len(itr.keys) == 0 {
+		return nil
+	}
+
+	s := itr.series[itr.keys[0]]
+	itr.keys = itr.keys[1:]
+
+	times := make([]int64, 0, len(s.points))
+	for t := range s.points {
+		times = append(times, t)
+	}
+	if itr.ascending {
+		sort.Sort(int64Slice(times))
+	} else {
+		sort.Sort(sort.Reverse(int64Slice(times)))
+	}
+
+	row := &models.Row{
+		Name:    itr.js.name,
+		Tags:    s.tags,
+		Columns: itr.js.columns,
+		Values:  make([][]interface{}, len(times)),
+	}
+	for i, t := range times {
+		row.Values[i] = append([]interface{}{time.Unix(0, t).UTC()}, s.points[t].values...)
+	}
+	return row
+}
+
+// executeJoinStatement reads both measurements of a join and sends the joined
+// rows as a single result.
+func (e *StatementExecutor) executeJoinStatement(js *joinStatement, ctx *influxql.ExecutionContext, schema *schemaRead) error {
+	// Stamp both sides with the same time so their time ranges line up.
+	nowValuer := influxql.NowValuer{Now: time.Now().UTC()}
+
+	itr := newJoinIterator(js)
+	var messages []*influxql.Message
+	seen := make(map[string]bool)
+	for i, side := range js.sides {
+		_, msgs, err := e.readRows(side.stmt.Reduce(&nowValuer), ctx, func(row *models.Row) {
+			itr.add(i, row)
+		})
+		if err != nil {
+			return err
+		}
+		messages = appendUniqueMessages(messages, seen, msgs)
+	}
+
+	casts := columnCasts(js.stmt)
+	conversions := columnConversions(js.stmt)
+
+	rows := make([]*models.Row, 0, len(itr.series))
+	for row := itr.Next(); row != nil; row = itr.Next() {
+		if casts != nil {
+			if err := e.castRow(row, casts); err != nil {
+				return err
+			}
+		}
+		if conversions != nil {
+			convertRow(row, conversions)
+		}
+		rows = append(rows, row)
+	}
+
+	if err := schema.check(); err != nil {
+		return err
+	}
+	return ctx.Send(&influxql.Result{
+		StatementID: ctx.StatementID,
+		Messages:    messages,
+		Series:      rows,
+	})
+}
+
+// appendUniqueMessages appends the messages whose text is not in seen.
+func appendUniqueMessages(messages []*influxql.Message, seen map[string]bool, msgs []*influxql.Message) []*influxql.Message {
+	for _, m := range msgs {
+		if !seen[m.Text] {
+			messages = append(messages, m)
+			seen[m.Text] = true
+		}
+	}
+	return messages
+}
+
+type int64Slice []int64
+
+func (a int64Slice) Len() int           { return len(a) }
+func (a int64Slice) Less(i, j int) bool { return a[i] < a[j] }
+func (a int64Slice) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
@@ -0,0 +1,75 @@
+package coordinator
+
+import (
+	"runtime"
+	"sync"
+	"time"
+)
+
+// memorySampleInterval is how often the heap is sampled while a statement
+// that reports its statistics executes.
+const memorySampleInterval = 100 * time.Millisecond
+
+// memorySampler tracks the peak growth of the heap while a statement
+// executes. The heap is shared by everything running on the node, so the
+// peak is only an estimate of the memory used by the statement.
+type memorySampler struct {
+	base uint64
+	peak uint64
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// startMemorySampler returns a sampler that samples the heap every interval
+// until it is stopped.
+func startMemorySampler(interval time.Duration) *memorySampler {
+	s := &memorySampler{done: make(chan struct{})}
+	s.base = heapAlloc()
+	s.peak = s.base
+
+	s.wg.Add(1)
+	go s.run(interval)
+	return s
+}
+
+func (s *memorySampler) run(interval time.Duration) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.sample()
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// sample records the current size of the heap if it is the largest so far.
+func (s *memorySampler) sample() {
+	if n := heapAlloc(); n > s.peak {
+		s.peak = n
+	}
+}
+
+// stop stops sampling and returns the peak growth of the heap in bytes. It is
+// safe to call more than once.
+func (s *memorySampler) stop() uint64 {
+	if s.done != nil {
+		close(s.done)
+		s.wg.Wait()
+		s.done = nil
+		s.sample()
+	}
+	return s.peak - s.base
+}
+
+// heapAlloc returns the bytes of allocated heap objects.
+func heapAlloc() uint64 {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return stats.HeapAlloc
+}
@@ -15,6 +15,7 @@ type MetaClient interface {
 	CreateRetentionPolicy(database string, spec *meta.RetentionPolicySpec, makeDefault bool) (*meta.RetentionPolicyInfo, error)
 	CreateSubscription(database, rp, name, mode string, destinations []string) error
 	CreateUser(name, password string, admin bool) (*meta.UserInfo, error)
+	CreateValidationRule(database string, rule meta.ValidationRuleInfo) error
 	Database(name string) *meta.DatabaseInfo
 	Databases() []meta.DatabaseInfo
 	DropShard(id uint64) error
@@ -23,10 +24,14 @@ type MetaClient interface {
 	DropRetentionPolicy(database, name string) error
 	DropSubscription(database, rp, name string) error
 	DropUser(name string) error
+	DropValidationRule(database, name string) error
+	RestoreShard(database, policy string, groupID uint64, start, end time.Time, shardID uint64) error
 	RetentionPolicy(database, name string) (rpi *meta.RetentionPolicyInfo, err error)
 	SetAdminPrivilege(username string, admin bool) error
+	SetDatabaseDefaultPrecision(name, precision string) error
 	SetPrivilege(username, database string, p influxql.Privilege) error
 	ShardGroupsByTimeRange(database, policy string, min, max time.Time) (a []meta.ShardGroupInfo, err error)
+	ShardOwner(shardID uint64) (database, policy string, sgi *meta.ShardGroupInfo)
 	UpdateRetentionPolicy(database, name string, rpu *meta.RetentionPolicyUpdate, makeDefault bool) error
 	UpdateUser(name, password string) error
 	UserPrivilege(username, database string) (*influxql.Privilege, error)
@@ -15,6 +15,7 @@ type MetaClient struct {
 	CreateRetentionPolicyFn             func(database string, spec *meta.RetentionPolicySpec, makeDefault bool) (*meta.RetentionPolicyInfo, error)
 	CreateSubscriptionFn                func(database, rp, name, mode string, destinations []string) error
 	CreateUserFn                        func(name, password string, admin bool) (*meta.UserInfo, error)
+	CreateValidationRuleFn              func(database string, rule meta.ValidationRuleInfo) error
 	DatabaseFn                          func(name string) *meta.DatabaseInfo
 	DatabasesFn                         func() []meta.DatabaseInfo
 	DataNodeFn                          func(id uint64) (*meta.NodeInfo, error)
@@ -27,11 +28,15 @@ type MetaClient struct {
 	DropSubscriptionFn                  func(database, rp, name string) error
 	DropShardFn                         func(id uint64) error
 	DropUserFn                          func(name string) error
+	DropValidationRuleFn                func(database, name string) error
 	MetaNodesFn                         func() ([]meta.NodeInfo, error)
+	RestoreShardFn                      func(database, policy string, groupID uint64, start, end time.Time, shardID uint64) error
 	RetentionPolicyFn                   func(database, name string) (rpi *meta.RetentionPolicyInfo, err error)
 	SetAdminPrivilegeFn                 func(username string, admin bool) error
+	SetDatabaseDefaultPrecisionFn       func(name, precision string) error
 	SetPrivilegeFn                      func(username, database string, p influxql.Privilege) error
 	ShardGroupsByTimeRangeFn            func(database, policy string, min, max time.Time) (a []meta.ShardGroupInfo, err error)
+	ShardOwnerFn                        func(shardID uint64) (database, policy string, sgi *meta.ShardGroupInfo)
 	UpdateRetentionPolicyFn             func(database, name string, rpu *meta.RetentionPolicyUpdate, makeDefault bool) error
 	UpdateUserFn                        func(name, password string) error
 	UserPrivilegeFn                     func(username, database string) (*influxql.Privilege, error)
@@ -67,6 +72,10 @@ func (c *MetaClient) CreateUser(name, password string, admin bool) (*meta.UserIn
 	return c.CreateUserFn(name, password, admin)
 }
 
+func (c *MetaClient) CreateValidationRule(database string, rule meta.ValidationRuleInfo) error {
+	return c.CreateValidationRuleFn(database, rule)
+}
+
 func (c *MetaClient) Database(name string) *meta.DatabaseInfo {
 	return c.DatabaseFn(name)
 }
@@ -111,10 +120,18 @@ func (c *MetaClient) DropUser(name string) error {
 	return c.DropUserFn(name)
 }
 
+func (c *MetaClient) DropValidationRule(database, name string) error {
+	return c.DropValidationRuleFn(database, name)
+}
+
 func (c *MetaClient) MetaNodes() ([]meta.NodeInfo, error) {
 	return c.MetaNodesFn()
 }
 
+func (c *MetaClient) RestoreShard(database, policy string, groupID uint64, start, end time.Time, shardID uint64) error {
+	return c.RestoreShardFn(database, policy, groupID, start, end, shardID)
+}
+
 func (c *MetaClient) RetentionPolicy(database, name string) (rpi *meta.RetentionPolicyInfo, err error) {
 	return c.RetentionPolicyFn(database, name)
 }
@@ -123,6 +140,10 @@ func (c *MetaClient) SetAdminPrivilege(username string, admin bool) error {
 	return c.SetAdminPrivilegeFn(username, admin)
 }
 
+func (c *MetaClient) SetDatabaseDefaultPrecision(name, precision string) error {
+	return c.SetDatabaseDefaultPrecisionFn(name, precision)
+}
+
 func (c *MetaClient) SetPrivilege(username, database string, p influxql.Privilege) error {
 	return c.SetPrivilegeFn(username, database, p)
 }
@@ -131,6 +152,10 @@ func (c *MetaClient) ShardGroupsByTimeRange(database, policy string, min, max ti
 	return c.ShardGroupsByTimeRangeFn(database, policy, min, max)
 }
 
+func (c *MetaClient) ShardOwner(shardID uint64) (database, policy string, sgi *meta.ShardGroupInfo) {
+	return c.ShardOwnerFn(shardID)
+}
+
 func (c *MetaClient) UpdateRetentionPolicy(database, name string, rpu *meta.RetentionPolicyUpdate, makeDefault bool) error {
 	return c.UpdateRetentionPolicyFn(database, name, rpu, makeDefault)
 }
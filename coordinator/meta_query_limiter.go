@@ -0,0 +1,94 @@
+package coordinator
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lucaswiersma/influxdb/models"
+)
+
+// The keys for statistics generated by the "metaQuery" module.
+const (
+	statMetaQueryAllowed   = "allowed"
+	statMetaQueryThrottled = "throttled"
+)
+
+// MetaQueryLimiter limits the rate at which metadata queries, such as
+// SHOW SERIES and SHOW TAG VALUES, may be executed. It is a token bucket
+// that holds up to burst queries and refills at rate queries per second.
+type MetaQueryLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+
+	stats *MetaQueryStatistics
+
+	// now returns the current time. It can be replaced for testing.
+	now func() time.Time
+}
+
+// NewMetaQueryLimiter returns a limiter that allows rate metadata queries per
+// second with bursts of up to burst queries. If burst is less than one, the
+// burst is the rate rounded up.
+func NewMetaQueryLimiter(rate float64, burst int) *MetaQueryLimiter {
+	if burst < 1 {
+		burst = int(math.Ceil(rate))
+		if burst < 1 {
+			burst = 1
+		}
+	}
+	l := &MetaQueryLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		stats:  &MetaQueryStatistics{},
+		now:    time.Now,
+	}
+	l.last = l.now()
+	return l
+}
+
+// Allow returns true if a metadata query may be executed now.
+func (l *MetaQueryLimiter) Allow() bool {
+	l.mu.Lock()
+	now := l.now()
+	if elapsed := now.Sub(l.last); elapsed > 0 {
+		l.tokens = math.Min(l.burst, l.tokens+elapsed.Seconds()*l.rate)
+	}
+	l.last = now
+
+	ok := l.tokens >= 1
+	if ok {
+		l.tokens--
+	}
+	l.mu.Unlock()
+
+	if !ok {
+		atomic.AddInt64(&l.stats.Throttled, 1)
+		return false
+	}
+	atomic.AddInt64(&l.stats.Allowed, 1)
+	return true
+}
+
+// MetaQueryStatistics keeps statistics related to the MetaQueryLimiter.
+type MetaQueryStatistics struct {
+	Allowed   int64
+	Throttled int64
+}
+
+// Statistics returns statistics for periodic monitoring.
+func (l *MetaQueryLimiter) Statistics(tags map[string]string) []models.Statistic {
+	return []models.Statistic{{
+		Name: "metaQuery",
+		Tags: tags,
+		Values: map[string]interface{}{
+			statMetaQueryAllowed:   atomic.LoadInt64(&l.stats.Allowed),
+			statMetaQueryThrottled: atomic.LoadInt64(&l.stats.Throttled),
+		},
+	}}
+}
@@ -0,0 +1,49 @@
+package coordinator
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMetaQueryLimiter_Allow(t *testing.T) {
+	now := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := NewMetaQueryLimiter(2, 3)
+	l.now = func() time.Time { return now }
+	l.last = now
+
+	// The full burst is available immediately.
+	for i := 0; i < 3; i++ {
+		if !l.Allow() {
+			t.Fatalf("query %d: expected query to be allowed", i)
+		}
+	}
+	if l.Allow() {
+		t.Fatal("expected query to be throttled")
+	}
+
+	// Half a second refills a single token at two queries per second.
+	now = now.Add(500 * time.Millisecond)
+	if !l.Allow() {
+		t.Fatal("expected query to be allowed after refill")
+	} else if l.Allow() {
+		t.Fatal("expected query to be throttled")
+	}
+
+	// Tokens never accumulate beyond the burst.
+	now = now.Add(time.Minute)
+	for i := 0; i < 3; i++ {
+		if !l.Allow() {
+			t.Fatalf("query %d: expected query to be allowed", i)
+		}
+	}
+	if l.Allow() {
+		t.Fatal("expected query to be throttled")
+	}
+
+	stats := l.Statistics(nil)[0].Values
+	if v := stats[statMetaQueryAllowed]; v != int64(7) {
+		t.Fatalf("unexpected allowed count: %v", v)
+	} else if v := stats[statMetaQueryThrottled]; v != int64(3) {
+		t.Fatalf("unexpected throttled count: %v", v)
+	}
+}
@@ -26,6 +26,12 @@ const (
 	statWriteErr           = "writeError"
 	statSubWriteOK         = "subWriteOk"
 	statSubWriteDrop       = "subWriteDrop"
+	statWriteSampled       = "writeSampled"
+	statMetaRetry          = "metaRetry"
+	statMetaRetryFail      = "metaRetryFail"
+	statWriteInvalid       = "writeInvalid"
+
+	statRuleViolations = "violations"
 )
 
 var (
@@ -47,12 +53,34 @@ type PointsWriter struct {
 	WriteTimeout time.Duration
 	Logger       zap.Logger
 
+	// WriteSampling keeps one in every N points per series for the configured
+	// measurements, keyed by "database.measurement".
+	WriteSampling map[string]int
+	sampleMu      sync.Mutex
+	sampleCounts  map[string]int
+
+	// maxSampleSeries bounds the number of series with a sampling count.
+	// Zero uses defaultMaxSampleSeries.
+	maxSampleSeries int
+
+	// violations counts the points rejected by each validation rule.
+	violationMu sync.Mutex
+	violations  map[validationRuleKey]int64
+
+	// MetaRetryTimeout is how long metadata operations of a write that fail
+	// with a temporary error, such as during a change of the meta leader, are
+	// retried. The wait between attempts starts at MetaRetryInterval and
+	// doubles after each attempt. Zero disables retries.
+	MetaRetryTimeout  time.Duration
+	MetaRetryInterval time.Duration
+
 	Node *influxdb.Node
 
 	MetaClient interface {
 		Database(name string) (di *meta.DatabaseInfo)
 		RetentionPolicy(database, policy string) (*meta.RetentionPolicyInfo, error)
 		CreateShardGroup(database, policy string, timestamp time.Time) (*meta.ShardGroupInfo, error)
+		CreateMeasurementShardGroup(database, policy, measurement string, timestamp time.Time) (*meta.ShardGroupInfo, error)
 	}
 
 	TSDBStore interface {
@@ -65,6 +93,10 @@ type PointsWriter struct {
 	}
 	subPoints chan<- *WritePointsRequest
 
+	// ReadRollups, if set, drops the rollups of query results that are
+	// changed by the written points.
+	ReadRollups *ReadRollups
+
 	stats *WriteStatistics
 }
 
@@ -159,11 +191,29 @@ type WriteStatistics struct {
 	WriteErr           int64
 	SubWriteOK         int64
 	SubWriteDrop       int64
+	WriteSampled       int64
+	MetaRetries        int64
+	MetaRetryFailures  int64
+	WriteInvalid       int64
 }
 
-// Statistics returns statistics for periodic monitoring.
+// Statistics returns statistics for periodic monitoring. Besides the writer
+// totals, a statistic is returned for every validation rule that rejected points.
 func (w *PointsWriter) Statistics(tags map[string]string) []models.Statistic {
-	return []models.Statistic{{
+	w.violationMu.Lock()
+	statistics := make([]models.Statistic, 0, len(w.violations)+1)
+	for k, n := range w.violations {
+		statistics = append(statistics, models.Statistic{
+			Name: "write_validation",
+			Tags: models.StatisticTags{"database": k.database, "rule": k.rule}.Merge(tags),
+			Values: map[string]interface{}{
+				statRuleViolations: n,
+			},
+		})
+	}
+	w.violationMu.Unlock()
+
+	return append([]models.Statistic{{
 		Name: "write",
 		Tags: tags,
 		Values: map[string]interface{}{
@@ -176,23 +226,33 @@ func (w *PointsWriter) Statistics(tags map[string]string) []models.Statistic {
 			statWriteErr:           atomic.LoadInt64(&w.stats.WriteErr),
 			statSubWriteOK:         atomic.LoadInt64(&w.stats.SubWriteOK),
 			statSubWriteDrop:       atomic.LoadInt64(&w.stats.SubWriteDrop),
+			statWriteSampled:       atomic.LoadInt64(&w.stats.WriteSampled),
+			statMetaRetry:          atomic.LoadInt64(&w.stats.MetaRetries),
+			statMetaRetryFail:      atomic.LoadInt64(&w.stats.MetaRetryFailures),
+			statWriteInvalid:       atomic.LoadInt64(&w.stats.WriteInvalid),
 		},
-	}}
+	}}, statistics...)
 }
 
 // MapShards maps the points contained in wp to a ShardMapping.  If a point
 // maps to a shard group or shard that does not currently exist, it will be
 // created before returning the mapping.
 func (w *PointsWriter) MapShards(wp *WritePointsRequest) (*ShardMapping, error) {
-	rp, err := w.MetaClient.RetentionPolicy(wp.Database, wp.RetentionPolicy)
+	var rp *meta.RetentionPolicyInfo
+	err := w.retryMeta(func() (err error) {
+		rp, err = w.MetaClient.RetentionPolicy(wp.Database, wp.RetentionPolicy)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	} else if rp == nil {
 		return nil, influxdb.ErrRetentionPolicyNotFound(wp.RetentionPolicy)
 	}
 
-	// Holds all the shard groups and shards that are required for writes.
-	list := make(sgList, 0, 8)
+	// Holds all the shard groups and shards that are required for writes, by
+	// the measurement they are isolated for. The shared shard groups are
+	// held under an empty measurement.
+	lists := map[string]sgList{"": make(sgList, 0, 8)}
 	min := time.Unix(0, models.MinNanoTime)
 	if rp.Duration > 0 {
 		min = time.Now().Add(-rp.Duration)
@@ -201,13 +261,22 @@ func (w *PointsWriter) MapShards(wp *WritePointsRequest) (*ShardMapping, error)
 	for _, p := range wp.Points {
 		// Either the point is outside the scope of the RP, or we already have
 		// a suitable shard group for the point.
-		if p.Time().Before(min) || list.Covers(p.Time()) {
+		name := shardGroupMeasurement(rp, p)
+		if p.Time().Before(min) || lists[name].Covers(p.Time()) {
 			continue
 		}
 
 		// No shard groups overlap with the point's time, so we will create
 		// a new shard group for this point.
-		sg, err := w.MetaClient.CreateShardGroup(wp.Database, wp.RetentionPolicy, p.Time())
+		var sg *meta.ShardGroupInfo
+		err := w.retryMeta(func() (err error) {
+			if name == "" {
+				sg, err = w.MetaClient.CreateShardGroup(wp.Database, wp.RetentionPolicy, p.Time())
+			} else {
+				sg, err = w.MetaClient.CreateMeasurementShardGroup(wp.Database, wp.RetentionPolicy, name, p.Time())
+			}
+			return err
+		})
 		if err != nil {
 			return nil, err
 		}
@@ -215,12 +284,12 @@ func (w *PointsWriter) MapShards(wp *WritePointsRequest) (*ShardMapping, error)
 		if sg == nil {
 			return nil, errors.New("nil shard group")
 		}
-		list = list.Append(*sg)
+		lists[name] = lists[name].Append(*sg)
 	}
 
 	mapping := NewShardMapping()
 	for _, p := range wp.Points {
-		sg := list.ShardGroupAt(p.Time())
+		sg := lists[shardGroupMeasurement(rp, p)].ShardGroupAt(p.Time())
 		if sg == nil {
 			// We didn't create a shard group because the point was outside the
 			// scope of the RP.
@@ -234,6 +303,70 @@ func (w *PointsWriter) MapShards(wp *WritePointsRequest) (*ShardMapping, error)
 	return mapping, nil
 }
 
+// retryMeta calls fn, a metadata operation, and calls it again with backoff
+// while it returns a temporary error, until MetaRetryTimeout has passed or
+// the writer is closed. Returns the error of the last call.
+func (w *PointsWriter) retryMeta(fn func() error) error {
+	err := fn()
+	if err == nil || w.MetaRetryTimeout <= 0 || !isTemporary(err) {
+		return err
+	}
+
+	w.mu.RLock()
+	closing := w.closing
+	w.mu.RUnlock()
+
+	deadline := time.Now().Add(w.MetaRetryTimeout)
+	interval := w.MetaRetryInterval
+	for {
+		wait := deadline.Sub(time.Now())
+		if wait <= 0 {
+			break
+		} else if interval < wait {
+			wait = interval
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-closing:
+			timer.Stop()
+			atomic.AddInt64(&w.stats.MetaRetryFailures, 1)
+			return err
+		case <-timer.C:
+		}
+
+		atomic.AddInt64(&w.stats.MetaRetries, 1)
+		if err = fn(); err == nil || !isTemporary(err) {
+			return err
+		}
+		interval *= 2
+	}
+
+	atomic.AddInt64(&w.stats.MetaRetryFailures, 1)
+	w.Logger.Info(fmt.Sprintf("metadata operation failed after retrying for %s: %v", w.MetaRetryTimeout, err))
+	return err
+}
+
+// isTemporary returns true if err reports that it is temporary.
+func isTemporary(err error) bool {
+	e, ok := err.(interface {
+		Temporary() bool
+	})
+	return ok && e.Temporary()
+}
+
+// shardGroupMeasurement returns the measurement of a point if the retention
+// policy writes it to shard groups of its own, or an empty string if the point
+// is written to the shared shard groups.
+func shardGroupMeasurement(rp *meta.RetentionPolicyInfo, p models.Point) string {
+	if len(rp.IsolatedMeasurements) == 0 {
+		return ""
+	} else if name := p.Name(); rp.IsolatesMeasurement(name) {
+		return name
+	}
+	return ""
+}
+
 // sgList is a wrapper around a meta.ShardGroupInfos where we can also check
 // if a given time is covered by any of the shard groups in the list.
 type sgList meta.ShardGroupInfos
@@ -271,6 +404,141 @@ func (l sgList) Append(sgi meta.ShardGroupInfo) sgList {
 	return next
 }
 
+// defaultMaxSampleSeries is the number of series whose sampling counts are
+// tracked before the counts are reset.
+const defaultMaxSampleSeries = 100000
+
+// samplePoints returns the points to keep for measurements configured for
+// write sampling. The first of every N points written to a series is kept.
+//
+// A series is only counted while it is part way through its N points, and
+// every count is reset once maxSampleSeries series are counted, so series
+// that stop being written do not grow the counts without bound. A series
+// whose count is reset has its next point kept early.
+func (w *PointsWriter) samplePoints(database string, points []models.Point) []models.Point {
+	if len(w.WriteSampling) == 0 {
+		return points
+	}
+
+	w.sampleMu.Lock()
+	defer w.sampleMu.Unlock()
+
+	maxSeries := w.maxSampleSeries
+	if maxSeries <= 0 {
+		maxSeries = defaultMaxSampleSeries
+	}
+	if w.sampleCounts == nil {
+		w.sampleCounts = make(map[string]int)
+	}
+
+	kept := make([]models.Point, 0, len(points))
+	for _, p := range points {
+		n := w.WriteSampling[database+"."+p.Name()]
+		if n <= 1 {
+			kept = append(kept, p)
+			continue
+		}
+
+		key := database + "\x00" + string(p.Key())
+		i, ok := w.sampleCounts[key]
+		if !ok && len(w.sampleCounts) >= maxSeries {
+			w.sampleCounts = make(map[string]int)
+		}
+		if i+1 < n {
+			w.sampleCounts[key] = i + 1
+		} else {
+			delete(w.sampleCounts, key)
+		}
+		if i == 0 {
+			kept = append(kept, p)
+		}
+	}
+
+	if dropped := len(points) - len(kept); dropped > 0 {
+		atomic.AddInt64(&w.stats.WriteSampled, int64(dropped))
+	}
+	return kept
+}
+
+// validationRuleKey identifies a validation rule of a database.
+type validationRuleKey struct {
+	database string
+	rule     string
+}
+
+// validatePoints returns the points that do not violate any of the validation
+// rules of the database. If points are rejected, a PartialWriteError describing
+// the last violation is returned as well.
+func (w *PointsWriter) validatePoints(di *meta.DatabaseInfo, points []models.Point) ([]models.Point, error) {
+	if di == nil || len(di.ValidationRules) == 0 {
+		return points, nil
+	}
+
+	var reason string
+	kept := make([]models.Point, 0, len(points))
+	for _, p := range points {
+		if rule, msg := validatePoint(di.ValidationRules, p); rule != "" {
+			w.violationMu.Lock()
+			if w.violations == nil {
+				w.violations = make(map[validationRuleKey]int64)
+			}
+			w.violations[validationRuleKey{database: di.Name, rule: rule}]++
+			w.violationMu.Unlock()
+
+			reason = fmt.Sprintf("point %q violates validation rule %q: %s", p.Key(), rule, msg)
+			continue
+		}
+		kept = append(kept, p)
+	}
+
+	dropped := len(points) - len(kept)
+	if dropped == 0 {
+		return points, nil
+	}
+	atomic.AddInt64(&w.stats.WriteInvalid, int64(dropped))
+	return kept, tsdb.PartialWriteError{Reason: reason, Dropped: dropped}
+}
+
+// validatePoint returns the name of the first rule violated by the point and
+// a description of the violation. The name is blank if the point is valid.
+func validatePoint(rules []meta.ValidationRuleInfo, p models.Point) (string, string) {
+	for _, rule := range rules {
+		if rule.Measurement != "" && rule.Measurement != p.Name() {
+			continue
+		}
+
+		if rule.Tag != "" {
+			if len(p.Tags().Get([]byte(rule.Tag))) == 0 {
+				return rule.Name, fmt.Sprintf("missing required tag %q", rule.Tag)
+			}
+			continue
+		}
+
+		iter := p.FieldIterator()
+		for iter.Next() {
+			if string(iter.FieldKey()) != rule.Field {
+				continue
+			}
+
+			var v float64
+			switch iter.Type() {
+			case models.Float:
+				v, _ = iter.FloatValue()
+			case models.Integer:
+				n, _ := iter.IntegerValue()
+				v = float64(n)
+			default:
+				continue
+			}
+
+			if v < rule.Min || v > rule.Max {
+				return rule.Name, fmt.Sprintf("field %q value %v is outside of [%v, %v]", rule.Field, v, rule.Min, rule.Max)
+			}
+		}
+	}
+	return "", ""
+}
+
 // WritePointsInto is a copy of WritePoints that uses a tsdb structure instead of
 // a cluster structure for information. This is to avoid a circular dependency.
 func (w *PointsWriter) WritePointsInto(p *IntoWriteRequest) error {
@@ -282,14 +550,27 @@ func (w *PointsWriter) WritePoints(database, retentionPolicy string, consistency
 	atomic.AddInt64(&w.stats.WriteReq, 1)
 	atomic.AddInt64(&w.stats.PointWriteReq, int64(len(points)))
 
+	db := w.MetaClient.Database(database)
 	if retentionPolicy == "" {
-		db := w.MetaClient.Database(database)
 		if db == nil {
 			return influxdb.ErrDatabaseNotFound(database)
 		}
 		retentionPolicy = db.DefaultRetentionPolicy
 	}
 
+	// Points violating a validation rule are dropped, but the rest are
+	// still written.
+	points, invalidErr := w.validatePoints(db, points)
+	if len(points) == 0 {
+		return invalidErr
+	}
+
+	points = w.samplePoints(database, points)
+
+	if w.ReadRollups != nil {
+		defer w.ReadRollups.Invalidate(database, points)
+	}
+
 	shardMappings, err := w.MapShards(&WritePointsRequest{Database: database, RetentionPolicy: retentionPolicy, Points: points})
 	if err != nil {
 		return err
@@ -330,12 +611,15 @@ func (w *PointsWriter) WritePoints(database, retentionPolicy string, consistency
 			// return timeout error to caller
 			return ErrTimeout
 		case err := <-ch:
-			if err != nil {
+			if werr, ok := err.(tsdb.PartialWriteError); ok && invalidErr != nil {
+				werr.Dropped += invalidErr.(tsdb.PartialWriteError).Dropped
+				return werr
+			} else if err != nil {
 				return err
 			}
 		}
 	}
-	return nil
+	return invalidErr
 }
 
 // writeToShards writes points to a shard.
@@ -3,6 +3,8 @@ package coordinator
 import (
 	"testing"
 	"time"
+
+	"github.com/lucaswiersma/influxdb/models"
 )
 
 func TestSgList_ShardGroupAt(t *testing.T) {
@@ -44,3 +46,54 @@ func TestSgList_ShardGroupAt(t *testing.T) {
 		}
 	}
 }
+
+func TestPointsWriter_SamplePoints(t *testing.T) {
+	w := NewPointsWriter()
+	w.WriteSampling = map[string]int{"db0.cpu": 3}
+
+	var points []models.Point
+	for i := 0; i < 4; i++ {
+		points = append(points,
+			models.MustNewPoint("cpu", models.NewTags(map[string]string{"host": "a"}), models.Fields{"value": 1.0}, time.Unix(int64(i), 0)),
+			models.MustNewPoint("cpu", models.NewTags(map[string]string{"host": "b"}), models.Fields{"value": 1.0}, time.Unix(int64(i), 0)),
+			models.MustNewPoint("mem", nil, models.Fields{"value": 1.0}, time.Unix(int64(i), 0)),
+		)
+	}
+
+	// Each cpu series keeps points 0 and 3 while every mem point is kept.
+	kept := w.samplePoints("db0", points)
+	if got, exp := len(kept), 8; got != exp {
+		t.Fatalf("unexpected kept count: got %d, exp %d", got, exp)
+	} else if got, exp := w.stats.WriteSampled, int64(4); got != exp {
+		t.Fatalf("unexpected sampled count: got %d, exp %d", got, exp)
+	}
+
+	// Other databases are not sampled.
+	if kept := w.samplePoints("db1", points); len(kept) != len(points) {
+		t.Fatalf("unexpected kept count: %d", len(kept))
+	}
+}
+
+func TestPointsWriter_SamplePoints_MaxSeries(t *testing.T) {
+	w := NewPointsWriter()
+	w.WriteSampling = map[string]int{"db0.cpu": 3}
+	w.maxSampleSeries = 2
+
+	point := func(host string, sec int64) models.Point {
+		return models.MustNewPoint("cpu", models.NewTags(map[string]string{"host": host}), models.Fields{"value": 1.0}, time.Unix(sec, 0))
+	}
+
+	// Series that complete their N points are no longer counted.
+	w.samplePoints("db0", []models.Point{point("a", 0), point("a", 1), point("a", 2)})
+	if got := len(w.sampleCounts); got != 0 {
+		t.Fatalf("unexpected counted series: %d", got)
+	}
+
+	// Counting a third series resets the counts of the first two.
+	kept := w.samplePoints("db0", []models.Point{point("a", 3), point("b", 3), point("c", 3), point("a", 4)})
+	if got, exp := len(kept), 4; got != exp {
+		t.Fatalf("unexpected kept count: got %d, exp %d", got, exp)
+	} else if got, exp := len(w.sampleCounts), 2; got != exp {
+		t.Fatalf("unexpected counted series: got %d, exp %d", got, exp)
+	}
+}
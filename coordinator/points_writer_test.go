@@ -12,6 +12,7 @@ import (
 	"github.com/lucaswiersma/influxdb/coordinator"
 	"github.com/lucaswiersma/influxdb/models"
 	"github.com/lucaswiersma/influxdb/services/meta"
+	"github.com/lucaswiersma/influxdb/tsdb"
 )
 
 // TODO(benbjohnson): Rewrite tests to use cluster_test.MetaClient.
@@ -203,6 +204,122 @@ func TestPointsWriter_MapShards_Multiple(t *testing.T) {
 }
 
 // Ensures the points writer does not map points beyond the retention policy.
+// Ensures the points writer maps isolated measurements to shard groups of
+// their own.
+func TestPointsWriter_MapShards_IsolatedMeasurement(t *testing.T) {
+	ms := PointsWriterMetaClient{}
+	rp := NewRetentionPolicy("myp", time.Hour, 1)
+	rp.IsolatedMeasurements = []string{"cpu"}
+
+	ms.NodeIDFn = func() uint64 { return 1 }
+	ms.RetentionPolicyFn = func(db, retentionPolicy string) (*meta.RetentionPolicyInfo, error) {
+		return rp, nil
+	}
+
+	now := time.Now()
+	shared := meta.ShardGroupInfo{ID: 1, StartTime: now.Add(-time.Hour), EndTime: now.Add(time.Hour), Shards: []meta.ShardInfo{{ID: 10}}}
+	isolated := meta.ShardGroupInfo{ID: 2, StartTime: now.Add(-time.Hour), EndTime: now.Add(time.Hour), Shards: []meta.ShardInfo{{ID: 20}}, Measurement: "cpu"}
+
+	ms.CreateShardGroupIfNotExistsFn = func(database, policy string, timestamp time.Time) (*meta.ShardGroupInfo, error) {
+		return &shared, nil
+	}
+	ms.CreateMeasurementShardGroupFn = func(database, policy, measurement string, timestamp time.Time) (*meta.ShardGroupInfo, error) {
+		if measurement != "cpu" {
+			t.Fatalf("unexpected measurement: %s", measurement)
+		}
+		return &isolated, nil
+	}
+
+	c := coordinator.PointsWriter{MetaClient: ms}
+	pr := &coordinator.WritePointsRequest{
+		Database:        "mydb",
+		RetentionPolicy: "myrp",
+	}
+	pr.AddPoint("cpu", 1.0, now, nil)
+	pr.AddPoint("mem", 2.0, now, nil)
+	pr.AddPoint("cpu", 3.0, now.Add(time.Second), nil)
+
+	shardMappings, err := c.MapShards(pr)
+	if err != nil {
+		t.Fatalf("unexpected an error: %v", err)
+	}
+
+	if got := shardMappings.Points[20]; len(got) != 2 || got[0].Name() != "cpu" || got[1].Name() != "cpu" {
+		t.Fatalf("unexpected points in isolated shard: %v", got)
+	} else if got := shardMappings.Points[10]; len(got) != 1 || got[0].Name() != "mem" {
+		t.Fatalf("unexpected points in shared shard: %v", got)
+	}
+}
+
+// Ensures the points writer retries creating a shard group that fails with a
+// temporary error.
+func TestPointsWriter_MapShards_MetaRetry(t *testing.T) {
+	ms := PointsWriterMetaClient{}
+	rp := NewRetentionPolicy("myp", time.Hour, 1)
+
+	ms.RetentionPolicyFn = func(db, retentionPolicy string) (*meta.RetentionPolicyInfo, error) {
+		return rp, nil
+	}
+
+	var n int
+	ms.CreateShardGroupIfNotExistsFn = func(database, policy string, timestamp time.Time) (*meta.ShardGroupInfo, error) {
+		if n++; n < 3 {
+			return nil, temporaryError{}
+		}
+		return &rp.ShardGroups[0], nil
+	}
+
+	c := coordinator.NewPointsWriter()
+	c.MetaClient = ms
+	c.MetaRetryTimeout = time.Second
+	c.MetaRetryInterval = time.Millisecond
+	defer c.Close()
+
+	pr := &coordinator.WritePointsRequest{
+		Database:        "mydb",
+		RetentionPolicy: "myrp",
+	}
+	pr.AddPoint("cpu", 1.0, time.Now(), nil)
+
+	if shardMappings, err := c.MapShards(pr); err != nil {
+		t.Fatalf("unexpected an error: %v", err)
+	} else if exp := 1; len(shardMappings.Points) != exp {
+		t.Fatalf("MapShards() len mismatch. got %v, exp %v", len(shardMappings.Points), exp)
+	}
+
+	stats := c.Statistics(nil)[0].Values
+	if got, exp := stats["metaRetry"], int64(2); got != exp {
+		t.Fatalf("unexpected meta retries: got %v, exp %v", got, exp)
+	}
+
+	// Errors that are not temporary are returned without retrying.
+	n = 0
+	ms.CreateShardGroupIfNotExistsFn = func(database, policy string, timestamp time.Time) (*meta.ShardGroupInfo, error) {
+		n++
+		return nil, meta.ErrRetentionPolicyNotFound
+	}
+	c.MetaClient = ms
+	if _, err := c.MapShards(pr); err != meta.ErrRetentionPolicyNotFound {
+		t.Fatalf("unexpected error: %v", err)
+	} else if n != 1 {
+		t.Fatalf("unexpected attempts: %d", n)
+	}
+
+	// Temporary errors are returned once the timeout has passed.
+	c.MetaRetryTimeout = 10 * time.Millisecond
+	ms.CreateShardGroupIfNotExistsFn = func(database, policy string, timestamp time.Time) (*meta.ShardGroupInfo, error) {
+		return nil, temporaryError{}
+	}
+	c.MetaClient = ms
+	if _, err := c.MapShards(pr); err != (temporaryError{}) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	stats = c.Statistics(nil)[0].Values
+	if got, exp := stats["metaRetryFail"], int64(1); got != exp {
+		t.Fatalf("unexpected meta retry failures: got %v, exp %v", got, exp)
+	}
+}
+
 func TestPointsWriter_MapShards_Invalid(t *testing.T) {
 	ms := PointsWriterMetaClient{}
 	rp := NewRetentionPolicy("myp", time.Hour, 3)
@@ -365,6 +482,65 @@ func TestPointsWriter_WritePoints(t *testing.T) {
 	}
 }
 
+// Ensures points violating validation rules are dropped and counted per rule.
+func TestPointsWriter_WritePoints_ValidationRules(t *testing.T) {
+	ms := NewPointsWriterMetaClient()
+	ms.DatabaseFn = func(database string) *meta.DatabaseInfo {
+		return &meta.DatabaseInfo{
+			Name:                   database,
+			DefaultRetentionPolicy: "myrp",
+			ValidationRules: []meta.ValidationRuleInfo{
+				{Name: "host_required", Measurement: "cpu", Tag: "host"},
+				{Name: "value_range", Field: "value", Min: 0, Max: 100},
+			},
+		}
+	}
+
+	var mu sync.Mutex
+	var written []models.Point
+	store := &fakeStore{
+		WriteFn: func(shardID uint64, points []models.Point) error {
+			mu.Lock()
+			defer mu.Unlock()
+			written = append(written, points...)
+			return nil
+		},
+	}
+
+	c := coordinator.NewPointsWriter()
+	c.MetaClient = ms
+	c.TSDBStore = store
+	c.Node = &influxdb.Node{ID: 1}
+	defer c.Close()
+
+	pr := &coordinator.WritePointsRequest{Database: "mydb"}
+	pr.AddPoint("cpu", 1.0, time.Now(), map[string]string{"host": "serverA"})
+	pr.AddPoint("cpu", 2.0, time.Now(), nil)
+	pr.AddPoint("mem", 200.0, time.Now(), nil)
+	pr.AddPoint("mem", 50.0, time.Now(), nil)
+
+	err := c.WritePoints(pr.Database, "", models.ConsistencyLevelOne, pr.Points)
+	if werr, ok := err.(tsdb.PartialWriteError); !ok {
+		t.Fatalf("expected partial write error, got %v", err)
+	} else if werr.Dropped != 2 {
+		t.Fatalf("unexpected dropped points: got %d, exp %d", werr.Dropped, 2)
+	} else if exp := `point "mem" violates validation rule "value_range": field "value" value 200 is outside of [0, 100]`; werr.Reason != exp {
+		t.Fatalf("unexpected reason: got %q, exp %q", werr.Reason, exp)
+	}
+
+	if len(written) != 2 {
+		t.Fatalf("unexpected written points: got %d, exp %d", len(written), 2)
+	}
+
+	violations := make(map[string]interface{})
+	for _, stat := range c.Statistics(nil)[1:] {
+		violations[stat.Tags["rule"]] = stat.Values["violations"]
+	}
+	if exp := map[string]interface{}{"host_required": int64(1), "value_range": int64(1)}; !reflect.DeepEqual(violations, exp) {
+		t.Fatalf("unexpected violations: got %v, exp %v", violations, exp)
+	}
+}
+
 type fakePointsWriter struct {
 	WritePointsIntoFn func(*coordinator.IntoWriteRequest) error
 }
@@ -531,6 +707,7 @@ type PointsWriterMetaClient struct {
 	NodeIDFn                      func() uint64
 	RetentionPolicyFn             func(database, name string) (*meta.RetentionPolicyInfo, error)
 	CreateShardGroupIfNotExistsFn func(database, policy string, timestamp time.Time) (*meta.ShardGroupInfo, error)
+	CreateMeasurementShardGroupFn func(database, policy, measurement string, timestamp time.Time) (*meta.ShardGroupInfo, error)
 	DatabaseFn                    func(database string) *meta.DatabaseInfo
 	ShardOwnerFn                  func(shardID uint64) (string, string, *meta.ShardGroupInfo)
 }
@@ -545,6 +722,10 @@ func (m PointsWriterMetaClient) CreateShardGroup(database, policy string, timest
 	return m.CreateShardGroupIfNotExistsFn(database, policy, timestamp)
 }
 
+func (m PointsWriterMetaClient) CreateMeasurementShardGroup(database, policy, measurement string, timestamp time.Time) (*meta.ShardGroupInfo, error) {
+	return m.CreateMeasurementShardGroupFn(database, policy, measurement, timestamp)
+}
+
 func (m PointsWriterMetaClient) Database(database string) *meta.DatabaseInfo {
 	return m.DatabaseFn(database)
 }
@@ -553,6 +734,12 @@ func (m PointsWriterMetaClient) ShardOwner(shardID uint64) (string, string, *met
 	return m.ShardOwnerFn(shardID)
 }
 
+// temporaryError is returned by a meta client during a leadership change.
+type temporaryError struct{}
+
+func (temporaryError) Error() string   { return "no leader" }
+func (temporaryError) Temporary() bool { return true }
+
 type Subscriber struct {
 	PointsFn func() chan<- *coordinator.WritePointsRequest
 }
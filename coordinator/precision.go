@@ -0,0 +1,101 @@
+package coordinator
+
+import (
+	"time"
+
+	"github.com/lucaswiersma/influxdb/influxql"
+	"github.com/lucaswiersma/influxdb/models"
+)
+
+// precisionMerger reduces the timestamps of each series of a SELECT result to
+// a precision and merges the points that fall within the same interval of
+// that precision into a single point. Points are merged with the aggregates
+// the downsampler picks in auto mode.
+type precisionMerger struct {
+	precision time.Duration
+	d         *downsampler
+
+	// pending holds the points of the last interval of a partial row, which
+	// may continue in the next row of the series.
+	pending [][]interface{}
+}
+
+// newPrecisionMerger returns a precisionMerger for the results of stmt.
+// Columns are the result columns in the order they are emitted, with time
+// first.
+func newPrecisionMerger(stmt *influxql.SelectStatement, columns []string, precision time.Duration) *precisionMerger {
+	return &precisionMerger{
+		precision: precision,
+		d:         newDownsampler(stmt, columns, 0, influxql.DownsampleAuto),
+	}
+}
+
+// add merges the points of row. The points of the last interval of a partial
+// row are held back until the next row of the series. Returns nil if no
+// points are left to emit.
+func (m *precisionMerger) add(row *models.Row, partial bool) *models.Row {
+	values := row.Values
+	if m.pending != nil {
+		values = append(m.pending, values...)
+		m.pending = nil
+	}
+
+	merged := make([][]interface{}, 0, len(values))
+	for start := 0; start < len(values); {
+		t := m.truncate(values[start])
+		end := start + 1
+		for end < len(values) && m.truncate(values[end]).Equal(t) {
+			end++
+		}
+
+		if partial && end == len(values) {
+			m.pending = values[start:end:end]
+			break
+		}
+		merged = append(merged, m.merge(row.Columns, values[start:end], t))
+		start = end
+	}
+
+	if len(merged) == 0 {
+		return nil
+	}
+	row.Values = merged
+	return row
+}
+
+// truncate returns the time of values truncated to the precision.
+func (m *precisionMerger) truncate(values []interface{}) time.Time {
+	t, _ := values[0].(time.Time)
+	return t.Truncate(m.precision)
+}
+
+// merge merges the points of an interval into a single point at time t.
+func (m *precisionMerger) merge(columns []string, bucket [][]interface{}, t time.Time) []interface{} {
+	if len(bucket) == 1 {
+		bucket[0][0] = t
+		return bucket[0]
+	}
+
+	out := make([]interface{}, len(columns))
+	out[0] = t
+	for i := 1; i < len(columns); i++ {
+		numeric := false
+		for _, values := range bucket {
+			if i < len(values) && isNumeric(values[i]) {
+				numeric = true
+				break
+			}
+		}
+		if !numeric {
+			out[i] = firstValue(bucket, i)
+			continue
+		}
+
+		agg, ok := m.d.aggregates[columns[i]]
+		if !ok {
+			agg = influxql.DownsampleMean
+		}
+		out[i] = aggregateBucket(bucket, i, agg)
+	}
+	return out
+}
@@ -0,0 +1,41 @@
+package coordinator
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lucaswiersma/influxdb/influxql"
+	"github.com/lucaswiersma/influxdb/models"
+)
+
+func TestPrecisionMerger(t *testing.T) {
+	stmt := influxql.MustParseStatement(`SELECT value, max(value), host FROM cpu`).(*influxql.SelectStatement)
+	m := newPrecisionMerger(stmt, []string{"time", "value", "max", "host"}, time.Second)
+
+	ts := func(ms int) time.Time { return time.Unix(0, int64(ms)*int64(time.Millisecond)).UTC() }
+	columns := []string{"time", "value", "max", "host"}
+
+	// The last interval of a partial row is held back for the next row.
+	row := m.add(&models.Row{Name: "cpu", Columns: columns, Values: [][]interface{}{
+		{ts(0), float64(1), int64(1), "a"},
+		{ts(500), float64(3), int64(5), nil},
+		{ts(1200), float64(2), int64(2), "b"},
+	}}, true)
+	if exp := [][]interface{}{
+		{ts(0), float64(2), int64(5), "a"},
+	}; !reflect.DeepEqual(row.Values, exp) {
+		t.Fatalf("unexpected values: %v", row.Values)
+	}
+
+	row = m.add(&models.Row{Name: "cpu", Columns: columns, Values: [][]interface{}{
+		{ts(1800), float64(4), int64(3), "c"},
+		{ts(2100), nil, nil, "d"},
+	}}, false)
+	if exp := [][]interface{}{
+		{ts(1000), float64(3), int64(3), "b"},
+		{ts(2000), nil, nil, "d"},
+	}; !reflect.DeepEqual(row.Values, exp) {
+		t.Fatalf("unexpected values: %v", row.Values)
+	}
+}
@@ -0,0 +1,479 @@
+package coordinator
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lucaswiersma/influxdb/influxql"
+	"github.com/lucaswiersma/influxdb/models"
+	"github.com/lucaswiersma/influxdb/services/meta"
+	"go.uber.org/zap"
+)
+
+const (
+	// ReadRollupDatabase is the internal database rollups are written to so
+	// they are kept apart from the measurements of the databases they are
+	// computed from.
+	ReadRollupDatabase = "_rollups"
+
+	// ReadRollupRetentionPolicy is the retention policy of the rollup
+	// database. It keeps points forever since rollups cover time ranges that
+	// have already passed and are dropped when they are no longer used.
+	ReadRollupRetentionPolicy = "rollups"
+
+	// readRollupPrefix is the prefix of the measurement name of a rollup.
+	readRollupPrefix = "_rollup_"
+)
+
+// The keys for statistics generated by the "readRollup" module.
+const (
+	statReadRollupHit          = "hit"
+	statReadRollupMaterialized = "materialized"
+	statReadRollupInvalidated  = "invalidated"
+	statReadRollupEvicted      = "evicted"
+)
+
+// ReadRollups materializes the result of an aggregate query into a rollup
+// measurement the first time the query is run, so identical queries read the
+// rollup instead of recomputing the result from the raw data.
+//
+// Only queries with a GROUP BY time interval over a single measurement and a
+// fixed time range that has already passed are materialized. A rollup is
+// dropped when points are written to its source measurement within its time
+// range, and the least recently used rollup is dropped when there are too
+// many. Rollups are written to ReadRollupDatabase and tracked in memory, so
+// Open drops the rollups left by a previous run and a rollup is rewritten
+// the next time its query is run.
+type ReadRollups struct {
+	mu       sync.Mutex
+	rollups  map[string]*readRollup              // by query
+	bySource map[string]map[*readRollup]struct{} // by database and source measurement
+	dropping map[string]int                      // rollup measurements being dropped
+	clock    uint64
+
+	maxN      int
+	maxPointN int
+	minRange  time.Duration
+
+	stats *ReadRollupStatistics
+
+	// MetaClient creates the rollup database.
+	MetaClient interface {
+		CreateDatabaseWithRetentionPolicy(name string, spec *meta.RetentionPolicySpec) (*meta.DatabaseInfo, error)
+	}
+
+	// TSDBStore drops the measurements of rollups that are no longer used.
+	TSDBStore interface {
+		Measurements(database string, cond influxql.Expr) ([]string, error)
+		DeleteMeasurement(database, name string) error
+	}
+
+	Logger zap.Logger
+
+	// now returns the current time. It can be replaced for testing.
+	now func() time.Time
+}
+
+// NewReadRollups returns a set of at most maxN rollups. Results with more
+// than maxPointN points, or over a time range shorter than minRange, are
+// not materialized.
+func NewReadRollups(maxN, maxPointN int, minRange time.Duration) *ReadRollups {
+	return &ReadRollups{
+		rollups:   make(map[string]*readRollup),
+		bySource:  make(map[string]map[*readRollup]struct{}),
+		dropping:  make(map[string]int),
+		maxN:      maxN,
+		maxPointN: maxPointN,
+		minRange:  minRange,
+		stats:     &ReadRollupStatistics{},
+		Logger:    zap.New(zap.NullEncoder()),
+		now:       time.Now,
+	}
+}
+
+// WithLogger sets the logger for the rollups.
+func (r *ReadRollups) WithLogger(log zap.Logger) {
+	r.Logger = log.With(zap.String("service", "read_rollups"))
+}
+
+// Open creates the rollup database and drops the rollups left in it by a
+// previous run, which are no longer tracked.
+func (r *ReadRollups) Open() error {
+	if r.MetaClient != nil {
+		replicaN := 1
+		spec := meta.RetentionPolicySpec{
+			Name:     ReadRollupRetentionPolicy,
+			ReplicaN: &replicaN,
+		}
+		if _, err := r.MetaClient.CreateDatabaseWithRetentionPolicy(ReadRollupDatabase, &spec); err != nil {
+			return fmt.Errorf("create rollup database: %s", err)
+		}
+	}
+
+	if r.TSDBStore == nil {
+		return nil
+	}
+	names, err := r.TSDBStore.Measurements(ReadRollupDatabase, nil)
+	if err != nil {
+		return err
+	}
+	var n int
+	for _, name := range names {
+		if !strings.HasPrefix(name, readRollupPrefix) {
+			continue
+		}
+		if err := r.TSDBStore.DeleteMeasurement(ReadRollupDatabase, name); err != nil {
+			return fmt.Errorf("drop rollup %s: %s", name, err)
+		}
+		n++
+	}
+	if n > 0 {
+		r.Logger.Info(fmt.Sprintf("dropped %d rollups of a previous run", n))
+	}
+	return nil
+}
+
+// readRollup is the materialized result of a single query.
+type readRollup struct {
+	key      string
+	database string // source database
+	source   string // source measurement
+	name     string // rollup measurement in ReadRollupDatabase
+	min, max int64
+
+	// columns are the names of the result columns, excluding time. They are
+	// only set once the rollup has been written.
+	columns []string
+	ready   bool
+	used    uint64
+}
+
+// acquire returns the rollup for stmt. If the rollup has been written, hit is
+// true and the rollup can be read instead of executing stmt. Otherwise the
+// returned rollup should be written from the result of stmt and passed to
+// release or ready. A nil rollup is returned if stmt cannot be materialized
+// or its rollup is already being written. Queries reading fields with
+// different field type policies use separate rollups.
+func (r *ReadRollups) acquire(database, fieldTypePolicy string, stmt *influxql.SelectStatement) (rollup *readRollup, hit bool) {
+	m, min, max, ok := r.materializable(stmt)
+	if !ok {
+		return nil, false
+	}
+	key := database + "\x00" + fieldTypePolicy + "\x00" + stmt.String()
+
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	name := fmt.Sprintf("%s%016x", readRollupPrefix, h.Sum64())
+
+	r.mu.Lock()
+	r.clock++
+	if rollup := r.rollups[key]; rollup != nil {
+		if !rollup.ready {
+			r.mu.Unlock()
+			return nil, false
+		}
+		rollup.used = r.clock
+		r.mu.Unlock()
+		atomic.AddInt64(&r.stats.Hits, 1)
+		return rollup, true
+	}
+
+	// The measurement of a previous rollup of the query may still be being
+	// dropped, so wait until it is gone before writing it again.
+	if r.dropping[name] > 0 {
+		r.mu.Unlock()
+		return nil, false
+	}
+
+	// Make room for the rollup by evicting the least recently used rollup.
+	var evicted *readRollup
+	if len(r.rollups) >= r.maxN {
+		if evicted = r.lru(); evicted == nil {
+			r.mu.Unlock()
+			return nil, false
+		}
+		r.remove(evicted)
+	}
+
+	rollup = &readRollup{
+		key:      key,
+		database: m.Database,
+		source:   m.Name,
+		name:     name,
+		min:      min.UnixNano(),
+		max:      max.UnixNano(),
+		used:     r.clock,
+	}
+	r.add(rollup)
+	r.mu.Unlock()
+
+	if evicted != nil {
+		atomic.AddInt64(&r.stats.Evicted, 1)
+		r.drop(evicted)
+	}
+	return rollup, false
+}
+
+// materializable returns the source measurement and time range of stmt if
+// its result can be materialized.
+func (r *ReadRollups) materializable(stmt *influxql.SelectStatement) (m *influxql.Measurement, min, max time.Time, ok bool) {
+	if stmt.Target != nil || stmt.IsRawQuery || len(stmt.Sources) != 1 {
+		return nil, min, max, false
+	}
+	m, ok = stmt.Sources[0].(*influxql.Measurement)
+	if !ok || m.Regex != nil || m.Name == "" {
+		return nil, min, max, false
+	}
+	if interval, err := stmt.GroupByInterval(); err != nil || interval == 0 {
+		return nil, min, max, false
+	}
+
+	// The time range must be fixed and in the past, otherwise the result of
+	// the query is still changing.
+	var now bool
+	influxql.WalkFunc(stmt.Condition, func(n influxql.Node) {
+		if call, ok := n.(*influxql.Call); ok && call.Name == "now" {
+			now = true
+		}
+	})
+	if now {
+		return nil, min, max, false
+	}
+	min, max, err := influxql.TimeRange(stmt.Condition)
+	if err != nil || min.IsZero() || max.IsZero() || !max.Before(r.now()) || max.Sub(min) < r.minRange {
+		return nil, min, max, false
+	}
+	return m, min, max, true
+}
+
+// ready marks rollup as written with the given result columns. It returns
+// false if the rollup was invalidated while it was being written, in which
+// case its measurement is dropped.
+func (r *ReadRollups) ready(rollup *readRollup, columns []string) bool {
+	r.mu.Lock()
+	if r.rollups[rollup.key] != rollup {
+		r.dropping[rollup.name]++
+		r.mu.Unlock()
+		r.drop(rollup)
+		return false
+	}
+	rollup.columns = columns
+	rollup.ready = true
+	r.mu.Unlock()
+
+	atomic.AddInt64(&r.stats.Materialized, 1)
+	return true
+}
+
+// release abandons a rollup that could not be written.
+func (r *ReadRollups) release(rollup *readRollup) {
+	r.mu.Lock()
+	if r.rollups[rollup.key] == rollup {
+		r.remove(rollup)
+	} else {
+		r.dropping[rollup.name]++
+	}
+	r.mu.Unlock()
+	r.drop(rollup)
+}
+
+// Invalidate drops the rollups of the measurements points are written to if
+// the points fall within the time range of the rollup.
+func (r *ReadRollups) Invalidate(database string, points []models.Point) {
+	var dropped []*readRollup
+
+	r.mu.Lock()
+	if len(r.bySource) == 0 {
+		r.mu.Unlock()
+		return
+	}
+	for _, p := range points {
+		rollups := r.bySource[database+"\x00"+p.Name()]
+		if len(rollups) == 0 {
+			continue
+		}
+
+		ts := p.UnixNano()
+		for rollup := range rollups {
+			if ts >= rollup.min && ts <= rollup.max {
+				r.remove(rollup)
+				dropped = append(dropped, rollup)
+			}
+		}
+	}
+	r.mu.Unlock()
+
+	for _, rollup := range dropped {
+		atomic.AddInt64(&r.stats.Invalidated, 1)
+		r.drop(rollup)
+	}
+}
+
+// InvalidateDatabase drops every rollup of a database. It is used when data
+// is deleted from the database. Data deleted from the rollup database drops
+// every rollup.
+func (r *ReadRollups) InvalidateDatabase(database string) {
+	var dropped []*readRollup
+
+	r.mu.Lock()
+	for _, rollup := range r.rollups {
+		if rollup.database == database || database == ReadRollupDatabase {
+			r.remove(rollup)
+			dropped = append(dropped, rollup)
+		}
+	}
+	r.mu.Unlock()
+
+	for _, rollup := range dropped {
+		atomic.AddInt64(&r.stats.Invalidated, 1)
+		r.drop(rollup)
+	}
+}
+
+// lru returns the least recently used rollup that has been written, or nil
+// if every rollup is still being written. The lock must be held.
+func (r *ReadRollups) lru() *readRollup {
+	var lru *readRollup
+	for _, rollup := range r.rollups {
+		if rollup.ready && (lru == nil || rollup.used < lru.used) {
+			lru = rollup
+		}
+	}
+	return lru
+}
+
+// add registers rollup. The lock must be held.
+func (r *ReadRollups) add(rollup *readRollup) {
+	r.rollups[rollup.key] = rollup
+
+	source := rollup.database + "\x00" + rollup.source
+	if r.bySource[source] == nil {
+		r.bySource[source] = make(map[*readRollup]struct{})
+	}
+	r.bySource[source][rollup] = struct{}{}
+}
+
+// remove unregisters rollup and marks its measurement as being dropped. The
+// rollup must then be passed to drop. The lock must be held.
+func (r *ReadRollups) remove(rollup *readRollup) {
+	delete(r.rollups, rollup.key)
+	r.dropping[rollup.name]++
+
+	source := rollup.database + "\x00" + rollup.source
+	delete(r.bySource[source], rollup)
+	if len(r.bySource[source]) == 0 {
+		delete(r.bySource, source)
+	}
+}
+
+// drop deletes the measurement of a rollup that has been removed.
+func (r *ReadRollups) drop(rollup *readRollup) {
+	if r.TSDBStore != nil {
+		if err := r.TSDBStore.DeleteMeasurement(ReadRollupDatabase, rollup.name); err != nil {
+			r.Logger.Info(fmt.Sprintf("failed to drop rollup %s of %s: %s", rollup.name, rollup.source, err))
+		}
+	}
+
+	r.mu.Lock()
+	if r.dropping[rollup.name]--; r.dropping[rollup.name] <= 0 {
+		delete(r.dropping, rollup.name)
+	}
+	r.mu.Unlock()
+}
+
+// rewrite returns a statement that reads the result of stmt from the rollup.
+// The rollup holds one point per row of the result so the last value of each
+// column in each interval is the original result, and the original fill
+// option reproduces intervals without a point.
+func (rollup *readRollup) rewrite(stmt *influxql.SelectStatement) *influxql.SelectStatement {
+	other := stmt.Clone()
+	other.Fields = make(influxql.Fields, 0, len(rollup.columns))
+	for _, c := range rollup.columns {
+		other.Fields = append(other.Fields, &influxql.Field{
+			Expr:  &influxql.Call{Name: "last", Args: []influxql.Expr{&influxql.VarRef{Val: c}}},
+			Alias: c,
+		})
+	}
+	other.Sources = influxql.Sources{&influxql.Measurement{
+		Database:        ReadRollupDatabase,
+		RetentionPolicy: ReadRollupRetentionPolicy,
+		Name:            rollup.name,
+	}}
+	other.Condition = &influxql.BinaryExpr{
+		Op: influxql.AND,
+		LHS: &influxql.BinaryExpr{
+			Op:  influxql.GTE,
+			LHS: &influxql.VarRef{Val: "time"},
+			RHS: &influxql.TimeLiteral{Val: time.Unix(0, rollup.min).UTC()},
+		},
+		RHS: &influxql.BinaryExpr{
+			Op:  influxql.LTE,
+			LHS: &influxql.VarRef{Val: "time"},
+			RHS: &influxql.TimeLiteral{Val: time.Unix(0, rollup.max).UTC()},
+		},
+	}
+
+	// The rollup only holds the rows after the offsets were applied.
+	other.Offset, other.SOffset = 0, 0
+	return other
+}
+
+// points converts the result rows of the rollup's query into the points of
+// the rollup. The first interval of a result can start before the queried
+// time range, so its point is moved to the start of the range to be read
+// back by the rewritten query.
+func (rollup *readRollup) points(rows []*models.Row) ([]models.Point, error) {
+	min := time.Unix(0, rollup.min).UTC()
+
+	var points []models.Point
+	for _, row := range rows {
+		for _, values := range row.Values {
+			if t, ok := values[0].(time.Time); ok && t.Before(min) {
+				values[0] = min
+			}
+		}
+
+		pts, err := convertRowToPoints(rollup.name, row)
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, pts...)
+	}
+	return points, nil
+}
+
+// copyRow returns a copy of row that does not share its values.
+func copyRow(row *models.Row) *models.Row {
+	other := *row
+	other.Values = make([][]interface{}, len(row.Values))
+	for i, values := range row.Values {
+		other.Values[i] = append([]interface{}(nil), values...)
+	}
+	return &other
+}
+
+// ReadRollupStatistics keeps statistics related to ReadRollups.
+type ReadRollupStatistics struct {
+	Hits         int64
+	Materialized int64
+	Invalidated  int64
+	Evicted      int64
+}
+
+// Statistics returns statistics for periodic monitoring.
+func (r *ReadRollups) Statistics(tags map[string]string) []models.Statistic {
+	return []models.Statistic{{
+		Name: "readRollup",
+		Tags: tags,
+		Values: map[string]interface{}{
+			statReadRollupHit:          atomic.LoadInt64(&r.stats.Hits),
+			statReadRollupMaterialized: atomic.LoadInt64(&r.stats.Materialized),
+			statReadRollupInvalidated:  atomic.LoadInt64(&r.stats.Invalidated),
+			statReadRollupEvicted:      atomic.LoadInt64(&r.stats.Evicted),
+		},
+	}}
+}
@@ -0,0 +1,259 @@
+package coordinator
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lucaswiersma/influxdb/influxql"
+	"github.com/lucaswiersma/influxdb/models"
+	"github.com/lucaswiersma/influxdb/services/meta"
+)
+
+type deleteMeasurementStore struct {
+	measurements []string
+	deleted      []string
+}
+
+func (s *deleteMeasurementStore) Measurements(database string, cond influxql.Expr) ([]string, error) {
+	if database != ReadRollupDatabase {
+		return nil, nil
+	}
+	return s.measurements, nil
+}
+
+func (s *deleteMeasurementStore) DeleteMeasurement(database, name string) error {
+	s.deleted = append(s.deleted, database+"."+name)
+	return nil
+}
+
+type createDatabaseMetaClient struct {
+	database string
+	spec     *meta.RetentionPolicySpec
+}
+
+func (c *createDatabaseMetaClient) CreateDatabaseWithRetentionPolicy(name string, spec *meta.RetentionPolicySpec) (*meta.DatabaseInfo, error) {
+	c.database, c.spec = name, spec
+	return &meta.DatabaseInfo{Name: name}, nil
+}
+
+func mustParseSelect(tb testing.TB, s string) *influxql.SelectStatement {
+	stmt, err := influxql.ParseStatement(s)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return stmt.(*influxql.SelectStatement)
+}
+
+func newTestReadRollups(maxN int) (*ReadRollups, *deleteMeasurementStore) {
+	r := NewReadRollups(maxN, 1000, time.Hour)
+	r.now = func() time.Time { return time.Date(2017, 6, 1, 0, 0, 0, 0, time.UTC) }
+	store := &deleteMeasurementStore{}
+	r.TSDBStore = store
+	return r, store
+}
+
+func TestReadRollups_Acquire(t *testing.T) {
+	r, _ := newTestReadRollups(10)
+	stmt := mustParseSelect(t, `SELECT mean(value) FROM db0.rp0.cpu WHERE host = 'a' AND time >= '2017-01-01T00:00:00Z' AND time < '2017-01-02T00:00:00Z' GROUP BY time(1h), region fill(0) LIMIT 5 OFFSET 2`)
+
+	rollup, hit := r.acquire("db0", "", stmt)
+	if rollup == nil || hit {
+		t.Fatalf("expected rollup to be written, got %v %v", rollup, hit)
+	}
+
+	// Identical queries do not write the rollup while it is being written.
+	if other, _ := r.acquire("db0", "", stmt); other != nil {
+		t.Fatal("expected no rollup while it is being written")
+	}
+
+	if !r.ready(rollup, []string{"mean"}) {
+		t.Fatal("expected rollup to be ready")
+	}
+	other, hit := r.acquire("db0", "", stmt)
+	if other != rollup || !hit {
+		t.Fatalf("expected rollup hit, got %v %v", other, hit)
+	}
+
+	exp := `SELECT last(mean) AS mean FROM _rollups.rollups.` + rollup.name + ` WHERE time >= '2017-01-01T00:00:00Z' AND time <= '2017-01-01T23:59:59.999999999Z' GROUP BY time(1h), region fill(0) LIMIT 5`
+	if got := rollup.rewrite(stmt).String(); got != exp {
+		t.Fatalf("unexpected rewrite:\n\tgot=%s\n\texp=%s", got, exp)
+	}
+}
+
+// Ensure a rollup written under one field type policy is not read by queries
+// using another.
+func TestReadRollups_Acquire_FieldTypePolicy(t *testing.T) {
+	r, _ := newTestReadRollups(10)
+	stmt := mustParseSelect(t, `SELECT mean(value) FROM db0.rp0.cpu WHERE time >= '2017-01-01T00:00:00Z' AND time < '2017-01-02T00:00:00Z' GROUP BY time(1h)`)
+
+	rollup, _ := r.acquire("db0", influxql.FieldTypeFloat, stmt)
+	r.ready(rollup, []string{"mean"})
+
+	other, hit := r.acquire("db0", influxql.FieldTypeNewest, stmt)
+	if other == nil || hit {
+		t.Fatalf("expected a separate rollup to be written, got %v %v", other, hit)
+	} else if other.name == rollup.name {
+		t.Fatalf("unexpected rollup measurement: %s", other.name)
+	}
+
+	if other, hit := r.acquire("db0", influxql.FieldTypeFloat, stmt); other != rollup || !hit {
+		t.Fatalf("expected rollup hit, got %v %v", other, hit)
+	}
+}
+
+// Ensure opening creates the rollup database and drops the rollups of a
+// previous run.
+func TestReadRollups_Open(t *testing.T) {
+	r, store := newTestReadRollups(10)
+	store.measurements = []string{"_rollup_0123456789abcdef", "cpu"}
+	client := &createDatabaseMetaClient{}
+	r.MetaClient = client
+
+	if err := r.Open(); err != nil {
+		t.Fatal(err)
+	}
+	if client.database != ReadRollupDatabase || client.spec.Name != ReadRollupRetentionPolicy || client.spec.Duration != nil {
+		t.Fatalf("unexpected rollup database: %s %+v", client.database, client.spec)
+	}
+	if exp := []string{"_rollups._rollup_0123456789abcdef"}; !reflect.DeepEqual(store.deleted, exp) {
+		t.Fatalf("unexpected deleted measurements: %v", store.deleted)
+	}
+}
+
+// Ensure deleting data from the rollup database drops every rollup.
+func TestReadRollups_InvalidateDatabase(t *testing.T) {
+	r, store := newTestReadRollups(10)
+	stmt := mustParseSelect(t, `SELECT mean(value) FROM db0.rp0.cpu WHERE time >= '2017-01-01T00:00:00Z' AND time < '2017-01-02T00:00:00Z' GROUP BY time(1h)`)
+	rollup, _ := r.acquire("db0", "", stmt)
+	r.ready(rollup, []string{"mean"})
+
+	r.InvalidateDatabase("db1")
+	if _, hit := r.acquire("db0", "", stmt); !hit {
+		t.Fatal("expected rollup hit")
+	}
+
+	r.InvalidateDatabase(ReadRollupDatabase)
+	if exp := []string{"_rollups." + rollup.name}; !reflect.DeepEqual(store.deleted, exp) {
+		t.Fatalf("unexpected deleted measurements: %v", store.deleted)
+	}
+}
+
+func TestReadRollups_Acquire_NotMaterializable(t *testing.T) {
+	r, _ := newTestReadRollups(10)
+	for _, s := range []string{
+		`SELECT value FROM cpu WHERE time >= '2017-01-01T00:00:00Z' AND time < '2017-01-02T00:00:00Z'`,
+		`SELECT mean(value) FROM cpu WHERE time >= '2017-01-01T00:00:00Z' AND time < '2017-01-02T00:00:00Z'`,
+		`SELECT mean(value) FROM cpu, mem WHERE time >= '2017-01-01T00:00:00Z' AND time < '2017-01-02T00:00:00Z' GROUP BY time(1h)`,
+		`SELECT mean(value) FROM /c.*/ WHERE time >= '2017-01-01T00:00:00Z' AND time < '2017-01-02T00:00:00Z' GROUP BY time(1h)`,
+		`SELECT mean(value) FROM cpu WHERE time >= '2017-01-01T00:00:00Z' GROUP BY time(1h)`,
+		`SELECT mean(value) FROM cpu WHERE time >= now() - 2d AND time < now() - 1d GROUP BY time(1h)`,
+		`SELECT mean(value) FROM cpu WHERE time >= '2017-05-31T12:00:00Z' AND time < '2017-06-01T12:00:00Z' GROUP BY time(1h)`,
+		`SELECT mean(value) FROM cpu WHERE time >= '2017-01-01T00:00:00Z' AND time < '2017-01-01T00:30:00Z' GROUP BY time(1m)`,
+		`SELECT mean(value) INTO cpu_1h FROM cpu WHERE time >= '2017-01-01T00:00:00Z' AND time < '2017-01-02T00:00:00Z' GROUP BY time(1h)`,
+	} {
+		if rollup, _ := r.acquire("db0", "", mustParseSelect(t, s)); rollup != nil {
+			t.Errorf("%s: expected statement not to be materialized", s)
+		}
+	}
+}
+
+func TestReadRollups_Invalidate(t *testing.T) {
+	r, store := newTestReadRollups(10)
+	stmt := mustParseSelect(t, `SELECT mean(value) FROM db0.rp0.cpu WHERE time >= '2017-01-01T00:00:00Z' AND time < '2017-01-02T00:00:00Z' GROUP BY time(1h)`)
+
+	rollup, _ := r.acquire("db0", "", stmt)
+	r.ready(rollup, []string{"mean"})
+
+	// Points outside of the time range or measurement keep the rollup.
+	r.Invalidate("db0", []models.Point{
+		models.MustNewPoint("cpu", nil, models.Fields{"value": 1.0}, time.Date(2017, 1, 2, 0, 0, 0, 0, time.UTC)),
+		models.MustNewPoint("mem", nil, models.Fields{"value": 1.0}, time.Date(2017, 1, 1, 12, 0, 0, 0, time.UTC)),
+	})
+	r.Invalidate("db1", []models.Point{
+		models.MustNewPoint("cpu", nil, models.Fields{"value": 1.0}, time.Date(2017, 1, 1, 12, 0, 0, 0, time.UTC)),
+	})
+	if _, hit := r.acquire("db0", "", stmt); !hit {
+		t.Fatal("expected rollup hit")
+	}
+
+	// A late write to the time range drops the rollup.
+	r.Invalidate("db0", []models.Point{
+		models.MustNewPoint("cpu", nil, models.Fields{"value": 1.0}, time.Date(2017, 1, 1, 12, 0, 0, 0, time.UTC)),
+	})
+	if exp := []string{"_rollups." + rollup.name}; !reflect.DeepEqual(store.deleted, exp) {
+		t.Fatalf("unexpected deleted measurements: %v", store.deleted)
+	}
+
+	// The next query writes the rollup again.
+	other, hit := r.acquire("db0", "", stmt)
+	if other == nil || hit {
+		t.Fatal("expected rollup to be written again")
+	}
+
+	// A write while the rollup is being written prevents it from being used.
+	r.Invalidate("db0", []models.Point{
+		models.MustNewPoint("cpu", nil, models.Fields{"value": 1.0}, time.Date(2017, 1, 1, 12, 0, 0, 0, time.UTC)),
+	})
+	if r.ready(other, []string{"mean"}) {
+		t.Fatal("expected invalidated rollup not to be ready")
+	}
+	if stats := r.Statistics(nil)[0].Values; stats[statReadRollupInvalidated] != int64(2) {
+		t.Fatalf("unexpected invalidated count: %v", stats[statReadRollupInvalidated])
+	}
+}
+
+func TestReadRollups_Evict(t *testing.T) {
+	r, store := newTestReadRollups(2)
+
+	var rollups []*readRollup
+	for _, s := range []string{
+		`SELECT mean(value) FROM db0.rp0.cpu WHERE time >= '2017-01-01T00:00:00Z' AND time < '2017-01-02T00:00:00Z' GROUP BY time(1h)`,
+		`SELECT max(value) FROM db0.rp0.cpu WHERE time >= '2017-01-01T00:00:00Z' AND time < '2017-01-02T00:00:00Z' GROUP BY time(1h)`,
+	} {
+		rollup, _ := r.acquire("db0", "", mustParseSelect(t, s))
+		r.ready(rollup, []string{"value"})
+		rollups = append(rollups, rollup)
+	}
+
+	// Use the first rollup so the second is the least recently used.
+	r.acquire("db0", "", mustParseSelect(t, `SELECT mean(value) FROM db0.rp0.cpu WHERE time >= '2017-01-01T00:00:00Z' AND time < '2017-01-02T00:00:00Z' GROUP BY time(1h)`))
+
+	if rollup, _ := r.acquire("db0", "", mustParseSelect(t, `SELECT min(value) FROM db0.rp0.cpu WHERE time >= '2017-01-01T00:00:00Z' AND time < '2017-01-02T00:00:00Z' GROUP BY time(1h)`)); rollup == nil {
+		t.Fatal("expected rollup to be written")
+	}
+	if exp := []string{"_rollups." + rollups[1].name}; !reflect.DeepEqual(store.deleted, exp) {
+		t.Fatalf("unexpected deleted measurements: %v", store.deleted)
+	}
+}
+
+func TestReadRollup_Points(t *testing.T) {
+	rollup := &readRollup{
+		name: "_rollup_test",
+		min:  time.Date(2017, 1, 1, 0, 30, 0, 0, time.UTC).UnixNano(),
+	}
+	points, err := rollup.points([]*models.Row{{
+		Name:    "cpu",
+		Tags:    map[string]string{"host": "a"},
+		Columns: []string{"time", "mean"},
+		Values: [][]interface{}{
+			{time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC), 1.5},
+			{time.Date(2017, 1, 1, 1, 0, 0, 0, time.UTC), nil},
+			{time.Date(2017, 1, 1, 2, 0, 0, 0, time.UTC), 2.5},
+		},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, p := range points {
+		got = append(got, p.String())
+	}
+	if exp := []string{
+		"_rollup_test,host=a mean=1.5 1483230600000000000",
+		"_rollup_test,host=a mean=2.5 1483236000000000000",
+	}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("unexpected points: %v", got)
+	}
+}
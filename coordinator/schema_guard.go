@@ -0,0 +1,152 @@
+package coordinator
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/lucaswiersma/influxdb/influxql"
+)
+
+// ErrSchemaChanged is returned by a SELECT statement when, under the
+// SchemaChangeError policy, the schema of a database it reads was changed
+// while it ran.
+var ErrSchemaChanged = errors.New("schema changed during execution")
+
+// SchemaGuard defines how SELECT statements behave when a statement that
+// changes the schema of a database they read, such as DROP MEASUREMENT, runs
+// at the same time. Statements are coordinated by database.
+type SchemaGuard struct {
+	policy string
+
+	mu        sync.Mutex
+	databases map[string]*databaseSchema
+}
+
+// NewSchemaGuard returns a guard that applies the given schema change policy.
+// It is one of SchemaChangeSnapshot and SchemaChangeError.
+func NewSchemaGuard(policy string) *SchemaGuard {
+	return &SchemaGuard{
+		policy:    policy,
+		databases: make(map[string]*databaseSchema),
+	}
+}
+
+// databaseSchema coordinates the statements that read and change the schema
+// of a database.
+type databaseSchema struct {
+	// mu is held for reading by SELECT statements and for writing by
+	// statements that change the schema under SchemaChangeSnapshot.
+	mu sync.RWMutex
+
+	// version is incremented when a change of the schema starts and again
+	// when it ends under SchemaChangeError, so it is odd during a change.
+	version uint64
+}
+
+func (g *SchemaGuard) database(name string) *databaseSchema {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	s := g.databases[name]
+	if s == nil {
+		s = &databaseSchema{}
+		g.databases[name] = s
+	}
+	return s
+}
+
+// change runs fn, which changes the schema of database. Under
+// SchemaChangeSnapshot it waits for the SELECT statements reading the
+// database to finish first.
+func (g *SchemaGuard) change(database string, fn func() error) error {
+	s := g.database(database)
+	switch g.policy {
+	case SchemaChangeSnapshot:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+	case SchemaChangeError:
+		atomic.AddUint64(&s.version, 1)
+		defer atomic.AddUint64(&s.version, 1)
+	}
+	return fn()
+}
+
+// read starts a SELECT statement reading the given databases. Under
+// SchemaChangeSnapshot it waits for any change of their schema to finish and
+// keeps them from changing until the read is done.
+func (g *SchemaGuard) read(databases []string) *schemaRead {
+	r := &schemaRead{policy: g.policy}
+	for _, name := range databases {
+		s := g.database(name)
+		if g.policy == SchemaChangeSnapshot {
+			s.mu.RLock()
+		}
+		r.schemas = append(r.schemas, s)
+		r.versions = append(r.versions, atomic.LoadUint64(&s.version))
+	}
+	return r
+}
+
+// schemaRead is a SELECT statement reading the schema of databases.
+type schemaRead struct {
+	policy   string
+	schemas  []*databaseSchema
+	versions []uint64
+}
+
+// check returns ErrSchemaChanged under SchemaChangeError if the schema of
+// any of the databases changed since the read started, or was changing when
+// it started. It is safe to call on a nil read.
+func (r *schemaRead) check() error {
+	if r == nil || r.policy != SchemaChangeError {
+		return nil
+	}
+	for i, s := range r.schemas {
+		if v := r.versions[i]; v%2 == 1 || atomic.LoadUint64(&s.version) != v {
+			return ErrSchemaChanged
+		}
+	}
+	return nil
+}
+
+// done ends the read. It is safe to call on a nil read.
+func (r *schemaRead) done() {
+	if r == nil || r.policy != SchemaChangeSnapshot {
+		return
+	}
+	for _, s := range r.schemas {
+		s.mu.RUnlock()
+	}
+}
+
+// sourceDatabases returns the databases read by sources, including those of
+// subqueries, in sorted order. Measurements without a database are read from
+// defaultDatabase.
+func sourceDatabases(sources influxql.Sources, defaultDatabase string) []string {
+	set := make(map[string]struct{})
+	var walk func(sources influxql.Sources)
+	walk = func(sources influxql.Sources) {
+		for _, source := range sources {
+			switch source := source.(type) {
+			case *influxql.Measurement:
+				if source.Database != "" {
+					set[source.Database] = struct{}{}
+				} else {
+					set[defaultDatabase] = struct{}{}
+				}
+			case *influxql.SubQuery:
+				walk(source.Statement.Sources)
+			}
+		}
+	}
+	walk(sources)
+
+	// Databases are always locked in the same order.
+	a := make([]string, 0, len(set))
+	for name := range set {
+		a = append(a, name)
+	}
+	sort.Strings(a)
+	return a
+}
@@ -0,0 +1,207 @@
+package coordinator
+
+import (
+	"sort"
+
+	"github.com/lucaswiersma/influxdb/influxql"
+)
+
+// seriesSample is a series of a measurement and how it ranks when a SELECT
+// is sampled.
+type seriesSample struct {
+	tags influxql.Tags
+
+	// rank is the number of points of the series in the queried time range,
+	// or the time of its last point, depending on the ranking.
+	rank int64
+}
+
+// seriesSamples sorts samples by descending rank.
+type seriesSamples []*seriesSample
+
+func (a seriesSamples) Len() int      { return len(a) }
+func (a seriesSamples) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a seriesSamples) Less(i, j int) bool {
+	if a[i].rank != a[j].rank {
+		return a[i].rank > a[j].rank
+	}
+	return a[i].tags.ID() < a[j].tags.ID()
+}
+
+// sampleSeries narrows the condition of stmt to the n series of the
+// measurement it selects from with the most points, or the most recent
+// point, in the time range of opt. The series are ranked by reading the
+// count or the last value of each field of the measurement grouped by every
+// tag. It returns the number of series with points in the time range, or 0
+// if the statement was not narrowed because it has n or fewer of them or
+// does not select from a single measurement.
+func sampleSeries(stmt *influxql.SelectStatement, ic IteratorCreator, opt *influxql.SelectOptions, n int, by string) (int, error) {
+	if len(stmt.Sources) != 1 {
+		return 0, nil
+	}
+	m, ok := stmt.Sources[0].(*influxql.Measurement)
+	if !ok || m.Regex != nil {
+		return 0, nil
+	}
+
+	// Skip reading the series when the index has few enough of them.
+	if seriesN, err := ic.SeriesN(m, stmt.Condition); err != nil || seriesN <= n {
+		return 0, err
+	}
+
+	fields, dimensions, err := ic.FieldDimensions(m)
+	if err != nil {
+		return 0, err
+	}
+	tagKeys := make([]string, 0, len(dimensions))
+	for k := range dimensions {
+		tagKeys = append(tagKeys, k)
+	}
+	sort.Strings(tagKeys)
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	call := "count"
+	if by == influxql.SampleSeriesRecent {
+		call = "last"
+	}
+
+	samples := make(map[string]*seriesSample)
+	for _, name := range names {
+		itr, err := ic.CreateIterator(m, influxql.IteratorOptions{
+			Expr: &influxql.Call{
+				Name: call,
+				Args: []influxql.Expr{&influxql.VarRef{Val: name, Type: fields[name]}},
+			},
+			Dimensions:      tagKeys,
+			GroupBy:         dimensions,
+			Condition:       stmt.Condition,
+			StartTime:       opt.MinTime.UnixNano(),
+			EndTime:         opt.MaxTime.UnixNano(),
+			Ascending:       true,
+			FieldTypePolicy: opt.FieldTypePolicy,
+			BufferSize:      opt.IteratorBufferSize,
+			InterruptCh:     opt.InterruptCh,
+		})
+		if err != nil {
+			return 0, err
+		} else if itr == nil {
+			continue
+		}
+		if err := rankSeriesSamples(itr, samples, by); err != nil {
+			return 0, err
+		}
+	}
+	if len(samples) <= n {
+		return 0, nil
+	}
+
+	a := make(seriesSamples, 0, len(samples))
+	for _, s := range samples {
+		a = append(a, s)
+	}
+	sort.Sort(a)
+
+	var cond influxql.Expr
+	for _, s := range a[:n] {
+		expr := seriesCondition(tagKeys, s.tags)
+		if cond == nil {
+			cond = expr
+		} else {
+			cond = &influxql.BinaryExpr{Op: influxql.OR, LHS: cond, RHS: expr}
+		}
+	}
+	if stmt.Condition == nil {
+		stmt.Condition = cond
+	} else {
+		stmt.Condition = &influxql.BinaryExpr{
+			Op:  influxql.AND,
+			LHS: &influxql.ParenExpr{Expr: stmt.Condition},
+			RHS: &influxql.ParenExpr{Expr: cond},
+		}
+	}
+	return len(samples), nil
+}
+
+// rankSeriesSamples reads the count or last value of a field for each series
+// from itr and ranks the series of samples by the highest count, or the time
+// of the latest last value, of any field.
+func rankSeriesSamples(itr influxql.Iterator, samples map[string]*seriesSample, by string) error {
+	defer itr.Close()
+
+	rank := func(tags influxql.Tags, t, count int64) {
+		r := count
+		if by == influxql.SampleSeriesRecent {
+			r = t
+		}
+		if s := samples[tags.ID()]; s == nil {
+			samples[tags.ID()] = &seriesSample{tags: tags, rank: r}
+		} else if r > s.rank {
+			s.rank = r
+		}
+	}
+
+	switch itr := itr.(type) {
+	case influxql.FloatIterator:
+		for {
+			p, err := itr.Next()
+			if p == nil || err != nil {
+				return err
+			} else if !p.Nil {
+				rank(p.Tags, p.Time, 0)
+			}
+		}
+	case influxql.IntegerIterator:
+		for {
+			p, err := itr.Next()
+			if p == nil || err != nil {
+				return err
+			} else if !p.Nil {
+				rank(p.Tags, p.Time, p.Value)
+			}
+		}
+	case influxql.StringIterator:
+		for {
+			p, err := itr.Next()
+			if p == nil || err != nil {
+				return err
+			} else if !p.Nil {
+				rank(p.Tags, p.Time, 0)
+			}
+		}
+	case influxql.BooleanIterator:
+		for {
+			p, err := itr.Next()
+			if p == nil || err != nil {
+				return err
+			} else if !p.Nil {
+				rank(p.Tags, p.Time, 0)
+			}
+		}
+	}
+	return nil
+}
+
+// seriesCondition returns a condition matching the series with the given
+// tags. Tag keys the series does not have are matched against an empty value,
+// which only matches series without the tag.
+func seriesCondition(tagKeys []string, tags influxql.Tags) influxql.Expr {
+	values := tags.KeyValues()
+	var expr influxql.Expr
+	for _, k := range tagKeys {
+		eq := &influxql.BinaryExpr{
+			Op:  influxql.EQ,
+			LHS: &influxql.VarRef{Val: k},
+			RHS: &influxql.StringLiteral{Val: values[k]},
+		}
+		if expr == nil {
+			expr = eq
+		} else {
+			expr = &influxql.BinaryExpr{Op: influxql.AND, LHS: expr, RHS: eq}
+		}
+	}
+	return &influxql.ParenExpr{Expr: expr}
+}
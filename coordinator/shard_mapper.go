@@ -1,6 +1,7 @@
 package coordinator
 
 import (
+	"fmt"
 	"io"
 	"time"
 
@@ -14,6 +15,22 @@ type IteratorCreator interface {
 	influxql.IteratorCreator
 	influxql.FieldMapper
 	io.Closer
+
+	// SeriesN returns the number of series of the measurement that match
+	// the condition. It is used to estimate the cost of a query.
+	SeriesN(m *influxql.Measurement, condition influxql.Expr) (int, error)
+
+	// WrittenSince returns true if points between min and max were written
+	// to any of the mapped shards since the given time.
+	WrittenSince(since, min, max time.Time) bool
+
+	// UnreadableShards returns the IDs of the shards that were skipped
+	// because they could not be opened.
+	UnreadableShards() []uint64
+
+	// FieldTypes returns the distinct types a field is stored with across
+	// the mapped shards.
+	FieldTypes(m *influxql.Measurement, field string) []influxql.DataType
 }
 
 // ShardMapper retrieves and maps shards into an IteratorCreator that can later be
@@ -30,13 +47,19 @@ type LocalShardMapper struct {
 
 	TSDBStore interface {
 		ShardGroup(ids []uint64) tsdb.ShardGroup
+		UnreadableShards(ids []uint64) []uint64
 	}
+
+	// SkipUnreadableShards maps the remaining shards when some of them could
+	// not be opened. Otherwise mapping returns an error.
+	SkipUnreadableShards bool
 }
 
 // MapShards maps the sources to the appropriate shards into an IteratorCreator.
 func (e *LocalShardMapper) MapShards(sources influxql.Sources, opt *influxql.SelectOptions) (IteratorCreator, error) {
 	a := &LocalShardMapping{
-		ShardMap: make(map[Source]tsdb.ShardGroup),
+		ShardMap:        make(map[Source]tsdb.ShardGroup),
+		FieldTypePolicy: opt.FieldTypePolicy,
 	}
 
 	if err := e.mapShards(a, sources, opt); err != nil {
@@ -74,6 +97,13 @@ func (e *LocalShardMapper) mapShards(a *LocalShardMapping, sources influxql.Sour
 						shardIDs = append(shardIDs, si.ID)
 					}
 				}
+
+				if ids := e.TSDBStore.UnreadableShards(shardIDs); len(ids) > 0 {
+					if !e.SkipUnreadableShards {
+						return fmt.Errorf("cannot read shards %s of %s.%s: %s", joinUint64(ids), s.Database, s.RetentionPolicy, tsdb.ErrShardUnreadable)
+					}
+					a.Unreadable = append(a.Unreadable, ids...)
+				}
 				a.ShardMap[source] = e.TSDBStore.ShardGroup(shardIDs)
 			}
 		case *influxql.SubQuery:
@@ -88,6 +118,14 @@ func (e *LocalShardMapper) mapShards(a *LocalShardMapping, sources influxql.Sour
 // ShardMapper maps data sources to a list of shard information.
 type LocalShardMapping struct {
 	ShardMap map[Source]tsdb.ShardGroup
+
+	// Unreadable holds the IDs of the shards left out of the mapping
+	// because they could not be opened.
+	Unreadable []uint64
+
+	// FieldTypePolicy is how a field whose type differs between shards is
+	// mapped.
+	FieldTypePolicy string
 }
 
 func (a *LocalShardMapping) FieldDimensions(m *influxql.Measurement) (fields map[string]influxql.DataType, dimensions map[string]struct{}, err error) {
@@ -116,6 +154,9 @@ func (a *LocalShardMapping) FieldDimensions(m *influxql.Measurement) (fields map
 		return nil, nil, err
 	}
 	for k, typ := range f {
+		if a.FieldTypePolicy == influxql.FieldTypeNewest || a.FieldTypePolicy == influxql.FieldTypeFloat {
+			typ = a.MapType(m, k)
+		}
 		fields[k] = typ
 	}
 	for k := range d {
@@ -145,6 +186,17 @@ func (a *LocalShardMapping) MapType(m *influxql.Measurement, field string) influ
 	var typ influxql.DataType
 	for _, name := range names {
 		t := sg.MapType(name, field)
+		if isFieldType(t) {
+			switch a.FieldTypePolicy {
+			case influxql.FieldTypeNewest:
+				// Shards are mapped in time order so the last one is the newest.
+				if types := sg.FieldTypes(name, field); len(types) > 0 {
+					t = types[len(types)-1]
+				}
+			case influxql.FieldTypeFloat:
+				t = influxql.Float
+			}
+		}
 		if typ.LessThan(t) {
 			typ = t
 		}
@@ -152,6 +204,44 @@ func (a *LocalShardMapping) MapType(m *influxql.Measurement, field string) influ
 	return typ
 }
 
+// FieldTypes returns the distinct types a field is stored with across the
+// mapped shards, in order of precedence.
+func (a *LocalShardMapping) FieldTypes(m *influxql.Measurement, field string) []influxql.DataType {
+	source := Source{
+		Database:        m.Database,
+		RetentionPolicy: m.RetentionPolicy,
+	}
+
+	sg := a.ShardMap[source]
+	if sg == nil {
+		return nil
+	}
+
+	var names []string
+	if m.Regex != nil {
+		names = sg.MeasurementsByRegex(m.Regex.Val)
+	} else {
+		names = []string{m.Name}
+	}
+
+	var seen [influxql.Boolean + 1]bool
+	for _, name := range names {
+		for _, t := range sg.FieldTypes(name, field) {
+			if isFieldType(t) {
+				seen[t] = true
+			}
+		}
+	}
+
+	var types []influxql.DataType
+	for t := influxql.DataType(influxql.Float); t <= influxql.Boolean; t++ {
+		if seen[t] {
+			types = append(types, t)
+		}
+	}
+	return types
+}
+
 func (a *LocalShardMapping) CreateIterator(m *influxql.Measurement, opt influxql.IteratorOptions) (influxql.Iterator, error) {
 	source := Source{
 		Database:        m.Database,
@@ -184,11 +274,61 @@ func (a *LocalShardMapping) CreateIterator(m *influxql.Measurement, opt influxql
 	return sg.CreateIterator(m.Name, opt)
 }
 
+// SeriesN returns the number of series of the measurement that match the tag
+// filters in condition across the mapped shards.
+func (a *LocalShardMapping) SeriesN(m *influxql.Measurement, condition influxql.Expr) (int, error) {
+	source := Source{
+		Database:        m.Database,
+		RetentionPolicy: m.RetentionPolicy,
+	}
+
+	sg := a.ShardMap[source]
+	if sg == nil {
+		return 0, nil
+	}
+
+	if m.Regex == nil {
+		return sg.SeriesN(m.Name, condition)
+	}
+
+	var n int
+	for _, name := range sg.MeasurementsByRegex(m.Regex.Val) {
+		sn, err := sg.SeriesN(name, condition)
+		if err != nil {
+			return 0, err
+		}
+		n += sn
+	}
+	return n, nil
+}
+
+// WrittenSince returns true if points between min and max were written to
+// any of the mapped shards since the given time.
+func (a *LocalShardMapping) WrittenSince(since, min, max time.Time) bool {
+	for _, sg := range a.ShardMap {
+		if sg != nil && sg.WrittenSince(since, min, max) {
+			return true
+		}
+	}
+	return false
+}
+
+// UnreadableShards returns the IDs of the shards left out of the mapping
+// because they could not be opened.
+func (a *LocalShardMapping) UnreadableShards() []uint64 {
+	return a.Unreadable
+}
+
 // Close does nothing for a LocalShardMapping.
 func (a *LocalShardMapping) Close() error {
 	return nil
 }
 
+// isFieldType returns true if typ is a type a field can be stored with.
+func isFieldType(typ influxql.DataType) bool {
+	return typ >= influxql.Float && typ <= influxql.Boolean
+}
+
 // Source contains the database and retention policy source for data.
 type Source struct {
 	Database        string
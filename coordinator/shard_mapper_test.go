@@ -100,3 +100,75 @@ func TestLocalShardMapper(t *testing.T) {
 		t.Fatalf("unexpected error: %s", err)
 	}
 }
+
+// Ensure shards are only mapped when the time range of a query intersects
+// their shard group, including ranges that touch the shard group boundaries.
+func TestLocalShardMapper_ShardGroupBoundaries(t *testing.T) {
+	data := &meta.Data{}
+	if err := data.CreateDatabase("db0"); err != nil {
+		t.Fatal(err)
+	} else if err := data.CreateRetentionPolicy("db0", &meta.RetentionPolicyInfo{Name: "rp0", ReplicaN: 1, ShardGroupDuration: 24 * time.Hour}, true); err != nil {
+		t.Fatal(err)
+	}
+	for _, day := range []string{"2000-01-01T00:00:00Z", "2000-01-02T00:00:00Z", "2000-01-03T00:00:00Z"} {
+		ts, _ := time.Parse(time.RFC3339, day)
+		if err := data.CreateShardGroup("db0", "rp0", ts); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var metaClient MetaClient
+	metaClient.ShardGroupsByTimeRangeFn = data.ShardGroupsByTimeRange
+
+	var mapped []uint64
+	var tsdbStore TSDBStore
+	tsdbStore.ShardGroupFn = func(ids []uint64) tsdb.ShardGroup {
+		mapped = ids
+		return &MockShard{}
+	}
+
+	shardMapper := &coordinator.LocalShardMapper{
+		MetaClient: &metaClient,
+		TSDBStore:  &tsdbStore,
+	}
+
+	for _, tt := range []struct {
+		cond   string
+		shards []uint64
+	}{
+		{cond: `time >= '2000-01-02T00:00:00Z' AND time < '2000-01-03T00:00:00Z'`, shards: []uint64{2}},
+		{cond: `time > '2000-01-01T23:59:59.999999999Z' AND time <= '2000-01-02T23:59:59.999999999Z'`, shards: []uint64{2}},
+		{cond: `time >= '2000-01-01T00:00:00Z' AND time <= '2000-01-02T00:00:00Z'`, shards: []uint64{1, 2}},
+		{cond: `time < '2000-01-02T00:00:00Z'`, shards: []uint64{1}},
+		{cond: `time >= '2000-01-03T00:00:00Z'`, shards: []uint64{3}},
+		{cond: `time = '2000-01-01T23:59:59.999999999Z'`, shards: []uint64{1}},
+		{cond: `time = '2000-01-02T00:00:00Z'`, shards: []uint64{2}},
+		{cond: `time > '2000-01-02T00:00:00Z' AND time < '2000-01-02T00:00:00Z'`},
+		{cond: `time >= '2000-01-04T00:00:00Z'`},
+	} {
+		expr, err := influxql.ParseExpr(tt.cond)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Determine the time range the same way the statement executor does.
+		var opt influxql.SelectOptions
+		if opt.MinTime, opt.MaxTime, err = influxql.TimeRange(expr); err != nil {
+			t.Fatal(err)
+		}
+		if opt.MaxTime.IsZero() {
+			opt.MaxTime = time.Unix(0, influxql.MaxTime)
+		}
+		if opt.MinTime.IsZero() {
+			opt.MinTime = time.Unix(0, influxql.MinTime).UTC()
+		}
+
+		mapped = nil
+		measurement := &influxql.Measurement{Database: "db0", RetentionPolicy: "rp0", Name: "cpu"}
+		if _, err := shardMapper.MapShards([]influxql.Source{measurement}, &opt); err != nil {
+			t.Fatalf("%s: unexpected error: %s", tt.cond, err)
+		} else if !reflect.DeepEqual(mapped, tt.shards) {
+			t.Errorf("%s: unexpected shards: got %v, exp %v", tt.cond, mapped, tt.shards)
+		}
+	}
+}
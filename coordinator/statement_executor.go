@@ -48,10 +48,71 @@ type StatementExecutor struct {
 	MaxSelectPointN   int
 	MaxSelectSeriesN  int
 	MaxSelectBucketsN int
+
+	// IteratorBufferSize is the number of points iterators running in a
+	// separate goroutine read ahead, unless a query overrides it.
+	IteratorBufferSize int
+
+	// MaxTagValues truncates the values SHOW TAG VALUES returns for each
+	// measurement. A value of zero returns every value.
+	MaxTagValues int
+
+	// MaxSelectCost rejects a SELECT before execution when its estimated
+	// cost, weighted by SelectCostWeights, exceeds the budget.
+	MaxSelectCost     float64
+	SelectCostWeights SelectCostWeights
+
+	// MaxShardGroupsPerRetentionPolicy rejects retention policies whose
+	// duration spans more shard groups than this, if set.
+	MaxShardGroupsPerRetentionPolicy int
+
+	// StrictTypeCasts returns an error for explicit casts that cannot be
+	// performed instead of returning a null value.
+	StrictTypeCasts bool
+
+	// ProjectionOrderedColumns emits result columns in the order they appear
+	// in the SELECT projection, including an explicitly selected time column.
+	ProjectionOrderedColumns bool
+
+	// DuplicateColumns is how SELECT statements with repeated column names
+	// are handled. They are rejected if it is DuplicateColumnsError, repeated
+	// aliases are suffixed if it is DuplicateColumnsSuffix and kept otherwise.
+	DuplicateColumns string
+
+	// DefaultSelectLimit is the LIMIT added to raw SELECT statements that
+	// have none, unless the query opts out. Zero disables it.
+	DefaultSelectLimit int
+
+	// MaxSelectSeriesRows and MaxSelectRows truncate the rows a SELECT
+	// returns for each series and in total, if set.
+	MaxSelectSeriesRows int
+	MaxSelectRows       int
+
+	// SampleSeries limits a SELECT from a single measurement to this many of
+	// its series, ranked by SampleSeriesBy, unless the query overrides them.
+	// Zero disables sampling.
+	SampleSeries   int
+	SampleSeriesBy string
+
+	// MetaQueryLimiter limits the rate of metadata queries, if set.
+	MetaQueryLimiter *MetaQueryLimiter
+
+	// ReadRollups materializes the results of aggregate queries so identical
+	// queries can read them back, if set.
+	ReadRollups *ReadRollups
+
+	// SchemaGuard coordinates SELECT statements with statements that change
+	// the schema of the databases they read, if set.
+	SchemaGuard *SchemaGuard
 }
 
 // ExecuteStatement executes the given statement with the given execution context.
 func (e *StatementExecutor) ExecuteStatement(stmt influxql.Statement, ctx influxql.ExecutionContext) error {
+	// Reject metadata queries when they are being run too frequently.
+	if e.MetaQueryLimiter != nil && influxql.IsMetaQuery(stmt) && !e.MetaQueryLimiter.Allow() {
+		return influxql.ErrMetaQueryRateLimitExceeded
+	}
+
 	// Select statements are handled separately so that they can be streamed.
 	if stmt, ok := stmt.(*influxql.SelectStatement); ok {
 		return e.executeSelectStatement(stmt, &ctx)
@@ -61,6 +122,11 @@ func (e *StatementExecutor) ExecuteStatement(stmt influxql.Statement, ctx influx
 	var messages []*influxql.Message
 	var err error
 	switch stmt := stmt.(type) {
+	case *influxql.AlterDatabaseStatement:
+		if ctx.ReadOnly {
+			messages = append(messages, influxql.ReadOnlyWarning(stmt.String()))
+		}
+		err = e.executeAlterDatabaseStatement(stmt)
 	case *influxql.AlterRetentionPolicyStatement:
 		if ctx.ReadOnly {
 			messages = append(messages, influxql.ReadOnlyWarning(stmt.String()))
@@ -91,6 +157,11 @@ func (e *StatementExecutor) ExecuteStatement(stmt influxql.Statement, ctx influx
 			messages = append(messages, influxql.ReadOnlyWarning(stmt.String()))
 		}
 		err = e.executeCreateUserStatement(stmt)
+	case *influxql.CreateValidationRuleStatement:
+		if ctx.ReadOnly {
+			messages = append(messages, influxql.ReadOnlyWarning(stmt.String()))
+		}
+		err = e.executeCreateValidationRuleStatement(stmt)
 	case *influxql.DeleteSeriesStatement:
 		err = e.executeDeleteSeriesStatement(stmt, ctx.Database)
 	case *influxql.DropContinuousQueryStatement:
@@ -133,6 +204,26 @@ func (e *StatementExecutor) ExecuteStatement(stmt influxql.Statement, ctx influx
 			messages = append(messages, influxql.ReadOnlyWarning(stmt.String()))
 		}
 		err = e.executeDropUserStatement(stmt)
+	case *influxql.DropValidationRuleStatement:
+		if ctx.ReadOnly {
+			messages = append(messages, influxql.ReadOnlyWarning(stmt.String()))
+		}
+		err = e.executeDropValidationRuleStatement(stmt)
+	case *influxql.UndropShardStatement:
+		if ctx.ReadOnly {
+			messages = append(messages, influxql.ReadOnlyWarning(stmt.String()))
+		}
+		err = e.executeUndropShardStatement(stmt)
+	case *influxql.DefragmentShardStatement:
+		if ctx.ReadOnly {
+			messages = append(messages, influxql.ReadOnlyWarning(stmt.String()))
+		}
+		rows, err = e.executeDefragmentShardStatement(stmt)
+	case *influxql.MigrateFieldTypeStatement:
+		if ctx.ReadOnly {
+			messages = append(messages, influxql.ReadOnlyWarning(stmt.String()))
+		}
+		err = e.executeMigrateFieldTypeStatement(stmt, ctx.Database)
 	case *influxql.GrantStatement:
 		if ctx.ReadOnly {
 			messages = append(messages, influxql.ReadOnlyWarning(stmt.String()))
@@ -177,6 +268,8 @@ func (e *StatementExecutor) ExecuteStatement(stmt influxql.Statement, ctx influx
 		return e.executeShowTagValues(stmt, &ctx)
 	case *influxql.ShowUsersStatement:
 		rows, err = e.executeShowUsersStatement(stmt)
+	case *influxql.ShowValidationRulesStatement:
+		rows, err = e.executeShowValidationRulesStatement(stmt)
 	case *influxql.SetPasswordUserStatement:
 		if ctx.ReadOnly {
 			messages = append(messages, influxql.ReadOnlyWarning(stmt.String()))
@@ -200,11 +293,40 @@ func (e *StatementExecutor) ExecuteStatement(stmt influxql.Statement, ctx influx
 	})
 }
 
+func (e *StatementExecutor) executeAlterDatabaseStatement(stmt *influxql.AlterDatabaseStatement) error {
+	return e.MetaClient.SetDatabaseDefaultPrecision(stmt.Name, stmt.Precision)
+}
+
 func (e *StatementExecutor) executeAlterRetentionPolicyStatement(stmt *influxql.AlterRetentionPolicyStatement) error {
 	rpu := &meta.RetentionPolicyUpdate{
 		Duration:           stmt.Duration,
 		ReplicaN:           stmt.Replication,
 		ShardGroupDuration: stmt.ShardGroupDuration,
+
+		IsolatedMeasurements: stmt.IsolatedMeasurements,
+	}
+
+	if e.MaxShardGroupsPerRetentionPolicy > 0 && (rpu.Duration != nil || rpu.ShardGroupDuration != nil || rpu.IsolatedMeasurements != nil) {
+		rpi, err := e.MetaClient.RetentionPolicy(stmt.Database, stmt.Name)
+		if err != nil {
+			return err
+		} else if rpi == nil {
+			return meta.ErrRetentionPolicyNotFound
+		}
+
+		d, sgd, isolated := rpi.Duration, rpi.ShardGroupDuration, rpi.IsolatedMeasurements
+		if rpu.Duration != nil {
+			d = *rpu.Duration
+		}
+		if rpu.ShardGroupDuration != nil {
+			sgd = *rpu.ShardGroupDuration
+		}
+		if rpu.IsolatedMeasurements != nil {
+			isolated = rpu.IsolatedMeasurements
+		}
+		if err := e.checkShardGroupsN(d, sgd, isolated); err != nil {
+			return err
+		}
 	}
 
 	// Update the retention policy.
@@ -269,6 +391,11 @@ func (e *StatementExecutor) executeCreateDatabaseStatement(stmt *influxql.Create
 		ReplicaN:           stmt.RetentionPolicyReplication,
 		ShardGroupDuration: stmt.RetentionPolicyShardGroupDuration,
 	}
+	if spec.Duration != nil {
+		if err := e.checkShardGroupsN(*spec.Duration, spec.ShardGroupDuration, nil); err != nil {
+			return err
+		}
+	}
 	_, err := e.MetaClient.CreateDatabaseWithRetentionPolicy(stmt.Name, &spec)
 	return err
 }
@@ -286,6 +413,9 @@ func (e *StatementExecutor) executeCreateRetentionPolicyStatement(stmt *influxql
 		ReplicaN:           &stmt.Replication,
 		ShardGroupDuration: stmt.ShardGroupDuration,
 	}
+	if err := e.checkShardGroupsN(stmt.Duration, stmt.ShardGroupDuration, nil); err != nil {
+		return err
+	}
 
 	// Create new retention policy.
 	_, err := e.MetaClient.CreateRetentionPolicy(stmt.Database, &spec, stmt.Default)
@@ -296,6 +426,56 @@ func (e *StatementExecutor) executeCreateRetentionPolicyStatement(stmt *influxql
 	return nil
 }
 
+// checkShardGroupsN returns an error if a retention policy of duration d
+// with shard group duration sgd spans more shard groups than allowed. Each
+// isolated measurement adds a shard group of its own to every shard duration.
+func (e *StatementExecutor) checkShardGroupsN(d, sgd time.Duration, isolated []string) error {
+	if e.MaxShardGroupsPerRetentionPolicy <= 0 || d == 0 {
+		return nil
+	}
+
+	// Count the distinct isolated measurements, as the meta store does.
+	var isolatedN int64
+	for i, name := range isolated {
+		dup := false
+		for _, other := range isolated[:i] {
+			if other == name {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			isolatedN++
+		}
+	}
+
+	sgd = meta.NormalisedShardDuration(sgd, d)
+	perInterval := 1 + isolatedN
+	n := int64((d+sgd-1)/sgd) * perInterval
+	if max := int64(e.MaxShardGroupsPerRetentionPolicy); n > max {
+		var desc string
+		if isolatedN > 0 {
+			desc = fmt.Sprintf(" and %d isolated measurements", isolatedN)
+		}
+
+		// Every shard duration needs a shared shard group and one for each
+		// isolated measurement, so no shard duration fits if those alone
+		// exceed the limit.
+		intervals := max / perInterval
+		if intervals == 0 {
+			return fmt.Errorf("retention policy duration %s with shard duration %s%s spans %d shard groups, exceeding max-shard-groups-per-retention-policy limit of %d: isolate fewer measurements",
+				influxql.FormatDuration(d), influxql.FormatDuration(sgd), desc, n, max)
+		}
+
+		// Suggest the smallest whole number of hours that fits the limit.
+		min := (d + time.Duration(intervals) - 1) / time.Duration(intervals)
+		min = (min + time.Hour - 1) / time.Hour * time.Hour
+		return fmt.Errorf("retention policy duration %s with shard duration %s%s spans %d shard groups, exceeding max-shard-groups-per-retention-policy limit of %d: use a shard duration of at least %s",
+			influxql.FormatDuration(d), influxql.FormatDuration(sgd), desc, n, max, influxql.FormatDuration(min))
+	}
+	return nil
+}
+
 func (e *StatementExecutor) executeCreateSubscriptionStatement(q *influxql.CreateSubscriptionStatement) error {
 	return e.MetaClient.CreateSubscription(q.Database, q.RetentionPolicy, q.Name, q.Mode, q.Destinations)
 }
@@ -313,8 +493,12 @@ func (e *StatementExecutor) executeDeleteSeriesStatement(stmt *influxql.DeleteSe
 	// Convert "now()" to current time.
 	stmt.Condition = influxql.Reduce(stmt.Condition, &influxql.NowValuer{Now: time.Now().UTC()})
 
+	e.invalidateReadRollups(database)
+
 	// Locally delete the series.
-	return e.TSDBStore.DeleteSeries(database, stmt.Sources, stmt.Condition)
+	return e.changeSchema(database, func() error {
+		return e.TSDBStore.DeleteSeries(database, stmt.Sources, stmt.Condition)
+	})
 }
 
 func (e *StatementExecutor) executeDropContinuousQueryStatement(q *influxql.DropContinuousQueryStatement) error {
@@ -329,13 +513,17 @@ func (e *StatementExecutor) executeDropDatabaseStatement(stmt *influxql.DropData
 		return nil
 	}
 
-	// Locally delete the datababse.
-	if err := e.TSDBStore.DeleteDatabase(stmt.Name); err != nil {
-		return err
-	}
+	e.invalidateReadRollups(stmt.Name)
 
-	// Remove the database from the Meta Store.
-	return e.MetaClient.DropDatabase(stmt.Name)
+	return e.changeSchema(stmt.Name, func() error {
+		// Locally delete the datababse.
+		if err := e.TSDBStore.DeleteDatabase(stmt.Name); err != nil {
+			return err
+		}
+
+		// Remove the database from the Meta Store.
+		return e.MetaClient.DropDatabase(stmt.Name)
+	})
 }
 
 func (e *StatementExecutor) executeDropMeasurementStatement(stmt *influxql.DropMeasurementStatement, database string) error {
@@ -343,8 +531,12 @@ func (e *StatementExecutor) executeDropMeasurementStatement(stmt *influxql.DropM
 		return influxql.ErrDatabaseNotFound(database)
 	}
 
+	e.invalidateReadRollups(database)
+
 	// Locally drop the measurement
-	return e.TSDBStore.DeleteMeasurement(database, stmt.Name)
+	return e.changeSchema(database, func() error {
+		return e.TSDBStore.DeleteMeasurement(database, stmt.Name)
+	})
 }
 
 func (e *StatementExecutor) executeDropSeriesStatement(stmt *influxql.DropSeriesStatement, database string) error {
@@ -357,18 +549,98 @@ func (e *StatementExecutor) executeDropSeriesStatement(stmt *influxql.DropSeries
 		return errors.New("DROP SERIES doesn't support time in WHERE clause")
 	}
 
+	e.invalidateReadRollups(database)
+
 	// Locally drop the series.
-	return e.TSDBStore.DeleteSeries(database, stmt.Sources, stmt.Condition)
+	return e.changeSchema(database, func() error {
+		return e.TSDBStore.DeleteSeries(database, stmt.Sources, stmt.Condition)
+	})
+}
+
+// changeSchema runs fn, which changes the schema of database, coordinated with
+// the SELECT statements reading it by the schema guard, if set.
+func (e *StatementExecutor) changeSchema(database string, fn func() error) error {
+	if e.SchemaGuard == nil {
+		return fn()
+	}
+	return e.SchemaGuard.change(database, fn)
+}
+
+// invalidateReadRollups drops the rollups of a database before data is
+// deleted from it.
+func (e *StatementExecutor) invalidateReadRollups(database string) {
+	if e.ReadRollups != nil {
+		e.ReadRollups.InvalidateDatabase(database)
+	}
 }
 
 func (e *StatementExecutor) executeDropShardStatement(stmt *influxql.DropShardStatement) error {
-	// Locally delete the shard.
-	if err := e.TSDBStore.DeleteShard(stmt.ID); err != nil {
+	// Record where the shard belongs so it can be restored from quarantine.
+	q := tsdb.QuarantinedShard{ID: stmt.ID}
+	if db, rp, sgi := e.MetaClient.ShardOwner(stmt.ID); sgi != nil {
+		q.Database, q.RetentionPolicy = db, rp
+		q.ShardGroupID, q.StartTime, q.EndTime = sgi.ID, sgi.StartTime, sgi.EndTime
+	}
+
+	return e.changeSchema(q.Database, func() error {
+		// Locally quarantine the shard, or delete it if quarantining is disabled.
+		if err := e.TSDBStore.QuarantineShard(q); err != nil {
+			return err
+		}
+
+		// Remove the shard reference from the Meta Store.
+		return e.MetaClient.DropShard(stmt.ID)
+	})
+}
+
+func (e *StatementExecutor) executeUndropShardStatement(stmt *influxql.UndropShardStatement) error {
+	q, err := e.TSDBStore.QuarantinedShard(stmt.ID)
+	if err != nil {
+		return err
+	}
+
+	// Restore the shard reference in the Meta Store first, since it can fail
+	// when the shard group no longer exists.
+	if err := e.MetaClient.RestoreShard(q.Database, q.RetentionPolicy, q.ShardGroupID, q.StartTime, q.EndTime, q.ID); err != nil {
 		return err
 	}
 
-	// Remove the shard reference from the Meta Store.
-	return e.MetaClient.DropShard(stmt.ID)
+	// Move the shard back out of quarantine and reopen it, dropping the shard
+	// reference again if that fails.
+	if _, err := e.TSDBStore.UndropShard(stmt.ID); err != nil {
+		if derr := e.MetaClient.DropShard(stmt.ID); derr != nil {
+			return fmt.Errorf("%s (shard %d could not be dropped again: %s)", err, stmt.ID, derr)
+		}
+		return err
+	}
+	return nil
+}
+
+func (e *StatementExecutor) executeDefragmentShardStatement(stmt *influxql.DefragmentShardStatement) (models.Rows, error) {
+	before, after, err := e.TSDBStore.DefragmentShard(stmt.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	row := &models.Row{Columns: []string{"stage", "files", "keys", "blocks", "files_per_key", "blocks_per_key"}}
+	for _, f := range []struct {
+		stage string
+		frag  tsdb.Fragmentation
+	}{{"before", before}, {"after", after}} {
+		row.Values = append(row.Values, []interface{}{f.stage, f.frag.Files, f.frag.Keys, f.frag.Blocks, f.frag.FilesPerKey(), f.frag.BlocksPerKey()})
+	}
+	return []*models.Row{row}, nil
+}
+
+func (e *StatementExecutor) executeMigrateFieldTypeStatement(stmt *influxql.MigrateFieldTypeStatement, database string) error {
+	if dbi := e.MetaClient.Database(database); dbi == nil {
+		return influxql.ErrDatabaseNotFound(database)
+	}
+
+	// Start the migration in the background. Progress is reported through the
+	// field_migration statistics.
+	_, err := e.TSDBStore.MigrateFieldType(database, stmt.Measurement, stmt.Field, stmt.Type)
+	return err
 }
 
 func (e *StatementExecutor) executeDropRetentionPolicyStatement(stmt *influxql.DropRetentionPolicyStatement) error {
@@ -381,18 +653,37 @@ func (e *StatementExecutor) executeDropRetentionPolicyStatement(stmt *influxql.D
 		return nil
 	}
 
-	// Locally drop the retention policy.
-	if err := e.TSDBStore.DeleteRetentionPolicy(stmt.Database, stmt.Name); err != nil {
-		return err
-	}
+	e.invalidateReadRollups(stmt.Database)
+
+	return e.changeSchema(stmt.Database, func() error {
+		// Locally drop the retention policy.
+		if err := e.TSDBStore.DeleteRetentionPolicy(stmt.Database, stmt.Name); err != nil {
+			return err
+		}
 
-	return e.MetaClient.DropRetentionPolicy(stmt.Database, stmt.Name)
+		return e.MetaClient.DropRetentionPolicy(stmt.Database, stmt.Name)
+	})
 }
 
 func (e *StatementExecutor) executeDropSubscriptionStatement(q *influxql.DropSubscriptionStatement) error {
 	return e.MetaClient.DropSubscription(q.Database, q.RetentionPolicy, q.Name)
 }
 
+func (e *StatementExecutor) executeCreateValidationRuleStatement(q *influxql.CreateValidationRuleStatement) error {
+	return e.MetaClient.CreateValidationRule(q.Database, meta.ValidationRuleInfo{
+		Name:        q.Name,
+		Measurement: q.Measurement,
+		Tag:         q.Tag,
+		Field:       q.Field,
+		Min:         q.Min,
+		Max:         q.Max,
+	})
+}
+
+func (e *StatementExecutor) executeDropValidationRuleStatement(q *influxql.DropValidationRuleStatement) error {
+	return e.MetaClient.DropValidationRule(q.Database, q.Name)
+}
+
 func (e *StatementExecutor) executeDropUserStatement(q *influxql.DropUserStatement) error {
 	return e.MetaClient.DropUser(q.Name)
 }
@@ -430,26 +721,153 @@ func (e *StatementExecutor) executeSetPasswordUserStatement(q *influxql.SetPassw
 }
 
 func (e *StatementExecutor) executeSelectStatement(stmt *influxql.SelectStatement, ctx *influxql.ExecutionContext) error {
-	itrs, stmt, err := e.createIterators(stmt, ctx)
+	if ctx.Resume != nil && (stmt.OmitTime || stmt.Target != nil) {
+		return errors.New("cannot resume a statement without a time column or with INTO")
+	}
+
+	// Pin or watch the schema of the databases the statement reads.
+	var schema *schemaRead
+	if e.SchemaGuard != nil {
+		schema = e.SchemaGuard.read(sourceDatabases(stmt.Sources, ctx.Database))
+		defer schema.done()
+	}
+
+	// Join the measurements separately if the statement joins them on tags.
+	if js, err := newJoinStatement(stmt); err != nil {
+		return err
+	} else if js != nil {
+		return e.executeJoinStatement(js, ctx, schema)
+	}
+
+	// Execute the statement over both time ranges if it compares them.
+	if stmt.Compare != nil {
+		cs, err := newCompareStatement(stmt, time.Now().UTC())
+		if err != nil {
+			return err
+		}
+		return e.executeCompareStatement(cs, ctx, schema)
+	}
+
+	// Limit the points of each series of a raw query without a LIMIT. The
+	// statement is cloned so the limit is not kept by the caller's query.
+	var defaultLimit int
+	if e.DefaultSelectLimit > 0 && !ctx.NoDefaultLimit && stmt.Target == nil && stmt.IsRawQuery && stmt.Limit == 0 {
+		defaultLimit = e.DefaultSelectLimit
+		stmt = stmt.Clone()
+		stmt.Limit = defaultLimit
+	}
+
+	// Find where time was projected before it is removed from the fields.
+	timeOffset := -1
+	if e.ProjectionOrderedColumns && stmt.Target == nil {
+		timeOffset = projectedTimeOffset(stmt)
+	}
+
+	// Read the result from its rollup if it has been materialized, or capture
+	// the result so it can be materialized. Options that change the rows of
+	// this request only are not materialized.
+	var rollup *readRollup
+	var rollupHit bool
+	if n, _ := e.sampleSeries(ctx); e.ReadRollups != nil && timeOffset < 0 && ctx.MaxPoints == 0 && ctx.MergePrecision == 0 && ctx.MaxGroups == 0 && n == 0 && !ctx.MarkFilled && !ctx.AlignToStart && ctx.BucketEdge != influxql.BucketEdgeEnd && ctx.DecimalPlaces == 0 && ctx.Resume == nil {
+		if rollup, rollupHit = e.ReadRollups.acquire(ctx.Database, ctx.FieldTypePolicy, stmt); rollupHit {
+			stmt = rollup.rewrite(stmt)
+		}
+	}
+	defer func() {
+		if rollup != nil && !rollupHit {
+			e.ReadRollups.release(rollup)
+		}
+	}()
+
+	// Sample the memory used while the iterators are created and read.
+	var sampler *memorySampler
+	if ctx.Stats {
+		sampler = startMemorySampler(memorySampleInterval)
+		defer sampler.stop()
+	}
+
+	itrs, stmt, messages, skipped, err := e.createIterators(stmt, ctx)
 	if err != nil {
 		return err
 	}
 
+	// Don't materialize a result that is missing the data of unreadable
+	// shards, as later queries would read it without a warning.
+	if skipped && rollup != nil && !rollupHit {
+		e.ReadRollups.release(rollup)
+		rollup = nil
+	}
+
 	// Generate a row emitter from the iterator set.
 	em := influxql.NewEmitter(itrs, stmt.TimeAscending(), ctx.ChunkSize)
 	em.Columns = stmt.ColumnNames()
 	em.OmitTime = stmt.OmitTime
 	defer em.Close()
 
+	// Determine which columns have an explicit cast applied.
+	casts := columnCasts(stmt)
+
+	// Determine which columns have a unit conversion applied.
+	conversions := columnConversions(stmt)
+
+	// Merge the points of each series to the requested precision.
+	var pm *precisionMerger
+	if ctx.MergePrecision > 0 && stmt.Target == nil && !stmt.OmitTime {
+		pm = newPrecisionMerger(stmt, em.Columns, ctx.MergePrecision)
+	}
+
+	// Downsample each series to the requested number of points.
+	var ds *downsampler
+	if ctx.MaxPoints > 0 && stmt.Target == nil {
+		ds = newDownsampler(stmt, em.Columns, ctx.MaxPoints, ctx.MaxPointsAggregate)
+	}
+
+	// Determine the position the time column is moved to, if any.
+	var columns []string
+	timeIndex := -1
+	if timeOffset >= 0 && !stmt.OmitTime {
+		timeIndex = len(em.Columns) - 1 - timeOffset
+	}
+	if timeIndex > 0 {
+		columns = moveTimeColumn(em.Columns, timeIndex)
+	}
+
+	// Mark rows containing filled values so they can be told apart from real
+	// data. The marker is always the last column so it isn't moved with time.
+	if ctx.MarkFilled && stmt.Target == nil {
+		em.MarkFilled = true
+		em.Columns = append(em.Columns, "_filled")
+		if columns != nil {
+			columns = append(columns, "_filled")
+		}
+	}
+
 	// Emit rows to the results channel.
 	var writeN int64
 	var emitted bool
 
+	var lastRow *models.Row
+	var groupN int
+	var truncated bool
+
+	var seriesRow *models.Row
+	var seriesRowN, rowN int
+	var seriesRowsTruncated, rowsTruncated bool
+
+	var rollupRows []*models.Row
+	var rollupN int
+
 	var pointsWriter *BufferedPointsWriter
 	if stmt.Target != nil {
 		pointsWriter = NewBufferedPointsWriter(e.PointsWriter, stmt.Target.Measurement.Database, stmt.Target.Measurement.RetentionPolicy, 10000)
 	}
 
+	// Track the last point returned so the client can resume after it.
+	var cp *checkpointer
+	if (ctx.Checkpoints || ctx.Resume != nil) && stmt.Target == nil {
+		cp = newCheckpointer(stmt.TimeAscending(), ctx.Resume)
+	}
+
 	for {
 		row, partial, err := em.Emit()
 		if err != nil {
@@ -464,6 +882,103 @@ func (e *StatementExecutor) executeSelectStatement(stmt *influxql.SelectStatemen
 			break
 		}
 
+		if casts != nil {
+			if err := e.castRow(row, casts); err != nil {
+				return err
+			}
+		}
+		if conversions != nil {
+			convertRow(row, conversions)
+		}
+
+		if pm != nil {
+			if row = pm.add(row, partial); row == nil {
+				continue
+			}
+		}
+
+		if timeIndex > 0 {
+			row.Columns = columns
+			for _, values := range row.Values {
+				moveTimeValue(values, timeIndex)
+			}
+		}
+
+		if ds != nil {
+			if row = ds.add(row, partial); row == nil {
+				continue
+			}
+			partial = false
+		}
+
+		if cp != nil {
+			if row = cp.filter(row); row == nil {
+				continue
+			}
+		}
+
+		// Stop once the requested number of series has been returned.
+		if ctx.MaxGroups > 0 && stmt.Target == nil {
+			if lastRow == nil || !lastRow.SameSeries(row) {
+				if groupN++; groupN > ctx.MaxGroups {
+					truncated = true
+					break
+				}
+			}
+			lastRow = row
+		}
+
+		// Truncate each series and then the whole result to the row limits.
+		// LIMIT and OFFSET have already been applied to each series.
+		if stmt.Target == nil && (e.MaxSelectSeriesRows > 0 || e.MaxSelectRows > 0) {
+			var limited bool
+			if e.MaxSelectSeriesRows > 0 {
+				if seriesRow == nil || !seriesRow.SameSeries(row) {
+					seriesRowN = 0
+				}
+				seriesRow = row
+				if n := e.MaxSelectSeriesRows - seriesRowN; len(row.Values) > n {
+					row.Values = row.Values[:n]
+					seriesRowsTruncated, limited = true, true
+				}
+				seriesRowN += len(row.Values)
+			}
+			if e.MaxSelectRows > 0 {
+				if n := e.MaxSelectRows - rowN; len(row.Values) > n {
+					row.Values = row.Values[:n]
+					rowsTruncated, limited = true, true
+				}
+				rowN += len(row.Values)
+			}
+
+			// Don't materialize a truncated result.
+			if limited {
+				partial = false
+				if rollup != nil && !rollupHit {
+					e.ReadRollups.release(rollup)
+					rollup, rollupRows = nil, nil
+				}
+			}
+
+			if rowsTruncated && len(row.Values) == 0 {
+				break
+			} else if len(row.Values) == 0 {
+				continue
+			}
+		}
+
+		if rollupHit {
+			row.Name = rollup.source
+		} else if rollup != nil {
+			// Give up on the rollup if the result is too large.
+			if rollupN += len(row.Values); rollupN > e.ReadRollups.maxPointN {
+				e.ReadRollups.release(rollup)
+				rollup, rollupRows = nil, nil
+			} else {
+				rollupRows = append(rollupRows, copyRow(row))
+			}
+		}
+
 		// Write points back into system for INTO statements.
 		if stmt.Target != nil {
 			if err := e.writeInto(pointsWriter, stmt, row); err != nil {
@@ -478,6 +993,20 @@ func (e *StatementExecutor) executeSelectStatement(stmt *influxql.SelectStatemen
 			Series:      []*models.Row{row},
 			Partial:     partial,
 		}
+		if !emitted {
+			result.Messages = messages
+		}
+		if cp != nil {
+			cp.record(row)
+			if ctx.Checkpoints {
+				result.Checkpoint = cp.checkpoint()
+			}
+		}
+
+		// Fail instead of returning rows read across a schema change.
+		if err := schema.check(); err != nil {
+			return err
+		}
 
 		// Send results or exit if closing.
 		if err := ctx.Send(result); err != nil {
@@ -487,16 +1016,28 @@ func (e *StatementExecutor) executeSelectStatement(stmt *influxql.SelectStatemen
 		emitted = true
 	}
 
+	if err := schema.check(); err != nil {
+		return err
+	}
+
+	// Report the cost of the statement after all of its rows.
+	var statsMessage *influxql.Message
+	if sampler != nil {
+		statsMessage = influxql.QueryStatsMessage(influxql.Iterators(itrs).Stats(), sampler.stop())
+	}
+
 	// Flush remaining points and emit write count if an INTO statement.
 	if stmt.Target != nil {
 		if err := pointsWriter.Flush(); err != nil {
 			return err
 		}
 
-		var messages []*influxql.Message
 		if ctx.ReadOnly {
 			messages = append(messages, influxql.ReadOnlyWarning(stmt.String()))
 		}
+		if statsMessage != nil {
+			messages = append(messages, statsMessage)
+		}
 
 		return ctx.Send(&influxql.Result{
 			StatementID: ctx.StatementID,
@@ -509,24 +1050,125 @@ func (e *StatementExecutor) executeSelectStatement(stmt *influxql.SelectStatemen
 		})
 	}
 
+	if rollup != nil && !rollupHit {
+		e.materializeReadRollup(rollup, rollupRows)
+		rollup = nil
+	}
+
+	var trailer []*influxql.Message
+	if defaultLimit > 0 {
+		trailer = append(trailer, influxql.DefaultLimitWarning(defaultLimit))
+	}
+	if truncated {
+		trailer = append(trailer, influxql.MaxGroupsWarning(ctx.MaxGroups))
+	}
+	if seriesRowsTruncated {
+		trailer = append(trailer, influxql.MaxSeriesRowsWarning(e.MaxSelectSeriesRows))
+	}
+	if rowsTruncated {
+		trailer = append(trailer, influxql.MaxRowsWarning(e.MaxSelectRows))
+	}
+	if statsMessage != nil {
+		trailer = append(trailer, statsMessage)
+	}
+
 	// Always emit at least one result.
 	if !emitted {
 		return ctx.Send(&influxql.Result{
 			StatementID: ctx.StatementID,
+			Messages:    append(messages, trailer...),
 			Series:      make([]*models.Row, 0),
 		})
+	} else if len(trailer) > 0 {
+		return ctx.Send(&influxql.Result{
+			StatementID: ctx.StatementID,
+			Messages:    trailer,
+		})
 	}
 
 	return nil
 }
 
-func (e *StatementExecutor) createIterators(stmt *influxql.SelectStatement, ctx *influxql.ExecutionContext) ([]influxql.Iterator, *influxql.SelectStatement, error) {
+// materializeReadRollup writes the result rows of a query to its rollup.
+func (e *StatementExecutor) materializeReadRollup(rollup *readRollup, rows []*models.Row) {
+	if len(rows) == 0 {
+		e.ReadRollups.release(rollup)
+		return
+	}
+
+	points, err := rollup.points(rows)
+	if err == nil {
+		err = e.PointsWriter.WritePointsInto(&IntoWriteRequest{
+			Database:        ReadRollupDatabase,
+			RetentionPolicy: ReadRollupRetentionPolicy,
+			Points:          points,
+		})
+	}
+	if err != nil {
+		e.ReadRollups.release(rollup)
+		return
+	}
+
+	columns := make([]string, 0, len(rows[0].Columns))
+	for _, c := range rows[0].Columns {
+		if c != "time" {
+			columns = append(columns, c)
+		}
+	}
+	e.ReadRollups.ready(rollup, columns)
+}
+
+// readRows reads every row of a statement and passes it to fn. Returns the
+// rewritten statement and the messages of the statement.
+func (e *StatementExecutor) readRows(stmt *influxql.SelectStatement, ctx *influxql.ExecutionContext, fn func(row *models.Row)) (*influxql.SelectStatement, []*influxql.Message, error) {
+	itrs, stmt, messages, _, err := e.createIterators(stmt, ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	em := influxql.NewEmitter(itrs, stmt.TimeAscending(), 0)
+	em.Columns = stmt.ColumnNames()
+	defer em.Close()
+	for {
+		row, _, err := em.Emit()
+		if err != nil {
+			return nil, nil, err
+		} else if row == nil {
+			break
+		}
+		fn(row)
+	}
+
+	// Check if the query was interrupted while reading.
+	select {
+	case <-ctx.InterruptCh:
+		return nil, nil, influxql.ErrQueryInterrupted
+	default:
+	}
+	return stmt, messages, nil
+}
+
+// createIterators creates the iterators of stmt. The returned bool is true if
+// data was left out because some of the shards could not be read.
+func (e *StatementExecutor) createIterators(stmt *influxql.SelectStatement, ctx *influxql.ExecutionContext) ([]influxql.Iterator, *influxql.SelectStatement, []*influxql.Message, bool, error) {
 	// It is important to "stamp" this time so that everywhere we evaluate `now()` in the statement is EXACTLY the same `now`
 	now := time.Now().UTC()
 	opt := influxql.SelectOptions{
-		InterruptCh: ctx.InterruptCh,
-		NodeID:      ctx.ExecutionOptions.NodeID,
-		MaxSeriesN:  e.MaxSelectSeriesN,
+		InterruptCh:      ctx.InterruptCh,
+		NodeID:           ctx.ExecutionOptions.NodeID,
+		MaxSeriesN:       e.MaxSelectSeriesN,
+		AlignToStart:     ctx.AlignToStart,
+		DedupeSubqueries: ctx.DedupeSubqueries,
+		StableMerge:      ctx.StableMerge,
+		FieldTypePolicy:  ctx.FieldTypePolicy,
+		BucketEdge:       ctx.BucketEdge,
+		DecimalPlaces:    ctx.DecimalPlaces,
+		ShareScans:       ctx.ShareScans,
+
+		IteratorBufferSize: e.IteratorBufferSize,
+	}
+	if ctx.IteratorBufferSize > 0 {
+		opt.IteratorBufferSize = ctx.IteratorBufferSize
 	}
 
 	// Replace instances of "now()" with the current time, and check the resultant times.
@@ -536,7 +1178,13 @@ func (e *StatementExecutor) createIterators(stmt *influxql.SelectStatement, ctx
 	var err error
 	opt.MinTime, opt.MaxTime, err = influxql.TimeRange(stmt.Condition)
 	if err != nil {
-		return nil, stmt, err
+		return nil, stmt, nil, false, err
+	}
+
+	// Both ends of the time range are inclusive, so it is empty if the start
+	// is after the end.
+	if ctx.EmptyTimeRange == influxql.EmptyTimeRangeError && !opt.MinTime.IsZero() && !opt.MaxTime.IsZero() && opt.MinTime.After(opt.MaxTime) {
+		return nil, stmt, nil, false, fmt.Errorf("empty time range: start %s is after end %s", opt.MinTime.Format(time.RFC3339Nano), opt.MaxTime.Format(time.RFC3339Nano))
 	}
 
 	if opt.MaxTime.IsZero() {
@@ -554,7 +1202,7 @@ func (e *StatementExecutor) createIterators(stmt *influxql.SelectStatement, ctx
 
 	// Rewrite time condition.
 	if err := stmt.RewriteTimeCondition(now); err != nil {
-		return nil, stmt, err
+		return nil, stmt, nil, false, err
 	}
 
 	// Rewrite any regex conditions that could make use of the index.
@@ -563,47 +1211,349 @@ func (e *StatementExecutor) createIterators(stmt *influxql.SelectStatement, ctx
 	// Create an iterator creator based on the shards in the cluster.
 	ic, err := e.ShardMapper.MapShards(stmt.Sources, &opt)
 	if err != nil {
-		return nil, stmt, err
+		return nil, stmt, nil, false, err
 	}
 	defer ic.Close()
 
+	// Warn if data in the queried time range may still be arriving.
+	var messages []*influxql.Message
+	if ctx.RecentWrites > 0 && ic.WrittenSince(now.Add(-ctx.RecentWrites), opt.MinTime, opt.MaxTime) {
+		messages = append(messages, influxql.RecentWritesWarning(ctx.RecentWrites))
+	}
+
+	// Warn that data was left out if any of the shards could not be read.
+	ids := ic.UnreadableShards()
+	if len(ids) > 0 {
+		messages = append(messages, influxql.UnreadableShardsWarning(ids))
+	}
+
+	// Read explicitly cast fields in their stored type so they can be
+	// converted once the results are emitted.
+	stmt.RewriteCasts()
+
 	// Rewrite wildcards, if any exist.
 	tmp, err := stmt.RewriteFields(ic)
 	if err != nil {
-		return nil, stmt, err
+		return nil, stmt, nil, false, err
 	}
 	stmt = tmp
 
-	if e.MaxSelectBucketsN > 0 && !stmt.IsRawQuery {
+	// Return a column per type for fields stored with more than one type.
+	if opt.FieldTypePolicy == influxql.FieldTypeTyped {
+		stmt.Fields = splitTypedFields(stmt.Fields, stmt.Sources, ic)
+	}
+
+	// Reject or rename repeated column names.
+	switch e.DuplicateColumns {
+	case DuplicateColumnsError:
+		if name := stmt.DuplicateColumnName(); name != "" {
+			return nil, stmt, nil, false, fmt.Errorf("duplicate column name %q, use AS to give each column a unique name", name)
+		}
+	case DuplicateColumnsSuffix:
+		stmt.SuffixDuplicateAliases()
+	}
+
+	// Narrow the statement to a sample of the series of its measurement.
+	if n, by := e.sampleSeries(ctx); n > 0 && stmt.Target == nil {
+		total, err := sampleSeries(stmt, ic, &opt, n, by)
+		if err != nil {
+			return nil, stmt, nil, false, err
+		} else if total > 0 {
+			messages = append(messages, influxql.SampledSeriesWarning(n, total, by))
+		}
+	}
+
+	var buckets int64
+	if (e.MaxSelectBucketsN > 0 || e.MaxSelectCost > 0) && !stmt.IsRawQuery {
 		interval, err := stmt.GroupByInterval()
 		if err != nil {
-			return nil, stmt, err
+			return nil, stmt, nil, false, err
 		}
 
 		if interval > 0 {
 			// Determine the start and end time matched to the interval (may not match the actual times).
-			min := opt.MinTime.Truncate(interval)
-			max := opt.MaxTime.Truncate(interval).Add(interval)
+			minTime, maxTime := opt.MinTime, opt.MaxTime
+			if opt.BucketEdge == influxql.BucketEdgeEnd {
+				minTime, maxTime = minTime.Add(-time.Nanosecond), maxTime.Add(-time.Nanosecond)
+			}
+			min := minTime.Truncate(interval)
+			max := maxTime.Truncate(interval).Add(interval)
 
 			// Determine the number of buckets by finding the time span and dividing by the interval.
-			buckets := int64(max.Sub(min)) / int64(interval)
-			if int(buckets) > e.MaxSelectBucketsN {
-				return nil, stmt, fmt.Errorf("max-select-buckets limit exceeded: (%d/%d)", buckets, e.MaxSelectBucketsN)
+			buckets = int64(max.Sub(min)) / int64(interval)
+			if e.MaxSelectBucketsN > 0 && int(buckets) > e.MaxSelectBucketsN {
+				return nil, stmt, nil, false, fmt.Errorf("max-select-buckets limit exceeded: (%d/%d)", buckets, e.MaxSelectBucketsN)
 			}
 		}
 	}
 
+	// Reject the query up front if its estimated cost is over budget.
+	if e.MaxSelectCost > 0 {
+		est, err := estimateSelectCost(stmt, ic, &opt, now, buckets)
+		if err != nil {
+			return nil, stmt, nil, false, err
+		}
+		if cost := est.Cost(e.SelectCostWeights); cost > e.MaxSelectCost {
+			return nil, stmt, nil, false, fmt.Errorf("max-select-cost limit exceeded: (%.0f/%.0f) estimated from %s, narrow the time range, filter on tags or use a larger GROUP BY interval", cost, e.MaxSelectCost, est)
+		}
+	}
+
 	// Create a set of iterators from a selection.
 	itrs, err := influxql.Select(stmt, ic, &opt)
 	if err != nil {
-		return nil, stmt, err
+		return nil, stmt, nil, false, err
 	}
 
 	if e.MaxSelectPointN > 0 {
 		monitor := influxql.PointLimitMonitor(itrs, influxql.DefaultStatsInterval, e.MaxSelectPointN)
 		ctx.Query.Monitor(monitor)
 	}
-	return itrs, stmt, nil
+	return itrs, stmt, messages, len(ids) > 0, nil
+}
+
+// sampleSeries returns the number of series a SELECT from a single
+// measurement is sampled to and how they are ranked, preferring the options
+// of the query to the defaults of the executor.
+func (e *StatementExecutor) sampleSeries(ctx *influxql.ExecutionContext) (int, string) {
+	n, by := e.SampleSeries, e.SampleSeriesBy
+	if ctx.SampleSeries > 0 {
+		n = ctx.SampleSeries
+	}
+	if ctx.SampleSeriesBy != "" {
+		by = ctx.SampleSeriesBy
+	}
+	if by == "" {
+		by = influxql.SampleSeriesPoints
+	}
+	return n, by
+}
+
+// splitTypedFields replaces each selected field that is stored with more than
+// one type across the mapped shards with a field per type, named after the
+// field and the type.
+func splitTypedFields(fields influxql.Fields, sources influxql.Sources, ic IteratorCreator) influxql.Fields {
+	other := make(influxql.Fields, 0, len(fields))
+	for _, f := range fields {
+		ref, ok := f.Expr.(*influxql.VarRef)
+		if !ok || !isFieldType(ref.Type) {
+			other = append(other, f)
+			continue
+		}
+
+		var seen [influxql.Boolean + 1]bool
+		var n int
+		for _, src := range sources {
+			if m, ok := src.(*influxql.Measurement); ok {
+				for _, t := range ic.FieldTypes(m, ref.Val) {
+					if !seen[t] {
+						seen[t] = true
+						n++
+					}
+				}
+			}
+		}
+		if n < 2 {
+			other = append(other, f)
+			continue
+		}
+
+		name := f.Name()
+		for t := influxql.DataType(influxql.Float); t <= influxql.Boolean; t++ {
+			if seen[t] {
+				other = append(other, &influxql.Field{
+					Expr:  &influxql.VarRef{Val: ref.Val, Type: t},
+					Alias: fmt.Sprintf("%s_%s", name, t),
+				})
+			}
+		}
+	}
+	return other
+}
+
+// projectedTimeOffset returns the number of result columns that follow an
+// explicitly selected time field. Returns -1 if time is not selected or the
+// columns following it cannot be determined until wildcards are expanded.
+func projectedTimeOffset(stmt *influxql.SelectStatement) int {
+	offset := -1
+	for _, f := range stmt.Fields {
+		if ref, ok := f.Expr.(*influxql.VarRef); ok && ref.Val == "time" {
+			offset = 0
+			continue
+		} else if offset < 0 {
+			continue
+		}
+
+		switch expr := f.Expr.(type) {
+		case *influxql.Wildcard, *influxql.RegexLiteral:
+			return -1
+		case *influxql.Call:
+			offset++
+
+			// Top and bottom add a column for each of their extra arguments.
+			if expr.Name == "top" || expr.Name == "bottom" {
+				for _, arg := range expr.Args[1:] {
+					if _, ok := arg.(*influxql.VarRef); ok {
+						offset++
+					}
+				}
+			}
+		default:
+			offset++
+		}
+	}
+	return offset
+}
+
+// moveTimeColumn returns a copy of columns with the leading time column moved
+// to index i.
+func moveTimeColumn(columns []string, i int) []string {
+	other := make([]string, len(columns))
+	copy(other, columns[1:i+1])
+	other[i] = columns[0]
+	copy(other[i+1:], columns[i+1:])
+	return other
+}
+
+// moveTimeValue moves the leading time value of a row to index i.
+func moveTimeValue(values []interface{}, i int) {
+	if i >= len(values) {
+		return
+	}
+	t := values[0]
+	copy(values, values[1:i+1])
+	values[i] = t
+}
+
+// columnCasts returns the cast for each column of the statement's results.
+// Returns nil if no column has an explicit cast.
+func columnCasts(stmt *influxql.SelectStatement) []influxql.DataType {
+	var casts []influxql.DataType
+	if !stmt.OmitTime {
+		casts = append(casts, influxql.Unknown)
+	}
+
+	var found bool
+	for _, f := range stmt.Fields {
+		casts = append(casts, f.Cast)
+		if f.Cast != influxql.Unknown {
+			found = true
+		}
+
+		// Top and bottom add a column for each of their extra arguments.
+		if call, ok := f.Expr.(*influxql.Call); ok && (call.Name == "top" || call.Name == "bottom") {
+			for _, arg := range call.Args[1:] {
+				if _, ok := arg.(*influxql.VarRef); ok {
+					casts = append(casts, influxql.Unknown)
+				}
+			}
+		}
+	}
+
+	if !found {
+		return nil
+	}
+	return casts
+}
+
+// columnConversions returns the unit conversion for each column of the
+// statement's results. Returns nil if no column has a conversion.
+func columnConversions(stmt *influxql.SelectStatement) []*influxql.UnitConversion {
+	var conversions []*influxql.UnitConversion
+	if !stmt.OmitTime {
+		conversions = append(conversions, nil)
+	}
+
+	var found bool
+	for _, f := range stmt.Fields {
+		conversions = append(conversions, f.Conversion)
+		if f.Conversion != nil {
+			found = true
+		}
+
+		// Top and bottom add a column for each of their extra arguments.
+		if call, ok := f.Expr.(*influxql.Call); ok && (call.Name == "top" || call.Name == "bottom") {
+			for _, arg := range call.Args[1:] {
+				if _, ok := arg.(*influxql.VarRef); ok {
+					conversions = append(conversions, nil)
+				}
+			}
+		}
+	}
+
+	if !found {
+		return nil
+	}
+	return conversions
+}
+
+// convertRow converts the values in row to the unit of each column's conversion.
+func convertRow(row *models.Row, conversions []*influxql.UnitConversion) {
+	for _, values := range row.Values {
+		for i, conv := range conversions {
+			if conv == nil || i >= len(values) {
+				continue
+			}
+			values[i] = conv.Convert(values[i])
+		}
+	}
+}
+
+// castRow converts the values in row to the type of each column's cast.
+func (e *StatementExecutor) castRow(row *models.Row, casts []influxql.DataType) error {
+	for _, values := range row.Values {
+		for i, typ := range casts {
+			if typ == influxql.Unknown || i >= len(values) || values[i] == nil {
+				continue
+			}
+
+			v, ok := castValue(values[i], typ)
+			if !ok && e.StrictTypeCasts {
+				return fmt.Errorf("cannot cast %v to %s in column %s", values[i], typ, row.Columns[i])
+			}
+			values[i] = v
+		}
+	}
+	return nil
+}
+
+// castValue converts v to typ. Returns nil and false if v cannot be converted.
+func castValue(v interface{}, typ influxql.DataType) (interface{}, bool) {
+	switch typ {
+	case influxql.Float:
+		switch v := v.(type) {
+		case float64:
+			return v, true
+		case int64:
+			return float64(v), true
+		case string:
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				return f, true
+			}
+		}
+	case influxql.Integer:
+		switch v := v.(type) {
+		case int64:
+			return v, true
+		case float64:
+			return int64(v), true
+		case string:
+			if i, err := strconv.ParseInt(v, 10, 64); err == nil {
+				return i, true
+			}
+		}
+	case influxql.String:
+		switch v := v.(type) {
+		case string:
+			return v, true
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64), true
+		case int64:
+			return strconv.FormatInt(v, 10), true
+		case bool:
+			return strconv.FormatBool(v), true
+		}
+	}
+	return nil, false
 }
 
 func (e *StatementExecutor) executeShowContinuousQueriesStatement(stmt *influxql.ShowContinuousQueriesStatement) (models.Rows, error) {
@@ -611,9 +1561,13 @@ func (e *StatementExecutor) executeShowContinuousQueriesStatement(stmt *influxql
 
 	rows := []*models.Row{}
 	for _, di := range dis {
-		row := &models.Row{Columns: []string{"name", "query"}, Name: di.Name}
+		row := &models.Row{Columns: []string{"name", "query", "last_run"}, Name: di.Name}
 		for _, cqi := range di.ContinuousQueries {
-			row.Values = append(row.Values, []interface{}{cqi.Name, cqi.Query})
+			var lastRun interface{}
+			if !cqi.LastRun.IsZero() {
+				lastRun = cqi.LastRun
+			}
+			row.Values = append(row.Values, []interface{}{cqi.Name, cqi.Query, lastRun})
 		}
 		rows = append(rows, row)
 	}
@@ -740,6 +1694,27 @@ func (e *StatementExecutor) executeShowRetentionPoliciesStatement(q *influxql.Sh
 	return []*models.Row{row}, nil
 }
 
+func (e *StatementExecutor) executeShowValidationRulesStatement(q *influxql.ShowValidationRulesStatement) (models.Rows, error) {
+	if q.Database == "" {
+		return nil, ErrDatabaseNameRequired
+	}
+
+	di := e.MetaClient.Database(q.Database)
+	if di == nil {
+		return nil, influxdb.ErrDatabaseNotFound(q.Database)
+	}
+
+	row := &models.Row{Columns: []string{"name", "measurement", "tag", "field", "min", "max"}}
+	for _, vi := range di.ValidationRules {
+		if vi.Tag != "" {
+			row.Values = append(row.Values, []interface{}{vi.Name, vi.Measurement, vi.Tag, nil, nil, nil})
+		} else {
+			row.Values = append(row.Values, []interface{}{vi.Name, vi.Measurement, nil, vi.Field, vi.Min, vi.Max})
+		}
+	}
+	return []*models.Row{row}, nil
+}
+
 func (e *StatementExecutor) executeShowShardsStatement(stmt *influxql.ShowShardsStatement) (models.Rows, error) {
 	dis := e.MetaClient.Databases()
 
@@ -853,7 +1828,15 @@ func (e *StatementExecutor) executeShowTagValues(q *influxql.ShowTagValuesStatem
 		return ErrDatabaseNameRequired
 	}
 
-	tagValues, err := e.TSDBStore.TagValues(q.Database, q.Condition)
+	// Read one value past the server limit when it is lower than the
+	// requested limit to tell whether the values were truncated.
+	limit := q.Limit
+	capped := e.MaxTagValues > 0 && (limit <= 0 || limit > e.MaxTagValues)
+	if capped {
+		limit = e.MaxTagValues + 1
+	}
+
+	tagValues, err := e.TSDBStore.TagValues(q.Database, q.Condition, q.Offset, limit)
 	if err != nil {
 		return ctx.Send(&influxql.Result{
 			StatementID: ctx.StatementID,
@@ -862,21 +1845,12 @@ func (e *StatementExecutor) executeShowTagValues(q *influxql.ShowTagValuesStatem
 	}
 
 	emitted := false
+	var truncated bool
 	for _, m := range tagValues {
 		values := m.Values
-
-		if q.Offset > 0 {
-			if q.Offset >= len(values) {
-				values = nil
-			} else {
-				values = values[q.Offset:]
-			}
-		}
-
-		if q.Limit > 0 {
-			if q.Limit < len(values) {
-				values = values[:q.Limit]
-			}
+		if capped && len(values) > e.MaxTagValues {
+			values = values[:e.MaxTagValues]
+			truncated = true
 		}
 
 		if len(values) == 0 {
@@ -887,6 +1861,7 @@ func (e *StatementExecutor) executeShowTagValues(q *influxql.ShowTagValuesStatem
 			Name:    m.Measurement,
 			Columns: []string{"key", "value"},
 			Values:  make([][]interface{}, len(values)),
+			Partial: len(values) < len(m.Values),
 		}
 		for i, v := range values {
 			row.Values[i] = []interface{}{v.Key, v.Value}
@@ -901,6 +1876,14 @@ func (e *StatementExecutor) executeShowTagValues(q *influxql.ShowTagValuesStatem
 		emitted = true
 	}
 
+	// Warn that values were left out after the last row.
+	if truncated {
+		return ctx.Send(&influxql.Result{
+			StatementID: ctx.StatementID,
+			Messages:    []*influxql.Message{influxql.MaxTagValuesWarning(e.MaxTagValues)},
+		})
+	}
+
 	// Ensure at least one result is emitted.
 	if !emitted {
 		return ctx.Send(&influxql.Result{
@@ -1082,6 +2065,10 @@ func (e *StatementExecutor) NormalizeStatement(stmt influxql.Statement, defaultD
 			if node.Database == "" {
 				node.Database = defaultDatabase
 			}
+		case *influxql.ShowValidationRulesStatement:
+			if node.Database == "" {
+				node.Database = defaultDatabase
+			}
 		case *influxql.ShowMeasurementsStatement:
 			if node.Database == "" {
 				node.Database = defaultDatabase
@@ -1158,8 +2145,15 @@ type TSDBStore interface {
 	DeleteSeries(database string, sources []influxql.Source, condition influxql.Expr) error
 	DeleteShard(id uint64) error
 
+	QuarantineShard(q tsdb.QuarantinedShard) error
+	QuarantinedShard(id uint64) (*tsdb.QuarantinedShard, error)
+	UndropShard(id uint64) (*tsdb.QuarantinedShard, error)
+	DefragmentShard(id uint64) (before, after tsdb.Fragmentation, err error)
+
+	MigrateFieldType(database, measurement, field string, typ influxql.DataType) (*tsdb.FieldMigration, error)
+
 	Measurements(database string, cond influxql.Expr) ([]string, error)
-	TagValues(database string, cond influxql.Expr) ([]tsdb.TagValues, error)
+	TagValues(database string, cond influxql.Expr, offset, limit int) ([]tsdb.TagValues, error)
 }
 
 var _ TSDBStore = LocalTSDBStore{}
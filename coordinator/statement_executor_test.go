@@ -3,10 +3,13 @@ package coordinator_test
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"io"
 	"os"
 	"reflect"
 	"regexp"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -82,12 +85,1021 @@ func TestQueryExecutor_ExecuteQuery_SelectStatement(t *testing.T) {
 	}
 }
 
+// Ensure query executor converts explicitly cast fields after reading them.
+func TestQueryExecutor_ExecuteQuery_SelectStatement_Cast(t *testing.T) {
+	e := DefaultQueryExecutor()
+
+	e.MetaClient.ShardGroupsByTimeRangeFn = func(database, policy string, min, max time.Time) (a []meta.ShardGroupInfo, err error) {
+		return []meta.ShardGroupInfo{
+			{ID: 1, Shards: []meta.ShardInfo{
+				{ID: 100, Owners: []meta.ShardOwner{{NodeID: 0}}},
+			}},
+		}, nil
+	}
+
+	e.TSDBStore.ShardGroupFn = func(ids []uint64) tsdb.ShardGroup {
+		var sh MockShard
+		sh.CreateIteratorFn = func(m string, opt influxql.IteratorOptions) (influxql.Iterator, error) {
+			if len(opt.Aux) != 1 || opt.Aux[0].Type != influxql.String {
+				t.Fatalf("unexpected aux fields: %v", opt.Aux)
+			}
+			return &FloatIterator{Points: []influxql.FloatPoint{
+				{Name: "cpu", Time: int64(0 * time.Second), Aux: []interface{}{"1.5"}},
+				{Name: "cpu", Time: int64(1 * time.Second), Aux: []interface{}{"abc"}},
+			}}, nil
+		}
+		sh.FieldDimensionsFn = func(measurements []string) (fields map[string]influxql.DataType, dimensions map[string]struct{}, err error) {
+			return map[string]influxql.DataType{"value": influxql.String}, nil, nil
+		}
+		return &sh
+	}
+
+	// Values that cannot be converted are returned as null.
+	if a := ReadAllResults(e.ExecuteQuery(`SELECT value::float FROM cpu`, "db0", 0)); !reflect.DeepEqual(a, []*influxql.Result{
+		{
+			StatementID: 0,
+			Series: []*models.Row{{
+				Name:    "cpu",
+				Columns: []string{"time", "value"},
+				Values: [][]interface{}{
+					{time.Unix(0, 0).UTC(), float64(1.5)},
+					{time.Unix(1, 0).UTC(), nil},
+				},
+			}},
+		},
+	}) {
+		t.Fatalf("unexpected results: %s", spew.Sdump(a))
+	}
+
+	// Strict casts return an error instead.
+	e.StatementExecutor.StrictTypeCasts = true
+	if a := ReadAllResults(e.ExecuteQuery(`SELECT value::float FROM cpu`, "db0", 0)); len(a) != 1 || a[0].Err == nil {
+		t.Fatalf("expected error: %s", spew.Sdump(a))
+	} else if got, exp := a[0].Err.Error(), "cannot cast abc to float in column value"; got != exp {
+		t.Fatalf("unexpected error: got %s, exp %s", got, exp)
+	}
+}
+
+// Ensure query executor converts fields to another unit after reading them.
+func TestQueryExecutor_ExecuteQuery_SelectStatement_UnitConversion(t *testing.T) {
+	e := DefaultQueryExecutor()
+
+	e.MetaClient.ShardGroupsByTimeRangeFn = func(database, policy string, min, max time.Time) (a []meta.ShardGroupInfo, err error) {
+		return []meta.ShardGroupInfo{
+			{ID: 1, Shards: []meta.ShardInfo{
+				{ID: 100, Owners: []meta.ShardOwner{{NodeID: 0}}},
+			}},
+		}, nil
+	}
+
+	e.TSDBStore.ShardGroupFn = func(ids []uint64) tsdb.ShardGroup {
+		var sh MockShard
+		sh.CreateIteratorFn = func(m string, opt influxql.IteratorOptions) (influxql.Iterator, error) {
+			return &FloatIterator{Points: []influxql.FloatPoint{
+				{Name: "cpu", Time: int64(0 * time.Second), Aux: []interface{}{float64(100)}},
+				{Name: "cpu", Time: int64(1 * time.Second), Aux: []interface{}{nil}},
+			}}, nil
+		}
+		sh.FieldDimensionsFn = func(measurements []string) (fields map[string]influxql.DataType, dimensions map[string]struct{}, err error) {
+			return map[string]influxql.DataType{"value": influxql.Float}, nil, nil
+		}
+		return &sh
+	}
+
+	// Null values remain null.
+	if a := ReadAllResults(e.ExecuteQuery(`SELECT c_to_f(value) FROM cpu`, "db0", 0)); !reflect.DeepEqual(a, []*influxql.Result{
+		{
+			StatementID: 0,
+			Series: []*models.Row{{
+				Name:    "cpu",
+				Columns: []string{"time", "c_to_f"},
+				Values: [][]interface{}{
+					{time.Unix(0, 0).UTC(), float64(212)},
+					{time.Unix(1, 0).UTC(), nil},
+				},
+			}},
+		},
+	}) {
+		t.Fatalf("unexpected results: %s", spew.Sdump(a))
+	}
+}
+
+// Ensure query executor converts aggregates to another unit after computing them.
+func TestQueryExecutor_ExecuteQuery_SelectStatement_UnitConversion_Aggregate(t *testing.T) {
+	e := DefaultQueryExecutor()
+
+	e.MetaClient.ShardGroupsByTimeRangeFn = func(database, policy string, min, max time.Time) (a []meta.ShardGroupInfo, err error) {
+		return []meta.ShardGroupInfo{
+			{ID: 1, Shards: []meta.ShardInfo{
+				{ID: 100, Owners: []meta.ShardOwner{{NodeID: 0}}},
+			}},
+		}, nil
+	}
+
+	e.TSDBStore.ShardGroupFn = func(ids []uint64) tsdb.ShardGroup {
+		var sh MockShard
+		sh.CreateIteratorFn = func(m string, opt influxql.IteratorOptions) (influxql.Iterator, error) {
+			if call, ok := opt.Expr.(*influxql.Call); !ok || call.Name != "mean" {
+				t.Fatalf("unexpected expr: %s", opt.Expr)
+			}
+			return &FloatIterator{Points: []influxql.FloatPoint{
+				{Name: "disk", Time: int64(0 * time.Minute), Value: 2e9},
+				{Name: "disk", Time: int64(1 * time.Minute), Value: 5e8},
+			}}, nil
+		}
+		sh.FieldDimensionsFn = func(measurements []string) (fields map[string]influxql.DataType, dimensions map[string]struct{}, err error) {
+			return map[string]influxql.DataType{"used": influxql.Float}, nil, nil
+		}
+		return &sh
+	}
+
+	if a := ReadAllResults(e.ExecuteQuery(`SELECT bytes_to_gb(mean(used)) AS used_gb FROM disk WHERE time >= 0 AND time < 2m GROUP BY time(1m)`, "db0", 0)); !reflect.DeepEqual(a, []*influxql.Result{
+		{
+			StatementID: 0,
+			Series: []*models.Row{{
+				Name:    "disk",
+				Columns: []string{"time", "used_gb"},
+				Values: [][]interface{}{
+					{time.Unix(0, 0).UTC(), float64(2)},
+					{time.Unix(60, 0).UTC(), float64(0.5)},
+				},
+			}},
+		},
+	}) {
+		t.Fatalf("unexpected results: %s", spew.Sdump(a))
+	}
+}
+
+// Ensure result columns follow the SELECT projection across chunked responses.
+func TestQueryExecutor_ExecuteQuery_SelectStatement_ProjectionOrderedColumns(t *testing.T) {
+	e := DefaultQueryExecutor()
+	e.StatementExecutor.ProjectionOrderedColumns = true
+
+	e.MetaClient.ShardGroupsByTimeRangeFn = func(database, policy string, min, max time.Time) (a []meta.ShardGroupInfo, err error) {
+		return []meta.ShardGroupInfo{
+			{ID: 1, Shards: []meta.ShardInfo{
+				{ID: 100, Owners: []meta.ShardOwner{{NodeID: 0}}},
+			}},
+		}, nil
+	}
+
+	e.TSDBStore.ShardGroupFn = func(ids []uint64) tsdb.ShardGroup {
+		var sh MockShard
+		sh.CreateIteratorFn = func(m string, opt influxql.IteratorOptions) (influxql.Iterator, error) {
+			rows := []map[string]interface{}{
+				{"value": float64(100), "host": "serverA"},
+				{"value": float64(200), "host": "serverB"},
+			}
+			points := make([]influxql.FloatPoint, len(rows))
+			for i, row := range rows {
+				points[i] = influxql.FloatPoint{Name: "cpu", Time: int64(time.Duration(i) * time.Second)}
+				for _, ref := range opt.Aux {
+					points[i].Aux = append(points[i].Aux, row[ref.Val])
+				}
+			}
+			return &FloatIterator{Points: points}, nil
+		}
+		sh.FieldDimensionsFn = func(measurements []string) (fields map[string]influxql.DataType, dimensions map[string]struct{}, err error) {
+			return map[string]influxql.DataType{"value": influxql.Float}, map[string]struct{}{"host": struct{}{}}, nil
+		}
+		return &sh
+	}
+
+	if a := ReadAllResults(e.ExecuteQuery(`SELECT value, time, host FROM cpu`, "db0", 1)); !reflect.DeepEqual(a, []*influxql.Result{
+		{
+			StatementID: 0,
+			Series: []*models.Row{{
+				Name:    "cpu",
+				Columns: []string{"value", "time", "host"},
+				Values: [][]interface{}{
+					{float64(100), time.Unix(0, 0).UTC(), "serverA"},
+				},
+				Partial: true,
+			}},
+			Partial: true,
+		},
+		{
+			StatementID: 0,
+			Series: []*models.Row{{
+				Name:    "cpu",
+				Columns: []string{"value", "time", "host"},
+				Values: [][]interface{}{
+					{float64(200), time.Unix(1, 0).UTC(), "serverB"},
+				},
+			}},
+		},
+	}) {
+		t.Fatalf("unexpected results: %s", spew.Sdump(a))
+	}
+}
+
+// Ensure query executor keeps, suffixes or rejects duplicate column names.
+func TestQueryExecutor_ExecuteQuery_SelectStatement_DuplicateColumns(t *testing.T) {
+	e := DefaultQueryExecutor()
+
+	e.MetaClient.ShardGroupsByTimeRangeFn = func(database, policy string, min, max time.Time) (a []meta.ShardGroupInfo, err error) {
+		return []meta.ShardGroupInfo{
+			{ID: 1, Shards: []meta.ShardInfo{
+				{ID: 100, Owners: []meta.ShardOwner{{NodeID: 0}}},
+			}},
+		}, nil
+	}
+
+	e.TSDBStore.ShardGroupFn = func(ids []uint64) tsdb.ShardGroup {
+		var sh MockShard
+		sh.CreateIteratorFn = func(m string, opt influxql.IteratorOptions) (influxql.Iterator, error) {
+			values := map[string]float64{"total": 1, "value": 2}
+			aux := make([]interface{}, len(opt.Aux))
+			for i, ref := range opt.Aux {
+				aux[i] = values[ref.Val]
+			}
+			return &FloatIterator{Points: []influxql.FloatPoint{
+				{Name: m, Time: int64(0 * time.Second), Aux: aux},
+			}}, nil
+		}
+		sh.FieldDimensionsFn = func(measurements []string) (fields map[string]influxql.DataType, dimensions map[string]struct{}, err error) {
+			return map[string]influxql.DataType{"value": influxql.Float, "total": influxql.Float}, nil, nil
+		}
+		return &sh
+	}
+
+	// Repeated generated names are suffixed and repeated aliases are kept
+	// by default.
+	if a := ReadAllResults(e.ExecuteQuery(`SELECT value, value FROM cpu`, "db0", 0)); !reflect.DeepEqual(a, []*influxql.Result{
+		{
+			StatementID: 0,
+			Series: []*models.Row{{
+				Name:    "cpu",
+				Columns: []string{"time", "value", "value_1"},
+				Values: [][]interface{}{
+					{time.Unix(0, 0).UTC(), float64(2), float64(2)},
+				},
+			}},
+		},
+	}) {
+		t.Fatalf("unexpected results: %s", spew.Sdump(a))
+	}
+
+	if a := ReadAllResults(e.ExecuteQuery(`SELECT total AS v, value AS v FROM cpu`, "db0", 0)); !reflect.DeepEqual(a, []*influxql.Result{
+		{
+			StatementID: 0,
+			Series: []*models.Row{{
+				Name:    "cpu",
+				Columns: []string{"time", "v", "v"},
+				Values: [][]interface{}{
+					{time.Unix(0, 0).UTC(), float64(1), float64(2)},
+				},
+			}},
+		},
+	}) {
+		t.Fatalf("unexpected results: %s", spew.Sdump(a))
+	}
+
+	// Repeated aliases are suffixed in suffix mode.
+	e.StatementExecutor.DuplicateColumns = coordinator.DuplicateColumnsSuffix
+	if a := ReadAllResults(e.ExecuteQuery(`SELECT total AS v, value AS v FROM cpu, mem`, "db0", 0)); !reflect.DeepEqual(a, []*influxql.Result{
+		{
+			StatementID: 0,
+			Series: []*models.Row{{
+				Name:    "cpu",
+				Columns: []string{"time", "v", "v_1"},
+				Values: [][]interface{}{
+					{time.Unix(0, 0).UTC(), float64(1), float64(2)},
+				},
+			}},
+			Partial: true,
+		},
+		{
+			StatementID: 0,
+			Series: []*models.Row{{
+				Name:    "mem",
+				Columns: []string{"time", "v", "v_1"},
+				Values: [][]interface{}{
+					{time.Unix(0, 0).UTC(), float64(1), float64(2)},
+				},
+			}},
+		},
+	}) {
+		t.Fatalf("unexpected results: %s", spew.Sdump(a))
+	}
+
+	// Repeated names are rejected in error mode.
+	e.StatementExecutor.DuplicateColumns = coordinator.DuplicateColumnsError
+	for _, tt := range []struct {
+		q   string
+		err string
+	}{
+		{q: `SELECT value, value FROM cpu`, err: `duplicate column name "value", use AS to give each column a unique name`},
+		{q: `SELECT total AS v, value AS v FROM cpu, mem`, err: `duplicate column name "v", use AS to give each column a unique name`},
+	} {
+		if a := ReadAllResults(e.ExecuteQuery(tt.q, "db0", 0)); len(a) != 1 || a[0].Err == nil {
+			t.Fatalf("%s: expected error: %s", tt.q, spew.Sdump(a))
+		} else if got := a[0].Err.Error(); got != tt.err {
+			t.Fatalf("%s: unexpected error: got %s, exp %s", tt.q, got, tt.err)
+		}
+	}
+
+	if a := ReadAllResults(e.ExecuteQuery(`SELECT total AS v, value FROM cpu`, "db0", 0)); len(a) != 1 || a[0].Err != nil {
+		t.Fatalf("unexpected results: %s", spew.Sdump(a))
+	}
+}
+
 // Ensure query executor can enforce a maximum bucket selection count.
 func TestQueryExecutor_ExecuteQuery_MaxSelectBucketsN(t *testing.T) {
 	e := DefaultQueryExecutor()
-	e.StatementExecutor.MaxSelectBucketsN = 3
+	e.StatementExecutor.MaxSelectBucketsN = 3
+
+	// The meta client should return a single shards on the local node.
+	e.MetaClient.ShardGroupsByTimeRangeFn = func(database, policy string, min, max time.Time) (a []meta.ShardGroupInfo, err error) {
+		return []meta.ShardGroupInfo{
+			{ID: 1, Shards: []meta.ShardInfo{
+				{ID: 100, Owners: []meta.ShardOwner{{NodeID: 0}}},
+			}},
+		}, nil
+	}
+
+	e.TSDBStore.ShardGroupFn = func(ids []uint64) tsdb.ShardGroup {
+		if !reflect.DeepEqual(ids, []uint64{100}) {
+			t.Fatalf("unexpected shard ids: %v", ids)
+		}
+
+		var sh MockShard
+		sh.CreateIteratorFn = func(m string, opt influxql.IteratorOptions) (influxql.Iterator, error) {
+			return &FloatIterator{
+				Points: []influxql.FloatPoint{{Name: "cpu", Time: int64(0 * time.Second), Aux: []interface{}{float64(100)}}},
+			}, nil
+		}
+		sh.FieldDimensionsFn = func(measurements []string) (fields map[string]influxql.DataType, dimensions map[string]struct{}, err error) {
+			if !reflect.DeepEqual(measurements, []string{"cpu"}) {
+				t.Fatalf("unexpected source: %#v", measurements)
+			}
+			return map[string]influxql.DataType{"value": influxql.Float}, nil, nil
+		}
+		return &sh
+	}
+
+	// Verify all results from the query.
+	if a := ReadAllResults(e.ExecuteQuery(`SELECT count(value) FROM cpu WHERE time >= '2000-01-01T00:00:05Z' AND time < '2000-01-01T00:00:35Z' GROUP BY time(10s)`, "db0", 0)); !reflect.DeepEqual(a, []*influxql.Result{
+		{
+			StatementID: 0,
+			Err:         errors.New("max-select-buckets limit exceeded: (4/3)"),
+		},
+	}) {
+		t.Fatalf("unexpected results: %s", spew.Sdump(a))
+	}
+}
+
+func TestQueryExecutor_ExecuteQuery_MaxSelectCost(t *testing.T) {
+	e := DefaultQueryExecutor()
+	e.StatementExecutor.MaxSelectCost = 1000
+	e.StatementExecutor.SelectCostWeights = coordinator.SelectCostWeights{Series: 1, Hour: 1, Bucket: 1}
+
+	// The meta client should return a single shards on the local node.
+	e.MetaClient.ShardGroupsByTimeRangeFn = func(database, policy string, min, max time.Time) (a []meta.ShardGroupInfo, err error) {
+		return []meta.ShardGroupInfo{
+			{ID: 1, Shards: []meta.ShardInfo{
+				{ID: 100, Owners: []meta.ShardOwner{{NodeID: 0}}},
+			}},
+		}, nil
+	}
+
+	var created bool
+	e.TSDBStore.ShardGroupFn = func(ids []uint64) tsdb.ShardGroup {
+		var sh MockShard
+		sh.CreateIteratorFn = func(m string, opt influxql.IteratorOptions) (influxql.Iterator, error) {
+			created = true
+			return &FloatIterator{
+				Points: []influxql.FloatPoint{{Name: "cpu", Time: int64(0 * time.Second), Aux: []interface{}{float64(100)}}},
+			}, nil
+		}
+		sh.FieldDimensionsFn = func(measurements []string) (fields map[string]influxql.DataType, dimensions map[string]struct{}, err error) {
+			return map[string]influxql.DataType{"value": influxql.Float}, map[string]struct{}{"host": struct{}{}}, nil
+		}
+		sh.SeriesNFn = func(measurement string, condition influxql.Expr) (int, error) {
+			if measurement != "cpu" {
+				t.Fatalf("unexpected measurement: %s", measurement)
+			}
+			if strings.Contains(condition.String(), "host") {
+				return 1, nil
+			}
+			return 9, nil
+		}
+		return &sh
+	}
+
+	// 9 series over 10 hours with 10 buckets costs 10*11*11.
+	if a := ReadAllResults(e.ExecuteQuery(`SELECT count(value) FROM cpu WHERE time >= '2000-01-01T00:00:00Z' AND time < '2000-01-01T10:00:00Z' GROUP BY time(1h)`, "db0", 0)); !reflect.DeepEqual(a, []*influxql.Result{
+		{
+			StatementID: 0,
+			Err:         errors.New("max-select-cost limit exceeded: (1210/1000) estimated from series=9 range=10.0h buckets=10, narrow the time range, filter on tags or use a larger GROUP BY interval"),
+		},
+	}) {
+		t.Fatalf("unexpected results: %s", spew.Sdump(a))
+	} else if created {
+		t.Fatal("expected query to be rejected before creating iterators")
+	}
+
+	// Filtering on a tag brings the query under budget.
+	if a := ReadAllResults(e.ExecuteQuery(`SELECT count(value) FROM cpu WHERE host = 'server01' AND time >= '2000-01-01T00:00:00Z' AND time < '2000-01-01T10:00:00Z' GROUP BY time(1h)`, "db0", 0)); len(a) != 1 || a[0].Err != nil {
+		t.Fatalf("unexpected results: %s", spew.Sdump(a))
+	} else if !created {
+		t.Fatal("expected iterators to be created")
+	}
+}
+
+// Ensure ALTER DATABASE sets the default write precision of the database.
+func TestQueryExecutor_ExecuteQuery_AlterDatabase(t *testing.T) {
+	e := DefaultQueryExecutor()
+
+	var name, precision string
+	e.MetaClient.SetDatabaseDefaultPrecisionFn = func(n, p string) error {
+		name, precision = n, p
+		return nil
+	}
+
+	if a := ReadAllResults(e.ExecuteQuery(`ALTER DATABASE db0 WITH PRECISION s`, "", 0)); !reflect.DeepEqual(a, []*influxql.Result{{StatementID: 0}}) {
+		t.Fatalf("unexpected results: %s", spew.Sdump(a))
+	} else if name != "db0" || precision != "s" {
+		t.Fatalf("unexpected precision: db=%s precision=%s", name, precision)
+	}
+}
+
+func TestQueryExecutor_ExecuteQuery_MaxShardGroupsPerRetentionPolicy(t *testing.T) {
+	e := DefaultQueryExecutor()
+	e.StatementExecutor.MaxShardGroupsPerRetentionPolicy = 100
+
+	var created, updated int
+	e.MetaClient.CreateRetentionPolicyFn = func(database string, spec *meta.RetentionPolicySpec, makeDefault bool) (*meta.RetentionPolicyInfo, error) {
+		created++
+		return spec.NewRetentionPolicyInfo(), nil
+	}
+	e.MetaClient.RetentionPolicyFn = func(database, name string) (*meta.RetentionPolicyInfo, error) {
+		return &meta.RetentionPolicyInfo{Name: name, Duration: 30 * 24 * time.Hour, ShardGroupDuration: 24 * time.Hour}, nil
+	}
+	e.MetaClient.UpdateRetentionPolicyFn = func(database, name string, rpu *meta.RetentionPolicyUpdate, makeDefault bool) error {
+		updated++
+		return nil
+	}
+
+	exp := errors.New("retention policy duration 30d with shard duration 1h spans 720 shard groups, exceeding max-shard-groups-per-retention-policy limit of 100: use a shard duration of at least 8h")
+	for _, q := range []string{
+		`CREATE RETENTION POLICY rp1 ON db0 DURATION 30d REPLICATION 1 SHARD DURATION 1h`,
+		`ALTER RETENTION POLICY rp1 ON db0 SHARD DURATION 1h`,
+	} {
+		if a := ReadAllResults(e.ExecuteQuery(q, "db0", 0)); !reflect.DeepEqual(a, []*influxql.Result{{StatementID: 0, Err: exp}}) {
+			t.Fatalf("%s: unexpected results: %s", q, spew.Sdump(a))
+		}
+	}
+	if created != 0 || updated != 0 {
+		t.Fatalf("unexpected meta changes: created=%d updated=%d", created, updated)
+	}
+
+	// Infinite retention policies and those within the limit are allowed.
+	for _, q := range []string{
+		`CREATE RETENTION POLICY rp1 ON db0 DURATION 30d REPLICATION 1 SHARD DURATION 8h`,
+		`CREATE RETENTION POLICY rp2 ON db0 DURATION INF REPLICATION 1 SHARD DURATION 1h`,
+		`ALTER RETENTION POLICY rp1 ON db0 DURATION 60d`,
+	} {
+		if a := ReadAllResults(e.ExecuteQuery(q, "db0", 0)); len(a) != 1 || a[0].Err != nil {
+			t.Fatalf("%s: unexpected results: %s", q, spew.Sdump(a))
+		}
+	}
+	if created != 2 || updated != 1 {
+		t.Fatalf("unexpected meta changes: created=%d updated=%d", created, updated)
+	}
+
+	// Isolated measurements add a shard group to every shard duration, so
+	// they are checked even when the durations are unchanged.
+	for _, tt := range []struct {
+		q   string
+		err error
+	}{
+		{q: `ALTER RETENTION POLICY rp1 ON db0 ISOLATE MEASUREMENTS (cpu, mem, disk, cpu)`, err: errors.New("retention policy duration 30d with shard duration 1d and 3 isolated measurements spans 120 shard groups, exceeding max-shard-groups-per-retention-policy limit of 100: use a shard duration of at least 29h")},
+		{q: `ALTER RETENTION POLICY rp1 ON db0 SHARD DURATION 1h ISOLATE MEASUREMENTS ()`, err: exp},
+		{q: `ALTER RETENTION POLICY rp1 ON db0 ISOLATE MEASUREMENTS (cpu, mem)`},
+	} {
+		if a := ReadAllResults(e.ExecuteQuery(tt.q, "db0", 0)); !reflect.DeepEqual(a, []*influxql.Result{{StatementID: 0, Err: tt.err}}) {
+			t.Fatalf("%s: unexpected results: %s", tt.q, spew.Sdump(a))
+		}
+	}
+	if updated != 2 {
+		t.Fatalf("unexpected meta changes: updated=%d", updated)
+	}
+}
+
+func TestQueryExecutor_ExecuteQuery_RecentWrites(t *testing.T) {
+	e := DefaultQueryExecutor()
+
+	// The meta client should return a single shards on the local node.
+	e.MetaClient.ShardGroupsByTimeRangeFn = func(database, policy string, min, max time.Time) (a []meta.ShardGroupInfo, err error) {
+		return []meta.ShardGroupInfo{
+			{ID: 1, Shards: []meta.ShardInfo{
+				{ID: 100, Owners: []meta.ShardOwner{{NodeID: 0}}},
+			}},
+		}, nil
+	}
+
+	// Points up to 00:00:30 were written recently.
+	e.TSDBStore.ShardGroupFn = func(ids []uint64) tsdb.ShardGroup {
+		var sh MockShard
+		sh.CreateIteratorFn = func(m string, opt influxql.IteratorOptions) (influxql.Iterator, error) {
+			return &FloatIterator{
+				Points: []influxql.FloatPoint{{Name: "cpu", Time: int64(0 * time.Second), Aux: []interface{}{float64(100)}}},
+			}, nil
+		}
+		sh.FieldDimensionsFn = func(measurements []string) (fields map[string]influxql.DataType, dimensions map[string]struct{}, err error) {
+			return map[string]influxql.DataType{"value": influxql.Float}, nil, nil
+		}
+		sh.WrittenSinceFn = func(since, min, max time.Time) bool {
+			if d := time.Since(since); d < 30*time.Second || d > time.Minute {
+				t.Fatalf("unexpected since: %s", since)
+			}
+			return !min.After(time.Date(2000, 1, 1, 0, 0, 30, 0, time.UTC))
+		}
+		return &sh
+	}
+
+	opt := influxql.ExecutionOptions{Database: "db0", RecentWrites: 30 * time.Second}
+	results := ReadAllResults(e.QueryExecutor.ExecuteQuery(MustParseQuery(`SELECT value FROM cpu WHERE time >= '2000-01-01T00:00:00Z'`), opt, make(chan struct{})))
+	if len(results) != 1 || results[0].Err != nil {
+		t.Fatalf("unexpected results: %s", spew.Sdump(results))
+	} else if exp := []*influxql.Message{influxql.RecentWritesWarning(30 * time.Second)}; !reflect.DeepEqual(results[0].Messages, exp) {
+		t.Fatalf("unexpected messages: %s", spew.Sdump(results[0].Messages))
+	}
+
+	// Settled time ranges have no warning.
+	results = ReadAllResults(e.QueryExecutor.ExecuteQuery(MustParseQuery(`SELECT value FROM cpu WHERE time >= '2000-01-01T00:01:00Z'`), opt, make(chan struct{})))
+	if len(results) != 1 || results[0].Err != nil {
+		t.Fatalf("unexpected results: %s", spew.Sdump(results))
+	} else if len(results[0].Messages) != 0 {
+		t.Fatalf("unexpected messages: %s", spew.Sdump(results[0].Messages))
+	}
+}
+
+// Ensure shards that could not be opened fail queries unless they are skipped.
+func TestQueryExecutor_ExecuteQuery_UnreadableShards(t *testing.T) {
+	e := DefaultQueryExecutor()
+
+	e.MetaClient.ShardGroupsByTimeRangeFn = func(database, policy string, min, max time.Time) (a []meta.ShardGroupInfo, err error) {
+		return []meta.ShardGroupInfo{
+			{ID: 1, Shards: []meta.ShardInfo{
+				{ID: 100, Owners: []meta.ShardOwner{{NodeID: 0}}},
+				{ID: 101, Owners: []meta.ShardOwner{{NodeID: 0}}},
+			}},
+		}, nil
+	}
+
+	// Shard 101 failed to open.
+	e.TSDBStore.UnreadableShardsFn = func(ids []uint64) []uint64 {
+		if !reflect.DeepEqual(ids, []uint64{100, 101}) {
+			t.Fatalf("unexpected shard ids: %v", ids)
+		}
+		return []uint64{101}
+	}
+	e.TSDBStore.ShardGroupFn = func(ids []uint64) tsdb.ShardGroup {
+		var sh MockShard
+		sh.CreateIteratorFn = func(m string, opt influxql.IteratorOptions) (influxql.Iterator, error) {
+			return &FloatIterator{
+				Points: []influxql.FloatPoint{{Name: "cpu", Time: int64(0 * time.Second), Aux: []interface{}{float64(100)}}},
+			}, nil
+		}
+		sh.FieldDimensionsFn = func(measurements []string) (fields map[string]influxql.DataType, dimensions map[string]struct{}, err error) {
+			return map[string]influxql.DataType{"value": influxql.Float}, nil, nil
+		}
+		return &sh
+	}
+
+	exp := errors.New("cannot read shards 101 of db0.rp0: shard is unreadable")
+	if a := ReadAllResults(e.ExecuteQuery(`SELECT value FROM cpu`, "db0", 0)); !reflect.DeepEqual(a, []*influxql.Result{{StatementID: 0, Err: exp}}) {
+		t.Fatalf("unexpected results: %s", spew.Sdump(a))
+	}
+
+	// Skipping the shard returns the remaining data with a warning.
+	e.StatementExecutor.ShardMapper.(*coordinator.LocalShardMapper).SkipUnreadableShards = true
+	results := ReadAllResults(e.ExecuteQuery(`SELECT value FROM cpu`, "db0", 0))
+	if len(results) != 1 || results[0].Err != nil || len(results[0].Series) != 1 {
+		t.Fatalf("unexpected results: %s", spew.Sdump(results))
+	} else if exp := []*influxql.Message{influxql.UnreadableShardsWarning([]uint64{101})}; !reflect.DeepEqual(results[0].Messages, exp) {
+		t.Fatalf("unexpected messages: %s", spew.Sdump(results[0].Messages))
+	}
+}
+
+// Ensure results that skipped unreadable shards are not materialized as
+// read rollups.
+func TestQueryExecutor_ExecuteQuery_UnreadableShards_ReadRollup(t *testing.T) {
+	e := DefaultQueryExecutor()
+	e.StatementExecutor.ShardMapper.(*coordinator.LocalShardMapper).SkipUnreadableShards = true
+	e.StatementExecutor.ReadRollups = coordinator.NewReadRollups(10, 1000, 0)
+
+	var writeN int
+	e.StatementExecutor.PointsWriter = &fakePointsWriter{
+		WritePointsIntoFn: func(req *coordinator.IntoWriteRequest) error {
+			writeN++
+			return nil
+		},
+	}
+
+	e.MetaClient.ShardGroupsByTimeRangeFn = func(database, policy string, min, max time.Time) (a []meta.ShardGroupInfo, err error) {
+		return []meta.ShardGroupInfo{
+			{ID: 1, Shards: []meta.ShardInfo{
+				{ID: 100, Owners: []meta.ShardOwner{{NodeID: 0}}},
+				{ID: 101, Owners: []meta.ShardOwner{{NodeID: 0}}},
+			}},
+		}, nil
+	}
+
+	var unreadable []uint64
+	e.TSDBStore.UnreadableShardsFn = func(ids []uint64) []uint64 {
+		return unreadable
+	}
+	e.TSDBStore.ShardGroupFn = func(ids []uint64) tsdb.ShardGroup {
+		var sh MockShard
+		sh.CreateIteratorFn = func(m string, opt influxql.IteratorOptions) (influxql.Iterator, error) {
+			return &FloatIterator{
+				Points: []influxql.FloatPoint{{Name: "cpu", Time: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC).UnixNano(), Value: 100}},
+			}, nil
+		}
+		sh.FieldDimensionsFn = func(measurements []string) (fields map[string]influxql.DataType, dimensions map[string]struct{}, err error) {
+			return map[string]influxql.DataType{"value": influxql.Float}, nil, nil
+		}
+		return &sh
+	}
+
+	q := `SELECT mean(value) FROM cpu WHERE time >= '2000-01-01T00:00:00Z' AND time < '2000-01-02T00:00:00Z' GROUP BY time(1h)`
+
+	// Shard 101 failed to open.
+	unreadable = []uint64{101}
+	results := ReadAllResults(e.ExecuteQuery(q, "db0", 0))
+	if len(results) != 1 || results[0].Err != nil || len(results[0].Messages) != 1 {
+		t.Fatalf("unexpected results: %s", spew.Sdump(results))
+	} else if writeN != 0 {
+		t.Fatalf("unexpected rollup writes: %d", writeN)
+	}
+
+	// The complete result is materialized.
+	unreadable = nil
+	results = ReadAllResults(e.ExecuteQuery(q, "db0", 0))
+	if len(results) != 1 || results[0].Err != nil {
+		t.Fatalf("unexpected results: %s", spew.Sdump(results))
+	} else if writeN != 1 {
+		t.Fatalf("unexpected rollup writes: %d", writeN)
+	}
+}
+
+func TestQueryExecutor_ExecuteQuery_Join(t *testing.T) {
+	e := DefaultQueryExecutor()
+
+	e.MetaClient.ShardGroupsByTimeRangeFn = func(database, policy string, min, max time.Time) (a []meta.ShardGroupInfo, err error) {
+		return []meta.ShardGroupInfo{
+			{ID: 1, Shards: []meta.ShardInfo{
+				{ID: 100, Owners: []meta.ShardOwner{{NodeID: 0}}},
+			}},
+		}, nil
+	}
+
+	e.TSDBStore.ShardGroupFn = func(ids []uint64) tsdb.ShardGroup {
+		var sh MockShard
+		sh.CreateIteratorFn = func(m string, opt influxql.IteratorOptions) (influxql.Iterator, error) {
+			switch m {
+			case "cpu":
+				return &FloatIterator{Points: []influxql.FloatPoint{
+					{Name: "cpu", Tags: influxql.NewTags(map[string]string{"host": "A"}), Time: int64(0 * time.Second), Aux: []interface{}{float64(100)}},
+					{Name: "cpu", Tags: influxql.NewTags(map[string]string{"host": "A"}), Time: int64(1 * time.Second), Aux: []interface{}{float64(101)}},
+					{Name: "cpu", Tags: influxql.NewTags(map[string]string{"host": "B"}), Time: int64(0 * time.Second), Aux: []interface{}{float64(200)}},
+				}}, nil
+			case "mem":
+				return &FloatIterator{Points: []influxql.FloatPoint{
+					{Name: "mem", Tags: influxql.NewTags(map[string]string{"host": "A"}), Time: int64(0 * time.Second), Aux: []interface{}{float64(10)}},
+					{Name: "mem", Tags: influxql.NewTags(map[string]string{"host": "C"}), Time: int64(0 * time.Second), Aux: []interface{}{float64(30)}},
+				}}, nil
+			}
+			t.Fatalf("unexpected measurement: %s", m)
+			return nil, nil
+		}
+		sh.FieldDimensionsFn = func(measurements []string) (fields map[string]influxql.DataType, dimensions map[string]struct{}, err error) {
+			return map[string]influxql.DataType{"value": influxql.Float}, map[string]struct{}{"host": struct{}{}}, nil
+		}
+		return &sh
+	}
+
+	// Points are joined by host and time. Missing values are null.
+	columns := []string{"time", "cpu.value", "mem.value"}
+	if a := ReadAllResults(e.ExecuteQuery(`SELECT cpu.value, mem.value FROM cpu, mem WHERE cpu.host = mem.host`, "db0", 0)); !reflect.DeepEqual(a, []*influxql.Result{
+		{
+			StatementID: 0,
+			Series: []*models.Row{
+				{Name: "cpu,mem", Tags: map[string]string{"host": "A"}, Columns: columns, Values: [][]interface{}{
+					{time.Unix(0, 0).UTC(), float64(100), float64(10)},
+					{time.Unix(1, 0).UTC(), float64(101), nil},
+				}},
+				{Name: "cpu,mem", Tags: map[string]string{"host": "B"}, Columns: columns, Values: [][]interface{}{
+					{time.Unix(0, 0).UTC(), float64(200), nil},
+				}},
+				{Name: "cpu,mem", Tags: map[string]string{"host": "C"}, Columns: columns, Values: [][]interface{}{
+					{time.Unix(0, 0).UTC(), nil, float64(30)},
+				}},
+			},
+		},
+	}) {
+		t.Fatalf("unexpected results: %s", spew.Sdump(a))
+	}
+
+	// Fields must be qualified by the measurement they select from.
+	exp := errors.New("field value must be qualified by cpu or mem in a join")
+	if a := ReadAllResults(e.ExecuteQuery(`SELECT value, mem.value FROM cpu, mem WHERE cpu.host = mem.host`, "db0", 0)); !reflect.DeepEqual(a, []*influxql.Result{{StatementID: 0, Err: exp}}) {
+		t.Fatalf("unexpected results: %s", spew.Sdump(a))
+	}
+}
+
+// Ensure a statement with a COMPARE clause aligns the buckets of the earlier
+// time range with the current one.
+func TestQueryExecutor_ExecuteQuery_Compare(t *testing.T) {
+	e := DefaultQueryExecutor()
+
+	e.MetaClient.ShardGroupsByTimeRangeFn = func(database, policy string, min, max time.Time) (a []meta.ShardGroupInfo, err error) {
+		return []meta.ShardGroupInfo{
+			{ID: 1, Shards: []meta.ShardInfo{
+				{ID: 100, Owners: []meta.ShardOwner{{NodeID: 0}}},
+			}},
+		}, nil
+	}
+
+	week := time.Date(2000, 1, 8, 0, 0, 0, 0, time.UTC)
+	e.TSDBStore.ShardGroupFn = func(ids []uint64) tsdb.ShardGroup {
+		var sh MockShard
+		sh.CreateIteratorFn = func(m string, opt influxql.IteratorOptions) (influxql.Iterator, error) {
+			if opt.StartTime < week.UnixNano() {
+				prev := week.Add(-7 * 24 * time.Hour)
+				return &FloatIterator{Points: []influxql.FloatPoint{
+					{Name: "cpu", Time: prev.UnixNano(), Value: 10},
+					{Name: "cpu", Time: prev.Add(time.Hour).UnixNano(), Value: 20},
+				}}, nil
+			}
+			return &FloatIterator{Points: []influxql.FloatPoint{
+				{Name: "cpu", Time: week.UnixNano(), Value: 15},
+			}}, nil
+		}
+		sh.FieldDimensionsFn = func(measurements []string) (fields map[string]influxql.DataType, dimensions map[string]struct{}, err error) {
+			return map[string]influxql.DataType{"value": influxql.Float}, nil, nil
+		}
+		return &sh
+	}
+
+	// Buckets missing from either time range are null.
+	if a := ReadAllResults(e.ExecuteQuery(`SELECT mean(value) FROM cpu WHERE time >= '2000-01-08T00:00:00Z' AND time < '2000-01-08T02:00:00Z' GROUP BY time(1h) COMPARE PREVIOUS 7d DIFFERENCE`, "db0", 0)); !reflect.DeepEqual(a, []*influxql.Result{
+		{
+			StatementID: 0,
+			Series: []*models.Row{{
+				Name:    "cpu",
+				Columns: []string{"time", "mean", "mean_previous", "mean_difference"},
+				Values: [][]interface{}{
+					{week, float64(15), float64(10), float64(5)},
+					{week.Add(time.Hour), nil, float64(20), nil},
+				},
+			}},
+		},
+	}) {
+		t.Fatalf("unexpected results: %s", spew.Sdump(a))
+	}
+
+	// The time range must have a lower bound to be shifted.
+	exp := errors.New("COMPARE requires a lower bound on time")
+	if a := ReadAllResults(e.ExecuteQuery(`SELECT mean(value) FROM cpu WHERE time < '2000-01-08T02:00:00Z' GROUP BY time(1h) COMPARE PREVIOUS 7d`, "db0", 0)); !reflect.DeepEqual(a, []*influxql.Result{{StatementID: 0, Err: exp}}) {
+		t.Fatalf("unexpected results: %s", spew.Sdump(a))
+	}
+}
+
+// Ensure fields stored with different types in different shards are read
+// according to the field type policy.
+func TestQueryExecutor_ExecuteQuery_FieldTypes(t *testing.T) {
+	for _, tt := range []struct {
+		policy  string
+		aux     []influxql.DataType
+		columns []string
+	}{
+		{policy: "", aux: []influxql.DataType{influxql.Float}, columns: []string{"time", "value"}},
+		{policy: influxql.FieldTypePrecedence, aux: []influxql.DataType{influxql.Float}, columns: []string{"time", "value"}},
+		{policy: influxql.FieldTypeNewest, aux: []influxql.DataType{influxql.String}, columns: []string{"time", "value"}},
+		{policy: influxql.FieldTypeFloat, aux: []influxql.DataType{influxql.Float}, columns: []string{"time", "value"}},
+		{policy: influxql.FieldTypeTyped, aux: []influxql.DataType{influxql.Float, influxql.String}, columns: []string{"time", "value_float", "value_string"}},
+	} {
+		e := DefaultQueryExecutor()
+		e.MetaClient.ShardGroupsByTimeRangeFn = func(database, policy string, min, max time.Time) (a []meta.ShardGroupInfo, err error) {
+			return []meta.ShardGroupInfo{
+				{ID: 1, Shards: []meta.ShardInfo{{ID: 100, Owners: []meta.ShardOwner{{NodeID: 0}}}}},
+				{ID: 2, Shards: []meta.ShardInfo{{ID: 200, Owners: []meta.ShardOwner{{NodeID: 0}}}}},
+			}, nil
+		}
+
+		e.TSDBStore.ShardGroupFn = func(ids []uint64) tsdb.ShardGroup {
+			var sh MockShard
+			sh.CreateIteratorFn = func(m string, opt influxql.IteratorOptions) (influxql.Iterator, error) {
+				if opt.FieldTypePolicy != tt.policy {
+					t.Fatalf("unexpected field type policy: %q", opt.FieldTypePolicy)
+				}
+				aux := make([]interface{}, len(opt.Aux))
+				for i, ref := range opt.Aux {
+					if ref.Type != tt.aux[i] {
+						t.Fatalf("%q: unexpected type for aux %d: %s", tt.policy, i, ref.Type)
+					}
+				}
+				return &FloatIterator{Points: []influxql.FloatPoint{
+					{Name: "cpu", Time: int64(0 * time.Second), Aux: aux},
+				}}, nil
+			}
+			sh.FieldDimensionsFn = func(measurements []string) (fields map[string]influxql.DataType, dimensions map[string]struct{}, err error) {
+				return map[string]influxql.DataType{"value": influxql.Float}, nil, nil
+			}
+			// The older shard stored floats and the newer one strings.
+			sh.FieldTypesFn = func(measurement, field string) []influxql.DataType {
+				return []influxql.DataType{influxql.Float, influxql.String}
+			}
+			return &sh
+		}
+
+		opt := influxql.ExecutionOptions{Database: "db0", FieldTypePolicy: tt.policy}
+		results := ReadAllResults(e.QueryExecutor.ExecuteQuery(MustParseQuery(`SELECT value FROM cpu`), opt, make(chan struct{})))
+		if len(results) != 1 || results[0].Err != nil || len(results[0].Series) != 1 {
+			t.Fatalf("%q: unexpected results: %s", tt.policy, spew.Sdump(results))
+		} else if columns := results[0].Series[0].Columns; !reflect.DeepEqual(columns, tt.columns) {
+			t.Fatalf("%q: unexpected columns: %v", tt.policy, columns)
+		}
+	}
+}
+
+func TestQueryExecutor_ExecuteQuery_MaxGroups(t *testing.T) {
+	e := DefaultQueryExecutor()
+
+	// The meta client should return a single shards on the local node.
+	e.MetaClient.ShardGroupsByTimeRangeFn = func(database, policy string, min, max time.Time) (a []meta.ShardGroupInfo, err error) {
+		return []meta.ShardGroupInfo{
+			{ID: 1, Shards: []meta.ShardInfo{
+				{ID: 100, Owners: []meta.ShardOwner{{NodeID: 0}}},
+			}},
+		}, nil
+	}
+
+	e.TSDBStore.ShardGroupFn = func(ids []uint64) tsdb.ShardGroup {
+		var sh MockShard
+		sh.CreateIteratorFn = func(m string, opt influxql.IteratorOptions) (influxql.Iterator, error) {
+			return &FloatIterator{Points: []influxql.FloatPoint{
+				{Name: "cpu", Tags: influxql.NewTags(map[string]string{"host": "A"}), Time: int64(0 * time.Second), Aux: []interface{}{float64(100)}},
+				{Name: "cpu", Tags: influxql.NewTags(map[string]string{"host": "A"}), Time: int64(1 * time.Second), Aux: []interface{}{float64(101)}},
+				{Name: "cpu", Tags: influxql.NewTags(map[string]string{"host": "B"}), Time: int64(0 * time.Second), Aux: []interface{}{float64(200)}},
+				{Name: "cpu", Tags: influxql.NewTags(map[string]string{"host": "C"}), Time: int64(0 * time.Second), Aux: []interface{}{float64(300)}},
+			}}, nil
+		}
+		sh.FieldDimensionsFn = func(measurements []string) (fields map[string]influxql.DataType, dimensions map[string]struct{}, err error) {
+			return map[string]influxql.DataType{"value": influxql.Float}, map[string]struct{}{"host": struct{}{}}, nil
+		}
+		return &sh
+	}
+
+	opt := influxql.ExecutionOptions{Database: "db0", MaxGroups: 2}
+	results := ReadAllResults(e.QueryExecutor.ExecuteQuery(MustParseQuery(`SELECT value FROM cpu GROUP BY host`), opt, make(chan struct{})))
+	if len(results) != 3 {
+		t.Fatalf("unexpected results: %s", spew.Sdump(results))
+	}
+	for i, host := range []string{"A", "B"} {
+		if got := results[i].Series[0].Tags["host"]; got != host {
+			t.Fatalf("unexpected series %d: %s", i, spew.Sdump(results[i].Series))
+		}
+	}
+	if exp := []*influxql.Message{influxql.MaxGroupsWarning(2)}; len(results[2].Series) != 0 || !reflect.DeepEqual(results[2].Messages, exp) {
+		t.Fatalf("unexpected truncation result: %s", spew.Sdump(results[2]))
+	}
+
+	// Results within the limit have no warning.
+	opt.MaxGroups = 3
+	results = ReadAllResults(e.QueryExecutor.ExecuteQuery(MustParseQuery(`SELECT value FROM cpu GROUP BY host`), opt, make(chan struct{})))
+	if len(results) != 3 {
+		t.Fatalf("unexpected results: %s", spew.Sdump(results))
+	}
+	for _, r := range results {
+		if len(r.Messages) != 0 {
+			t.Fatalf("unexpected messages: %s", spew.Sdump(r.Messages))
+		}
+	}
+}
+
+// Ensure a SELECT with an empty time range fails when asked to.
+func TestQueryExecutor_ExecuteQuery_EmptyTimeRange(t *testing.T) {
+	e := DefaultQueryExecutor()
+
+	e.MetaClient.ShardGroupsByTimeRangeFn = func(database, policy string, min, max time.Time) (a []meta.ShardGroupInfo, err error) {
+		return []meta.ShardGroupInfo{
+			{ID: 1, Shards: []meta.ShardInfo{
+				{ID: 100, Owners: []meta.ShardOwner{{NodeID: 0}}},
+			}},
+		}, nil
+	}
+
+	e.TSDBStore.ShardGroupFn = func(ids []uint64) tsdb.ShardGroup {
+		var sh MockShard
+		sh.CreateIteratorFn = func(m string, opt influxql.IteratorOptions) (influxql.Iterator, error) {
+			return &FloatIterator{}, nil
+		}
+		sh.FieldDimensionsFn = func(measurements []string) (fields map[string]influxql.DataType, dimensions map[string]struct{}, err error) {
+			return map[string]influxql.DataType{"value": influxql.Float}, nil, nil
+		}
+		return &sh
+	}
+
+	for _, tt := range []struct {
+		q   string
+		err bool
+	}{
+		// Inverted.
+		{q: `SELECT value FROM cpu WHERE time >= now() AND time < now() - 1h`, err: true},
+		// Zero width.
+		{q: `SELECT value FROM cpu WHERE time >= '2000-01-01T00:00:00Z' AND time < '2000-01-01T00:00:00Z'`, err: true},
+		{q: `SELECT value FROM cpu WHERE time > '2000-01-01T00:00:00Z' AND time < '2000-01-01T00:00:00Z'`, err: true},
+		// A single instant and open ranges are not empty.
+		{q: `SELECT value FROM cpu WHERE time >= '2000-01-01T00:00:00Z' AND time <= '2000-01-01T00:00:00Z'`},
+		{q: `SELECT value FROM cpu WHERE time >= now() - 1h`},
+		{q: `SELECT value FROM cpu`},
+	} {
+		// Empty ranges return no results by default.
+		opt := influxql.ExecutionOptions{Database: "db0"}
+		results := ReadAllResults(e.QueryExecutor.ExecuteQuery(MustParseQuery(tt.q), opt, make(chan struct{})))
+		if len(results) != 1 || results[0].Err != nil {
+			t.Fatalf("%s: unexpected results: %s", tt.q, spew.Sdump(results))
+		}
+
+		opt.EmptyTimeRange = influxql.EmptyTimeRangeError
+		results = ReadAllResults(e.QueryExecutor.ExecuteQuery(MustParseQuery(tt.q), opt, make(chan struct{})))
+		if len(results) != 1 {
+			t.Fatalf("%s: unexpected results: %s", tt.q, spew.Sdump(results))
+		} else if err := results[0].Err; tt.err && (err == nil || !strings.HasPrefix(err.Error(), "empty time range: ")) {
+			t.Fatalf("%s: unexpected error: %v", tt.q, err)
+		} else if !tt.err && err != nil {
+			t.Fatalf("%s: unexpected error: %s", tt.q, err)
+		}
+	}
+}
+
+// Ensure raw queries without a LIMIT are limited by the default LIMIT.
+func TestQueryExecutor_ExecuteQuery_DefaultSelectLimit(t *testing.T) {
+	e := DefaultQueryExecutor()
+	e.StatementExecutor.DefaultSelectLimit = 2
+
+	e.MetaClient.ShardGroupsByTimeRangeFn = func(database, policy string, min, max time.Time) (a []meta.ShardGroupInfo, err error) {
+		return []meta.ShardGroupInfo{
+			{ID: 1, Shards: []meta.ShardInfo{
+				{ID: 100, Owners: []meta.ShardOwner{{NodeID: 0}}},
+			}},
+		}, nil
+	}
+
+	e.TSDBStore.ShardGroupFn = func(ids []uint64) tsdb.ShardGroup {
+		var sh MockShard
+		sh.CreateIteratorFn = func(m string, opt influxql.IteratorOptions) (influxql.Iterator, error) {
+			return &FloatIterator{Points: []influxql.FloatPoint{
+				{Name: "cpu", Time: int64(0 * time.Second), Aux: []interface{}{float64(100)}},
+				{Name: "cpu", Time: int64(1 * time.Second), Aux: []interface{}{float64(101)}},
+				{Name: "cpu", Time: int64(2 * time.Second), Aux: []interface{}{float64(102)}},
+			}}, nil
+		}
+		sh.FieldDimensionsFn = func(measurements []string) (fields map[string]influxql.DataType, dimensions map[string]struct{}, err error) {
+			return map[string]influxql.DataType{"value": influxql.Float}, nil, nil
+		}
+		return &sh
+	}
+
+	opt := influxql.ExecutionOptions{Database: "db0"}
+	results := ReadAllResults(e.QueryExecutor.ExecuteQuery(MustParseQuery(`SELECT value FROM cpu`), opt, make(chan struct{})))
+	if len(results) != 2 || len(results[0].Series) != 1 || len(results[0].Series[0].Values) != 2 {
+		t.Fatalf("unexpected results: %s", spew.Sdump(results))
+	}
+	if exp := []*influxql.Message{influxql.DefaultLimitWarning(2)}; !reflect.DeepEqual(results[1].Messages, exp) {
+		t.Fatalf("unexpected messages: %s", spew.Sdump(results[1]))
+	}
+
+	// An explicit LIMIT and the opt out return the requested points without
+	// a warning.
+	for _, tt := range []struct {
+		q      string
+		noLim  bool
+		points int
+	}{
+		{q: `SELECT value FROM cpu LIMIT 3`, points: 3},
+		{q: `SELECT value FROM cpu`, noLim: true, points: 3},
+	} {
+		opt.NoDefaultLimit = tt.noLim
+		results := ReadAllResults(e.QueryExecutor.ExecuteQuery(MustParseQuery(tt.q), opt, make(chan struct{})))
+		if len(results) != 1 || len(results[0].Series) != 1 || len(results[0].Series[0].Values) != tt.points {
+			t.Fatalf("%s: unexpected results: %s", tt.q, spew.Sdump(results))
+		} else if len(results[0].Messages) != 0 {
+			t.Fatalf("%s: unexpected messages: %s", tt.q, spew.Sdump(results[0].Messages))
+		}
+	}
+}
+
+// Ensure the row limits of each series and of the whole result are applied
+// after LIMIT, OFFSET, SLIMIT and SOFFSET.
+func TestQueryExecutor_ExecuteQuery_MaxSelectRows(t *testing.T) {
+	e := DefaultQueryExecutor()
 
-	// The meta client should return a single shards on the local node.
 	e.MetaClient.ShardGroupsByTimeRangeFn = func(database, policy string, min, max time.Time) (a []meta.ShardGroupInfo, err error) {
 		return []meta.ShardGroupInfo{
 			{ID: 1, Shards: []meta.ShardInfo{
@@ -97,36 +1109,493 @@ func TestQueryExecutor_ExecuteQuery_MaxSelectBucketsN(t *testing.T) {
 	}
 
 	e.TSDBStore.ShardGroupFn = func(ids []uint64) tsdb.ShardGroup {
-		if !reflect.DeepEqual(ids, []uint64{100}) {
-			t.Fatalf("unexpected shard ids: %v", ids)
+		var sh MockShard
+		sh.CreateIteratorFn = func(m string, opt influxql.IteratorOptions) (influxql.Iterator, error) {
+			// Apply SLIMIT and SOFFSET to the series like the engine does.
+			hosts := []string{"A", "B", "C"}
+			if opt.SOffset < len(hosts) {
+				hosts = hosts[opt.SOffset:]
+			} else {
+				hosts = nil
+			}
+			if opt.SLimit > 0 && opt.SLimit < len(hosts) {
+				hosts = hosts[:opt.SLimit]
+			}
+
+			var points []influxql.FloatPoint
+			for _, host := range hosts {
+				for i := 0; i < 3; i++ {
+					points = append(points, influxql.FloatPoint{Name: "cpu", Tags: influxql.NewTags(map[string]string{"host": host}), Time: int64(time.Duration(i) * time.Second), Aux: []interface{}{float64(i)}})
+				}
+			}
+			return &FloatIterator{Points: points}, nil
+		}
+		sh.FieldDimensionsFn = func(measurements []string) (fields map[string]influxql.DataType, dimensions map[string]struct{}, err error) {
+			return map[string]influxql.DataType{"value": influxql.Float}, map[string]struct{}{"host": struct{}{}}, nil
+		}
+		return &sh
+	}
+
+	for _, tt := range []struct {
+		q          string
+		seriesRows int
+		rows       int
+		exp        map[string]int
+		warnings   []*influxql.Message
+	}{
+		{q: `SELECT value FROM cpu GROUP BY host`, seriesRows: 2, exp: map[string]int{"A": 2, "B": 2, "C": 2}, warnings: []*influxql.Message{influxql.MaxSeriesRowsWarning(2)}},
+		{q: `SELECT value FROM cpu GROUP BY host LIMIT 2`, seriesRows: 2, exp: map[string]int{"A": 2, "B": 2, "C": 2}},
+		{q: `SELECT value FROM cpu GROUP BY host LIMIT 3 OFFSET 1`, seriesRows: 2, exp: map[string]int{"A": 2, "B": 2, "C": 2}},
+		{q: `SELECT value FROM cpu GROUP BY host`, rows: 4, exp: map[string]int{"A": 3, "B": 1}, warnings: []*influxql.Message{influxql.MaxRowsWarning(4)}},
+		{q: `SELECT value FROM cpu GROUP BY host SLIMIT 1 SOFFSET 1`, rows: 4, exp: map[string]int{"B": 3}},
+		{q: `SELECT value FROM cpu GROUP BY host`, seriesRows: 1, rows: 4, exp: map[string]int{"A": 1, "B": 1, "C": 1}, warnings: []*influxql.Message{influxql.MaxSeriesRowsWarning(1)}},
+		{q: `SELECT value FROM cpu GROUP BY host LIMIT 1 SLIMIT 2`, rows: 4, exp: map[string]int{"A": 1, "B": 1}},
+		{q: `SELECT value FROM cpu GROUP BY host OFFSET 1 SOFFSET 1`, seriesRows: 2, rows: 3, exp: map[string]int{"B": 2, "C": 1}, warnings: []*influxql.Message{influxql.MaxRowsWarning(3)}},
+	} {
+		e.StatementExecutor.MaxSelectSeriesRows = tt.seriesRows
+		e.StatementExecutor.MaxSelectRows = tt.rows
+
+		results := ReadAllResults(e.QueryExecutor.ExecuteQuery(MustParseQuery(tt.q), influxql.ExecutionOptions{Database: "db0"}, make(chan struct{})))
+		got := make(map[string]int)
+		var warnings []*influxql.Message
+		for _, r := range results {
+			if r.Err != nil {
+				t.Fatalf("%s: unexpected error: %s", tt.q, r.Err)
+			}
+			for _, row := range r.Series {
+				got[row.Tags["host"]] += len(row.Values)
+			}
+			warnings = append(warnings, r.Messages...)
+		}
+		if !reflect.DeepEqual(got, tt.exp) {
+			t.Errorf("%s: unexpected rows: %v", tt.q, got)
+		} else if !reflect.DeepEqual(warnings, tt.warnings) {
+			t.Errorf("%s: unexpected messages: %s", tt.q, spew.Sdump(warnings))
 		}
+	}
+}
+
+// Ensure a SELECT is sampled to the series ranked highest by points or recency.
+func TestQueryExecutor_ExecuteQuery_SampleSeries(t *testing.T) {
+	e := DefaultQueryExecutor()
+
+	e.MetaClient.ShardGroupsByTimeRangeFn = func(database, policy string, min, max time.Time) (a []meta.ShardGroupInfo, err error) {
+		return []meta.ShardGroupInfo{
+			{ID: 1, Shards: []meta.ShardInfo{
+				{ID: 100, Owners: []meta.ShardOwner{{NodeID: 0}}},
+			}},
+		}, nil
+	}
 
+	// Host B has the most points and host C the most recent one.
+	times := map[string][]time.Duration{
+		"A": {0, time.Second, 2 * time.Second},
+		"B": {0, time.Second, 2 * time.Second, 3 * time.Second, 4 * time.Second},
+		"C": {10 * time.Second},
+	}
+	hosts := []string{"A", "B", "C"}
+
+	e.TSDBStore.ShardGroupFn = func(ids []uint64) tsdb.ShardGroup {
 		var sh MockShard
 		sh.CreateIteratorFn = func(m string, opt influxql.IteratorOptions) (influxql.Iterator, error) {
-			return &FloatIterator{
-				Points: []influxql.FloatPoint{{Name: "cpu", Time: int64(0 * time.Second), Aux: []interface{}{float64(100)}}},
-			}, nil
+			if call, ok := opt.Expr.(*influxql.Call); ok {
+				if !reflect.DeepEqual(opt.Dimensions, []string{"host"}) {
+					t.Fatalf("unexpected dimensions: %v", opt.Dimensions)
+				}
+				switch call.Name {
+				case "count":
+					itr := &IntegerIterator{}
+					for _, host := range hosts {
+						itr.Points = append(itr.Points, influxql.IntegerPoint{Name: "cpu", Tags: influxql.NewTags(map[string]string{"host": host}), Value: int64(len(times[host]))})
+					}
+					return itr, nil
+				case "last":
+					itr := &FloatIterator{}
+					for _, host := range hosts {
+						ts := times[host]
+						itr.Points = append(itr.Points, influxql.FloatPoint{Name: "cpu", Tags: influxql.NewTags(map[string]string{"host": host}), Time: int64(ts[len(ts)-1]), Value: 1})
+					}
+					return itr, nil
+				}
+				t.Fatalf("unexpected call: %s", call)
+			}
+
+			// Read the hosts the condition matches.
+			var points []influxql.FloatPoint
+			for _, host := range hosts {
+				if opt.Condition != nil && strings.Contains(opt.Condition.String(), "host") && !strings.Contains(opt.Condition.String(), fmt.Sprintf("host = '%s'", host)) {
+					continue
+				}
+				for _, ts := range times[host] {
+					points = append(points, influxql.FloatPoint{Name: "cpu", Tags: influxql.NewTags(map[string]string{"host": host}), Time: int64(ts), Aux: []interface{}{float64(1)}})
+				}
+			}
+			return &FloatIterator{Points: points}, nil
 		}
 		sh.FieldDimensionsFn = func(measurements []string) (fields map[string]influxql.DataType, dimensions map[string]struct{}, err error) {
-			if !reflect.DeepEqual(measurements, []string{"cpu"}) {
-				t.Fatalf("unexpected source: %#v", measurements)
+			return map[string]influxql.DataType{"value": influxql.Float}, map[string]struct{}{"host": struct{}{}}, nil
+		}
+		sh.SeriesNFn = func(measurement string, condition influxql.Expr) (int, error) {
+			return len(hosts), nil
+		}
+		return &sh
+	}
+
+	for _, tt := range []struct {
+		n        int
+		by       string
+		opt      influxql.ExecutionOptions
+		exp      map[string]int
+		warnings []*influxql.Message
+	}{
+		{n: 2, by: influxql.SampleSeriesPoints, exp: map[string]int{"A": 3, "B": 5}, warnings: []*influxql.Message{influxql.SampledSeriesWarning(2, 3, influxql.SampleSeriesPoints)}},
+		{n: 2, by: influxql.SampleSeriesRecent, exp: map[string]int{"B": 5, "C": 1}, warnings: []*influxql.Message{influxql.SampledSeriesWarning(2, 3, influxql.SampleSeriesRecent)}},
+		{n: 3, by: influxql.SampleSeriesPoints, exp: map[string]int{"A": 3, "B": 5, "C": 1}},
+		{opt: influxql.ExecutionOptions{SampleSeries: 1}, exp: map[string]int{"B": 5}, warnings: []*influxql.Message{influxql.SampledSeriesWarning(1, 3, influxql.SampleSeriesPoints)}},
+		{n: 3, opt: influxql.ExecutionOptions{SampleSeries: 1, SampleSeriesBy: influxql.SampleSeriesRecent}, exp: map[string]int{"C": 1}, warnings: []*influxql.Message{influxql.SampledSeriesWarning(1, 3, influxql.SampleSeriesRecent)}},
+	} {
+		e.StatementExecutor.SampleSeries = tt.n
+		e.StatementExecutor.SampleSeriesBy = tt.by
+
+		opt := tt.opt
+		opt.Database = "db0"
+		results := ReadAllResults(e.QueryExecutor.ExecuteQuery(MustParseQuery(`SELECT value FROM cpu GROUP BY host`), opt, make(chan struct{})))
+		got := make(map[string]int)
+		var warnings []*influxql.Message
+		for _, r := range results {
+			if r.Err != nil {
+				t.Fatalf("%d/%s: unexpected error: %s", tt.n, tt.by, r.Err)
 			}
+			for _, row := range r.Series {
+				got[row.Tags["host"]] += len(row.Values)
+			}
+			warnings = append(warnings, r.Messages...)
+		}
+		if !reflect.DeepEqual(got, tt.exp) {
+			t.Errorf("%d/%s: unexpected rows: %v", tt.n, tt.by, got)
+		} else if !reflect.DeepEqual(warnings, tt.warnings) {
+			t.Errorf("%d/%s: unexpected messages: %s", tt.n, tt.by, spew.Sdump(warnings))
+		}
+	}
+}
+
+// NewSchemaChangeQueryExecutor returns a QueryExecutor with the given schema
+// change policy. Reading the cpu measurement closes reading and blocks until
+// release is closed, and dropping it closes dropped.
+func NewSchemaChangeQueryExecutor(policy string, reading, release, dropped chan struct{}) *QueryExecutor {
+	e := DefaultQueryExecutor()
+	e.StatementExecutor.SchemaGuard = coordinator.NewSchemaGuard(policy)
+
+	e.MetaClient.ShardGroupsByTimeRangeFn = func(database, policy string, min, max time.Time) (a []meta.ShardGroupInfo, err error) {
+		return []meta.ShardGroupInfo{
+			{ID: 1, Shards: []meta.ShardInfo{
+				{ID: 100, Owners: []meta.ShardOwner{{NodeID: 0}}},
+			}},
+		}, nil
+	}
+
+	var once sync.Once
+	e.TSDBStore.ShardGroupFn = func(ids []uint64) tsdb.ShardGroup {
+		var sh MockShard
+		sh.CreateIteratorFn = func(m string, opt influxql.IteratorOptions) (influxql.Iterator, error) {
+			return &BlockingFloatIterator{
+				FloatIterator: &FloatIterator{Points: []influxql.FloatPoint{{Name: "cpu", Time: int64(0 * time.Second), Aux: []interface{}{float64(100)}}}},
+				Wait: func() {
+					once.Do(func() {
+						close(reading)
+						<-release
+					})
+				},
+			}, nil
+		}
+		sh.FieldDimensionsFn = func(measurements []string) (fields map[string]influxql.DataType, dimensions map[string]struct{}, err error) {
 			return map[string]influxql.DataType{"value": influxql.Float}, nil, nil
 		}
 		return &sh
 	}
+	e.TSDBStore.DeleteMeasurementFn = func(database, name string) error {
+		close(dropped)
+		return nil
+	}
+	return e
+}
 
-	// Verify all results from the query.
-	if a := ReadAllResults(e.ExecuteQuery(`SELECT count(value) FROM cpu WHERE time >= '2000-01-01T00:00:05Z' AND time < '2000-01-01T00:00:35Z' GROUP BY time(10s)`, "db0", 0)); !reflect.DeepEqual(a, []*influxql.Result{
+// Ensure DROP MEASUREMENT waits for a SELECT reading the database to finish
+// under the snapshot schema change policy.
+func TestQueryExecutor_ExecuteQuery_SchemaChangeSnapshot(t *testing.T) {
+	reading, release, dropped := make(chan struct{}), make(chan struct{}), make(chan struct{})
+	e := NewSchemaChangeQueryExecutor(coordinator.SchemaChangeSnapshot, reading, release, dropped)
+
+	selectResults := make(chan []*influxql.Result)
+	go func() { selectResults <- ReadAllResults(e.ExecuteQuery(`SELECT value FROM cpu`, "db0", 0)) }()
+	<-reading
+
+	dropResults := make(chan []*influxql.Result)
+	go func() { dropResults <- ReadAllResults(e.ExecuteQuery(`DROP MEASUREMENT cpu`, "db0", 0)) }()
+
+	select {
+	case <-dropped:
+		t.Fatal("measurement dropped while it was being read")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+
+	if results := <-selectResults; len(results) != 1 || results[0].Err != nil || len(results[0].Series) != 1 {
+		t.Fatalf("unexpected select results: %s", spew.Sdump(results))
+	}
+	if results := <-dropResults; len(results) != 1 || results[0].Err != nil {
+		t.Fatalf("unexpected drop results: %s", spew.Sdump(results))
+	}
+	select {
+	case <-dropped:
+	default:
+		t.Fatal("measurement not dropped")
+	}
+}
+
+// Ensure a SELECT fails when its measurement is dropped while it runs under
+// the error schema change policy.
+func TestQueryExecutor_ExecuteQuery_SchemaChangeError(t *testing.T) {
+	reading, release, dropped := make(chan struct{}), make(chan struct{}), make(chan struct{})
+	e := NewSchemaChangeQueryExecutor(coordinator.SchemaChangeError, reading, release, dropped)
+
+	selectResults := make(chan []*influxql.Result)
+	go func() { selectResults <- ReadAllResults(e.ExecuteQuery(`SELECT value FROM cpu`, "db0", 0)) }()
+	<-reading
+
+	// The measurement is dropped without waiting for the SELECT.
+	if results := ReadAllResults(e.ExecuteQuery(`DROP MEASUREMENT cpu`, "db0", 0)); len(results) != 1 || results[0].Err != nil {
+		t.Fatalf("unexpected drop results: %s", spew.Sdump(results))
+	}
+	close(release)
+
+	if results := <-selectResults; len(results) != 1 || results[0].Err != coordinator.ErrSchemaChanged {
+		t.Fatalf("unexpected select results: %s", spew.Sdump(results))
+	}
+
+	// A SELECT started after the change is not affected by it.
+	if results := ReadAllResults(e.ExecuteQuery(`SELECT value FROM cpu`, "db0", 0)); len(results) != 1 || results[0].Err != nil {
+		t.Fatalf("unexpected select results: %s", spew.Sdump(results))
+	}
+}
+
+// Ensure chunked results carry checkpoints a query can resume from.
+func TestQueryExecutor_ExecuteQuery_Checkpoints(t *testing.T) {
+	e := DefaultQueryExecutor()
+
+	e.MetaClient.ShardGroupsByTimeRangeFn = func(database, policy string, min, max time.Time) (a []meta.ShardGroupInfo, err error) {
+		return []meta.ShardGroupInfo{
+			{ID: 1, Shards: []meta.ShardInfo{
+				{ID: 100, Owners: []meta.ShardOwner{{NodeID: 0}}},
+			}},
+		}, nil
+	}
+
+	e.TSDBStore.ShardGroupFn = func(ids []uint64) tsdb.ShardGroup {
+		var sh MockShard
+		sh.CreateIteratorFn = func(m string, opt influxql.IteratorOptions) (influxql.Iterator, error) {
+			return &FloatIterator{Points: []influxql.FloatPoint{
+				{Name: "cpu", Time: int64(0 * time.Second), Aux: []interface{}{float64(100)}},
+				{Name: "cpu", Time: int64(1 * time.Second), Aux: []interface{}{float64(101)}},
+				{Name: "cpu", Time: int64(1 * time.Second), Aux: []interface{}{float64(102)}},
+				{Name: "cpu", Time: int64(2 * time.Second), Aux: []interface{}{float64(103)}},
+			}}, nil
+		}
+		sh.FieldDimensionsFn = func(measurements []string) (fields map[string]influxql.DataType, dimensions map[string]struct{}, err error) {
+			return map[string]influxql.DataType{"value": influxql.Float}, nil, nil
+		}
+		return &sh
+	}
+
+	opt := influxql.ExecutionOptions{Database: "db0", ChunkSize: 2, Checkpoints: true}
+	results := ReadAllResults(e.QueryExecutor.ExecuteQuery(MustParseQuery(`SELECT value FROM cpu`), opt, make(chan struct{})))
+	if len(results) != 2 || results[0].Checkpoint == "" {
+		t.Fatalf("unexpected results: %s", spew.Sdump(results))
+	}
+
+	// The first point at 1s was returned, so resuming from the first
+	// result's checkpoint returns the second point at 1s and the rest.
+	cp, err := influxql.ParseCheckpoint(results[0].Checkpoint)
+	if err != nil {
+		t.Fatal(err)
+	} else if exp := (&influxql.Checkpoint{Name: "cpu", Time: int64(time.Second), N: 1}); !reflect.DeepEqual(cp, exp) {
+		t.Fatalf("unexpected checkpoint: %s", spew.Sdump(cp))
+	}
+
+	opt = influxql.ExecutionOptions{Database: "db0", Resume: cp}
+	results = ReadAllResults(e.QueryExecutor.ExecuteQuery(MustParseQuery(`SELECT value FROM cpu`), opt, make(chan struct{})))
+	if len(results) != 1 || len(results[0].Series) != 1 {
+		t.Fatalf("unexpected results: %s", spew.Sdump(results))
+	} else if exp := [][]interface{}{
+		{time.Unix(1, 0).UTC(), float64(102)},
+		{time.Unix(2, 0).UTC(), float64(103)},
+	}; !reflect.DeepEqual(results[0].Series[0].Values, exp) {
+		t.Fatalf("unexpected values: %s", spew.Sdump(results[0].Series[0].Values))
+	}
+}
+
+// Ensure SHOW TAG VALUES is truncated to the server limit with a warning.
+func TestQueryExecutor_ExecuteQuery_ShowTagValues_MaxTagValues(t *testing.T) {
+	e := DefaultQueryExecutor()
+	e.StatementExecutor.MaxTagValues = 2
+
+	values := []tsdb.KeyValue{{Key: "host", Value: "A"}, {Key: "host", Value: "B"}, {Key: "host", Value: "C"}}
+	e.TSDBStore.TagValuesFn = func(database string, cond influxql.Expr, offset, limit int) ([]tsdb.TagValues, error) {
+		a := values[offset:]
+		if limit > 0 && limit < len(a) {
+			a = a[:limit]
+		}
+		return []tsdb.TagValues{{Measurement: "cpu", Values: a}}, nil
+	}
+
+	results := ReadAllResults(e.ExecuteQuery(`SHOW TAG VALUES FROM cpu WITH KEY = "host"`, "db0", 0))
+	if len(results) != 2 {
+		t.Fatalf("unexpected results: %s", spew.Sdump(results))
+	} else if row := results[0].Series[0]; len(row.Values) != 2 || !row.Partial {
+		t.Fatalf("unexpected row: %s", spew.Sdump(row))
+	} else if exp := []*influxql.Message{influxql.MaxTagValuesWarning(2)}; !reflect.DeepEqual(results[1].Messages, exp) {
+		t.Fatalf("unexpected truncation result: %s", spew.Sdump(results[1]))
+	}
+
+	// Values within the server limit have no warning.
+	results = ReadAllResults(e.ExecuteQuery(`SHOW TAG VALUES FROM cpu WITH KEY = "host" LIMIT 2 OFFSET 1`, "db0", 0))
+	if len(results) != 1 {
+		t.Fatalf("unexpected results: %s", spew.Sdump(results))
+	} else if row := results[0].Series[0]; !reflect.DeepEqual(row.Values, [][]interface{}{{"host", "B"}, {"host", "C"}}) || row.Partial {
+		t.Fatalf("unexpected row: %s", spew.Sdump(row))
+	}
+}
+
+// Ensure DEFRAGMENT SHARD reports the fragmentation before and after.
+func TestQueryExecutor_ExecuteQuery_DefragmentShard(t *testing.T) {
+	e := DefaultQueryExecutor()
+	e.TSDBStore.DefragmentShardFn = func(id uint64) (before, after tsdb.Fragmentation, err error) {
+		if id != 12 {
+			t.Fatalf("unexpected shard id: %d", id)
+		}
+		return tsdb.Fragmentation{Files: 4, Keys: 2, Blocks: 8, Fragments: 6},
+			tsdb.Fragmentation{Files: 1, Keys: 2, Blocks: 2, Fragments: 2}, nil
+	}
+
+	if a := ReadAllResults(e.ExecuteQuery(`DEFRAGMENT SHARD 12`, "", 0)); !reflect.DeepEqual(a, []*influxql.Result{
 		{
 			StatementID: 0,
-			Err:         errors.New("max-select-buckets limit exceeded: (4/3)"),
+			Series: []*models.Row{{
+				Columns: []string{"stage", "files", "keys", "blocks", "files_per_key", "blocks_per_key"},
+				Values: [][]interface{}{
+					{"before", int64(4), int64(2), int64(8), float64(3), float64(4)},
+					{"after", int64(1), int64(2), int64(2), float64(1), float64(1)},
+				},
+			}},
 		},
 	}) {
 		t.Fatalf("unexpected results: %s", spew.Sdump(a))
 	}
 }
 
+// Ensure UNDROP SHARD restores the shard in the meta store before the store,
+// and drops it from the meta store again if the store cannot restore it.
+func TestQueryExecutor_ExecuteQuery_UndropShard(t *testing.T) {
+	q := &tsdb.QuarantinedShard{ID: 12, Database: "db0", RetentionPolicy: "rp0", ShardGroupID: 3}
+	for _, tt := range []struct {
+		name       string
+		restoreErr error
+		undropErr  error
+		err        string
+		undropped  bool
+		dropped    bool
+	}{
+		{name: "ok", undropped: true},
+		{name: "meta error", restoreErr: errors.New("shard group not found"), err: "shard group not found"},
+		{name: "store error", undropErr: errors.New("disk full"), err: "disk full", undropped: true, dropped: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var undropped, dropped bool
+			e := DefaultQueryExecutor()
+			e.TSDBStore.QuarantinedShardFn = func(id uint64) (*tsdb.QuarantinedShard, error) {
+				return q, nil
+			}
+			e.MetaClient.RestoreShardFn = func(database, policy string, groupID uint64, start, end time.Time, shardID uint64) error {
+				if undropped {
+					t.Fatal("shard undropped before it was restored in the meta store")
+				} else if database != "db0" || policy != "rp0" || groupID != 3 || shardID != 12 {
+					t.Fatalf("unexpected shard: %s %s %d %d", database, policy, groupID, shardID)
+				}
+				return tt.restoreErr
+			}
+			e.TSDBStore.UndropShardFn = func(id uint64) (*tsdb.QuarantinedShard, error) {
+				undropped = true
+				return q, tt.undropErr
+			}
+			e.MetaClient.DropShardFn = func(id uint64) error {
+				dropped = true
+				return nil
+			}
+
+			res := ReadAllResults(e.ExecuteQuery(`UNDROP SHARD 12`, "", 0))
+			if tt.err == "" && res[0].Err != nil {
+				t.Fatalf("unexpected error: %s", res[0].Err)
+			} else if tt.err != "" && (res[0].Err == nil || res[0].Err.Error() != tt.err) {
+				t.Fatalf("unexpected error: got %v, exp %s", res[0].Err, tt.err)
+			}
+			if undropped != tt.undropped {
+				t.Fatalf("unexpected undropped: %v", undropped)
+			} else if dropped != tt.dropped {
+				t.Fatalf("unexpected dropped: %v", dropped)
+			}
+		})
+	}
+}
+
+// Ensure the cost of a statement is reported after its rows when requested.
+func TestQueryExecutor_ExecuteQuery_Stats(t *testing.T) {
+	e := DefaultQueryExecutor()
+
+	// The meta client should return a single shards on the local node.
+	e.MetaClient.ShardGroupsByTimeRangeFn = func(database, policy string, min, max time.Time) (a []meta.ShardGroupInfo, err error) {
+		return []meta.ShardGroupInfo{
+			{ID: 1, Shards: []meta.ShardInfo{
+				{ID: 100, Owners: []meta.ShardOwner{{NodeID: 0}}},
+			}},
+		}, nil
+	}
+
+	e.TSDBStore.ShardGroupFn = func(ids []uint64) tsdb.ShardGroup {
+		var sh MockShard
+		sh.CreateIteratorFn = func(m string, opt influxql.IteratorOptions) (influxql.Iterator, error) {
+			return &FloatIterator{
+				Points: []influxql.FloatPoint{
+					{Name: "cpu", Time: int64(0 * time.Second), Aux: []interface{}{float64(100)}},
+					{Name: "cpu", Time: int64(1 * time.Second), Aux: []interface{}{float64(101)}},
+				},
+				stats: influxql.IteratorStats{SeriesN: 1, PointN: 2},
+			}, nil
+		}
+		sh.FieldDimensionsFn = func(measurements []string) (fields map[string]influxql.DataType, dimensions map[string]struct{}, err error) {
+			return map[string]influxql.DataType{"value": influxql.Float}, nil, nil
+		}
+		return &sh
+	}
+
+	opt := influxql.ExecutionOptions{Database: "db0", Stats: true}
+	results := ReadAllResults(e.QueryExecutor.ExecuteQuery(MustParseQuery(`SELECT value FROM cpu`), opt, make(chan struct{})))
+	if len(results) != 2 || len(results[0].Series) != 1 {
+		t.Fatalf("unexpected results: %s", spew.Sdump(results))
+	}
+	if m := results[1].Messages; len(results[1].Series) != 0 || len(m) != 1 {
+		t.Fatalf("unexpected stats result: %s", spew.Sdump(results[1]))
+	} else if m[0].Level != influxql.InfoLevel || !strings.HasPrefix(m[0].Text, "statement statistics: points scanned=2 series=1 peak memory=") {
+		t.Fatalf("unexpected stats message: %s", spew.Sdump(m[0]))
+	}
+
+	// Statistics are not reported by default.
+	opt.Stats = false
+	results = ReadAllResults(e.QueryExecutor.ExecuteQuery(MustParseQuery(`SELECT value FROM cpu`), opt, make(chan struct{})))
+	if len(results) != 1 || len(results[0].Messages) != 0 {
+		t.Fatalf("unexpected results: %s", spew.Sdump(results))
+	}
+}
+
 func TestStatementExecutor_NormalizeDropSeries(t *testing.T) {
 	q, err := influxql.ParseQuery("DROP SERIES FROM cpu")
 	if err != nil {
@@ -309,9 +1778,16 @@ type TSDBStore struct {
 	DeleteMeasurementFn     func(database, name string) error
 	DeleteRetentionPolicyFn func(database, name string) error
 	DeleteShardFn           func(id uint64) error
+	QuarantineShardFn       func(q tsdb.QuarantinedShard) error
+	QuarantinedShardFn      func(id uint64) (*tsdb.QuarantinedShard, error)
+	UndropShardFn           func(id uint64) (*tsdb.QuarantinedShard, error)
+	DefragmentShardFn       func(id uint64) (before, after tsdb.Fragmentation, err error)
+	MigrateFieldTypeFn      func(database, measurement, field string, typ influxql.DataType) (*tsdb.FieldMigration, error)
 	DeleteSeriesFn          func(database string, sources []influxql.Source, condition influxql.Expr) error
 	DatabaseIndexFn         func(name string) *tsdb.DatabaseIndex
 	ShardGroupFn            func(ids []uint64) tsdb.ShardGroup
+	UnreadableShardsFn      func(ids []uint64) []uint64
+	TagValuesFn             func(database string, cond influxql.Expr, offset, limit int) ([]tsdb.TagValues, error)
 }
 
 func (s *TSDBStore) CreateShard(database, policy string, shardID uint64, enabled bool) error {
@@ -349,6 +1825,26 @@ func (s *TSDBStore) DeleteShard(id uint64) error {
 	return s.DeleteShardFn(id)
 }
 
+func (s *TSDBStore) QuarantineShard(q tsdb.QuarantinedShard) error {
+	return s.QuarantineShardFn(q)
+}
+
+func (s *TSDBStore) QuarantinedShard(id uint64) (*tsdb.QuarantinedShard, error) {
+	return s.QuarantinedShardFn(id)
+}
+
+func (s *TSDBStore) UndropShard(id uint64) (*tsdb.QuarantinedShard, error) {
+	return s.UndropShardFn(id)
+}
+
+func (s *TSDBStore) DefragmentShard(id uint64) (before, after tsdb.Fragmentation, err error) {
+	return s.DefragmentShardFn(id)
+}
+
+func (s *TSDBStore) MigrateFieldType(database, measurement, field string, typ influxql.DataType) (*tsdb.FieldMigration, error) {
+	return s.MigrateFieldTypeFn(database, measurement, field, typ)
+}
+
 func (s *TSDBStore) DeleteSeries(database string, sources []influxql.Source, condition influxql.Expr) error {
 	return s.DeleteSeriesFn(database, sources, condition)
 }
@@ -357,6 +1853,13 @@ func (s *TSDBStore) ShardGroup(ids []uint64) tsdb.ShardGroup {
 	return s.ShardGroupFn(ids)
 }
 
+func (s *TSDBStore) UnreadableShards(ids []uint64) []uint64 {
+	if s.UnreadableShardsFn == nil {
+		return nil
+	}
+	return s.UnreadableShardsFn(ids)
+}
+
 func (s *TSDBStore) DatabaseIndex(name string) *tsdb.DatabaseIndex {
 	return s.DatabaseIndexFn(name)
 }
@@ -365,8 +1868,11 @@ func (s *TSDBStore) Measurements(database string, cond influxql.Expr) ([]string,
 	return nil, nil
 }
 
-func (s *TSDBStore) TagValues(database string, cond influxql.Expr) ([]tsdb.TagValues, error) {
-	return nil, nil
+func (s *TSDBStore) TagValues(database string, cond influxql.Expr, offset, limit int) ([]tsdb.TagValues, error) {
+	if s.TagValuesFn == nil {
+		return nil, nil
+	}
+	return s.TagValuesFn(database, cond, offset, limit)
 }
 
 type MockShard struct {
@@ -374,6 +1880,9 @@ type MockShard struct {
 	FieldDimensionsFn func(measurements []string) (fields map[string]influxql.DataType, dimensions map[string]struct{}, err error)
 	CreateIteratorFn  func(m string, opt influxql.IteratorOptions) (influxql.Iterator, error)
 	ExpandSourcesFn   func(sources influxql.Sources) (influxql.Sources, error)
+	SeriesNFn         func(measurement string, condition influxql.Expr) (int, error)
+	WrittenSinceFn    func(since, min, max time.Time) bool
+	FieldTypesFn      func(measurement, field string) []influxql.DataType
 }
 
 func (sh *MockShard) MeasurementsByRegex(re *regexp.Regexp) []string {
@@ -404,6 +1913,16 @@ func (sh *MockShard) MapType(measurement, field string) influxql.DataType {
 	return influxql.Unknown
 }
 
+func (sh *MockShard) FieldTypes(measurement, field string) []influxql.DataType {
+	if sh.FieldTypesFn != nil {
+		return sh.FieldTypesFn(measurement, field)
+	}
+	if typ := sh.MapType(measurement, field); typ != influxql.Unknown {
+		return []influxql.DataType{typ}
+	}
+	return nil
+}
+
 func (sh *MockShard) CreateIterator(measurement string, opt influxql.IteratorOptions) (influxql.Iterator, error) {
 	return sh.CreateIteratorFn(measurement, opt)
 }
@@ -412,6 +1931,14 @@ func (sh *MockShard) ExpandSources(sources influxql.Sources) (influxql.Sources,
 	return sh.ExpandSourcesFn(sources)
 }
 
+func (sh *MockShard) SeriesN(measurement string, condition influxql.Expr) (int, error) {
+	return sh.SeriesNFn(measurement, condition)
+}
+
+func (sh *MockShard) WrittenSince(since, min, max time.Time) bool {
+	return sh.WrittenSinceFn(since, min, max)
+}
+
 // MustParseQuery parses s into a query. Panic on error.
 func MustParseQuery(s string) *influxql.Query {
 	q, err := influxql.ParseQuery(s)
@@ -449,3 +1976,36 @@ func (itr *FloatIterator) Next() (*influxql.FloatPoint, error) {
 	itr.Points = itr.Points[1:]
 	return v, nil
 }
+
+// BlockingFloatIterator is a FloatIterator that calls Wait before reading
+// each point.
+type BlockingFloatIterator struct {
+	*FloatIterator
+	Wait func()
+}
+
+// Next waits and then returns the next value.
+func (itr *BlockingFloatIterator) Next() (*influxql.FloatPoint, error) {
+	itr.Wait()
+	return itr.FloatIterator.Next()
+}
+
+// IntegerIterator is a represents an iterator that reads from a slice.
+type IntegerIterator struct {
+	Points []influxql.IntegerPoint
+	stats  influxql.IteratorStats
+}
+
+func (itr *IntegerIterator) Stats() influxql.IteratorStats { return itr.stats }
+func (itr *IntegerIterator) Close() error                  { return nil }
+
+// Next returns the next value and shifts it off the beginning of the points slice.
+func (itr *IntegerIterator) Next() (*influxql.IntegerPoint, error) {
+	if len(itr.Points) == 0 {
+		return nil, nil
+	}
+
+	v := &itr.Points[0]
+	itr.Points = itr.Points[1:]
+	return v, nil
+}
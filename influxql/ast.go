@@ -119,13 +119,16 @@ type Node interface {
 func (*Query) node()     {}
 func (Statements) node() {}
 
+func (*AlterDatabaseStatement) node()         {}
 func (*AlterRetentionPolicyStatement) node()  {}
 func (*CreateContinuousQueryStatement) node() {}
 func (*CreateDatabaseStatement) node()        {}
 func (*CreateRetentionPolicyStatement) node() {}
 func (*CreateSubscriptionStatement) node()    {}
 func (*CreateUserStatement) node()            {}
+func (*CreateValidationRuleStatement) node()  {}
 func (*Distinct) node()                       {}
+func (*DefragmentShardStatement) node()       {}
 func (*DeleteSeriesStatement) node()          {}
 func (*DeleteStatement) node()                {}
 func (*DropContinuousQueryStatement) node()   {}
@@ -136,9 +139,11 @@ func (*DropSeriesStatement) node()            {}
 func (*DropShardStatement) node()             {}
 func (*DropSubscriptionStatement) node()      {}
 func (*DropUserStatement) node()              {}
+func (*DropValidationRuleStatement) node()    {}
 func (*GrantStatement) node()                 {}
 func (*GrantAdminStatement) node()            {}
 func (*KillQueryStatement) node()             {}
+func (*MigrateFieldTypeStatement) node()      {}
 func (*RevokeStatement) node()                {}
 func (*RevokeAdminStatement) node()           {}
 func (*SelectStatement) node()                {}
@@ -159,6 +164,8 @@ func (*ShowDiagnosticsStatement) node()       {}
 func (*ShowTagKeysStatement) node()           {}
 func (*ShowTagValuesStatement) node()         {}
 func (*ShowUsersStatement) node()             {}
+func (*ShowValidationRulesStatement) node()   {}
+func (*UndropShardStatement) node()           {}
 
 func (*BinaryExpr) node()      {}
 func (*BooleanLiteral) node()  {}
@@ -240,12 +247,15 @@ type ExecutionPrivilege struct {
 // ExecutionPrivileges is a list of privileges required to execute a statement.
 type ExecutionPrivileges []ExecutionPrivilege
 
+func (*AlterDatabaseStatement) stmt()         {}
 func (*AlterRetentionPolicyStatement) stmt()  {}
 func (*CreateContinuousQueryStatement) stmt() {}
 func (*CreateDatabaseStatement) stmt()        {}
 func (*CreateRetentionPolicyStatement) stmt() {}
 func (*CreateSubscriptionStatement) stmt()    {}
 func (*CreateUserStatement) stmt()            {}
+func (*CreateValidationRuleStatement) stmt()  {}
+func (*DefragmentShardStatement) stmt()       {}
 func (*DeleteSeriesStatement) stmt()          {}
 func (*DeleteStatement) stmt()                {}
 func (*DropContinuousQueryStatement) stmt()   {}
@@ -255,9 +265,11 @@ func (*DropRetentionPolicyStatement) stmt()   {}
 func (*DropSeriesStatement) stmt()            {}
 func (*DropSubscriptionStatement) stmt()      {}
 func (*DropUserStatement) stmt()              {}
+func (*DropValidationRuleStatement) stmt()    {}
 func (*GrantStatement) stmt()                 {}
 func (*GrantAdminStatement) stmt()            {}
 func (*KillQueryStatement) stmt()             {}
+func (*MigrateFieldTypeStatement) stmt()      {}
 func (*ShowContinuousQueriesStatement) stmt() {}
 func (*ShowGrantsForUserStatement) stmt()     {}
 func (*ShowDatabasesStatement) stmt()         {}
@@ -275,10 +287,12 @@ func (*ShowDiagnosticsStatement) stmt()       {}
 func (*ShowTagKeysStatement) stmt()           {}
 func (*ShowTagValuesStatement) stmt()         {}
 func (*ShowUsersStatement) stmt()             {}
+func (*ShowValidationRulesStatement) stmt()   {}
 func (*RevokeStatement) stmt()                {}
 func (*RevokeAdminStatement) stmt()           {}
 func (*SelectStatement) stmt()                {}
 func (*SetPasswordUserStatement) stmt()       {}
+func (*UndropShardStatement) stmt()           {}
 
 // Expr represents an expression that can be evaluated to a value.
 type Expr interface {
@@ -378,6 +392,16 @@ func (a Sources) HasSystemSource() bool {
 	return false
 }
 
+// HasSubquery returns true if any of the sources are subqueries.
+func (a Sources) HasSubquery() bool {
+	for _, s := range a {
+		if _, ok := s.(*SubQuery); ok {
+			return true
+		}
+	}
+	return false
+}
+
 // HasRegex returns true if any of the sources are regex measurements.
 func (a Sources) HasRegex() bool {
 	for _, s := range a {
@@ -461,6 +485,24 @@ func IsSystemName(name string) bool {
 	}
 }
 
+// IsMetaQuery returns true if stmt reads metadata from the index. This is one
+// of the SHOW SERIES, MEASUREMENTS, TAG KEYS, TAG VALUES or FIELD KEYS
+// statements or a SELECT statement that one of them has been rewritten to.
+func IsMetaQuery(stmt Statement) bool {
+	switch stmt := stmt.(type) {
+	case *ShowSeriesStatement, *ShowMeasurementsStatement, *ShowTagKeysStatement,
+		*ShowTagValuesStatement, *ShowFieldKeysStatement:
+		return true
+	case *SelectStatement:
+		for _, src := range stmt.Sources {
+			if m, ok := src.(*Measurement); ok && IsSystemName(m.Name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // SortField represents a field to sort results by.
 type SortField struct {
 	// Name of the field.
@@ -868,6 +910,31 @@ func (s *CreateRetentionPolicyStatement) RequiredPrivileges() (ExecutionPrivileg
 	return ExecutionPrivileges{{Admin: true, Name: "", Privilege: AllPrivileges}}, nil
 }
 
+// AlterDatabaseStatement represents a command to alter an existing database.
+type AlterDatabaseStatement struct {
+	// Name of the database to alter.
+	Name string
+
+	// Precision of timestamps in writes to the database that do not specify
+	// one.
+	Precision string
+}
+
+// String returns a string representation of the alter database statement.
+func (s *AlterDatabaseStatement) String() string {
+	var buf bytes.Buffer
+	_, _ = buf.WriteString("ALTER DATABASE ")
+	_, _ = buf.WriteString(QuoteIdent(s.Name))
+	_, _ = buf.WriteString(" WITH PRECISION ")
+	_, _ = buf.WriteString(s.Precision)
+	return buf.String()
+}
+
+// RequiredPrivileges returns the privilege required to execute an AlterDatabaseStatement.
+func (s *AlterDatabaseStatement) RequiredPrivileges() (ExecutionPrivileges, error) {
+	return ExecutionPrivileges{{Admin: true, Name: "", Privilege: AllPrivileges}}, nil
+}
+
 // AlterRetentionPolicyStatement represents a command to alter an existing retention policy.
 type AlterRetentionPolicyStatement struct {
 	// Name of policy to alter.
@@ -887,6 +954,10 @@ type AlterRetentionPolicyStatement struct {
 
 	// Duration of the Shard.
 	ShardGroupDuration *time.Duration
+
+	// Measurements written to shard groups of their own. Nil leaves them
+	// unchanged.
+	IsolatedMeasurements []string
 }
 
 // String returns a string representation of the alter retention policy statement.
@@ -916,6 +987,17 @@ func (s *AlterRetentionPolicyStatement) String() string {
 		_, _ = buf.WriteString(" DEFAULT")
 	}
 
+	if s.IsolatedMeasurements != nil {
+		_, _ = buf.WriteString(" ISOLATE MEASUREMENTS (")
+		for i, name := range s.IsolatedMeasurements {
+			if i > 0 {
+				_, _ = buf.WriteString(", ")
+			}
+			_, _ = buf.WriteString(QuoteIdent(name))
+		}
+		_, _ = buf.WriteString(")")
+	}
+
 	return buf.String()
 }
 
@@ -938,6 +1020,8 @@ const (
 	PreviousFill
 	// LinearFill means that empty aggregate windows will be filled with whatever a linear value between non null windows.
 	LinearFill
+	// NextFill means that empty aggregate windows will be filled with whatever the next aggregate window has.
+	NextFill
 )
 
 // SelectStatement represents a command for extracting data from the database.
@@ -992,6 +1076,49 @@ type SelectStatement struct {
 
 	// Removes duplicate rows from raw queries.
 	Dedupe bool
+
+	// Compares the selection with the same selection over an earlier time
+	// range, if set.
+	Compare *CompareClause
+
+	// The timezone that GROUP BY time() windows are aligned to and that
+	// result timestamps are rendered in, if set.
+	Location *time.Location
+}
+
+// CompareOp is the value computed from each compared column.
+type CompareOp int
+
+const (
+	// CompareNone returns the current and previous values only.
+	CompareNone CompareOp = iota
+	// CompareDifference also returns the current value minus the previous value.
+	CompareDifference
+	// CompareRatio also returns the current value divided by the previous value.
+	CompareRatio
+)
+
+// CompareClause represents a "COMPARE PREVIOUS <duration>" clause.
+type CompareClause struct {
+	// How far back the earlier time range is.
+	Offset time.Duration
+
+	// What is computed from the current and previous values.
+	Op CompareOp
+}
+
+// String returns a string representation of the clause.
+func (c *CompareClause) String() string {
+	var buf bytes.Buffer
+	_, _ = buf.WriteString("COMPARE PREVIOUS ")
+	_, _ = buf.WriteString(FormatDuration(c.Offset))
+	switch c.Op {
+	case CompareDifference:
+		_, _ = buf.WriteString(" DIFFERENCE")
+	case CompareRatio:
+		_, _ = buf.WriteString(" RATIO")
+	}
+	return buf.String()
 }
 
 // HasDerivative returns true if any function call in the statement is a
@@ -1067,7 +1194,7 @@ func (s *SelectStatement) Clone() *SelectStatement {
 		}
 	}
 	for _, f := range s.Fields {
-		clone.Fields = append(clone.Fields, &Field{Expr: CloneExpr(f.Expr), Alias: f.Alias})
+		clone.Fields = append(clone.Fields, &Field{Expr: CloneExpr(f.Expr), Alias: f.Alias, Cast: f.Cast, Conversion: f.Conversion})
 	}
 	for _, d := range s.Dimensions {
 		clone.Dimensions = append(clone.Dimensions, &Dimension{Expr: CloneExpr(d.Expr)})
@@ -1075,6 +1202,10 @@ func (s *SelectStatement) Clone() *SelectStatement {
 	for _, f := range s.SortFields {
 		clone.SortFields = append(clone.SortFields, &SortField{Name: f.Name, Ascending: f.Ascending})
 	}
+	if s.Compare != nil {
+		other := *s.Compare
+		clone.Compare = &other
+	}
 	return &clone
 }
 
@@ -1413,6 +1544,23 @@ func matchExactRegex(v string) (string, bool) {
 	return "", true
 }
 
+// RewriteCasts moves explicit float, integer and string types on projected
+// variable references into the field's Cast so the values are read in their
+// stored type and converted afterwards instead of being filtered by type.
+func (s *SelectStatement) RewriteCasts() {
+	for _, f := range s.Fields {
+		ref, ok := f.Expr.(*VarRef)
+		if !ok {
+			continue
+		}
+
+		switch ref.Type {
+		case Float, Integer, String:
+			f.Cast, ref.Type = ref.Type, Unknown
+		}
+	}
+}
+
 // RewriteDistinct rewrites the expression to be a call for map/reduce to work correctly.
 // This method assumes all validation has passed.
 func (s *SelectStatement) RewriteDistinct() {
@@ -1484,23 +1632,30 @@ func (s *SelectStatement) RewriteTimeCondition(now time.Time) error {
 // ColumnNames will walk all fields and functions and return the appropriate field names for the select statement
 // while maintaining order of the field names.
 func (s *SelectStatement) ColumnNames() []string {
-	// First walk each field to determine the number of columns.
-	columnFields := Fields{}
-	for _, field := range s.Fields {
-		columnFields = append(columnFields, field)
+	return s.columnNames(false)
+}
 
-		switch f := field.Expr.(type) {
-		case *Call:
-			if f.Name == "top" || f.Name == "bottom" {
-				for _, arg := range f.Args[1:] {
-					ref, ok := arg.(*VarRef)
-					if ok {
-						columnFields = append(columnFields, &Field{Expr: ref})
-					}
-				}
-			}
+// SuffixDuplicateAliases renames each field whose alias repeats the name of
+// an earlier column by adding a numbered suffix, such as "value_1", the same
+// way repeated names generated from expressions are made unique.
+func (s *SelectStatement) SuffixDuplicateAliases() {
+	names := s.columnNames(true)
+	offset := 0
+	if !s.OmitTime {
+		offset++
+	}
+	for i, col := range s.columnFields() {
+		if col.Alias != "" {
+			col.Alias = names[i+offset]
 		}
 	}
+}
+
+// columnNames returns the name of each column. Repeated aliases are kept
+// unless suffixAliases is set.
+func (s *SelectStatement) columnNames(suffixAliases bool) []string {
+	// First walk each field to determine the number of columns.
+	columnFields := s.columnFields()
 
 	// Determine if we should add an extra column for an implicit time.
 	offset := 0
@@ -1517,9 +1672,13 @@ func (s *SelectStatement) ColumnNames() []string {
 	// Keep track of the encountered column names.
 	names := make(map[string]int)
 
-	// Resolve aliases first.
+	// Resolve aliases first. Repeated aliases are resolved with the
+	// generated names when they are suffixed.
 	for i, col := range columnFields {
 		if col.Alias != "" {
+			if _, ok := names[col.Alias]; ok && suffixAliases {
+				continue
+			}
 			columnNames[i+offset] = col.Alias
 			names[col.Alias] = 1
 		}
@@ -1551,6 +1710,46 @@ func (s *SelectStatement) ColumnNames() []string {
 	return columnNames
 }
 
+// DuplicateColumnName returns the first column name, given by an alias or
+// generated from its expression, that more than one column of the statement
+// shares. Returns an empty string if every column name is unique.
+func (s *SelectStatement) DuplicateColumnName() string {
+	names := make(map[string]struct{})
+	if !s.OmitTime {
+		names[s.TimeFieldName()] = struct{}{}
+	}
+	for _, col := range s.columnFields() {
+		name := col.Name()
+		if _, ok := names[name]; ok {
+			return name
+		}
+		names[name] = struct{}{}
+	}
+	return ""
+}
+
+// columnFields returns a field for each column of the statement, except for
+// time. The variables selected by "top" and "bottom" are columns of their own.
+func (s *SelectStatement) columnFields() Fields {
+	columnFields := Fields{}
+	for _, field := range s.Fields {
+		columnFields = append(columnFields, field)
+
+		switch f := field.Expr.(type) {
+		case *Call:
+			if f.Name == "top" || f.Name == "bottom" {
+				for _, arg := range f.Args[1:] {
+					ref, ok := arg.(*VarRef)
+					if ok {
+						columnFields = append(columnFields, &Field{Expr: ref})
+					}
+				}
+			}
+		}
+	}
+	return columnFields
+}
+
 // FieldExprByName returns the expression that matches the field name and the
 // index where this was found. If the name matches one of the arguments to
 // "top" or "bottom", the variable reference inside of the function is returned
@@ -1632,6 +1831,12 @@ func (s *SelectStatement) String() string {
 		_, _ = buf.WriteString(" fill(linear)")
 	case PreviousFill:
 		_, _ = buf.WriteString(" fill(previous)")
+	case NextFill:
+		_, _ = buf.WriteString(" fill(next)")
+	}
+	if s.Compare != nil {
+		_, _ = buf.WriteString(" ")
+		_, _ = buf.WriteString(s.Compare.String())
 	}
 	if len(s.SortFields) > 0 {
 		_, _ = buf.WriteString(" ORDER BY ")
@@ -1650,6 +1855,9 @@ func (s *SelectStatement) String() string {
 	if s.SOffset > 0 {
 		_, _ = fmt.Fprintf(&buf, " SOFFSET %d", s.SOffset)
 	}
+	if s.Location != nil {
+		_, _ = fmt.Fprintf(&buf, " TZ(%s)", QuoteString(s.Location.String()))
+	}
 	return buf.String()
 }
 
@@ -1734,6 +1942,36 @@ func (s *SelectStatement) validate(tr targetRequirement) error {
 		return err
 	}
 
+	if err := s.validateCompare(tr); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// validateCompare ensures the buckets of both time ranges of a COMPARE
+// clause line up.
+func (s *SelectStatement) validateCompare(tr targetRequirement) error {
+	if s.Compare == nil {
+		return nil
+	}
+
+	if tr == targetSubquery {
+		return errors.New("COMPARE is not supported in subqueries")
+	} else if s.Target != nil {
+		return errors.New("COMPARE is not supported with INTO")
+	} else if s.Limit > 0 || s.Offset > 0 || s.SLimit > 0 || s.SOffset > 0 {
+		return errors.New("LIMIT and OFFSET are not supported with COMPARE")
+	}
+
+	interval, err := s.GroupByInterval()
+	if err != nil {
+		return err
+	} else if interval == 0 {
+		return errors.New("COMPARE requires GROUP BY time()")
+	} else if s.Compare.Offset%interval != 0 {
+		return fmt.Errorf("COMPARE PREVIOUS %s must be a multiple of the GROUP BY interval %s", FormatDuration(s.Compare.Offset), FormatDuration(interval))
+	}
 	return nil
 }
 
@@ -1750,6 +1988,17 @@ func (s *SelectStatement) validateFields() error {
 				return err
 			}
 		}
+
+		// Conversions are only lifted out of the field when they wrap it.
+		var err error
+		WalkFunc(f.Expr, func(n Node) {
+			if call, ok := n.(*Call); ok && err == nil && IsConversionFunc(call.Name) {
+				err = fmt.Errorf("%s() must wrap the entire field", call.Name)
+			}
+		})
+		if err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -1892,6 +2141,94 @@ func (s *SelectStatement) validPercentileAggr(expr *Call) error {
 	}
 }
 
+// validEmptyAsAggr determines if the call to EMPTY_AS has valid arguments.
+func (s *SelectStatement) validEmptyAsAggr(expr *Call) error {
+	if err := s.validSelectWithAggregate(); err != nil {
+		return err
+	}
+	if exp, got := 2, len(expr.Args); got != exp {
+		return fmt.Errorf("invalid number of arguments for %s, expected %d, got %d", expr.Name, exp, got)
+	}
+
+	c, ok := expr.Args[0].(*Call)
+	if !ok {
+		return fmt.Errorf("expected aggregate argument in empty_as()")
+	}
+	switch c.Name {
+	case "count", "sum", "mean", "median", "mode", "min", "max", "first", "last", "spread", "stddev":
+		if exp, got := 1, len(c.Args); got != exp {
+			return fmt.Errorf("invalid number of arguments for %s, expected %d, got %d", c.Name, exp, got)
+		}
+
+		switch fc := c.Args[0].(type) {
+		case *VarRef, *Wildcard, *RegexLiteral:
+			// do nothing
+		case *Call:
+			if fc.Name != "distinct" || c.Name != "count" {
+				return fmt.Errorf("expected field argument in %s()", c.Name)
+			} else if exp, got := 1, len(fc.Args); got != exp {
+				return fmt.Errorf("count(distinct <field>) can only have one argument")
+			} else if _, ok := fc.Args[0].(*VarRef); !ok {
+				return fmt.Errorf("expected field argument in distinct()")
+			}
+		case *Distinct:
+			if c.Name != "count" {
+				return fmt.Errorf("expected field argument in %s()", c.Name)
+			}
+		default:
+			return fmt.Errorf("expected field argument in %s()", c.Name)
+		}
+	case "percentile":
+		if err := s.validPercentileAggr(c); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported aggregate in empty_as(): %s", c.Name)
+	}
+
+	switch expr.Args[1].(type) {
+	case *NumberLiteral, *IntegerLiteral, *StringLiteral, *BooleanLiteral:
+		return nil
+	default:
+		return fmt.Errorf("expected literal argument in empty_as()")
+	}
+}
+
+// validTimeWeightedAggr determines if the call to TIME_WEIGHTED_MEAN or
+// TIME_WEIGHTED_INTEGRAL has valid arguments.
+func (s *SelectStatement) validTimeWeightedAggr(expr *Call) error {
+	if err := s.validSelectWithAggregate(); err != nil {
+		return err
+	}
+
+	max := 1
+	if expr.Name == "time_weighted_integral" {
+		max = 2
+	}
+	if got := len(expr.Args); got < 1 || got > max {
+		if max == 1 {
+			return fmt.Errorf("invalid number of arguments for %s, expected 1, got %d", expr.Name, got)
+		}
+		return fmt.Errorf("invalid number of arguments for %s, expected at least 1 but no more than %d, got %d", expr.Name, max, got)
+	}
+
+	switch expr.Args[0].(type) {
+	case *VarRef, *RegexLiteral, *Wildcard:
+		// do nothing
+	default:
+		return fmt.Errorf("expected field argument in %s()", expr.Name)
+	}
+
+	if len(expr.Args) == 2 {
+		if unit, ok := expr.Args[1].(*DurationLiteral); !ok {
+			return fmt.Errorf("second argument to %s must be a duration, got %T", expr.Name, expr.Args[1])
+		} else if unit.Val <= 0 {
+			return fmt.Errorf("duration argument must be positive, got %s", FormatDuration(unit.Val))
+		}
+	}
+	return nil
+}
+
 // validPercentileAggr determines if the call to SAMPLE has valid arguments.
 func (s *SelectStatement) validSampleAggr(expr *Call) error {
 	if err := s.validSelectWithAggregate(); err != nil {
@@ -1920,7 +2257,7 @@ func (s *SelectStatement) validateAggregates(tr targetRequirement) error {
 	for _, f := range s.Fields {
 		for _, expr := range walkFunctionCalls(f.Expr) {
 			switch expr.Name {
-			case "derivative", "non_negative_derivative", "difference", "moving_average", "cumulative_sum", "elapsed":
+			case "derivative", "non_negative_derivative", "difference", "moving_average", "cumulative_sum", "elapsed", "lag", "lead", "flag_outliers":
 				if err := s.validSelectWithAggregate(); err != nil {
 					return err
 				}
@@ -1952,6 +2289,35 @@ func (s *SelectStatement) validateAggregates(tr targetRequirement) error {
 					} else if int64(int(lit.Val)) != lit.Val {
 						return fmt.Errorf("moving_average window too large, got %d", lit.Val)
 					}
+				case "lag", "lead":
+					if got := len(expr.Args); got != 2 {
+						return fmt.Errorf("invalid number of arguments for %s, expected 2, got %d", expr.Name, got)
+					}
+
+					if lit, ok := expr.Args[1].(*IntegerLiteral); !ok {
+						return fmt.Errorf("second argument for %s must be an integer, got %T", expr.Name, expr.Args[1])
+					} else if lit.Val < 1 {
+						return fmt.Errorf("%s offset must be greater than 0, got %d", expr.Name, lit.Val)
+					} else if int64(int(lit.Val)) != lit.Val {
+						return fmt.Errorf("%s offset too large, got %d", expr.Name, lit.Val)
+					}
+				case "flag_outliers":
+					if got := len(expr.Args); got != 2 {
+						return fmt.Errorf("invalid number of arguments for flag_outliers, expected 2, got %d", got)
+					}
+
+					switch arg := expr.Args[1].(type) {
+					case *NumberLiteral:
+						if arg.Val <= 0 {
+							return fmt.Errorf("flag_outliers deviation must be greater than 0, got %v", arg.Val)
+						}
+					case *IntegerLiteral:
+						if arg.Val <= 0 {
+							return fmt.Errorf("flag_outliers deviation must be greater than 0, got %d", arg.Val)
+						}
+					default:
+						return fmt.Errorf("second argument for flag_outliers must be a number, got %T", expr.Args[1])
+					}
 				}
 				// Validate that if they have grouping by time, they need a sub-call like min/max, etc.
 				groupByInterval, err := s.GroupByInterval()
@@ -1973,6 +2339,10 @@ func (s *SelectStatement) validateAggregates(tr targetRequirement) error {
 						if err := s.validPercentileAggr(c); err != nil {
 							return err
 						}
+					case "time_weighted_mean", "time_weighted_integral":
+						if err := s.validTimeWeightedAggr(c); err != nil {
+							return err
+						}
 					default:
 						if exp, got := 1, len(c.Args); got != exp {
 							return fmt.Errorf("invalid number of arguments for %s, expected %d, got %d", c.Name, exp, got)
@@ -1998,6 +2368,10 @@ func (s *SelectStatement) validateAggregates(tr targetRequirement) error {
 						}
 					}
 				}
+			case "empty_as":
+				if err := s.validEmptyAsAggr(expr); err != nil {
+					return err
+				}
 			case "top", "bottom":
 				if err := s.validTopBottomAggr(expr); err != nil {
 					return err
@@ -2010,6 +2384,10 @@ func (s *SelectStatement) validateAggregates(tr targetRequirement) error {
 				if err := s.validSampleAggr(expr); err != nil {
 					return err
 				}
+			case "time_weighted_mean", "time_weighted_integral":
+				if err := s.validTimeWeightedAggr(expr); err != nil {
+					return err
+				}
 			case "holt_winters", "holt_winters_with_fit":
 				if exp, got := 3, len(expr.Args); got != exp {
 					return fmt.Errorf("invalid number of arguments for %s, expected %d, got %d", expr.Name, exp, got)
@@ -2142,7 +2520,7 @@ func (s *SelectStatement) validateGroupByInterval() error {
 		switch expr := f.Expr.(type) {
 		case *Call:
 			switch expr.Name {
-			case "derivative", "non_negative_derivative", "difference", "moving_average", "cumulative_sum", "elapsed", "holt_winters", "holt_winters_with_fit":
+			case "derivative", "non_negative_derivative", "difference", "moving_average", "cumulative_sum", "elapsed", "holt_winters", "holt_winters_with_fit", "lag", "lead", "flag_outliers":
 				// If the first argument is a call, we needed a group by interval and we don't have one.
 				if _, ok := expr.Args[0].(*Call); ok {
 					return fmt.Errorf("%s aggregate requires a GROUP BY interval", expr.Name)
@@ -2664,6 +3042,80 @@ func (s *DropShardStatement) RequiredPrivileges() (ExecutionPrivileges, error) {
 	return ExecutionPrivileges{{Admin: true, Name: "", Privilege: AllPrivileges}}, nil
 }
 
+// UndropShardStatement represents a command for restoring a shard that
+// was dropped with DROP SHARD but is still held in quarantine.
+type UndropShardStatement struct {
+	// ID of the shard to be restored.
+	ID uint64
+}
+
+// String returns a string representation of the undrop shard statement.
+func (s *UndropShardStatement) String() string {
+	var buf bytes.Buffer
+	buf.WriteString("UNDROP SHARD ")
+	buf.WriteString(strconv.FormatUint(s.ID, 10))
+	return buf.String()
+}
+
+// RequiredPrivileges returns the privilege required to execute a
+// UndropShardStatement.
+func (s *UndropShardStatement) RequiredPrivileges() (ExecutionPrivileges, error) {
+	return ExecutionPrivileges{{Admin: true, Name: "", Privilege: AllPrivileges}}, nil
+}
+
+// DefragmentShardStatement represents a command for rewriting the files of a
+// shard so the blocks of each series are contiguous.
+type DefragmentShardStatement struct {
+	// ID of the shard to be defragmented.
+	ID uint64
+}
+
+// String returns a string representation of the defragment shard statement.
+func (s *DefragmentShardStatement) String() string {
+	var buf bytes.Buffer
+	buf.WriteString("DEFRAGMENT SHARD ")
+	buf.WriteString(strconv.FormatUint(s.ID, 10))
+	return buf.String()
+}
+
+// RequiredPrivileges returns the privilege required to execute a
+// DefragmentShardStatement.
+func (s *DefragmentShardStatement) RequiredPrivileges() (ExecutionPrivileges, error) {
+	return ExecutionPrivileges{{Admin: true, Name: "", Privilege: AllPrivileges}}, nil
+}
+
+// MigrateFieldTypeStatement represents a command for rewriting the stored
+// values of a field to a new type. Shards are migrated one at a time, so a
+// query spanning several shards may see both types until it completes.
+type MigrateFieldTypeStatement struct {
+	// Measurement the field belongs to.
+	Measurement string
+
+	// Name of the field to be migrated.
+	Field string
+
+	// Type the field is migrated to.
+	Type DataType
+}
+
+// String returns a string representation of the migrate field type statement.
+func (s *MigrateFieldTypeStatement) String() string {
+	var buf bytes.Buffer
+	_, _ = buf.WriteString("MIGRATE FIELD TYPE ")
+	_, _ = buf.WriteString(QuoteIdent(s.Field))
+	_, _ = buf.WriteString(" FROM ")
+	_, _ = buf.WriteString(QuoteIdent(s.Measurement))
+	_, _ = buf.WriteString(" TO ")
+	_, _ = buf.WriteString(s.Type.String())
+	return buf.String()
+}
+
+// RequiredPrivileges returns the privilege required to execute a
+// MigrateFieldTypeStatement.
+func (s *MigrateFieldTypeStatement) RequiredPrivileges() (ExecutionPrivileges, error) {
+	return ExecutionPrivileges{{Admin: true, Name: "", Privilege: AllPrivileges}}, nil
+}
+
 // ShowContinuousQueriesStatement represents a command for listing continuous queries.
 type ShowContinuousQueriesStatement struct{}
 
@@ -3054,6 +3506,95 @@ func (s *ShowSubscriptionsStatement) RequiredPrivileges() (ExecutionPrivileges,
 	return ExecutionPrivileges{{Admin: true, Name: "", Privilege: AllPrivileges}}, nil
 }
 
+// CreateValidationRuleStatement represents a command to add a rule that points
+// written to a database are validated against.
+type CreateValidationRuleStatement struct {
+	Name     string
+	Database string
+
+	// Measurement the rule applies to. If blank, the rule applies to every
+	// measurement of the database.
+	Measurement string
+
+	// Tag is a tag the points are required to have.
+	Tag string
+
+	// Field is a field whose values must be between Min and Max, inclusive,
+	// if the points have it.
+	Field string
+	Min   float64
+	Max   float64
+}
+
+// String returns a string representation of the CreateValidationRuleStatement.
+func (s *CreateValidationRuleStatement) String() string {
+	var buf bytes.Buffer
+	_, _ = buf.WriteString("CREATE VALIDATION RULE ")
+	_, _ = buf.WriteString(QuoteIdent(s.Name))
+	_, _ = buf.WriteString(" ON ")
+	_, _ = buf.WriteString(QuoteIdent(s.Database))
+	if s.Measurement != "" {
+		_, _ = buf.WriteString(" FROM ")
+		_, _ = buf.WriteString(QuoteIdent(s.Measurement))
+	}
+	if s.Tag != "" {
+		_, _ = buf.WriteString(" REQUIRE TAG ")
+		_, _ = buf.WriteString(QuoteIdent(s.Tag))
+	} else {
+		_, _ = buf.WriteString(" REQUIRE FIELD ")
+		_, _ = buf.WriteString(QuoteIdent(s.Field))
+		_, _ = buf.WriteString(" BETWEEN ")
+		_, _ = buf.WriteString(strconv.FormatFloat(s.Min, 'f', -1, 64))
+		_, _ = buf.WriteString(" AND ")
+		_, _ = buf.WriteString(strconv.FormatFloat(s.Max, 'f', -1, 64))
+	}
+	return buf.String()
+}
+
+// RequiredPrivileges returns the privilege required to execute a CreateValidationRuleStatement.
+func (s *CreateValidationRuleStatement) RequiredPrivileges() (ExecutionPrivileges, error) {
+	return ExecutionPrivileges{{Admin: true, Name: "", Privilege: AllPrivileges}}, nil
+}
+
+// DropValidationRuleStatement represents a command to drop a validation rule.
+type DropValidationRuleStatement struct {
+	Name     string
+	Database string
+}
+
+// String returns a string representation of the DropValidationRuleStatement.
+func (s *DropValidationRuleStatement) String() string {
+	return fmt.Sprintf(`DROP VALIDATION RULE %s ON %s`, QuoteIdent(s.Name), QuoteIdent(s.Database))
+}
+
+// RequiredPrivileges returns the privilege required to execute a DropValidationRuleStatement.
+func (s *DropValidationRuleStatement) RequiredPrivileges() (ExecutionPrivileges, error) {
+	return ExecutionPrivileges{{Admin: true, Name: "", Privilege: AllPrivileges}}, nil
+}
+
+// ShowValidationRulesStatement represents a command for listing the validation
+// rules of a database.
+type ShowValidationRulesStatement struct {
+	// Name of the database to list the rules of.
+	Database string
+}
+
+// String returns a string representation of a ShowValidationRulesStatement.
+func (s *ShowValidationRulesStatement) String() string {
+	var buf bytes.Buffer
+	_, _ = buf.WriteString("SHOW VALIDATION RULES")
+	if s.Database != "" {
+		_, _ = buf.WriteString(" ON ")
+		_, _ = buf.WriteString(QuoteIdent(s.Database))
+	}
+	return buf.String()
+}
+
+// RequiredPrivileges returns the privilege required to execute a ShowValidationRulesStatement.
+func (s *ShowValidationRulesStatement) RequiredPrivileges() (ExecutionPrivileges, error) {
+	return ExecutionPrivileges{{Admin: false, Name: "", Privilege: ReadPrivilege}}, nil
+}
+
 // ShowTagKeysStatement represents a command for listing tag keys.
 type ShowTagKeysStatement struct {
 	// Database to query. If blank, use the default database.
@@ -3311,6 +3852,14 @@ func (a Fields) String() string {
 type Field struct {
 	Expr  Expr
 	Alias string
+
+	// Cast is the type the field's values are converted to after they are
+	// read. It is set by RewriteCasts and is Unknown when no cast applies.
+	Cast DataType
+
+	// Conversion is the unit conversion applied to the field's values after
+	// they are read. It is nil when no conversion applies.
+	Conversion *UnitConversion
 }
 
 // Name returns the name of the field. Returns alias, if set.
@@ -3321,6 +3870,11 @@ func (f *Field) Name() string {
 		return f.Alias
 	}
 
+	// Return the conversion function name, if converted.
+	if f.Conversion != nil {
+		return f.Conversion.Name
+	}
+
 	// Return the function name or variable name, if available.
 	switch expr := f.Expr.(type) {
 	case *Call:
@@ -3341,6 +3895,9 @@ func (f *Field) Name() string {
 // String returns a string representation of the field.
 func (f *Field) String() string {
 	str := f.Expr.String()
+	if f.Conversion != nil {
+		str = f.Conversion.format(str)
+	}
 
 	if f.Alias == "" {
 		return str
@@ -3934,7 +4491,7 @@ func TimeRange(expr Expr) (min, max time.Time, err error) {
 				}
 			}
 
-			// Update the min/max depending on the operator.
+			// Update the min/max depending on the operator. Both are inclusive.
 			// The GT & LT update the value by +/- 1ns not make them "not equal".
 			switch op {
 			case GT:
@@ -3957,8 +4514,8 @@ func TimeRange(expr Expr) (min, max time.Time, err error) {
 				if min.IsZero() || value.After(min) {
 					min = value
 				}
-				if max.IsZero() || value.Add(1*time.Nanosecond).Before(max) {
-					max = value.Add(1 * time.Nanosecond)
+				if max.IsZero() || value.Before(max) {
+					max = value
 				}
 			}
 		}
@@ -4495,10 +5052,12 @@ func EvalType(expr Expr, sources Sources, typmap TypeMapper) DataType {
 		return typ
 	case *Call:
 		switch expr.Name {
-		case "mean", "median":
+		case "mean", "median", "time_weighted_mean", "time_weighted_integral":
 			return Float
 		case "count":
 			return Integer
+		case "flag_outliers":
+			return Boolean
 		default:
 			return EvalType(expr.Args[0], sources, typmap)
 		}
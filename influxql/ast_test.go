@@ -879,7 +879,7 @@ func TestTimeRange(t *testing.T) {
 		{expr: `time < 10`, min: `0001-01-01T00:00:00Z`, max: `1970-01-01T00:00:00.000000009Z`},
 
 		// Equality
-		{expr: `time = '2000-01-01 00:00:00'`, min: `2000-01-01T00:00:00Z`, max: `2000-01-01T00:00:00.000000001Z`},
+		{expr: `time = '2000-01-01 00:00:00'`, min: `2000-01-01T00:00:00Z`, max: `2000-01-01T00:00:00Z`},
 
 		// Multiple time expressions.
 		{expr: `time >= '2000-01-01 00:00:00' AND time < '2000-01-02 00:00:00'`, min: `2000-01-01T00:00:00Z`, max: `2000-01-01T23:59:59.999999999Z`},
@@ -888,7 +888,7 @@ func TestTimeRange(t *testing.T) {
 		{expr: `time >= '2000-01-01 00:00:00' AND time <= '1999-01-01 00:00:00'`, min: `2000-01-01T00:00:00Z`, max: `1999-01-01T00:00:00Z`},
 
 		// Absolute time
-		{expr: `time = 1388534400s`, min: `2014-01-01T00:00:00Z`, max: `2014-01-01T00:00:00.000000001Z`},
+		{expr: `time = 1388534400s`, min: `2014-01-01T00:00:00Z`, max: `2014-01-01T00:00:00Z`},
 
 		// Non-comparative expressions.
 		{expr: `time`, min: `0001-01-01T00:00:00Z`, max: `0001-01-01T00:00:00Z`},
@@ -1039,6 +1039,9 @@ func TestParseString(t *testing.T) {
 		{
 			stmt: `ALTER RETENTION POLICY "my rp" ON "a database" DEFAULT`,
 		},
+		{
+			stmt: `ALTER DATABASE "a database" WITH PRECISION ms`,
+		},
 		{
 			stmt: `SHOW RETENTION POLICIES ON "a database"`,
 		},
@@ -1475,6 +1478,16 @@ func TestSelect_ColumnNames(t *testing.T) {
 			},
 			columns: []string{"time", "value_1", "value", "value_2"},
 		},
+		{
+			stmt: &influxql.SelectStatement{
+				Fields: influxql.Fields([]*influxql.Field{
+					{Expr: &influxql.VarRef{Val: "usage_user"}, Alias: "value"},
+					{Expr: &influxql.VarRef{Val: "value"}},
+					{Expr: &influxql.VarRef{Val: "usage_system"}, Alias: "value"},
+				}),
+			},
+			columns: []string{"time", "value", "value_1", "value"},
+		},
 		{
 			stmt: &influxql.SelectStatement{
 				Fields: influxql.Fields([]*influxql.Field{
@@ -1492,6 +1505,44 @@ func TestSelect_ColumnNames(t *testing.T) {
 	}
 }
 
+func TestSelect_SuffixDuplicateAliases(t *testing.T) {
+	for _, tt := range []struct {
+		s       string
+		columns []string
+	}{
+		{s: `SELECT usage_user AS value, value, usage_system AS value FROM cpu`, columns: []string{"time", "value", "value_1", "value_2"}},
+		{s: `SELECT mean(value) AS v, max(value) AS v FROM cpu`, columns: []string{"time", "v", "v_1"}},
+		{s: `SELECT mean(value) AS value, max(value) AS max FROM cpu`, columns: []string{"time", "value", "max"}},
+	} {
+		stmt := MustParseSelectStatement(tt.s)
+		stmt.SuffixDuplicateAliases()
+		if columns := stmt.ColumnNames(); !reflect.DeepEqual(columns, tt.columns) {
+			t.Errorf("%s: unexpected columns: got %v, exp %v", tt.s, columns, tt.columns)
+		}
+	}
+}
+
+func TestSelect_DuplicateColumnName(t *testing.T) {
+	for _, tt := range []struct {
+		s    string
+		name string
+	}{
+		{s: `SELECT value, total FROM cpu`},
+		{s: `SELECT value, value FROM cpu`, name: "value"},
+		{s: `SELECT mean(value), mean(total) FROM cpu`, name: "mean"},
+		{s: `SELECT mean(value) AS v, max(value) AS v FROM cpu, mem`, name: "v"},
+		{s: `SELECT total AS value, value FROM cpu`, name: "value"},
+		{s: `SELECT top(value, host, 2), host FROM cpu`, name: "host"},
+		{s: `SELECT value AS time FROM cpu`, name: "time"},
+		{s: `SELECT mean(value) AS value, max(value) AS max FROM cpu`},
+	} {
+		stmt := MustParseSelectStatement(tt.s)
+		if name := stmt.DuplicateColumnName(); name != tt.name {
+			t.Errorf("%s: unexpected duplicate column: got %q, exp %q", tt.s, name, tt.name)
+		}
+	}
+}
+
 func TestSelect_Privileges(t *testing.T) {
 	stmt := &influxql.SelectStatement{
 		Target: &influxql.Target{
@@ -1597,6 +1648,10 @@ func TestShow_Privileges(t *testing.T) {
 			stmt: &influxql.ShowSubscriptionsStatement{},
 			exp:  influxql.ExecutionPrivileges{{Admin: true, Privilege: influxql.AllPrivileges}},
 		},
+		{
+			stmt: &influxql.ShowValidationRulesStatement{},
+			exp:  influxql.ExecutionPrivileges{{Admin: false, Privilege: influxql.ReadPrivilege}},
+		},
 		{
 			stmt: &influxql.ShowDiagnosticsStatement{},
 			exp:  influxql.ExecutionPrivileges{{Admin: true, Privilege: influxql.AllPrivileges}},
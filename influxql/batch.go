@@ -0,0 +1,206 @@
+package influxql
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// BatchQuery combines the statements of a batch of queries so statements that
+// differ only in the aggregates they select are executed as one statement.
+// Combined with SelectOptions.ShareScans, their aggregates are computed from
+// a single scan of the data instead of one scan for each statement.
+type BatchQuery struct {
+	// Query holds the statements to execute.
+	Query *Query
+
+	// parts maps the statements of Query back to the original statements.
+	parts [][]batchPart
+}
+
+// batchPart is an original statement that was combined into a statement of
+// the batch. Its n columns follow offset columns of the combined statement.
+type batchPart struct {
+	id      int
+	offset  int
+	n       int
+	columns []string
+	noFill  bool
+}
+
+// NewBatchQuery combines stmts, the statements of a batch in order, into a
+// single query. A SELECT of aggregates of fields from measurements is
+// combined with the other statements that have the same sources, condition,
+// grouping and fill. Other statements are executed as they are.
+func NewBatchQuery(stmts Statements) *BatchQuery {
+	q := &BatchQuery{Query: &Query{}}
+
+	groups := make(map[string]int)
+	for id, stmt := range stmts {
+		sel, ok := stmt.(*SelectStatement)
+		key, batchable := batchKey(sel)
+		if !ok || !batchable {
+			q.Query.Statements = append(q.Query.Statements, stmt)
+			q.parts = append(q.parts, []batchPart{{id: id}})
+			continue
+		}
+
+		part := batchPart{
+			id:      id,
+			n:       len(sel.Fields),
+			columns: sel.ColumnNames(),
+			noFill:  sel.Fill == NoFill,
+		}
+
+		i, ok := groups[key]
+		if !ok {
+			i = len(q.Query.Statements)
+			groups[key] = i
+
+			combined := sel.Clone()
+			combined.Fields = nil
+			q.Query.Statements = append(q.Query.Statements, combined)
+			q.parts = append(q.parts, nil)
+		}
+
+		combined := q.Query.Statements[i].(*SelectStatement)
+		part.offset = len(combined.Fields)
+		for _, f := range sel.Fields {
+			// Alias every column so the names of the combined statement
+			// cannot conflict.
+			combined.Fields = append(combined.Fields, &Field{
+				Expr:  CloneExpr(f.Expr),
+				Alias: "f" + strconv.Itoa(len(combined.Fields)),
+			})
+		}
+		q.parts[i] = append(q.parts[i], part)
+	}
+
+	// Statements that were not combined with any other statement are
+	// executed as written.
+	for i, parts := range q.parts {
+		if len(parts) == 1 && parts[0].columns != nil {
+			q.Query.Statements[i] = stmts[parts[0].id]
+			q.parts[i] = []batchPart{{id: parts[0].id}}
+		}
+	}
+	return q
+}
+
+// batchKey returns the key that statements must share to be combined and
+// whether stmt can be combined at all.
+func batchKey(stmt *SelectStatement) (string, bool) {
+	if stmt == nil || stmt.Target != nil || stmt.Compare != nil {
+		return "", false
+	}
+
+	// Limits count rows and series that are only in the result because
+	// of another statement of the batch.
+	if stmt.Limit > 0 || stmt.Offset > 0 || stmt.SLimit > 0 || stmt.SOffset > 0 {
+		return "", false
+	}
+
+	for _, source := range stmt.Sources {
+		if _, ok := source.(*Measurement); !ok {
+			return "", false
+		}
+	}
+	for _, f := range stmt.Fields {
+		if _, ok := sharedScanCallRef(f.Expr); !ok {
+			return "", false
+		}
+	}
+
+	// A lone selector without a GROUP BY time() returns the time of the
+	// selected point, which is lost when combined with other aggregates.
+	if len(stmt.Fields) == 1 && IsSelector(stmt.Fields[0].Expr) {
+		if d, err := stmt.GroupByInterval(); err != nil || d == 0 {
+			return "", false
+		}
+	}
+
+	other := *stmt
+	other.Fields = nil
+	return fmt.Sprintf("%s\x00%s\x00%t", other.String(), stmt.TimeAlias, stmt.OmitTime), true
+}
+
+// CombinedN returns the number of statements of the batch that were
+// combined with another statement.
+func (q *BatchQuery) CombinedN() int {
+	var n int
+	for _, parts := range q.parts {
+		if len(parts) > 1 {
+			n += len(parts)
+		}
+	}
+	return n
+}
+
+// Split returns the results of the original statements from r, the complete
+// result of a statement of Query. The StatementID of each result is the
+// position of its statement in the batch.
+func (q *BatchQuery) Split(r *Result) []*Result {
+	if r.StatementID < 0 || r.StatementID >= len(q.parts) {
+		return nil
+	}
+
+	parts := q.parts[r.StatementID]
+	if len(parts) == 1 && parts[0].columns == nil {
+		other := *r
+		other.StatementID = parts[0].id
+		return []*Result{&other}
+	}
+
+	results := make([]*Result, 0, len(parts))
+	for _, part := range parts {
+		results = append(results, part.split(r))
+	}
+	return results
+}
+
+// split returns the columns of the part from the result of the combined
+// statement. Rows and series that only have values of other parts are
+// removed, since the original statement would not have returned them.
+func (part batchPart) split(r *Result) *Result {
+	result := &Result{
+		StatementID: part.id,
+		Tags:        r.Tags,
+		Messages:    r.Messages,
+		Partial:     r.Partial,
+		Err:         r.Err,
+		Checkpoint:  r.Checkpoint,
+	}
+
+	// The implicit time column, if any, is shared by every part.
+	timeN := len(part.columns) - part.n
+
+	for _, row := range r.Series {
+		other := *row
+		other.Columns = part.columns
+		other.Values = nil
+
+		found := false
+		for _, values := range row.Values {
+			v := make([]interface{}, 0, len(part.columns))
+			v = append(v, values[:timeN]...)
+			v = append(v, values[timeN+part.offset:timeN+part.offset+part.n]...)
+
+			empty := true
+			for _, value := range v[timeN:] {
+				if value != nil {
+					empty = false
+					break
+				}
+			}
+			if !empty {
+				found = true
+			} else if part.noFill {
+				continue
+			}
+			other.Values = append(other.Values, v)
+		}
+		if found {
+			result.Series = append(result.Series, &other)
+		}
+	}
+	return result
+}
@@ -0,0 +1,100 @@
+package influxql_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/davecgh/go-spew/spew"
+	"github.com/lucaswiersma/influxdb/influxql"
+	"github.com/lucaswiersma/influxdb/models"
+)
+
+// Ensure statements selecting aggregates of the same data are combined.
+func TestNewBatchQuery(t *testing.T) {
+	stmts := mustParseStatements(`
+SELECT mean(a) FROM cpu WHERE time > now() - 1h GROUP BY time(1m);
+SELECT max(a) FROM mem WHERE time > now() - 1h GROUP BY time(1m);
+SELECT max(b) AS peak FROM cpu WHERE time > now() - 1h GROUP BY time(1m);
+SELECT max(b) FROM cpu;
+SELECT mean(a) FROM cpu WHERE time > now() - 1h GROUP BY time(1m) LIMIT 5;
+SELECT mean(a), count(b) FROM cpu WHERE time > now() - 1h GROUP BY time(1m);
+SELECT a FROM cpu`)
+	q := influxql.NewBatchQuery(stmts)
+
+	if got, exp := q.Query.String(), "SELECT mean(a) AS f0, max(b) AS f1, mean(a) AS f2, count(b) AS f3 FROM cpu WHERE time > now() - 1h GROUP BY time(1m);\n"+
+		"SELECT max(a) FROM mem WHERE time > now() - 1h GROUP BY time(1m);\n"+
+		"SELECT max(b) FROM cpu;\n"+
+		"SELECT mean(a) FROM cpu WHERE time > now() - 1h GROUP BY time(1m) LIMIT 5;\n"+
+		"SELECT a FROM cpu"; got != exp {
+		t.Fatalf("unexpected query:\n\ngot=%s\n\nexp=%s", got, exp)
+	}
+	if n := q.CombinedN(); n != 3 {
+		t.Fatalf("unexpected combined statements: %d", n)
+	}
+}
+
+// Ensure the results of combined statements are split.
+func TestBatchQuery_Split(t *testing.T) {
+	stmts := mustParseStatements(`
+SELECT mean(a) FROM cpu WHERE time >= 0 AND time < 2m GROUP BY time(1m) fill(none);
+SELECT max(b) AS peak FROM cpu WHERE time >= 0 AND time < 2m GROUP BY time(1m) fill(none);
+SELECT a FROM cpu`)
+	q := influxql.NewBatchQuery(stmts)
+
+	t0 := time.Unix(0, 0).UTC()
+	t1 := t0.Add(time.Minute)
+	results := q.Split(&influxql.Result{
+		StatementID: 0,
+		Series: models.Rows{
+			{Name: "cpu", Tags: map[string]string{"host": "A"}, Columns: []string{"time", "f0", "f1"}, Values: [][]interface{}{
+				{t0, 1.5, nil},
+				{t1, 2.5, float64(4)},
+			}},
+			{Name: "cpu", Tags: map[string]string{"host": "B"}, Columns: []string{"time", "f0", "f1"}, Values: [][]interface{}{
+				{t0, nil, float64(8)},
+			}},
+		},
+	})
+	if exp := []*influxql.Result{
+		{
+			StatementID: 0,
+			Series: models.Rows{
+				{Name: "cpu", Tags: map[string]string{"host": "A"}, Columns: []string{"time", "mean"}, Values: [][]interface{}{
+					{t0, 1.5},
+					{t1, 2.5},
+				}},
+			},
+		},
+		{
+			StatementID: 1,
+			Series: models.Rows{
+				{Name: "cpu", Tags: map[string]string{"host": "A"}, Columns: []string{"time", "peak"}, Values: [][]interface{}{
+					{t1, float64(4)},
+				}},
+				{Name: "cpu", Tags: map[string]string{"host": "B"}, Columns: []string{"time", "peak"}, Values: [][]interface{}{
+					{t0, float64(8)},
+				}},
+			},
+		},
+	}; !reflect.DeepEqual(results, exp) {
+		t.Fatalf("unexpected results: %s", spew.Sdump(results))
+	}
+
+	// The results of statements that were not combined are returned as is.
+	err := errors.New("marker")
+	results = q.Split(&influxql.Result{StatementID: 1, Err: err})
+	if len(results) != 1 || results[0].StatementID != 2 || results[0].Err != err {
+		t.Fatalf("unexpected results: %s", spew.Sdump(results))
+	}
+}
+
+// mustParseStatements parses the statements of a query. Panic on error.
+func mustParseStatements(s string) influxql.Statements {
+	q, err := influxql.ParseQuery(s)
+	if err != nil {
+		panic(err)
+	}
+	return q.Statements
+}
@@ -679,6 +679,93 @@ func newStddevIterator(input Iterator, opt IteratorOptions) (Iterator, error) {
 	}
 }
 
+// newTimeWeightedIterator returns an iterator for operating on a
+// time_weighted_mean() or time_weighted_integral() call. The integral is
+// expressed in the given unit of time.
+func newTimeWeightedIterator(input Iterator, opt IteratorOptions, integral bool, unit time.Duration) (Iterator, error) {
+	reduce := func(a []FloatPoint) []FloatPoint {
+		return timeWeightedReduceSlice(a, opt, integral, unit)
+	}
+
+	switch input := input.(type) {
+	case FloatIterator:
+		createFn := func() (FloatPointAggregator, FloatPointEmitter) {
+			fn := NewFloatSliceFuncReducer(reduce)
+			return fn, fn
+		}
+		return newFloatReduceFloatIterator(input, opt, createFn), nil
+	case IntegerIterator:
+		createFn := func() (IntegerPointAggregator, FloatPointEmitter) {
+			fn := NewIntegerSliceFuncFloatReducer(func(a []IntegerPoint) []FloatPoint {
+				points := make([]FloatPoint, len(a))
+				for i, p := range a {
+					points[i] = FloatPoint{Time: p.Time, Value: float64(p.Value), Nil: p.Nil}
+				}
+				return reduce(points)
+			})
+			return fn, fn
+		}
+		return newIntegerReduceFloatIterator(input, opt, createFn), nil
+	default:
+		return nil, fmt.Errorf("unsupported %s iterator type: %T", timeWeightedName(integral), input)
+	}
+}
+
+func timeWeightedName(integral bool) string {
+	if integral {
+		return "time_weighted_integral"
+	}
+	return "time_weighted_mean"
+}
+
+// timeWeightedReduceSlice returns the time-weighted mean or integral of the
+// values within a window. Each value is in effect from its time until the
+// time of the next value. The last value is in effect until the end of the
+// window, or the end of the query's time range if it is earlier, when the
+// query groups by time, and is not weighted otherwise.
+func timeWeightedReduceSlice(a []FloatPoint, opt IteratorOptions, integral bool, unit time.Duration) []FloatPoint {
+	points := a[:0]
+	for _, p := range a {
+		if !p.Nil && !math.IsNaN(p.Value) {
+			points = append(points, p)
+		}
+	}
+	if len(points) == 0 {
+		return []FloatPoint{{Time: ZeroTime, Nil: true}}
+	}
+	sort.Stable(floatPointsByTime(points))
+
+	end := points[len(points)-1].Time
+	if !opt.Interval.IsZero() {
+		_, end = opt.windowBounds(opt.Window(points[0].Time))
+		if opt.EndTime+1 < end {
+			end = opt.EndTime + 1
+		}
+	}
+
+	var sum float64
+	for i, p := range points {
+		next := end
+		if i < len(points)-1 {
+			next = points[i+1].Time
+		}
+		if next > p.Time {
+			sum += p.Value * float64(next-p.Time)
+		}
+	}
+
+	if integral {
+		return []FloatPoint{{Time: ZeroTime, Value: sum / float64(unit)}}
+	}
+
+	// A window with a single instant has no duration to weight by.
+	d := end - points[0].Time
+	if d <= 0 {
+		return []FloatPoint{{Time: ZeroTime, Value: points[len(points)-1].Value}}
+	}
+	return []FloatPoint{{Time: ZeroTime, Value: sum / float64(d)}}
+}
+
 // FloatStddevReduceSlice returns the stddev value within a window.
 func FloatStddevReduceSlice(a []FloatPoint) []FloatPoint {
 	// If there is only one point then return 0.
@@ -1233,6 +1320,153 @@ func newCumulativeSumIterator(input Iterator, opt IteratorOptions) (Iterator, er
 	}
 }
 
+// newLagIterator returns an iterator for operating on a lag() call.
+func newLagIterator(input Iterator, opt IteratorOptions, n int) (Iterator, error) {
+	return newOffsetIterator(input, opt, n)
+}
+
+// newLeadIterator returns an iterator for operating on a lead() call.
+func newLeadIterator(input Iterator, opt IteratorOptions, n int) (Iterator, error) {
+	return newOffsetIterator(input, opt, -n)
+}
+
+// newOffsetIterator returns an iterator that replaces the value of each point
+// with the value of the point offset positions earlier in time within the same
+// series. Negative offsets reference later points.
+func newOffsetIterator(input Iterator, opt IteratorOptions, offset int) (Iterator, error) {
+	// The points are passed to the reducer in the order they are read so
+	// flip the offset when reading in descending order.
+	if !opt.Ascending {
+		offset = -offset
+	}
+
+	switch input := input.(type) {
+	case FloatIterator:
+		aggregateFn := NewFloatOffsetReduceSliceFunc(offset)
+		createFn := func() (FloatPointAggregator, FloatPointEmitter) {
+			fn := NewFloatSliceFuncReducer(aggregateFn)
+			return fn, fn
+		}
+		return newFloatReduceFloatIterator(input, opt, createFn), nil
+	case IntegerIterator:
+		aggregateFn := NewIntegerOffsetReduceSliceFunc(offset)
+		createFn := func() (IntegerPointAggregator, IntegerPointEmitter) {
+			fn := NewIntegerSliceFuncReducer(aggregateFn)
+			return fn, fn
+		}
+		return newIntegerReduceIntegerIterator(input, opt, createFn), nil
+	case StringIterator:
+		aggregateFn := NewStringOffsetReduceSliceFunc(offset)
+		createFn := func() (StringPointAggregator, StringPointEmitter) {
+			fn := NewStringSliceFuncReducer(aggregateFn)
+			return fn, fn
+		}
+		return newStringReduceStringIterator(input, opt, createFn), nil
+	case BooleanIterator:
+		aggregateFn := NewBooleanOffsetReduceSliceFunc(offset)
+		createFn := func() (BooleanPointAggregator, BooleanPointEmitter) {
+			fn := NewBooleanSliceFuncReducer(aggregateFn)
+			return fn, fn
+		}
+		return newBooleanReduceBooleanIterator(input, opt, createFn), nil
+	default:
+		return nil, fmt.Errorf("unsupported offset iterator type: %T", input)
+	}
+}
+
+// NewFloatOffsetReduceSliceFunc returns a reduce function that sets the value of
+// each point to the value of the point offset positions before it. Points
+// without a neighbor at that offset are returned as nil.
+func NewFloatOffsetReduceSliceFunc(offset int) FloatReduceSliceFunc {
+	return func(a []FloatPoint) []FloatPoint {
+		points := make([]FloatPoint, len(a))
+		for i := range a {
+			points[i] = FloatPoint{Time: a[i].Time, Aux: a[i].Aux}
+			if j := i - offset; j >= 0 && j < len(a) {
+				points[i].Value = a[j].Value
+			} else {
+				points[i].Nil = true
+			}
+		}
+		return points
+	}
+}
+
+// NewIntegerOffsetReduceSliceFunc returns a reduce function that sets the value of
+// each point to the value of the point offset positions before it. Points
+// without a neighbor at that offset are returned as nil.
+func NewIntegerOffsetReduceSliceFunc(offset int) IntegerReduceSliceFunc {
+	return func(a []IntegerPoint) []IntegerPoint {
+		points := make([]IntegerPoint, len(a))
+		for i := range a {
+			points[i] = IntegerPoint{Time: a[i].Time, Aux: a[i].Aux}
+			if j := i - offset; j >= 0 && j < len(a) {
+				points[i].Value = a[j].Value
+			} else {
+				points[i].Nil = true
+			}
+		}
+		return points
+	}
+}
+
+// NewStringOffsetReduceSliceFunc returns a reduce function that sets the value of
+// each point to the value of the point offset positions before it. Points
+// without a neighbor at that offset are returned as nil.
+func NewStringOffsetReduceSliceFunc(offset int) StringReduceSliceFunc {
+	return func(a []StringPoint) []StringPoint {
+		points := make([]StringPoint, len(a))
+		for i := range a {
+			points[i] = StringPoint{Time: a[i].Time, Aux: a[i].Aux}
+			if j := i - offset; j >= 0 && j < len(a) {
+				points[i].Value = a[j].Value
+			} else {
+				points[i].Nil = true
+			}
+		}
+		return points
+	}
+}
+
+// NewBooleanOffsetReduceSliceFunc returns a reduce function that sets the value of
+// each point to the value of the point offset positions before it. Points
+// without a neighbor at that offset are returned as nil.
+func NewBooleanOffsetReduceSliceFunc(offset int) BooleanReduceSliceFunc {
+	return func(a []BooleanPoint) []BooleanPoint {
+		points := make([]BooleanPoint, len(a))
+		for i := range a {
+			points[i] = BooleanPoint{Time: a[i].Time, Aux: a[i].Aux}
+			if j := i - offset; j >= 0 && j < len(a) {
+				points[i].Value = a[j].Value
+			} else {
+				points[i].Nil = true
+			}
+		}
+		return points
+	}
+}
+
+// newFlagOutliersIterator returns an iterator for operating on a
+// flag_outliers() call.
+func newFlagOutliersIterator(input Iterator, opt IteratorOptions, k float64) (Iterator, error) {
+	switch input := input.(type) {
+	case FloatIterator:
+		createFn := func() (FloatPointAggregator, BooleanPointEmitter) {
+			fn := NewFloatOutlierReducer(k)
+			return fn, fn
+		}
+		return newFloatReduceBooleanIterator(input, opt, createFn), nil
+	case IntegerIterator:
+		createFn := func() (IntegerPointAggregator, BooleanPointEmitter) {
+			fn := NewIntegerOutlierReducer(k)
+			return fn, fn
+		}
+		return newIntegerReduceBooleanIterator(input, opt, createFn), nil
+	default:
+		return nil, fmt.Errorf("unsupported flag_outliers iterator type: %T", input)
+	}
+}
+
 // newHoltWintersIterator returns an iterator for operating on a holt_winters() call.
 func newHoltWintersIterator(input Iterator, opt IteratorOptions, h, m int, includeFitData bool, interval time.Duration) (Iterator, error) {
 	switch input := input.(type) {
@@ -1289,3 +1523,93 @@ func newSampleIterator(input Iterator, opt IteratorOptions, size int) (Iterator,
 		return nil, fmt.Errorf("unsupported elapsed iterator type: %T", input)
 	}
 }
+
+// newEmptyValueIterator returns an iterator for operating on an empty_as()
+// call. The null points the aggregate emits for groups without any values are
+// given the value of the call. The value must have the type of the aggregate.
+func newEmptyValueIterator(input Iterator, value Literal) (Iterator, error) {
+	switch input := input.(type) {
+	case FloatIterator:
+		switch value := value.(type) {
+		case *NumberLiteral:
+			return &floatEmptyValueIterator{input: input, value: value.Val}, nil
+		case *IntegerLiteral:
+			return &floatEmptyValueIterator{input: input, value: float64(value.Val)}, nil
+		}
+	case IntegerIterator:
+		if value, ok := value.(*IntegerLiteral); ok {
+			return &integerEmptyValueIterator{input: input, value: value.Val}, nil
+		}
+	case StringIterator:
+		if value, ok := value.(*StringLiteral); ok {
+			return &stringEmptyValueIterator{input: input, value: value.Val}, nil
+		}
+	case BooleanIterator:
+		if value, ok := value.(*BooleanLiteral); ok {
+			return &booleanEmptyValueIterator{input: input, value: value.Val}, nil
+		}
+	default:
+		return nil, fmt.Errorf("unsupported empty_as iterator type: %T", input)
+	}
+	return nil, fmt.Errorf("empty_as value %s does not match the %s type of the aggregate", value, iteratorDataType(input))
+}
+
+type floatEmptyValueIterator struct {
+	input FloatIterator
+	value float64
+}
+
+func (itr *floatEmptyValueIterator) Stats() IteratorStats { return itr.input.Stats() }
+func (itr *floatEmptyValueIterator) Close() error         { return itr.input.Close() }
+func (itr *floatEmptyValueIterator) Next() (*FloatPoint, error) {
+	p, err := itr.input.Next()
+	if p != nil && p.Nil {
+		p.Value, p.Nil = itr.value, false
+	}
+	return p, err
+}
+
+type integerEmptyValueIterator struct {
+	input IntegerIterator
+	value int64
+}
+
+func (itr *integerEmptyValueIterator) Stats() IteratorStats { return itr.input.Stats() }
+func (itr *integerEmptyValueIterator) Close() error         { return itr.input.Close() }
+func (itr *integerEmptyValueIterator) Next() (*IntegerPoint, error) {
+	p, err := itr.input.Next()
+	if p != nil && p.Nil {
+		p.Value, p.Nil = itr.value, false
+	}
+	return p, err
+}
+
+type stringEmptyValueIterator struct {
+	input StringIterator
+	value string
+}
+
+func (itr *stringEmptyValueIterator) Stats() IteratorStats { return itr.input.Stats() }
+func (itr *stringEmptyValueIterator) Close() error         { return itr.input.Close() }
+func (itr *stringEmptyValueIterator) Next() (*StringPoint, error) {
+	p, err := itr.input.Next()
+	if p != nil && p.Nil {
+		p.Value, p.Nil = itr.value, false
+	}
+	return p, err
+}
+
+type booleanEmptyValueIterator struct {
+	input BooleanIterator
+	value bool
+}
+
+func (itr *booleanEmptyValueIterator) Stats() IteratorStats { return itr.input.Stats() }
+func (itr *booleanEmptyValueIterator) Close() error         { return itr.input.Close() }
+func (itr *booleanEmptyValueIterator) Next() (*BooleanPoint, error) {
+	p, err := itr.input.Next()
+	if p != nil && p.Nil {
+		p.Value, p.Nil = itr.value, false
+	}
+	return p, err
+}
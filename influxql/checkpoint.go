@@ -0,0 +1,38 @@
+package influxql
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+// Checkpoint identifies the last point of a SELECT that was returned to a
+// client, so a query can be run again and resume after it. Points at the same
+// time are counted, since a series merged from several series may have more
+// than one point at a time.
+type Checkpoint struct {
+	Name string            `json:"name"`
+	Tags map[string]string `json:"tags,omitempty"`
+	Time int64             `json:"time"`
+	N    int               `json:"n"`
+}
+
+// String returns the checkpoint as an opaque token that is safe to use in
+// a URL.
+func (c *Checkpoint) String() string {
+	buf, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+// ParseCheckpoint parses a token returned by Checkpoint.String.
+func ParseCheckpoint(s string) (*Checkpoint, error) {
+	buf, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.New("invalid checkpoint")
+	}
+	var c Checkpoint
+	if err := json.Unmarshal(buf, &c); err != nil || c.N < 1 {
+		return nil, errors.New("invalid checkpoint")
+	}
+	return &c, nil
+}
@@ -0,0 +1,262 @@
+package influxql
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Unit is a unit of measurement that values can be converted to and from.
+// Values are converted between units of the same dimension through the
+// dimension's base unit using: base = value*Scale + Offset.
+type Unit struct {
+	Name      string
+	Dimension string
+	Scale     float64
+	Offset    float64
+}
+
+// conversionRegistry holds the units and named conversion functions that
+// can be used in a SELECT projection.
+type conversionRegistry struct {
+	mu    sync.RWMutex
+	units map[string]*Unit
+	funcs map[string][2]string
+}
+
+var conversions = &conversionRegistry{
+	units: make(map[string]*Unit),
+	funcs: make(map[string][2]string),
+}
+
+// RegisterUnit registers a unit that can be used with the convert() function
+// and with named conversion functions. Unit names are case insensitive.
+func RegisterUnit(name, dimension string, scale, offset float64) error {
+	if name == "" {
+		return errors.New("unit name required")
+	} else if dimension == "" {
+		return fmt.Errorf("dimension required for unit %s", name)
+	} else if scale == 0 {
+		return fmt.Errorf("scale for unit %s must be non-zero", name)
+	}
+
+	name = strings.ToLower(name)
+
+	conversions.mu.Lock()
+	defer conversions.mu.Unlock()
+	if _, ok := conversions.units[name]; ok {
+		return fmt.Errorf("unit %s already registered", name)
+	}
+	conversions.units[name] = &Unit{Name: name, Dimension: dimension, Scale: scale, Offset: offset}
+	return nil
+}
+
+// RegisterConversionFunc registers a function that converts its single
+// argument from one registered unit to another, such as c_to_f().
+func RegisterConversionFunc(name, from, to string) error {
+	name = strings.ToLower(name)
+	if name == "convert" {
+		return errors.New("convert is a reserved conversion function name")
+	}
+	if _, err := lookupConversion(from, to); err != nil {
+		return err
+	}
+
+	conversions.mu.Lock()
+	defer conversions.mu.Unlock()
+	if _, ok := conversions.funcs[name]; ok {
+		return fmt.Errorf("conversion function %s already registered", name)
+	}
+	conversions.funcs[name] = [2]string{strings.ToLower(from), strings.ToLower(to)}
+	return nil
+}
+
+// IsConversionFunc returns true if name is the generic convert() function or
+// a registered named conversion function.
+func IsConversionFunc(name string) bool {
+	if name == "convert" {
+		return true
+	}
+
+	conversions.mu.RLock()
+	defer conversions.mu.RUnlock()
+	_, ok := conversions.funcs[name]
+	return ok
+}
+
+// lookupConversion returns the units for converting from one unit to another.
+func lookupConversion(from, to string) ([2]*Unit, error) {
+	conversions.mu.RLock()
+	defer conversions.mu.RUnlock()
+
+	f, ok := conversions.units[strings.ToLower(from)]
+	if !ok {
+		return [2]*Unit{}, fmt.Errorf("unknown unit: %s", from)
+	}
+	t, ok := conversions.units[strings.ToLower(to)]
+	if !ok {
+		return [2]*Unit{}, fmt.Errorf("unknown unit: %s", to)
+	}
+	if f.Dimension != t.Dimension {
+		return [2]*Unit{}, fmt.Errorf("cannot convert %s (%s) to %s (%s)", f.Name, f.Dimension, t.Name, t.Dimension)
+	}
+	return [2]*Unit{f, t}, nil
+}
+
+// UnitConversion converts the values of a field from one unit to another
+// after they have been read.
+type UnitConversion struct {
+	// Name is the name of the conversion function used in the query.
+	Name string
+
+	From string
+	To   string
+
+	from, to *Unit
+}
+
+// NewUnitConversion returns a conversion between two registered units.
+// Name is the function the conversion was requested with.
+func NewUnitConversion(name, from, to string) (*UnitConversion, error) {
+	units, err := lookupConversion(from, to)
+	if err != nil {
+		return nil, err
+	}
+	return &UnitConversion{
+		Name: name,
+		From: units[0].Name,
+		To:   units[1].Name,
+		from: units[0],
+		to:   units[1],
+	}, nil
+}
+
+// newConversionFromCall returns the conversion requested by a call to a
+// conversion function and the expression being converted.
+func newConversionFromCall(call *Call) (*UnitConversion, Expr, error) {
+	var from, to string
+	if call.Name == "convert" {
+		if len(call.Args) != 3 {
+			return nil, nil, fmt.Errorf("invalid number of arguments for convert, expected 3, got %d", len(call.Args))
+		}
+		for i, dst := range []*string{&from, &to} {
+			lit, ok := call.Args[i+1].(*StringLiteral)
+			if !ok {
+				return nil, nil, fmt.Errorf("expected string unit argument in convert()")
+			}
+			*dst = lit.Val
+		}
+	} else {
+		if len(call.Args) != 1 {
+			return nil, nil, fmt.Errorf("invalid number of arguments for %s, expected 1, got %d", call.Name, len(call.Args))
+		}
+		conversions.mu.RLock()
+		units := conversions.funcs[call.Name]
+		conversions.mu.RUnlock()
+		from, to = units[0], units[1]
+	}
+
+	// Wildcards are expanded into new fields so they cannot carry a conversion.
+	expr := call.Args[0]
+	var wildcard bool
+	WalkFunc(expr, func(n Node) {
+		switch n.(type) {
+		case *Wildcard, *RegexLiteral:
+			wildcard = true
+		}
+	})
+	if wildcard {
+		return nil, nil, fmt.Errorf("unable to use wildcard in %s()", call.Name)
+	}
+
+	conv, err := NewUnitConversion(call.Name, from, to)
+	if err != nil {
+		return nil, nil, err
+	}
+	return conv, expr, nil
+}
+
+// Convert returns v converted to the target unit. Nil values and values that
+// are not numeric are returned as nil.
+func (c *UnitConversion) Convert(v interface{}) interface{} {
+	switch v := v.(type) {
+	case float64:
+		return c.convert(v)
+	case int64:
+		return c.convert(float64(v))
+	}
+	return nil
+}
+
+func (c *UnitConversion) convert(v float64) float64 {
+	return (v*c.from.Scale + c.from.Offset - c.to.Offset) / c.to.Scale
+}
+
+// format returns the string representation of the conversion applied to expr.
+func (c *UnitConversion) format(expr string) string {
+	if c.Name == "convert" {
+		return fmt.Sprintf("convert(%s, %s, %s)", expr, QuoteString(c.From), QuoteString(c.To))
+	}
+	return fmt.Sprintf("%s(%s)", c.Name, expr)
+}
+
+func init() {
+	for _, u := range []Unit{
+		// Storage, relative to bytes.
+		{Name: "bits", Dimension: "storage", Scale: 0.125},
+		{Name: "bytes", Dimension: "storage", Scale: 1},
+		{Name: "kb", Dimension: "storage", Scale: 1e3},
+		{Name: "mb", Dimension: "storage", Scale: 1e6},
+		{Name: "gb", Dimension: "storage", Scale: 1e9},
+		{Name: "tb", Dimension: "storage", Scale: 1e12},
+		{Name: "kib", Dimension: "storage", Scale: 1 << 10},
+		{Name: "mib", Dimension: "storage", Scale: 1 << 20},
+		{Name: "gib", Dimension: "storage", Scale: 1 << 30},
+		{Name: "tib", Dimension: "storage", Scale: 1 << 40},
+
+		// Temperature, relative to ninths of a kelvin so the scale of
+		// fahrenheit is exact.
+		{Name: "k", Dimension: "temperature", Scale: 9},
+		{Name: "c", Dimension: "temperature", Scale: 9, Offset: 2458.35},
+		{Name: "f", Dimension: "temperature", Scale: 5, Offset: 2298.35},
+
+		// Time, relative to nanoseconds.
+		{Name: "ns", Dimension: "time", Scale: 1},
+		{Name: "us", Dimension: "time", Scale: 1e3},
+		{Name: "ms", Dimension: "time", Scale: 1e6},
+		{Name: "s", Dimension: "time", Scale: 1e9},
+		{Name: "min", Dimension: "time", Scale: 60e9},
+		{Name: "h", Dimension: "time", Scale: 3600e9},
+		{Name: "d", Dimension: "time", Scale: 86400e9},
+	} {
+		if err := RegisterUnit(u.Name, u.Dimension, u.Scale, u.Offset); err != nil {
+			panic(err)
+		}
+	}
+
+	for _, fn := range [][3]string{
+		{"bytes_to_kb", "bytes", "kb"},
+		{"bytes_to_mb", "bytes", "mb"},
+		{"bytes_to_gb", "bytes", "gb"},
+		{"bytes_to_tb", "bytes", "tb"},
+		{"bytes_to_kib", "bytes", "kib"},
+		{"bytes_to_mib", "bytes", "mib"},
+		{"bytes_to_gib", "bytes", "gib"},
+		{"bits_to_bytes", "bits", "bytes"},
+		{"bytes_to_bits", "bytes", "bits"},
+		{"c_to_f", "c", "f"},
+		{"f_to_c", "f", "c"},
+		{"c_to_k", "c", "k"},
+		{"k_to_c", "k", "c"},
+		{"ns_to_ms", "ns", "ms"},
+		{"ns_to_s", "ns", "s"},
+		{"us_to_ms", "us", "ms"},
+		{"ms_to_s", "ms", "s"},
+		{"s_to_ms", "s", "ms"},
+	} {
+		if err := RegisterConversionFunc(fn[0], fn[1], fn[2]); err != nil {
+			panic(err)
+		}
+	}
+}
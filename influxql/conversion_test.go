@@ -0,0 +1,102 @@
+package influxql_test
+
+import (
+	"testing"
+
+	"github.com/lucaswiersma/influxdb/influxql"
+)
+
+func TestUnitConversion_Convert(t *testing.T) {
+	for _, tt := range []struct {
+		from, to string
+		v        interface{}
+		exp      interface{}
+	}{
+		{from: "c", to: "f", v: float64(100), exp: float64(212)},
+		{from: "f", to: "c", v: int64(-40), exp: float64(-40)},
+		{from: "k", to: "c", v: float64(0), exp: float64(-273.15)},
+		{from: "bytes", to: "gb", v: int64(5e9), exp: float64(5)},
+		{from: "bytes", to: "kib", v: float64(2048), exp: float64(2)},
+		{from: "ns", to: "ms", v: int64(1500000), exp: float64(1.5)},
+		{from: "h", to: "min", v: float64(2), exp: float64(120)},
+		{from: "c", to: "f", v: nil, exp: nil},
+		{from: "c", to: "f", v: "hot", exp: nil},
+		{from: "c", to: "f", v: true, exp: nil},
+	} {
+		conv, err := influxql.NewUnitConversion("convert", tt.from, tt.to)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := conv.Convert(tt.v); got != tt.exp {
+			t.Errorf("convert(%v, %s, %s): got %v, exp %v", tt.v, tt.from, tt.to, got, tt.exp)
+		}
+	}
+}
+
+func TestParser_ParseStatement_UnitConversion(t *testing.T) {
+	for _, tt := range []struct {
+		s       string
+		str     string
+		columns []string
+	}{
+		{
+			s:       `SELECT c_to_f(value) FROM cpu`,
+			str:     `SELECT c_to_f(value) FROM cpu`,
+			columns: []string{"time", "c_to_f"},
+		},
+		{
+			s:       `SELECT bytes_to_gb(mean(used)) AS used_gb FROM disk WHERE time > now() - 1h GROUP BY time(1m)`,
+			str:     `SELECT bytes_to_gb(mean(used)) AS used_gb FROM disk WHERE time > now() - 1h GROUP BY time(1m)`,
+			columns: []string{"time", "used_gb"},
+		},
+		{
+			s:       `SELECT convert(latency, 'NS', 'ms'), host FROM http`,
+			str:     `SELECT convert(latency, 'ns', 'ms'), host FROM http`,
+			columns: []string{"time", "convert", "host"},
+		},
+	} {
+		stmt, err := influxql.ParseStatement(tt.s)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.s, err)
+			continue
+		}
+		sel := stmt.(*influxql.SelectStatement)
+		if got := sel.String(); got != tt.str {
+			t.Errorf("%s: unexpected string: %s", tt.s, got)
+		}
+		if got := sel.ColumnNames(); len(got) != len(tt.columns) {
+			t.Errorf("%s: unexpected columns: %v", tt.s, got)
+		} else {
+			for i := range got {
+				if got[i] != tt.columns[i] {
+					t.Errorf("%s: unexpected columns: %v", tt.s, got)
+					break
+				}
+			}
+		}
+		if sel.Fields[0].Conversion == nil {
+			t.Errorf("%s: expected conversion", tt.s)
+		}
+	}
+}
+
+func TestParser_ParseStatement_UnitConversionErrors(t *testing.T) {
+	for _, tt := range []struct {
+		s   string
+		err string
+	}{
+		{s: `SELECT convert(value, 'c', 'gb') FROM cpu`, err: `cannot convert c (temperature) to gb (storage)`},
+		{s: `SELECT convert(value, 'c', 'rankine') FROM cpu`, err: `unknown unit: rankine`},
+		{s: `SELECT convert(value, 'c') FROM cpu`, err: `invalid number of arguments for convert, expected 3, got 2`},
+		{s: `SELECT convert(value, c, 'f') FROM cpu`, err: `expected string unit argument in convert()`},
+		{s: `SELECT c_to_f(value, 1) FROM cpu`, err: `invalid number of arguments for c_to_f, expected 1, got 2`},
+		{s: `SELECT c_to_f(*) FROM cpu`, err: `unable to use wildcard in c_to_f()`},
+		{s: `SELECT c_to_f(value) + 1 FROM cpu`, err: `c_to_f() must wrap the entire field`},
+		{s: `SELECT mean(c_to_f(value)) FROM cpu`, err: `c_to_f() must wrap the entire field`},
+		{s: `SELECT value FROM (SELECT c_to_f(value) AS value FROM cpu)`, err: `unable to use c_to_f() in a subquery`},
+	} {
+		if _, err := influxql.ParseStatement(tt.s); err == nil || err.Error() != tt.err {
+			t.Errorf("%s: unexpected error: got %v, exp %s", tt.s, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package influxql
+
+import (
+	"math"
+	"math/big"
+	"strconv"
+)
+
+// MaxDecimalPlaces is the largest number of decimal places that decimal
+// arithmetic can round to. Results are returned as float64 values, which
+// cannot represent more significant digits than this.
+const MaxDecimalPlaces = 15
+
+// decimalBinaryExprFunc returns a function that performs the arithmetic
+// operator on decimal numbers and rounds the result to the number of decimal
+// places. It returns nil for operators that are not arithmetic.
+//
+// The operands are read as the shortest decimal number that represents them,
+// so 0.1 is exactly one tenth instead of its binary approximation. Operands
+// that are not finite and divisions by zero use float arithmetic.
+func decimalBinaryExprFunc(op Token, places int) func(lhs, rhs float64) float64 {
+	fallback, ok := floatBinaryExprFunc(op).(func(float64, float64) float64)
+	if !ok {
+		return nil
+	}
+
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(places)), nil)
+	return func(lhs, rhs float64) float64 {
+		x, y := decimalFromFloat(lhs), decimalFromFloat(rhs)
+		if x == nil || y == nil || ((op == DIV || op == MOD) && y.Sign() == 0) {
+			return fallback(lhs, rhs)
+		}
+
+		z := new(big.Rat)
+		switch op {
+		case ADD:
+			z.Add(x, y)
+		case SUB:
+			z.Sub(x, y)
+		case MUL:
+			z.Mul(x, y)
+		case DIV:
+			z.Quo(x, y)
+		case MOD:
+			// The result has the sign of the dividend, the same as math.Mod.
+			q := new(big.Int).Quo(new(big.Int).Mul(x.Num(), y.Denom()), new(big.Int).Mul(x.Denom(), y.Num()))
+			z.Sub(x, new(big.Rat).Mul(y, new(big.Rat).SetInt(q)))
+		}
+		return roundDecimal(z, scale)
+	}
+}
+
+// decimalIntegerDivFunc returns a function that divides integers as decimal
+// numbers and rounds the result to the number of decimal places.
+func decimalIntegerDivFunc(places int) func(lhs, rhs int64) float64 {
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(places)), nil)
+	return func(lhs, rhs int64) float64 {
+		if rhs == 0 {
+			return float64(0)
+		}
+		return roundDecimal(big.NewRat(lhs, rhs), scale)
+	}
+}
+
+// decimalFromFloat returns the shortest decimal number that represents v.
+// It returns nil if v is not finite.
+func decimalFromFloat(v float64) *big.Rat {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return nil
+	}
+	r, ok := new(big.Rat).SetString(strconv.FormatFloat(v, 'g', -1, 64))
+	if !ok {
+		return nil
+	}
+	return r
+}
+
+// roundDecimal rounds x to a multiple of 1/scale, with halves rounded away
+// from zero, and returns it as a float64.
+func roundDecimal(x *big.Rat, scale *big.Int) float64 {
+	// Truncating |x| * scale + 1/2 rounds the magnitude half up.
+	num := new(big.Int).Mul(new(big.Int).Abs(x.Num()), scale)
+	num.Mul(num, big.NewInt(2))
+	num.Add(num, x.Denom())
+	den := new(big.Int).Mul(x.Denom(), big.NewInt(2))
+	num.Quo(num, den)
+	if x.Sign() < 0 {
+		num.Neg(num)
+	}
+
+	f, _ := new(big.Rat).SetFrac(num, scale).Float64()
+	return f
+}
@@ -10,6 +10,7 @@ import (
 // Emitter groups values together by name, tags, and time.
 type Emitter struct {
 	buf       []Point
+	filled    []bool
 	itrs      []Iterator
 	ascending bool
 	chunkSize int
@@ -23,12 +24,17 @@ type Emitter struct {
 	// Removes the "time" column from output.
 	// Used for meta queries where time does not apply.
 	OmitTime bool
+
+	// Appends a value to each row that is true when any of the row's values
+	// were generated by fill() rather than read from the data.
+	MarkFilled bool
 }
 
 // NewEmitter returns a new instance of Emitter that pulls from itrs.
 func NewEmitter(itrs []Iterator, ascending bool, chunkSize int) *Emitter {
 	return &Emitter{
 		buf:       make([]Point, len(itrs)),
+		filled:    make([]bool, len(itrs)),
 		itrs:      itrs,
 		ascending: ascending,
 		chunkSize: chunkSize,
@@ -102,6 +108,7 @@ func (e *Emitter) loadBuf() (t int64, name string, tags Tags, err error) {
 			if err != nil {
 				break
 			}
+			e.filled[i] = e.MarkFilled && e.buf[i] != nil && isFilled(e.itrs[i])
 		}
 
 		// Skip if buffer is empty.
@@ -152,15 +159,25 @@ func (e *Emitter) readAt(t int64, name string, tags Tags) []interface{} {
 		offset = 0
 	}
 
-	values := make([]interface{}, len(e.itrs)+offset)
+	n := len(e.itrs) + offset
+	if e.MarkFilled {
+		n++
+	}
+
+	values := make([]interface{}, n)
 	if !e.OmitTime {
 		values[0] = time.Unix(0, t).UTC()
 	}
-	e.readInto(t, name, tags, values[offset:])
+	filled := e.readInto(t, name, tags, values[offset:offset+len(e.itrs)])
+	if e.MarkFilled {
+		values[n-1] = filled
+	}
 	return values
 }
 
-func (e *Emitter) readInto(t int64, name string, tags Tags, values []interface{}) {
+// readInto reads the values at time/name/tags into values. Returns true if
+// any of the values were generated by a fill.
+func (e *Emitter) readInto(t int64, name string, tags Tags, values []interface{}) (filled bool) {
 	for i, p := range e.buf {
 		// Skip if buffer is empty.
 		if p == nil {
@@ -177,10 +194,12 @@ func (e *Emitter) readInto(t int64, name string, tags Tags, values []interface{}
 
 		// Read point value.
 		values[i] = p.value()
+		filled = filled || e.filled[i]
 
 		// Clear buffer.
 		e.buf[i] = nil
 	}
+	return filled
 }
 
 // readIterator reads the next point from itr.
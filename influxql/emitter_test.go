@@ -76,6 +76,100 @@ func TestEmitter_Emit(t *testing.T) {
 	}
 }
 
+// Ensure the emitter can mark rows containing values generated by fill().
+func TestEmitter_MarkFilled(t *testing.T) {
+	opt := influxql.IteratorOptions{
+		Expr:      MustParseExpr(`mean(value)`),
+		StartTime: 0,
+		EndTime:   29,
+		Interval:  influxql.Interval{Duration: 10},
+		Fill:      influxql.NumberFill,
+		FillValue: float64(0),
+		Ascending: true,
+	}
+
+	// Build an emitter that pulls from a filled iterator and an unfilled one.
+	e := influxql.NewEmitter([]influxql.Iterator{
+		influxql.NewInterruptIterator(influxql.NewFillIterator(&FloatIterator{Points: []influxql.FloatPoint{
+			{Name: "cpu", Time: 0, Value: 1},
+			{Name: "cpu", Time: 20, Value: 3},
+		}}, opt.Expr, opt), make(chan struct{})),
+		&FloatIterator{Points: []influxql.FloatPoint{
+			{Name: "cpu", Time: 0, Value: 10},
+			{Name: "cpu", Time: 10, Value: 20},
+			{Name: "cpu", Time: 20, Value: 30},
+		}},
+	}, true, 0)
+	e.Columns = []string{"col1", "col2", "_filled"}
+	e.MarkFilled = true
+
+	if row, _, err := e.Emit(); err != nil {
+		t.Fatalf("unexpected error(0): %s", err)
+	} else if !deep.Equal(row, &models.Row{
+		Name:    "cpu",
+		Columns: []string{"col1", "col2", "_filled"},
+		Values: [][]interface{}{
+			{time.Unix(0, 0).UTC(), float64(1), float64(10), false},
+			{time.Unix(0, 10).UTC(), float64(0), float64(20), true},
+			{time.Unix(0, 20).UTC(), float64(3), float64(30), false},
+		},
+	}) {
+		t.Fatalf("unexpected row(0): %s", spew.Sdump(row))
+	}
+
+	// Verify EOF.
+	if row, _, err := e.Emit(); err != nil {
+		t.Fatalf("unexpected error(eof): %s", err)
+	} else if row != nil {
+		t.Fatalf("unexpected eof: %s", spew.Sdump(row))
+	}
+}
+
+// Ensure rows are marked as filled when the filled aggregate is wrapped by an
+// expression, a transformation or an auxiliary field.
+func TestEmitter_MarkFilled_Wrapped(t *testing.T) {
+	for _, tt := range []struct {
+		q      string
+		filled []bool
+	}{
+		{q: `SELECT mean(value) * 2 FROM cpu WHERE time >= '1970-01-01T00:00:00Z' AND time < '1970-01-01T00:00:30Z' GROUP BY time(10s) fill(0)`, filled: []bool{false, true, false}},
+		{q: `SELECT mean(value) + max(value) FROM cpu WHERE time >= '1970-01-01T00:00:00Z' AND time < '1970-01-01T00:00:30Z' GROUP BY time(10s) fill(0)`, filled: []bool{false, true, false}},
+		{q: `SELECT max(value), host FROM cpu WHERE time >= '1970-01-01T00:00:00Z' AND time < '1970-01-01T00:00:30Z' GROUP BY time(10s) fill(0)`, filled: []bool{false, true, false}},
+		{q: `SELECT derivative(mean(value), 10s) FROM cpu WHERE time >= '1970-01-01T00:00:00Z' AND time < '1970-01-01T00:00:30Z' GROUP BY time(10s) fill(0)`, filled: []bool{false, true, false}},
+	} {
+		var ic IteratorCreator
+		ic.CreateIteratorFn = func(m *influxql.Measurement, opt influxql.IteratorOptions) (influxql.Iterator, error) {
+			return influxql.NewCallIterator(&FloatIterator{Points: []influxql.FloatPoint{
+				{Name: "cpu", Time: 0 * Second, Value: 1, Aux: []interface{}{"A"}},
+				{Name: "cpu", Time: 20 * Second, Value: 3, Aux: []interface{}{"A"}},
+			}}, opt)
+		}
+
+		stmt := MustParseSelectStatement(tt.q)
+		itrs, err := influxql.Select(stmt, &ic, nil)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", tt.q, err)
+		}
+
+		e := influxql.NewEmitter(itrs, true, 0)
+		e.Columns = append(stmt.ColumnNames(), "_filled")
+		e.MarkFilled = true
+
+		row, _, err := e.Emit()
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", tt.q, err)
+		} else if row == nil || len(row.Values) != len(tt.filled) {
+			t.Fatalf("%s: unexpected row: %s", tt.q, spew.Sdump(row))
+		}
+		for i, values := range row.Values {
+			if filled := values[len(values)-1]; filled != tt.filled[i] {
+				t.Errorf("%s: row %d: unexpected _filled: %v", tt.q, i, filled)
+			}
+		}
+		e.Close()
+	}
+}
+
 // Ensure the emitter will limit the chunked output from a series.
 func TestEmitter_ChunkSize(t *testing.T) {
 	// Build an emitter that pulls from one iterator with multiple points in the same series.
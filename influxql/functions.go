@@ -409,6 +409,106 @@ func (r *IntegerCumulativeSumReducer) Emit() []IntegerPoint {
 	return pts
 }
 
+// outlierMinN is the fewest non-nil points needed to flag outliers. Smaller
+// groups have no meaningful standard deviation so none of their points are
+// flagged.
+const outlierMinN = 3
+
+// FloatOutlierReducer flags the points whose value is more than k standard
+// deviations from the mean of all the aggregated points.
+type FloatOutlierReducer struct {
+	k      float64
+	points []FloatPoint
+}
+
+// NewFloatOutlierReducer creates a new FloatOutlierReducer.
+func NewFloatOutlierReducer(k float64) *FloatOutlierReducer {
+	return &FloatOutlierReducer{k: k}
+}
+
+func (r *FloatOutlierReducer) AggregateFloat(p *FloatPoint) {
+	r.points = append(r.points, *p.Clone())
+}
+
+func (r *FloatOutlierReducer) Emit() []BooleanPoint {
+	values := make([]float64, 0, len(r.points))
+	for _, p := range r.points {
+		if !p.Nil {
+			values = append(values, p.Value)
+		}
+	}
+	isOutlier := outlierFunc(values, r.k)
+
+	points := make([]BooleanPoint, len(r.points))
+	for i, p := range r.points {
+		points[i] = BooleanPoint{Time: p.Time, Aux: p.Aux, Nil: p.Nil}
+		if !p.Nil {
+			points[i].Value = isOutlier(p.Value)
+		}
+	}
+	return points
+}
+
+// IntegerOutlierReducer flags the points whose value is more than k standard
+// deviations from the mean of all the aggregated points.
+type IntegerOutlierReducer struct {
+	k      float64
+	points []IntegerPoint
+}
+
+// NewIntegerOutlierReducer creates a new IntegerOutlierReducer.
+func NewIntegerOutlierReducer(k float64) *IntegerOutlierReducer {
+	return &IntegerOutlierReducer{k: k}
+}
+
+func (r *IntegerOutlierReducer) AggregateInteger(p *IntegerPoint) {
+	r.points = append(r.points, *p.Clone())
+}
+
+func (r *IntegerOutlierReducer) Emit() []BooleanPoint {
+	values := make([]float64, 0, len(r.points))
+	for _, p := range r.points {
+		if !p.Nil {
+			values = append(values, float64(p.Value))
+		}
+	}
+	isOutlier := outlierFunc(values, r.k)
+
+	points := make([]BooleanPoint, len(r.points))
+	for i, p := range r.points {
+		points[i] = BooleanPoint{Time: p.Time, Aux: p.Aux, Nil: p.Nil}
+		if !p.Nil {
+			points[i].Value = isOutlier(float64(p.Value))
+		}
+	}
+	return points
+}
+
+// outlierFunc returns a function that reports if a value is more than k
+// sample standard deviations from the mean of values. No value is an outlier
+// when there are fewer than outlierMinN values.
+func outlierFunc(values []float64, k float64) func(v float64) bool {
+	if len(values) < outlierMinN {
+		return func(float64) bool { return false }
+	}
+
+	var mean float64
+	for _, v := range values {
+		mean += v
+	}
+	mean /= float64(len(values))
+
+	var variance float64
+	for _, v := range values {
+		variance += (v - mean) * (v - mean)
+	}
+	stddev := math.Sqrt(variance / float64(len(values)-1))
+
+	return func(v float64) bool {
+		return math.Abs(v-mean) > k*stddev
+	}
+}
+
 // FloatHoltWintersReducer forecasts a series into the future.
 // This is done using the Holt-Winters damped method.
 //    1. Using the series the initial values are calculated using a SSE.
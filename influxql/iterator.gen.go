@@ -52,6 +52,11 @@ func newFloatIterators(itrs []Iterator) []FloatIterator {
 type bufFloatIterator struct {
 	itr FloatIterator
 	buf *FloatPoint
+
+	// lastFilled and bufFilled record whether the last returned point and
+	// the buffered point were generated by a fill.
+	lastFilled bool
+	bufFilled  bool
 }
 
 // newBufFloatIterator returns a buffered FloatIterator.
@@ -90,9 +95,12 @@ func (itr *bufFloatIterator) Next() (*FloatPoint, error) {
 	buf := itr.buf
 	if buf != nil {
 		itr.buf = nil
+		itr.lastFilled = itr.bufFilled
 		return buf, nil
 	}
-	return itr.itr.Next()
+	p, err := itr.itr.Next()
+	itr.lastFilled = isFilled(itr.itr)
+	return p, err
 }
 
 // NextInWindow returns the next value if it is between [startTime, endTime).
@@ -109,7 +117,13 @@ func (itr *bufFloatIterator) NextInWindow(startTime, endTime int64) (*FloatPoint
 }
 
 // unread sets v to the buffer. It is read on the next call to Next().
-func (itr *bufFloatIterator) unread(v *FloatPoint) { itr.buf = v }
+func (itr *bufFloatIterator) unread(v *FloatPoint) {
+	itr.buf = v
+	itr.bufFilled = itr.lastFilled
+}
+
+// filled returns true if the last point was generated by a fill.
+func (itr *bufFloatIterator) filled() bool { return itr.lastFilled }
 
 // floatMergeIterator represents an iterator that combines multiple float iterators.
 type floatMergeIterator struct {
@@ -138,12 +152,12 @@ func newFloatMergeIterator(inputs []FloatIterator, opt IteratorOptions) *floatMe
 	}
 
 	// Initialize heap items.
-	for _, input := range inputs {
+	for i, input := range inputs {
 		// Wrap in buffer, ignore any inputs without anymore points.
 		bufInput := newBufFloatIterator(input)
 
 		// Append to the heap.
-		itr.heap.items = append(itr.heap.items, &floatMergeHeapItem{itr: bufInput})
+		itr.heap.items = append(itr.heap.items, &floatMergeHeapItem{itr: bufInput, index: i})
 	}
 
 	return itr
@@ -206,7 +220,7 @@ func (itr *floatMergeIterator) Next() (*FloatPoint, error) {
 			}
 			tags := p.Tags.Subset(itr.heap.opt.Dimensions)
 			itr.window.name, itr.window.tags = p.Name, tags.ID()
-			itr.window.startTime, itr.window.endTime = itr.heap.opt.Window(p.Time)
+			itr.window.startTime, itr.window.endTime = itr.heap.opt.windowBounds(itr.heap.opt.Window(p.Time))
 			return p, nil
 		}
 
@@ -282,6 +296,12 @@ func (h *floatMergeHeap) Less(i, j int) bool {
 	xt, _ := h.opt.Window(x.Time)
 	yt, _ := h.opt.Window(y.Time)
 
+	// Break ties by input when requested so points from series that have
+	// the same tags after projection are always merged in the same order.
+	if xt == yt && h.opt.StableMerge {
+		return h.items[i].index < h.items[j].index
+	}
+
 	if h.opt.Ascending {
 		return xt < yt
 	}
@@ -301,7 +321,8 @@ func (h *floatMergeHeap) Pop() interface{} {
 }
 
 type floatMergeHeapItem struct {
-	itr *bufFloatIterator
+	itr   *bufFloatIterator
+	index int
 }
 
 // floatSortedMergeIterator is an iterator that sorts and merges multiple iterators into one.
@@ -322,9 +343,9 @@ func newFloatSortedMergeIterator(inputs []FloatIterator, opt IteratorOptions) It
 	}
 
 	// Initialize heap items.
-	for _, input := range inputs {
+	for i, input := range inputs {
 		// Append to the heap.
-		itr.heap.items = append(itr.heap.items, &floatSortedMergeHeapItem{itr: input})
+		itr.heap.items = append(itr.heap.items, &floatSortedMergeHeapItem{itr: input, index: i})
 	}
 
 	return itr
@@ -410,6 +431,9 @@ func (h *floatSortedMergeHeap) Less(i, j int) bool {
 		} else if xTags, yTags := x.Tags.Subset(h.opt.Dimensions), y.Tags.Subset(h.opt.Dimensions); !xTags.Equals(&yTags) {
 			return xTags.ID() < yTags.ID()
 		}
+		if x.Time == y.Time && h.opt.StableMerge {
+			return h.items[i].index < h.items[j].index
+		}
 		return x.Time < y.Time
 	}
 
@@ -418,6 +442,9 @@ func (h *floatSortedMergeHeap) Less(i, j int) bool {
 	} else if xTags, yTags := x.Tags.Subset(h.opt.Dimensions), y.Tags.Subset(h.opt.Dimensions); !xTags.Equals(&yTags) {
 		return xTags.ID() > yTags.ID()
 	}
+	if x.Time == y.Time && h.opt.StableMerge {
+		return h.items[i].index < h.items[j].index
+	}
 	return x.Time > y.Time
 }
 
@@ -437,6 +464,7 @@ type floatSortedMergeHeapItem struct {
 	point *FloatPoint
 	err   error
 	itr   FloatIterator
+	index int
 }
 
 // floatParallelIterator represents an iterator that pulls data in a separate goroutine.
@@ -450,10 +478,10 @@ type floatParallelIterator struct {
 }
 
 // newFloatParallelIterator returns a new instance of floatParallelIterator.
-func newFloatParallelIterator(input FloatIterator) *floatParallelIterator {
+func newFloatParallelIterator(input FloatIterator, size int) *floatParallelIterator {
 	itr := &floatParallelIterator{
 		input:   input,
-		ch:      make(chan floatPointError, 256),
+		ch:      make(chan floatPointError, size),
 		closing: make(chan struct{}),
 	}
 	itr.wg.Add(1)
@@ -505,6 +533,92 @@ type floatPointError struct {
 	err   error
 }
 
+// floatBufferedIterator represents an iterator that reads all of its input
+// in a separate goroutine without waiting for the points to be read.
+type floatBufferedIterator struct {
+	input FloatIterator
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	points []*FloatPoint
+	err    error
+	done   bool
+	closed bool
+
+	wg sync.WaitGroup
+}
+
+// newFloatBufferedIterator returns a new instance of floatBufferedIterator.
+func newFloatBufferedIterator(input FloatIterator) *floatBufferedIterator {
+	itr := &floatBufferedIterator{input: input}
+	itr.cond = sync.NewCond(&itr.mu)
+	itr.wg.Add(1)
+	go itr.monitor()
+	return itr
+}
+
+// Stats returns stats from the underlying iterator.
+func (itr *floatBufferedIterator) Stats() IteratorStats { return itr.input.Stats() }
+
+// Close closes the underlying iterator and waits for the goroutine to exit.
+func (itr *floatBufferedIterator) Close() error {
+	itr.mu.Lock()
+	itr.closed, itr.points = true, nil
+	itr.cond.Broadcast()
+	itr.mu.Unlock()
+
+	err := itr.input.Close()
+	itr.wg.Wait()
+	return err
+}
+
+// Next returns the next point from the iterator.
+func (itr *floatBufferedIterator) Next() (*FloatPoint, error) {
+	itr.mu.Lock()
+	defer itr.mu.Unlock()
+
+	for len(itr.points) == 0 && !itr.done && !itr.closed {
+		itr.cond.Wait()
+	}
+	if len(itr.points) == 0 {
+		return nil, itr.err
+	}
+
+	p := itr.points[0]
+	itr.points[0] = nil
+	itr.points = itr.points[1:]
+	return p, nil
+}
+
+// monitor runs in a separate goroutine and reads the input until it is done.
+func (itr *floatBufferedIterator) monitor() {
+	defer itr.wg.Done()
+
+	for {
+		p, err := itr.input.Next()
+		if p != nil {
+			p = p.Clone()
+		}
+
+		itr.mu.Lock()
+		if itr.closed {
+			itr.mu.Unlock()
+			return
+		} else if p == nil || err != nil {
+			itr.err, itr.done = err, true
+		} else {
+			itr.points = append(itr.points, p)
+		}
+		done := itr.done
+		itr.cond.Signal()
+		itr.mu.Unlock()
+
+		if done {
+			return
+		}
+	}
+}
+
 // floatLimitIterator represents an iterator that limits points per group.
 type floatLimitIterator struct {
 	input FloatIterator
@@ -531,6 +645,9 @@ func (itr *floatLimitIterator) Stats() IteratorStats { return itr.input.Stats()
 // Close closes the underlying iterators.
 func (itr *floatLimitIterator) Close() error { return itr.input.Close() }
 
+// filled returns true if the last point was generated by a fill.
+func (itr *floatLimitIterator) filled() bool { return isFilled(itr.input) }
+
 // Next returns the next point from the iterator.
 func (itr *floatLimitIterator) Next() (*FloatPoint, error) {
 	for {
@@ -564,13 +681,14 @@ func (itr *floatLimitIterator) Next() (*FloatPoint, error) {
 }
 
 type floatFillIterator struct {
-	input     *bufFloatIterator
-	prev      FloatPoint
-	startTime int64
-	endTime   int64
-	auxFields []interface{}
-	init      bool
-	opt       IteratorOptions
+	input      *bufFloatIterator
+	prev       FloatPoint
+	startTime  int64
+	endTime    int64
+	auxFields  []interface{}
+	init       bool
+	lastFilled bool
+	opt        IteratorOptions
 
 	window struct {
 		name string
@@ -614,6 +732,9 @@ func newFloatFillIterator(input FloatIterator, expr Expr, opt IteratorOptions) *
 func (itr *floatFillIterator) Stats() IteratorStats { return itr.input.Stats() }
 func (itr *floatFillIterator) Close() error         { return itr.input.Close() }
 
+// filled returns true if the last point was generated by a fill.
+func (itr *floatFillIterator) filled() bool { return itr.lastFilled }
+
 func (itr *floatFillIterator) Next() (*FloatPoint, error) {
 	if !itr.init {
 		p, err := itr.input.peek()
@@ -666,6 +787,7 @@ func (itr *floatFillIterator) Next() (*FloatPoint, error) {
 		if p != nil {
 			itr.input.unread(p)
 		}
+		itr.lastFilled = true
 
 		p = &FloatPoint{
 			Name: itr.window.name,
@@ -702,9 +824,20 @@ func (itr *floatFillIterator) Next() (*FloatPoint, error) {
 			} else {
 				p.Nil = true
 			}
+		case NextFill:
+			next, err := itr.input.peek()
+			if err != nil {
+				return nil, err
+			} else if next != nil && next.Name == itr.window.name && next.Tags.ID() == itr.window.tags.ID() {
+				p.Value = next.Value
+				p.Nil = next.Nil
+			} else {
+				p.Nil = true
+			}
 		}
 	} else {
 		itr.prev = *p
+		itr.lastFilled = false
 	}
 
 	// Advance the expected time. Do not advance to a new window here
@@ -715,6 +848,14 @@ func (itr *floatFillIterator) Next() (*FloatPoint, error) {
 	} else {
 		itr.window.time = p.Time - int64(itr.opt.Interval.Duration)
 	}
+
+	// Keep the expected time on a window edge if the zone offset changes
+	// before it, such as for daylight saving time.
+	if itr.opt.Location != nil {
+		if o := itr.opt.zoneOffset(p.Time) - itr.opt.zoneOffset(itr.window.time); o != 0 && abs(o) < int64(itr.opt.Interval.Duration) {
+			itr.window.time += o
+		}
+	}
 	return p, nil
 }
 
@@ -758,6 +899,7 @@ func newFloatInterruptIterator(input FloatIterator, closing <-chan struct{}) *fl
 
 func (itr *floatInterruptIterator) Stats() IteratorStats { return itr.input.Stats() }
 func (itr *floatInterruptIterator) Close() error         { return itr.input.Close() }
+func (itr *floatInterruptIterator) filled() bool         { return isFilled(itr.input) }
 
 func (itr *floatInterruptIterator) Next() (*FloatPoint, error) {
 	// Only check if the channel is closed every N points. This
@@ -833,8 +975,9 @@ func (itr *floatCloseInterruptIterator) Next() (*FloatPoint, error) {
 
 // auxFloatPoint represents a combination of a point and an error for the AuxIterator.
 type auxFloatPoint struct {
-	point *FloatPoint
-	err   error
+	point  *FloatPoint
+	filled bool
+	err    error
 }
 
 // floatAuxIterator represents a float implementation of AuxIterator.
@@ -843,14 +986,17 @@ type floatAuxIterator struct {
 	output     chan auxFloatPoint
 	fields     *auxIteratorFields
 	background bool
+	lastFilled bool
 }
 
 func newFloatAuxIterator(input FloatIterator, opt IteratorOptions) *floatAuxIterator {
-	return &floatAuxIterator{
+	itr := &floatAuxIterator{
 		input:  newBufFloatIterator(input),
 		output: make(chan auxFloatPoint, 1),
 		fields: newAuxIteratorFields(opt),
 	}
+	itr.fields.stats = itr.input.Stats
+	return itr
 }
 
 func (itr *floatAuxIterator) Background() {
@@ -864,8 +1010,10 @@ func (itr *floatAuxIterator) Stats() IteratorStats { return itr.input.Stats() }
 func (itr *floatAuxIterator) Close() error         { return itr.input.Close() }
 func (itr *floatAuxIterator) Next() (*FloatPoint, error) {
 	p := <-itr.output
+	itr.lastFilled = p.filled
 	return p.point, p.err
 }
+func (itr *floatAuxIterator) filled() bool { return itr.lastFilled }
 func (itr *floatAuxIterator) Iterator(name string, typ DataType) Iterator {
 	return itr.fields.iterator(name, typ)
 }
@@ -883,8 +1031,9 @@ func (itr *floatAuxIterator) stream() {
 		}
 
 		// Send point to output and to each field iterator.
-		itr.output <- auxFloatPoint{point: p}
-		if ok := itr.fields.send(p); !ok && itr.background {
+		filled := itr.input.filled()
+		itr.output <- auxFloatPoint{point: p, filled: filled}
+		if ok := itr.fields.send(p, filled); !ok && itr.background {
 			break
 		}
 	}
@@ -899,13 +1048,23 @@ type floatChanIterator struct {
 		i      int
 		filled bool
 		points [2]FloatPoint
+
+		// fill is true if the buffered point was generated by a fill.
+		fill bool
 	}
-	err  error
-	cond *sync.Cond
-	done bool
+	err        error
+	cond       *sync.Cond
+	done       bool
+	stats      func() IteratorStats
+	lastFilled bool
 }
 
-func (itr *floatChanIterator) Stats() IteratorStats { return IteratorStats{} }
+func (itr *floatChanIterator) Stats() IteratorStats {
+	if itr.stats == nil {
+		return IteratorStats{}
+	}
+	return itr.stats()
+}
 
 func (itr *floatChanIterator) Close() error {
 	itr.cond.L.Lock()
@@ -917,7 +1076,7 @@ func (itr *floatChanIterator) Close() error {
 	return nil
 }
 
-func (itr *floatChanIterator) setBuf(name string, tags Tags, time int64, value interface{}) bool {
+func (itr *floatChanIterator) setBuf(name string, tags Tags, time int64, value interface{}, fill bool) bool {
 	itr.cond.L.Lock()
 	defer itr.cond.L.Unlock()
 
@@ -944,6 +1103,7 @@ func (itr *floatChanIterator) setBuf(name string, tags Tags, time int64, value i
 	default:
 		itr.buf.points[itr.buf.i] = FloatPoint{Name: name, Tags: tags, Time: time, Nil: true}
 	}
+	itr.buf.fill = fill
 	itr.buf.filled = true
 
 	// Signal to all waiting goroutines that a new value is ready to read.
@@ -986,10 +1146,14 @@ func (itr *floatChanIterator) Next() (*FloatPoint, error) {
 	p := &itr.buf.points[itr.buf.i]
 	itr.buf.i = (itr.buf.i + 1) % len(itr.buf.points)
 	itr.buf.filled = false
+	itr.lastFilled = itr.buf.fill
 	itr.cond.Signal()
 	return p, nil
 }
 
+// filled returns true if the last point was generated by a fill.
+func (itr *floatChanIterator) filled() bool { return itr.lastFilled }
+
 // floatReduceFloatIterator executes a reducer for every interval and buffers the result.
 type floatReduceFloatIterator struct {
 	input  *bufFloatIterator
@@ -1037,6 +1201,9 @@ type floatReduceFloatPoint struct {
 	Tags       Tags
 	Aggregator FloatPointAggregator
 	Emitter    FloatPointEmitter
+
+	// Nil is true while only null points were read for the group.
+	Nil bool
 }
 
 // reduce executes fn once for every point in the next window.
@@ -1048,7 +1215,7 @@ func (itr *floatReduceFloatIterator) reduce() ([]FloatPoint, error) {
 		p, err := itr.input.Next()
 		if err != nil || p == nil {
 			return nil, err
-		} else if p.Nil {
+		} else if p.Nil && !itr.opt.KeepEmpty {
 			continue
 		}
 
@@ -1062,12 +1229,12 @@ func (itr *floatReduceFloatIterator) reduce() ([]FloatPoint, error) {
 	m := make(map[string]*floatReduceFloatPoint)
 	for {
 		// Read next point.
-		curr, err := itr.input.NextInWindow(startTime, endTime)
+		curr, err := itr.input.NextInWindow(itr.opt.windowBounds(startTime, endTime))
 		if err != nil {
 			return nil, err
 		} else if curr == nil {
 			break
-		} else if curr.Nil {
+		} else if curr.Nil && !itr.opt.KeepEmpty {
 			continue
 		}
 		tags := curr.Tags.Subset(itr.dims)
@@ -1086,10 +1253,15 @@ func (itr *floatReduceFloatIterator) reduce() ([]FloatPoint, error) {
 				Tags:       tags,
 				Aggregator: aggregator,
 				Emitter:    emitter,
+				Nil:        true,
 			}
 			m[id] = rp
 		}
+		if curr.Nil {
+			continue
+		}
 		rp.Aggregator.AggregateFloat(curr)
+		rp.Nil = false
 	}
 
 	// Reverse sort points by name & tag.
@@ -1106,7 +1278,12 @@ func (itr *floatReduceFloatIterator) reduce() ([]FloatPoint, error) {
 	a := make([]FloatPoint, 0, len(m))
 	for _, k := range keys {
 		rp := m[k]
-		points := rp.Emitter.Emit()
+		var points []FloatPoint
+		if rp.Nil {
+			points = []FloatPoint{{Time: ZeroTime, Nil: true}}
+		} else {
+			points = rp.Emitter.Emit()
+		}
 		for i := len(points) - 1; i >= 0; i-- {
 			points[i].Name = rp.Name
 			points[i].Tags = rp.Tags
@@ -1136,6 +1313,10 @@ type floatStreamFloatIterator struct {
 	opt    IteratorOptions
 	m      map[string]*floatReduceFloatPoint
 	points []FloatPoint
+
+	// pointsFilled is true if the buffered points were emitted for an
+	// input point that was generated by a fill.
+	pointsFilled bool
 }
 
 // newFloatStreamFloatIterator returns a new instance of floatStreamFloatIterator.
@@ -1155,6 +1336,10 @@ func (itr *floatStreamFloatIterator) Stats() IteratorStats { return itr.input.St
 // Close closes the iterator and all child iterators.
 func (itr *floatStreamFloatIterator) Close() error { return itr.input.Close() }
 
+// filled returns true if the last point was emitted for an input point that
+// was generated by a fill.
+func (itr *floatStreamFloatIterator) filled() bool { return itr.pointsFilled }
+
 // Next returns the next value for the stream iterator.
 func (itr *floatStreamFloatIterator) Next() (*FloatPoint, error) {
 	// Calculate next window if we have no more points.
@@ -1214,6 +1399,7 @@ func (itr *floatStreamFloatIterator) reduce() ([]FloatPoint, error) {
 			points[i].Name = rp.Name
 			points[i].Tags = rp.Tags
 		}
+		itr.pointsFilled = itr.input.filled()
 		return points, nil
 	}
 }
@@ -1226,12 +1412,16 @@ type floatExprIterator struct {
 	fn        floatExprFunc
 	points    []FloatPoint // must be size 2
 	storePrev bool
+
+	// lastFilled is true if the last point was computed from a point
+	// generated by a fill, either by the inputs or by this iterator.
+	lastFilled bool
 }
 
 func newFloatExprIterator(left, right FloatIterator, opt IteratorOptions, fn func(a, b float64) float64) *floatExprIterator {
 	var points []FloatPoint
 	switch opt.Fill {
-	case NullFill, PreviousFill:
+	case NullFill, PreviousFill, NextFill:
 		points = []FloatPoint{{Nil: true}, {Nil: true}}
 	case NumberFill:
 		value := castToFloat(opt.FillValue)
@@ -1258,6 +1448,9 @@ func (itr *floatExprIterator) Close() error {
 	return nil
 }
 
+// filled returns true if the last point was generated by a fill.
+func (itr *floatExprIterator) filled() bool { return itr.lastFilled }
+
 func (itr *floatExprIterator) Next() (*FloatPoint, error) {
 	for {
 		a, b, err := itr.next()
@@ -1270,6 +1463,9 @@ func (itr *floatExprIterator) Next() (*FloatPoint, error) {
 			continue
 		}
 
+		// A missing point is filled below, so the result counts as filled too.
+		itr.lastFilled = a == nil || b == nil || itr.left.filled() || itr.right.filled()
+
 		// If one of the two points is nil, we need to fill it with a fake nil
 		// point that has the same name, tags, and time as the other point.
 		// There should never be a time when both of these are nil.
@@ -1405,6 +1601,9 @@ type floatReduceIntegerPoint struct {
 	Tags       Tags
 	Aggregator FloatPointAggregator
 	Emitter    IntegerPointEmitter
+
+	// Nil is true while only null points were read for the group.
+	Nil bool
 }
 
 // reduce executes fn once for every point in the next window.
@@ -1416,7 +1615,7 @@ func (itr *floatReduceIntegerIterator) reduce() ([]IntegerPoint, error) {
 		p, err := itr.input.Next()
 		if err != nil || p == nil {
 			return nil, err
-		} else if p.Nil {
+		} else if p.Nil && !itr.opt.KeepEmpty {
 			continue
 		}
 
@@ -1430,12 +1629,12 @@ func (itr *floatReduceIntegerIterator) reduce() ([]IntegerPoint, error) {
 	m := make(map[string]*floatReduceIntegerPoint)
 	for {
 		// Read next point.
-		curr, err := itr.input.NextInWindow(startTime, endTime)
+		curr, err := itr.input.NextInWindow(itr.opt.windowBounds(startTime, endTime))
 		if err != nil {
 			return nil, err
 		} else if curr == nil {
 			break
-		} else if curr.Nil {
+		} else if curr.Nil && !itr.opt.KeepEmpty {
 			continue
 		}
 		tags := curr.Tags.Subset(itr.dims)
@@ -1454,10 +1653,15 @@ func (itr *floatReduceIntegerIterator) reduce() ([]IntegerPoint, error) {
 				Tags:       tags,
 				Aggregator: aggregator,
 				Emitter:    emitter,
+				Nil:        true,
 			}
 			m[id] = rp
 		}
+		if curr.Nil {
+			continue
+		}
 		rp.Aggregator.AggregateFloat(curr)
+		rp.Nil = false
 	}
 
 	// Reverse sort points by name & tag.
@@ -1474,7 +1678,12 @@ func (itr *floatReduceIntegerIterator) reduce() ([]IntegerPoint, error) {
 	a := make([]IntegerPoint, 0, len(m))
 	for _, k := range keys {
 		rp := m[k]
-		points := rp.Emitter.Emit()
+		var points []IntegerPoint
+		if rp.Nil {
+			points = []IntegerPoint{{Time: ZeroTime, Nil: true}}
+		} else {
+			points = rp.Emitter.Emit()
+		}
 		for i := len(points) - 1; i >= 0; i-- {
 			points[i].Name = rp.Name
 			points[i].Tags = rp.Tags
@@ -1504,6 +1713,10 @@ type floatStreamIntegerIterator struct {
 	opt    IteratorOptions
 	m      map[string]*floatReduceIntegerPoint
 	points []IntegerPoint
+
+	// pointsFilled is true if the buffered points were emitted for an
+	// input point that was generated by a fill.
+	pointsFilled bool
 }
 
 // newFloatStreamIntegerIterator returns a new instance of floatStreamIntegerIterator.
@@ -1523,6 +1736,10 @@ func (itr *floatStreamIntegerIterator) Stats() IteratorStats { return itr.input.
 // Close closes the iterator and all child iterators.
 func (itr *floatStreamIntegerIterator) Close() error { return itr.input.Close() }
 
+// filled returns true if the last point was emitted for an input point that
+// was generated by a fill.
+func (itr *floatStreamIntegerIterator) filled() bool { return itr.pointsFilled }
+
 // Next returns the next value for the stream iterator.
 func (itr *floatStreamIntegerIterator) Next() (*IntegerPoint, error) {
 	// Calculate next window if we have no more points.
@@ -1582,6 +1799,7 @@ func (itr *floatStreamIntegerIterator) reduce() ([]IntegerPoint, error) {
 			points[i].Name = rp.Name
 			points[i].Tags = rp.Tags
 		}
+		itr.pointsFilled = itr.input.filled()
 		return points, nil
 	}
 }
@@ -1594,12 +1812,16 @@ type floatIntegerExprIterator struct {
 	fn        floatIntegerExprFunc
 	points    []FloatPoint // must be size 2
 	storePrev bool
+
+	// lastFilled is true if the last point was computed from a point
+	// generated by a fill, either by the inputs or by this iterator.
+	lastFilled bool
 }
 
 func newFloatIntegerExprIterator(left, right FloatIterator, opt IteratorOptions, fn func(a, b float64) int64) *floatIntegerExprIterator {
 	var points []FloatPoint
 	switch opt.Fill {
-	case NullFill, PreviousFill:
+	case NullFill, PreviousFill, NextFill:
 		points = []FloatPoint{{Nil: true}, {Nil: true}}
 	case NumberFill:
 		value := castToFloat(opt.FillValue)
@@ -1626,6 +1848,9 @@ func (itr *floatIntegerExprIterator) Close() error {
 	return nil
 }
 
+// filled returns true if the last point was generated by a fill.
+func (itr *floatIntegerExprIterator) filled() bool { return itr.lastFilled }
+
 func (itr *floatIntegerExprIterator) Next() (*IntegerPoint, error) {
 	for {
 		a, b, err := itr.next()
@@ -1638,6 +1863,9 @@ func (itr *floatIntegerExprIterator) Next() (*IntegerPoint, error) {
 			continue
 		}
 
+		// A missing point is filled below, so the result counts as filled too.
+		itr.lastFilled = a == nil || b == nil || itr.left.filled() || itr.right.filled()
+
 		// If one of the two points is nil, we need to fill it with a fake nil
 		// point that has the same name, tags, and time as the other point.
 		// There should never be a time when both of these are nil.
@@ -1777,6 +2005,9 @@ type floatReduceStringPoint struct {
 	Tags       Tags
 	Aggregator FloatPointAggregator
 	Emitter    StringPointEmitter
+
+	// Nil is true while only null points were read for the group.
+	Nil bool
 }
 
 // reduce executes fn once for every point in the next window.
@@ -1788,7 +2019,7 @@ func (itr *floatReduceStringIterator) reduce() ([]StringPoint, error) {
 		p, err := itr.input.Next()
 		if err != nil || p == nil {
 			return nil, err
-		} else if p.Nil {
+		} else if p.Nil && !itr.opt.KeepEmpty {
 			continue
 		}
 
@@ -1802,12 +2033,12 @@ func (itr *floatReduceStringIterator) reduce() ([]StringPoint, error) {
 	m := make(map[string]*floatReduceStringPoint)
 	for {
 		// Read next point.
-		curr, err := itr.input.NextInWindow(startTime, endTime)
+		curr, err := itr.input.NextInWindow(itr.opt.windowBounds(startTime, endTime))
 		if err != nil {
 			return nil, err
 		} else if curr == nil {
 			break
-		} else if curr.Nil {
+		} else if curr.Nil && !itr.opt.KeepEmpty {
 			continue
 		}
 		tags := curr.Tags.Subset(itr.dims)
@@ -1826,10 +2057,15 @@ func (itr *floatReduceStringIterator) reduce() ([]StringPoint, error) {
 				Tags:       tags,
 				Aggregator: aggregator,
 				Emitter:    emitter,
+				Nil:        true,
 			}
 			m[id] = rp
 		}
+		if curr.Nil {
+			continue
+		}
 		rp.Aggregator.AggregateFloat(curr)
+		rp.Nil = false
 	}
 
 	// Reverse sort points by name & tag.
@@ -1846,7 +2082,12 @@ func (itr *floatReduceStringIterator) reduce() ([]StringPoint, error) {
 	a := make([]StringPoint, 0, len(m))
 	for _, k := range keys {
 		rp := m[k]
-		points := rp.Emitter.Emit()
+		var points []StringPoint
+		if rp.Nil {
+			points = []StringPoint{{Time: ZeroTime, Nil: true}}
+		} else {
+			points = rp.Emitter.Emit()
+		}
 		for i := len(points) - 1; i >= 0; i-- {
 			points[i].Name = rp.Name
 			points[i].Tags = rp.Tags
@@ -1876,6 +2117,10 @@ type floatStreamStringIterator struct {
 	opt    IteratorOptions
 	m      map[string]*floatReduceStringPoint
 	points []StringPoint
+
+	// pointsFilled is true if the buffered points were emitted for an
+	// input point that was generated by a fill.
+	pointsFilled bool
 }
 
 // newFloatStreamStringIterator returns a new instance of floatStreamStringIterator.
@@ -1895,6 +2140,10 @@ func (itr *floatStreamStringIterator) Stats() IteratorStats { return itr.input.S
 // Close closes the iterator and all child iterators.
 func (itr *floatStreamStringIterator) Close() error { return itr.input.Close() }
 
+// filled returns true if the last point was emitted for an input point that
+// was generated by a fill.
+func (itr *floatStreamStringIterator) filled() bool { return itr.pointsFilled }
+
 // Next returns the next value for the stream iterator.
 func (itr *floatStreamStringIterator) Next() (*StringPoint, error) {
 	// Calculate next window if we have no more points.
@@ -1954,6 +2203,7 @@ func (itr *floatStreamStringIterator) reduce() ([]StringPoint, error) {
 			points[i].Name = rp.Name
 			points[i].Tags = rp.Tags
 		}
+		itr.pointsFilled = itr.input.filled()
 		return points, nil
 	}
 }
@@ -1966,12 +2216,16 @@ type floatStringExprIterator struct {
 	fn        floatStringExprFunc
 	points    []FloatPoint // must be size 2
 	storePrev bool
+
+	// lastFilled is true if the last point was computed from a point
+	// generated by a fill, either by the inputs or by this iterator.
+	lastFilled bool
 }
 
 func newFloatStringExprIterator(left, right FloatIterator, opt IteratorOptions, fn func(a, b float64) string) *floatStringExprIterator {
 	var points []FloatPoint
 	switch opt.Fill {
-	case NullFill, PreviousFill:
+	case NullFill, PreviousFill, NextFill:
 		points = []FloatPoint{{Nil: true}, {Nil: true}}
 	case NumberFill:
 		value := castToFloat(opt.FillValue)
@@ -1998,6 +2252,9 @@ func (itr *floatStringExprIterator) Close() error {
 	return nil
 }
 
+// filled returns true if the last point was generated by a fill.
+func (itr *floatStringExprIterator) filled() bool { return itr.lastFilled }
+
 func (itr *floatStringExprIterator) Next() (*StringPoint, error) {
 	for {
 		a, b, err := itr.next()
@@ -2010,6 +2267,9 @@ func (itr *floatStringExprIterator) Next() (*StringPoint, error) {
 			continue
 		}
 
+		// A missing point is filled below, so the result counts as filled too.
+		itr.lastFilled = a == nil || b == nil || itr.left.filled() || itr.right.filled()
+
 		// If one of the two points is nil, we need to fill it with a fake nil
 		// point that has the same name, tags, and time as the other point.
 		// There should never be a time when both of these are nil.
@@ -2149,6 +2409,9 @@ type floatReduceBooleanPoint struct {
 	Tags       Tags
 	Aggregator FloatPointAggregator
 	Emitter    BooleanPointEmitter
+
+	// Nil is true while only null points were read for the group.
+	Nil bool
 }
 
 // reduce executes fn once for every point in the next window.
@@ -2160,7 +2423,7 @@ func (itr *floatReduceBooleanIterator) reduce() ([]BooleanPoint, error) {
 		p, err := itr.input.Next()
 		if err != nil || p == nil {
 			return nil, err
-		} else if p.Nil {
+		} else if p.Nil && !itr.opt.KeepEmpty {
 			continue
 		}
 
@@ -2174,12 +2437,12 @@ func (itr *floatReduceBooleanIterator) reduce() ([]BooleanPoint, error) {
 	m := make(map[string]*floatReduceBooleanPoint)
 	for {
 		// Read next point.
-		curr, err := itr.input.NextInWindow(startTime, endTime)
+		curr, err := itr.input.NextInWindow(itr.opt.windowBounds(startTime, endTime))
 		if err != nil {
 			return nil, err
 		} else if curr == nil {
 			break
-		} else if curr.Nil {
+		} else if curr.Nil && !itr.opt.KeepEmpty {
 			continue
 		}
 		tags := curr.Tags.Subset(itr.dims)
@@ -2198,10 +2461,15 @@ func (itr *floatReduceBooleanIterator) reduce() ([]BooleanPoint, error) {
 				Tags:       tags,
 				Aggregator: aggregator,
 				Emitter:    emitter,
+				Nil:        true,
 			}
 			m[id] = rp
 		}
+		if curr.Nil {
+			continue
+		}
 		rp.Aggregator.AggregateFloat(curr)
+		rp.Nil = false
 	}
 
 	// Reverse sort points by name & tag.
@@ -2218,7 +2486,12 @@ func (itr *floatReduceBooleanIterator) reduce() ([]BooleanPoint, error) {
 	a := make([]BooleanPoint, 0, len(m))
 	for _, k := range keys {
 		rp := m[k]
-		points := rp.Emitter.Emit()
+		var points []BooleanPoint
+		if rp.Nil {
+			points = []BooleanPoint{{Time: ZeroTime, Nil: true}}
+		} else {
+			points = rp.Emitter.Emit()
+		}
 		for i := len(points) - 1; i >= 0; i-- {
 			points[i].Name = rp.Name
 			points[i].Tags = rp.Tags
@@ -2248,6 +2521,10 @@ type floatStreamBooleanIterator struct {
 	opt    IteratorOptions
 	m      map[string]*floatReduceBooleanPoint
 	points []BooleanPoint
+
+	// pointsFilled is true if the buffered points were emitted for an
+	// input point that was generated by a fill.
+	pointsFilled bool
 }
 
 // newFloatStreamBooleanIterator returns a new instance of floatStreamBooleanIterator.
@@ -2267,6 +2544,10 @@ func (itr *floatStreamBooleanIterator) Stats() IteratorStats { return itr.input.
 // Close closes the iterator and all child iterators.
 func (itr *floatStreamBooleanIterator) Close() error { return itr.input.Close() }
 
+// filled returns true if the last point was emitted for an input point that
+// was generated by a fill.
+func (itr *floatStreamBooleanIterator) filled() bool { return itr.pointsFilled }
+
 // Next returns the next value for the stream iterator.
 func (itr *floatStreamBooleanIterator) Next() (*BooleanPoint, error) {
 	// Calculate next window if we have no more points.
@@ -2326,6 +2607,7 @@ func (itr *floatStreamBooleanIterator) reduce() ([]BooleanPoint, error) {
 			points[i].Name = rp.Name
 			points[i].Tags = rp.Tags
 		}
+		itr.pointsFilled = itr.input.filled()
 		return points, nil
 	}
 }
@@ -2338,12 +2620,16 @@ type floatBooleanExprIterator struct {
 	fn        floatBooleanExprFunc
 	points    []FloatPoint // must be size 2
 	storePrev bool
+
+	// lastFilled is true if the last point was computed from a point
+	// generated by a fill, either by the inputs or by this iterator.
+	lastFilled bool
 }
 
 func newFloatBooleanExprIterator(left, right FloatIterator, opt IteratorOptions, fn func(a, b float64) bool) *floatBooleanExprIterator {
 	var points []FloatPoint
 	switch opt.Fill {
-	case NullFill, PreviousFill:
+	case NullFill, PreviousFill, NextFill:
 		points = []FloatPoint{{Nil: true}, {Nil: true}}
 	case NumberFill:
 		value := castToFloat(opt.FillValue)
@@ -2370,6 +2656,9 @@ func (itr *floatBooleanExprIterator) Close() error {
 	return nil
 }
 
+// filled returns true if the last point was generated by a fill.
+func (itr *floatBooleanExprIterator) filled() bool { return itr.lastFilled }
+
 func (itr *floatBooleanExprIterator) Next() (*BooleanPoint, error) {
 	for {
 		a, b, err := itr.next()
@@ -2382,6 +2671,9 @@ func (itr *floatBooleanExprIterator) Next() (*BooleanPoint, error) {
 			continue
 		}
 
+		// A missing point is filled below, so the result counts as filled too.
+		itr.lastFilled = a == nil || b == nil || itr.left.filled() || itr.right.filled()
+
 		// If one of the two points is nil, we need to fill it with a fake nil
 		// point that has the same name, tags, and time as the other point.
 		// There should never be a time when both of these are nil.
@@ -2487,6 +2779,9 @@ func (itr *floatTransformIterator) Stats() IteratorStats { return itr.input.Stat
 // Close closes the iterator and all child iterators.
 func (itr *floatTransformIterator) Close() error { return itr.input.Close() }
 
+// filled returns true if the last point was generated by a fill.
+func (itr *floatTransformIterator) filled() bool { return isFilled(itr.input) }
+
 // Next returns the minimum value for the next available interval.
 func (itr *floatTransformIterator) Next() (*FloatPoint, error) {
 	p, err := itr.input.Next()
@@ -2516,6 +2811,9 @@ func (itr *floatBoolTransformIterator) Stats() IteratorStats { return itr.input.
 // Close closes the iterator and all child iterators.
 func (itr *floatBoolTransformIterator) Close() error { return itr.input.Close() }
 
+// filled returns true if the last point was generated by a fill.
+func (itr *floatBoolTransformIterator) filled() bool { return isFilled(itr.input) }
+
 // Next returns the minimum value for the next available interval.
 func (itr *floatBoolTransformIterator) Next() (*BooleanPoint, error) {
 	p, err := itr.input.Next()
@@ -2640,6 +2938,46 @@ func (itr *floatDedupeIterator) Next() (*FloatPoint, error) {
 	}
 }
 
+// floatTimeDedupeIterator only outputs the first point for each series
+// and timestamp. It is used to drop the rows repeated by subqueries that
+// overlap and, like the DedupeIterator, keeps every key it has seen.
+type floatTimeDedupeIterator struct {
+	input FloatIterator
+	m     map[timeDedupeKey]struct{} // lookup of series and times already sent
+}
+
+// newFloatTimeDedupeIterator returns a new instance of floatTimeDedupeIterator.
+func newFloatTimeDedupeIterator(input FloatIterator) *floatTimeDedupeIterator {
+	return &floatTimeDedupeIterator{
+		input: input,
+		m:     make(map[timeDedupeKey]struct{}),
+	}
+}
+
+// Stats returns stats from the input iterator.
+func (itr *floatTimeDedupeIterator) Stats() IteratorStats { return itr.input.Stats() }
+
+// Close closes the iterator and all child iterators.
+func (itr *floatTimeDedupeIterator) Close() error { return itr.input.Close() }
+
+// Next returns the next point from the input iterator whose series and time
+// have not been output yet.
+func (itr *floatTimeDedupeIterator) Next() (*FloatPoint, error) {
+	for {
+		p, err := itr.input.Next()
+		if p == nil || err != nil {
+			return nil, err
+		}
+
+		key := timeDedupeKey{name: p.Name, tags: p.Tags.ID(), time: p.Time}
+		if _, ok := itr.m[key]; ok {
+			continue
+		}
+		itr.m[key] = struct{}{}
+		return p, nil
+	}
+}
+
 // floatReaderIterator represents an iterator that streams from a reader.
 type floatReaderIterator struct {
 	r   io.Reader
@@ -2709,6 +3047,11 @@ func newIntegerIterators(itrs []Iterator) []IntegerIterator {
 type bufIntegerIterator struct {
 	itr IntegerIterator
 	buf *IntegerPoint
+
+	// lastFilled and bufFilled record whether the last returned point and
+	// the buffered point were generated by a fill.
+	lastFilled bool
+	bufFilled  bool
 }
 
 // newBufIntegerIterator returns a buffered IntegerIterator.
@@ -2747,9 +3090,12 @@ func (itr *bufIntegerIterator) Next() (*IntegerPoint, error) {
 	buf := itr.buf
 	if buf != nil {
 		itr.buf = nil
+		itr.lastFilled = itr.bufFilled
 		return buf, nil
 	}
-	return itr.itr.Next()
+	p, err := itr.itr.Next()
+	itr.lastFilled = isFilled(itr.itr)
+	return p, err
 }
 
 // NextInWindow returns the next value if it is between [startTime, endTime).
@@ -2766,7 +3112,13 @@ func (itr *bufIntegerIterator) NextInWindow(startTime, endTime int64) (*IntegerP
 }
 
 // unread sets v to the buffer. It is read on the next call to Next().
-func (itr *bufIntegerIterator) unread(v *IntegerPoint) { itr.buf = v }
+func (itr *bufIntegerIterator) unread(v *IntegerPoint) {
+	itr.buf = v
+	itr.bufFilled = itr.lastFilled
+}
+
+// filled returns true if the last point was generated by a fill.
+func (itr *bufIntegerIterator) filled() bool { return itr.lastFilled }
 
 // integerMergeIterator represents an iterator that combines multiple integer iterators.
 type integerMergeIterator struct {
@@ -2795,12 +3147,12 @@ func newIntegerMergeIterator(inputs []IntegerIterator, opt IteratorOptions) *int
 	}
 
 	// Initialize heap items.
-	for _, input := range inputs {
+	for i, input := range inputs {
 		// Wrap in buffer, ignore any inputs without anymore points.
 		bufInput := newBufIntegerIterator(input)
 
 		// Append to the heap.
-		itr.heap.items = append(itr.heap.items, &integerMergeHeapItem{itr: bufInput})
+		itr.heap.items = append(itr.heap.items, &integerMergeHeapItem{itr: bufInput, index: i})
 	}
 
 	return itr
@@ -2863,7 +3215,7 @@ func (itr *integerMergeIterator) Next() (*IntegerPoint, error) {
 			}
 			tags := p.Tags.Subset(itr.heap.opt.Dimensions)
 			itr.window.name, itr.window.tags = p.Name, tags.ID()
-			itr.window.startTime, itr.window.endTime = itr.heap.opt.Window(p.Time)
+			itr.window.startTime, itr.window.endTime = itr.heap.opt.windowBounds(itr.heap.opt.Window(p.Time))
 			return p, nil
 		}
 
@@ -2939,6 +3291,12 @@ func (h *integerMergeHeap) Less(i, j int) bool {
 	xt, _ := h.opt.Window(x.Time)
 	yt, _ := h.opt.Window(y.Time)
 
+	// Break ties by input when requested so points from series that have
+	// the same tags after projection are always merged in the same order.
+	if xt == yt && h.opt.StableMerge {
+		return h.items[i].index < h.items[j].index
+	}
+
 	if h.opt.Ascending {
 		return xt < yt
 	}
@@ -2958,7 +3316,8 @@ func (h *integerMergeHeap) Pop() interface{} {
 }
 
 type integerMergeHeapItem struct {
-	itr *bufIntegerIterator
+	itr   *bufIntegerIterator
+	index int
 }
 
 // integerSortedMergeIterator is an iterator that sorts and merges multiple iterators into one.
@@ -2979,9 +3338,9 @@ func newIntegerSortedMergeIterator(inputs []IntegerIterator, opt IteratorOptions
 	}
 
 	// Initialize heap items.
-	for _, input := range inputs {
+	for i, input := range inputs {
 		// Append to the heap.
-		itr.heap.items = append(itr.heap.items, &integerSortedMergeHeapItem{itr: input})
+		itr.heap.items = append(itr.heap.items, &integerSortedMergeHeapItem{itr: input, index: i})
 	}
 
 	return itr
@@ -3067,6 +3426,9 @@ func (h *integerSortedMergeHeap) Less(i, j int) bool {
 		} else if xTags, yTags := x.Tags.Subset(h.opt.Dimensions), y.Tags.Subset(h.opt.Dimensions); !xTags.Equals(&yTags) {
 			return xTags.ID() < yTags.ID()
 		}
+		if x.Time == y.Time && h.opt.StableMerge {
+			return h.items[i].index < h.items[j].index
+		}
 		return x.Time < y.Time
 	}
 
@@ -3075,6 +3437,9 @@ func (h *integerSortedMergeHeap) Less(i, j int) bool {
 	} else if xTags, yTags := x.Tags.Subset(h.opt.Dimensions), y.Tags.Subset(h.opt.Dimensions); !xTags.Equals(&yTags) {
 		return xTags.ID() > yTags.ID()
 	}
+	if x.Time == y.Time && h.opt.StableMerge {
+		return h.items[i].index < h.items[j].index
+	}
 	return x.Time > y.Time
 }
 
@@ -3094,6 +3459,7 @@ type integerSortedMergeHeapItem struct {
 	point *IntegerPoint
 	err   error
 	itr   IntegerIterator
+	index int
 }
 
 // integerParallelIterator represents an iterator that pulls data in a separate goroutine.
@@ -3107,10 +3473,10 @@ type integerParallelIterator struct {
 }
 
 // newIntegerParallelIterator returns a new instance of integerParallelIterator.
-func newIntegerParallelIterator(input IntegerIterator) *integerParallelIterator {
+func newIntegerParallelIterator(input IntegerIterator, size int) *integerParallelIterator {
 	itr := &integerParallelIterator{
 		input:   input,
-		ch:      make(chan integerPointError, 256),
+		ch:      make(chan integerPointError, size),
 		closing: make(chan struct{}),
 	}
 	itr.wg.Add(1)
@@ -3162,6 +3528,92 @@ type integerPointError struct {
 	err   error
 }
 
+// integerBufferedIterator represents an iterator that reads all of its input
+// in a separate goroutine without waiting for the points to be read.
+type integerBufferedIterator struct {
+	input IntegerIterator
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	points []*IntegerPoint
+	err    error
+	done   bool
+	closed bool
+
+	wg sync.WaitGroup
+}
+
+// newIntegerBufferedIterator returns a new instance of integerBufferedIterator.
+func newIntegerBufferedIterator(input IntegerIterator) *integerBufferedIterator {
+	itr := &integerBufferedIterator{input: input}
+	itr.cond = sync.NewCond(&itr.mu)
+	itr.wg.Add(1)
+	go itr.monitor()
+	return itr
+}
+
+// Stats returns stats from the underlying iterator.
+func (itr *integerBufferedIterator) Stats() IteratorStats { return itr.input.Stats() }
+
+// Close closes the underlying iterator and waits for the goroutine to exit.
+func (itr *integerBufferedIterator) Close() error {
+	itr.mu.Lock()
+	itr.closed, itr.points = true, nil
+	itr.cond.Broadcast()
+	itr.mu.Unlock()
+
+	err := itr.input.Close()
+	itr.wg.Wait()
+	return err
+}
+
+// Next returns the next point from the iterator.
+func (itr *integerBufferedIterator) Next() (*IntegerPoint, error) {
+	itr.mu.Lock()
+	defer itr.mu.Unlock()
+
+	for len(itr.points) == 0 && !itr.done && !itr.closed {
+		itr.cond.Wait()
+	}
+	if len(itr.points) == 0 {
+		return nil, itr.err
+	}
+
+	p := itr.points[0]
+	itr.points[0] = nil
+	itr.points = itr.points[1:]
+	return p, nil
+}
+
+// monitor runs in a separate goroutine and reads the input until it is done.
+func (itr *integerBufferedIterator) monitor() {
+	defer itr.wg.Done()
+
+	for {
+		p, err := itr.input.Next()
+		if p != nil {
+			p = p.Clone()
+		}
+
+		itr.mu.Lock()
+		if itr.closed {
+			itr.mu.Unlock()
+			return
+		} else if p == nil || err != nil {
+			itr.err, itr.done = err, true
+		} else {
+			itr.points = append(itr.points, p)
+		}
+		done := itr.done
+		itr.cond.Signal()
+		itr.mu.Unlock()
+
+		if done {
+			return
+		}
+	}
+}
+
 // integerLimitIterator represents an iterator that limits points per group.
 type integerLimitIterator struct {
 	input IntegerIterator
@@ -3188,6 +3640,9 @@ func (itr *integerLimitIterator) Stats() IteratorStats { return itr.input.Stats(
 // Close closes the underlying iterators.
 func (itr *integerLimitIterator) Close() error { return itr.input.Close() }
 
+// filled returns true if the last point was generated by a fill.
+func (itr *integerLimitIterator) filled() bool { return isFilled(itr.input) }
+
 // Next returns the next point from the iterator.
 func (itr *integerLimitIterator) Next() (*IntegerPoint, error) {
 	for {
@@ -3221,13 +3676,14 @@ func (itr *integerLimitIterator) Next() (*IntegerPoint, error) {
 }
 
 type integerFillIterator struct {
-	input     *bufIntegerIterator
-	prev      IntegerPoint
-	startTime int64
-	endTime   int64
-	auxFields []interface{}
-	init      bool
-	opt       IteratorOptions
+	input      *bufIntegerIterator
+	prev       IntegerPoint
+	startTime  int64
+	endTime    int64
+	auxFields  []interface{}
+	init       bool
+	lastFilled bool
+	opt        IteratorOptions
 
 	window struct {
 		name string
@@ -3271,6 +3727,9 @@ func newIntegerFillIterator(input IntegerIterator, expr Expr, opt IteratorOption
 func (itr *integerFillIterator) Stats() IteratorStats { return itr.input.Stats() }
 func (itr *integerFillIterator) Close() error         { return itr.input.Close() }
 
+// filled returns true if the last point was generated by a fill.
+func (itr *integerFillIterator) filled() bool { return itr.lastFilled }
+
 func (itr *integerFillIterator) Next() (*IntegerPoint, error) {
 	if !itr.init {
 		p, err := itr.input.peek()
@@ -3323,6 +3782,7 @@ func (itr *integerFillIterator) Next() (*IntegerPoint, error) {
 		if p != nil {
 			itr.input.unread(p)
 		}
+		itr.lastFilled = true
 
 		p = &IntegerPoint{
 			Name: itr.window.name,
@@ -3359,9 +3819,20 @@ func (itr *integerFillIterator) Next() (*IntegerPoint, error) {
 			} else {
 				p.Nil = true
 			}
+		case NextFill:
+			next, err := itr.input.peek()
+			if err != nil {
+				return nil, err
+			} else if next != nil && next.Name == itr.window.name && next.Tags.ID() == itr.window.tags.ID() {
+				p.Value = next.Value
+				p.Nil = next.Nil
+			} else {
+				p.Nil = true
+			}
 		}
 	} else {
 		itr.prev = *p
+		itr.lastFilled = false
 	}
 
 	// Advance the expected time. Do not advance to a new window here
@@ -3372,6 +3843,14 @@ func (itr *integerFillIterator) Next() (*IntegerPoint, error) {
 	} else {
 		itr.window.time = p.Time - int64(itr.opt.Interval.Duration)
 	}
+
+	// Keep the expected time on a window edge if the zone offset changes
+	// before it, such as for daylight saving time.
+	if itr.opt.Location != nil {
+		if o := itr.opt.zoneOffset(p.Time) - itr.opt.zoneOffset(itr.window.time); o != 0 && abs(o) < int64(itr.opt.Interval.Duration) {
+			itr.window.time += o
+		}
+	}
 	return p, nil
 }
 
@@ -3415,6 +3894,7 @@ func newIntegerInterruptIterator(input IntegerIterator, closing <-chan struct{})
 
 func (itr *integerInterruptIterator) Stats() IteratorStats { return itr.input.Stats() }
 func (itr *integerInterruptIterator) Close() error         { return itr.input.Close() }
+func (itr *integerInterruptIterator) filled() bool         { return isFilled(itr.input) }
 
 func (itr *integerInterruptIterator) Next() (*IntegerPoint, error) {
 	// Only check if the channel is closed every N points. This
@@ -3490,8 +3970,9 @@ func (itr *integerCloseInterruptIterator) Next() (*IntegerPoint, error) {
 
 // auxIntegerPoint represents a combination of a point and an error for the AuxIterator.
 type auxIntegerPoint struct {
-	point *IntegerPoint
-	err   error
+	point  *IntegerPoint
+	filled bool
+	err    error
 }
 
 // integerAuxIterator represents a integer implementation of AuxIterator.
@@ -3500,14 +3981,17 @@ type integerAuxIterator struct {
 	output     chan auxIntegerPoint
 	fields     *auxIteratorFields
 	background bool
+	lastFilled bool
 }
 
 func newIntegerAuxIterator(input IntegerIterator, opt IteratorOptions) *integerAuxIterator {
-	return &integerAuxIterator{
+	itr := &integerAuxIterator{
 		input:  newBufIntegerIterator(input),
 		output: make(chan auxIntegerPoint, 1),
 		fields: newAuxIteratorFields(opt),
 	}
+	itr.fields.stats = itr.input.Stats
+	return itr
 }
 
 func (itr *integerAuxIterator) Background() {
@@ -3521,8 +4005,10 @@ func (itr *integerAuxIterator) Stats() IteratorStats { return itr.input.Stats()
 func (itr *integerAuxIterator) Close() error         { return itr.input.Close() }
 func (itr *integerAuxIterator) Next() (*IntegerPoint, error) {
 	p := <-itr.output
+	itr.lastFilled = p.filled
 	return p.point, p.err
 }
+func (itr *integerAuxIterator) filled() bool { return itr.lastFilled }
 func (itr *integerAuxIterator) Iterator(name string, typ DataType) Iterator {
 	return itr.fields.iterator(name, typ)
 }
@@ -3540,8 +4026,9 @@ func (itr *integerAuxIterator) stream() {
 		}
 
 		// Send point to output and to each field iterator.
-		itr.output <- auxIntegerPoint{point: p}
-		if ok := itr.fields.send(p); !ok && itr.background {
+		filled := itr.input.filled()
+		itr.output <- auxIntegerPoint{point: p, filled: filled}
+		if ok := itr.fields.send(p, filled); !ok && itr.background {
 			break
 		}
 	}
@@ -3556,13 +4043,23 @@ type integerChanIterator struct {
 		i      int
 		filled bool
 		points [2]IntegerPoint
+
+		// fill is true if the buffered point was generated by a fill.
+		fill bool
 	}
-	err  error
-	cond *sync.Cond
-	done bool
+	err        error
+	cond       *sync.Cond
+	done       bool
+	stats      func() IteratorStats
+	lastFilled bool
 }
 
-func (itr *integerChanIterator) Stats() IteratorStats { return IteratorStats{} }
+func (itr *integerChanIterator) Stats() IteratorStats {
+	if itr.stats == nil {
+		return IteratorStats{}
+	}
+	return itr.stats()
+}
 
 func (itr *integerChanIterator) Close() error {
 	itr.cond.L.Lock()
@@ -3574,7 +4071,7 @@ func (itr *integerChanIterator) Close() error {
 	return nil
 }
 
-func (itr *integerChanIterator) setBuf(name string, tags Tags, time int64, value interface{}) bool {
+func (itr *integerChanIterator) setBuf(name string, tags Tags, time int64, value interface{}, fill bool) bool {
 	itr.cond.L.Lock()
 	defer itr.cond.L.Unlock()
 
@@ -3598,6 +4095,7 @@ func (itr *integerChanIterator) setBuf(name string, tags Tags, time int64, value
 	default:
 		itr.buf.points[itr.buf.i] = IntegerPoint{Name: name, Tags: tags, Time: time, Nil: true}
 	}
+	itr.buf.fill = fill
 	itr.buf.filled = true
 
 	// Signal to all waiting goroutines that a new value is ready to read.
@@ -3640,10 +4138,14 @@ func (itr *integerChanIterator) Next() (*IntegerPoint, error) {
 	p := &itr.buf.points[itr.buf.i]
 	itr.buf.i = (itr.buf.i + 1) % len(itr.buf.points)
 	itr.buf.filled = false
+	itr.lastFilled = itr.buf.fill
 	itr.cond.Signal()
 	return p, nil
 }
 
+// filled returns true if the last point was generated by a fill.
+func (itr *integerChanIterator) filled() bool { return itr.lastFilled }
+
 // integerReduceFloatIterator executes a reducer for every interval and buffers the result.
 type integerReduceFloatIterator struct {
 	input  *bufIntegerIterator
@@ -3691,6 +4193,9 @@ type integerReduceFloatPoint struct {
 	Tags       Tags
 	Aggregator IntegerPointAggregator
 	Emitter    FloatPointEmitter
+
+	// Nil is true while only null points were read for the group.
+	Nil bool
 }
 
 // reduce executes fn once for every point in the next window.
@@ -3702,7 +4207,7 @@ func (itr *integerReduceFloatIterator) reduce() ([]FloatPoint, error) {
 		p, err := itr.input.Next()
 		if err != nil || p == nil {
 			return nil, err
-		} else if p.Nil {
+		} else if p.Nil && !itr.opt.KeepEmpty {
 			continue
 		}
 
@@ -3716,12 +4221,12 @@ func (itr *integerReduceFloatIterator) reduce() ([]FloatPoint, error) {
 	m := make(map[string]*integerReduceFloatPoint)
 	for {
 		// Read next point.
-		curr, err := itr.input.NextInWindow(startTime, endTime)
+		curr, err := itr.input.NextInWindow(itr.opt.windowBounds(startTime, endTime))
 		if err != nil {
 			return nil, err
 		} else if curr == nil {
 			break
-		} else if curr.Nil {
+		} else if curr.Nil && !itr.opt.KeepEmpty {
 			continue
 		}
 		tags := curr.Tags.Subset(itr.dims)
@@ -3740,10 +4245,15 @@ func (itr *integerReduceFloatIterator) reduce() ([]FloatPoint, error) {
 				Tags:       tags,
 				Aggregator: aggregator,
 				Emitter:    emitter,
+				Nil:        true,
 			}
 			m[id] = rp
 		}
+		if curr.Nil {
+			continue
+		}
 		rp.Aggregator.AggregateInteger(curr)
+		rp.Nil = false
 	}
 
 	// Reverse sort points by name & tag.
@@ -3760,7 +4270,12 @@ func (itr *integerReduceFloatIterator) reduce() ([]FloatPoint, error) {
 	a := make([]FloatPoint, 0, len(m))
 	for _, k := range keys {
 		rp := m[k]
-		points := rp.Emitter.Emit()
+		var points []FloatPoint
+		if rp.Nil {
+			points = []FloatPoint{{Time: ZeroTime, Nil: true}}
+		} else {
+			points = rp.Emitter.Emit()
+		}
 		for i := len(points) - 1; i >= 0; i-- {
 			points[i].Name = rp.Name
 			points[i].Tags = rp.Tags
@@ -3790,6 +4305,10 @@ type integerStreamFloatIterator struct {
 	opt    IteratorOptions
 	m      map[string]*integerReduceFloatPoint
 	points []FloatPoint
+
+	// pointsFilled is true if the buffered points were emitted for an
+	// input point that was generated by a fill.
+	pointsFilled bool
 }
 
 // newIntegerStreamFloatIterator returns a new instance of integerStreamFloatIterator.
@@ -3809,6 +4328,10 @@ func (itr *integerStreamFloatIterator) Stats() IteratorStats { return itr.input.
 // Close closes the iterator and all child iterators.
 func (itr *integerStreamFloatIterator) Close() error { return itr.input.Close() }
 
+// filled returns true if the last point was emitted for an input point that
+// was generated by a fill.
+func (itr *integerStreamFloatIterator) filled() bool { return itr.pointsFilled }
+
 // Next returns the next value for the stream iterator.
 func (itr *integerStreamFloatIterator) Next() (*FloatPoint, error) {
 	// Calculate next window if we have no more points.
@@ -3868,6 +4391,7 @@ func (itr *integerStreamFloatIterator) reduce() ([]FloatPoint, error) {
 			points[i].Name = rp.Name
 			points[i].Tags = rp.Tags
 		}
+		itr.pointsFilled = itr.input.filled()
 		return points, nil
 	}
 }
@@ -3880,12 +4404,16 @@ type integerFloatExprIterator struct {
 	fn        integerFloatExprFunc
 	points    []IntegerPoint // must be size 2
 	storePrev bool
+
+	// lastFilled is true if the last point was computed from a point
+	// generated by a fill, either by the inputs or by this iterator.
+	lastFilled bool
 }
 
 func newIntegerFloatExprIterator(left, right IntegerIterator, opt IteratorOptions, fn func(a, b int64) float64) *integerFloatExprIterator {
 	var points []IntegerPoint
 	switch opt.Fill {
-	case NullFill, PreviousFill:
+	case NullFill, PreviousFill, NextFill:
 		points = []IntegerPoint{{Nil: true}, {Nil: true}}
 	case NumberFill:
 		value := castToInteger(opt.FillValue)
@@ -3912,6 +4440,9 @@ func (itr *integerFloatExprIterator) Close() error {
 	return nil
 }
 
+// filled returns true if the last point was generated by a fill.
+func (itr *integerFloatExprIterator) filled() bool { return itr.lastFilled }
+
 func (itr *integerFloatExprIterator) Next() (*FloatPoint, error) {
 	for {
 		a, b, err := itr.next()
@@ -3924,6 +4455,9 @@ func (itr *integerFloatExprIterator) Next() (*FloatPoint, error) {
 			continue
 		}
 
+		// A missing point is filled below, so the result counts as filled too.
+		itr.lastFilled = a == nil || b == nil || itr.left.filled() || itr.right.filled()
+
 		// If one of the two points is nil, we need to fill it with a fake nil
 		// point that has the same name, tags, and time as the other point.
 		// There should never be a time when both of these are nil.
@@ -4063,6 +4597,9 @@ type integerReduceIntegerPoint struct {
 	Tags       Tags
 	Aggregator IntegerPointAggregator
 	Emitter    IntegerPointEmitter
+
+	// Nil is true while only null points were read for the group.
+	Nil bool
 }
 
 // reduce executes fn once for every point in the next window.
@@ -4074,7 +4611,7 @@ func (itr *integerReduceIntegerIterator) reduce() ([]IntegerPoint, error) {
 		p, err := itr.input.Next()
 		if err != nil || p == nil {
 			return nil, err
-		} else if p.Nil {
+		} else if p.Nil && !itr.opt.KeepEmpty {
 			continue
 		}
 
@@ -4088,12 +4625,12 @@ func (itr *integerReduceIntegerIterator) reduce() ([]IntegerPoint, error) {
 	m := make(map[string]*integerReduceIntegerPoint)
 	for {
 		// Read next point.
-		curr, err := itr.input.NextInWindow(startTime, endTime)
+		curr, err := itr.input.NextInWindow(itr.opt.windowBounds(startTime, endTime))
 		if err != nil {
 			return nil, err
 		} else if curr == nil {
 			break
-		} else if curr.Nil {
+		} else if curr.Nil && !itr.opt.KeepEmpty {
 			continue
 		}
 		tags := curr.Tags.Subset(itr.dims)
@@ -4112,10 +4649,15 @@ func (itr *integerReduceIntegerIterator) reduce() ([]IntegerPoint, error) {
 				Tags:       tags,
 				Aggregator: aggregator,
 				Emitter:    emitter,
+				Nil:        true,
 			}
 			m[id] = rp
 		}
+		if curr.Nil {
+			continue
+		}
 		rp.Aggregator.AggregateInteger(curr)
+		rp.Nil = false
 	}
 
 	// Reverse sort points by name & tag.
@@ -4132,7 +4674,12 @@ func (itr *integerReduceIntegerIterator) reduce() ([]IntegerPoint, error) {
 	a := make([]IntegerPoint, 0, len(m))
 	for _, k := range keys {
 		rp := m[k]
-		points := rp.Emitter.Emit()
+		var points []IntegerPoint
+		if rp.Nil {
+			points = []IntegerPoint{{Time: ZeroTime, Nil: true}}
+		} else {
+			points = rp.Emitter.Emit()
+		}
 		for i := len(points) - 1; i >= 0; i-- {
 			points[i].Name = rp.Name
 			points[i].Tags = rp.Tags
@@ -4162,6 +4709,10 @@ type integerStreamIntegerIterator struct {
 	opt    IteratorOptions
 	m      map[string]*integerReduceIntegerPoint
 	points []IntegerPoint
+
+	// pointsFilled is true if the buffered points were emitted for an
+	// input point that was generated by a fill.
+	pointsFilled bool
 }
 
 // newIntegerStreamIntegerIterator returns a new instance of integerStreamIntegerIterator.
@@ -4181,6 +4732,10 @@ func (itr *integerStreamIntegerIterator) Stats() IteratorStats { return itr.inpu
 // Close closes the iterator and all child iterators.
 func (itr *integerStreamIntegerIterator) Close() error { return itr.input.Close() }
 
+// filled returns true if the last point was emitted for an input point that
+// was generated by a fill.
+func (itr *integerStreamIntegerIterator) filled() bool { return itr.pointsFilled }
+
 // Next returns the next value for the stream iterator.
 func (itr *integerStreamIntegerIterator) Next() (*IntegerPoint, error) {
 	// Calculate next window if we have no more points.
@@ -4240,6 +4795,7 @@ func (itr *integerStreamIntegerIterator) reduce() ([]IntegerPoint, error) {
 			points[i].Name = rp.Name
 			points[i].Tags = rp.Tags
 		}
+		itr.pointsFilled = itr.input.filled()
 		return points, nil
 	}
 }
@@ -4252,12 +4808,16 @@ type integerExprIterator struct {
 	fn        integerExprFunc
 	points    []IntegerPoint // must be size 2
 	storePrev bool
+
+	// lastFilled is true if the last point was computed from a point
+	// generated by a fill, either by the inputs or by this iterator.
+	lastFilled bool
 }
 
 func newIntegerExprIterator(left, right IntegerIterator, opt IteratorOptions, fn func(a, b int64) int64) *integerExprIterator {
 	var points []IntegerPoint
 	switch opt.Fill {
-	case NullFill, PreviousFill:
+	case NullFill, PreviousFill, NextFill:
 		points = []IntegerPoint{{Nil: true}, {Nil: true}}
 	case NumberFill:
 		value := castToInteger(opt.FillValue)
@@ -4284,6 +4844,9 @@ func (itr *integerExprIterator) Close() error {
 	return nil
 }
 
+// filled returns true if the last point was generated by a fill.
+func (itr *integerExprIterator) filled() bool { return itr.lastFilled }
+
 func (itr *integerExprIterator) Next() (*IntegerPoint, error) {
 	for {
 		a, b, err := itr.next()
@@ -4296,6 +4859,9 @@ func (itr *integerExprIterator) Next() (*IntegerPoint, error) {
 			continue
 		}
 
+		// A missing point is filled below, so the result counts as filled too.
+		itr.lastFilled = a == nil || b == nil || itr.left.filled() || itr.right.filled()
+
 		// If one of the two points is nil, we need to fill it with a fake nil
 		// point that has the same name, tags, and time as the other point.
 		// There should never be a time when both of these are nil.
@@ -4431,6 +4997,9 @@ type integerReduceStringPoint struct {
 	Tags       Tags
 	Aggregator IntegerPointAggregator
 	Emitter    StringPointEmitter
+
+	// Nil is true while only null points were read for the group.
+	Nil bool
 }
 
 // reduce executes fn once for every point in the next window.
@@ -4442,7 +5011,7 @@ func (itr *integerReduceStringIterator) reduce() ([]StringPoint, error) {
 		p, err := itr.input.Next()
 		if err != nil || p == nil {
 			return nil, err
-		} else if p.Nil {
+		} else if p.Nil && !itr.opt.KeepEmpty {
 			continue
 		}
 
@@ -4456,12 +5025,12 @@ func (itr *integerReduceStringIterator) reduce() ([]StringPoint, error) {
 	m := make(map[string]*integerReduceStringPoint)
 	for {
 		// Read next point.
-		curr, err := itr.input.NextInWindow(startTime, endTime)
+		curr, err := itr.input.NextInWindow(itr.opt.windowBounds(startTime, endTime))
 		if err != nil {
 			return nil, err
 		} else if curr == nil {
 			break
-		} else if curr.Nil {
+		} else if curr.Nil && !itr.opt.KeepEmpty {
 			continue
 		}
 		tags := curr.Tags.Subset(itr.dims)
@@ -4480,10 +5049,15 @@ func (itr *integerReduceStringIterator) reduce() ([]StringPoint, error) {
 				Tags:       tags,
 				Aggregator: aggregator,
 				Emitter:    emitter,
+				Nil:        true,
 			}
 			m[id] = rp
 		}
+		if curr.Nil {
+			continue
+		}
 		rp.Aggregator.AggregateInteger(curr)
+		rp.Nil = false
 	}
 
 	// Reverse sort points by name & tag.
@@ -4500,7 +5074,12 @@ func (itr *integerReduceStringIterator) reduce() ([]StringPoint, error) {
 	a := make([]StringPoint, 0, len(m))
 	for _, k := range keys {
 		rp := m[k]
-		points := rp.Emitter.Emit()
+		var points []StringPoint
+		if rp.Nil {
+			points = []StringPoint{{Time: ZeroTime, Nil: true}}
+		} else {
+			points = rp.Emitter.Emit()
+		}
 		for i := len(points) - 1; i >= 0; i-- {
 			points[i].Name = rp.Name
 			points[i].Tags = rp.Tags
@@ -4530,6 +5109,10 @@ type integerStreamStringIterator struct {
 	opt    IteratorOptions
 	m      map[string]*integerReduceStringPoint
 	points []StringPoint
+
+	// pointsFilled is true if the buffered points were emitted for an
+	// input point that was generated by a fill.
+	pointsFilled bool
 }
 
 // newIntegerStreamStringIterator returns a new instance of integerStreamStringIterator.
@@ -4549,6 +5132,10 @@ func (itr *integerStreamStringIterator) Stats() IteratorStats { return itr.input
 // Close closes the iterator and all child iterators.
 func (itr *integerStreamStringIterator) Close() error { return itr.input.Close() }
 
+// filled returns true if the last point was emitted for an input point that
+// was generated by a fill.
+func (itr *integerStreamStringIterator) filled() bool { return itr.pointsFilled }
+
 // Next returns the next value for the stream iterator.
 func (itr *integerStreamStringIterator) Next() (*StringPoint, error) {
 	// Calculate next window if we have no more points.
@@ -4608,6 +5195,7 @@ func (itr *integerStreamStringIterator) reduce() ([]StringPoint, error) {
 			points[i].Name = rp.Name
 			points[i].Tags = rp.Tags
 		}
+		itr.pointsFilled = itr.input.filled()
 		return points, nil
 	}
 }
@@ -4620,12 +5208,16 @@ type integerStringExprIterator struct {
 	fn        integerStringExprFunc
 	points    []IntegerPoint // must be size 2
 	storePrev bool
+
+	// lastFilled is true if the last point was computed from a point
+	// generated by a fill, either by the inputs or by this iterator.
+	lastFilled bool
 }
 
 func newIntegerStringExprIterator(left, right IntegerIterator, opt IteratorOptions, fn func(a, b int64) string) *integerStringExprIterator {
 	var points []IntegerPoint
 	switch opt.Fill {
-	case NullFill, PreviousFill:
+	case NullFill, PreviousFill, NextFill:
 		points = []IntegerPoint{{Nil: true}, {Nil: true}}
 	case NumberFill:
 		value := castToInteger(opt.FillValue)
@@ -4652,6 +5244,9 @@ func (itr *integerStringExprIterator) Close() error {
 	return nil
 }
 
+// filled returns true if the last point was generated by a fill.
+func (itr *integerStringExprIterator) filled() bool { return itr.lastFilled }
+
 func (itr *integerStringExprIterator) Next() (*StringPoint, error) {
 	for {
 		a, b, err := itr.next()
@@ -4664,6 +5259,9 @@ func (itr *integerStringExprIterator) Next() (*StringPoint, error) {
 			continue
 		}
 
+		// A missing point is filled below, so the result counts as filled too.
+		itr.lastFilled = a == nil || b == nil || itr.left.filled() || itr.right.filled()
+
 		// If one of the two points is nil, we need to fill it with a fake nil
 		// point that has the same name, tags, and time as the other point.
 		// There should never be a time when both of these are nil.
@@ -4803,6 +5401,9 @@ type integerReduceBooleanPoint struct {
 	Tags       Tags
 	Aggregator IntegerPointAggregator
 	Emitter    BooleanPointEmitter
+
+	// Nil is true while only null points were read for the group.
+	Nil bool
 }
 
 // reduce executes fn once for every point in the next window.
@@ -4814,7 +5415,7 @@ func (itr *integerReduceBooleanIterator) reduce() ([]BooleanPoint, error) {
 		p, err := itr.input.Next()
 		if err != nil || p == nil {
 			return nil, err
-		} else if p.Nil {
+		} else if p.Nil && !itr.opt.KeepEmpty {
 			continue
 		}
 
@@ -4828,12 +5429,12 @@ func (itr *integerReduceBooleanIterator) reduce() ([]BooleanPoint, error) {
 	m := make(map[string]*integerReduceBooleanPoint)
 	for {
 		// Read next point.
-		curr, err := itr.input.NextInWindow(startTime, endTime)
+		curr, err := itr.input.NextInWindow(itr.opt.windowBounds(startTime, endTime))
 		if err != nil {
 			return nil, err
 		} else if curr == nil {
 			break
-		} else if curr.Nil {
+		} else if curr.Nil && !itr.opt.KeepEmpty {
 			continue
 		}
 		tags := curr.Tags.Subset(itr.dims)
@@ -4852,10 +5453,15 @@ func (itr *integerReduceBooleanIterator) reduce() ([]BooleanPoint, error) {
 				Tags:       tags,
 				Aggregator: aggregator,
 				Emitter:    emitter,
+				Nil:        true,
 			}
 			m[id] = rp
 		}
+		if curr.Nil {
+			continue
+		}
 		rp.Aggregator.AggregateInteger(curr)
+		rp.Nil = false
 	}
 
 	// Reverse sort points by name & tag.
@@ -4872,7 +5478,12 @@ func (itr *integerReduceBooleanIterator) reduce() ([]BooleanPoint, error) {
 	a := make([]BooleanPoint, 0, len(m))
 	for _, k := range keys {
 		rp := m[k]
-		points := rp.Emitter.Emit()
+		var points []BooleanPoint
+		if rp.Nil {
+			points = []BooleanPoint{{Time: ZeroTime, Nil: true}}
+		} else {
+			points = rp.Emitter.Emit()
+		}
 		for i := len(points) - 1; i >= 0; i-- {
 			points[i].Name = rp.Name
 			points[i].Tags = rp.Tags
@@ -4902,6 +5513,10 @@ type integerStreamBooleanIterator struct {
 	opt    IteratorOptions
 	m      map[string]*integerReduceBooleanPoint
 	points []BooleanPoint
+
+	// pointsFilled is true if the buffered points were emitted for an
+	// input point that was generated by a fill.
+	pointsFilled bool
 }
 
 // newIntegerStreamBooleanIterator returns a new instance of integerStreamBooleanIterator.
@@ -4921,6 +5536,10 @@ func (itr *integerStreamBooleanIterator) Stats() IteratorStats { return itr.inpu
 // Close closes the iterator and all child iterators.
 func (itr *integerStreamBooleanIterator) Close() error { return itr.input.Close() }
 
+// filled returns true if the last point was emitted for an input point that
+// was generated by a fill.
+func (itr *integerStreamBooleanIterator) filled() bool { return itr.pointsFilled }
+
 // Next returns the next value for the stream iterator.
 func (itr *integerStreamBooleanIterator) Next() (*BooleanPoint, error) {
 	// Calculate next window if we have no more points.
@@ -4980,6 +5599,7 @@ func (itr *integerStreamBooleanIterator) reduce() ([]BooleanPoint, error) {
 			points[i].Name = rp.Name
 			points[i].Tags = rp.Tags
 		}
+		itr.pointsFilled = itr.input.filled()
 		return points, nil
 	}
 }
@@ -4992,12 +5612,16 @@ type integerBooleanExprIterator struct {
 	fn        integerBooleanExprFunc
 	points    []IntegerPoint // must be size 2
 	storePrev bool
+
+	// lastFilled is true if the last point was computed from a point
+	// generated by a fill, either by the inputs or by this iterator.
+	lastFilled bool
 }
 
 func newIntegerBooleanExprIterator(left, right IntegerIterator, opt IteratorOptions, fn func(a, b int64) bool) *integerBooleanExprIterator {
 	var points []IntegerPoint
 	switch opt.Fill {
-	case NullFill, PreviousFill:
+	case NullFill, PreviousFill, NextFill:
 		points = []IntegerPoint{{Nil: true}, {Nil: true}}
 	case NumberFill:
 		value := castToInteger(opt.FillValue)
@@ -5024,6 +5648,9 @@ func (itr *integerBooleanExprIterator) Close() error {
 	return nil
 }
 
+// filled returns true if the last point was generated by a fill.
+func (itr *integerBooleanExprIterator) filled() bool { return itr.lastFilled }
+
 func (itr *integerBooleanExprIterator) Next() (*BooleanPoint, error) {
 	for {
 		a, b, err := itr.next()
@@ -5036,6 +5663,9 @@ func (itr *integerBooleanExprIterator) Next() (*BooleanPoint, error) {
 			continue
 		}
 
+		// A missing point is filled below, so the result counts as filled too.
+		itr.lastFilled = a == nil || b == nil || itr.left.filled() || itr.right.filled()
+
 		// If one of the two points is nil, we need to fill it with a fake nil
 		// point that has the same name, tags, and time as the other point.
 		// There should never be a time when both of these are nil.
@@ -5141,6 +5771,9 @@ func (itr *integerTransformIterator) Stats() IteratorStats { return itr.input.St
 // Close closes the iterator and all child iterators.
 func (itr *integerTransformIterator) Close() error { return itr.input.Close() }
 
+// filled returns true if the last point was generated by a fill.
+func (itr *integerTransformIterator) filled() bool { return isFilled(itr.input) }
+
 // Next returns the minimum value for the next available interval.
 func (itr *integerTransformIterator) Next() (*IntegerPoint, error) {
 	p, err := itr.input.Next()
@@ -5170,6 +5803,9 @@ func (itr *integerBoolTransformIterator) Stats() IteratorStats { return itr.inpu
 // Close closes the iterator and all child iterators.
 func (itr *integerBoolTransformIterator) Close() error { return itr.input.Close() }
 
+// filled returns true if the last point was generated by a fill.
+func (itr *integerBoolTransformIterator) filled() bool { return isFilled(itr.input) }
+
 // Next returns the minimum value for the next available interval.
 func (itr *integerBoolTransformIterator) Next() (*BooleanPoint, error) {
 	p, err := itr.input.Next()
@@ -5294,6 +5930,46 @@ func (itr *integerDedupeIterator) Next() (*IntegerPoint, error) {
 	}
 }
 
+// integerTimeDedupeIterator only outputs the first point for each series
+// and timestamp. It is used to drop the rows repeated by subqueries that
+// overlap and, like the DedupeIterator, keeps every key it has seen.
+type integerTimeDedupeIterator struct {
+	input IntegerIterator
+	m     map[timeDedupeKey]struct{} // lookup of series and times already sent
+}
+
+// newIntegerTimeDedupeIterator returns a new instance of integerTimeDedupeIterator.
+func newIntegerTimeDedupeIterator(input IntegerIterator) *integerTimeDedupeIterator {
+	return &integerTimeDedupeIterator{
+		input: input,
+		m:     make(map[timeDedupeKey]struct{}),
+	}
+}
+
+// Stats returns stats from the input iterator.
+func (itr *integerTimeDedupeIterator) Stats() IteratorStats { return itr.input.Stats() }
+
+// Close closes the iterator and all child iterators.
+func (itr *integerTimeDedupeIterator) Close() error { return itr.input.Close() }
+
+// Next returns the next point from the input iterator whose series and time
+// have not been output yet.
+func (itr *integerTimeDedupeIterator) Next() (*IntegerPoint, error) {
+	for {
+		p, err := itr.input.Next()
+		if p == nil || err != nil {
+			return nil, err
+		}
+
+		key := timeDedupeKey{name: p.Name, tags: p.Tags.ID(), time: p.Time}
+		if _, ok := itr.m[key]; ok {
+			continue
+		}
+		itr.m[key] = struct{}{}
+		return p, nil
+	}
+}
+
 // integerReaderIterator represents an iterator that streams from a reader.
 type integerReaderIterator struct {
 	r   io.Reader
@@ -5363,6 +6039,11 @@ func newStringIterators(itrs []Iterator) []StringIterator {
 type bufStringIterator struct {
 	itr StringIterator
 	buf *StringPoint
+
+	// lastFilled and bufFilled record whether the last returned point and
+	// the buffered point were generated by a fill.
+	lastFilled bool
+	bufFilled  bool
 }
 
 // newBufStringIterator returns a buffered StringIterator.
@@ -5401,9 +6082,12 @@ func (itr *bufStringIterator) Next() (*StringPoint, error) {
 	buf := itr.buf
 	if buf != nil {
 		itr.buf = nil
+		itr.lastFilled = itr.bufFilled
 		return buf, nil
 	}
-	return itr.itr.Next()
+	p, err := itr.itr.Next()
+	itr.lastFilled = isFilled(itr.itr)
+	return p, err
 }
 
 // NextInWindow returns the next value if it is between [startTime, endTime).
@@ -5420,7 +6104,13 @@ func (itr *bufStringIterator) NextInWindow(startTime, endTime int64) (*StringPoi
 }
 
 // unread sets v to the buffer. It is read on the next call to Next().
-func (itr *bufStringIterator) unread(v *StringPoint) { itr.buf = v }
+func (itr *bufStringIterator) unread(v *StringPoint) {
+	itr.buf = v
+	itr.bufFilled = itr.lastFilled
+}
+
+// filled returns true if the last point was generated by a fill.
+func (itr *bufStringIterator) filled() bool { return itr.lastFilled }
 
 // stringMergeIterator represents an iterator that combines multiple string iterators.
 type stringMergeIterator struct {
@@ -5449,12 +6139,12 @@ func newStringMergeIterator(inputs []StringIterator, opt IteratorOptions) *strin
 	}
 
 	// Initialize heap items.
-	for _, input := range inputs {
+	for i, input := range inputs {
 		// Wrap in buffer, ignore any inputs without anymore points.
 		bufInput := newBufStringIterator(input)
 
 		// Append to the heap.
-		itr.heap.items = append(itr.heap.items, &stringMergeHeapItem{itr: bufInput})
+		itr.heap.items = append(itr.heap.items, &stringMergeHeapItem{itr: bufInput, index: i})
 	}
 
 	return itr
@@ -5517,7 +6207,7 @@ func (itr *stringMergeIterator) Next() (*StringPoint, error) {
 			}
 			tags := p.Tags.Subset(itr.heap.opt.Dimensions)
 			itr.window.name, itr.window.tags = p.Name, tags.ID()
-			itr.window.startTime, itr.window.endTime = itr.heap.opt.Window(p.Time)
+			itr.window.startTime, itr.window.endTime = itr.heap.opt.windowBounds(itr.heap.opt.Window(p.Time))
 			return p, nil
 		}
 
@@ -5593,6 +6283,12 @@ func (h *stringMergeHeap) Less(i, j int) bool {
 	xt, _ := h.opt.Window(x.Time)
 	yt, _ := h.opt.Window(y.Time)
 
+	// Break ties by input when requested so points from series that have
+	// the same tags after projection are always merged in the same order.
+	if xt == yt && h.opt.StableMerge {
+		return h.items[i].index < h.items[j].index
+	}
+
 	if h.opt.Ascending {
 		return xt < yt
 	}
@@ -5612,7 +6308,8 @@ func (h *stringMergeHeap) Pop() interface{} {
 }
 
 type stringMergeHeapItem struct {
-	itr *bufStringIterator
+	itr   *bufStringIterator
+	index int
 }
 
 // stringSortedMergeIterator is an iterator that sorts and merges multiple iterators into one.
@@ -5633,9 +6330,9 @@ func newStringSortedMergeIterator(inputs []StringIterator, opt IteratorOptions)
 	}
 
 	// Initialize heap items.
-	for _, input := range inputs {
+	for i, input := range inputs {
 		// Append to the heap.
-		itr.heap.items = append(itr.heap.items, &stringSortedMergeHeapItem{itr: input})
+		itr.heap.items = append(itr.heap.items, &stringSortedMergeHeapItem{itr: input, index: i})
 	}
 
 	return itr
@@ -5721,6 +6418,9 @@ func (h *stringSortedMergeHeap) Less(i, j int) bool {
 		} else if xTags, yTags := x.Tags.Subset(h.opt.Dimensions), y.Tags.Subset(h.opt.Dimensions); !xTags.Equals(&yTags) {
 			return xTags.ID() < yTags.ID()
 		}
+		if x.Time == y.Time && h.opt.StableMerge {
+			return h.items[i].index < h.items[j].index
+		}
 		return x.Time < y.Time
 	}
 
@@ -5729,6 +6429,9 @@ func (h *stringSortedMergeHeap) Less(i, j int) bool {
 	} else if xTags, yTags := x.Tags.Subset(h.opt.Dimensions), y.Tags.Subset(h.opt.Dimensions); !xTags.Equals(&yTags) {
 		return xTags.ID() > yTags.ID()
 	}
+	if x.Time == y.Time && h.opt.StableMerge {
+		return h.items[i].index < h.items[j].index
+	}
 	return x.Time > y.Time
 }
 
@@ -5748,6 +6451,7 @@ type stringSortedMergeHeapItem struct {
 	point *StringPoint
 	err   error
 	itr   StringIterator
+	index int
 }
 
 // stringParallelIterator represents an iterator that pulls data in a separate goroutine.
@@ -5761,10 +6465,10 @@ type stringParallelIterator struct {
 }
 
 // newStringParallelIterator returns a new instance of stringParallelIterator.
-func newStringParallelIterator(input StringIterator) *stringParallelIterator {
+func newStringParallelIterator(input StringIterator, size int) *stringParallelIterator {
 	itr := &stringParallelIterator{
 		input:   input,
-		ch:      make(chan stringPointError, 256),
+		ch:      make(chan stringPointError, size),
 		closing: make(chan struct{}),
 	}
 	itr.wg.Add(1)
@@ -5816,6 +6520,92 @@ type stringPointError struct {
 	err   error
 }
 
+// stringBufferedIterator represents an iterator that reads all of its input
+// in a separate goroutine without waiting for the points to be read.
+type stringBufferedIterator struct {
+	input StringIterator
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	points []*StringPoint
+	err    error
+	done   bool
+	closed bool
+
+	wg sync.WaitGroup
+}
+
+// newStringBufferedIterator returns a new instance of stringBufferedIterator.
+func newStringBufferedIterator(input StringIterator) *stringBufferedIterator {
+	itr := &stringBufferedIterator{input: input}
+	itr.cond = sync.NewCond(&itr.mu)
+	itr.wg.Add(1)
+	go itr.monitor()
+	return itr
+}
+
+// Stats returns stats from the underlying iterator.
+func (itr *stringBufferedIterator) Stats() IteratorStats { return itr.input.Stats() }
+
+// Close closes the underlying iterator and waits for the goroutine to exit.
+func (itr *stringBufferedIterator) Close() error {
+	itr.mu.Lock()
+	itr.closed, itr.points = true, nil
+	itr.cond.Broadcast()
+	itr.mu.Unlock()
+
+	err := itr.input.Close()
+	itr.wg.Wait()
+	return err
+}
+
+// Next returns the next point from the iterator.
+func (itr *stringBufferedIterator) Next() (*StringPoint, error) {
+	itr.mu.Lock()
+	defer itr.mu.Unlock()
+
+	for len(itr.points) == 0 && !itr.done && !itr.closed {
+		itr.cond.Wait()
+	}
+	if len(itr.points) == 0 {
+		return nil, itr.err
+	}
+
+	p := itr.points[0]
+	itr.points[0] = nil
+	itr.points = itr.points[1:]
+	return p, nil
+}
+
+// monitor runs in a separate goroutine and reads the input until it is done.
+func (itr *stringBufferedIterator) monitor() {
+	defer itr.wg.Done()
+
+	for {
+		p, err := itr.input.Next()
+		if p != nil {
+			p = p.Clone()
+		}
+
+		itr.mu.Lock()
+		if itr.closed {
+			itr.mu.Unlock()
+			return
+		} else if p == nil || err != nil {
+			itr.err, itr.done = err, true
+		} else {
+			itr.points = append(itr.points, p)
+		}
+		done := itr.done
+		itr.cond.Signal()
+		itr.mu.Unlock()
+
+		if done {
+			return
+		}
+	}
+}
+
 // stringLimitIterator represents an iterator that limits points per group.
 type stringLimitIterator struct {
 	input StringIterator
@@ -5842,6 +6632,9 @@ func (itr *stringLimitIterator) Stats() IteratorStats { return itr.input.Stats()
 // Close closes the underlying iterators.
 func (itr *stringLimitIterator) Close() error { return itr.input.Close() }
 
+// filled returns true if the last point was generated by a fill.
+func (itr *stringLimitIterator) filled() bool { return isFilled(itr.input) }
+
 // Next returns the next point from the iterator.
 func (itr *stringLimitIterator) Next() (*StringPoint, error) {
 	for {
@@ -5875,13 +6668,14 @@ func (itr *stringLimitIterator) Next() (*StringPoint, error) {
 }
 
 type stringFillIterator struct {
-	input     *bufStringIterator
-	prev      StringPoint
-	startTime int64
-	endTime   int64
-	auxFields []interface{}
-	init      bool
-	opt       IteratorOptions
+	input      *bufStringIterator
+	prev       StringPoint
+	startTime  int64
+	endTime    int64
+	auxFields  []interface{}
+	init       bool
+	lastFilled bool
+	opt        IteratorOptions
 
 	window struct {
 		name string
@@ -5925,6 +6719,9 @@ func newStringFillIterator(input StringIterator, expr Expr, opt IteratorOptions)
 func (itr *stringFillIterator) Stats() IteratorStats { return itr.input.Stats() }
 func (itr *stringFillIterator) Close() error         { return itr.input.Close() }
 
+// filled returns true if the last point was generated by a fill.
+func (itr *stringFillIterator) filled() bool { return itr.lastFilled }
+
 func (itr *stringFillIterator) Next() (*StringPoint, error) {
 	if !itr.init {
 		p, err := itr.input.peek()
@@ -5977,6 +6774,7 @@ func (itr *stringFillIterator) Next() (*StringPoint, error) {
 		if p != nil {
 			itr.input.unread(p)
 		}
+		itr.lastFilled = true
 
 		p = &StringPoint{
 			Name: itr.window.name,
@@ -5999,9 +6797,20 @@ func (itr *stringFillIterator) Next() (*StringPoint, error) {
 			} else {
 				p.Nil = true
 			}
+		case NextFill:
+			next, err := itr.input.peek()
+			if err != nil {
+				return nil, err
+			} else if next != nil && next.Name == itr.window.name && next.Tags.ID() == itr.window.tags.ID() {
+				p.Value = next.Value
+				p.Nil = next.Nil
+			} else {
+				p.Nil = true
+			}
 		}
 	} else {
 		itr.prev = *p
+		itr.lastFilled = false
 	}
 
 	// Advance the expected time. Do not advance to a new window here
@@ -6012,6 +6821,14 @@ func (itr *stringFillIterator) Next() (*StringPoint, error) {
 	} else {
 		itr.window.time = p.Time - int64(itr.opt.Interval.Duration)
 	}
+
+	// Keep the expected time on a window edge if the zone offset changes
+	// before it, such as for daylight saving time.
+	if itr.opt.Location != nil {
+		if o := itr.opt.zoneOffset(p.Time) - itr.opt.zoneOffset(itr.window.time); o != 0 && abs(o) < int64(itr.opt.Interval.Duration) {
+			itr.window.time += o
+		}
+	}
 	return p, nil
 }
 
@@ -6055,6 +6872,7 @@ func newStringInterruptIterator(input StringIterator, closing <-chan struct{}) *
 
 func (itr *stringInterruptIterator) Stats() IteratorStats { return itr.input.Stats() }
 func (itr *stringInterruptIterator) Close() error         { return itr.input.Close() }
+func (itr *stringInterruptIterator) filled() bool         { return isFilled(itr.input) }
 
 func (itr *stringInterruptIterator) Next() (*StringPoint, error) {
 	// Only check if the channel is closed every N points. This
@@ -6130,8 +6948,9 @@ func (itr *stringCloseInterruptIterator) Next() (*StringPoint, error) {
 
 // auxStringPoint represents a combination of a point and an error for the AuxIterator.
 type auxStringPoint struct {
-	point *StringPoint
-	err   error
+	point  *StringPoint
+	filled bool
+	err    error
 }
 
 // stringAuxIterator represents a string implementation of AuxIterator.
@@ -6140,14 +6959,17 @@ type stringAuxIterator struct {
 	output     chan auxStringPoint
 	fields     *auxIteratorFields
 	background bool
+	lastFilled bool
 }
 
 func newStringAuxIterator(input StringIterator, opt IteratorOptions) *stringAuxIterator {
-	return &stringAuxIterator{
+	itr := &stringAuxIterator{
 		input:  newBufStringIterator(input),
 		output: make(chan auxStringPoint, 1),
 		fields: newAuxIteratorFields(opt),
 	}
+	itr.fields.stats = itr.input.Stats
+	return itr
 }
 
 func (itr *stringAuxIterator) Background() {
@@ -6161,8 +6983,10 @@ func (itr *stringAuxIterator) Stats() IteratorStats { return itr.input.Stats() }
 func (itr *stringAuxIterator) Close() error         { return itr.input.Close() }
 func (itr *stringAuxIterator) Next() (*StringPoint, error) {
 	p := <-itr.output
+	itr.lastFilled = p.filled
 	return p.point, p.err
 }
+func (itr *stringAuxIterator) filled() bool { return itr.lastFilled }
 func (itr *stringAuxIterator) Iterator(name string, typ DataType) Iterator {
 	return itr.fields.iterator(name, typ)
 }
@@ -6180,8 +7004,9 @@ func (itr *stringAuxIterator) stream() {
 		}
 
 		// Send point to output and to each field iterator.
-		itr.output <- auxStringPoint{point: p}
-		if ok := itr.fields.send(p); !ok && itr.background {
+		filled := itr.input.filled()
+		itr.output <- auxStringPoint{point: p, filled: filled}
+		if ok := itr.fields.send(p, filled); !ok && itr.background {
 			break
 		}
 	}
@@ -6196,13 +7021,23 @@ type stringChanIterator struct {
 		i      int
 		filled bool
 		points [2]StringPoint
+
+		// fill is true if the buffered point was generated by a fill.
+		fill bool
 	}
-	err  error
-	cond *sync.Cond
-	done bool
+	err        error
+	cond       *sync.Cond
+	done       bool
+	stats      func() IteratorStats
+	lastFilled bool
 }
 
-func (itr *stringChanIterator) Stats() IteratorStats { return IteratorStats{} }
+func (itr *stringChanIterator) Stats() IteratorStats {
+	if itr.stats == nil {
+		return IteratorStats{}
+	}
+	return itr.stats()
+}
 
 func (itr *stringChanIterator) Close() error {
 	itr.cond.L.Lock()
@@ -6214,7 +7049,7 @@ func (itr *stringChanIterator) Close() error {
 	return nil
 }
 
-func (itr *stringChanIterator) setBuf(name string, tags Tags, time int64, value interface{}) bool {
+func (itr *stringChanIterator) setBuf(name string, tags Tags, time int64, value interface{}, fill bool) bool {
 	itr.cond.L.Lock()
 	defer itr.cond.L.Unlock()
 
@@ -6238,6 +7073,7 @@ func (itr *stringChanIterator) setBuf(name string, tags Tags, time int64, value
 	default:
 		itr.buf.points[itr.buf.i] = StringPoint{Name: name, Tags: tags, Time: time, Nil: true}
 	}
+	itr.buf.fill = fill
 	itr.buf.filled = true
 
 	// Signal to all waiting goroutines that a new value is ready to read.
@@ -6280,10 +7116,14 @@ func (itr *stringChanIterator) Next() (*StringPoint, error) {
 	p := &itr.buf.points[itr.buf.i]
 	itr.buf.i = (itr.buf.i + 1) % len(itr.buf.points)
 	itr.buf.filled = false
+	itr.lastFilled = itr.buf.fill
 	itr.cond.Signal()
 	return p, nil
 }
 
+// filled returns true if the last point was generated by a fill.
+func (itr *stringChanIterator) filled() bool { return itr.lastFilled }
+
 // stringReduceFloatIterator executes a reducer for every interval and buffers the result.
 type stringReduceFloatIterator struct {
 	input  *bufStringIterator
@@ -6331,6 +7171,9 @@ type stringReduceFloatPoint struct {
 	Tags       Tags
 	Aggregator StringPointAggregator
 	Emitter    FloatPointEmitter
+
+	// Nil is true while only null points were read for the group.
+	Nil bool
 }
 
 // reduce executes fn once for every point in the next window.
@@ -6342,7 +7185,7 @@ func (itr *stringReduceFloatIterator) reduce() ([]FloatPoint, error) {
 		p, err := itr.input.Next()
 		if err != nil || p == nil {
 			return nil, err
-		} else if p.Nil {
+		} else if p.Nil && !itr.opt.KeepEmpty {
 			continue
 		}
 
@@ -6356,12 +7199,12 @@ func (itr *stringReduceFloatIterator) reduce() ([]FloatPoint, error) {
 	m := make(map[string]*stringReduceFloatPoint)
 	for {
 		// Read next point.
-		curr, err := itr.input.NextInWindow(startTime, endTime)
+		curr, err := itr.input.NextInWindow(itr.opt.windowBounds(startTime, endTime))
 		if err != nil {
 			return nil, err
 		} else if curr == nil {
 			break
-		} else if curr.Nil {
+		} else if curr.Nil && !itr.opt.KeepEmpty {
 			continue
 		}
 		tags := curr.Tags.Subset(itr.dims)
@@ -6380,10 +7223,15 @@ func (itr *stringReduceFloatIterator) reduce() ([]FloatPoint, error) {
 				Tags:       tags,
 				Aggregator: aggregator,
 				Emitter:    emitter,
+				Nil:        true,
 			}
 			m[id] = rp
 		}
+		if curr.Nil {
+			continue
+		}
 		rp.Aggregator.AggregateString(curr)
+		rp.Nil = false
 	}
 
 	// Reverse sort points by name & tag.
@@ -6400,7 +7248,12 @@ func (itr *stringReduceFloatIterator) reduce() ([]FloatPoint, error) {
 	a := make([]FloatPoint, 0, len(m))
 	for _, k := range keys {
 		rp := m[k]
-		points := rp.Emitter.Emit()
+		var points []FloatPoint
+		if rp.Nil {
+			points = []FloatPoint{{Time: ZeroTime, Nil: true}}
+		} else {
+			points = rp.Emitter.Emit()
+		}
 		for i := len(points) - 1; i >= 0; i-- {
 			points[i].Name = rp.Name
 			points[i].Tags = rp.Tags
@@ -6430,6 +7283,10 @@ type stringStreamFloatIterator struct {
 	opt    IteratorOptions
 	m      map[string]*stringReduceFloatPoint
 	points []FloatPoint
+
+	// pointsFilled is true if the buffered points were emitted for an
+	// input point that was generated by a fill.
+	pointsFilled bool
 }
 
 // newStringStreamFloatIterator returns a new instance of stringStreamFloatIterator.
@@ -6449,6 +7306,10 @@ func (itr *stringStreamFloatIterator) Stats() IteratorStats { return itr.input.S
 // Close closes the iterator and all child iterators.
 func (itr *stringStreamFloatIterator) Close() error { return itr.input.Close() }
 
+// filled returns true if the last point was emitted for an input point that
+// was generated by a fill.
+func (itr *stringStreamFloatIterator) filled() bool { return itr.pointsFilled }
+
 // Next returns the next value for the stream iterator.
 func (itr *stringStreamFloatIterator) Next() (*FloatPoint, error) {
 	// Calculate next window if we have no more points.
@@ -6508,6 +7369,7 @@ func (itr *stringStreamFloatIterator) reduce() ([]FloatPoint, error) {
 			points[i].Name = rp.Name
 			points[i].Tags = rp.Tags
 		}
+		itr.pointsFilled = itr.input.filled()
 		return points, nil
 	}
 }
@@ -6520,12 +7382,16 @@ type stringFloatExprIterator struct {
 	fn        stringFloatExprFunc
 	points    []StringPoint // must be size 2
 	storePrev bool
+
+	// lastFilled is true if the last point was computed from a point
+	// generated by a fill, either by the inputs or by this iterator.
+	lastFilled bool
 }
 
 func newStringFloatExprIterator(left, right StringIterator, opt IteratorOptions, fn func(a, b string) float64) *stringFloatExprIterator {
 	var points []StringPoint
 	switch opt.Fill {
-	case NullFill, PreviousFill:
+	case NullFill, PreviousFill, NextFill:
 		points = []StringPoint{{Nil: true}, {Nil: true}}
 	case NumberFill:
 		value := castToString(opt.FillValue)
@@ -6552,6 +7418,9 @@ func (itr *stringFloatExprIterator) Close() error {
 	return nil
 }
 
+// filled returns true if the last point was generated by a fill.
+func (itr *stringFloatExprIterator) filled() bool { return itr.lastFilled }
+
 func (itr *stringFloatExprIterator) Next() (*FloatPoint, error) {
 	for {
 		a, b, err := itr.next()
@@ -6564,6 +7433,9 @@ func (itr *stringFloatExprIterator) Next() (*FloatPoint, error) {
 			continue
 		}
 
+		// A missing point is filled below, so the result counts as filled too.
+		itr.lastFilled = a == nil || b == nil || itr.left.filled() || itr.right.filled()
+
 		// If one of the two points is nil, we need to fill it with a fake nil
 		// point that has the same name, tags, and time as the other point.
 		// There should never be a time when both of these are nil.
@@ -6703,6 +7575,9 @@ type stringReduceIntegerPoint struct {
 	Tags       Tags
 	Aggregator StringPointAggregator
 	Emitter    IntegerPointEmitter
+
+	// Nil is true while only null points were read for the group.
+	Nil bool
 }
 
 // reduce executes fn once for every point in the next window.
@@ -6714,7 +7589,7 @@ func (itr *stringReduceIntegerIterator) reduce() ([]IntegerPoint, error) {
 		p, err := itr.input.Next()
 		if err != nil || p == nil {
 			return nil, err
-		} else if p.Nil {
+		} else if p.Nil && !itr.opt.KeepEmpty {
 			continue
 		}
 
@@ -6728,12 +7603,12 @@ func (itr *stringReduceIntegerIterator) reduce() ([]IntegerPoint, error) {
 	m := make(map[string]*stringReduceIntegerPoint)
 	for {
 		// Read next point.
-		curr, err := itr.input.NextInWindow(startTime, endTime)
+		curr, err := itr.input.NextInWindow(itr.opt.windowBounds(startTime, endTime))
 		if err != nil {
 			return nil, err
 		} else if curr == nil {
 			break
-		} else if curr.Nil {
+		} else if curr.Nil && !itr.opt.KeepEmpty {
 			continue
 		}
 		tags := curr.Tags.Subset(itr.dims)
@@ -6752,10 +7627,15 @@ func (itr *stringReduceIntegerIterator) reduce() ([]IntegerPoint, error) {
 				Tags:       tags,
 				Aggregator: aggregator,
 				Emitter:    emitter,
+				Nil:        true,
 			}
 			m[id] = rp
 		}
+		if curr.Nil {
+			continue
+		}
 		rp.Aggregator.AggregateString(curr)
+		rp.Nil = false
 	}
 
 	// Reverse sort points by name & tag.
@@ -6772,7 +7652,12 @@ func (itr *stringReduceIntegerIterator) reduce() ([]IntegerPoint, error) {
 	a := make([]IntegerPoint, 0, len(m))
 	for _, k := range keys {
 		rp := m[k]
-		points := rp.Emitter.Emit()
+		var points []IntegerPoint
+		if rp.Nil {
+			points = []IntegerPoint{{Time: ZeroTime, Nil: true}}
+		} else {
+			points = rp.Emitter.Emit()
+		}
 		for i := len(points) - 1; i >= 0; i-- {
 			points[i].Name = rp.Name
 			points[i].Tags = rp.Tags
@@ -6802,6 +7687,10 @@ type stringStreamIntegerIterator struct {
 	opt    IteratorOptions
 	m      map[string]*stringReduceIntegerPoint
 	points []IntegerPoint
+
+	// pointsFilled is true if the buffered points were emitted for an
+	// input point that was generated by a fill.
+	pointsFilled bool
 }
 
 // newStringStreamIntegerIterator returns a new instance of stringStreamIntegerIterator.
@@ -6821,6 +7710,10 @@ func (itr *stringStreamIntegerIterator) Stats() IteratorStats { return itr.input
 // Close closes the iterator and all child iterators.
 func (itr *stringStreamIntegerIterator) Close() error { return itr.input.Close() }
 
+// filled returns true if the last point was emitted for an input point that
+// was generated by a fill.
+func (itr *stringStreamIntegerIterator) filled() bool { return itr.pointsFilled }
+
 // Next returns the next value for the stream iterator.
 func (itr *stringStreamIntegerIterator) Next() (*IntegerPoint, error) {
 	// Calculate next window if we have no more points.
@@ -6880,6 +7773,7 @@ func (itr *stringStreamIntegerIterator) reduce() ([]IntegerPoint, error) {
 			points[i].Name = rp.Name
 			points[i].Tags = rp.Tags
 		}
+		itr.pointsFilled = itr.input.filled()
 		return points, nil
 	}
 }
@@ -6892,12 +7786,16 @@ type stringIntegerExprIterator struct {
 	fn        stringIntegerExprFunc
 	points    []StringPoint // must be size 2
 	storePrev bool
+
+	// lastFilled is true if the last point was computed from a point
+	// generated by a fill, either by the inputs or by this iterator.
+	lastFilled bool
 }
 
 func newStringIntegerExprIterator(left, right StringIterator, opt IteratorOptions, fn func(a, b string) int64) *stringIntegerExprIterator {
 	var points []StringPoint
 	switch opt.Fill {
-	case NullFill, PreviousFill:
+	case NullFill, PreviousFill, NextFill:
 		points = []StringPoint{{Nil: true}, {Nil: true}}
 	case NumberFill:
 		value := castToString(opt.FillValue)
@@ -6924,6 +7822,9 @@ func (itr *stringIntegerExprIterator) Close() error {
 	return nil
 }
 
+// filled returns true if the last point was generated by a fill.
+func (itr *stringIntegerExprIterator) filled() bool { return itr.lastFilled }
+
 func (itr *stringIntegerExprIterator) Next() (*IntegerPoint, error) {
 	for {
 		a, b, err := itr.next()
@@ -6936,6 +7837,9 @@ func (itr *stringIntegerExprIterator) Next() (*IntegerPoint, error) {
 			continue
 		}
 
+		// A missing point is filled below, so the result counts as filled too.
+		itr.lastFilled = a == nil || b == nil || itr.left.filled() || itr.right.filled()
+
 		// If one of the two points is nil, we need to fill it with a fake nil
 		// point that has the same name, tags, and time as the other point.
 		// There should never be a time when both of these are nil.
@@ -7075,6 +7979,9 @@ type stringReduceStringPoint struct {
 	Tags       Tags
 	Aggregator StringPointAggregator
 	Emitter    StringPointEmitter
+
+	// Nil is true while only null points were read for the group.
+	Nil bool
 }
 
 // reduce executes fn once for every point in the next window.
@@ -7086,7 +7993,7 @@ func (itr *stringReduceStringIterator) reduce() ([]StringPoint, error) {
 		p, err := itr.input.Next()
 		if err != nil || p == nil {
 			return nil, err
-		} else if p.Nil {
+		} else if p.Nil && !itr.opt.KeepEmpty {
 			continue
 		}
 
@@ -7100,12 +8007,12 @@ func (itr *stringReduceStringIterator) reduce() ([]StringPoint, error) {
 	m := make(map[string]*stringReduceStringPoint)
 	for {
 		// Read next point.
-		curr, err := itr.input.NextInWindow(startTime, endTime)
+		curr, err := itr.input.NextInWindow(itr.opt.windowBounds(startTime, endTime))
 		if err != nil {
 			return nil, err
 		} else if curr == nil {
 			break
-		} else if curr.Nil {
+		} else if curr.Nil && !itr.opt.KeepEmpty {
 			continue
 		}
 		tags := curr.Tags.Subset(itr.dims)
@@ -7124,10 +8031,15 @@ func (itr *stringReduceStringIterator) reduce() ([]StringPoint, error) {
 				Tags:       tags,
 				Aggregator: aggregator,
 				Emitter:    emitter,
+				Nil:        true,
 			}
 			m[id] = rp
 		}
+		if curr.Nil {
+			continue
+		}
 		rp.Aggregator.AggregateString(curr)
+		rp.Nil = false
 	}
 
 	// Reverse sort points by name & tag.
@@ -7144,7 +8056,12 @@ func (itr *stringReduceStringIterator) reduce() ([]StringPoint, error) {
 	a := make([]StringPoint, 0, len(m))
 	for _, k := range keys {
 		rp := m[k]
-		points := rp.Emitter.Emit()
+		var points []StringPoint
+		if rp.Nil {
+			points = []StringPoint{{Time: ZeroTime, Nil: true}}
+		} else {
+			points = rp.Emitter.Emit()
+		}
 		for i := len(points) - 1; i >= 0; i-- {
 			points[i].Name = rp.Name
 			points[i].Tags = rp.Tags
@@ -7174,6 +8091,10 @@ type stringStreamStringIterator struct {
 	opt    IteratorOptions
 	m      map[string]*stringReduceStringPoint
 	points []StringPoint
+
+	// pointsFilled is true if the buffered points were emitted for an
+	// input point that was generated by a fill.
+	pointsFilled bool
 }
 
 // newStringStreamStringIterator returns a new instance of stringStreamStringIterator.
@@ -7193,6 +8114,10 @@ func (itr *stringStreamStringIterator) Stats() IteratorStats { return itr.input.
 // Close closes the iterator and all child iterators.
 func (itr *stringStreamStringIterator) Close() error { return itr.input.Close() }
 
+// filled returns true if the last point was emitted for an input point that
+// was generated by a fill.
+func (itr *stringStreamStringIterator) filled() bool { return itr.pointsFilled }
+
 // Next returns the next value for the stream iterator.
 func (itr *stringStreamStringIterator) Next() (*StringPoint, error) {
 	// Calculate next window if we have no more points.
@@ -7252,6 +8177,7 @@ func (itr *stringStreamStringIterator) reduce() ([]StringPoint, error) {
 			points[i].Name = rp.Name
 			points[i].Tags = rp.Tags
 		}
+		itr.pointsFilled = itr.input.filled()
 		return points, nil
 	}
 }
@@ -7264,12 +8190,16 @@ type stringExprIterator struct {
 	fn        stringExprFunc
 	points    []StringPoint // must be size 2
 	storePrev bool
+
+	// lastFilled is true if the last point was computed from a point
+	// generated by a fill, either by the inputs or by this iterator.
+	lastFilled bool
 }
 
 func newStringExprIterator(left, right StringIterator, opt IteratorOptions, fn func(a, b string) string) *stringExprIterator {
 	var points []StringPoint
 	switch opt.Fill {
-	case NullFill, PreviousFill:
+	case NullFill, PreviousFill, NextFill:
 		points = []StringPoint{{Nil: true}, {Nil: true}}
 	case NumberFill:
 		value := castToString(opt.FillValue)
@@ -7296,6 +8226,9 @@ func (itr *stringExprIterator) Close() error {
 	return nil
 }
 
+// filled returns true if the last point was generated by a fill.
+func (itr *stringExprIterator) filled() bool { return itr.lastFilled }
+
 func (itr *stringExprIterator) Next() (*StringPoint, error) {
 	for {
 		a, b, err := itr.next()
@@ -7308,6 +8241,9 @@ func (itr *stringExprIterator) Next() (*StringPoint, error) {
 			continue
 		}
 
+		// A missing point is filled below, so the result counts as filled too.
+		itr.lastFilled = a == nil || b == nil || itr.left.filled() || itr.right.filled()
+
 		// If one of the two points is nil, we need to fill it with a fake nil
 		// point that has the same name, tags, and time as the other point.
 		// There should never be a time when both of these are nil.
@@ -7443,6 +8379,9 @@ type stringReduceBooleanPoint struct {
 	Tags       Tags
 	Aggregator StringPointAggregator
 	Emitter    BooleanPointEmitter
+
+	// Nil is true while only null points were read for the group.
+	Nil bool
 }
 
 // reduce executes fn once for every point in the next window.
@@ -7454,7 +8393,7 @@ func (itr *stringReduceBooleanIterator) reduce() ([]BooleanPoint, error) {
 		p, err := itr.input.Next()
 		if err != nil || p == nil {
 			return nil, err
-		} else if p.Nil {
+		} else if p.Nil && !itr.opt.KeepEmpty {
 			continue
 		}
 
@@ -7468,12 +8407,12 @@ func (itr *stringReduceBooleanIterator) reduce() ([]BooleanPoint, error) {
 	m := make(map[string]*stringReduceBooleanPoint)
 	for {
 		// Read next point.
-		curr, err := itr.input.NextInWindow(startTime, endTime)
+		curr, err := itr.input.NextInWindow(itr.opt.windowBounds(startTime, endTime))
 		if err != nil {
 			return nil, err
 		} else if curr == nil {
 			break
-		} else if curr.Nil {
+		} else if curr.Nil && !itr.opt.KeepEmpty {
 			continue
 		}
 		tags := curr.Tags.Subset(itr.dims)
@@ -7492,10 +8431,15 @@ func (itr *stringReduceBooleanIterator) reduce() ([]BooleanPoint, error) {
 				Tags:       tags,
 				Aggregator: aggregator,
 				Emitter:    emitter,
+				Nil:        true,
 			}
 			m[id] = rp
 		}
+		if curr.Nil {
+			continue
+		}
 		rp.Aggregator.AggregateString(curr)
+		rp.Nil = false
 	}
 
 	// Reverse sort points by name & tag.
@@ -7512,7 +8456,12 @@ func (itr *stringReduceBooleanIterator) reduce() ([]BooleanPoint, error) {
 	a := make([]BooleanPoint, 0, len(m))
 	for _, k := range keys {
 		rp := m[k]
-		points := rp.Emitter.Emit()
+		var points []BooleanPoint
+		if rp.Nil {
+			points = []BooleanPoint{{Time: ZeroTime, Nil: true}}
+		} else {
+			points = rp.Emitter.Emit()
+		}
 		for i := len(points) - 1; i >= 0; i-- {
 			points[i].Name = rp.Name
 			points[i].Tags = rp.Tags
@@ -7542,6 +8491,10 @@ type stringStreamBooleanIterator struct {
 	opt    IteratorOptions
 	m      map[string]*stringReduceBooleanPoint
 	points []BooleanPoint
+
+	// pointsFilled is true if the buffered points were emitted for an
+	// input point that was generated by a fill.
+	pointsFilled bool
 }
 
 // newStringStreamBooleanIterator returns a new instance of stringStreamBooleanIterator.
@@ -7561,6 +8514,10 @@ func (itr *stringStreamBooleanIterator) Stats() IteratorStats { return itr.input
 // Close closes the iterator and all child iterators.
 func (itr *stringStreamBooleanIterator) Close() error { return itr.input.Close() }
 
+// filled returns true if the last point was emitted for an input point that
+// was generated by a fill.
+func (itr *stringStreamBooleanIterator) filled() bool { return itr.pointsFilled }
+
 // Next returns the next value for the stream iterator.
 func (itr *stringStreamBooleanIterator) Next() (*BooleanPoint, error) {
 	// Calculate next window if we have no more points.
@@ -7620,6 +8577,7 @@ func (itr *stringStreamBooleanIterator) reduce() ([]BooleanPoint, error) {
 			points[i].Name = rp.Name
 			points[i].Tags = rp.Tags
 		}
+		itr.pointsFilled = itr.input.filled()
 		return points, nil
 	}
 }
@@ -7632,12 +8590,16 @@ type stringBooleanExprIterator struct {
 	fn        stringBooleanExprFunc
 	points    []StringPoint // must be size 2
 	storePrev bool
+
+	// lastFilled is true if the last point was computed from a point
+	// generated by a fill, either by the inputs or by this iterator.
+	lastFilled bool
 }
 
 func newStringBooleanExprIterator(left, right StringIterator, opt IteratorOptions, fn func(a, b string) bool) *stringBooleanExprIterator {
 	var points []StringPoint
 	switch opt.Fill {
-	case NullFill, PreviousFill:
+	case NullFill, PreviousFill, NextFill:
 		points = []StringPoint{{Nil: true}, {Nil: true}}
 	case NumberFill:
 		value := castToString(opt.FillValue)
@@ -7664,6 +8626,9 @@ func (itr *stringBooleanExprIterator) Close() error {
 	return nil
 }
 
+// filled returns true if the last point was generated by a fill.
+func (itr *stringBooleanExprIterator) filled() bool { return itr.lastFilled }
+
 func (itr *stringBooleanExprIterator) Next() (*BooleanPoint, error) {
 	for {
 		a, b, err := itr.next()
@@ -7676,6 +8641,9 @@ func (itr *stringBooleanExprIterator) Next() (*BooleanPoint, error) {
 			continue
 		}
 
+		// A missing point is filled below, so the result counts as filled too.
+		itr.lastFilled = a == nil || b == nil || itr.left.filled() || itr.right.filled()
+
 		// If one of the two points is nil, we need to fill it with a fake nil
 		// point that has the same name, tags, and time as the other point.
 		// There should never be a time when both of these are nil.
@@ -7781,6 +8749,9 @@ func (itr *stringTransformIterator) Stats() IteratorStats { return itr.input.Sta
 // Close closes the iterator and all child iterators.
 func (itr *stringTransformIterator) Close() error { return itr.input.Close() }
 
+// filled returns true if the last point was generated by a fill.
+func (itr *stringTransformIterator) filled() bool { return isFilled(itr.input) }
+
 // Next returns the minimum value for the next available interval.
 func (itr *stringTransformIterator) Next() (*StringPoint, error) {
 	p, err := itr.input.Next()
@@ -7810,6 +8781,9 @@ func (itr *stringBoolTransformIterator) Stats() IteratorStats { return itr.input
 // Close closes the iterator and all child iterators.
 func (itr *stringBoolTransformIterator) Close() error { return itr.input.Close() }
 
+// filled returns true if the last point was generated by a fill.
+func (itr *stringBoolTransformIterator) filled() bool { return isFilled(itr.input) }
+
 // Next returns the minimum value for the next available interval.
 func (itr *stringBoolTransformIterator) Next() (*BooleanPoint, error) {
 	p, err := itr.input.Next()
@@ -7934,6 +8908,46 @@ func (itr *stringDedupeIterator) Next() (*StringPoint, error) {
 	}
 }
 
+// stringTimeDedupeIterator only outputs the first point for each series
+// and timestamp. It is used to drop the rows repeated by subqueries that
+// overlap and, like the DedupeIterator, keeps every key it has seen.
+type stringTimeDedupeIterator struct {
+	input StringIterator
+	m     map[timeDedupeKey]struct{} // lookup of series and times already sent
+}
+
+// newStringTimeDedupeIterator returns a new instance of stringTimeDedupeIterator.
+func newStringTimeDedupeIterator(input StringIterator) *stringTimeDedupeIterator {
+	return &stringTimeDedupeIterator{
+		input: input,
+		m:     make(map[timeDedupeKey]struct{}),
+	}
+}
+
+// Stats returns stats from the input iterator.
+func (itr *stringTimeDedupeIterator) Stats() IteratorStats { return itr.input.Stats() }
+
+// Close closes the iterator and all child iterators.
+func (itr *stringTimeDedupeIterator) Close() error { return itr.input.Close() }
+
+// Next returns the next point from the input iterator whose series and time
+// have not been output yet.
+func (itr *stringTimeDedupeIterator) Next() (*StringPoint, error) {
+	for {
+		p, err := itr.input.Next()
+		if p == nil || err != nil {
+			return nil, err
+		}
+
+		key := timeDedupeKey{name: p.Name, tags: p.Tags.ID(), time: p.Time}
+		if _, ok := itr.m[key]; ok {
+			continue
+		}
+		itr.m[key] = struct{}{}
+		return p, nil
+	}
+}
+
 // stringReaderIterator represents an iterator that streams from a reader.
 type stringReaderIterator struct {
 	r   io.Reader
@@ -8003,6 +9017,11 @@ func newBooleanIterators(itrs []Iterator) []BooleanIterator {
 type bufBooleanIterator struct {
 	itr BooleanIterator
 	buf *BooleanPoint
+
+	// lastFilled and bufFilled record whether the last returned point and
+	// the buffered point were generated by a fill.
+	lastFilled bool
+	bufFilled  bool
 }
 
 // newBufBooleanIterator returns a buffered BooleanIterator.
@@ -8041,9 +9060,12 @@ func (itr *bufBooleanIterator) Next() (*BooleanPoint, error) {
 	buf := itr.buf
 	if buf != nil {
 		itr.buf = nil
+		itr.lastFilled = itr.bufFilled
 		return buf, nil
 	}
-	return itr.itr.Next()
+	p, err := itr.itr.Next()
+	itr.lastFilled = isFilled(itr.itr)
+	return p, err
 }
 
 // NextInWindow returns the next value if it is between [startTime, endTime).
@@ -8060,7 +9082,13 @@ func (itr *bufBooleanIterator) NextInWindow(startTime, endTime int64) (*BooleanP
 }
 
 // unread sets v to the buffer. It is read on the next call to Next().
-func (itr *bufBooleanIterator) unread(v *BooleanPoint) { itr.buf = v }
+func (itr *bufBooleanIterator) unread(v *BooleanPoint) {
+	itr.buf = v
+	itr.bufFilled = itr.lastFilled
+}
+
+// filled returns true if the last point was generated by a fill.
+func (itr *bufBooleanIterator) filled() bool { return itr.lastFilled }
 
 // booleanMergeIterator represents an iterator that combines multiple boolean iterators.
 type booleanMergeIterator struct {
@@ -8089,12 +9117,12 @@ func newBooleanMergeIterator(inputs []BooleanIterator, opt IteratorOptions) *boo
 	}
 
 	// Initialize heap items.
-	for _, input := range inputs {
+	for i, input := range inputs {
 		// Wrap in buffer, ignore any inputs without anymore points.
 		bufInput := newBufBooleanIterator(input)
 
 		// Append to the heap.
-		itr.heap.items = append(itr.heap.items, &booleanMergeHeapItem{itr: bufInput})
+		itr.heap.items = append(itr.heap.items, &booleanMergeHeapItem{itr: bufInput, index: i})
 	}
 
 	return itr
@@ -8157,7 +9185,7 @@ func (itr *booleanMergeIterator) Next() (*BooleanPoint, error) {
 			}
 			tags := p.Tags.Subset(itr.heap.opt.Dimensions)
 			itr.window.name, itr.window.tags = p.Name, tags.ID()
-			itr.window.startTime, itr.window.endTime = itr.heap.opt.Window(p.Time)
+			itr.window.startTime, itr.window.endTime = itr.heap.opt.windowBounds(itr.heap.opt.Window(p.Time))
 			return p, nil
 		}
 
@@ -8233,6 +9261,12 @@ func (h *booleanMergeHeap) Less(i, j int) bool {
 	xt, _ := h.opt.Window(x.Time)
 	yt, _ := h.opt.Window(y.Time)
 
+	// Break ties by input when requested so points from series that have
+	// the same tags after projection are always merged in the same order.
+	if xt == yt && h.opt.StableMerge {
+		return h.items[i].index < h.items[j].index
+	}
+
 	if h.opt.Ascending {
 		return xt < yt
 	}
@@ -8252,7 +9286,8 @@ func (h *booleanMergeHeap) Pop() interface{} {
 }
 
 type booleanMergeHeapItem struct {
-	itr *bufBooleanIterator
+	itr   *bufBooleanIterator
+	index int
 }
 
 // booleanSortedMergeIterator is an iterator that sorts and merges multiple iterators into one.
@@ -8273,9 +9308,9 @@ func newBooleanSortedMergeIterator(inputs []BooleanIterator, opt IteratorOptions
 	}
 
 	// Initialize heap items.
-	for _, input := range inputs {
+	for i, input := range inputs {
 		// Append to the heap.
-		itr.heap.items = append(itr.heap.items, &booleanSortedMergeHeapItem{itr: input})
+		itr.heap.items = append(itr.heap.items, &booleanSortedMergeHeapItem{itr: input, index: i})
 	}
 
 	return itr
@@ -8361,6 +9396,9 @@ func (h *booleanSortedMergeHeap) Less(i, j int) bool {
 		} else if xTags, yTags := x.Tags.Subset(h.opt.Dimensions), y.Tags.Subset(h.opt.Dimensions); !xTags.Equals(&yTags) {
 			return xTags.ID() < yTags.ID()
 		}
+		if x.Time == y.Time && h.opt.StableMerge {
+			return h.items[i].index < h.items[j].index
+		}
 		return x.Time < y.Time
 	}
 
@@ -8369,6 +9407,9 @@ func (h *booleanSortedMergeHeap) Less(i, j int) bool {
 	} else if xTags, yTags := x.Tags.Subset(h.opt.Dimensions), y.Tags.Subset(h.opt.Dimensions); !xTags.Equals(&yTags) {
 		return xTags.ID() > yTags.ID()
 	}
+	if x.Time == y.Time && h.opt.StableMerge {
+		return h.items[i].index < h.items[j].index
+	}
 	return x.Time > y.Time
 }
 
@@ -8388,6 +9429,7 @@ type booleanSortedMergeHeapItem struct {
 	point *BooleanPoint
 	err   error
 	itr   BooleanIterator
+	index int
 }
 
 // booleanParallelIterator represents an iterator that pulls data in a separate goroutine.
@@ -8401,10 +9443,10 @@ type booleanParallelIterator struct {
 }
 
 // newBooleanParallelIterator returns a new instance of booleanParallelIterator.
-func newBooleanParallelIterator(input BooleanIterator) *booleanParallelIterator {
+func newBooleanParallelIterator(input BooleanIterator, size int) *booleanParallelIterator {
 	itr := &booleanParallelIterator{
 		input:   input,
-		ch:      make(chan booleanPointError, 256),
+		ch:      make(chan booleanPointError, size),
 		closing: make(chan struct{}),
 	}
 	itr.wg.Add(1)
@@ -8456,6 +9498,92 @@ type booleanPointError struct {
 	err   error
 }
 
+// booleanBufferedIterator represents an iterator that reads all of its input
+// in a separate goroutine without waiting for the points to be read.
+type booleanBufferedIterator struct {
+	input BooleanIterator
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	points []*BooleanPoint
+	err    error
+	done   bool
+	closed bool
+
+	wg sync.WaitGroup
+}
+
+// newBooleanBufferedIterator returns a new instance of booleanBufferedIterator.
+func newBooleanBufferedIterator(input BooleanIterator) *booleanBufferedIterator {
+	itr := &booleanBufferedIterator{input: input}
+	itr.cond = sync.NewCond(&itr.mu)
+	itr.wg.Add(1)
+	go itr.monitor()
+	return itr
+}
+
+// Stats returns stats from the underlying iterator.
+func (itr *booleanBufferedIterator) Stats() IteratorStats { return itr.input.Stats() }
+
+// Close closes the underlying iterator and waits for the goroutine to exit.
+func (itr *booleanBufferedIterator) Close() error {
+	itr.mu.Lock()
+	itr.closed, itr.points = true, nil
+	itr.cond.Broadcast()
+	itr.mu.Unlock()
+
+	err := itr.input.Close()
+	itr.wg.Wait()
+	return err
+}
+
+// Next returns the next point from the iterator.
+func (itr *booleanBufferedIterator) Next() (*BooleanPoint, error) {
+	itr.mu.Lock()
+	defer itr.mu.Unlock()
+
+	for len(itr.points) == 0 && !itr.done && !itr.closed {
+		itr.cond.Wait()
+	}
+	if len(itr.points) == 0 {
+		return nil, itr.err
+	}
+
+	p := itr.points[0]
+	itr.points[0] = nil
+	itr.points = itr.points[1:]
+	return p, nil
+}
+
+// monitor runs in a separate goroutine and reads the input until it is done.
+func (itr *booleanBufferedIterator) monitor() {
+	defer itr.wg.Done()
+
+	for {
+		p, err := itr.input.Next()
+		if p != nil {
+			p = p.Clone()
+		}
+
+		itr.mu.Lock()
+		if itr.closed {
+			itr.mu.Unlock()
+			return
+		} else if p == nil || err != nil {
+			itr.err, itr.done = err, true
+		} else {
+			itr.points = append(itr.points, p)
+		}
+		done := itr.done
+		itr.cond.Signal()
+		itr.mu.Unlock()
+
+		if done {
+			return
+		}
+	}
+}
+
 // booleanLimitIterator represents an iterator that limits points per group.
 type booleanLimitIterator struct {
 	input BooleanIterator
@@ -8482,6 +9610,9 @@ func (itr *booleanLimitIterator) Stats() IteratorStats { return itr.input.Stats(
 // Close closes the underlying iterators.
 func (itr *booleanLimitIterator) Close() error { return itr.input.Close() }
 
+// filled returns true if the last point was generated by a fill.
+func (itr *booleanLimitIterator) filled() bool { return isFilled(itr.input) }
+
 // Next returns the next point from the iterator.
 func (itr *booleanLimitIterator) Next() (*BooleanPoint, error) {
 	for {
@@ -8515,13 +9646,14 @@ func (itr *booleanLimitIterator) Next() (*BooleanPoint, error) {
 }
 
 type booleanFillIterator struct {
-	input     *bufBooleanIterator
-	prev      BooleanPoint
-	startTime int64
-	endTime   int64
-	auxFields []interface{}
-	init      bool
-	opt       IteratorOptions
+	input      *bufBooleanIterator
+	prev       BooleanPoint
+	startTime  int64
+	endTime    int64
+	auxFields  []interface{}
+	init       bool
+	lastFilled bool
+	opt        IteratorOptions
 
 	window struct {
 		name string
@@ -8565,6 +9697,9 @@ func newBooleanFillIterator(input BooleanIterator, expr Expr, opt IteratorOption
 func (itr *booleanFillIterator) Stats() IteratorStats { return itr.input.Stats() }
 func (itr *booleanFillIterator) Close() error         { return itr.input.Close() }
 
+// filled returns true if the last point was generated by a fill.
+func (itr *booleanFillIterator) filled() bool { return itr.lastFilled }
+
 func (itr *booleanFillIterator) Next() (*BooleanPoint, error) {
 	if !itr.init {
 		p, err := itr.input.peek()
@@ -8617,6 +9752,7 @@ func (itr *booleanFillIterator) Next() (*BooleanPoint, error) {
 		if p != nil {
 			itr.input.unread(p)
 		}
+		itr.lastFilled = true
 
 		p = &BooleanPoint{
 			Name: itr.window.name,
@@ -8639,9 +9775,20 @@ func (itr *booleanFillIterator) Next() (*BooleanPoint, error) {
 			} else {
 				p.Nil = true
 			}
+		case NextFill:
+			next, err := itr.input.peek()
+			if err != nil {
+				return nil, err
+			} else if next != nil && next.Name == itr.window.name && next.Tags.ID() == itr.window.tags.ID() {
+				p.Value = next.Value
+				p.Nil = next.Nil
+			} else {
+				p.Nil = true
+			}
 		}
 	} else {
 		itr.prev = *p
+		itr.lastFilled = false
 	}
 
 	// Advance the expected time. Do not advance to a new window here
@@ -8652,6 +9799,14 @@ func (itr *booleanFillIterator) Next() (*BooleanPoint, error) {
 	} else {
 		itr.window.time = p.Time - int64(itr.opt.Interval.Duration)
 	}
+
+	// Keep the expected time on a window edge if the zone offset changes
+	// before it, such as for daylight saving time.
+	if itr.opt.Location != nil {
+		if o := itr.opt.zoneOffset(p.Time) - itr.opt.zoneOffset(itr.window.time); o != 0 && abs(o) < int64(itr.opt.Interval.Duration) {
+			itr.window.time += o
+		}
+	}
 	return p, nil
 }
 
@@ -8695,6 +9850,7 @@ func newBooleanInterruptIterator(input BooleanIterator, closing <-chan struct{})
 
 func (itr *booleanInterruptIterator) Stats() IteratorStats { return itr.input.Stats() }
 func (itr *booleanInterruptIterator) Close() error         { return itr.input.Close() }
+func (itr *booleanInterruptIterator) filled() bool         { return isFilled(itr.input) }
 
 func (itr *booleanInterruptIterator) Next() (*BooleanPoint, error) {
 	// Only check if the channel is closed every N points. This
@@ -8770,8 +9926,9 @@ func (itr *booleanCloseInterruptIterator) Next() (*BooleanPoint, error) {
 
 // auxBooleanPoint represents a combination of a point and an error for the AuxIterator.
 type auxBooleanPoint struct {
-	point *BooleanPoint
-	err   error
+	point  *BooleanPoint
+	filled bool
+	err    error
 }
 
 // booleanAuxIterator represents a boolean implementation of AuxIterator.
@@ -8780,14 +9937,17 @@ type booleanAuxIterator struct {
 	output     chan auxBooleanPoint
 	fields     *auxIteratorFields
 	background bool
+	lastFilled bool
 }
 
 func newBooleanAuxIterator(input BooleanIterator, opt IteratorOptions) *booleanAuxIterator {
-	return &booleanAuxIterator{
+	itr := &booleanAuxIterator{
 		input:  newBufBooleanIterator(input),
 		output: make(chan auxBooleanPoint, 1),
 		fields: newAuxIteratorFields(opt),
 	}
+	itr.fields.stats = itr.input.Stats
+	return itr
 }
 
 func (itr *booleanAuxIterator) Background() {
@@ -8801,8 +9961,10 @@ func (itr *booleanAuxIterator) Stats() IteratorStats { return itr.input.Stats()
 func (itr *booleanAuxIterator) Close() error         { return itr.input.Close() }
 func (itr *booleanAuxIterator) Next() (*BooleanPoint, error) {
 	p := <-itr.output
+	itr.lastFilled = p.filled
 	return p.point, p.err
 }
+func (itr *booleanAuxIterator) filled() bool { return itr.lastFilled }
 func (itr *booleanAuxIterator) Iterator(name string, typ DataType) Iterator {
 	return itr.fields.iterator(name, typ)
 }
@@ -8820,8 +9982,9 @@ func (itr *booleanAuxIterator) stream() {
 		}
 
 		// Send point to output and to each field iterator.
-		itr.output <- auxBooleanPoint{point: p}
-		if ok := itr.fields.send(p); !ok && itr.background {
+		filled := itr.input.filled()
+		itr.output <- auxBooleanPoint{point: p, filled: filled}
+		if ok := itr.fields.send(p, filled); !ok && itr.background {
 			break
 		}
 	}
@@ -8836,13 +9999,23 @@ type booleanChanIterator struct {
 		i      int
 		filled bool
 		points [2]BooleanPoint
+
+		// fill is true if the buffered point was generated by a fill.
+		fill bool
 	}
-	err  error
-	cond *sync.Cond
-	done bool
+	err        error
+	cond       *sync.Cond
+	done       bool
+	stats      func() IteratorStats
+	lastFilled bool
 }
 
-func (itr *booleanChanIterator) Stats() IteratorStats { return IteratorStats{} }
+func (itr *booleanChanIterator) Stats() IteratorStats {
+	if itr.stats == nil {
+		return IteratorStats{}
+	}
+	return itr.stats()
+}
 
 func (itr *booleanChanIterator) Close() error {
 	itr.cond.L.Lock()
@@ -8854,7 +10027,7 @@ func (itr *booleanChanIterator) Close() error {
 	return nil
 }
 
-func (itr *booleanChanIterator) setBuf(name string, tags Tags, time int64, value interface{}) bool {
+func (itr *booleanChanIterator) setBuf(name string, tags Tags, time int64, value interface{}, fill bool) bool {
 	itr.cond.L.Lock()
 	defer itr.cond.L.Unlock()
 
@@ -8878,6 +10051,7 @@ func (itr *booleanChanIterator) setBuf(name string, tags Tags, time int64, value
 	default:
 		itr.buf.points[itr.buf.i] = BooleanPoint{Name: name, Tags: tags, Time: time, Nil: true}
 	}
+	itr.buf.fill = fill
 	itr.buf.filled = true
 
 	// Signal to all waiting goroutines that a new value is ready to read.
@@ -8920,10 +10094,14 @@ func (itr *booleanChanIterator) Next() (*BooleanPoint, error) {
 	p := &itr.buf.points[itr.buf.i]
 	itr.buf.i = (itr.buf.i + 1) % len(itr.buf.points)
 	itr.buf.filled = false
+	itr.lastFilled = itr.buf.fill
 	itr.cond.Signal()
 	return p, nil
 }
 
+// filled returns true if the last point was generated by a fill.
+func (itr *booleanChanIterator) filled() bool { return itr.lastFilled }
+
 // booleanReduceFloatIterator executes a reducer for every interval and buffers the result.
 type booleanReduceFloatIterator struct {
 	input  *bufBooleanIterator
@@ -8971,6 +10149,9 @@ type booleanReduceFloatPoint struct {
 	Tags       Tags
 	Aggregator BooleanPointAggregator
 	Emitter    FloatPointEmitter
+
+	// Nil is true while only null points were read for the group.
+	Nil bool
 }
 
 // reduce executes fn once for every point in the next window.
@@ -8982,7 +10163,7 @@ func (itr *booleanReduceFloatIterator) reduce() ([]FloatPoint, error) {
 		p, err := itr.input.Next()
 		if err != nil || p == nil {
 			return nil, err
-		} else if p.Nil {
+		} else if p.Nil && !itr.opt.KeepEmpty {
 			continue
 		}
 
@@ -8996,12 +10177,12 @@ func (itr *booleanReduceFloatIterator) reduce() ([]FloatPoint, error) {
 	m := make(map[string]*booleanReduceFloatPoint)
 	for {
 		// Read next point.
-		curr, err := itr.input.NextInWindow(startTime, endTime)
+		curr, err := itr.input.NextInWindow(itr.opt.windowBounds(startTime, endTime))
 		if err != nil {
 			return nil, err
 		} else if curr == nil {
 			break
-		} else if curr.Nil {
+		} else if curr.Nil && !itr.opt.KeepEmpty {
 			continue
 		}
 		tags := curr.Tags.Subset(itr.dims)
@@ -9020,10 +10201,15 @@ func (itr *booleanReduceFloatIterator) reduce() ([]FloatPoint, error) {
 				Tags:       tags,
 				Aggregator: aggregator,
 				Emitter:    emitter,
+				Nil:        true,
 			}
 			m[id] = rp
 		}
+		if curr.Nil {
+			continue
+		}
 		rp.Aggregator.AggregateBoolean(curr)
+		rp.Nil = false
 	}
 
 	// Reverse sort points by name & tag.
@@ -9040,7 +10226,12 @@ func (itr *booleanReduceFloatIterator) reduce() ([]FloatPoint, error) {
 	a := make([]FloatPoint, 0, len(m))
 	for _, k := range keys {
 		rp := m[k]
-		points := rp.Emitter.Emit()
+		var points []FloatPoint
+		if rp.Nil {
+			points = []FloatPoint{{Time: ZeroTime, Nil: true}}
+		} else {
+			points = rp.Emitter.Emit()
+		}
 		for i := len(points) - 1; i >= 0; i-- {
 			points[i].Name = rp.Name
 			points[i].Tags = rp.Tags
@@ -9070,6 +10261,10 @@ type booleanStreamFloatIterator struct {
 	opt    IteratorOptions
 	m      map[string]*booleanReduceFloatPoint
 	points []FloatPoint
+
+	// pointsFilled is true if the buffered points were emitted for an
+	// input point that was generated by a fill.
+	pointsFilled bool
 }
 
 // newBooleanStreamFloatIterator returns a new instance of booleanStreamFloatIterator.
@@ -9089,6 +10284,10 @@ func (itr *booleanStreamFloatIterator) Stats() IteratorStats { return itr.input.
 // Close closes the iterator and all child iterators.
 func (itr *booleanStreamFloatIterator) Close() error { return itr.input.Close() }
 
+// filled returns true if the last point was emitted for an input point that
+// was generated by a fill.
+func (itr *booleanStreamFloatIterator) filled() bool { return itr.pointsFilled }
+
 // Next returns the next value for the stream iterator.
 func (itr *booleanStreamFloatIterator) Next() (*FloatPoint, error) {
 	// Calculate next window if we have no more points.
@@ -9148,6 +10347,7 @@ func (itr *booleanStreamFloatIterator) reduce() ([]FloatPoint, error) {
 			points[i].Name = rp.Name
 			points[i].Tags = rp.Tags
 		}
+		itr.pointsFilled = itr.input.filled()
 		return points, nil
 	}
 }
@@ -9160,12 +10360,16 @@ type booleanFloatExprIterator struct {
 	fn        booleanFloatExprFunc
 	points    []BooleanPoint // must be size 2
 	storePrev bool
+
+	// lastFilled is true if the last point was computed from a point
+	// generated by a fill, either by the inputs or by this iterator.
+	lastFilled bool
 }
 
 func newBooleanFloatExprIterator(left, right BooleanIterator, opt IteratorOptions, fn func(a, b bool) float64) *booleanFloatExprIterator {
 	var points []BooleanPoint
 	switch opt.Fill {
-	case NullFill, PreviousFill:
+	case NullFill, PreviousFill, NextFill:
 		points = []BooleanPoint{{Nil: true}, {Nil: true}}
 	case NumberFill:
 		value := castToBoolean(opt.FillValue)
@@ -9192,6 +10396,9 @@ func (itr *booleanFloatExprIterator) Close() error {
 	return nil
 }
 
+// filled returns true if the last point was generated by a fill.
+func (itr *booleanFloatExprIterator) filled() bool { return itr.lastFilled }
+
 func (itr *booleanFloatExprIterator) Next() (*FloatPoint, error) {
 	for {
 		a, b, err := itr.next()
@@ -9204,6 +10411,9 @@ func (itr *booleanFloatExprIterator) Next() (*FloatPoint, error) {
 			continue
 		}
 
+		// A missing point is filled below, so the result counts as filled too.
+		itr.lastFilled = a == nil || b == nil || itr.left.filled() || itr.right.filled()
+
 		// If one of the two points is nil, we need to fill it with a fake nil
 		// point that has the same name, tags, and time as the other point.
 		// There should never be a time when both of these are nil.
@@ -9343,6 +10553,9 @@ type booleanReduceIntegerPoint struct {
 	Tags       Tags
 	Aggregator BooleanPointAggregator
 	Emitter    IntegerPointEmitter
+
+	// Nil is true while only null points were read for the group.
+	Nil bool
 }
 
 // reduce executes fn once for every point in the next window.
@@ -9354,7 +10567,7 @@ func (itr *booleanReduceIntegerIterator) reduce() ([]IntegerPoint, error) {
 		p, err := itr.input.Next()
 		if err != nil || p == nil {
 			return nil, err
-		} else if p.Nil {
+		} else if p.Nil && !itr.opt.KeepEmpty {
 			continue
 		}
 
@@ -9368,12 +10581,12 @@ func (itr *booleanReduceIntegerIterator) reduce() ([]IntegerPoint, error) {
 	m := make(map[string]*booleanReduceIntegerPoint)
 	for {
 		// Read next point.
-		curr, err := itr.input.NextInWindow(startTime, endTime)
+		curr, err := itr.input.NextInWindow(itr.opt.windowBounds(startTime, endTime))
 		if err != nil {
 			return nil, err
 		} else if curr == nil {
 			break
-		} else if curr.Nil {
+		} else if curr.Nil && !itr.opt.KeepEmpty {
 			continue
 		}
 		tags := curr.Tags.Subset(itr.dims)
@@ -9392,10 +10605,15 @@ func (itr *booleanReduceIntegerIterator) reduce() ([]IntegerPoint, error) {
 				Tags:       tags,
 				Aggregator: aggregator,
 				Emitter:    emitter,
+				Nil:        true,
 			}
 			m[id] = rp
 		}
+		if curr.Nil {
+			continue
+		}
 		rp.Aggregator.AggregateBoolean(curr)
+		rp.Nil = false
 	}
 
 	// Reverse sort points by name & tag.
@@ -9412,7 +10630,12 @@ func (itr *booleanReduceIntegerIterator) reduce() ([]IntegerPoint, error) {
 	a := make([]IntegerPoint, 0, len(m))
 	for _, k := range keys {
 		rp := m[k]
-		points := rp.Emitter.Emit()
+		var points []IntegerPoint
+		if rp.Nil {
+			points = []IntegerPoint{{Time: ZeroTime, Nil: true}}
+		} else {
+			points = rp.Emitter.Emit()
+		}
 		for i := len(points) - 1; i >= 0; i-- {
 			points[i].Name = rp.Name
 			points[i].Tags = rp.Tags
@@ -9442,6 +10665,10 @@ type booleanStreamIntegerIterator struct {
 	opt    IteratorOptions
 	m      map[string]*booleanReduceIntegerPoint
 	points []IntegerPoint
+
+	// pointsFilled is true if the buffered points were emitted for an
+	// input point that was generated by a fill.
+	pointsFilled bool
 }
 
 // newBooleanStreamIntegerIterator returns a new instance of booleanStreamIntegerIterator.
@@ -9461,6 +10688,10 @@ func (itr *booleanStreamIntegerIterator) Stats() IteratorStats { return itr.inpu
 // Close closes the iterator and all child iterators.
 func (itr *booleanStreamIntegerIterator) Close() error { return itr.input.Close() }
 
+// filled returns true if the last point was emitted for an input point that
+// was generated by a fill.
+func (itr *booleanStreamIntegerIterator) filled() bool { return itr.pointsFilled }
+
 // Next returns the next value for the stream iterator.
 func (itr *booleanStreamIntegerIterator) Next() (*IntegerPoint, error) {
 	// Calculate next window if we have no more points.
@@ -9520,6 +10751,7 @@ func (itr *booleanStreamIntegerIterator) reduce() ([]IntegerPoint, error) {
 			points[i].Name = rp.Name
 			points[i].Tags = rp.Tags
 		}
+		itr.pointsFilled = itr.input.filled()
 		return points, nil
 	}
 }
@@ -9532,12 +10764,16 @@ type booleanIntegerExprIterator struct {
 	fn        booleanIntegerExprFunc
 	points    []BooleanPoint // must be size 2
 	storePrev bool
+
+	// lastFilled is true if the last point was computed from a point
+	// generated by a fill, either by the inputs or by this iterator.
+	lastFilled bool
 }
 
 func newBooleanIntegerExprIterator(left, right BooleanIterator, opt IteratorOptions, fn func(a, b bool) int64) *booleanIntegerExprIterator {
 	var points []BooleanPoint
 	switch opt.Fill {
-	case NullFill, PreviousFill:
+	case NullFill, PreviousFill, NextFill:
 		points = []BooleanPoint{{Nil: true}, {Nil: true}}
 	case NumberFill:
 		value := castToBoolean(opt.FillValue)
@@ -9564,6 +10800,9 @@ func (itr *booleanIntegerExprIterator) Close() error {
 	return nil
 }
 
+// filled returns true if the last point was generated by a fill.
+func (itr *booleanIntegerExprIterator) filled() bool { return itr.lastFilled }
+
 func (itr *booleanIntegerExprIterator) Next() (*IntegerPoint, error) {
 	for {
 		a, b, err := itr.next()
@@ -9576,6 +10815,9 @@ func (itr *booleanIntegerExprIterator) Next() (*IntegerPoint, error) {
 			continue
 		}
 
+		// A missing point is filled below, so the result counts as filled too.
+		itr.lastFilled = a == nil || b == nil || itr.left.filled() || itr.right.filled()
+
 		// If one of the two points is nil, we need to fill it with a fake nil
 		// point that has the same name, tags, and time as the other point.
 		// There should never be a time when both of these are nil.
@@ -9715,6 +10957,9 @@ type booleanReduceStringPoint struct {
 	Tags       Tags
 	Aggregator BooleanPointAggregator
 	Emitter    StringPointEmitter
+
+	// Nil is true while only null points were read for the group.
+	Nil bool
 }
 
 // reduce executes fn once for every point in the next window.
@@ -9726,7 +10971,7 @@ func (itr *booleanReduceStringIterator) reduce() ([]StringPoint, error) {
 		p, err := itr.input.Next()
 		if err != nil || p == nil {
 			return nil, err
-		} else if p.Nil {
+		} else if p.Nil && !itr.opt.KeepEmpty {
 			continue
 		}
 
@@ -9740,12 +10985,12 @@ func (itr *booleanReduceStringIterator) reduce() ([]StringPoint, error) {
 	m := make(map[string]*booleanReduceStringPoint)
 	for {
 		// Read next point.
-		curr, err := itr.input.NextInWindow(startTime, endTime)
+		curr, err := itr.input.NextInWindow(itr.opt.windowBounds(startTime, endTime))
 		if err != nil {
 			return nil, err
 		} else if curr == nil {
 			break
-		} else if curr.Nil {
+		} else if curr.Nil && !itr.opt.KeepEmpty {
 			continue
 		}
 		tags := curr.Tags.Subset(itr.dims)
@@ -9764,10 +11009,15 @@ func (itr *booleanReduceStringIterator) reduce() ([]StringPoint, error) {
 				Tags:       tags,
 				Aggregator: aggregator,
 				Emitter:    emitter,
+				Nil:        true,
 			}
 			m[id] = rp
 		}
+		if curr.Nil {
+			continue
+		}
 		rp.Aggregator.AggregateBoolean(curr)
+		rp.Nil = false
 	}
 
 	// Reverse sort points by name & tag.
@@ -9784,7 +11034,12 @@ func (itr *booleanReduceStringIterator) reduce() ([]StringPoint, error) {
 	a := make([]StringPoint, 0, len(m))
 	for _, k := range keys {
 		rp := m[k]
-		points := rp.Emitter.Emit()
+		var points []StringPoint
+		if rp.Nil {
+			points = []StringPoint{{Time: ZeroTime, Nil: true}}
+		} else {
+			points = rp.Emitter.Emit()
+		}
 		for i := len(points) - 1; i >= 0; i-- {
 			points[i].Name = rp.Name
 			points[i].Tags = rp.Tags
@@ -9814,6 +11069,10 @@ type booleanStreamStringIterator struct {
 	opt    IteratorOptions
 	m      map[string]*booleanReduceStringPoint
 	points []StringPoint
+
+	// pointsFilled is true if the buffered points were emitted for an
+	// input point that was generated by a fill.
+	pointsFilled bool
 }
 
 // newBooleanStreamStringIterator returns a new instance of booleanStreamStringIterator.
@@ -9833,6 +11092,10 @@ func (itr *booleanStreamStringIterator) Stats() IteratorStats { return itr.input
 // Close closes the iterator and all child iterators.
 func (itr *booleanStreamStringIterator) Close() error { return itr.input.Close() }
 
+// filled returns true if the last point was emitted for an input point that
+// was generated by a fill.
+func (itr *booleanStreamStringIterator) filled() bool { return itr.pointsFilled }
+
 // Next returns the next value for the stream iterator.
 func (itr *booleanStreamStringIterator) Next() (*StringPoint, error) {
 	// Calculate next window if we have no more points.
@@ -9892,6 +11155,7 @@ func (itr *booleanStreamStringIterator) reduce() ([]StringPoint, error) {
 			points[i].Name = rp.Name
 			points[i].Tags = rp.Tags
 		}
+		itr.pointsFilled = itr.input.filled()
 		return points, nil
 	}
 }
@@ -9904,12 +11168,16 @@ type booleanStringExprIterator struct {
 	fn        booleanStringExprFunc
 	points    []BooleanPoint // must be size 2
 	storePrev bool
+
+	// lastFilled is true if the last point was computed from a point
+	// generated by a fill, either by the inputs or by this iterator.
+	lastFilled bool
 }
 
 func newBooleanStringExprIterator(left, right BooleanIterator, opt IteratorOptions, fn func(a, b bool) string) *booleanStringExprIterator {
 	var points []BooleanPoint
 	switch opt.Fill {
-	case NullFill, PreviousFill:
+	case NullFill, PreviousFill, NextFill:
 		points = []BooleanPoint{{Nil: true}, {Nil: true}}
 	case NumberFill:
 		value := castToBoolean(opt.FillValue)
@@ -9936,6 +11204,9 @@ func (itr *booleanStringExprIterator) Close() error {
 	return nil
 }
 
+// filled returns true if the last point was generated by a fill.
+func (itr *booleanStringExprIterator) filled() bool { return itr.lastFilled }
+
 func (itr *booleanStringExprIterator) Next() (*StringPoint, error) {
 	for {
 		a, b, err := itr.next()
@@ -9948,6 +11219,9 @@ func (itr *booleanStringExprIterator) Next() (*StringPoint, error) {
 			continue
 		}
 
+		// A missing point is filled below, so the result counts as filled too.
+		itr.lastFilled = a == nil || b == nil || itr.left.filled() || itr.right.filled()
+
 		// If one of the two points is nil, we need to fill it with a fake nil
 		// point that has the same name, tags, and time as the other point.
 		// There should never be a time when both of these are nil.
@@ -10087,6 +11361,9 @@ type booleanReduceBooleanPoint struct {
 	Tags       Tags
 	Aggregator BooleanPointAggregator
 	Emitter    BooleanPointEmitter
+
+	// Nil is true while only null points were read for the group.
+	Nil bool
 }
 
 // reduce executes fn once for every point in the next window.
@@ -10098,7 +11375,7 @@ func (itr *booleanReduceBooleanIterator) reduce() ([]BooleanPoint, error) {
 		p, err := itr.input.Next()
 		if err != nil || p == nil {
 			return nil, err
-		} else if p.Nil {
+		} else if p.Nil && !itr.opt.KeepEmpty {
 			continue
 		}
 
@@ -10112,12 +11389,12 @@ func (itr *booleanReduceBooleanIterator) reduce() ([]BooleanPoint, error) {
 	m := make(map[string]*booleanReduceBooleanPoint)
 	for {
 		// Read next point.
-		curr, err := itr.input.NextInWindow(startTime, endTime)
+		curr, err := itr.input.NextInWindow(itr.opt.windowBounds(startTime, endTime))
 		if err != nil {
 			return nil, err
 		} else if curr == nil {
 			break
-		} else if curr.Nil {
+		} else if curr.Nil && !itr.opt.KeepEmpty {
 			continue
 		}
 		tags := curr.Tags.Subset(itr.dims)
@@ -10136,10 +11413,15 @@ func (itr *booleanReduceBooleanIterator) reduce() ([]BooleanPoint, error) {
 				Tags:       tags,
 				Aggregator: aggregator,
 				Emitter:    emitter,
+				Nil:        true,
 			}
 			m[id] = rp
 		}
+		if curr.Nil {
+			continue
+		}
 		rp.Aggregator.AggregateBoolean(curr)
+		rp.Nil = false
 	}
 
 	// Reverse sort points by name & tag.
@@ -10156,7 +11438,12 @@ func (itr *booleanReduceBooleanIterator) reduce() ([]BooleanPoint, error) {
 	a := make([]BooleanPoint, 0, len(m))
 	for _, k := range keys {
 		rp := m[k]
-		points := rp.Emitter.Emit()
+		var points []BooleanPoint
+		if rp.Nil {
+			points = []BooleanPoint{{Time: ZeroTime, Nil: true}}
+		} else {
+			points = rp.Emitter.Emit()
+		}
 		for i := len(points) - 1; i >= 0; i-- {
 			points[i].Name = rp.Name
 			points[i].Tags = rp.Tags
@@ -10186,6 +11473,10 @@ type booleanStreamBooleanIterator struct {
 	opt    IteratorOptions
 	m      map[string]*booleanReduceBooleanPoint
 	points []BooleanPoint
+
+	// pointsFilled is true if the buffered points were emitted for an
+	// input point that was generated by a fill.
+	pointsFilled bool
 }
 
 // newBooleanStreamBooleanIterator returns a new instance of booleanStreamBooleanIterator.
@@ -10205,6 +11496,10 @@ func (itr *booleanStreamBooleanIterator) Stats() IteratorStats { return itr.inpu
 // Close closes the iterator and all child iterators.
 func (itr *booleanStreamBooleanIterator) Close() error { return itr.input.Close() }
 
+// filled returns true if the last point was emitted for an input point that
+// was generated by a fill.
+func (itr *booleanStreamBooleanIterator) filled() bool { return itr.pointsFilled }
+
 // Next returns the next value for the stream iterator.
 func (itr *booleanStreamBooleanIterator) Next() (*BooleanPoint, error) {
 	// Calculate next window if we have no more points.
@@ -10264,6 +11559,7 @@ func (itr *booleanStreamBooleanIterator) reduce() ([]BooleanPoint, error) {
 			points[i].Name = rp.Name
 			points[i].Tags = rp.Tags
 		}
+		itr.pointsFilled = itr.input.filled()
 		return points, nil
 	}
 }
@@ -10276,12 +11572,16 @@ type booleanExprIterator struct {
 	fn        booleanExprFunc
 	points    []BooleanPoint // must be size 2
 	storePrev bool
+
+	// lastFilled is true if the last point was computed from a point
+	// generated by a fill, either by the inputs or by this iterator.
+	lastFilled bool
 }
 
 func newBooleanExprIterator(left, right BooleanIterator, opt IteratorOptions, fn func(a, b bool) bool) *booleanExprIterator {
 	var points []BooleanPoint
 	switch opt.Fill {
-	case NullFill, PreviousFill:
+	case NullFill, PreviousFill, NextFill:
 		points = []BooleanPoint{{Nil: true}, {Nil: true}}
 	case NumberFill:
 		value := castToBoolean(opt.FillValue)
@@ -10308,6 +11608,9 @@ func (itr *booleanExprIterator) Close() error {
 	return nil
 }
 
+// filled returns true if the last point was generated by a fill.
+func (itr *booleanExprIterator) filled() bool { return itr.lastFilled }
+
 func (itr *booleanExprIterator) Next() (*BooleanPoint, error) {
 	for {
 		a, b, err := itr.next()
@@ -10320,6 +11623,9 @@ func (itr *booleanExprIterator) Next() (*BooleanPoint, error) {
 			continue
 		}
 
+		// A missing point is filled below, so the result counts as filled too.
+		itr.lastFilled = a == nil || b == nil || itr.left.filled() || itr.right.filled()
+
 		// If one of the two points is nil, we need to fill it with a fake nil
 		// point that has the same name, tags, and time as the other point.
 		// There should never be a time when both of these are nil.
@@ -10421,6 +11727,9 @@ func (itr *booleanTransformIterator) Stats() IteratorStats { return itr.input.St
 // Close closes the iterator and all child iterators.
 func (itr *booleanTransformIterator) Close() error { return itr.input.Close() }
 
+// filled returns true if the last point was generated by a fill.
+func (itr *booleanTransformIterator) filled() bool { return isFilled(itr.input) }
+
 // Next returns the minimum value for the next available interval.
 func (itr *booleanTransformIterator) Next() (*BooleanPoint, error) {
 	p, err := itr.input.Next()
@@ -10450,6 +11759,9 @@ func (itr *booleanBoolTransformIterator) Stats() IteratorStats { return itr.inpu
 // Close closes the iterator and all child iterators.
 func (itr *booleanBoolTransformIterator) Close() error { return itr.input.Close() }
 
+// filled returns true if the last point was generated by a fill.
+func (itr *booleanBoolTransformIterator) filled() bool { return isFilled(itr.input) }
+
 // Next returns the minimum value for the next available interval.
 func (itr *booleanBoolTransformIterator) Next() (*BooleanPoint, error) {
 	p, err := itr.input.Next()
@@ -10574,6 +11886,46 @@ func (itr *booleanDedupeIterator) Next() (*BooleanPoint, error) {
 	}
 }
 
+// booleanTimeDedupeIterator only outputs the first point for each series
+// and timestamp. It is used to drop the rows repeated by subqueries that
+// overlap and, like the DedupeIterator, keeps every key it has seen.
+type booleanTimeDedupeIterator struct {
+	input BooleanIterator
+	m     map[timeDedupeKey]struct{} // lookup of series and times already sent
+}
+
+// newBooleanTimeDedupeIterator returns a new instance of booleanTimeDedupeIterator.
+func newBooleanTimeDedupeIterator(input BooleanIterator) *booleanTimeDedupeIterator {
+	return &booleanTimeDedupeIterator{
+		input: input,
+		m:     make(map[timeDedupeKey]struct{}),
+	}
+}
+
+// Stats returns stats from the input iterator.
+func (itr *booleanTimeDedupeIterator) Stats() IteratorStats { return itr.input.Stats() }
+
+// Close closes the iterator and all child iterators.
+func (itr *booleanTimeDedupeIterator) Close() error { return itr.input.Close() }
+
+// Next returns the next point from the input iterator whose series and time
+// have not been output yet.
+func (itr *booleanTimeDedupeIterator) Next() (*BooleanPoint, error) {
+	for {
+		p, err := itr.input.Next()
+		if p == nil || err != nil {
+			return nil, err
+		}
+
+		key := timeDedupeKey{name: p.Name, tags: p.Tags.ID(), time: p.Time}
+		if _, ok := itr.m[key]; ok {
+			continue
+		}
+		itr.m[key] = struct{}{}
+		return p, nil
+	}
+}
+
 // booleanReaderIterator represents an iterator that streams from a reader.
 type booleanReaderIterator struct {
 	r   io.Reader
@@ -28,6 +28,17 @@ const (
 	MaxTime = models.MaxNanoTime
 )
 
+const (
+	// DefaultIteratorBufferSize is the number of points an iterator running
+	// in a separate goroutine reads ahead of its consumer by default.
+	DefaultIteratorBufferSize = 256
+
+	// MaxIteratorBufferSize is the largest iterator buffer size that can be
+	// set. Each point buffered holds its auxiliary fields and tags in memory,
+	// so very large buffers use a lot of memory with many series.
+	MaxIteratorBufferSize = 65536
+)
+
 // Iterator represents a generic interface for all Iterators.
 // Most iterator operations are done on the typed sub-interfaces.
 type Iterator interface {
@@ -211,7 +222,7 @@ func NewParallelMergeIterator(inputs []Iterator, opt IteratorOptions, parallelis
 			slice = inputs[i*n:]
 		}
 
-		outputs[i] = newParallelIterator(NewMergeIterator(slice, opt))
+		outputs[i] = newParallelIterator(NewMergeIterator(slice, opt), opt.bufferSize())
 	}
 
 	// Merge all groups together.
@@ -245,26 +256,50 @@ func NewSortedMergeIterator(inputs []Iterator, opt IteratorOptions) Iterator {
 	}
 }
 
-// newParallelIterator returns an iterator that runs in a separate goroutine.
-func newParallelIterator(input Iterator) Iterator {
+// newParallelIterator returns an iterator that runs in a separate goroutine
+// and reads up to size points ahead.
+func newParallelIterator(input Iterator, size int) Iterator {
 	if input == nil {
 		return nil
 	}
 
 	switch itr := input.(type) {
 	case FloatIterator:
-		return newFloatParallelIterator(itr)
+		return newFloatParallelIterator(itr, size)
 	case IntegerIterator:
-		return newIntegerParallelIterator(itr)
+		return newIntegerParallelIterator(itr, size)
 	case StringIterator:
-		return newStringParallelIterator(itr)
+		return newStringParallelIterator(itr, size)
 	case BooleanIterator:
-		return newBooleanParallelIterator(itr)
+		return newBooleanParallelIterator(itr, size)
 	default:
 		panic(fmt.Sprintf("unsupported parallel iterator type: %T", itr))
 	}
 }
 
+// newBufferedIterator returns an iterator that reads all of input in a
+// separate goroutine and holds the points until they are read, so reading
+// the input is never blocked by the reader. Close closes input while it may
+// be being read, so input must be safe to close concurrently.
+func newBufferedIterator(input Iterator) Iterator {
+	if input == nil {
+		return nil
+	}
+
+	switch itr := input.(type) {
+	case FloatIterator:
+		return newFloatBufferedIterator(itr)
+	case IntegerIterator:
+		return newIntegerBufferedIterator(itr)
+	case StringIterator:
+		return newStringBufferedIterator(itr)
+	case BooleanIterator:
+		return newBooleanBufferedIterator(itr)
+	default:
+		panic(fmt.Sprintf("unsupported buffered iterator type: %T", itr))
+	}
+}
+
 // NewLimitIterator returns an iterator that limits the number of points per grouping.
 func NewLimitIterator(input Iterator, opt IteratorOptions) Iterator {
 	switch input := input.(type) {
@@ -325,6 +360,35 @@ func NewDedupeIterator(input Iterator) Iterator {
 	}
 }
 
+// timeDedupeKey identifies a row by its series and time.
+type timeDedupeKey struct {
+	name string
+	tags string
+	time int64
+}
+
+// NewTimeDedupeIterator returns an iterator that only outputs the first point
+// for each series and timestamp. Later points with the same series and time
+// are dropped even if their values differ.
+func NewTimeDedupeIterator(input Iterator) Iterator {
+	if input == nil {
+		return nil
+	}
+
+	switch input := input.(type) {
+	case FloatIterator:
+		return newFloatTimeDedupeIterator(input)
+	case IntegerIterator:
+		return newIntegerTimeDedupeIterator(input)
+	case StringIterator:
+		return newStringTimeDedupeIterator(input)
+	case BooleanIterator:
+		return newBooleanTimeDedupeIterator(input)
+	default:
+		panic(fmt.Sprintf("unsupported time dedupe iterator type: %T", input))
+	}
+}
+
 // NewFillIterator returns an iterator that fills in missing points in an aggregate.
 func NewFillIterator(input Iterator, expr Expr, opt IteratorOptions) Iterator {
 	switch input := input.(type) {
@@ -341,6 +405,20 @@ func NewFillIterator(input Iterator, expr Expr, opt IteratorOptions) Iterator {
 	}
 }
 
+// filledIterator is implemented by iterators that can report whether the last
+// point they returned was generated by a fill rather than read from the input.
+type filledIterator interface {
+	filled() bool
+}
+
+// isFilled returns true if the last point returned by itr was generated by a fill.
+func isFilled(itr Iterator) bool {
+	if itr, ok := itr.(filledIterator); ok {
+		return itr.filled()
+	}
+	return false
+}
+
 // NewIntervalIterator returns an iterator that sets the time on each point to the interval.
 func NewIntervalIterator(input Iterator, opt IteratorOptions) Iterator {
 	switch input := input.(type) {
@@ -448,6 +526,10 @@ func (f *auxIteratorField) close() {
 type auxIteratorFields struct {
 	fields     []*auxIteratorField
 	dimensions []string
+
+	// stats returns the statistics of the auxiliary iterator's input. Only
+	// the first field iterator reports them so they are not counted twice.
+	stats func() IteratorStats
 }
 
 // newAuxIteratorFields returns a new instance of auxIteratorFields from a list of field names.
@@ -477,22 +559,26 @@ func (a *auxIteratorFields) iterator(name string, typ DataType) Iterator {
 			continue
 		}
 
+		// Only the first field iterator reports the statistics of the input.
+		stats := a.stats
+		a.stats = nil
+
 		// Create channel iterator by data type.
 		switch f.typ {
 		case Float:
-			itr := &floatChanIterator{cond: sync.NewCond(&sync.Mutex{})}
+			itr := &floatChanIterator{cond: sync.NewCond(&sync.Mutex{}), stats: stats}
 			f.append(itr)
 			return itr
 		case Integer:
-			itr := &integerChanIterator{cond: sync.NewCond(&sync.Mutex{})}
+			itr := &integerChanIterator{cond: sync.NewCond(&sync.Mutex{}), stats: stats}
 			f.append(itr)
 			return itr
 		case String, Tag:
-			itr := &stringChanIterator{cond: sync.NewCond(&sync.Mutex{})}
+			itr := &stringChanIterator{cond: sync.NewCond(&sync.Mutex{}), stats: stats}
 			f.append(itr)
 			return itr
 		case Boolean:
-			itr := &booleanChanIterator{cond: sync.NewCond(&sync.Mutex{})}
+			itr := &booleanChanIterator{cond: sync.NewCond(&sync.Mutex{}), stats: stats}
 			f.append(itr)
 			return itr
 		default:
@@ -503,8 +589,9 @@ func (a *auxIteratorFields) iterator(name string, typ DataType) Iterator {
 	return &nilFloatIterator{}
 }
 
-// send sends a point to all field iterators.
-func (a *auxIteratorFields) send(p Point) (ok bool) {
+// send sends a point to all field iterators. filled reports whether p was
+// generated by a fill.
+func (a *auxIteratorFields) send(p Point, filled bool) (ok bool) {
 	values := p.aux()
 	for i, f := range a.fields {
 		var v interface{}
@@ -520,13 +607,13 @@ func (a *auxIteratorFields) send(p Point) (ok bool) {
 		for _, itr := range f.itrs {
 			switch itr := itr.(type) {
 			case *floatChanIterator:
-				ok = itr.setBuf(p.name(), tags, p.time(), v) || ok
+				ok = itr.setBuf(p.name(), tags, p.time(), v, filled) || ok
 			case *integerChanIterator:
-				ok = itr.setBuf(p.name(), tags, p.time(), v) || ok
+				ok = itr.setBuf(p.name(), tags, p.time(), v, filled) || ok
 			case *stringChanIterator:
-				ok = itr.setBuf(p.name(), tags, p.time(), v) || ok
+				ok = itr.setBuf(p.name(), tags, p.time(), v, filled) || ok
 			case *booleanChanIterator:
-				ok = itr.setBuf(p.name(), tags, p.time(), v) || ok
+				ok = itr.setBuf(p.name(), tags, p.time(), v, filled) || ok
 			default:
 				panic(fmt.Sprintf("invalid aux itr type: %T", itr))
 			}
@@ -687,6 +774,41 @@ type IteratorOptions struct {
 	// Limits on the creation of iterators.
 	MaxSeriesN int
 
+	// Aligns the interval to StartTime instead of the epoch. The interval
+	// offset is relative to StartTime when this is set.
+	AlignToStart bool
+
+	// Removes rows with the same series and time when merging the results
+	// of multiple subqueries. The row from the first source is kept.
+	DedupeSubqueries bool
+
+	// Merges points with the same series and time in the order of their
+	// inputs so repeated queries return identically ordered rows.
+	StableMerge bool
+
+	// How a field whose type differs between shards is read.
+	FieldTypePolicy string
+
+	// The edge of a window that includes points exactly on it.
+	BucketEdge string
+
+	// The timezone windows are aligned to. Windows are aligned to UTC if it
+	// is not set.
+	Location *time.Location
+
+	// The number of decimal places that arithmetic in field expressions is
+	// rounded to when performed on decimal numbers. Zero uses float arithmetic.
+	DecimalPlaces int
+
+	// Emits a null point for each group whose points in a window are all
+	// null instead of leaving the group out. It is set for the aggregate of
+	// an empty_as() call.
+	KeepEmpty bool
+
+	// The number of points iterators running in a separate goroutine read
+	// ahead. Zero uses DefaultIteratorBufferSize.
+	BufferSize int
+
 	// If this channel is set and is closed, the iterator should try to exit
 	// and close as soon as possible.
 	InterruptCh <-chan struct{}
@@ -734,6 +856,14 @@ func newIteratorOptionsStmt(stmt *SelectStatement, sopt *SelectOptions) (opt Ite
 		}
 	}
 	opt.Interval.Duration = interval
+	opt.Location = stmt.Location
+	if sopt != nil {
+		opt.BucketEdge = sopt.BucketEdge
+	}
+	if sopt != nil && sopt.AlignToStart {
+		opt.AlignToStart = true
+		opt.alignToStart()
+	}
 
 	// Determine if the input for this select call must be ordered.
 	opt.Ordered = stmt.IsRawQuery
@@ -763,6 +893,11 @@ func newIteratorOptionsStmt(stmt *SelectStatement, sopt *SelectOptions) (opt Ite
 	if sopt != nil {
 		opt.MaxSeriesN = sopt.MaxSeriesN
 		opt.InterruptCh = sopt.InterruptCh
+		opt.DedupeSubqueries = sopt.DedupeSubqueries
+		opt.StableMerge = sopt.StableMerge
+		opt.FieldTypePolicy = sopt.FieldTypePolicy
+		opt.DecimalPlaces = sopt.DecimalPlaces
+		opt.BufferSize = sopt.IteratorBufferSize
 	}
 
 	return opt, nil
@@ -786,6 +921,15 @@ func newIteratorOptionsSubstatement(stmt *SelectStatement, opt IteratorOptions)
 		subOpt.GroupBy[d] = struct{}{}
 	}
 	subOpt.InterruptCh = opt.InterruptCh
+	subOpt.DedupeSubqueries = opt.DedupeSubqueries
+	subOpt.StableMerge = opt.StableMerge
+	subOpt.FieldTypePolicy = opt.FieldTypePolicy
+	subOpt.BucketEdge = opt.BucketEdge
+	if subOpt.Location == nil {
+		subOpt.Location = opt.Location
+	}
+	subOpt.DecimalPlaces = opt.DecimalPlaces
+	subOpt.BufferSize = opt.BufferSize
 
 	// Propagate the SLIMIT and SOFFSET from the outer query.
 	subOpt.SLimit += opt.SLimit
@@ -809,13 +953,54 @@ func newIteratorOptionsSubstatement(stmt *SelectStatement, opt IteratorOptions)
 	subOpt.Ordered = opt.Ordered && (interval == 0 && stmt.HasSelector())
 
 	// If there is no interval for this subquery, but the outer query has an
-	// interval, inherit the parent interval.
+	// interval, inherit the parent interval. Otherwise, align the subquery's
+	// own interval in the same way as the parent.
 	if interval == 0 {
 		subOpt.Interval = opt.Interval
+	} else if opt.AlignToStart {
+		subOpt.alignToStart()
 	}
+	subOpt.AlignToStart = opt.AlignToStart
 	return subOpt, nil
 }
 
+// bufferSize returns the number of points iterators read ahead.
+func (opt IteratorOptions) bufferSize() int {
+	if opt.BufferSize <= 0 {
+		return DefaultIteratorBufferSize
+	}
+	return opt.BufferSize
+}
+
+// alignToStart shifts the interval offset so windows begin at the start time
+// rather than the epoch. Any offset already set is applied relative to the
+// start time. Windows remain aligned to the epoch if there is no start time.
+// If windows include their end, the first window begins just before the
+// start time so it includes the start time.
+func (opt *IteratorOptions) alignToStart() {
+	if opt.Interval.IsZero() || opt.StartTime == MinTime {
+		return
+	}
+
+	start := opt.StartTime
+	if opt.BucketEdge == BucketEdgeEnd {
+		start--
+	}
+
+	// Windows are shifted by the zone offset of the time they contain, so
+	// include the offset at the start time.
+	if opt.Location != nil {
+		start += opt.zoneOffset(start)
+	}
+
+	d := int64(opt.Interval.Duration)
+	offset := (start%d + int64(opt.Interval.Offset)) % d
+	if offset < 0 {
+		offset += d
+	}
+	opt.Interval.Offset = time.Duration(offset)
+}
+
 // MergeSorted returns true if the options require a sorted merge.
 func (opt IteratorOptions) MergeSorted() bool {
 	return opt.Ordered
@@ -831,29 +1016,93 @@ func (opt IteratorOptions) SeekTime() int64 {
 }
 
 // Window returns the time window [start,end) that t falls within.
+//
+// If windows include their end instead of their start, t falls within the
+// window (start,end] and the window is returned as its end and the time
+// following it, so start is the time the window is labeled with. Use
+// windowBounds to find the times inside a window.
 func (opt IteratorOptions) Window(t int64) (start, end int64) {
 	if opt.Interval.IsZero() {
 		return opt.StartTime, opt.EndTime + 1
 	}
 
+	// A time on the edge between two windows belongs to the earlier window
+	// if windows include their end.
+	includeEnd := opt.BucketEdge == BucketEdgeEnd
+	if includeEnd {
+		t--
+	}
+
 	// Subtract the offset to the time so we calculate the correct base interval.
 	t -= int64(opt.Interval.Offset)
 
+	// Truncate the local time in the timezone, if there is one.
+	var zone int64
+	if opt.Location != nil {
+		zone = opt.zoneOffset(t)
+	}
+
 	// Truncate time by duration.
-	dt := t % int64(opt.Interval.Duration)
+	d := int64(opt.Interval.Duration)
+	dt := (t + zone) % d
 	if dt < 0 {
 		// Negative modulo rounds up instead of down, so offset
 		// with the duration.
-		dt += int64(opt.Interval.Duration)
+		dt += d
 	}
 	t -= dt
+	start, end = t, t+d
+
+	// The zone offset may change inside the window, such as for daylight
+	// saving time, so move the edges of the window by the difference. Windows
+	// shorter than the change are left aligned to UTC.
+	if opt.Location != nil {
+		if o := zone - opt.zoneOffset(start); o != 0 && abs(o) < d {
+			start += o
+		}
+		if o := zone - opt.zoneOffset(end); o != 0 && abs(o) < d {
+			end += o
+		}
+	}
 
 	// Apply the offset.
-	start = t + int64(opt.Interval.Offset)
-	end = start + int64(opt.Interval.Duration)
+	start += int64(opt.Interval.Offset)
+	end += int64(opt.Interval.Offset)
+	if includeEnd {
+		return end, end + 1
+	}
 	return
 }
 
+// zoneOffset returns the offset of the timezone from UTC at t.
+func (opt IteratorOptions) zoneOffset(t int64) int64 {
+	_, offset := time.Unix(0, t).In(opt.Location).Zone()
+	return int64(offset) * int64(time.Second)
+}
+
+// abs returns the absolute value of v.
+func abs(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// windowBounds returns the times [lower,upper) inside the window returned by
+// Window.
+func (opt IteratorOptions) windowBounds(start, end int64) (lower, upper int64) {
+	if opt.Interval.IsZero() || opt.BucketEdge != BucketEdgeEnd {
+		return start, end
+	} else if opt.Location != nil {
+		// The window may be shorter or longer than the interval if the zone
+		// offset changes inside it, so find where it begins.
+		opt.BucketEdge = BucketEdgeStart
+		lower, _ = opt.Window(end - 1)
+		return lower, end
+	}
+	return end - int64(opt.Interval.Duration), end
+}
+
 // DerivativeInterval returns the time interval for the derivative function.
 func (opt IteratorOptions) DerivativeInterval() Interval {
 	// Use the interval on the derivative() call, if specified.
@@ -1148,6 +1397,9 @@ func (itr *integerFloatTransformIterator) Stats() IteratorStats { return itr.inp
 // Close closes the iterator and all child iterators.
 func (itr *integerFloatTransformIterator) Close() error { return itr.input.Close() }
 
+// filled returns true if the last point was generated by a fill.
+func (itr *integerFloatTransformIterator) filled() bool { return isFilled(itr.input) }
+
 // Next returns the minimum value for the next available interval.
 func (itr *integerFloatTransformIterator) Next() (*FloatPoint, error) {
 	p, err := itr.input.Next()
@@ -1170,6 +1422,7 @@ type integerFloatCastIterator struct {
 
 func (itr *integerFloatCastIterator) Stats() IteratorStats { return itr.input.Stats() }
 func (itr *integerFloatCastIterator) Close() error         { return itr.input.Close() }
+func (itr *integerFloatCastIterator) filled() bool         { return isFilled(itr.input) }
 func (itr *integerFloatCastIterator) Next() (*FloatPoint, error) {
 	p, err := itr.input.Next()
 	if p == nil || err != nil {
@@ -271,6 +271,40 @@ func TestMergeIterator_Cast_Float(t *testing.T) {
 	}
 }
 
+// Ensure that series with the same tags after projection are always merged in
+// input order, when requested, so repeated queries return identically ordered
+// rows.
+func TestMergeIterator_Stable(t *testing.T) {
+	var exp []float64
+	for i := 0; i < 8; i++ {
+		exp = append(exp, float64(i), float64(i)+0.5)
+	}
+
+	for n := 0; n < 100; n++ {
+		inputs := make([]influxql.Iterator, 8)
+		for i := range inputs {
+			inputs[i] = &FloatIterator{Points: []influxql.FloatPoint{
+				{Name: "cpu", Tags: ParseTags(fmt.Sprintf("host=%d", i)), Time: 0, Value: float64(i)},
+				{Name: "cpu", Tags: ParseTags(fmt.Sprintf("host=%d", i)), Time: 10, Value: float64(i) + 0.5},
+			}}
+		}
+
+		itr := influxql.NewMergeIterator(inputs, influxql.IteratorOptions{Ascending: true, StableMerge: true})
+		a, err := Iterators([]influxql.Iterator{itr}).ReadAll()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		got := make([]float64, 0, len(a))
+		for _, p := range a {
+			got = append(got, p[0].(*influxql.FloatPoint).Value)
+		}
+		if !reflect.DeepEqual(got, exp) {
+			t.Fatalf("%d. unexpected order: got %v, exp %v", n, got, exp)
+		}
+	}
+}
+
 // Ensure that a set of iterators can be merged together, sorted by name/tag.
 func TestSortedMergeIterator_Float(t *testing.T) {
 	inputs := []*FloatIterator{
@@ -524,6 +558,42 @@ func TestSortedMergeIterator_Cast_Float(t *testing.T) {
 	}
 }
 
+// Ensure that points with the same tags after projection and the same time are
+// always sorted in input order, when requested, so repeated queries return
+// identically ordered rows.
+func TestSortedMergeIterator_Stable(t *testing.T) {
+	var exp []float64
+	for _, offset := range []float64{0, 0.5} {
+		for i := 0; i < 8; i++ {
+			exp = append(exp, float64(i)+offset)
+		}
+	}
+
+	for n := 0; n < 100; n++ {
+		inputs := make([]influxql.Iterator, 8)
+		for i := range inputs {
+			inputs[i] = &FloatIterator{Points: []influxql.FloatPoint{
+				{Name: "cpu", Tags: ParseTags(fmt.Sprintf("host=%d", i)), Time: 0, Value: float64(i)},
+				{Name: "cpu", Tags: ParseTags(fmt.Sprintf("host=%d", i)), Time: 10, Value: float64(i) + 0.5},
+			}}
+		}
+
+		itr := influxql.NewSortedMergeIterator(inputs, influxql.IteratorOptions{Ascending: true, StableMerge: true})
+		a, err := Iterators([]influxql.Iterator{itr}).ReadAll()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		got := make([]float64, 0, len(a))
+		for _, p := range a {
+			got = append(got, p[0].(*influxql.FloatPoint).Value)
+		}
+		if !reflect.DeepEqual(got, exp) {
+			t.Fatalf("%d. unexpected order: got %v, exp %v", n, got, exp)
+		}
+	}
+}
+
 // Ensure limit iterators work with limit and offset.
 func TestLimitIterator_Float(t *testing.T) {
 	input := &FloatIterator{Points: []influxql.FloatPoint{
@@ -799,6 +869,37 @@ func TestIteratorOptions_Window_Offset(t *testing.T) {
 	}
 }
 
+// Ensure windows are aligned to the timezone and follow its offset changes.
+func TestIteratorOptions_Window_Location(t *testing.T) {
+	for _, tt := range []struct {
+		interval   time.Duration
+		t          string
+		start, end string
+	}{
+		{interval: 24 * time.Hour, t: "2017-01-01T12:00:00Z", start: "2017-01-01T05:00:00Z", end: "2017-01-02T05:00:00Z"},
+		// The day daylight saving time starts is 23 hours long.
+		{interval: 24 * time.Hour, t: "2017-03-12T06:30:00Z", start: "2017-03-12T05:00:00Z", end: "2017-03-13T04:00:00Z"},
+		{interval: 24 * time.Hour, t: "2017-03-12T16:00:00Z", start: "2017-03-12T05:00:00Z", end: "2017-03-13T04:00:00Z"},
+		// The day daylight saving time ends is 25 hours long.
+		{interval: 24 * time.Hour, t: "2017-11-05T17:00:00Z", start: "2017-11-05T04:00:00Z", end: "2017-11-06T05:00:00Z"},
+		// Windows shorter than the offset change stay aligned to UTC.
+		{interval: time.Hour, t: "2017-03-12T07:30:00Z", start: "2017-03-12T07:00:00Z", end: "2017-03-12T08:00:00Z"},
+	} {
+		opt := influxql.IteratorOptions{
+			Interval: influxql.Interval{Duration: tt.interval},
+			Location: mustLoadLocation("America/New_York"),
+		}
+
+		start, end := opt.Window(mustParseTime(tt.t).UnixNano())
+		if got, exp := time.Unix(0, start).UTC(), mustParseTime(tt.start); !got.Equal(exp) {
+			t.Errorf("%s: unexpected start: got %s, exp %s", tt.t, got, exp)
+		}
+		if got, exp := time.Unix(0, end).UTC(), mustParseTime(tt.end); !got.Equal(exp) {
+			t.Errorf("%s: unexpected end: got %s, exp %s", tt.t, got, exp)
+		}
+	}
+}
+
 func TestIteratorOptions_Window_Default(t *testing.T) {
 	opt := influxql.IteratorOptions{
 		StartTime: 0,
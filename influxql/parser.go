@@ -116,8 +116,14 @@ func (p *Parser) ParseStatement() (Statement, error) {
 		return p.parseSetPasswordUserStatement()
 	case KILL:
 		return p.parseKillQueryStatement()
+	case UNDROP:
+		return p.parseUndropStatement()
+	case MIGRATE:
+		return p.parseMigrateFieldTypeStatement()
+	case DEFRAGMENT:
+		return p.parseDefragmentShardStatement()
 	default:
-		return nil, newParseError(tokstr(tok, lit), []string{"SELECT", "DELETE", "SHOW", "CREATE", "DROP", "GRANT", "REVOKE", "ALTER", "SET", "KILL"}, pos)
+		return nil, newParseError(tokstr(tok, lit), []string{"SELECT", "DELETE", "SHOW", "CREATE", "DROP", "GRANT", "REVOKE", "ALTER", "SET", "KILL", "UNDROP", "MIGRATE", "DEFRAGMENT"}, pos)
 	}
 }
 
@@ -174,6 +180,13 @@ func (p *Parser) parseShowStatement() (Statement, error) {
 		return p.parseShowUsersStatement()
 	case SUBSCRIPTIONS:
 		return p.parseShowSubscriptionsStatement()
+	case IDENT:
+		if strings.EqualFold(lit, "validation") {
+			if err := p.parseUnreservedKeyword("RULES"); err != nil {
+				return nil, err
+			}
+			return p.parseShowValidationRulesStatement()
+		}
 	}
 
 	showQueryKeywords := []string{
@@ -192,6 +205,7 @@ func (p *Parser) parseShowStatement() (Statement, error) {
 		"SHARD",
 		"SHARDS",
 		"SUBSCRIPTIONS",
+		"VALIDATION",
 	}
 	sort.Strings(showQueryKeywords)
 
@@ -216,9 +230,14 @@ func (p *Parser) parseCreateStatement() (Statement, error) {
 		return p.parseCreateRetentionPolicyStatement()
 	} else if tok == SUBSCRIPTION {
 		return p.parseCreateSubscriptionStatement()
+	} else if tok == IDENT && strings.EqualFold(lit, "validation") {
+		if err := p.parseUnreservedKeyword("RULE"); err != nil {
+			return nil, err
+		}
+		return p.parseCreateValidationRuleStatement()
 	}
 
-	return nil, newParseError(tokstr(tok, lit), []string{"CONTINUOUS", "DATABASE", "USER", "RETENTION", "SUBSCRIPTION"}, pos)
+	return nil, newParseError(tokstr(tok, lit), []string{"CONTINUOUS", "DATABASE", "USER", "RETENTION", "SUBSCRIPTION", "VALIDATION"}, pos)
 }
 
 // parseDropStatement parses a string and returns a drop statement.
@@ -245,23 +264,65 @@ func (p *Parser) parseDropStatement() (Statement, error) {
 		return p.parseDropSubscriptionStatement()
 	case USER:
 		return p.parseDropUserStatement()
-	default:
-		return nil, newParseError(tokstr(tok, lit), []string{"CONTINUOUS", "MEASUREMENT", "RETENTION", "SERIES", "SHARD", "SUBSCRIPTION", "USER"}, pos)
+	case IDENT:
+		if strings.EqualFold(lit, "validation") {
+			if err := p.parseUnreservedKeyword("RULE"); err != nil {
+				return nil, err
+			}
+			return p.parseDropValidationRuleStatement()
+		}
 	}
+	return nil, newParseError(tokstr(tok, lit), []string{"CONTINUOUS", "MEASUREMENT", "RETENTION", "SERIES", "SHARD", "SUBSCRIPTION", "USER", "VALIDATION"}, pos)
 }
 
 // parseAlterStatement parses a string and returns an alter statement.
 // This function assumes the ALTER token has already been consumed.
 func (p *Parser) parseAlterStatement() (Statement, error) {
 	tok, pos, lit := p.scanIgnoreWhitespace()
-	if tok == RETENTION {
+	if tok == DATABASE {
+		return p.parseAlterDatabaseStatement()
+	} else if tok == RETENTION {
 		if tok, pos, lit = p.scanIgnoreWhitespace(); tok != POLICY {
 			return nil, newParseError(tokstr(tok, lit), []string{"POLICY"}, pos)
 		}
 		return p.parseAlterRetentionPolicyStatement()
 	}
 
-	return nil, newParseError(tokstr(tok, lit), []string{"RETENTION"}, pos)
+	return nil, newParseError(tokstr(tok, lit), []string{"DATABASE", "RETENTION"}, pos)
+}
+
+// parseAlterDatabaseStatement parses a string and returns an AlterDatabaseStatement.
+// This function assumes the "ALTER DATABASE" tokens have already been consumed.
+func (p *Parser) parseAlterDatabaseStatement() (*AlterDatabaseStatement, error) {
+	stmt := &AlterDatabaseStatement{}
+
+	// Parse the database name.
+	ident, err := p.parseIdent()
+	if err != nil {
+		return nil, err
+	}
+	stmt.Name = ident
+
+	// Consume the required WITH PRECISION tokens.
+	if tok, pos, lit := p.scanIgnoreWhitespace(); tok != WITH {
+		return nil, newParseError(tokstr(tok, lit), []string{"WITH"}, pos)
+	}
+	if tok, pos, lit := p.scanIgnoreWhitespace(); tok != IDENT || strings.ToLower(lit) != "precision" {
+		return nil, newParseError(tokstr(tok, lit), []string{"PRECISION"}, pos)
+	}
+
+	// Parse the precision, which may be quoted.
+	tok, pos, lit := p.scanIgnoreWhitespace()
+	if tok != IDENT && tok != STRING {
+		return nil, newParseError(tokstr(tok, lit), []string{"precision"}, pos)
+	}
+	switch lit {
+	case "n", "u", "ms", "s", "m", "h":
+		stmt.Precision = lit
+	default:
+		return nil, &ParseError{Message: fmt.Sprintf("invalid precision %s, expected one of n, u, ms, s, m, h", lit), Pos: pos}
+	}
+	return stmt, nil
 }
 
 // parseSetPasswordUserStatement parses a string and returns a set statement.
@@ -375,6 +436,75 @@ func (p *Parser) parseCreateSubscriptionStatement() (*CreateSubscriptionStatemen
 	return stmt, nil
 }
 
+// parseCreateValidationRuleStatement parses a string and returns a CreateValidationRuleStatement.
+// This function assumes the "CREATE VALIDATION RULE" tokens have already been consumed.
+func (p *Parser) parseCreateValidationRuleStatement() (*CreateValidationRuleStatement, error) {
+	stmt := &CreateValidationRuleStatement{}
+
+	// Read the name of the rule.
+	ident, err := p.parseIdent()
+	if err != nil {
+		return nil, err
+	}
+	stmt.Name = ident
+
+	// Expect an "ON" keyword.
+	if tok, pos, lit := p.scanIgnoreWhitespace(); tok != ON {
+		return nil, newParseError(tokstr(tok, lit), []string{"ON"}, pos)
+	}
+
+	// Read the name of the database.
+	if ident, err = p.parseIdent(); err != nil {
+		return nil, err
+	}
+	stmt.Database = ident
+
+	// Parse the optional measurement the rule applies to.
+	if tok, _, _ := p.scanIgnoreWhitespace(); tok == FROM {
+		if ident, err = p.parseIdent(); err != nil {
+			return nil, err
+		}
+		stmt.Measurement = ident
+	} else {
+		p.unscan()
+	}
+
+	if err := p.parseUnreservedKeyword("REQUIRE"); err != nil {
+		return nil, err
+	}
+
+	// Parse either a required tag or the range of a field.
+	tok, pos, lit := p.scanIgnoreWhitespace()
+	switch tok {
+	case TAG:
+		if stmt.Tag, err = p.parseIdent(); err != nil {
+			return nil, err
+		}
+	case FIELD:
+		if stmt.Field, err = p.parseIdent(); err != nil {
+			return nil, err
+		}
+		if err := p.parseUnreservedKeyword("BETWEEN"); err != nil {
+			return nil, err
+		}
+		if stmt.Min, err = p.parseSignedNumber(); err != nil {
+			return nil, err
+		}
+		tok, pos, lit := p.scanIgnoreWhitespace()
+		if tok != AND {
+			return nil, newParseError(tokstr(tok, lit), []string{"AND"}, pos)
+		}
+		if stmt.Max, err = p.parseSignedNumber(); err != nil {
+			return nil, err
+		} else if stmt.Max < stmt.Min {
+			return nil, &ParseError{Message: "invalid range: maximum is less than the minimum", Pos: pos}
+		}
+	default:
+		return nil, newParseError(tokstr(tok, lit), []string{"TAG", "FIELD"}, pos)
+	}
+	return stmt, nil
+}
+
 // parseCreateRetentionPolicyStatement parses a string and returns a create retention policy statement.
 // This function assumes the CREATE RETENTION POLICY tokens have already been consumed.
 func (p *Parser) parseCreateRetentionPolicyStatement() (*CreateRetentionPolicyStatement, error) {
@@ -490,27 +620,30 @@ func (p *Parser) parseAlterRetentionPolicyStatement() (*AlterRetentionPolicyStat
 Loop:
 	for {
 		tok, pos, lit := p.scanIgnoreWhitespace()
-		if _, ok := found[tok]; ok {
+
+		// ISOLATE is not a keyword, so it is matched as an identifier.
+		isolate := tok == IDENT && strings.ToUpper(lit) == "ISOLATE"
+		if _, ok := found[tok]; ok && (tok != IDENT || isolate) {
 			return nil, &ParseError{
-				Message: fmt.Sprintf("found duplicate %s option", tok),
+				Message: fmt.Sprintf("found duplicate %s option", tokstr(tok, strings.ToUpper(lit))),
 				Pos:     pos,
 			}
 		}
 
-		switch tok {
-		case DURATION:
+		switch {
+		case tok == DURATION:
 			d, err := p.parseDuration()
 			if err != nil {
 				return nil, err
 			}
 			stmt.Duration = &d
-		case REPLICATION:
+		case tok == REPLICATION:
 			n, err := p.parseInt(1, math.MaxInt32)
 			if err != nil {
 				return nil, err
 			}
 			stmt.Replication = &n
-		case SHARD:
+		case tok == SHARD:
 			tok, pos, lit := p.scanIgnoreWhitespace()
 			if tok == DURATION {
 				// Check to see if they used the INF keyword
@@ -531,11 +664,17 @@ Loop:
 			} else {
 				return nil, newParseError(tokstr(tok, lit), []string{"DURATION"}, pos)
 			}
-		case DEFAULT:
+		case tok == DEFAULT:
 			stmt.Default = true
+		case isolate:
+			names, err := p.parseIsolatedMeasurements()
+			if err != nil {
+				return nil, err
+			}
+			stmt.IsolatedMeasurements = names
 		default:
 			if len(found) == 0 {
-				return nil, newParseError(tokstr(tok, lit), []string{"DURATION", "REPLICATION", "SHARD", "DEFAULT"}, pos)
+				return nil, newParseError(tokstr(tok, lit), []string{"DURATION", "REPLICATION", "SHARD", "DEFAULT", "ISOLATE"}, pos)
 			}
 			p.unscan()
 			break Loop
@@ -546,6 +685,34 @@ Loop:
 	return stmt, nil
 }
 
+// parseIsolatedMeasurements parses a parenthesized, comma delimited list of
+// measurement names that may be empty. This function assumes the ISOLATE token
+// has already been consumed.
+func (p *Parser) parseIsolatedMeasurements() ([]string, error) {
+	if tok, pos, lit := p.scanIgnoreWhitespace(); tok != MEASUREMENTS {
+		return nil, newParseError(tokstr(tok, lit), []string{"MEASUREMENTS"}, pos)
+	}
+	if tok, pos, lit := p.scanIgnoreWhitespace(); tok != LPAREN {
+		return nil, newParseError(tokstr(tok, lit), []string{"("}, pos)
+	}
+
+	names := []string{}
+	if tok, _, _ := p.scanIgnoreWhitespace(); tok != RPAREN {
+		p.unscan()
+
+		idents, err := p.parseIdentList()
+		if err != nil {
+			return nil, err
+		}
+		names = idents
+
+		if tok, pos, lit := p.scanIgnoreWhitespace(); tok != RPAREN {
+			return nil, newParseError(tokstr(tok, lit), []string{")"}, pos)
+		}
+	}
+	return names, nil
+}
+
 // parseInt parses a string representing a base 10 integer and returns the number.
 // It returns an error if the parsed number is outside the range [min, max].
 func (p *Parser) parseInt(min, max int) (int, error) {
@@ -568,6 +735,31 @@ func (p *Parser) parseInt(min, max int) (int, error) {
 	return n, nil
 }
 
+// parseSignedNumber parses a string and returns a number literal, which may
+// have a sign.
+func (p *Parser) parseSignedNumber() (float64, error) {
+	tok, pos, lit := p.scanIgnoreWhitespace()
+	if tok != NUMBER && tok != INTEGER {
+		return 0, newParseError(tokstr(tok, lit), []string{"number"}, pos)
+	}
+
+	v, err := strconv.ParseFloat(lit, 64)
+	if err != nil {
+		return 0, &ParseError{Message: err.Error(), Pos: pos}
+	}
+	return v, nil
+}
+
+// parseUnreservedKeyword consumes an identifier that is used as a keyword
+// in a statement without being reserved, so it remains a valid name.
+func (p *Parser) parseUnreservedKeyword(keyword string) error {
+	tok, pos, lit := p.scanIgnoreWhitespace()
+	if tok != IDENT || !strings.EqualFold(lit, keyword) {
+		return newParseError(tokstr(tok, lit), []string{keyword}, pos)
+	}
+	return nil
+}
+
 // parseUInt64 parses a string and returns a 64-bit unsigned integer literal.
 func (p *Parser) parseUInt64() (uint64, error) {
 	tok, pos, lit := p.scanIgnoreWhitespace()
@@ -931,6 +1123,11 @@ func (p *Parser) parseSelectStatement(tr targetRequirement) (*SelectStatement, e
 		return nil, err
 	}
 
+	// Parse comparison: "COMPARE PREVIOUS <duration>".
+	if stmt.Compare, err = p.parseCompare(); err != nil {
+		return nil, err
+	}
+
 	// Parse sort: "ORDER BY FIELD+".
 	if stmt.SortFields, err = p.parseOrderBy(); err != nil {
 		return nil, err
@@ -956,6 +1153,11 @@ func (p *Parser) parseSelectStatement(tr targetRequirement) (*SelectStatement, e
 		return nil, err
 	}
 
+	// Parse timezone: "tz(<string>)".
+	if stmt.Location, err = p.parseLocation(); err != nil {
+		return nil, err
+	}
+
 	// Set if the query is a raw data query or one with an aggregate
 	stmt.IsRawQuery = true
 	WalkFunc(stmt.Fields, func(n Node) {
@@ -1386,6 +1588,25 @@ func (p *Parser) parseShowSubscriptionsStatement() (*ShowSubscriptionsStatement,
 	return stmt, nil
 }
 
+// parseShowValidationRulesStatement parses a string and returns a ShowValidationRulesStatement.
+// This function assumes the "SHOW VALIDATION RULES" tokens have been consumed.
+func (p *Parser) parseShowValidationRulesStatement() (*ShowValidationRulesStatement, error) {
+	stmt := &ShowValidationRulesStatement{}
+
+	// Parse the optional database.
+	if tok, _, _ := p.scanIgnoreWhitespace(); tok == ON {
+		ident, err := p.parseIdent()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Database = ident
+	} else {
+		p.unscan()
+	}
+
+	return stmt, nil
+}
+
 // parseShowFieldKeysStatement parses a string and returns a ShowSeriesStatement.
 // This function assumes the "SHOW FIELD KEYS" tokens have already been consumed.
 func (p *Parser) parseShowFieldKeysStatement() (*ShowFieldKeysStatement, error) {
@@ -1507,6 +1728,92 @@ func (p *Parser) parseDropShardStatement() (*DropShardStatement, error) {
 	return stmt, nil
 }
 
+// parseUndropStatement parses a string and returns an undrop statement.
+// This function assumes the UNDROP token has already been consumed.
+func (p *Parser) parseUndropStatement() (Statement, error) {
+	if tok, pos, lit := p.scanIgnoreWhitespace(); tok != SHARD {
+		return nil, newParseError(tokstr(tok, lit), []string{"SHARD"}, pos)
+	}
+
+	var err error
+	stmt := &UndropShardStatement{}
+
+	// Parse the ID of the shard to be restored.
+	if stmt.ID, err = p.parseUInt64(); err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
+
+// parseDefragmentShardStatement parses a string and returns a DefragmentShardStatement.
+// This function assumes the DEFRAGMENT token has already been consumed.
+func (p *Parser) parseDefragmentShardStatement() (*DefragmentShardStatement, error) {
+	if tok, pos, lit := p.scanIgnoreWhitespace(); tok != SHARD {
+		return nil, newParseError(tokstr(tok, lit), []string{"SHARD"}, pos)
+	}
+
+	var err error
+	stmt := &DefragmentShardStatement{}
+
+	// Parse the ID of the shard to be defragmented.
+	if stmt.ID, err = p.parseUInt64(); err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
+
+// parseMigrateFieldTypeStatement parses a string and returns a MigrateFieldTypeStatement.
+// This function assumes the MIGRATE token has already been consumed.
+func (p *Parser) parseMigrateFieldTypeStatement() (*MigrateFieldTypeStatement, error) {
+	// Expect the "FIELD TYPE" tokens. TYPE is not a keyword so that it can
+	// still be used as an unquoted identifier.
+	if tok, pos, lit := p.scanIgnoreWhitespace(); tok != FIELD {
+		return nil, newParseError(tokstr(tok, lit), []string{"FIELD"}, pos)
+	}
+	if tok, pos, lit := p.scanIgnoreWhitespace(); tok != IDENT || strings.ToLower(lit) != "type" {
+		return nil, newParseError(tokstr(tok, lit), []string{"TYPE"}, pos)
+	}
+
+	stmt := &MigrateFieldTypeStatement{}
+
+	// Parse the name of the field to be migrated.
+	lit, err := p.parseIdent()
+	if err != nil {
+		return nil, err
+	}
+	stmt.Field = lit
+
+	// Parse the measurement the field belongs to.
+	if tok, pos, lit := p.scanIgnoreWhitespace(); tok != FROM {
+		return nil, newParseError(tokstr(tok, lit), []string{"FROM"}, pos)
+	}
+	if stmt.Measurement, err = p.parseIdent(); err != nil {
+		return nil, err
+	}
+
+	// Parse the type the field is migrated to.
+	if tok, pos, lit := p.scanIgnoreWhitespace(); tok != TO {
+		return nil, newParseError(tokstr(tok, lit), []string{"TO"}, pos)
+	}
+	tok, pos, lit := p.scanIgnoreWhitespace()
+	if tok == IDENT {
+		switch strings.ToLower(lit) {
+		case "float":
+			stmt.Type = Float
+		case "integer":
+			stmt.Type = Integer
+		case "string":
+			stmt.Type = String
+		case "boolean":
+			stmt.Type = Boolean
+		}
+	}
+	if stmt.Type == Unknown {
+		return nil, newParseError(tokstr(tok, lit), []string{"float", "integer", "string", "boolean"}, pos)
+	}
+	return stmt, nil
+}
+
 // parseShowContinuousQueriesStatement parses a string and returns a ShowContinuousQueriesStatement.
 // This function assumes the "SHOW CONTINUOUS" tokens have already been consumed.
 func (p *Parser) parseShowContinuousQueriesStatement() (*ShowContinuousQueriesStatement, error) {
@@ -1714,6 +2021,32 @@ func (p *Parser) parseDropDatabaseStatement() (*DropDatabaseStatement, error) {
 	return stmt, nil
 }
 
+// parseDropValidationRuleStatement parses a string and returns a DropValidationRuleStatement.
+// This function assumes the "DROP VALIDATION RULE" tokens have already been consumed.
+func (p *Parser) parseDropValidationRuleStatement() (*DropValidationRuleStatement, error) {
+	stmt := &DropValidationRuleStatement{}
+
+	// Read the name of the rule to drop.
+	ident, err := p.parseIdent()
+	if err != nil {
+		return nil, err
+	}
+	stmt.Name = ident
+
+	// Expect an "ON" keyword.
+	if tok, pos, lit := p.scanIgnoreWhitespace(); tok != ON {
+		return nil, newParseError(tokstr(tok, lit), []string{"ON"}, pos)
+	}
+
+	// Read the name of the database.
+	if ident, err = p.parseIdent(); err != nil {
+		return nil, err
+	}
+	stmt.Database = ident
+
+	return stmt, nil
+}
+
 // parseDropSubscriptionStatement parses a string and returns a DropSubscriptionStatement.
 // This function assumes the "DROP SUBSCRIPTION" tokens have already been consumed.
 func (p *Parser) parseDropSubscriptionStatement() (*DropSubscriptionStatement, error) {
@@ -1947,6 +2280,15 @@ func (p *Parser) parseField() (*Field, error) {
 		if c.foundInvalid {
 			return nil, fmt.Errorf("invalid operator %s in SELECT clause at line %d, char %d; operator is intended for WHERE clause", c.badToken, pos.Line+1, pos.Char+1)
 		}
+
+		// Unit conversions wrapping the whole field are applied to the
+		// results so the converted expression is selected instead.
+		if call, ok := expr.(*Call); ok && IsConversionFunc(call.Name) {
+			f.Conversion, expr, err = newConversionFromCall(call)
+			if err != nil {
+				return nil, err
+			}
+		}
 		f.Expr = expr
 	}
 
@@ -2058,6 +2400,11 @@ func (p *Parser) parseSource(subqueries bool) (Source, error) {
 			if err != nil {
 				return nil, err
 			}
+			for _, f := range stmt.Fields {
+				if f.Conversion != nil {
+					return nil, fmt.Errorf("unable to use %s() in a subquery", f.Conversion.Name)
+				}
+			}
 
 			if err := p.parseTokens([]Token{RPAREN}); err != nil {
 				return nil, err
@@ -2194,7 +2541,7 @@ func (p *Parser) parseFill() (FillOption, interface{}, error) {
 	if !ok {
 		return NullFill, nil, errors.New("fill must be a function call")
 	} else if len(fill.Args) != 1 {
-		return NullFill, nil, errors.New("fill requires an argument, e.g.: 0, null, none, previous, linear")
+		return NullFill, nil, errors.New("fill requires an argument, e.g.: 0, null, none, previous, next, linear")
 	}
 	switch fill.Args[0].String() {
 	case "null":
@@ -2203,6 +2550,8 @@ func (p *Parser) parseFill() (FillOption, interface{}, error) {
 		return NoFill, nil, nil
 	case "previous":
 		return PreviousFill, nil, nil
+	case "next":
+		return NextFill, nil, nil
 	case "linear":
 		return LinearFill, nil, nil
 	default:
@@ -2217,6 +2566,68 @@ func (p *Parser) parseFill() (FillOption, interface{}, error) {
 	}
 }
 
+// parseLocation parses a "tz(<string>)" clause, if it exists.
+func (p *Parser) parseLocation() (*time.Location, error) {
+	if tok, _, lit := p.scanIgnoreWhitespace(); tok != IDENT || strings.ToLower(lit) != "tz" {
+		p.unscan()
+		return nil, nil
+	}
+
+	if tok, pos, lit := p.scanIgnoreWhitespace(); tok != LPAREN {
+		return nil, newParseError(tokstr(tok, lit), []string{"("}, pos)
+	}
+
+	tok, pos, lit := p.scanIgnoreWhitespace()
+	if tok != STRING {
+		return nil, newParseError(tokstr(tok, lit), []string{"string"}, pos)
+	}
+	loc, err := time.LoadLocation(lit)
+	if err != nil {
+		return nil, &ParseError{Message: fmt.Sprintf("unable to find time zone %s", lit), Pos: pos}
+	}
+
+	if tok, pos, lit := p.scanIgnoreWhitespace(); tok != RPAREN {
+		return nil, newParseError(tokstr(tok, lit), []string{")"}, pos)
+	}
+	return loc, nil
+}
+
+// parseCompare parses a "COMPARE PREVIOUS <duration> [DIFFERENCE | RATIO]"
+// clause, if it exists.
+func (p *Parser) parseCompare() (*CompareClause, error) {
+	if tok, _, lit := p.scanIgnoreWhitespace(); tok != IDENT || strings.ToUpper(lit) != "COMPARE" {
+		p.unscan()
+		return nil, nil
+	}
+
+	if tok, pos, lit := p.scanIgnoreWhitespace(); tok != IDENT || strings.ToUpper(lit) != "PREVIOUS" {
+		return nil, newParseError(tokstr(tok, lit), []string{"PREVIOUS"}, pos)
+	}
+
+	tok, pos, lit := p.scanIgnoreWhitespace()
+	if tok != DURATIONVAL {
+		return nil, newParseError(tokstr(tok, lit), []string{"duration"}, pos)
+	}
+	d, err := ParseDuration(lit)
+	if err != nil {
+		return nil, &ParseError{Message: err.Error(), Pos: pos}
+	} else if d <= 0 {
+		return nil, &ParseError{Message: "COMPARE PREVIOUS duration must be greater than 0", Pos: pos}
+	}
+	c := &CompareClause{Offset: d}
+
+	tok, _, lit = p.scanIgnoreWhitespace()
+	switch {
+	case tok == IDENT && strings.ToUpper(lit) == "DIFFERENCE":
+		c.Op = CompareDifference
+	case tok == IDENT && strings.ToUpper(lit) == "RATIO":
+		c.Op = CompareRatio
+	default:
+		p.unscan()
+	}
+	return c, nil
+}
+
 // parseOptionalTokenAndInt parses the specified token followed
 // by an int, if it exists.
 func (p *Parser) parseOptionalTokenAndInt(t Token) (int, error) {
@@ -1041,6 +1041,25 @@ func TestParser_ParseStatement(t *testing.T) {
 			},
 		},
 
+		// SELECT statement with next fill
+		{
+			s: fmt.Sprintf(`SELECT mean(value) FROM cpu where time < '%s' GROUP BY time(5m) FILL(next)`, now.UTC().Format(time.RFC3339Nano)),
+			stmt: &influxql.SelectStatement{
+				Fields: []*influxql.Field{{
+					Expr: &influxql.Call{
+						Name: "mean",
+						Args: []influxql.Expr{&influxql.VarRef{Val: "value"}}}}},
+				Sources: []influxql.Source{&influxql.Measurement{Name: "cpu"}},
+				Condition: &influxql.BinaryExpr{
+					Op:  influxql.LT,
+					LHS: &influxql.VarRef{Val: "time"},
+					RHS: &influxql.StringLiteral{Val: now.UTC().Format(time.RFC3339Nano)},
+				},
+				Dimensions: []*influxql.Dimension{{Expr: &influxql.Call{Name: "time", Args: []influxql.Expr{&influxql.DurationLiteral{Val: 5 * time.Minute}}}}},
+				Fill:       influxql.NextFill,
+			},
+		},
+
 		// SELECT statement with average fill
 		{
 			s: fmt.Sprintf(`SELECT mean(value) FROM cpu where time < '%s' GROUP BY time(5m) FILL(linear)`, now.UTC().Format(time.RFC3339Nano)),
@@ -1060,6 +1079,75 @@ func TestParser_ParseStatement(t *testing.T) {
 			},
 		},
 
+		// SELECT statement with a timezone
+		{
+			s: `SELECT mean(value) FROM cpu WHERE time > now() - 7d GROUP BY time(1d) tz('America/New_York')`,
+			stmt: &influxql.SelectStatement{
+				Fields: []*influxql.Field{{
+					Expr: &influxql.Call{
+						Name: "mean",
+						Args: []influxql.Expr{&influxql.VarRef{Val: "value"}}}}},
+				Sources: []influxql.Source{&influxql.Measurement{Name: "cpu"}},
+				Condition: &influxql.BinaryExpr{
+					Op:  influxql.GT,
+					LHS: &influxql.VarRef{Val: "time"},
+					RHS: &influxql.BinaryExpr{
+						Op:  influxql.SUB,
+						LHS: &influxql.Call{Name: "now"},
+						RHS: &influxql.DurationLiteral{Val: 7 * 24 * time.Hour},
+					},
+				},
+				Dimensions: []*influxql.Dimension{{Expr: &influxql.Call{Name: "time", Args: []influxql.Expr{&influxql.DurationLiteral{Val: 24 * time.Hour}}}}},
+				Location:   mustLoadLocation("America/New_York"),
+			},
+		},
+
+		// SELECT statement comparing with an earlier time range
+		{
+			s: `SELECT mean(value) FROM cpu WHERE time > now() - 1d GROUP BY time(1h) fill(none) COMPARE PREVIOUS 7d RATIO ORDER BY time DESC`,
+			stmt: &influxql.SelectStatement{
+				Fields: []*influxql.Field{{
+					Expr: &influxql.Call{
+						Name: "mean",
+						Args: []influxql.Expr{&influxql.VarRef{Val: "value"}}}}},
+				Sources: []influxql.Source{&influxql.Measurement{Name: "cpu"}},
+				Condition: &influxql.BinaryExpr{
+					Op:  influxql.GT,
+					LHS: &influxql.VarRef{Val: "time"},
+					RHS: &influxql.BinaryExpr{
+						Op:  influxql.SUB,
+						LHS: &influxql.Call{Name: "now"},
+						RHS: &influxql.DurationLiteral{Val: 24 * time.Hour},
+					},
+				},
+				Dimensions: []*influxql.Dimension{{Expr: &influxql.Call{Name: "time", Args: []influxql.Expr{&influxql.DurationLiteral{Val: time.Hour}}}}},
+				Fill:       influxql.NoFill,
+				Compare:    &influxql.CompareClause{Offset: 7 * 24 * time.Hour, Op: influxql.CompareRatio},
+				SortFields: []*influxql.SortField{{Name: "time", Ascending: false}},
+			},
+		},
+		{
+			s: `SELECT mean(value) FROM cpu WHERE time > now() - 1d GROUP BY time(1h) COMPARE PREVIOUS 1d`,
+			stmt: &influxql.SelectStatement{
+				Fields: []*influxql.Field{{
+					Expr: &influxql.Call{
+						Name: "mean",
+						Args: []influxql.Expr{&influxql.VarRef{Val: "value"}}}}},
+				Sources: []influxql.Source{&influxql.Measurement{Name: "cpu"}},
+				Condition: &influxql.BinaryExpr{
+					Op:  influxql.GT,
+					LHS: &influxql.VarRef{Val: "time"},
+					RHS: &influxql.BinaryExpr{
+						Op:  influxql.SUB,
+						LHS: &influxql.Call{Name: "now"},
+						RHS: &influxql.DurationLiteral{Val: 24 * time.Hour},
+					},
+				},
+				Dimensions: []*influxql.Dimension{{Expr: &influxql.Call{Name: "time", Args: []influxql.Expr{&influxql.DurationLiteral{Val: time.Hour}}}}},
+				Compare:    &influxql.CompareClause{Offset: 24 * time.Hour},
+			},
+		},
+
 		// SELECT casts
 		{
 			s: `SELECT field1::float, field2::integer, field3::string, field4::boolean, field5::field, tag1::tag FROM cpu`,
@@ -1518,6 +1606,36 @@ func TestParser_ParseStatement(t *testing.T) {
 			},
 		},
 
+		// UNDROP SHARD 12
+		{
+			s:    `UNDROP SHARD 12`,
+			stmt: &influxql.UndropShardStatement{ID: 12},
+		},
+
+		// DEFRAGMENT SHARD 12
+		{
+			s:    `DEFRAGMENT SHARD 12`,
+			stmt: &influxql.DefragmentShardStatement{ID: 12},
+		},
+
+		// MIGRATE FIELD TYPE
+		{
+			s: `MIGRATE FIELD TYPE value FROM cpu TO float`,
+			stmt: &influxql.MigrateFieldTypeStatement{
+				Measurement: "cpu",
+				Field:       "value",
+				Type:        influxql.Float,
+			},
+		},
+		{
+			s: `migrate field type "usage idle" from "cpu load" to Boolean`,
+			stmt: &influxql.MigrateFieldTypeStatement{
+				Measurement: "cpu load",
+				Field:       "usage idle",
+				Type:        influxql.Boolean,
+			},
+		},
+
 		// SHOW RETENTION POLICIES
 		{
 			s:    `SHOW RETENTION POLICIES`,
@@ -2359,6 +2477,17 @@ func TestParser_ParseStatement(t *testing.T) {
 			stmt: newAlterRetentionPolicyStatement("policy1", "testdb", -1, -1, 4, true),
 		},
 
+		// ALTER DATABASE
+		{
+			s:    `ALTER DATABASE testdb WITH PRECISION s`,
+			stmt: &influxql.AlterDatabaseStatement{Name: "testdb", Precision: "s"},
+		},
+		// ALTER DATABASE with quoted precision
+		{
+			s:    `ALTER DATABASE testdb with precision 'ms'`,
+			stmt: &influxql.AlterDatabaseStatement{Name: "testdb", Precision: "ms"},
+		},
+
 		// ALTER RETENTION POLICY without optional REPLICATION
 		{
 			s:    `ALTER RETENTION POLICY policy1 ON testdb DEFAULT`,
@@ -2390,6 +2519,25 @@ func TestParser_ParseStatement(t *testing.T) {
 			s:    `ALTER RETENTION POLICY default ON testdb DURATION 0s REPLICATION 1 SHARD DURATION 0s`,
 			stmt: newAlterRetentionPolicyStatement("default", "testdb", time.Duration(0), 0, 1, false),
 		},
+		// ALTER RETENTION POLICY with isolated measurements
+		{
+			s: `ALTER RETENTION POLICY policy1 ON testdb ISOLATE MEASUREMENTS (cpu, "disk io")`,
+			stmt: &influxql.AlterRetentionPolicyStatement{
+				Name:                 "policy1",
+				Database:             "testdb",
+				IsolatedMeasurements: []string{"cpu", "disk io"},
+			},
+		},
+		// ALTER RETENTION POLICY with no isolated measurements
+		{
+			s: `ALTER RETENTION POLICY policy1 ON testdb REPLICATION 2 ISOLATE MEASUREMENTS ()`,
+			stmt: &influxql.AlterRetentionPolicyStatement{
+				Name:                 "policy1",
+				Database:             "testdb",
+				Replication:          intptr(2),
+				IsolatedMeasurements: []string{},
+			},
+		},
 
 		// SHOW STATS
 		{
@@ -2457,11 +2605,43 @@ func TestParser_ParseStatement(t *testing.T) {
 			stmt: &influxql.ShowSubscriptionsStatement{},
 		},
 
+		// CREATE VALIDATION RULE requiring a tag
+		{
+			s:    `CREATE VALIDATION RULE host_required ON testdb FROM cpu REQUIRE TAG host`,
+			stmt: &influxql.CreateValidationRuleStatement{Name: "host_required", Database: "testdb", Measurement: "cpu", Tag: "host"},
+		},
+
+		// CREATE VALIDATION RULE bounding a field
+		{
+			s:    `create validation rule temp ON testdb require field temperature between -50 and 150.5`,
+			stmt: &influxql.CreateValidationRuleStatement{Name: "temp", Database: "testdb", Field: "temperature", Min: -50, Max: 150.5},
+		},
+
+		// DROP VALIDATION RULE
+		{
+			s:    `DROP VALIDATION RULE host_required ON testdb`,
+			stmt: &influxql.DropValidationRuleStatement{Name: "host_required", Database: "testdb"},
+		},
+
+		// SHOW VALIDATION RULES
+		{
+			s:    `SHOW VALIDATION RULES ON testdb`,
+			stmt: &influxql.ShowValidationRulesStatement{Database: "testdb"},
+		},
+
 		// Errors
-		{s: ``, err: `found EOF, expected SELECT, DELETE, SHOW, CREATE, DROP, GRANT, REVOKE, ALTER, SET, KILL at line 1, char 1`},
+		{s: ``, err: `found EOF, expected SELECT, DELETE, SHOW, CREATE, DROP, GRANT, REVOKE, ALTER, SET, KILL, UNDROP, MIGRATE, DEFRAGMENT at line 1, char 1`},
 		{s: `SELECT`, err: `found EOF, expected identifier, string, number, bool at line 1, char 8`},
+		{s: `UNDROP DATABASE db0`, err: `found DATABASE, expected SHARD at line 1, char 8`},
+		{s: `DEFRAGMENT SHARDS`, err: `found SHARDS, expected SHARD at line 1, char 12`},
+		{s: `DEFRAGMENT SHARD`, err: `found EOF, expected integer at line 1, char 18`},
+		{s: `MIGRATE TYPE value FROM cpu TO float`, err: `found TYPE, expected FIELD at line 1, char 9`},
+		{s: `MIGRATE FIELD value FROM cpu TO float`, err: `found value, expected TYPE at line 1, char 15`},
+		{s: `MIGRATE FIELD TYPE value TO float`, err: `found TO, expected FROM at line 1, char 26`},
+		{s: `MIGRATE FIELD TYPE value FROM cpu`, err: `found EOF, expected TO at line 1, char 35`},
+		{s: `MIGRATE FIELD TYPE value FROM cpu TO time`, err: `found time, expected float, integer, string, boolean at line 1, char 38`},
 		{s: `SELECT time FROM myseries`, err: `at least 1 non-time field must be queried`},
-		{s: `blah blah`, err: `found blah, expected SELECT, DELETE, SHOW, CREATE, DROP, GRANT, REVOKE, ALTER, SET, KILL at line 1, char 1`},
+		{s: `blah blah`, err: `found blah, expected SELECT, DELETE, SHOW, CREATE, DROP, GRANT, REVOKE, ALTER, SET, KILL, UNDROP, MIGRATE, DEFRAGMENT at line 1, char 1`},
 		{s: `SELECT field1 X`, err: `found X, expected FROM at line 1, char 15`},
 		{s: `SELECT field1 FROM "series" WHERE X +;`, err: `found ;, expected identifier, string, number, bool at line 1, char 38`},
 		{s: `SELECT field1 FROM myseries GROUP`, err: `found EOF, expected BY at line 1, char 35`},
@@ -2499,6 +2679,12 @@ func TestParser_ParseStatement(t *testing.T) {
 		{s: `SELECT bottom(max(value), 10) FROM myseries`, err: `only fields or tags are allowed in bottom(), found max(value)`},
 		{s: `SELECT percentile() FROM myseries`, err: `invalid number of arguments for percentile, expected 2, got 0`},
 		{s: `SELECT percentile(field1) FROM myseries`, err: `invalid number of arguments for percentile, expected 2, got 1`},
+		{s: `SELECT time_weighted_mean() FROM myseries`, err: `invalid number of arguments for time_weighted_mean, expected 1, got 0`},
+		{s: `SELECT time_weighted_mean(field1, 1s) FROM myseries`, err: `invalid number of arguments for time_weighted_mean, expected 1, got 2`},
+		{s: `SELECT time_weighted_integral(field1, 1s, 1s) FROM myseries`, err: `invalid number of arguments for time_weighted_integral, expected at least 1 but no more than 2, got 3`},
+		{s: `SELECT time_weighted_integral(field1, 1) FROM myseries`, err: `second argument to time_weighted_integral must be a duration, got *influxql.IntegerLiteral`},
+		{s: `SELECT time_weighted_integral(field1, 0s) FROM myseries`, err: `duration argument must be positive, got 0s`},
+		{s: `SELECT time_weighted_mean(1) FROM myseries`, err: `expected field argument in time_weighted_mean()`},
 		{s: `SELECT percentile(field1, foo) FROM myseries`, err: `expected float argument in percentile()`},
 		{s: `SELECT percentile(max(field1), 75) FROM myseries`, err: `expected field argument in percentile()`},
 		{s: `SELECT field1 FROM myseries OFFSET`, err: `found EOF, expected integer at line 1, char 36`},
@@ -2571,6 +2757,30 @@ func TestParser_ParseStatement(t *testing.T) {
 		{s: `SELECT moving_average(max(), 2) FROM myseries where time < now() and time > now() - 1d group by time(1h)`, err: `invalid number of arguments for max, expected 1, got 0`},
 		{s: `SELECT moving_average(percentile(value), 2) FROM myseries where time < now() and time > now() - 1d group by time(1h)`, err: `invalid number of arguments for percentile, expected 2, got 1`},
 		{s: `SELECT moving_average(mean(value), 2) FROM myseries where time < now() and time > now() - 1d`, err: `moving_average aggregate requires a GROUP BY interval`},
+		{s: `SELECT lag(value) FROM myseries`, err: `invalid number of arguments for lag, expected 2, got 1`},
+		{s: `SELECT lag(value, 'a') FROM myseries`, err: `second argument for lag must be an integer, got *influxql.StringLiteral`},
+		{s: `SELECT lead(value, 0) FROM myseries`, err: `lead offset must be greater than 0, got 0`},
+		{s: `SELECT lead(value, 1) FROM myseries group by time(1h)`, err: `aggregate function required inside the call to lead`},
+		{s: `SELECT flag_outliers(value) FROM myseries`, err: `invalid number of arguments for flag_outliers, expected 2, got 1`},
+		{s: `SELECT flag_outliers(value, 'a') FROM myseries`, err: `second argument for flag_outliers must be a number, got *influxql.StringLiteral`},
+		{s: `SELECT flag_outliers(value, 0) FROM myseries`, err: `flag_outliers deviation must be greater than 0, got 0`},
+		{s: `SELECT flag_outliers(value, 2) FROM myseries group by time(1h)`, err: `aggregate function required inside the call to flag_outliers`},
+		{s: `SELECT empty_as(mean(value)) FROM myseries`, err: `invalid number of arguments for empty_as, expected 2, got 1`},
+		{s: `SELECT empty_as(value, 0) FROM myseries`, err: `expected aggregate argument in empty_as()`},
+		{s: `SELECT empty_as(derivative(value), 0) FROM myseries`, err: `unsupported aggregate in empty_as(): derivative`},
+		{s: `SELECT empty_as(mean(value), host) FROM myseries`, err: `expected literal argument in empty_as()`},
+		{s: `SELECT empty_as(percentile(value), 0) FROM myseries`, err: `invalid number of arguments for percentile, expected 2, got 1`},
+		{s: `SELECT mean(value) FROM myseries GROUP BY time(1h) COMPARE 7d`, err: `found 7d, expected PREVIOUS at line 1, char 60`},
+		{s: `SELECT mean(value) FROM myseries GROUP BY time(1h) COMPARE PREVIOUS week`, err: `found week, expected duration at line 1, char 69`},
+		{s: `SELECT mean(value) FROM myseries GROUP BY time(1h) COMPARE PREVIOUS 0s`, err: `COMPARE PREVIOUS duration must be greater than 0 at line 1, char 69`},
+		{s: `SELECT value FROM myseries COMPARE PREVIOUS 7d`, err: `COMPARE requires GROUP BY time()`},
+		{s: `SELECT value FROM myseries tz('Mars/Olympus_Mons')`, err: `unable to find time zone Mars/Olympus_Mons at line 1, char 30`},
+		{s: `SELECT value FROM myseries tz(UTC)`, err: `found UTC, expected string at line 1, char 31`},
+		{s: `SELECT value FROM myseries tz('UTC'`, err: `found EOF, expected ) at line 1, char 36`},
+		{s: `SELECT mean(value) FROM myseries WHERE time > now() - 1d GROUP BY time(5d) COMPARE PREVIOUS 7d`, err: `COMPARE PREVIOUS 1w must be a multiple of the GROUP BY interval 5d`},
+		{s: `SELECT mean(value) FROM myseries WHERE time > now() - 1d GROUP BY time(1h) COMPARE PREVIOUS 7d LIMIT 1`, err: `LIMIT and OFFSET are not supported with COMPARE`},
+		{s: `SELECT mean(value) INTO other FROM myseries WHERE time > now() - 1d GROUP BY time(1h) COMPARE PREVIOUS 7d`, err: `COMPARE is not supported with INTO`},
+		{s: `SELECT value FROM (SELECT mean(value) AS value FROM myseries GROUP BY time(1h) COMPARE PREVIOUS 7d)`, err: `COMPARE is not supported in subqueries`},
 		{s: `SELECT cumulative_sum(), field1 FROM myseries`, err: `mixing aggregate and non-aggregate queries is not supported`},
 		{s: `SELECT cumulative_sum() from myseries`, err: `invalid number of arguments for cumulative_sum, expected 1, got 0`},
 		{s: `SELECT cumulative_sum(value) FROM myseries group by time(1h)`, err: `aggregate function required inside the call to cumulative_sum`},
@@ -2620,7 +2830,7 @@ func TestParser_ParseStatement(t *testing.T) {
 		{s: `SHOW RETENTION ON`, err: `found ON, expected POLICIES at line 1, char 16`},
 		{s: `SHOW RETENTION POLICIES ON`, err: `found EOF, expected identifier at line 1, char 28`},
 		{s: `SHOW SHARD`, err: `found EOF, expected GROUPS at line 1, char 12`},
-		{s: `SHOW FOO`, err: `found FOO, expected CONTINUOUS, DATABASES, DIAGNOSTICS, FIELD, GRANTS, MEASUREMENTS, QUERIES, RETENTION, SERIES, SHARD, SHARDS, STATS, SUBSCRIPTIONS, TAG, USERS at line 1, char 6`},
+		{s: `SHOW FOO`, err: `found FOO, expected CONTINUOUS, DATABASES, DIAGNOSTICS, FIELD, GRANTS, MEASUREMENTS, QUERIES, RETENTION, SERIES, SHARD, SHARDS, STATS, SUBSCRIPTIONS, TAG, USERS, VALIDATION at line 1, char 6`},
 		{s: `SHOW STATS FOR`, err: `found EOF, expected string at line 1, char 16`},
 		{s: `SHOW DIAGNOSTICS FOR`, err: `found EOF, expected string at line 1, char 22`},
 		{s: `SHOW GRANTS`, err: `found EOF, expected FOR at line 1, char 13`},
@@ -2633,8 +2843,13 @@ func TestParser_ParseStatement(t *testing.T) {
 		{s: `CREATE CONTINUOUS QUERY`, err: `found EOF, expected identifier at line 1, char 25`},
 		{s: `CREATE CONTINUOUS QUERY cq ON db RESAMPLE FOR 5s BEGIN SELECT mean(value) INTO cpu_mean FROM cpu GROUP BY time(10s) END`, err: `FOR duration must be >= GROUP BY time duration: must be a minimum of 10s, got 5s`},
 		{s: `CREATE CONTINUOUS QUERY cq ON db RESAMPLE EVERY 10s FOR 5s BEGIN SELECT mean(value) INTO cpu_mean FROM cpu GROUP BY time(5s) END`, err: `FOR duration must be >= GROUP BY time duration: must be a minimum of 10s, got 5s`},
-		{s: `DROP FOO`, err: `found FOO, expected CONTINUOUS, MEASUREMENT, RETENTION, SERIES, SHARD, SUBSCRIPTION, USER at line 1, char 6`},
-		{s: `CREATE FOO`, err: `found FOO, expected CONTINUOUS, DATABASE, USER, RETENTION, SUBSCRIPTION at line 1, char 8`},
+		{s: `CREATE VALIDATION RULE r0 ON db0`, err: `found EOF, expected REQUIRE at line 1, char 34`},
+		{s: `CREATE VALIDATION RULE r0 ON db0 REQUIRE TAGS host`, err: `found TAGS, expected TAG, FIELD at line 1, char 42`},
+		{s: `CREATE VALIDATION RULE r0 ON db0 REQUIRE FIELD f BETWEEN 10 AND 1`, err: `invalid range: maximum is less than the minimum at line 1, char 61`},
+		{s: `CREATE VALIDATION RULE r0 ON db0 REQUIRE FIELD f BETWEEN 'a' AND 1`, err: `found a, expected number at line 1, char 57`},
+		{s: `DROP VALIDATION RULES r0 ON db0`, err: `found RULES, expected RULE at line 1, char 17`},
+		{s: `DROP FOO`, err: `found FOO, expected CONTINUOUS, MEASUREMENT, RETENTION, SERIES, SHARD, SUBSCRIPTION, USER, VALIDATION at line 1, char 6`},
+		{s: `CREATE FOO`, err: `found FOO, expected CONTINUOUS, DATABASE, USER, RETENTION, SUBSCRIPTION, VALIDATION at line 1, char 8`},
 		{s: `CREATE DATABASE`, err: `found EOF, expected identifier at line 1, char 17`},
 		{s: `CREATE DATABASE "testdb" WITH`, err: `found EOF, expected DURATION, NAME, REPLICATION, SHARD at line 1, char 31`},
 		{s: `CREATE DATABASE "testdb" WITH DURATION`, err: `found EOF, expected duration at line 1, char 40`},
@@ -2745,11 +2960,20 @@ func TestParser_ParseStatement(t *testing.T) {
 		{s: `CREATE RETENTION POLICY policy1 ON testdb DURATION 1h REPLICATION 0`, err: `invalid value 0: must be 1 <= n <= 2147483647 at line 1, char 67`},
 		{s: `CREATE RETENTION POLICY policy1 ON testdb DURATION 1h REPLICATION bad`, err: `found bad, expected integer at line 1, char 67`},
 		{s: `CREATE RETENTION POLICY policy1 ON testdb DURATION 1h REPLICATION 2 SHARD DURATION INF`, err: `invalid duration INF for shard duration at line 1, char 84`},
-		{s: `ALTER`, err: `found EOF, expected RETENTION at line 1, char 7`},
+		{s: `ALTER`, err: `found EOF, expected DATABASE, RETENTION at line 1, char 7`},
+		{s: `ALTER DATABASE`, err: `found EOF, expected identifier at line 1, char 16`},
+		{s: `ALTER DATABASE testdb`, err: `found EOF, expected WITH at line 1, char 23`},
+		{s: `ALTER DATABASE testdb WITH`, err: `found EOF, expected PRECISION at line 1, char 28`},
+		{s: `ALTER DATABASE testdb WITH PRECISION`, err: `found EOF, expected precision at line 1, char 38`},
+		{s: `ALTER DATABASE testdb WITH PRECISION ns`, err: `invalid precision ns, expected one of n, u, ms, s, m, h at line 1, char 38`},
 		{s: `ALTER RETENTION`, err: `found EOF, expected POLICY at line 1, char 17`},
 		{s: `ALTER RETENTION POLICY`, err: `found EOF, expected identifier at line 1, char 24`},
 		{s: `ALTER RETENTION POLICY policy1`, err: `found EOF, expected ON at line 1, char 32`}, {s: `ALTER RETENTION POLICY policy1 ON`, err: `found EOF, expected identifier at line 1, char 35`},
-		{s: `ALTER RETENTION POLICY policy1 ON testdb`, err: `found EOF, expected DURATION, REPLICATION, SHARD, DEFAULT at line 1, char 42`},
+		{s: `ALTER RETENTION POLICY policy1 ON testdb`, err: `found EOF, expected DURATION, REPLICATION, SHARD, DEFAULT, ISOLATE at line 1, char 42`},
+		{s: `ALTER RETENTION POLICY policy1 ON testdb ISOLATE (cpu)`, err: `found (, expected MEASUREMENTS at line 1, char 50`},
+		{s: `ALTER RETENTION POLICY policy1 ON testdb ISOLATE MEASUREMENTS cpu`, err: `found cpu, expected ( at line 1, char 63`},
+		{s: `ALTER RETENTION POLICY policy1 ON testdb ISOLATE MEASUREMENTS (cpu mem)`, err: `found mem, expected ) at line 1, char 68`},
+		{s: `ALTER RETENTION POLICY policy1 ON testdb ISOLATE MEASUREMENTS () ISOLATE MEASUREMENTS ()`, err: `found duplicate ISOLATE option at line 1, char 66`},
 		{s: `ALTER RETENTION POLICY policy1 ON testdb REPLICATION 1 REPLICATION 2`, err: `found duplicate REPLICATION option at line 1, char 56`},
 		{s: `ALTER RETENTION POLICY policy1 ON testdb DURATION 15251w`, err: `overflowed duration 15251w: choose a smaller duration or INF at line 1, char 51`},
 		{s: `ALTER RETENTION POLICY policy1 ON testdb DURATION INF SHARD DURATION INF`, err: `invalid duration INF for shard duration at line 1, char 70`},
@@ -2760,7 +2984,7 @@ func TestParser_ParseStatement(t *testing.T) {
 		{s: `SET PASSWORD FOR dejan`, err: `found EOF, expected = at line 1, char 24`},
 		{s: `SET PASSWORD FOR dejan =`, err: `found EOF, expected string at line 1, char 25`},
 		{s: `SET PASSWORD FOR dejan = bla`, err: `found bla, expected string at line 1, char 26`},
-		{s: `$SHOW$DATABASES`, err: `found $SHOW, expected SELECT, DELETE, SHOW, CREATE, DROP, GRANT, REVOKE, ALTER, SET, KILL at line 1, char 1`},
+		{s: `$SHOW$DATABASES`, err: `found $SHOW, expected SELECT, DELETE, SHOW, CREATE, DROP, GRANT, REVOKE, ALTER, SET, KILL, UNDROP, MIGRATE, DEFRAGMENT at line 1, char 1`},
 		{s: `SELECT * FROM cpu WHERE "tagkey" = $$`, err: `empty bound parameter`},
 	}
 
@@ -3361,6 +3585,14 @@ func mustParseDuration(s string) time.Duration {
 	return d
 }
 
+func mustLoadLocation(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		panic(err)
+	}
+	return loc
+}
+
 func duration(v time.Duration) *time.Duration {
 	return &v
 }
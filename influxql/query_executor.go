@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"runtime/debug"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -32,6 +33,10 @@ var (
 
 	// ErrQueryTimeoutLimitExceeded is an error when a query hits the max time allowed to run.
 	ErrQueryTimeoutLimitExceeded = errors.New("query-timeout limit exceeded")
+
+	// ErrMetaQueryRateLimitExceeded is an error when a metadata query is
+	// rejected because too many metadata queries have been run recently.
+	ErrMetaQueryRateLimitExceeded = errors.New("max-meta-query-rate limit exceeded")
 )
 
 // Statistics for the QueryExecutor
@@ -74,6 +79,80 @@ var _ Authorizer = OpenAuthorizer{}
 // AuthorizeDatabase returns true to allow any operation on a database.
 func (OpenAuthorizer) AuthorizeDatabase(Privilege, string) bool { return true }
 
+// Aggregates used to downsample results to ExecutionOptions.MaxPoints.
+const (
+	// DownsampleAuto picks an aggregate for each column from the function
+	// that produced it: max() and top() use the maximum, min() and bottom()
+	// the minimum, count() and sum() the sum, and everything else the mean.
+	DownsampleAuto = "auto"
+
+	// DownsampleMean, DownsampleMin and DownsampleMax use the same aggregate
+	// for every numeric column.
+	DownsampleMean = "mean"
+	DownsampleMin  = "min"
+	DownsampleMax  = "max"
+
+	// DownsampleBand uses the mean for every numeric column and adds the
+	// minimum and maximum of each bucket in "<column>_min" and "<column>_max"
+	// columns following it.
+	DownsampleBand = "band"
+)
+
+// Policies for reading a field whose type differs between shards.
+const (
+	// FieldTypePrecedence reads the field as the type with the highest
+	// precedence of float, integer, string and boolean. Integers and floats
+	// are cast to that type while values of other types are left out.
+	FieldTypePrecedence = "precedence"
+
+	// FieldTypeNewest reads the field as its type in the newest shard that
+	// has it, casting and leaving out values as FieldTypePrecedence does.
+	FieldTypeNewest = "newest"
+
+	// FieldTypeFloat reads every value of the field as a float. Booleans are
+	// read as 1 and 0 and strings that do not hold a number are left out.
+	FieldTypeFloat = "float"
+
+	// FieldTypeTyped returns a column for each type of a field that is
+	// selected directly, named "<field>_<type>", holding the values stored
+	// with that type. Fields used in functions are read as with
+	// FieldTypePrecedence.
+	FieldTypeTyped = "typed"
+)
+
+// Edges of GROUP BY time() buckets that include a point exactly on them.
+const (
+	// BucketEdgeStart puts a point on the edge between two buckets in the
+	// bucket that starts at its time. Buckets are labeled with their start.
+	BucketEdgeStart = "start"
+
+	// BucketEdgeEnd puts a point on the edge between two buckets in the
+	// bucket that ends at its time. Buckets are labeled with their end.
+	BucketEdgeEnd = "end"
+)
+
+// Handling of SELECT statements whose time range is empty, such as when the
+// start is after the end once now() is evaluated.
+const (
+	// EmptyTimeRangeIgnore returns no results for the statement.
+	EmptyTimeRangeIgnore = "ignore"
+
+	// EmptyTimeRangeError fails the statement with an error that gives the
+	// resolved start and end.
+	EmptyTimeRangeError = "error"
+)
+
+// Rankings of the series a SELECT is sampled to.
+const (
+	// SampleSeriesPoints keeps the series with the most points in the
+	// queried time range.
+	SampleSeriesPoints = "points"
+
+	// SampleSeriesRecent keeps the series with the most recent points in
+	// the queried time range.
+	SampleSeriesRecent = "recent"
+)
+
 // ExecutionOptions contains the options for executing a query.
 type ExecutionOptions struct {
 	// The database the query is running against.
@@ -95,6 +174,103 @@ type ExecutionOptions struct {
 	// Quiet suppresses non-essential output from the query executor.
 	Quiet bool
 
+	// MarkFilled adds a "_filled" column to SELECT results that is true for
+	// rows containing values generated by fill().
+	MarkFilled bool
+
+	// AlignToStart aligns GROUP BY time() buckets to the start time of the
+	// query instead of the epoch.
+	AlignToStart bool
+
+	// MaxPoints downsamples each series of a SELECT result to at most this
+	// many points. A value of zero returns every point.
+	MaxPoints int
+
+	// MaxPointsAggregate is the aggregate used to combine points when
+	// downsampling. It is one of the Downsample constants.
+	MaxPointsAggregate string
+
+	// MergePrecision truncates the timestamps of each series of a SELECT
+	// result to this precision and merges the points with the same truncated
+	// timestamp. A value of zero returns every point.
+	MergePrecision time.Duration
+
+	// RecentWrites adds a warning to SELECT results when points in the
+	// queried time range were written within this duration, since the
+	// results may change as late data arrives. A value of zero disables it.
+	RecentWrites time.Duration
+
+	// MaxGroups stops a SELECT after returning this many series, such as the
+	// groups of a GROUP BY, and adds a warning to the results if any were
+	// left out. A value of zero returns every series.
+	MaxGroups int
+
+	// Stats adds a message to SELECT results with the points scanned and the
+	// peak memory used while executing the statement.
+	Stats bool
+
+	// DedupeSubqueries removes rows with the same series and time returned
+	// by overlapping subqueries of a SELECT.
+	DedupeSubqueries bool
+
+	// StableMerge merges points from series that have the same tags after
+	// projection in a fixed order so repeated queries return identically
+	// ordered rows.
+	StableMerge bool
+
+	// FieldTypePolicy is how a field whose type differs between shards is
+	// read. The default is FieldTypePrecedence.
+	FieldTypePolicy string
+
+	// BucketEdge is the edge of a GROUP BY time() bucket that includes
+	// points exactly on it. The default is BucketEdgeStart.
+	BucketEdge string
+
+	// EmptyTimeRange is how a SELECT whose time range is empty is handled.
+	// The default is EmptyTimeRangeIgnore.
+	EmptyTimeRange string
+
+	// DecimalPlaces performs arithmetic in the field expressions of a SELECT
+	// on decimal numbers rounded to this many decimal places instead of on
+	// floats. Zero uses float arithmetic.
+	DecimalPlaces int
+
+	// IteratorBufferSize overrides the number of points iterators running in
+	// a separate goroutine read ahead. Zero uses the server default.
+	IteratorBufferSize int
+
+	// NoDefaultLimit runs raw SELECT statements without a LIMIT unlimited,
+	// even if the server adds a default LIMIT to them.
+	NoDefaultLimit bool
+
+	// Checkpoints adds a checkpoint token to each result of a SELECT, which
+	// identifies the last point returned so far.
+	Checkpoints bool
+
+	// Resume skips the points of a SELECT up to and including the
+	// checkpoint, so a query that was interrupted continues where it left
+	// off.
+	Resume *Checkpoint
+
+	// LeapSecond is how time literals at a leap second, such as
+	// '2016-12-31T23:59:60Z', are parsed in the conditions of a SELECT. It is
+	// one of the models.LeapSecond constants. The default rejects them as
+	// invalid times.
+	LeapSecond string
+
+	// ShareScans computes the aggregates of a SELECT that selects several
+	// aggregates of fields from one scan of each measurement.
+	ShareScans bool
+
+	// SampleSeries limits a SELECT from a single measurement to this many of
+	// its series, ranked by SampleSeriesBy, overriding the server default.
+	// Zero uses the server default.
+	SampleSeries int
+
+	// SampleSeriesBy is how the series a SELECT is sampled to are ranked. It
+	// is one of the SampleSeries constants. Empty uses the server default.
+	SampleSeriesBy string
+
 	// AbortCh is a channel that signals when results are no longer desired by the caller.
 	AbortCh <-chan struct{}
 }
@@ -208,6 +384,11 @@ func (e *QueryExecutor) Statistics(tags map[string]string) []models.Statistic {
 	}}
 }
 
+// ActiveQueries returns the number of queries currently running.
+func (e *QueryExecutor) ActiveQueries() int64 {
+	return atomic.LoadInt64(&e.stats.ActiveQueries)
+}
+
 // Close kills all running queries and prevents new queries from being attached.
 func (e *QueryExecutor) Close() error {
 	return e.TaskManager.Close()
@@ -312,6 +493,11 @@ LOOP:
 		}
 		stmt = newStmt
 
+		// Parse leap seconds in time literals with the requested policy.
+		if opt.LeapSecond != "" && opt.LeapSecond != models.LeapSecondReject {
+			rewriteLeapSeconds(stmt, opt.LeapSecond)
+		}
+
 		// Normalize each statement if possible.
 		if normalizer, ok := e.StatementExecutor.(StatementNormalizer); ok {
 			if err := normalizer.NormalizeStatement(stmt, defaultDB); err != nil {
@@ -376,6 +562,49 @@ LOOP:
 	}
 }
 
+// rewriteLeapSeconds replaces the strings compared with time in the
+// conditions of the SELECT statements in stmt that are leap seconds with
+// the time literal given by the leap second policy.
+func rewriteLeapSeconds(stmt Statement, policy string) {
+	WalkFunc(stmt, func(n Node) {
+		s, ok := n.(*SelectStatement)
+		if !ok || s.Condition == nil {
+			return
+		}
+
+		s.Condition = RewriteExpr(s.Condition, func(e Expr) Expr {
+			expr, ok := e.(*BinaryExpr)
+			if !ok {
+				return e
+			}
+			if ref, ok := expr.LHS.(*VarRef); ok && strings.ToLower(ref.Val) == "time" {
+				expr.RHS = leapSecondLiteral(expr.RHS, policy)
+			} else if ref, ok := expr.RHS.(*VarRef); ok && strings.ToLower(ref.Val) == "time" {
+				expr.LHS = leapSecondLiteral(expr.LHS, policy)
+			}
+			return e
+		})
+	})
+}
+
+// leapSecondLiteral returns a time literal for expr if it is a string of a
+// leap second. Otherwise expr is returned unchanged.
+func leapSecondLiteral(expr Expr, policy string) Expr {
+	lit, ok := expr.(*StringLiteral)
+	if !ok || !lit.IsTimeLiteral() {
+		return expr
+	} else if _, err := lit.ToTimeLiteral(); err == nil {
+		return expr
+	}
+
+	for _, layout := range []string{DateTimeFormat, time.RFC3339Nano} {
+		if t, err := models.ParseTimeLeapSecond(layout, lit.Val, policy); err == nil {
+			return &TimeLiteral{Val: t}
+		}
+	}
+	return expr
+}
+
 func (e *QueryExecutor) recover(query *Query, results chan *Result) {
 	if err := recover(); err != nil {
 		e.Logger.Error(fmt.Sprintf("%s [panic:%s] %s", query.String(), err, debug.Stack()))
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/lucaswiersma/influxdb/influxql"
+	"github.com/lucaswiersma/influxdb/models"
 )
 
 var errUnexpected = errors.New("unexpected error")
@@ -310,6 +311,52 @@ func TestQueryExecutor_Panic(t *testing.T) {
 	}
 }
 
+// Ensure time literals at a leap second are parsed with the leap second policy.
+func TestQueryExecutor_LeapSecond(t *testing.T) {
+	for _, tt := range []struct {
+		policy string
+		q      string
+		exp    string
+	}{
+		{
+			policy: "",
+			q:      `SELECT count(value) FROM cpu WHERE time >= '2016-12-31T23:59:60Z'`,
+			exp:    `SELECT count(value) FROM cpu WHERE time >= '2016-12-31T23:59:60Z'`,
+		},
+		{
+			policy: models.LeapSecondClamp,
+			q:      `SELECT count(value) FROM cpu WHERE time >= '2016-12-31T23:59:60Z' AND host = '2016-12-31T23:59:60Z'`,
+			exp:    `SELECT count(value) FROM cpu WHERE time >= '2016-12-31T23:59:59.999999999Z' AND host = '2016-12-31T23:59:60Z'`,
+		},
+		{
+			policy: models.LeapSecondNext,
+			q:      `SELECT count(value) FROM cpu WHERE '2016-12-31 23:59:60.5' > time AND time > '2016-12-31T23:00:00Z'`,
+			exp:    `SELECT count(value) FROM cpu WHERE '2017-01-01T00:00:00.5Z' > time AND time > '2016-12-31T23:00:00Z'`,
+		},
+		{
+			policy: models.LeapSecondNext,
+			q:      `SELECT max FROM (SELECT max(value) FROM cpu WHERE time < '2016-12-31T23:59:60Z' GROUP BY time(1s))`,
+			exp:    `SELECT max FROM (SELECT max(value) FROM cpu WHERE time < '2017-01-01T00:00:00Z' GROUP BY time(1s))`,
+		},
+	} {
+		q, err := influxql.ParseQuery(tt.q)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		e := NewQueryExecutor()
+		e.StatementExecutor = &StatementExecutor{
+			ExecuteStatementFn: func(stmt influxql.Statement, ctx influxql.ExecutionContext) error {
+				if got := stmt.String(); got != tt.exp {
+					t.Errorf("%s: unexpected statement:\n\ngot=%s\n\nexp=%s", tt.policy, got, tt.exp)
+				}
+				return nil
+			},
+		}
+		discardOutput(e.ExecuteQuery(q, influxql.ExecutionOptions{LeapSecond: tt.policy}, nil))
+	}
+}
+
 func TestQueryExecutor_InvalidSource(t *testing.T) {
 	e := NewQueryExecutor()
 	e.StatementExecutor = &StatementExecutor{
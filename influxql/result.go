@@ -4,6 +4,9 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/lucaswiersma/influxdb/models"
 )
@@ -11,6 +14,9 @@ import (
 const (
 	// WarningLevel is the message level for a warning.
 	WarningLevel = "warning"
+
+	// InfoLevel is the message level for an informational message.
+	InfoLevel = "info"
 )
 
 // TagSet is a fundamental concept within the query system. It represents a composite series,
@@ -61,6 +67,96 @@ func ReadOnlyWarning(stmt string) *Message {
 	}
 }
 
+// RecentWritesWarning generates a warning message that tells the user points
+// in the queried time range were written within the given duration, so the
+// results may change as late data arrives.
+func RecentWritesWarning(d time.Duration) *Message {
+	return &Message{
+		Level: WarningLevel,
+		Text:  fmt.Sprintf("points in the queried time range were written in the last %s, results may still change as late data arrives", d),
+	}
+}
+
+// UnreadableShardsWarning generates a warning message that tells the user the
+// data in the given shards was skipped because the shards could not be read.
+func UnreadableShardsWarning(ids []uint64) *Message {
+	a := make([]string, len(ids))
+	for i, id := range ids {
+		a[i] = strconv.FormatUint(id, 10)
+	}
+	return &Message{
+		Level: WarningLevel,
+		Text:  fmt.Sprintf("data in shards %s was skipped because the shards are unreadable", strings.Join(a, ", ")),
+	}
+}
+
+// MaxGroupsWarning generates a warning message that tells the user the
+// results were truncated to the given number of series.
+func MaxGroupsWarning(n int) *Message {
+	return &Message{
+		Level: WarningLevel,
+		Text:  fmt.Sprintf("results were truncated to the first %d series, narrow the GROUP BY or raise max_groups to see the rest", n),
+	}
+}
+
+// DefaultLimitWarning generates a warning message that tells the user the
+// server limited each series of a raw query to the given number of points.
+func DefaultLimitWarning(n int) *Message {
+	return &Message{
+		Level: WarningLevel,
+		Text:  fmt.Sprintf("each series was limited to %d points by the default LIMIT, add a LIMIT or set no_default_limit=true to change it", n),
+	}
+}
+
+// MaxSeriesRowsWarning generates a warning message that tells the user each
+// series was truncated to the given number of rows by the server.
+func MaxSeriesRowsWarning(n int) *Message {
+	return &Message{
+		Level: WarningLevel,
+		Text:  fmt.Sprintf("series were truncated to their first %d rows by max-select-series-rows, use LIMIT and OFFSET to page through the rest", n),
+	}
+}
+
+// MaxRowsWarning generates a warning message that tells the user the results
+// were truncated to the given total number of rows by the server.
+func MaxRowsWarning(n int) *Message {
+	return &Message{
+		Level: WarningLevel,
+		Text:  fmt.Sprintf("results were truncated to the first %d rows by max-select-rows, use SLIMIT and SOFFSET or narrow the query to see the rest", n),
+	}
+}
+
+// SampledSeriesWarning generates a warning message that tells the user the
+// results were sampled to n of the total series, ranked by the given ranking.
+func SampledSeriesWarning(n, total int, by string) *Message {
+	ranking := "most points"
+	if by == SampleSeriesRecent {
+		ranking = "most recent points"
+	}
+	return &Message{
+		Level: WarningLevel,
+		Text:  fmt.Sprintf("results were sampled to the %d of %d series with the %s in the queried time range, filter on tags to see others", n, total, ranking),
+	}
+}
+
+// MaxTagValuesWarning generates a warning message that tells the user the tag
+// values of a measurement were truncated to the given number of values.
+func MaxTagValuesWarning(n int) *Message {
+	return &Message{
+		Level: WarningLevel,
+		Text:  fmt.Sprintf("tag values were truncated to the first %d values of each measurement, use LIMIT and OFFSET to page through the rest", n),
+	}
+}
+
+// QueryStatsMessage generates an informational message that tells the user
+// the cost of executing a statement.
+func QueryStatsMessage(stats IteratorStats, peakMemory uint64) *Message {
+	return &Message{
+		Level: InfoLevel,
+		Text:  fmt.Sprintf("statement statistics: points scanned=%d series=%d peak memory=%d bytes", stats.PointN, stats.SeriesN, peakMemory),
+	}
+}
+
 // Result represents a resultset returned from a single statement.
 // Rows represents a list of rows that can be sorted consistently by name/tag.
 type Result struct {
@@ -68,27 +164,40 @@ type Result struct {
 	// to combine statement results if they're being buffered in memory.
 	StatementID int
 	Series      models.Rows
-	Messages    []*Message
-	Partial     bool
-	Err         error
+
+	// Tags are the tags shared by every series in the result that were
+	// removed from the series themselves.
+	Tags map[string]string
+
+	Messages []*Message
+	Partial  bool
+	Err      error
+
+	// Checkpoint is a token identifying the last point returned by the
+	// statement so far. It is only set if checkpoints were requested.
+	Checkpoint string
 }
 
 // MarshalJSON encodes the result into JSON.
 func (r *Result) MarshalJSON() ([]byte, error) {
 	// Define a struct that outputs "error" as a string.
 	var o struct {
-		StatementID int           `json:"statement_id"`
-		Series      []*models.Row `json:"series,omitempty"`
-		Messages    []*Message    `json:"messages,omitempty"`
-		Partial     bool          `json:"partial,omitempty"`
-		Err         string        `json:"error,omitempty"`
+		StatementID int               `json:"statement_id"`
+		Tags        map[string]string `json:"tags,omitempty"`
+		Series      []*models.Row     `json:"series,omitempty"`
+		Messages    []*Message        `json:"messages,omitempty"`
+		Partial     bool              `json:"partial,omitempty"`
+		Checkpoint  string            `json:"checkpoint,omitempty"`
+		Err         string            `json:"error,omitempty"`
 	}
 
 	// Copy fields to output struct.
 	o.StatementID = r.StatementID
+	o.Tags = r.Tags
 	o.Series = r.Series
 	o.Messages = r.Messages
 	o.Partial = r.Partial
+	o.Checkpoint = r.Checkpoint
 	if r.Err != nil {
 		o.Err = r.Err.Error()
 	}
@@ -99,11 +208,13 @@ func (r *Result) MarshalJSON() ([]byte, error) {
 // UnmarshalJSON decodes the data into the Result struct
 func (r *Result) UnmarshalJSON(b []byte) error {
 	var o struct {
-		StatementID int           `json:"statement_id"`
-		Series      []*models.Row `json:"series,omitempty"`
-		Messages    []*Message    `json:"messages,omitempty"`
-		Partial     bool          `json:"partial,omitempty"`
-		Err         string        `json:"error,omitempty"`
+		StatementID int               `json:"statement_id"`
+		Tags        map[string]string `json:"tags,omitempty"`
+		Series      []*models.Row     `json:"series,omitempty"`
+		Messages    []*Message        `json:"messages,omitempty"`
+		Partial     bool              `json:"partial,omitempty"`
+		Checkpoint  string            `json:"checkpoint,omitempty"`
+		Err         string            `json:"error,omitempty"`
 	}
 
 	err := json.Unmarshal(b, &o)
@@ -111,9 +222,11 @@ func (r *Result) UnmarshalJSON(b []byte) error {
 		return err
 	}
 	r.StatementID = o.StatementID
+	r.Tags = o.Tags
 	r.Series = o.Series
 	r.Messages = o.Messages
 	r.Partial = o.Partial
+	r.Checkpoint = o.Checkpoint
 	if o.Err != "" {
 		r.Err = errors.New(o.Err)
 	}
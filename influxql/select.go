@@ -26,6 +26,36 @@ type SelectOptions struct {
 
 	// Maximum number of concurrent series.
 	MaxSeriesN int
+
+	// Aligns GROUP BY time() buckets to MinTime instead of the epoch.
+	AlignToStart bool
+
+	// Removes rows with the same series and time from the results of
+	// overlapping subqueries.
+	DedupeSubqueries bool
+
+	// Merges points with the same series and time in input order.
+	StableMerge bool
+
+	// FieldTypePolicy is how a field whose type differs between shards is read.
+	FieldTypePolicy string
+
+	// BucketEdge is the edge of a GROUP BY time() bucket that includes
+	// points exactly on it.
+	BucketEdge string
+
+	// DecimalPlaces performs arithmetic in field expressions on decimal
+	// numbers rounded to this many decimal places. Zero uses float arithmetic.
+	DecimalPlaces int
+
+	// IteratorBufferSize is the number of points iterators running in a
+	// separate goroutine read ahead. Zero uses DefaultIteratorBufferSize.
+	IteratorBufferSize int
+
+	// ShareScans computes the aggregates of a statement that selects several
+	// aggregates of fields from one scan of each measurement instead of
+	// scanning it once for every aggregate.
+	ShareScans bool
 }
 
 // Select executes stmt against ic and returns a list of iterators to stream from.
@@ -38,9 +68,143 @@ func Select(stmt *SelectStatement, ic IteratorCreator, sopt *SelectOptions) ([]I
 	if err != nil {
 		return nil, err
 	}
+
+	if sopt != nil && sopt.ShareScans {
+		if refs, ok := sharedScanRefs(stmt); ok {
+			shared := newSharedScanIteratorCreator(ic, refs)
+			itrs, err := buildIterators(stmt, shared, opt)
+			if err != nil {
+				shared.close()
+				return nil, err
+			}
+			shared.start()
+			return itrs, nil
+		}
+	}
 	return buildIterators(stmt, ic, opt)
 }
 
+// sharedScanRefs returns the fields read by stmt if its aggregates can be
+// computed from a shared scan. Each field of the statement must be a single
+// aggregate of a field and every source must be a measurement.
+func sharedScanRefs(stmt *SelectStatement) ([]VarRef, bool) {
+	if len(stmt.Fields) < 2 {
+		return nil, false
+	}
+	for _, source := range stmt.Sources {
+		if _, ok := source.(*Measurement); !ok {
+			return nil, false
+		}
+	}
+
+	set := make(map[VarRef]struct{})
+	for _, f := range stmt.Fields {
+		ref, ok := sharedScanCallRef(f.Expr)
+		if !ok {
+			return nil, false
+		}
+		set[*ref] = struct{}{}
+	}
+
+	refs := make([]VarRef, 0, len(set))
+	for ref := range set {
+		refs = append(refs, ref)
+	}
+	sort.Sort(VarRefs(refs))
+	return refs, true
+}
+
+// sharedScanCallRef returns the field of a call that can be computed from a
+// shared scan.
+func sharedScanCallRef(expr Expr) (*VarRef, bool) {
+	call, ok := expr.(*Call)
+	if !ok || len(call.Args) != 1 {
+		return nil, false
+	}
+	switch call.Name {
+	case "count", "min", "max", "sum", "first", "last", "mean":
+	default:
+		return nil, false
+	}
+	ref, ok := call.Args[0].(*VarRef)
+	return ref, ok
+}
+
+// sharedScanIteratorCreator creates the iterators of aggregates from a single
+// raw scan of each measurement. The points of the scan are sent to every
+// aggregate of the measurement as they are read.
+type sharedScanIteratorCreator struct {
+	ic   IteratorCreator
+	refs []VarRef
+	aux  map[string]AuxIterator
+}
+
+func newSharedScanIteratorCreator(ic IteratorCreator, refs []VarRef) *sharedScanIteratorCreator {
+	return &sharedScanIteratorCreator{
+		ic:   ic,
+		refs: refs,
+		aux:  make(map[string]AuxIterator),
+	}
+}
+
+// CreateIterator returns an iterator for the aggregate in opt that reads from
+// the shared scan of source. Other iterators are created as usual.
+func (ic *sharedScanIteratorCreator) CreateIterator(source *Measurement, opt IteratorOptions) (Iterator, error) {
+	call, ok := opt.Expr.(*Call)
+	if !ok {
+		return ic.ic.CreateIterator(source, opt)
+	}
+	ref, ok := sharedScanCallRef(call)
+	if !ok {
+		return ic.ic.CreateIterator(source, opt)
+	}
+
+	aitr, ok := ic.aux[source.String()]
+	if !ok {
+		scanOpt := opt
+		scanOpt.Expr = nil
+		scanOpt.Aux = ic.refs
+		scanOpt.Limit, scanOpt.Offset = 0, 0
+
+		input, err := ic.ic.CreateIterator(source, scanOpt)
+		if err != nil {
+			return nil, err
+		} else if input != nil {
+			aitr = NewAuxIterator(input, scanOpt)
+		}
+		ic.aux[source.String()] = aitr
+	}
+	if aitr == nil {
+		return nil, nil
+	}
+
+	itr, err := NewCallIterator(aitr.Iterator(ref.Val, ref.Type), opt)
+	if err != nil {
+		return nil, err
+	}
+	// Every aggregate must keep reading the scan while another one is read
+	// so the aggregates are computed in their own goroutine and buffered.
+	return newBufferedIterator(itr), nil
+}
+
+// start starts sending the points of each scan to the aggregates.
+func (ic *sharedScanIteratorCreator) start() {
+	for _, aitr := range ic.aux {
+		if aitr != nil {
+			aitr.Background()
+		}
+	}
+}
+
+// close closes the scans that were not started.
+func (ic *sharedScanIteratorCreator) close() {
+	for _, aitr := range ic.aux {
+		if aitr != nil {
+			aitr.Close()
+		}
+	}
+}
+
 func buildIterators(stmt *SelectStatement, ic IteratorCreator, opt IteratorOptions) ([]Iterator, error) {
 	// Retrieve refs for each call and var ref.
 	info := newSelectInfo(stmt)
@@ -237,6 +401,8 @@ func buildAuxIterators(fields Fields, ic IteratorCreator, sources Sources, opt I
 		return nil, err
 	} else if input == nil {
 		input = &nilFloatIterator{}
+	} else if opt.DedupeSubqueries && len(inputs) > 1 && sources.HasSubquery() {
+		input = NewTimeDedupeIterator(input)
 	}
 
 	// Filter out duplicate rows, if required.
@@ -696,6 +862,8 @@ func (b *exprIteratorBuilder) buildVarRefIterator(expr *VarRef) (Iterator, error
 	itr := NewMergeIterator(inputs, b.opt)
 	if itr == nil {
 		itr = &nilFloatIterator{}
+	} else if b.opt.DedupeSubqueries && len(inputs) > 1 && b.sources.HasSubquery() {
+		itr = NewTimeDedupeIterator(itr)
 	}
 
 	if b.opt.InterruptCh != nil {
@@ -743,6 +911,46 @@ func (b *exprIteratorBuilder) buildCallIterator(expr *Call) (Iterator, error) {
 		opt.Interval = Interval{}
 
 		return newHoltWintersIterator(input, opt, int(h.Val), int(m.Val), includeFitData, interval)
+	case "lag", "lead":
+		input, err := buildExprIterator(expr.Args[0], b.ic, b.sources, b.opt, b.selector)
+		if err != nil {
+			return nil, err
+		}
+		n := expr.Args[1].(*IntegerLiteral)
+
+		// Offsets are computed across the whole series so redefine the
+		// interval to be unbounded.
+		opt := b.opt
+		opt.StartTime = MinTime
+		opt.EndTime = MaxTime
+		opt.Interval = Interval{}
+
+		if expr.Name == "lag" {
+			return newLagIterator(input, opt, int(n.Val))
+		}
+		return newLeadIterator(input, opt, int(n.Val))
+	case "flag_outliers":
+		input, err := buildExprIterator(expr.Args[0], b.ic, b.sources, b.opt, b.selector)
+		if err != nil {
+			return nil, err
+		}
+
+		var k float64
+		switch arg := expr.Args[1].(type) {
+		case *NumberLiteral:
+			k = arg.Val
+		case *IntegerLiteral:
+			k = float64(arg.Val)
+		}
+
+		// The mean and standard deviation are computed across the whole
+		// series so redefine the interval to be unbounded.
+		opt := b.opt
+		opt.StartTime = MinTime
+		opt.EndTime = MaxTime
+		opt.Interval = Interval{}
+
+		return newFlagOutliersIterator(input, opt, k)
 	case "derivative", "non_negative_derivative", "difference", "moving_average", "elapsed":
 		opt := b.opt
 		if !opt.Interval.IsZero() {
@@ -788,178 +996,229 @@ func (b *exprIteratorBuilder) buildCallIterator(expr *Call) (Iterator, error) {
 		return newCumulativeSumIterator(input, b.opt)
 	}
 
-	itr, err := func() (Iterator, error) {
-		switch expr.Name {
-		case "count":
-			switch arg0 := expr.Args[0].(type) {
-			case *Call:
-				if arg0.Name == "distinct" {
-					input, err := buildExprIterator(arg0, b.ic, b.sources, b.opt, b.selector)
-					if err != nil {
-						return nil, err
-					}
-					return newCountIterator(input, b.opt)
-				}
+	itr, err := b.buildAggregateIterator(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	if !b.selector || !b.opt.Interval.IsZero() {
+		if expr.Name != "top" && expr.Name != "bottom" {
+			itr = NewIntervalIterator(itr, b.opt)
+		}
+		if !b.opt.Interval.IsZero() && b.opt.Fill != NoFill {
+			// Windows without points are filled the same way as those of
+			// the aggregate of empty_as().
+			fillExpr := expr
+			if expr.Name == "empty_as" {
+				fillExpr = expr.Args[0].(*Call)
 			}
-			fallthrough
-		case "min", "max", "sum", "first", "last", "mean":
-			inputs := make([]Iterator, 0, len(b.sources))
-			if err := func() error {
-				for _, source := range b.sources {
-					switch source := source.(type) {
-					case *Measurement:
-						input, err := b.ic.CreateIterator(source, b.opt)
-						if err != nil {
-							return err
-						}
-						inputs = append(inputs, input)
-					case *SubQuery:
-						// Identify the name of the field we are using.
-						arg0 := expr.Args[0].(*VarRef)
+			itr = NewFillIterator(itr, fillExpr, b.opt)
+		}
+	}
+	if b.opt.InterruptCh != nil {
+		itr = NewInterruptIterator(itr, b.opt.InterruptCh)
+	}
+	return itr, nil
+}
 
-						input, err := buildExprIterator(arg0, b.ic, []Source{source}, b.opt, b.selector)
-						if err != nil {
-							return err
-						}
+// buildAggregateIterator creates an iterator that computes an aggregate for
+// every window of the call.
+func (b *exprIteratorBuilder) buildAggregateIterator(expr *Call) (Iterator, error) {
+	switch expr.Name {
+	case "empty_as":
+		// The aggregate keeps the groups whose points are all null so
+		// they can be given the value of the call instead.
+		call := expr.Args[0].(*Call)
+		opt := b.opt
+		opt.Expr = call
+		opt.KeepEmpty = true
+		sub := exprIteratorBuilder{ic: b.ic, sources: b.sources, opt: opt, selector: b.selector}
+		input, err := sub.buildAggregateIterator(call)
+		if err != nil {
+			return nil, err
+		}
+		return newEmptyValueIterator(input, expr.Args[1].(Literal))
+	case "count":
+		switch arg0 := expr.Args[0].(type) {
+		case *Call:
+			if arg0.Name == "distinct" {
+				input, err := buildExprIterator(arg0, b.ic, b.sources, b.opt, b.selector)
+				if err != nil {
+					return nil, err
+				}
+				return newCountIterator(input, b.opt)
+			}
+		}
+		fallthrough
+	case "min", "max", "sum", "first", "last", "mean":
+		inputs := make([]Iterator, 0, len(b.sources))
+		if err := func() error {
+			buildSubqueryIterator := func(sources Sources) error {
+				// Identify the name of the field we are using.
+				arg0 := expr.Args[0].(*VarRef)
+
+				input, err := buildExprIterator(arg0, b.ic, sources, b.opt, b.selector)
+				if err != nil {
+					return err
+				}
 
-						if b.opt.Condition != nil {
-							input = NewFilterIterator(input, b.opt.Condition, b.opt)
-						}
+				if b.opt.Condition != nil {
+					input = NewFilterIterator(input, b.opt.Condition, b.opt)
+				}
 
-						// Wrap the result in a call iterator.
-						i, err := NewCallIterator(input, b.opt)
-						if err != nil {
-							input.Close()
-							return err
-						}
-						inputs = append(inputs, i)
-					}
+				// Wrap the result in a call iterator.
+				i, err := NewCallIterator(input, b.opt)
+				if err != nil {
+					input.Close()
+					return err
 				}
+				inputs = append(inputs, i)
 				return nil
-			}(); err != nil {
-				Iterators(inputs).Close()
-				return nil, err
 			}
 
-			itr, err := Iterators(inputs).Merge(b.opt)
-			if err != nil {
-				Iterators(inputs).Close()
-				return nil, err
-			} else if itr == nil {
-				itr = &nilFloatIterator{}
-			}
-			return itr, nil
-		case "median":
-			opt := b.opt
-			opt.Ordered = true
-			input, err := buildExprIterator(expr.Args[0].(*VarRef), b.ic, b.sources, opt, false)
-			if err != nil {
-				return nil, err
-			}
-			return newMedianIterator(input, opt)
-		case "mode":
-			input, err := buildExprIterator(expr.Args[0].(*VarRef), b.ic, b.sources, b.opt, false)
-			if err != nil {
-				return nil, err
-			}
-			return NewModeIterator(input, b.opt)
-		case "stddev":
-			input, err := buildExprIterator(expr.Args[0].(*VarRef), b.ic, b.sources, b.opt, false)
-			if err != nil {
-				return nil, err
-			}
-			return newStddevIterator(input, b.opt)
-		case "spread":
-			// OPTIMIZE(benbjohnson): convert to map/reduce
-			input, err := buildExprIterator(expr.Args[0].(*VarRef), b.ic, b.sources, b.opt, false)
-			if err != nil {
-				return nil, err
-			}
-			return newSpreadIterator(input, b.opt)
-		case "top":
-			var tags []int
-			if len(expr.Args) < 2 {
-				return nil, fmt.Errorf("top() requires 2 or more arguments, got %d", len(expr.Args))
-			} else if len(expr.Args) > 2 {
-				// We need to find the indices of where the tag values are stored in Aux
-				// This section is O(n^2), but for what should be a low value.
-				for i := 1; i < len(expr.Args)-1; i++ {
-					ref := expr.Args[i].(*VarRef)
-					for index, aux := range b.opt.Aux {
-						if aux.Val == ref.Val {
-							tags = append(tags, index)
-							break
-						}
+			// Subqueries are read together when their overlapping rows
+			// are removed so duplicates are dropped before aggregating.
+			var subqueries Sources
+			for _, source := range b.sources {
+				switch source := source.(type) {
+				case *Measurement:
+					input, err := b.ic.CreateIterator(source, b.opt)
+					if err != nil {
+						return err
+					}
+					inputs = append(inputs, input)
+				case *SubQuery:
+					if b.opt.DedupeSubqueries {
+						subqueries = append(subqueries, source)
+						continue
+					}
+					if err := buildSubqueryIterator([]Source{source}); err != nil {
+						return err
 					}
 				}
 			}
-
-			input, err := buildExprIterator(expr.Args[0].(*VarRef), b.ic, b.sources, b.opt, false)
-			if err != nil {
-				return nil, err
+			if len(subqueries) > 0 {
+				return buildSubqueryIterator(subqueries)
 			}
-			n := expr.Args[len(expr.Args)-1].(*IntegerLiteral)
-			return newTopIterator(input, b.opt, n, tags)
-		case "bottom":
-			var tags []int
-			if len(expr.Args) < 2 {
-				return nil, fmt.Errorf("bottom() requires 2 or more arguments, got %d", len(expr.Args))
-			} else if len(expr.Args) > 2 {
-				// We need to find the indices of where the tag values are stored in Aux
-				// This section is O(n^2), but for what should be a low value.
-				for i := 1; i < len(expr.Args)-1; i++ {
-					ref := expr.Args[i].(*VarRef)
-					for index, aux := range b.opt.Aux {
-						if aux.Val == ref.Val {
-							tags = append(tags, index)
-							break
-						}
+			return nil
+		}(); err != nil {
+			Iterators(inputs).Close()
+			return nil, err
+		}
+
+		itr, err := Iterators(inputs).Merge(b.opt)
+		if err != nil {
+			Iterators(inputs).Close()
+			return nil, err
+		} else if itr == nil {
+			itr = &nilFloatIterator{}
+		}
+		return itr, nil
+	case "median":
+		opt := b.opt
+		opt.Ordered = true
+		input, err := buildExprIterator(expr.Args[0].(*VarRef), b.ic, b.sources, opt, false)
+		if err != nil {
+			return nil, err
+		}
+		return newMedianIterator(input, opt)
+	case "mode":
+		input, err := buildExprIterator(expr.Args[0].(*VarRef), b.ic, b.sources, b.opt, false)
+		if err != nil {
+			return nil, err
+		}
+		return NewModeIterator(input, b.opt)
+	case "stddev":
+		input, err := buildExprIterator(expr.Args[0].(*VarRef), b.ic, b.sources, b.opt, false)
+		if err != nil {
+			return nil, err
+		}
+		return newStddevIterator(input, b.opt)
+	case "time_weighted_mean", "time_weighted_integral":
+		opt := b.opt
+		opt.Ordered = true
+		input, err := buildExprIterator(expr.Args[0].(*VarRef), b.ic, b.sources, opt, false)
+		if err != nil {
+			return nil, err
+		}
+		unit := time.Second
+		if len(expr.Args) == 2 {
+			unit = expr.Args[1].(*DurationLiteral).Val
+		}
+		return newTimeWeightedIterator(input, opt, expr.Name == "time_weighted_integral", unit)
+	case "spread":
+		// OPTIMIZE(benbjohnson): convert to map/reduce
+		input, err := buildExprIterator(expr.Args[0].(*VarRef), b.ic, b.sources, b.opt, false)
+		if err != nil {
+			return nil, err
+		}
+		return newSpreadIterator(input, b.opt)
+	case "top":
+		var tags []int
+		if len(expr.Args) < 2 {
+			return nil, fmt.Errorf("top() requires 2 or more arguments, got %d", len(expr.Args))
+		} else if len(expr.Args) > 2 {
+			// We need to find the indices of where the tag values are stored in Aux
+			// This section is O(n^2), but for what should be a low value.
+			for i := 1; i < len(expr.Args)-1; i++ {
+				ref := expr.Args[i].(*VarRef)
+				for index, aux := range b.opt.Aux {
+					if aux.Val == ref.Val {
+						tags = append(tags, index)
+						break
 					}
 				}
 			}
+		}
 
-			input, err := buildExprIterator(expr.Args[0].(*VarRef), b.ic, b.sources, b.opt, false)
-			if err != nil {
-				return nil, err
-			}
-			n := expr.Args[len(expr.Args)-1].(*IntegerLiteral)
-			return newBottomIterator(input, b.opt, n, tags)
-		case "percentile":
-			opt := b.opt
-			opt.Ordered = true
-			input, err := buildExprIterator(expr.Args[0].(*VarRef), b.ic, b.sources, opt, false)
-			if err != nil {
-				return nil, err
-			}
-			var percentile float64
-			switch arg := expr.Args[1].(type) {
-			case *NumberLiteral:
-				percentile = arg.Val
-			case *IntegerLiteral:
-				percentile = float64(arg.Val)
+		input, err := buildExprIterator(expr.Args[0].(*VarRef), b.ic, b.sources, b.opt, false)
+		if err != nil {
+			return nil, err
+		}
+		n := expr.Args[len(expr.Args)-1].(*IntegerLiteral)
+		return newTopIterator(input, b.opt, n, tags)
+	case "bottom":
+		var tags []int
+		if len(expr.Args) < 2 {
+			return nil, fmt.Errorf("bottom() requires 2 or more arguments, got %d", len(expr.Args))
+		} else if len(expr.Args) > 2 {
+			// We need to find the indices of where the tag values are stored in Aux
+			// This section is O(n^2), but for what should be a low value.
+			for i := 1; i < len(expr.Args)-1; i++ {
+				ref := expr.Args[i].(*VarRef)
+				for index, aux := range b.opt.Aux {
+					if aux.Val == ref.Val {
+						tags = append(tags, index)
+						break
+					}
+				}
 			}
-			return newPercentileIterator(input, opt, percentile)
-		default:
-			return nil, fmt.Errorf("unsupported call: %s", expr.Name)
 		}
-	}()
-
-	if err != nil {
-		return nil, err
-	}
 
-	if !b.selector || !b.opt.Interval.IsZero() {
-		if expr.Name != "top" && expr.Name != "bottom" {
-			itr = NewIntervalIterator(itr, b.opt)
+		input, err := buildExprIterator(expr.Args[0].(*VarRef), b.ic, b.sources, b.opt, false)
+		if err != nil {
+			return nil, err
 		}
-		if !b.opt.Interval.IsZero() && b.opt.Fill != NoFill {
-			itr = NewFillIterator(itr, expr, b.opt)
+		n := expr.Args[len(expr.Args)-1].(*IntegerLiteral)
+		return newBottomIterator(input, b.opt, n, tags)
+	case "percentile":
+		opt := b.opt
+		opt.Ordered = true
+		input, err := buildExprIterator(expr.Args[0].(*VarRef), b.ic, b.sources, opt, false)
+		if err != nil {
+			return nil, err
 		}
+		var percentile float64
+		switch arg := expr.Args[1].(type) {
+		case *NumberLiteral:
+			percentile = arg.Val
+		case *IntegerLiteral:
+			percentile = float64(arg.Val)
+		}
+		return newPercentileIterator(input, opt, percentile)
+	default:
+		return nil, fmt.Errorf("unsupported call: %s", expr.Name)
 	}
-	if b.opt.InterruptCh != nil {
-		itr = NewInterruptIterator(itr, b.opt.InterruptCh)
-	}
-	return itr, nil
 }
 
 func (b *exprIteratorBuilder) buildBinaryExprIterator(expr *BinaryExpr) (Iterator, error) {
@@ -997,7 +1256,7 @@ func (b *exprIteratorBuilder) buildBinaryExprIterator(expr *BinaryExpr) (Iterato
 }
 
 func buildRHSTransformIterator(lhs Iterator, rhs Literal, op Token, opt IteratorOptions) (Iterator, error) {
-	fn := binaryExprFunc(iteratorDataType(lhs), literalDataType(rhs), op)
+	fn := binaryExprFunc(iteratorDataType(lhs), literalDataType(rhs), op, opt.DecimalPlaces)
 	switch fn := fn.(type) {
 	case func(float64, float64) float64:
 		var input FloatIterator
@@ -1176,7 +1435,7 @@ func buildRHSTransformIterator(lhs Iterator, rhs Literal, op Token, opt Iterator
 }
 
 func buildLHSTransformIterator(lhs Literal, rhs Iterator, op Token, opt IteratorOptions) (Iterator, error) {
-	fn := binaryExprFunc(literalDataType(lhs), iteratorDataType(rhs), op)
+	fn := binaryExprFunc(literalDataType(lhs), iteratorDataType(rhs), op, opt.DecimalPlaces)
 	switch fn := fn.(type) {
 	case func(float64, float64) float64:
 		var input FloatIterator
@@ -1355,7 +1614,7 @@ func buildLHSTransformIterator(lhs Literal, rhs Iterator, op Token, opt Iterator
 }
 
 func buildTransformIterator(lhs Iterator, rhs Iterator, op Token, opt IteratorOptions) (Iterator, error) {
-	fn := binaryExprFunc(iteratorDataType(lhs), iteratorDataType(rhs), op)
+	fn := binaryExprFunc(iteratorDataType(lhs), iteratorDataType(rhs), op, opt.DecimalPlaces)
 	switch fn := fn.(type) {
 	case func(float64, float64) float64:
 		var left FloatIterator
@@ -1463,7 +1722,10 @@ func literalDataType(lit Literal) DataType {
 	}
 }
 
-func binaryExprFunc(typ1 DataType, typ2 DataType, op Token) interface{} {
+// binaryExprFunc returns the function that evaluates the operator for the
+// operand types. If decimalPlaces is positive, arithmetic that returns a float
+// is performed on decimal numbers and rounded to that many decimal places.
+func binaryExprFunc(typ1 DataType, typ2 DataType, op Token, decimalPlaces int) interface{} {
 	var fn interface{}
 	switch typ1 {
 	case Float:
@@ -1476,6 +1738,15 @@ func binaryExprFunc(typ1 DataType, typ2 DataType, op Token) interface{} {
 			fn = integerBinaryExprFunc(op)
 		}
 	}
+
+	if decimalPlaces > 0 {
+		switch fn.(type) {
+		case func(float64, float64) float64:
+			fn = decimalBinaryExprFunc(op, decimalPlaces)
+		case func(int64, int64) float64:
+			fn = decimalIntegerDivFunc(decimalPlaces)
+		}
+	}
 	return fn
 }
 
@@ -51,6 +51,254 @@ func TestSelect_Min(t *testing.T) {
 	}
 }
 
+// Ensure GROUP BY time() buckets can be aligned to the start of the query.
+func TestSelect_AlignToStart(t *testing.T) {
+	var ic IteratorCreator
+	ic.CreateIteratorFn = func(m *influxql.Measurement, opt influxql.IteratorOptions) (influxql.Iterator, error) {
+		return influxql.NewCallIterator(&FloatIterator{Points: []influxql.FloatPoint{
+			{Name: "cpu", Time: 5 * Second, Value: 10},
+			{Name: "cpu", Time: 9 * Second, Value: 19},
+			{Name: "cpu", Time: 10 * Second, Value: 2},
+			{Name: "cpu", Time: 11 * Second, Value: 3},
+			{Name: "cpu", Time: 15 * Second, Value: 7},
+			{Name: "cpu", Time: 25 * Second, Value: 100},
+		}}, opt)
+	}
+
+	// Execute selection.
+	itrs, err := influxql.Select(MustParseSelectStatement(`SELECT min(value) FROM cpu WHERE time >= '1970-01-01T00:00:04Z' AND time < '1970-01-01T00:00:30Z' GROUP BY time(10s) fill(none)`), &ic, &influxql.SelectOptions{AlignToStart: true})
+	if err != nil {
+		t.Fatal(err)
+	} else if a, err := Iterators(itrs).ReadAll(); err != nil {
+		t.Fatalf("unexpected point: %s", err)
+	} else if !deep.Equal(a, [][]influxql.Point{
+		{&influxql.FloatPoint{Name: "cpu", Time: 4 * Second, Value: 2, Aggregated: 4}},
+		{&influxql.FloatPoint{Name: "cpu", Time: 14 * Second, Value: 7, Aggregated: 1}},
+		{&influxql.FloatPoint{Name: "cpu", Time: 24 * Second, Value: 100, Aggregated: 1}},
+	}) {
+		t.Fatalf("unexpected points: %s", spew.Sdump(a))
+	}
+}
+
+// Ensure points exactly on the edge between GROUP BY time() buckets are put
+// in the bucket that includes that edge.
+func TestSelect_BucketEdge(t *testing.T) {
+	var ic IteratorCreator
+	ic.CreateIteratorFn = func(m *influxql.Measurement, opt influxql.IteratorOptions) (influxql.Iterator, error) {
+		var points []influxql.FloatPoint
+		for _, p := range []influxql.FloatPoint{
+			{Name: "cpu", Time: 0 * Second, Value: 1},
+			{Name: "cpu", Time: 10 * Second, Value: 2},
+			{Name: "cpu", Time: 15 * Second, Value: 4},
+			{Name: "cpu", Time: 20 * Second, Value: 8},
+		} {
+			if p.Time >= opt.StartTime && p.Time <= opt.EndTime {
+				points = append(points, p)
+			}
+		}
+		return influxql.NewCallIterator(&FloatIterator{Points: points}, opt)
+	}
+
+	for _, tt := range []struct {
+		name   string
+		q      string
+		edge   string
+		align  bool
+		points [][]influxql.Point
+	}{
+		{
+			name: "start",
+			q:    `SELECT sum(value) FROM cpu WHERE time > '1970-01-01T00:00:00Z' AND time <= '1970-01-01T00:00:20Z' GROUP BY time(10s) fill(none)`,
+			edge: influxql.BucketEdgeStart,
+			points: [][]influxql.Point{
+				{&influxql.FloatPoint{Name: "cpu", Time: 10 * Second, Value: 6, Aggregated: 2}},
+				{&influxql.FloatPoint{Name: "cpu", Time: 20 * Second, Value: 8, Aggregated: 1}},
+			},
+		},
+		{
+			name: "end",
+			q:    `SELECT sum(value) FROM cpu WHERE time > '1970-01-01T00:00:00Z' AND time <= '1970-01-01T00:00:20Z' GROUP BY time(10s) fill(none)`,
+			edge: influxql.BucketEdgeEnd,
+			points: [][]influxql.Point{
+				{&influxql.FloatPoint{Name: "cpu", Time: 10 * Second, Value: 2, Aggregated: 1}},
+				{&influxql.FloatPoint{Name: "cpu", Time: 20 * Second, Value: 12, Aggregated: 2}},
+			},
+		},
+		{
+			name: "start fill(null)",
+			q:    `SELECT sum(value) FROM cpu WHERE time > '1970-01-01T00:00:00Z' AND time <= '1970-01-01T00:00:20Z' GROUP BY time(10s) fill(null)`,
+			edge: influxql.BucketEdgeStart,
+			points: [][]influxql.Point{
+				{&influxql.FloatPoint{Name: "cpu", Time: 0 * Second, Nil: true}},
+				{&influxql.FloatPoint{Name: "cpu", Time: 10 * Second, Value: 6, Aggregated: 2}},
+				{&influxql.FloatPoint{Name: "cpu", Time: 20 * Second, Value: 8, Aggregated: 1}},
+			},
+		},
+		{
+			name: "end fill(null)",
+			q:    `SELECT sum(value) FROM cpu WHERE time > '1970-01-01T00:00:00Z' AND time <= '1970-01-01T00:00:20Z' GROUP BY time(10s) fill(null)`,
+			edge: influxql.BucketEdgeEnd,
+			points: [][]influxql.Point{
+				{&influxql.FloatPoint{Name: "cpu", Time: 10 * Second, Value: 2, Aggregated: 1}},
+				{&influxql.FloatPoint{Name: "cpu", Time: 20 * Second, Value: 12, Aggregated: 2}},
+			},
+		},
+		{
+			name: "end inclusive start",
+			q:    `SELECT sum(value) FROM cpu WHERE time >= '1970-01-01T00:00:00Z' AND time <= '1970-01-01T00:00:20Z' GROUP BY time(10s) fill(null)`,
+			edge: influxql.BucketEdgeEnd,
+			points: [][]influxql.Point{
+				{&influxql.FloatPoint{Name: "cpu", Time: 0 * Second, Value: 1, Aggregated: 1}},
+				{&influxql.FloatPoint{Name: "cpu", Time: 10 * Second, Value: 2, Aggregated: 1}},
+				{&influxql.FloatPoint{Name: "cpu", Time: 20 * Second, Value: 12, Aggregated: 2}},
+			},
+		},
+		{
+			name: "end fill(previous)",
+			q:    `SELECT sum(value) FROM cpu WHERE time > '1970-01-01T00:00:00Z' AND time <= '1970-01-01T00:00:40Z' GROUP BY time(10s) fill(previous)`,
+			edge: influxql.BucketEdgeEnd,
+			points: [][]influxql.Point{
+				{&influxql.FloatPoint{Name: "cpu", Time: 10 * Second, Value: 2, Aggregated: 1}},
+				{&influxql.FloatPoint{Name: "cpu", Time: 20 * Second, Value: 12, Aggregated: 2}},
+				{&influxql.FloatPoint{Name: "cpu", Time: 30 * Second, Value: 12}},
+				{&influxql.FloatPoint{Name: "cpu", Time: 40 * Second, Value: 12}},
+			},
+		},
+		{
+			name: "start offset",
+			q:    `SELECT sum(value) FROM cpu WHERE time >= '1970-01-01T00:00:00Z' AND time <= '1970-01-01T00:00:20Z' GROUP BY time(10s, 5s) fill(none)`,
+			edge: influxql.BucketEdgeStart,
+			points: [][]influxql.Point{
+				{&influxql.FloatPoint{Name: "cpu", Time: -5 * Second, Value: 1, Aggregated: 1}},
+				{&influxql.FloatPoint{Name: "cpu", Time: 5 * Second, Value: 2, Aggregated: 1}},
+				{&influxql.FloatPoint{Name: "cpu", Time: 15 * Second, Value: 12, Aggregated: 2}},
+			},
+		},
+		{
+			name: "end offset",
+			q:    `SELECT sum(value) FROM cpu WHERE time >= '1970-01-01T00:00:00Z' AND time <= '1970-01-01T00:00:20Z' GROUP BY time(10s, 5s) fill(none)`,
+			edge: influxql.BucketEdgeEnd,
+			points: [][]influxql.Point{
+				{&influxql.FloatPoint{Name: "cpu", Time: 5 * Second, Value: 1, Aggregated: 1}},
+				{&influxql.FloatPoint{Name: "cpu", Time: 15 * Second, Value: 6, Aggregated: 2}},
+				{&influxql.FloatPoint{Name: "cpu", Time: 25 * Second, Value: 8, Aggregated: 1}},
+			},
+		},
+		{
+			// Buckets are computed in UTC, so buckets in a time zone are
+			// queried with an offset, such as the hour a day starts at in
+			// UTC.
+			name: "end zone offset",
+			q:    `SELECT sum(value) FROM cpu WHERE time >= '1970-01-01T00:00:00Z' AND time <= '1970-01-01T00:00:20Z' GROUP BY time(20s, 10s) fill(none)`,
+			edge: influxql.BucketEdgeEnd,
+			points: [][]influxql.Point{
+				{&influxql.FloatPoint{Name: "cpu", Time: 10 * Second, Value: 3, Aggregated: 2}},
+				{&influxql.FloatPoint{Name: "cpu", Time: 30 * Second, Value: 12, Aggregated: 2}},
+			},
+		},
+		{
+			name:  "end align to start",
+			q:     `SELECT sum(value) FROM cpu WHERE time > '1970-01-01T00:00:04Z' AND time <= '1970-01-01T00:00:24Z' GROUP BY time(10s) fill(none)`,
+			edge:  influxql.BucketEdgeEnd,
+			align: true,
+			points: [][]influxql.Point{
+				{&influxql.FloatPoint{Name: "cpu", Time: 14 * Second, Value: 2, Aggregated: 1}},
+				{&influxql.FloatPoint{Name: "cpu", Time: 24 * Second, Value: 12, Aggregated: 2}},
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			itrs, err := influxql.Select(MustParseSelectStatement(tt.q), &ic, &influxql.SelectOptions{AlignToStart: tt.align, BucketEdge: tt.edge})
+			if err != nil {
+				t.Fatal(err)
+			} else if a, err := Iterators(itrs).ReadAll(); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			} else if !deep.Equal(a, tt.points) {
+				t.Fatalf("unexpected points: %s", spew.Sdump(a))
+			}
+		})
+	}
+}
+
+// Ensure rows repeated by overlapping subqueries can be removed.
+func TestSelect_DedupeSubqueries(t *testing.T) {
+	var ic IteratorCreator
+	ic.CreateIteratorFn = func(m *influxql.Measurement, opt influxql.IteratorOptions) (influxql.Iterator, error) {
+		var points []influxql.FloatPoint
+		for _, p := range []influxql.FloatPoint{
+			{Name: "cpu", Time: 0 * Second, Value: 1},
+			{Name: "cpu", Time: 10 * Second, Value: 2},
+			{Name: "cpu", Time: 20 * Second, Value: 3},
+		} {
+			if p.Time >= opt.StartTime && p.Time <= opt.EndTime {
+				points = append(points, p)
+			}
+		}
+		return influxql.NewCallIterator(&FloatIterator{Points: points}, opt)
+	}
+
+	// The inner windows both include the 10s bucket.
+	const sources = `(SELECT max(value) FROM cpu WHERE time >= '1970-01-01T00:00:00Z' AND time < '1970-01-01T00:00:20Z' GROUP BY time(10s)), ` +
+		`(SELECT max(value) FROM cpu WHERE time >= '1970-01-01T00:00:10Z' AND time < '1970-01-01T00:00:30Z' GROUP BY time(10s))`
+	sopt := func(dedupe bool) *influxql.SelectOptions {
+		return &influxql.SelectOptions{
+			MinTime:          time.Unix(0, influxql.MinTime),
+			MaxTime:          time.Unix(0, influxql.MaxTime),
+			DedupeSubqueries: dedupe,
+		}
+	}
+
+	// Without deduplication the overlapping bucket is returned twice.
+	itrs, err := influxql.Select(MustParseSelectStatement(`SELECT max::float FROM `+sources), &ic, sopt(false))
+	if err != nil {
+		t.Fatal(err)
+	} else if a, err := Iterators(itrs).ReadAll(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if len(a) != 4 {
+		t.Fatalf("unexpected points: %s", spew.Sdump(a))
+	}
+
+	itrs, err = influxql.Select(MustParseSelectStatement(`SELECT max::float FROM `+sources), &ic, sopt(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := Iterators(itrs).ReadAll()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if len(a) != 3 {
+		t.Fatalf("unexpected points: %s", spew.Sdump(a))
+	}
+	seen := make(map[int64]bool)
+	for i, exp := range []struct {
+		time  int64
+		value float64
+	}{
+		{time: 0 * Second, value: 1},
+		{time: 10 * Second, value: 2},
+		{time: 20 * Second, value: 3},
+	} {
+		p := a[i][0].(*influxql.FloatPoint)
+		if seen[p.Time] {
+			t.Fatalf("duplicate timestamp: %d", p.Time)
+		} else if p.Time != exp.time || p.Value != exp.value {
+			t.Fatalf("%d. unexpected point: time=%d value=%v", i, p.Time, p.Value)
+		}
+		seen[p.Time] = true
+	}
+
+	// Aggregates over the subqueries only see each bucket once.
+	itrs, err = influxql.Select(MustParseSelectStatement(`SELECT count(max) FROM `+sources), &ic, sopt(true))
+	if err != nil {
+		t.Fatal(err)
+	} else if a, err := Iterators(itrs).ReadAll(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if len(a) != 1 {
+		t.Fatalf("unexpected points: %s", spew.Sdump(a))
+	} else if p, ok := a[0][0].(*influxql.IntegerPoint); !ok || p.Value != 3 {
+		t.Fatalf("unexpected count: %s", spew.Sdump(a))
+	}
+}
+
 // Ensure a SELECT distinct() query can be executed.
 func TestSelect_Distinct_Float(t *testing.T) {
 	var ic IteratorCreator
@@ -310,6 +558,53 @@ func TestSelect_Mean_Boolean(t *testing.T) {
 	}
 }
 
+// Ensure the aggregates of a SELECT can be computed from a shared scan.
+func TestSelect_ShareScans(t *testing.T) {
+	var ic IteratorCreator
+	ic.CreateIteratorFn = func(m *influxql.Measurement, opt influxql.IteratorOptions) (influxql.Iterator, error) {
+		if opt.Expr != nil {
+			t.Fatalf("unexpected aggregate iterator: %s", opt.Expr)
+		} else if len(opt.Aux) != 2 {
+			t.Fatalf("unexpected aux fields: %v", opt.Aux)
+		}
+		return &FloatIterator{Points: []influxql.FloatPoint{
+			{Name: "cpu", Tags: ParseTags("host=A"), Time: 0 * Second, Aux: []interface{}{float64(1), nil}},
+			{Name: "cpu", Tags: ParseTags("host=A"), Time: 5 * Second, Aux: []interface{}{float64(3), float64(10)}},
+			{Name: "cpu", Tags: ParseTags("host=A"), Time: 12 * Second, Aux: []interface{}{nil, float64(20)}},
+			{Name: "cpu", Tags: ParseTags("host=B"), Time: 1 * Second, Aux: []interface{}{nil, float64(5)}},
+		}}, nil
+	}
+
+	// Execute selection.
+	itrs, err := influxql.Select(MustParseSelectStatement(`SELECT mean(a::float), count(b::float) FROM cpu WHERE time >= '1970-01-01T00:00:00Z' AND time < '1970-01-01T00:00:20Z' GROUP BY time(10s), host fill(none)`), &ic, &influxql.SelectOptions{ShareScans: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each aggregate is read to the end before the next one is read.
+	var a [][][]influxql.Point
+	for _, itr := range itrs {
+		points, err := Iterators([]influxql.Iterator{itr}).ReadAll()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		a = append(a, points)
+	}
+
+	if !deep.Equal(a, [][][]influxql.Point{
+		{
+			{&influxql.FloatPoint{Name: "cpu", Tags: ParseTags("host=A"), Time: 0 * Second, Value: 2, Aggregated: 2}},
+		},
+		{
+			{&influxql.IntegerPoint{Name: "cpu", Tags: ParseTags("host=A"), Time: 0 * Second, Value: 1, Aggregated: 1}},
+			{&influxql.IntegerPoint{Name: "cpu", Tags: ParseTags("host=A"), Time: 10 * Second, Value: 1, Aggregated: 1}},
+			{&influxql.IntegerPoint{Name: "cpu", Tags: ParseTags("host=B"), Time: 0 * Second, Value: 1, Aggregated: 1}},
+		},
+	}) {
+		t.Fatalf("unexpected points: %s", spew.Sdump(a))
+	}
+}
+
 // Ensure a SELECT median() query can be executed.
 func TestSelect_Median_Float(t *testing.T) {
 	var ic IteratorCreator
@@ -1229,6 +1524,76 @@ func TestSelect_Fill_Previous_Float(t *testing.T) {
 	}
 }
 
+// Ensure a SELECT query with a fill(next) statement fills leading and interior
+// gaps with the next value.
+func TestSelect_Fill_Next_Float(t *testing.T) {
+	var ic IteratorCreator
+	ic.CreateIteratorFn = func(m *influxql.Measurement, opt influxql.IteratorOptions) (influxql.Iterator, error) {
+		if m.Name != "cpu" {
+			t.Fatalf("unexpected source: %s", m.Name)
+		}
+		return influxql.NewCallIterator(&FloatIterator{Points: []influxql.FloatPoint{
+			{Name: "cpu", Tags: ParseTags("host=A"), Time: 22 * Second, Value: 2},
+			{Name: "cpu", Tags: ParseTags("host=A"), Time: 42 * Second, Value: 4},
+		}}, opt)
+	}
+
+	// Execute selection.
+	itrs, err := influxql.Select(MustParseSelectStatement(`SELECT mean(value) FROM cpu WHERE time >= '1970-01-01T00:00:00Z' AND time < '1970-01-01T00:01:00Z' GROUP BY host, time(10s) fill(next)`), &ic, nil)
+	if err != nil {
+		t.Fatal(err)
+	} else if a, err := Iterators(itrs).ReadAll(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if !deep.Equal(a, [][]influxql.Point{
+		{&influxql.FloatPoint{Name: "cpu", Tags: ParseTags("host=A"), Time: 0 * Second, Value: 2}},
+		{&influxql.FloatPoint{Name: "cpu", Tags: ParseTags("host=A"), Time: 10 * Second, Value: 2}},
+		{&influxql.FloatPoint{Name: "cpu", Tags: ParseTags("host=A"), Time: 20 * Second, Value: 2, Aggregated: 1}},
+		{&influxql.FloatPoint{Name: "cpu", Tags: ParseTags("host=A"), Time: 30 * Second, Value: 4}},
+		{&influxql.FloatPoint{Name: "cpu", Tags: ParseTags("host=A"), Time: 40 * Second, Value: 4, Aggregated: 1}},
+		{&influxql.FloatPoint{Name: "cpu", Tags: ParseTags("host=A"), Time: 50 * Second, Nil: true}},
+	}) {
+		t.Fatalf("unexpected points: %s", spew.Sdump(a))
+	}
+}
+
+// Ensure a SELECT query with a fill(next) statement does not fill a series
+// with the values of the next series.
+func TestSelect_Fill_Next_Float_MultipleSeries(t *testing.T) {
+	var ic IteratorCreator
+	ic.CreateIteratorFn = func(m *influxql.Measurement, opt influxql.IteratorOptions) (influxql.Iterator, error) {
+		if m.Name != "cpu" {
+			t.Fatalf("unexpected source: %s", m.Name)
+		}
+		return influxql.NewCallIterator(&FloatIterator{Points: []influxql.FloatPoint{
+			{Name: "cpu", Tags: ParseTags("host=A"), Time: 12 * Second, Value: 2},
+			{Name: "cpu", Tags: ParseTags("host=B"), Time: 32 * Second, Value: 4},
+		}}, opt)
+	}
+
+	// Execute selection.
+	itrs, err := influxql.Select(MustParseSelectStatement(`SELECT mean(value) FROM cpu WHERE time >= '1970-01-01T00:00:00Z' AND time < '1970-01-01T00:01:00Z' GROUP BY host, time(10s) fill(next)`), &ic, nil)
+	if err != nil {
+		t.Fatal(err)
+	} else if a, err := Iterators(itrs).ReadAll(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if !deep.Equal(a, [][]influxql.Point{
+		{&influxql.FloatPoint{Name: "cpu", Tags: ParseTags("host=A"), Time: 0 * Second, Value: 2}},
+		{&influxql.FloatPoint{Name: "cpu", Tags: ParseTags("host=A"), Time: 10 * Second, Value: 2, Aggregated: 1}},
+		{&influxql.FloatPoint{Name: "cpu", Tags: ParseTags("host=A"), Time: 20 * Second, Nil: true}},
+		{&influxql.FloatPoint{Name: "cpu", Tags: ParseTags("host=A"), Time: 30 * Second, Nil: true}},
+		{&influxql.FloatPoint{Name: "cpu", Tags: ParseTags("host=A"), Time: 40 * Second, Nil: true}},
+		{&influxql.FloatPoint{Name: "cpu", Tags: ParseTags("host=A"), Time: 50 * Second, Nil: true}},
+		{&influxql.FloatPoint{Name: "cpu", Tags: ParseTags("host=B"), Time: 0 * Second, Value: 4}},
+		{&influxql.FloatPoint{Name: "cpu", Tags: ParseTags("host=B"), Time: 10 * Second, Value: 4}},
+		{&influxql.FloatPoint{Name: "cpu", Tags: ParseTags("host=B"), Time: 20 * Second, Value: 4}},
+		{&influxql.FloatPoint{Name: "cpu", Tags: ParseTags("host=B"), Time: 30 * Second, Value: 4, Aggregated: 1}},
+		{&influxql.FloatPoint{Name: "cpu", Tags: ParseTags("host=B"), Time: 40 * Second, Nil: true}},
+		{&influxql.FloatPoint{Name: "cpu", Tags: ParseTags("host=B"), Time: 50 * Second, Nil: true}},
+	}) {
+		t.Fatalf("unexpected points: %s", spew.Sdump(a))
+	}
+}
+
 // Ensure a SELECT query with a fill(linear) statement can be executed.
 func TestSelect_Fill_Linear_Float_One(t *testing.T) {
 	var ic IteratorCreator
@@ -1466,6 +1831,72 @@ func TestSelect_Stddev_Float(t *testing.T) {
 	}
 }
 
+// Ensure a SELECT time_weighted_mean() query can be executed.
+func TestSelect_TimeWeightedMean_Float(t *testing.T) {
+	var ic IteratorCreator
+	ic.CreateIteratorFn = func(m *influxql.Measurement, opt influxql.IteratorOptions) (influxql.Iterator, error) {
+		if m.Name != "cpu" {
+			t.Fatalf("unexpected source: %s", m.Name)
+		}
+		return &FloatIterator{Points: []influxql.FloatPoint{
+			{Name: "cpu", Tags: ParseTags("region=west,host=A"), Time: 0 * Second, Value: 10},
+			{Name: "cpu", Tags: ParseTags("region=east,host=A"), Time: 2 * Second, Value: 20},
+			{Name: "cpu", Tags: ParseTags("region=west,host=A"), Time: 8 * Second, Value: 5},
+			{Name: "cpu", Tags: ParseTags("region=west,host=A"), Time: 14 * Second, Value: 4},
+			{Name: "cpu", Tags: ParseTags("region=west,host=A"), Time: 19 * Second, Value: 8},
+			{Name: "cpu", Tags: ParseTags("region=west,host=B"), Time: 5 * Second, Value: 3},
+		}}, nil
+	}
+
+	// Each value is weighted by the time until the next value, and the last
+	// value by the time until the end of its window. Points are returned in
+	// series order:
+	//   host=A [0s,10s):  (10*2s + 20*6s + 5*2s) / 10s = 15
+	//   host=A [10s,20s): (4*5s + 8*1s) / 6s = 28/6
+	//   host=B [0s,10s):  (3*5s) / 5s = 3
+	itrs, err := influxql.Select(MustParseSelectStatement(`SELECT time_weighted_mean(value) FROM cpu WHERE time >= '1970-01-01T00:00:00Z' AND time < '1970-01-02T00:00:00Z' GROUP BY time(10s), host fill(none)`), &ic, nil)
+	if err != nil {
+		t.Fatal(err)
+	} else if a, err := Iterators(itrs).ReadAll(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if !deep.Equal(a, [][]influxql.Point{
+		{&influxql.FloatPoint{Name: "cpu", Tags: ParseTags("host=A"), Time: 0 * Second, Value: 15}},
+		{&influxql.FloatPoint{Name: "cpu", Tags: ParseTags("host=A"), Time: 10 * Second, Value: 28.0 / 6}},
+		{&influxql.FloatPoint{Name: "cpu", Tags: ParseTags("host=B"), Time: 0 * Second, Value: 3}},
+	}) {
+		t.Fatalf("unexpected points: %s", spew.Sdump(a))
+	}
+}
+
+// Ensure a SELECT time_weighted_integral() query can be executed.
+func TestSelect_TimeWeightedIntegral_Integer(t *testing.T) {
+	var ic IteratorCreator
+	ic.CreateIteratorFn = func(m *influxql.Measurement, opt influxql.IteratorOptions) (influxql.Iterator, error) {
+		if m.Name != "cpu" {
+			t.Fatalf("unexpected source: %s", m.Name)
+		}
+		return &IntegerIterator{Points: []influxql.IntegerPoint{
+			{Name: "cpu", Tags: ParseTags("region=west,host=A"), Time: 0 * Second, Value: 10},
+			{Name: "cpu", Tags: ParseTags("region=east,host=A"), Time: 2 * Second, Value: 20},
+			{Name: "cpu", Tags: ParseTags("region=west,host=A"), Time: 8 * Second, Value: 5},
+			{Name: "cpu", Tags: ParseTags("region=west,host=A"), Time: 14 * Second, Value: 4},
+			{Name: "cpu", Tags: ParseTags("region=west,host=A"), Time: 19 * Second, Value: 8},
+		}}, nil
+	}
+
+	itrs, err := influxql.Select(MustParseSelectStatement(`SELECT time_weighted_integral(value, 2s) FROM cpu WHERE time >= '1970-01-01T00:00:00Z' AND time < '1970-01-02T00:00:00Z' GROUP BY time(10s), host fill(none)`), &ic, nil)
+	if err != nil {
+		t.Fatal(err)
+	} else if a, err := Iterators(itrs).ReadAll(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if !deep.Equal(a, [][]influxql.Point{
+		{&influxql.FloatPoint{Name: "cpu", Tags: ParseTags("host=A"), Time: 0 * Second, Value: 75}},
+		{&influxql.FloatPoint{Name: "cpu", Tags: ParseTags("host=A"), Time: 10 * Second, Value: 14}},
+	}) {
+		t.Fatalf("unexpected points: %s", spew.Sdump(a))
+	}
+}
+
 // Ensure a SELECT stddev() query can be executed.
 func TestSelect_Stddev_Integer(t *testing.T) {
 	var ic IteratorCreator
@@ -2382,6 +2813,95 @@ func TestSelect_BinaryExpr_Mixed(t *testing.T) {
 	}
 }
 
+// Ensure a SELECT binary expr performs decimal arithmetic when decimal places are set.
+func TestSelect_BinaryExpr_DecimalPlaces(t *testing.T) {
+	var ic IteratorCreator
+	ic.CreateIteratorFn = func(m *influxql.Measurement, opt influxql.IteratorOptions) (influxql.Iterator, error) {
+		// Return the auxiliary fields in the order they are requested.
+		rows := []struct {
+			time   int64
+			values map[string]interface{}
+		}{
+			{0 * Second, map[string]interface{}{"a": float64(0.1), "b": float64(0.2), "n": int64(2)}},
+			{5 * Second, map[string]interface{}{"a": float64(1.005), "b": float64(3), "n": int64(3)}},
+			{9 * Second, map[string]interface{}{"a": float64(-0.125), "b": nil, "n": int64(8)}},
+		}
+		var points []influxql.FloatPoint
+		for _, row := range rows {
+			p := influxql.FloatPoint{Name: "cpu", Time: row.time}
+			for _, ref := range opt.Aux {
+				p.Aux = append(p.Aux, row.values[ref.Val])
+			}
+			points = append(points, p)
+		}
+		return &FloatIterator{Points: points}, nil
+	}
+	ic.FieldDimensionsFn = func(m *influxql.Measurement) (map[string]influxql.DataType, map[string]struct{}, error) {
+		return map[string]influxql.DataType{
+			"a": influxql.Float,
+			"b": influxql.Float,
+			"n": influxql.Integer,
+		}, nil, nil
+	}
+
+	for _, test := range []struct {
+		Name      string
+		Statement string
+		Points    [][]influxql.Point
+	}{
+		{
+			Name:      "add",
+			Statement: `SELECT a + b FROM cpu`,
+			Points: [][]influxql.Point{
+				{&influxql.FloatPoint{Name: "cpu", Time: 0 * Second, Value: 0.3}},
+				{&influxql.FloatPoint{Name: "cpu", Time: 5 * Second, Value: 4.01}},
+				{&influxql.FloatPoint{Name: "cpu", Time: 9 * Second, Nil: true}},
+			},
+		},
+		{
+			Name:      "multiply literal",
+			Statement: `SELECT a * 100 FROM cpu`,
+			Points: [][]influxql.Point{
+				{&influxql.FloatPoint{Name: "cpu", Time: 0 * Second, Value: 10}},
+				{&influxql.FloatPoint{Name: "cpu", Time: 5 * Second, Value: 100.5}},
+				{&influxql.FloatPoint{Name: "cpu", Time: 9 * Second, Value: -12.5}},
+			},
+		},
+		{
+			Name:      "divide rounds half away from zero",
+			Statement: `SELECT a / 1 FROM cpu`,
+			Points: [][]influxql.Point{
+				{&influxql.FloatPoint{Name: "cpu", Time: 0 * Second, Value: 0.1}},
+				{&influxql.FloatPoint{Name: "cpu", Time: 5 * Second, Value: 1.01}},
+				{&influxql.FloatPoint{Name: "cpu", Time: 9 * Second, Value: -0.13}},
+			},
+		},
+		{
+			Name:      "integer division",
+			Statement: `SELECT 2 / n FROM cpu`,
+			Points: [][]influxql.Point{
+				{&influxql.FloatPoint{Name: "cpu", Time: 0 * Second, Value: 1}},
+				{&influxql.FloatPoint{Name: "cpu", Time: 5 * Second, Value: 0.67}},
+				{&influxql.FloatPoint{Name: "cpu", Time: 9 * Second, Value: 0.25}},
+			},
+		},
+	} {
+		stmt, err := MustParseSelectStatement(test.Statement).RewriteFields(&ic)
+		if err != nil {
+			t.Errorf("%s: rewrite error: %s", test.Name, err)
+		}
+
+		itrs, err := influxql.Select(stmt, &ic, &influxql.SelectOptions{DecimalPlaces: 2})
+		if err != nil {
+			t.Errorf("%s: parse error: %s", test.Name, err)
+		} else if a, err := Iterators(itrs).ReadAll(); err != nil {
+			t.Fatalf("%s: unexpected error: %s", test.Name, err)
+		} else if !deep.Equal(a, test.Points) {
+			t.Errorf("%s: unexpected points: %s", test.Name, spew.Sdump(a))
+		}
+	}
+}
+
 // Ensure a SELECT binary expr with nil values can be executed.
 // Nil values may be present when a field is missing from one iterator,
 // but not the other.
@@ -2988,6 +3508,199 @@ func TestSelect_MovingAverage_Integer(t *testing.T) {
 	}
 }
 
+func TestSelect_Lag_Float(t *testing.T) {
+	var ic IteratorCreator
+	ic.CreateIteratorFn = func(m *influxql.Measurement, opt influxql.IteratorOptions) (influxql.Iterator, error) {
+		if m.Name != "cpu" {
+			t.Fatalf("unexpected source: %s", m.Name)
+		}
+		return &FloatIterator{Points: []influxql.FloatPoint{
+			{Name: "cpu", Tags: ParseTags("host=A"), Time: 0 * Second, Value: 20},
+			{Name: "cpu", Tags: ParseTags("host=A"), Time: 4 * Second, Value: 10},
+			{Name: "cpu", Tags: ParseTags("host=A"), Time: 8 * Second, Value: 19},
+			{Name: "cpu", Tags: ParseTags("host=B"), Time: 0 * Second, Value: 3},
+			{Name: "cpu", Tags: ParseTags("host=B"), Time: 4 * Second, Value: 7},
+		}}, nil
+	}
+
+	// Execute selection.
+	itrs, err := influxql.Select(MustParseSelectStatement(`SELECT lag(value, 1) FROM cpu WHERE time >= '1970-01-01T00:00:00Z' AND time < '1970-01-01T00:00:16Z' GROUP BY host`), &ic, nil)
+	if err != nil {
+		t.Fatal(err)
+	} else if a, err := Iterators(itrs).ReadAll(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if !deep.Equal(a, [][]influxql.Point{
+		{&influxql.FloatPoint{Name: "cpu", Tags: ParseTags("host=A"), Time: 0 * Second, Nil: true}},
+		{&influxql.FloatPoint{Name: "cpu", Tags: ParseTags("host=A"), Time: 4 * Second, Value: 20}},
+		{&influxql.FloatPoint{Name: "cpu", Tags: ParseTags("host=A"), Time: 8 * Second, Value: 10}},
+		{&influxql.FloatPoint{Name: "cpu", Tags: ParseTags("host=B"), Time: 0 * Second, Nil: true}},
+		{&influxql.FloatPoint{Name: "cpu", Tags: ParseTags("host=B"), Time: 4 * Second, Value: 3}},
+	}) {
+		t.Fatalf("unexpected points: %s", spew.Sdump(a))
+	}
+}
+
+func TestSelect_Lead_Integer(t *testing.T) {
+	var ic IteratorCreator
+	ic.CreateIteratorFn = func(m *influxql.Measurement, opt influxql.IteratorOptions) (influxql.Iterator, error) {
+		if m.Name != "cpu" {
+			t.Fatalf("unexpected source: %s", m.Name)
+		}
+		return &IntegerIterator{Points: []influxql.IntegerPoint{
+			{Name: "cpu", Time: 0 * Second, Value: 20},
+			{Name: "cpu", Time: 4 * Second, Value: 10},
+			{Name: "cpu", Time: 8 * Second, Value: 19},
+			{Name: "cpu", Time: 12 * Second, Value: 3},
+		}}, nil
+	}
+
+	// Execute selection.
+	itrs, err := influxql.Select(MustParseSelectStatement(`SELECT lead(value, 2) FROM cpu WHERE time >= '1970-01-01T00:00:00Z' AND time < '1970-01-01T00:00:16Z'`), &ic, nil)
+	if err != nil {
+		t.Fatal(err)
+	} else if a, err := Iterators(itrs).ReadAll(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if !deep.Equal(a, [][]influxql.Point{
+		{&influxql.IntegerPoint{Name: "cpu", Time: 0 * Second, Value: 19}},
+		{&influxql.IntegerPoint{Name: "cpu", Time: 4 * Second, Value: 3}},
+		{&influxql.IntegerPoint{Name: "cpu", Time: 8 * Second, Nil: true}},
+		{&influxql.IntegerPoint{Name: "cpu", Time: 12 * Second, Nil: true}},
+	}) {
+		t.Fatalf("unexpected points: %s", spew.Sdump(a))
+	}
+}
+
+func TestSelect_FlagOutliers_Float(t *testing.T) {
+	var ic IteratorCreator
+	ic.CreateIteratorFn = func(m *influxql.Measurement, opt influxql.IteratorOptions) (influxql.Iterator, error) {
+		if m.Name != "cpu" {
+			t.Fatalf("unexpected source: %s", m.Name)
+		}
+		return &FloatIterator{Points: []influxql.FloatPoint{
+			{Name: "cpu", Tags: ParseTags("host=A"), Time: 0 * Second, Value: 10},
+			{Name: "cpu", Tags: ParseTags("host=A"), Time: 4 * Second, Value: 11},
+			{Name: "cpu", Tags: ParseTags("host=A"), Time: 8 * Second, Value: 9},
+			{Name: "cpu", Tags: ParseTags("host=A"), Time: 12 * Second, Value: 10},
+			{Name: "cpu", Tags: ParseTags("host=A"), Time: 16 * Second, Value: 30},
+			{Name: "cpu", Tags: ParseTags("host=B"), Time: 0 * Second, Value: 3},
+			{Name: "cpu", Tags: ParseTags("host=B"), Time: 4 * Second, Value: 300},
+		}}, nil
+	}
+
+	// Series B has too few points to flag any of them.
+	itrs, err := influxql.Select(MustParseSelectStatement(`SELECT flag_outliers(value, 1.5) FROM cpu WHERE time >= '1970-01-01T00:00:00Z' AND time < '1970-01-01T00:00:20Z' GROUP BY host`), &ic, nil)
+	if err != nil {
+		t.Fatal(err)
+	} else if a, err := Iterators(itrs).ReadAll(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if !deep.Equal(a, [][]influxql.Point{
+		{&influxql.BooleanPoint{Name: "cpu", Tags: ParseTags("host=A"), Time: 0 * Second, Value: false}},
+		{&influxql.BooleanPoint{Name: "cpu", Tags: ParseTags("host=A"), Time: 4 * Second, Value: false}},
+		{&influxql.BooleanPoint{Name: "cpu", Tags: ParseTags("host=A"), Time: 8 * Second, Value: false}},
+		{&influxql.BooleanPoint{Name: "cpu", Tags: ParseTags("host=A"), Time: 12 * Second, Value: false}},
+		{&influxql.BooleanPoint{Name: "cpu", Tags: ParseTags("host=A"), Time: 16 * Second, Value: true}},
+		{&influxql.BooleanPoint{Name: "cpu", Tags: ParseTags("host=B"), Time: 0 * Second, Value: false}},
+		{&influxql.BooleanPoint{Name: "cpu", Tags: ParseTags("host=B"), Time: 4 * Second, Value: false}},
+	}) {
+		t.Fatalf("unexpected points: %s", spew.Sdump(a))
+	}
+}
+
+func TestSelect_FlagOutliers_Integer(t *testing.T) {
+	var ic IteratorCreator
+	ic.CreateIteratorFn = func(m *influxql.Measurement, opt influxql.IteratorOptions) (influxql.Iterator, error) {
+		if m.Name != "cpu" {
+			t.Fatalf("unexpected source: %s", m.Name)
+		}
+		return &IntegerIterator{Points: []influxql.IntegerPoint{
+			{Name: "cpu", Time: 0 * Second, Value: -50},
+			{Name: "cpu", Time: 4 * Second, Value: 2},
+			{Name: "cpu", Time: 8 * Second, Value: 1},
+			{Name: "cpu", Time: 12 * Second, Value: 2},
+			{Name: "cpu", Time: 16 * Second, Value: 1},
+		}}, nil
+	}
+
+	itrs, err := influxql.Select(MustParseSelectStatement(`SELECT flag_outliers(value, 1) FROM cpu WHERE time >= '1970-01-01T00:00:00Z' AND time < '1970-01-01T00:00:20Z'`), &ic, nil)
+	if err != nil {
+		t.Fatal(err)
+	} else if a, err := Iterators(itrs).ReadAll(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if !deep.Equal(a, [][]influxql.Point{
+		{&influxql.BooleanPoint{Name: "cpu", Time: 0 * Second, Value: true}},
+		{&influxql.BooleanPoint{Name: "cpu", Time: 4 * Second, Value: false}},
+		{&influxql.BooleanPoint{Name: "cpu", Time: 8 * Second, Value: false}},
+		{&influxql.BooleanPoint{Name: "cpu", Time: 12 * Second, Value: false}},
+		{&influxql.BooleanPoint{Name: "cpu", Time: 16 * Second, Value: false}},
+	}) {
+		t.Fatalf("unexpected points: %s", spew.Sdump(a))
+	}
+}
+
+// Ensure an aggregate in empty_as() returns the value for groups that only
+// have null values, while windows without any points are still filled.
+func TestSelect_EmptyAs(t *testing.T) {
+	var ic IteratorCreator
+	ic.CreateIteratorFn = func(m *influxql.Measurement, opt influxql.IteratorOptions) (influxql.Iterator, error) {
+		var points []influxql.FloatPoint
+		for _, p := range []influxql.FloatPoint{
+			{Name: "cpu", Time: 40 * Second, Value: 4},
+			{Name: "cpu", Time: 50 * Second, Value: 6},
+		} {
+			if p.Time >= opt.StartTime && p.Time <= opt.EndTime {
+				points = append(points, p)
+			}
+		}
+		return influxql.NewCallIterator(&FloatIterator{Points: points}, opt)
+	}
+
+	// The subquery has null rows from 0s to 30s because there is no previous
+	// value to fill them with, and no rows after 60s.
+	const source = `(SELECT max(value) FROM cpu WHERE time >= '1970-01-01T00:00:00Z' AND time < '1970-01-01T00:01:00Z' GROUP BY time(10s) fill(previous))`
+	const where = ` WHERE time >= '1970-01-01T00:00:00Z' AND time < '1970-01-01T00:01:30Z' GROUP BY time(30s) fill(-1)`
+
+	for _, tt := range []struct {
+		name string
+		q    string
+		exp  []float64
+	}{
+		{
+			name: "without empty_as",
+			q:    `SELECT mean(max) FROM ` + source + where,
+			exp:  []float64{-1, 5, -1},
+		},
+		{
+			name: "empty_as",
+			q:    `SELECT empty_as(mean(max), 0) FROM ` + source + where,
+			exp:  []float64{0, 5, -1},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			itrs, err := influxql.Select(MustParseSelectStatement(tt.q), &ic, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			a, err := Iterators(itrs).ReadAll()
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			} else if len(a) != len(tt.exp) {
+				t.Fatalf("unexpected points: %s", spew.Sdump(a))
+			}
+			for i, exp := range tt.exp {
+				p, ok := a[i][0].(*influxql.FloatPoint)
+				if !ok || p.Nil || p.Time != int64(i)*30*Second || p.Value != exp {
+					t.Fatalf("%d. unexpected point: %s", i, spew.Sdump(a[i][0]))
+				}
+			}
+		})
+	}
+
+	// The value must have the type of the aggregate.
+	if _, err := influxql.Select(MustParseSelectStatement(`SELECT empty_as(count(max), 0.5) FROM `+source+where), &ic, nil); err == nil || err.Error() != `empty_as value 0.500 does not match the integer type of the aggregate` {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
 func TestSelect_CumulativeSum_Float(t *testing.T) {
 	var ic IteratorCreator
 	ic.CreateIteratorFn = func(m *influxql.Measurement, opt influxql.IteratorOptions) (influxql.Iterator, error) {
@@ -74,6 +74,7 @@ const (
 	DATABASE
 	DATABASES
 	DEFAULT
+	DEFRAGMENT
 	DELETE
 	DESC
 	DESTINATIONS
@@ -101,6 +102,7 @@ const (
 	LIMIT
 	MEASUREMENT
 	MEASUREMENTS
+	MIGRATE
 	NAME
 	OFFSET
 	ON
@@ -129,6 +131,7 @@ const (
 	SUBSCRIPTIONS
 	TAG
 	TO
+	UNDROP
 	USER
 	USERS
 	VALUES
@@ -191,6 +194,7 @@ var tokens = [...]string{
 	DATABASE:      "DATABASE",
 	DATABASES:     "DATABASES",
 	DEFAULT:       "DEFAULT",
+	DEFRAGMENT:    "DEFRAGMENT",
 	DELETE:        "DELETE",
 	DESC:          "DESC",
 	DESTINATIONS:  "DESTINATIONS",
@@ -218,6 +222,7 @@ var tokens = [...]string{
 	LIMIT:         "LIMIT",
 	MEASUREMENT:   "MEASUREMENT",
 	MEASUREMENTS:  "MEASUREMENTS",
+	MIGRATE:       "MIGRATE",
 	NAME:          "NAME",
 	OFFSET:        "OFFSET",
 	ON:            "ON",
@@ -246,6 +251,7 @@ var tokens = [...]string{
 	SUBSCRIPTIONS: "SUBSCRIPTIONS",
 	TAG:           "TAG",
 	TO:            "TO",
+	UNDROP:        "UNDROP",
 	USER:          "USER",
 	USERS:         "USERS",
 	VALUES:        "VALUES",
@@ -17,6 +17,7 @@ type MetaClientMock struct {
 	CreateShardGroupFn                  func(database, policy string, timestamp time.Time) (*meta.ShardGroupInfo, error)
 	CreateSubscriptionFn                func(database, rp, name, mode string, destinations []string) error
 	CreateUserFn                        func(name, password string, admin bool) (*meta.UserInfo, error)
+	CreateValidationRuleFn              func(database string, rule meta.ValidationRuleInfo) error
 
 	DatabaseFn  func(name string) *meta.DatabaseInfo
 	DatabasesFn func() []meta.DatabaseInfo
@@ -29,21 +30,24 @@ type MetaClientMock struct {
 	DropSubscriptionFn    func(database, rp, name string) error
 	DropShardFn           func(id uint64) error
 	DropUserFn            func(name string) error
+	DropValidationRuleFn  func(database, name string) error
 
 	OpenFn func() error
 
+	RestoreShardFn    func(database, policy string, groupID uint64, start, end time.Time, shardID uint64) error
 	RetentionPolicyFn func(database, name string) (rpi *meta.RetentionPolicyInfo, err error)
 
-	SetAdminPrivilegeFn      func(username string, admin bool) error
-	SetDataFn                func(*meta.Data) error
-	SetPrivilegeFn           func(username, database string, p influxql.Privilege) error
-	ShardGroupsByTimeRangeFn func(database, policy string, min, max time.Time) (a []meta.ShardGroupInfo, err error)
-	ShardOwnerFn             func(shardID uint64) (database, policy string, sgi *meta.ShardGroupInfo)
-	UpdateRetentionPolicyFn  func(database, name string, rpu *meta.RetentionPolicyUpdate, makeDefault bool) error
-	UpdateUserFn             func(name, password string) error
-	UserPrivilegeFn          func(username, database string) (*influxql.Privilege, error)
-	UserPrivilegesFn         func(username string) (map[string]influxql.Privilege, error)
-	UsersFn                  func() []meta.UserInfo
+	SetAdminPrivilegeFn           func(username string, admin bool) error
+	SetDataFn                     func(*meta.Data) error
+	SetDatabaseDefaultPrecisionFn func(name, precision string) error
+	SetPrivilegeFn                func(username, database string, p influxql.Privilege) error
+	ShardGroupsByTimeRangeFn      func(database, policy string, min, max time.Time) (a []meta.ShardGroupInfo, err error)
+	ShardOwnerFn                  func(shardID uint64) (database, policy string, sgi *meta.ShardGroupInfo)
+	UpdateRetentionPolicyFn       func(database, name string, rpu *meta.RetentionPolicyUpdate, makeDefault bool) error
+	UpdateUserFn                  func(name, password string) error
+	UserPrivilegeFn               func(username, database string) (*influxql.Privilege, error)
+	UserPrivilegesFn              func(username string) (map[string]influxql.Privilege, error)
+	UsersFn                       func() []meta.UserInfo
 }
 
 func (c *MetaClientMock) Close() error {
@@ -78,6 +82,10 @@ func (c *MetaClientMock) CreateUser(name, password string, admin bool) (*meta.Us
 	return c.CreateUserFn(name, password, admin)
 }
 
+func (c *MetaClientMock) CreateValidationRule(database string, rule meta.ValidationRuleInfo) error {
+	return c.CreateValidationRuleFn(database, rule)
+}
+
 func (c *MetaClientMock) Database(name string) *meta.DatabaseInfo {
 	return c.DatabaseFn(name)
 }
@@ -114,6 +122,14 @@ func (c *MetaClientMock) DropUser(name string) error {
 	return c.DropUserFn(name)
 }
 
+func (c *MetaClientMock) DropValidationRule(database, name string) error {
+	return c.DropValidationRuleFn(database, name)
+}
+
+func (c *MetaClientMock) RestoreShard(database, policy string, groupID uint64, start, end time.Time, shardID uint64) error {
+	return c.RestoreShardFn(database, policy, groupID, start, end, shardID)
+}
+
 func (c *MetaClientMock) RetentionPolicy(database, name string) (rpi *meta.RetentionPolicyInfo, err error) {
 	return c.RetentionPolicyFn(database, name)
 }
@@ -122,6 +138,10 @@ func (c *MetaClientMock) SetAdminPrivilege(username string, admin bool) error {
 	return c.SetAdminPrivilegeFn(username, admin)
 }
 
+func (c *MetaClientMock) SetDatabaseDefaultPrecision(name, precision string) error {
+	return c.SetDatabaseDefaultPrecisionFn(name, precision)
+}
+
 func (c *MetaClientMock) SetPrivilege(username, database string, p influxql.Privilege) error {
 	return c.SetPrivilegeFn(username, database, p)
 }
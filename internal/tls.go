@@ -0,0 +1,149 @@
+package internal
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// TLSFiles holds the PEM files of a certificate authority and of a server
+// and a client certificate signed by it, for testing TLS listeners.
+type TLSFiles struct {
+	Dir string
+
+	// CA is the certificate of the authority.
+	CA string
+
+	// Certificate and PrivateKey are the server certificate, valid for
+	// localhost and 127.0.0.1, and its key.
+	Certificate string
+	PrivateKey  string
+
+	caCert     *x509.Certificate
+	clientCert tls.Certificate
+}
+
+// NewTLSFiles writes a new certificate authority and certificates signed by
+// it to a temporary directory.
+func NewTLSFiles() (*TLSFiles, error) {
+	dir, err := ioutil.TempDir("", "influxdb-tls")
+	if err != nil {
+		return nil, err
+	}
+	f := &TLSFiles{
+		Dir:         dir,
+		CA:          filepath.Join(dir, "ca.pem"),
+		Certificate: filepath.Join(dir, "cert.pem"),
+		PrivateKey:  filepath.Join(dir, "key.pem"),
+	}
+	if err := f.generate(); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	return f, nil
+}
+
+// Close removes the files.
+func (f *TLSFiles) Close() error {
+	return os.RemoveAll(f.Dir)
+}
+
+// ClientConfig returns a client TLS configuration that trusts the authority.
+// The client presents a certificate signed by the authority if withCert is
+// true.
+func (f *TLSFiles) ClientConfig(withCert bool) *tls.Config {
+	pool := x509.NewCertPool()
+	pool.AddCert(f.caCert)
+
+	config := &tls.Config{
+		RootCAs:    pool,
+		ServerName: "localhost",
+	}
+	if withCert {
+		config.Certificates = []tls.Certificate{f.clientCert}
+	}
+	return config
+}
+
+func (f *TLSFiles) generate() error {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	caTemplate := certificateTemplate(1, "influxdb test CA")
+	caTemplate.IsCA = true
+	caTemplate.BasicConstraintsValid = true
+	caTemplate.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		return err
+	}
+	if f.caCert, err = x509.ParseCertificate(caDER); err != nil {
+		return err
+	}
+	if err := writePEM(f.CA, "CERTIFICATE", caDER); err != nil {
+		return err
+	}
+
+	// Sign the server certificate.
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	template := certificateTemplate(2, "localhost")
+	template.DNSNames = []string{"localhost"}
+	template.IPAddresses = []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback}
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	der, err := x509.CreateCertificate(rand.Reader, template, f.caCert, &key.PublicKey, caKey)
+	if err != nil {
+		return err
+	}
+	if err := writePEM(f.Certificate, "CERTIFICATE", der); err != nil {
+		return err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	if err := writePEM(f.PrivateKey, "EC PRIVATE KEY", keyDER); err != nil {
+		return err
+	}
+
+	// Sign the client certificate.
+	clientKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	template = certificateTemplate(3, "client")
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	der, err = x509.CreateCertificate(rand.Reader, template, f.caCert, &clientKey.PublicKey, caKey)
+	if err != nil {
+		return err
+	}
+	f.clientCert = tls.Certificate{Certificate: [][]byte{der}, PrivateKey: clientKey}
+	return nil
+}
+
+func certificateTemplate(serial int64, name string) *x509.Certificate {
+	return &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+}
+
+func writePEM(path, typ string, der []byte) error {
+	return ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0600)
+}
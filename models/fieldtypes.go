@@ -0,0 +1,213 @@
+package models
+
+import (
+	"bytes"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// FieldTypeCache remembers the types of the fields of each measurement seen
+// while parsing points. ParsePointsWithFieldTypes uses the remembered type of a
+// field to check its value with a faster scan when it has the usual form of
+// that type, such as a float without an exponent. Values that don't are
+// parsed in full, so the cache never changes which points are accepted.
+// Field keys that repeat those of the previous point of the measurement are
+// not scanned again.
+//
+// The cache is safe for concurrent use. Parsing reads it without locking and
+// adds the fields it did not know once a whole buffer has been parsed.
+type FieldTypeCache struct {
+	mu      sync.Mutex
+	maxN    int
+	n       int
+	entries atomic.Value // map[string]map[string]FieldType
+}
+
+// NewFieldTypeCache returns a cache that remembers up to maxN fields.
+func NewFieldTypeCache(maxN int) *FieldTypeCache {
+	c := &FieldTypeCache{maxN: maxN}
+	c.entries.Store(make(map[string]map[string]FieldType))
+	return c
+}
+
+// FieldType returns the remembered type of a field of a measurement, or Empty
+// if it is not known.
+func (c *FieldTypeCache) FieldType(measurement, field string) FieldType {
+	if typ, ok := c.load()[measurement][field]; ok {
+		return typ
+	}
+	return Empty
+}
+
+// Len returns the number of fields remembered.
+func (c *FieldTypeCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.n
+}
+
+func (c *FieldTypeCache) load() map[string]map[string]FieldType {
+	return c.entries.Load().(map[string]map[string]FieldType)
+}
+
+// add remembers the types of fields found while parsing. The maps are
+// replaced rather than updated so readers never need to lock.
+func (c *FieldTypeCache) add(found map[string]map[string]FieldType) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	old := c.load()
+	if !c.changes(old, found) {
+		return
+	}
+
+	entries := make(map[string]map[string]FieldType, len(old)+len(found))
+	for name, fields := range old {
+		entries[name] = fields
+	}
+
+	for name, types := range found {
+		fields := make(map[string]FieldType, len(entries[name])+len(types))
+		for k, typ := range entries[name] {
+			fields[k] = typ
+		}
+		for k, typ := range types {
+			if _, ok := fields[k]; !ok {
+				if c.n >= c.maxN {
+					continue
+				}
+				c.n++
+			}
+			fields[k] = typ
+		}
+		entries[name] = fields
+	}
+	c.entries.Store(entries)
+}
+
+// changes returns true if adding found to entries would change them. Once
+// the cache is full, unknown fields no longer change it.
+func (c *FieldTypeCache) changes(entries, found map[string]map[string]FieldType) bool {
+	for name, types := range found {
+		for k, typ := range types {
+			if prev, ok := entries[name][k]; ok && prev != typ {
+				return true
+			} else if !ok && c.n < c.maxN {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ParsePointsWithFieldTypes is similar to ParsePointsWithPrecision, but
+// consults types for the fields of each measurement and remembers the types
+// of the fields it did not know.
+func ParsePointsWithFieldTypes(buf []byte, defaultTime time.Time, precision string, types *FieldTypeCache) ([]Point, error) {
+	points, _, err := parsePoints(buf, defaultTime, precision, false, types)
+	return points, err
+}
+
+// fieldTypeLookup looks up the fields of points in a snapshot of a
+// FieldTypeCache while a buffer is parsed.
+type fieldTypeLookup struct {
+	entries map[string]map[string]FieldType
+
+	// The measurement of the point being parsed and its known fields.
+	name   []byte
+	fields map[string]FieldType
+	ok     bool
+
+	// The fields of the last point of the measurement, in order. Points
+	// of the same measurement usually have the same fields in the same
+	// order, so comparing the key of each field with the field at the
+	// same position of the last point avoids looking it up.
+	last []fieldTypeEntry
+
+	// found holds the types of fields that were not known, or that had a
+	// different type than the one remembered.
+	found map[string]map[string]FieldType
+}
+
+func newFieldTypeLookup(c *FieldTypeCache) *fieldTypeLookup {
+	return &fieldTypeLookup{entries: c.load()}
+}
+
+// setKey looks up the known fields of the measurement of key. Points with an
+// escaped measurement are always parsed in full.
+func (l *fieldTypeLookup) setKey(key []byte) {
+	_, name := scanTo(key, 0, ',')
+	if l.ok && bytes.Equal(name, l.name) {
+		return
+	}
+	l.name = name
+	l.ok = bytes.IndexByte(name, '\\') < 0
+	l.fields = nil
+	l.last = l.last[:0]
+	if l.ok {
+		l.fields = l.entries[string(name)]
+	}
+}
+
+// fieldType returns the known type of the field at position i of a point, or
+// Empty if it is not known.
+func (l *fieldTypeLookup) fieldType(i int, field []byte) FieldType {
+	if i < len(l.last) && bytes.Equal(l.last[i].key, field) {
+		return l.last[i].typ
+	}
+
+	typ := Empty
+	if t, ok := l.fields[string(field)]; ok {
+		typ = t
+	}
+	l.setLast(i, field, typ)
+	return typ
+}
+
+// knownKey returns the length of the key of the field at position i of the
+// last point if buf starts with that key followed by an equals sign, or 0.
+func (l *fieldTypeLookup) knownKey(i int, buf []byte) int {
+	if i < len(l.last) {
+		key := l.last[i].key
+		if len(key) < len(buf) && buf[len(key)] == '=' && bytes.Equal(buf[:len(key)], key) {
+			return len(key)
+		}
+	}
+	return 0
+}
+
+// setLast sets the field at position i of the last point.
+func (l *fieldTypeLookup) setLast(i int, field []byte, typ FieldType) {
+	if i < len(l.last) {
+		l.last[i] = fieldTypeEntry{key: field, typ: typ}
+	} else if i == len(l.last) {
+		l.last = append(l.last, fieldTypeEntry{key: field, typ: typ})
+	}
+}
+
+// record notes the type of the field at position i of a point that was
+// parsed in full.
+func (l *fieldTypeLookup) record(i int, field []byte, typ FieldType) {
+	if !l.ok || bytes.IndexByte(field, '\\') >= 0 {
+		return
+	}
+	l.setLast(i, field, typ)
+	if l.found == nil {
+		l.found = make(map[string]map[string]FieldType)
+	}
+	fields := l.found[string(l.name)]
+	if fields == nil {
+		fields = make(map[string]FieldType)
+		l.found[string(l.name)] = fields
+	}
+	if prev, ok := fields[string(field)]; !ok || prev != typ {
+		fields[string(field)] = typ
+	}
+}
+
+// fieldTypeEntry is a field key and its type.
+type fieldTypeEntry struct {
+	key []byte
+	typ FieldType
+}
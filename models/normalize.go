@@ -0,0 +1,96 @@
+package models
+
+import (
+	"errors"
+	"sort"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// ParsePointsNormalized is similar to ParsePointsWithPrecision, but converts
+// the measurement, tag keys and field keys of each point to Unicode
+// Normalization Form C. Names written with different encodings of the same
+// characters, such as a precomposed é and an e followed by a combining accent,
+// are then stored as the same name. Tag and field values are not changed.
+//
+// The number of points with a name that was changed is returned with the
+// points. Points with names that are only ASCII are not examined further.
+func ParsePointsNormalized(buf []byte, defaultTime time.Time, precision string) ([]Point, int, error) {
+	return parsePoints(buf, defaultTime, precision, true, nil)
+}
+
+// normalizeNames returns pt with its names in Normalization Form C and whether
+// any name was changed.
+func normalizeNames(pt *point) (Point, bool, error) {
+	if isASCII(pt.key) && isASCII(pt.fields) {
+		return pt, false, nil
+	}
+
+	name := []byte(pt.Name())
+	changed := !norm.NFC.IsNormal(name)
+	if changed {
+		name = norm.NFC.Bytes(name)
+	}
+
+	tags := pt.Tags()
+	for _, t := range tags {
+		if !norm.NFC.IsNormal(t.Key) {
+			changed = true
+			break
+		}
+	}
+
+	fields, err := pt.Fields()
+	if err != nil {
+		return nil, false, err
+	}
+	for k := range fields {
+		if !norm.NFC.IsNormalString(k) {
+			changed = true
+			break
+		}
+	}
+
+	if !changed {
+		return pt, false, nil
+	}
+
+	// Names that only differed in their encoding are the same name now.
+	normTags := make(Tags, len(tags))
+	for i, t := range tags {
+		normTags[i] = Tag{Key: norm.NFC.Bytes(t.Key), Value: t.Value}
+	}
+	sort.Sort(normTags)
+	for i := 1; i < len(normTags); i++ {
+		if string(normTags[i-1].Key) == string(normTags[i].Key) {
+			return nil, false, errors.New("duplicate tags")
+		}
+	}
+
+	normFields := make(Fields, len(fields))
+	for k, v := range fields {
+		k = norm.NFC.String(k)
+		if _, ok := normFields[k]; ok {
+			return nil, false, errors.New("duplicate fields")
+		}
+		normFields[k] = v
+	}
+
+	p, err := NewPoint(string(name), normTags, normFields, pt.time)
+	if err != nil {
+		return nil, false, err
+	}
+	return p, true, nil
+}
+
+// isASCII returns true if b contains no multi-byte UTF-8 sequences.
+func isASCII(b []byte) bool {
+	for _, c := range b {
+		if c >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
@@ -254,15 +254,31 @@ func ParseKey(buf []byte) (string, Tags, error) {
 // ParsePointsWithPrecision is similar to ParsePoints, but allows the
 // caller to provide a precision for time.
 //
+// Every point in buf without a timestamp is assigned the same defaultTime.
+//
 // NOTE: to minimize heap allocations, the returned Points will refer to subslices of buf.
 // This can have the unintended effect preventing buf from being garbage collected.
 func ParsePointsWithPrecision(buf []byte, defaultTime time.Time, precision string) ([]Point, error) {
+	points, _, err := parsePoints(buf, defaultTime, precision, false, nil)
+	return points, err
+}
+
+// parsePoints parses the points in buf, converting their names to Unicode
+// Normalization Form C if normalize is true. It returns the number of points
+// with a name that was changed. The fields of each point are looked up in
+// types, if set, and the types of fields it did not know are added to it.
+func parsePoints(buf []byte, defaultTime time.Time, precision string, normalize bool, types *FieldTypeCache) ([]Point, int, error) {
 	points := make([]Point, 0, bytes.Count(buf, []byte{'\n'})+1)
 	var (
-		pos    int
-		block  []byte
-		failed []string
+		pos        int
+		block      []byte
+		failed     []string
+		normalized int
+		lookup     *fieldTypeLookup
 	)
+	if types != nil {
+		lookup = newFieldTypeLookup(types)
+	}
 	for pos < len(buf) {
 		pos, block = scanLine(buf, pos)
 		pos++
@@ -288,7 +304,13 @@ func ParsePointsWithPrecision(buf []byte, defaultTime time.Time, precision strin
 			block = block[:len(block)-1]
 		}
 
-		pt, err := parsePoint(block[start:], defaultTime, precision)
+		pt, err := parsePoint(block[start:], defaultTime, precision, lookup)
+		if err == nil && normalize {
+			var changed bool
+			if pt, changed, err = normalizeNames(pt.(*point)); changed {
+				normalized++
+			}
+		}
 		if err != nil {
 			failed = append(failed, fmt.Sprintf("unable to parse '%s': %v", string(block[start:]), err))
 		} else {
@@ -296,14 +318,17 @@ func ParsePointsWithPrecision(buf []byte, defaultTime time.Time, precision strin
 		}
 
 	}
+	if lookup != nil && lookup.found != nil {
+		types.add(lookup.found)
+	}
 	if len(failed) > 0 {
-		return points, fmt.Errorf("%s", strings.Join(failed, "\n"))
+		return points, normalized, fmt.Errorf("%s", strings.Join(failed, "\n"))
 	}
-	return points, nil
+	return points, normalized, nil
 
 }
 
-func parsePoint(buf []byte, defaultTime time.Time, precision string) (Point, error) {
+func parsePoint(buf []byte, defaultTime time.Time, precision string, lookup *fieldTypeLookup) (Point, error) {
 	// scan the first block which is measurement[,tag1=value1,tag2=value=2...]
 	pos, key, err := scanKey(buf, 0)
 	if err != nil {
@@ -319,8 +344,12 @@ func parsePoint(buf []byte, defaultTime time.Time, precision string) (Point, err
 		return nil, fmt.Errorf("max key length exceeded: %v > %v", len(key), MaxKeyLength)
 	}
 
+	if lookup != nil {
+		lookup.setKey(key)
+	}
+
 	// scan the second block is which is field1=value1[,field2=value2,...]
-	pos, fields, err := scanFields(buf, pos)
+	pos, fields, err := scanFields(buf, pos, lookup)
 	if err != nil {
 		return nil, err
 	}
@@ -647,11 +676,14 @@ func less(buf []byte, indices []int, i, j int) bool {
 
 // scanFields scans buf, starting at i for the fields section of a point.  It returns
 // the ending position and the byte slice of the fields within buf.
-func scanFields(buf []byte, i int) (int, []byte, error) {
+func scanFields(buf []byte, i int, lookup *fieldTypeLookup) (int, []byte, error) {
 	start := skipWhitespace(buf, i)
 	i = start
 	quoted := false
 
+	// the start of the current field key
+	keyStart := start
+
 	// tracks how many '=' we've seen
 	equals := 0
 
@@ -664,6 +696,12 @@ func scanFields(buf []byte, i int) (int, []byte, error) {
 			break
 		}
 
+		// Skip over a field key that is the same as the key of the field at
+		// the same position of the last point, which was scanned the same way.
+		if lookup != nil && i == keyStart {
+			i += lookup.knownKey(commas, buf[i:])
+		}
+
 		// escaped characters?
 		if buf[i] == '\\' && i+1 < len(buf) {
 			i += 2
@@ -703,12 +741,41 @@ func scanFields(buf []byte, i int) (int, []byte, error) {
 				return i, buf[start:i], fmt.Errorf("missing field value")
 			}
 
+			// Check values in the usual form of the known type of the
+			// field with a faster scan.
+			key := buf[keyStart:i]
+			typ := Empty
+			if lookup != nil {
+				typ = lookup.fieldType(commas, key)
+				switch typ {
+				case Float:
+					if j, ok := scanFloatFast(buf, i+1); ok {
+						i = j
+						continue
+					}
+				case Integer:
+					if j, ok := scanIntegerFast(buf, i+1); ok {
+						i = j
+						continue
+					}
+				}
+			}
+
 			if isNumeric(buf[i+1]) || buf[i+1] == '-' || buf[i+1] == 'N' || buf[i+1] == 'n' {
 				var err error
 				i, err = scanNumber(buf, i+1)
 				if err != nil {
 					return i, buf[start:i], err
 				}
+				if lookup != nil {
+					numType := Float
+					if buf[i-1] == 'i' {
+						numType = Integer
+					}
+					if numType != typ {
+						lookup.record(commas, key, numType)
+					}
+				}
 				continue
 			}
 			// If next byte is not a double-quote, the value must be a boolean
@@ -718,12 +785,19 @@ func scanFields(buf []byte, i int) (int, []byte, error) {
 				if err != nil {
 					return i, buf[start:i], err
 				}
+				if lookup != nil && typ != Boolean {
+					lookup.record(commas, key, Boolean)
+				}
 				continue
 			}
+			if lookup != nil && typ != String {
+				lookup.record(commas, key, String)
+			}
 		}
 
 		if buf[i] == ',' && !quoted {
 			commas++
+			keyStart = i + 1
 		}
 
 		// reached end of block?
@@ -899,6 +973,62 @@ func scanNumber(buf []byte, i int) (int, error) {
 	return i, nil
 }
 
+// scanFloatFast returns the end position within buf, starting at i, of a
+// float without an exponent that is too short to need a range check, such as
+// 1.5 or -20. It returns false if the value is not in that form, in which case
+// it must be scanned with scanNumber.
+func scanFloatFast(buf []byte, i int) (int, bool) {
+	start := i
+	if i < len(buf) && buf[i] == '-' {
+		i++
+	}
+
+	digits, decimal := 0, false
+	for ; i < len(buf); i++ {
+		c := buf[i]
+		if c >= '0' && c <= '9' {
+			digits++
+		} else if c == '.' && !decimal {
+			decimal = true
+		} else if c == ',' || c == ' ' {
+			break
+		} else {
+			return start, false
+		}
+	}
+
+	if digits == 0 || i-start >= maxFloat64Digits {
+		return start, false
+	}
+	return i, true
+}
+
+// scanIntegerFast returns the end position within buf, starting at i, of an
+// integer that is too short to need a range check, such as 10i. It returns
+// false if the value is not in that form, in which case it must be scanned
+// with scanNumber.
+func scanIntegerFast(buf []byte, i int) (int, bool) {
+	start := i
+	if i < len(buf) && buf[i] == '-' {
+		i++
+	}
+
+	digits := 0
+	for ; i < len(buf) && buf[i] >= '0' && buf[i] <= '9'; i++ {
+		digits++
+	}
+
+	if digits == 0 || i >= len(buf) || buf[i] != 'i' || i-start >= maxInt64Digits {
+		return start, false
+	}
+	i++
+
+	if i < len(buf) && buf[i] != ',' && buf[i] != ' ' {
+		return start, false
+	}
+	return i, true
+}
+
 // scanBoolean returns the end position within buf, start at i after
 // scanning over buf for boolean. Valid values for a boolean are
 // t, T, true, TRUE, f, F, false, FALSE.  It returns an error if a invalid boolean
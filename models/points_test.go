@@ -2297,6 +2297,138 @@ func TestEscapeStringField(t *testing.T) {
 	}
 }
 
+func TestParsePointsNormalized(t *testing.T) {
+	const (
+		composed   = "caf\u00e9"
+		decomposed = "cafe\u0301"
+	)
+
+	buf := decomposed + ",key" + decomposed + "=" + decomposed + " field" + decomposed + "=\"" + decomposed + "\" 10\n" +
+		composed + " value=1 20\n" +
+		"cpu value=2 30\n"
+	points, n, err := models.ParsePointsNormalized([]byte(buf), time.Unix(0, 0), "n")
+	if err != nil {
+		t.Fatal(err)
+	} else if len(points) != 3 {
+		t.Fatalf("unexpected points: %v", points)
+	} else if n != 1 {
+		t.Fatalf("unexpected normalized points: %d", n)
+	}
+
+	// Only the names are normalized.
+	if got := points[0].Name(); got != composed {
+		t.Fatalf("unexpected name: %q", got)
+	} else if got := points[0].Tags().GetString("key" + composed); got != decomposed {
+		t.Fatalf("unexpected tags: %v", points[0].Tags())
+	} else if fields, err := points[0].Fields(); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(fields, models.Fields{"field" + composed: decomposed}) {
+		t.Fatalf("unexpected fields: %v", fields)
+	} else if got := points[0].UnixNano(); got != 10 {
+		t.Fatalf("unexpected time: %d", got)
+	}
+	if got := points[1].Name(); got != composed {
+		t.Fatalf("unexpected name: %q", got)
+	}
+
+	// Names that are only equal once normalized are duplicates.
+	if _, _, err := models.ParsePointsNormalized([]byte("cpu,"+composed+"=a,"+decomposed+"=b value=1"), time.Unix(0, 0), "n"); err == nil {
+		t.Fatal("expected error for duplicate tags")
+	}
+}
+
+// Ensure points parsed with a field type cache are the same as points parsed
+// without one, whether or not the cached types match.
+func TestParsePointsWithFieldTypes(t *testing.T) {
+	types := models.NewFieldTypeCache(100)
+	if _, err := models.ParsePointsWithFieldTypes([]byte(`cpu,host=a f=1.5,i=2i,b=true,s="x" 0`), time.Unix(0, 0), "n", types); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		field string
+		typ   models.FieldType
+	}{
+		{"f", models.Float},
+		{"i", models.Integer},
+		{"b", models.Boolean},
+		{"s", models.String},
+		{"missing", models.Empty},
+	} {
+		if got := types.FieldType("cpu", tt.field); got != tt.typ {
+			t.Fatalf("%s: unexpected type: %v", tt.field, got)
+		}
+	}
+
+	for _, line := range []string{
+		`cpu f=-20,i=-3i 0`,
+		`cpu f=.5,i=0i 0`,
+		`cpu f=1e3,i=4i 0`,
+		`cpu f=4i,i=1.5 0`,
+		`cpu f=12345678901234567890123456789,i=99999999999999999999i 0`,
+		`cpu f=1.2.3 0`,
+		`cpu f=-,i=1 0`,
+		`cpu f=.,i=1 0`,
+		`cpu f=1x 0`,
+		`cpu i=1ix 0`,
+		`cpu i=-i 0`,
+		`cpu f=NaN 0`,
+		`cpu\,x f=1,i=2i 0`,
+		`cpu f\ x=1,i=2i 0`,
+		"cpu f=1,i=2i 0\ncpu f=2,i=3i 1\ncpu i=4i,f=3 2\ncpu f=1,i=2i,x=\"a,b=c\" 3\ncpu f=1,i=2i,x=\"q\" 4\ncpu fx=1,i=2i 5\ncpu f=1,ix=2i 6\ncpu f=1,i=2.5 7",
+		`cpu f="str",i=true 0`,
+	} {
+		exp, expErr := models.ParsePointsWithPrecision([]byte(line), time.Unix(0, 0), "n")
+		got, err := models.ParsePointsWithFieldTypes([]byte(line), time.Unix(0, 0), "n", types)
+		if (err == nil) != (expErr == nil) {
+			t.Fatalf("%s: unexpected error: got=%v exp=%v", line, err, expErr)
+		} else if len(got) != len(exp) {
+			t.Fatalf("%s: unexpected points: %v", line, got)
+		}
+		for i := range got {
+			if got[i].String() != exp[i].String() {
+				t.Fatalf("%s: unexpected point: %s", line, got[i])
+			}
+		}
+	}
+
+	// A field whose type changed is remembered with its new type.
+	if got := types.FieldType("cpu", "f"); got != models.String {
+		t.Fatalf("unexpected type: %v", got)
+	}
+
+	// Fields beyond the size of the cache are not remembered.
+	types = models.NewFieldTypeCache(2)
+	if _, err := models.ParsePointsWithFieldTypes([]byte(`cpu a=1,b=2,c=3`), time.Unix(0, 0), "n", types); err != nil {
+		t.Fatal(err)
+	} else if n := types.Len(); n != 2 {
+		t.Fatalf("unexpected cached fields: %d", n)
+	}
+}
+
+func BenchmarkParsePoints_FieldTypes(b *testing.B) {
+	var batch [5000]string
+	for i := 0; i < len(batch); i++ {
+		batch[i] = fmt.Sprintf(`cpu,host=server%d,region=uswest usage_user=%d.25,usage_system=12.125,usage_idle=%d.5,threads=%di,running=true 1000000000`, i%100, i%100, i, i)
+	}
+	buf := []byte(strings.Join(batch[:], "\n"))
+
+	b.Run("Uncached", func(b *testing.B) {
+		b.SetBytes(int64(len(buf)))
+		for i := 0; i < b.N; i++ {
+			models.ParsePointsWithPrecision(buf, time.Unix(0, 0), "n")
+		}
+	})
+	b.Run("Cached", func(b *testing.B) {
+		types := models.NewFieldTypeCache(100)
+		models.ParsePointsWithFieldTypes(buf, time.Unix(0, 0), "n", types)
+		b.SetBytes(int64(len(buf)))
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			models.ParsePointsWithFieldTypes(buf, time.Unix(0, 0), "n", types)
+		}
+	})
+}
+
 func BenchmarkEscapeStringField_Plain(b *testing.B) {
 	s := "nothing special"
 	for i := 0; i < b.N; i++ {
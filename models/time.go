@@ -6,6 +6,7 @@ package models
 import (
 	"fmt"
 	"math"
+	"strings"
 	"time"
 )
 
@@ -41,6 +42,56 @@ var (
 	ErrTimeOutOfRange = fmt.Errorf("time outside range %d - %d", MinNanoTime, MaxNanoTime)
 )
 
+// Policies for parsing a timestamp at a leap second, such as
+// 2016-12-31T23:59:60Z. Timestamps are stored as Unix time, which has no leap
+// seconds, so a leap second has to be moved onto a second that exists.
+const (
+	// LeapSecondReject rejects a leap second as an invalid time.
+	LeapSecondReject = "reject"
+
+	// LeapSecondClamp parses every instant of a leap second as the last
+	// nanosecond of the second before it, so it stays in the same minute,
+	// day and GROUP BY time() bucket.
+	LeapSecondClamp = "clamp"
+
+	// LeapSecondNext parses a leap second as the first second of the next
+	// day, the same as POSIX time, so it overlaps that second.
+	LeapSecondNext = "next"
+)
+
+// ParseTimeLeapSecond parses value like time.Parse, handling a leap second
+// with the policy. Leap seconds are only accepted at 23:59:60 UTC on the last
+// day of June or December, when they can be inserted. The fields of layout
+// before the seconds must have a fixed width.
+func ParseTimeLeapSecond(layout, value, policy string) (time.Time, error) {
+	t, err := time.Parse(layout, value)
+	if err == nil || policy == "" || policy == LeapSecondReject {
+		return t, err
+	}
+
+	i := strings.Index(layout, "05")
+	if i < 0 || len(value) < i+2 || value[i:i+2] != "60" {
+		return time.Time{}, err
+	}
+	prev, perr := time.Parse(layout, value[:i]+"59"+value[i+2:])
+	if perr != nil {
+		return time.Time{}, err
+	}
+
+	u := prev.UTC()
+	if u.Hour() != 23 || u.Minute() != 59 || !((u.Month() == time.June && u.Day() == 30) || (u.Month() == time.December && u.Day() == 31)) {
+		return time.Time{}, err
+	}
+
+	switch policy {
+	case LeapSecondClamp:
+		return prev.Truncate(time.Second).Add(time.Second - time.Nanosecond), nil
+	case LeapSecondNext:
+		return prev.Add(time.Second), nil
+	}
+	return time.Time{}, err
+}
+
 // SafeCalcTime safely calculates the time given. Will return error if the time is outside the
 // supported range.
 func SafeCalcTime(timestamp int64, precision string) (time.Time, error) {
@@ -0,0 +1,53 @@
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lucaswiersma/influxdb/models"
+)
+
+func TestParseTimeLeapSecond(t *testing.T) {
+	for _, tt := range []struct {
+		value  string
+		policy string
+		exp    string
+		err    bool
+	}{
+		// Times that are not leap seconds are parsed as usual.
+		{value: "2016-12-31T23:59:59.5Z", policy: models.LeapSecondClamp, exp: "2016-12-31T23:59:59.5Z"},
+
+		// The leap second at the end of 2016.
+		{value: "2016-12-31T23:59:60Z", policy: models.LeapSecondReject, err: true},
+		{value: "2016-12-31T23:59:60Z", policy: "", err: true},
+		{value: "2016-12-31T23:59:60Z", policy: models.LeapSecondClamp, exp: "2016-12-31T23:59:59.999999999Z"},
+		{value: "2016-12-31T23:59:60.5Z", policy: models.LeapSecondClamp, exp: "2016-12-31T23:59:59.999999999Z"},
+		{value: "2016-12-31T23:59:60Z", policy: models.LeapSecondNext, exp: "2017-01-01T00:00:00Z"},
+		{value: "2016-12-31T23:59:60.5Z", policy: models.LeapSecondNext, exp: "2017-01-01T00:00:00.5Z"},
+
+		// The same leap second in another time zone.
+		{value: "2017-01-01T08:59:60+09:00", policy: models.LeapSecondNext, exp: "2017-01-01T00:00:00Z"},
+
+		// The leap second at the end of June 2015.
+		{value: "2015-06-30T23:59:60Z", policy: models.LeapSecondClamp, exp: "2015-06-30T23:59:59.999999999Z"},
+
+		// Leap seconds are not inserted at other times.
+		{value: "2016-12-31T12:00:60Z", policy: models.LeapSecondClamp, err: true},
+		{value: "2016-03-31T23:59:60Z", policy: models.LeapSecondNext, err: true},
+	} {
+		got, err := models.ParseTimeLeapSecond(time.RFC3339Nano, tt.value, tt.policy)
+		if tt.err {
+			if err == nil {
+				t.Errorf("%s (%s): expected error, got %s", tt.value, tt.policy, got.Format(time.RFC3339Nano))
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("%s (%s): unexpected error: %s", tt.value, tt.policy, err)
+			continue
+		}
+
+		if s := got.UTC().Format(time.RFC3339Nano); s != tt.exp {
+			t.Errorf("%s (%s): got %s, exp %s", tt.value, tt.policy, s, tt.exp)
+		}
+	}
+}
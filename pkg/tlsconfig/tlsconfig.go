@@ -0,0 +1,45 @@
+// Package tlsconfig builds the TLS configuration of listeners.
+package tlsconfig // import "github.com/lucaswiersma/influxdb/pkg/tlsconfig"
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+)
+
+// New returns a TLS configuration for a listener serving the certificate and
+// private key in the given PEM files. The private key is read from the
+// certificate file if privateKey is empty.
+//
+// If clientCA is not empty, clients must present a certificate signed by one
+// of the certificate authorities in that PEM file.
+func New(certificate, privateKey, clientCA string) (*tls.Config, error) {
+	if privateKey == "" {
+		privateKey = certificate
+	}
+
+	cert, err := tls.LoadX509KeyPair(certificate, privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+	}
+
+	if clientCA != "" {
+		pem, err := ioutil.ReadFile(clientCA)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in client CA file %s", clientCA)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
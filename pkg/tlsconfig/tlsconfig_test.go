@@ -0,0 +1,90 @@
+package tlsconfig_test
+
+import (
+	"crypto/tls"
+	"testing"
+
+	"github.com/lucaswiersma/influxdb/internal"
+	"github.com/lucaswiersma/influxdb/pkg/tlsconfig"
+)
+
+func TestNew(t *testing.T) {
+	files, err := internal.NewTLSFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer files.Close()
+
+	config, err := tlsconfig.New(files.Certificate, files.PrivateKey, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := handshake(config, files.ClientConfig(false)); err != nil {
+		t.Fatalf("unexpected handshake error: %s", err)
+	}
+}
+
+func TestNew_ClientCA(t *testing.T) {
+	files, err := internal.NewTLSFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer files.Close()
+
+	config, err := tlsconfig.New(files.Certificate, files.PrivateKey, files.CA)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := handshake(config, files.ClientConfig(true)); err != nil {
+		t.Fatalf("unexpected handshake error: %s", err)
+	}
+
+	// Clients without a certificate are rejected.
+	if err := handshake(config, files.ClientConfig(false)); err == nil {
+		t.Fatal("expected handshake error")
+	}
+}
+
+func TestNew_Error(t *testing.T) {
+	files, err := internal.NewTLSFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer files.Close()
+
+	if _, err := tlsconfig.New(files.Certificate, files.Certificate, ""); err == nil {
+		t.Fatal("expected error for missing private key")
+	}
+
+	// The private key is not a certificate authority.
+	if _, err := tlsconfig.New(files.Certificate, files.PrivateKey, files.PrivateKey); err == nil {
+		t.Fatal("expected error for client CA without certificates")
+	}
+}
+
+// handshake connects a client to a listener using the given configurations
+// and returns the error of the server side of the handshake.
+func handshake(server, client *tls.Config) error {
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", server)
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+
+	go func() {
+		conn, err := tls.Dial("tcp", ln.Addr().String(), client)
+		if err != nil {
+			return
+		}
+		conn.Handshake()
+		conn.Close()
+	}()
+
+	conn, err := ln.Accept()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.(*tls.Conn).Handshake()
+}
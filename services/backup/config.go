@@ -0,0 +1,108 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lucaswiersma/influxdb/monitor/diagnostics"
+	"github.com/lucaswiersma/influxdb/toml"
+)
+
+const (
+	// ModeFull takes a full backup on every run.
+	ModeFull = "full"
+
+	// ModeIncremental backs up only the files written since the previous run
+	// and takes a full backup once every full interval.
+	ModeIncremental = "incremental"
+)
+
+const (
+	// DefaultInterval is how often a backup is taken if none is specified.
+	DefaultInterval = 24 * time.Hour
+
+	// DefaultFullInterval is how often an incremental schedule starts a new
+	// full backup if none is specified.
+	DefaultFullInterval = 7 * 24 * time.Hour
+
+	// DefaultRetain is the default number of backups that are kept.
+	DefaultRetain = 7
+)
+
+// Config represents the configuration for the backup service.
+type Config struct {
+	Enabled bool `toml:"enabled"`
+
+	// Destination is the directory backups are written to.
+	Destination string `toml:"destination"`
+
+	// Databases are the databases that are backed up. All databases are
+	// backed up if none are given.
+	Databases []string `toml:"databases"`
+
+	Interval     toml.Duration `toml:"interval"`
+	Mode         string        `toml:"mode"`
+	FullInterval toml.Duration `toml:"full-interval"`
+
+	// Retain is the number of backups that are kept in the destination. A
+	// value of 0 keeps every backup.
+	Retain int `toml:"retain"`
+}
+
+// NewConfig returns a new Config with defaults.
+func NewConfig() Config {
+	return Config{
+		Enabled:      false,
+		Interval:     toml.Duration(DefaultInterval),
+		Mode:         ModeFull,
+		FullInterval: toml.Duration(DefaultFullInterval),
+		Retain:       DefaultRetain,
+	}
+}
+
+// Validate returns an error if the Config is invalid.
+func (c Config) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+
+	if c.Destination == "" {
+		return errors.New("destination must be specified")
+	}
+	if c.Interval <= 0 {
+		return errors.New("interval must be positive")
+	}
+	switch c.Mode {
+	case ModeFull:
+	case ModeIncremental:
+		if c.FullInterval < c.Interval {
+			return errors.New("full-interval must be greater than or equal to interval")
+		}
+	default:
+		return fmt.Errorf("invalid mode %q: must be %s or %s", c.Mode, ModeFull, ModeIncremental)
+	}
+	if c.Retain < 0 {
+		return errors.New("retain must be greater than or equal to 0")
+	}
+	return nil
+}
+
+// Diagnostics returns a diagnostics representation of a subset of the Config.
+func (c Config) Diagnostics() (*diagnostics.Diagnostics, error) {
+	if !c.Enabled {
+		return diagnostics.RowFromMap(map[string]interface{}{
+			"enabled": false,
+		}), nil
+	}
+
+	return diagnostics.RowFromMap(map[string]interface{}{
+		"enabled":       true,
+		"destination":   c.Destination,
+		"databases":     c.Databases,
+		"interval":      c.Interval,
+		"mode":          c.Mode,
+		"full-interval": c.FullInterval,
+		"retain":        c.Retain,
+	}), nil
+}
@@ -0,0 +1,85 @@
+package backup_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/lucaswiersma/influxdb/services/backup"
+)
+
+func TestConfig_Parse(t *testing.T) {
+	// Parse configuration.
+	var c backup.Config
+	if _, err := toml.Decode(`
+enabled = true
+destination = "/var/lib/influxdb/backups"
+databases = ["telegraf"]
+interval = "6h"
+mode = "incremental"
+full-interval = "24h"
+retain = 3
+`, &c); err != nil {
+		t.Fatal(err)
+	}
+
+	// Validate configuration.
+	if !c.Enabled {
+		t.Fatalf("unexpected enabled state: %v", c.Enabled)
+	} else if c.Destination != "/var/lib/influxdb/backups" {
+		t.Fatalf("unexpected destination: %s", c.Destination)
+	} else if len(c.Databases) != 1 || c.Databases[0] != "telegraf" {
+		t.Fatalf("unexpected databases: %v", c.Databases)
+	} else if time.Duration(c.Interval) != 6*time.Hour {
+		t.Fatalf("unexpected interval: %v", c.Interval)
+	} else if c.Mode != backup.ModeIncremental {
+		t.Fatalf("unexpected mode: %s", c.Mode)
+	} else if time.Duration(c.FullInterval) != 24*time.Hour {
+		t.Fatalf("unexpected full interval: %v", c.FullInterval)
+	} else if c.Retain != 3 {
+		t.Fatalf("unexpected retain: %d", c.Retain)
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	c := backup.NewConfig()
+	if err := c.Validate(); err != nil {
+		t.Fatalf("unexpected validation fail from NewConfig: %s", err)
+	}
+
+	c = backup.NewConfig()
+	c.Enabled = true
+	if err := c.Validate(); err == nil {
+		t.Fatal("expected error for missing destination, got nil")
+	}
+
+	c.Destination = "/var/lib/influxdb/backups"
+	if err := c.Validate(); err != nil {
+		t.Fatalf("unexpected validation fail: %s", err)
+	}
+
+	c.Interval = 0
+	if err := c.Validate(); err == nil {
+		t.Fatal("expected error for interval = 0, got nil")
+	}
+
+	c = backup.NewConfig()
+	c.Enabled, c.Destination = true, "/var/lib/influxdb/backups"
+	c.Mode = "differential"
+	if err := c.Validate(); err == nil {
+		t.Fatal("expected error for unknown mode, got nil")
+	}
+
+	c.Mode = backup.ModeIncremental
+	c.FullInterval = c.Interval / 2
+	if err := c.Validate(); err == nil {
+		t.Fatal("expected error for full-interval shorter than interval, got nil")
+	}
+
+	c = backup.NewConfig()
+	c.Enabled, c.Destination = true, "/var/lib/influxdb/backups"
+	c.Retain = -1
+	if err := c.Validate(); err == nil {
+		t.Fatal("expected error for negative retain, got nil")
+	}
+}
@@ -0,0 +1,352 @@
+// Package backup provides a service that periodically backs up the meta store
+// and the local shards to a directory.
+package backup // import "github.com/lucaswiersma/influxdb/services/backup"
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lucaswiersma/influxdb/models"
+	"github.com/lucaswiersma/influxdb/services/meta"
+	"go.uber.org/zap"
+)
+
+// Statistics for the backup service.
+const (
+	statBackups        = "backups"
+	statBackupFailures = "backupFailures"
+	statBackupDuration = "backupDuration"
+	statBackupBytes    = "backupBytes"
+	statBackupsPruned  = "backupsPruned"
+)
+
+// Backup files are named the same as the files written by "influxd backup"
+// so that a backup directory can be restored with "influxd restore".
+const (
+	metafile         = "meta"
+	shardFilePattern = "%s.%s.%05d"
+	pendingSuffix    = ".pending"
+)
+
+// dirLayout is the time layout of the directory name of each backup.
+const dirLayout = "20060102T150405Z"
+
+// Service periodically backs up the meta store and the local shards. Each
+// full backup is written to a directory of its own in the destination, named
+// by the time it was taken. Incremental backups add the files written since
+// the previous backup to the directory of the newest full backup.
+type Service struct {
+	MetaClient interface {
+		Databases() []meta.DatabaseInfo
+	}
+	TSDBStore interface {
+		ShardIDs() []uint64
+		BackupShard(id uint64, since time.Time, w io.Writer) error
+	}
+	Snapshotter interface {
+		WriteMetastoreBackup(w io.Writer) error
+	}
+
+	destination  string
+	databases    map[string]struct{}
+	interval     time.Duration
+	incremental  bool
+	fullInterval time.Duration
+	retain       int
+
+	// dir is the directory of the newest full backup taken by the service
+	// and fullTime is when it was taken. Incremental backups are added to
+	// it. The first backup after the service starts is always full.
+	dir      string
+	fullTime time.Time
+
+	// last is when the previous successful backup was taken.
+	last time.Time
+
+	wg   sync.WaitGroup
+	done chan struct{}
+
+	stats  *Statistics
+	logger zap.Logger
+}
+
+// NewService returns a configured backup service.
+func NewService(c Config) *Service {
+	var databases map[string]struct{}
+	if len(c.Databases) > 0 {
+		databases = make(map[string]struct{}, len(c.Databases))
+		for _, name := range c.Databases {
+			databases[name] = struct{}{}
+		}
+	}
+
+	return &Service{
+		destination:  c.Destination,
+		databases:    databases,
+		interval:     time.Duration(c.Interval),
+		incremental:  c.Mode == ModeIncremental,
+		fullInterval: time.Duration(c.FullInterval),
+		retain:       c.Retain,
+		done:         make(chan struct{}),
+		stats:        &Statistics{},
+		logger:       zap.New(zap.NullEncoder()),
+	}
+}
+
+// Open starts the backup schedule.
+func (s *Service) Open() error {
+	if err := os.MkdirAll(s.destination, 0700); err != nil {
+		return err
+	}
+
+	s.logger.Info(fmt.Sprintf("Starting backup service with interval of %s to %s", s.interval, s.destination))
+	s.wg.Add(1)
+	go s.run()
+	return nil
+}
+
+// Close stops the backup schedule, waiting for a running backup to finish.
+func (s *Service) Close() error {
+	s.logger.Info("backup service terminating")
+	close(s.done)
+	s.wg.Wait()
+	return nil
+}
+
+// WithLogger sets the logger on the service.
+func (s *Service) WithLogger(log zap.Logger) {
+	s.logger = log.With(zap.String("service", "backup"))
+}
+
+// Statistics maintains statistics for the backup service.
+type Statistics struct {
+	Backups        int64
+	BackupFailures int64
+	BackupDuration int64
+	BackupBytes    int64
+	BackupsPruned  int64
+}
+
+// Statistics returns statistics for periodic monitoring.
+func (s *Service) Statistics(tags map[string]string) []models.Statistic {
+	return []models.Statistic{{
+		Name: "backup",
+		Tags: tags,
+		Values: map[string]interface{}{
+			statBackups:        atomic.LoadInt64(&s.stats.Backups),
+			statBackupFailures: atomic.LoadInt64(&s.stats.BackupFailures),
+			statBackupDuration: atomic.LoadInt64(&s.stats.BackupDuration),
+			statBackupBytes:    atomic.LoadInt64(&s.stats.BackupBytes),
+			statBackupsPruned:  atomic.LoadInt64(&s.stats.BackupsPruned),
+		},
+	}}
+}
+
+func (s *Service) run() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+
+		case <-ticker.C:
+			s.backup(time.Now().UTC())
+		}
+	}
+}
+
+// backup takes a backup at now, then removes the oldest backups beyond the
+// number that are retained. A failed backup is retried on the next run.
+func (s *Service) backup(now time.Time) error {
+	full := !s.incremental || s.dir == "" || now.Sub(s.fullTime) >= s.fullInterval
+	kind := "full"
+	if !full {
+		kind = "incremental"
+	}
+
+	start := time.Now()
+	dir, n, err := s.write(now, full)
+	atomic.AddInt64(&s.stats.BackupDuration, time.Since(start).Nanoseconds())
+	if err != nil {
+		atomic.AddInt64(&s.stats.BackupFailures, 1)
+		s.logger.Info(fmt.Sprintf("%s backup to %s failed: %s", kind, dir, err))
+		return err
+	}
+	atomic.AddInt64(&s.stats.Backups, 1)
+	atomic.AddInt64(&s.stats.BackupBytes, n)
+	s.logger.Info(fmt.Sprintf("%s backup to %s complete: %d bytes in %s", kind, dir, n, time.Since(start)))
+
+	if full {
+		s.dir, s.fullTime = dir, now
+	}
+	s.last = now
+
+	if err := s.prune(); err != nil {
+		s.logger.Info(fmt.Sprintf("failed to remove old backups from %s: %s", s.destination, err))
+	}
+	return nil
+}
+
+// write writes the meta store and the shards to the directory of the backup
+// and returns the directory and the number of bytes written. A full backup is
+// written to a new directory that is removed again if the backup fails.
+func (s *Service) write(now time.Time, full bool) (string, int64, error) {
+	dir, since := s.dir, s.last
+	if full {
+		dir, since = filepath.Join(s.destination, now.Format(dirLayout)), time.Time{}
+		if err := os.Mkdir(dir, 0700); err != nil {
+			return dir, 0, err
+		}
+	}
+
+	n, err := s.writeFiles(dir, since)
+	if err != nil && full {
+		if rmErr := os.RemoveAll(dir); rmErr != nil {
+			s.logger.Info(fmt.Sprintf("failed to remove incomplete backup %s: %s", dir, rmErr))
+		}
+	}
+	return dir, n, err
+}
+
+// writeFiles writes the meta store and every local shard of the backed up
+// databases, with the files changed since the given time, to dir.
+func (s *Service) writeFiles(dir string, since time.Time) (int64, error) {
+	n, err := writeFile(filepath.Join(dir, metafile), s.Snapshotter.WriteMetastoreBackup)
+	if err != nil {
+		return 0, fmt.Errorf("back up meta store: %s", err)
+	}
+
+	local := make(map[uint64]struct{})
+	for _, id := range s.TSDBStore.ShardIDs() {
+		local[id] = struct{}{}
+	}
+
+	for _, db := range s.MetaClient.Databases() {
+		if s.databases != nil {
+			if _, ok := s.databases[db.Name]; !ok {
+				continue
+			}
+		}
+
+		for _, rp := range db.RetentionPolicies {
+			for _, sg := range rp.ShardGroups {
+				for _, sh := range sg.Shards {
+					if _, ok := local[sh.ID]; !ok {
+						continue
+					}
+
+					path := filepath.Join(dir, fmt.Sprintf(shardFilePattern, db.Name, rp.Name, sh.ID))
+					sz, err := writeFile(path, func(w io.Writer) error {
+						return s.TSDBStore.BackupShard(sh.ID, since, w)
+					})
+					if err != nil {
+						return n, fmt.Errorf("back up shard %d: %s", sh.ID, err)
+					}
+					n += sz
+				}
+			}
+		}
+	}
+	return n, nil
+}
+
+// prune removes the oldest backups in the destination beyond the number that
+// are retained.
+func (s *Service) prune() error {
+	if s.retain == 0 {
+		return nil
+	}
+
+	fis, err := ioutil.ReadDir(s.destination)
+	if err != nil {
+		return err
+	}
+
+	// Directories are read in order of their names, which is the order the
+	// backups were taken in.
+	var dirs []string
+	for _, fi := range fis {
+		if !fi.IsDir() {
+			continue
+		} else if _, err := time.Parse(dirLayout, fi.Name()); err != nil {
+			continue
+		}
+		dirs = append(dirs, filepath.Join(s.destination, fi.Name()))
+	}
+
+	for i := 0; i < len(dirs)-s.retain; i++ {
+		if dirs[i] == s.dir {
+			continue
+		}
+		if err := os.RemoveAll(dirs[i]); err != nil {
+			return err
+		}
+		atomic.AddInt64(&s.stats.BackupsPruned, 1)
+		s.logger.Info(fmt.Sprintf("removed backup %s", dirs[i]))
+	}
+	return nil
+}
+
+// writeFile writes a backup file with the next free increment of path and
+// returns its size. The file is written under a temporary name and renamed
+// once it is complete. An empty file is removed.
+func writeFile(path string, fn func(w io.Writer) error) (int64, error) {
+	path, err := nextPath(path)
+	if err != nil {
+		return 0, err
+	}
+
+	tmppath := path + pendingSuffix
+	f, err := os.OpenFile(tmppath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return 0, err
+	}
+
+	err = fn(f)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmppath)
+		return 0, err
+	}
+
+	fi, err := os.Stat(tmppath)
+	if err != nil {
+		return 0, err
+	}
+
+	// Nothing was written since the previous backup.
+	if fi.Size() == 0 {
+		return 0, os.Remove(tmppath)
+	}
+
+	if err := os.Rename(tmppath, path); err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
+
+// nextPath returns the first increment of path that does not exist yet.
+func nextPath(path string) (string, error) {
+	for i := 0; ; i++ {
+		s := fmt.Sprintf("%s.%02d", path, i)
+		if _, err := os.Stat(s); os.IsNotExist(err) {
+			return s, nil
+		} else if err != nil {
+			return "", err
+		}
+	}
+}
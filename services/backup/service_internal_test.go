@@ -0,0 +1,186 @@
+package backup
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/lucaswiersma/influxdb/services/meta"
+	"github.com/lucaswiersma/influxdb/toml"
+)
+
+func TestService_Backup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "influxdb-backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Date(2017, 6, 10, 0, 0, 0, 0, time.UTC)
+	hour := func(n int) time.Time { return now.Add(time.Duration(n) * time.Hour) }
+
+	store := &tsdbStore{ids: []uint64{1, 3}}
+	s := NewService(Config{
+		Destination:  dir,
+		Databases:    []string{"db0"},
+		Interval:     toml.Duration(time.Hour),
+		Mode:         ModeIncremental,
+		FullInterval: toml.Duration(2 * time.Hour),
+		Retain:       2,
+	})
+	s.MetaClient = &metaClient{dbs: []meta.DatabaseInfo{
+		{
+			Name: "db0",
+			RetentionPolicies: []meta.RetentionPolicyInfo{{
+				Name: "rp0",
+				ShardGroups: []meta.ShardGroupInfo{
+					{ID: 1, Shards: []meta.ShardInfo{{ID: 1}}},
+					// Not stored on this server.
+					{ID: 2, Shards: []meta.ShardInfo{{ID: 2}}},
+				},
+			}},
+		},
+		{
+			// Not backed up.
+			Name: "db1",
+			RetentionPolicies: []meta.RetentionPolicyInfo{{
+				Name:        "rp0",
+				ShardGroups: []meta.ShardGroupInfo{{ID: 3, Shards: []meta.ShardInfo{{ID: 3}}}},
+			}},
+		},
+	}}
+	s.TSDBStore = store
+	s.Snapshotter = snapshotter{}
+
+	// Full backups are taken every two hours with an incremental backup in
+	// between.
+	for i := 0; i <= 4; i++ {
+		if err := s.backup(hour(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if exp := []time.Time{{}, hour(0), {}, hour(2), {}}; !reflect.DeepEqual(store.since, exp) {
+		t.Fatalf("unexpected since times: got %v, exp %v", store.since, exp)
+	}
+
+	// Only the two newest backups are retained.
+	if got, exp := listFiles(t, dir), []string{
+		"20170610T020000Z/db0.rp0.00001.00",
+		"20170610T020000Z/db0.rp0.00001.01",
+		"20170610T020000Z/meta.00",
+		"20170610T020000Z/meta.01",
+		"20170610T040000Z/db0.rp0.00001.00",
+		"20170610T040000Z/meta.00",
+	}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("unexpected files: got %v, exp %v", got, exp)
+	}
+
+	if got, exp := s.stats.Backups, int64(5); got != exp {
+		t.Fatalf("unexpected backups: got %d, exp %d", got, exp)
+	} else if got, exp := s.stats.BackupsPruned, int64(1); got != exp {
+		t.Fatalf("unexpected pruned backups: got %d, exp %d", got, exp)
+	} else if got, exp := s.stats.BackupBytes, int64(5*len("meta")+5*len("shard")); got != exp {
+		t.Fatalf("unexpected backup bytes: got %d, exp %d", got, exp)
+	}
+}
+
+func TestService_Backup_Failure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "influxdb-backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Date(2017, 6, 10, 0, 0, 0, 0, time.UTC)
+
+	store := &tsdbStore{ids: []uint64{1}, err: errors.New("shard closed")}
+	s := NewService(Config{
+		Destination:  dir,
+		Interval:     toml.Duration(time.Hour),
+		Mode:         ModeIncremental,
+		FullInterval: toml.Duration(24 * time.Hour),
+	})
+	s.MetaClient = &metaClient{dbs: []meta.DatabaseInfo{{
+		Name: "db0",
+		RetentionPolicies: []meta.RetentionPolicyInfo{{
+			Name:        "rp0",
+			ShardGroups: []meta.ShardGroupInfo{{ID: 1, Shards: []meta.ShardInfo{{ID: 1}}}},
+		}},
+	}}}
+	s.TSDBStore = store
+	s.Snapshotter = snapshotter{}
+
+	// A failed full backup is removed.
+	if err := s.backup(now); err == nil {
+		t.Fatal("expected error")
+	} else if got := listFiles(t, dir); len(got) != 0 {
+		t.Fatalf("unexpected files: %v", got)
+	}
+
+	// The next backup is full again.
+	store.err = nil
+	if err := s.backup(now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	} else if exp := []time.Time{{}, {}}; !reflect.DeepEqual(store.since, exp) {
+		t.Fatalf("unexpected since times: got %v, exp %v", store.since, exp)
+	}
+
+	if got, exp := s.stats.Backups, int64(1); got != exp {
+		t.Fatalf("unexpected backups: got %d, exp %d", got, exp)
+	} else if got, exp := s.stats.BackupFailures, int64(1); got != exp {
+		t.Fatalf("unexpected backup failures: got %d, exp %d", got, exp)
+	}
+}
+
+// listFiles returns the paths of the files below dir, relative to dir.
+func listFiles(t *testing.T, dir string) []string {
+	var paths []string
+	if err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil || fi.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		paths = append(paths, filepath.ToSlash(rel))
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+type metaClient struct {
+	dbs []meta.DatabaseInfo
+}
+
+func (c *metaClient) Databases() []meta.DatabaseInfo { return c.dbs }
+
+type tsdbStore struct {
+	ids   []uint64
+	err   error
+	since []time.Time
+}
+
+func (s *tsdbStore) ShardIDs() []uint64 { return s.ids }
+func (s *tsdbStore) BackupShard(id uint64, since time.Time, w io.Writer) error {
+	s.since = append(s.since, since)
+	if s.err != nil {
+		return s.err
+	}
+	_, err := io.WriteString(w, "shard")
+	return err
+}
+
+type snapshotter struct{}
+
+func (snapshotter) WriteMetastoreBackup(w io.Writer) error {
+	_, err := io.WriteString(w, "meta")
+	return err
+}
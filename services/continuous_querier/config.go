@@ -12,6 +12,30 @@ import (
 const (
 	// The default value of how often to check whether any CQs need to be run.
 	DefaultRunInterval = time.Second
+
+	// DefaultMaxRetries is the default number of times a failed CQ run is
+	// retried before its window is skipped.
+	DefaultMaxRetries = 3
+
+	// DefaultRetryInterval is the default time to wait before the first retry
+	// of a failed CQ run. The wait doubles with every further retry.
+	DefaultRetryInterval = 5 * time.Second
+
+	// DefaultMaxRetryInterval is the default upper bound of the time to wait
+	// between retries.
+	DefaultMaxRetryInterval = time.Minute
+
+	// DefaultMaxConsecutiveFailures is the default number of consecutive
+	// failed runs after which a CQ is disabled. Zero never disables a CQ.
+	DefaultMaxConsecutiveFailures = 0
+
+	// DefaultCheckpointInterval is the default time between checkpoints of
+	// the progress of CQs in the meta store.
+	DefaultCheckpointInterval = time.Minute
+
+	// DefaultMaxCatchUp is the default longest time since its checkpoint that
+	// a CQ catches up on after a restart.
+	DefaultMaxCatchUp = time.Hour
 )
 
 // Config represents a configuration for the continuous query service.
@@ -27,6 +51,29 @@ type Config struct {
 	// every minute, this should be set to 1 minute. The default is set to '1s' so the interval
 	// is compatible with most aggregations.
 	RunInterval toml.Duration `toml:"run-interval"`
+
+	// MaxRetries is the number of times a failed run of a continuous query is
+	// retried before the next scheduled run. The wait between retries starts at
+	// RetryInterval and doubles on every retry, up to MaxRetryInterval.
+	MaxRetries       int           `toml:"max-retries"`
+	RetryInterval    toml.Duration `toml:"retry-interval"`
+	MaxRetryInterval toml.Duration `toml:"max-retry-interval"`
+
+	// MaxConsecutiveFailures is the number of consecutive failed runs after
+	// which a continuous query is disabled until it is run manually or the
+	// server restarts. Zero never disables a continuous query.
+	MaxConsecutiveFailures int `toml:"max-consecutive-failures"`
+
+	// CheckpointInterval is how often the last run of each continuous query
+	// is saved to the meta store, so that after a restart a continuous query
+	// resumes where it left off. Zero disables checkpoints.
+	CheckpointInterval toml.Duration `toml:"checkpoint-interval"`
+
+	// MaxCatchUp is the longest time since its checkpoint that a continuous
+	// query catches up on. An older checkpoint is ignored and only the latest
+	// window is computed, as if the continuous query had never run. Zero
+	// never ignores a checkpoint.
+	MaxCatchUp toml.Duration `toml:"max-catch-up"`
 }
 
 // NewConfig returns a new instance of Config with defaults.
@@ -35,6 +82,13 @@ func NewConfig() Config {
 		LogEnabled:  true,
 		Enabled:     true,
 		RunInterval: toml.Duration(DefaultRunInterval),
+
+		MaxRetries:             DefaultMaxRetries,
+		RetryInterval:          toml.Duration(DefaultRetryInterval),
+		MaxRetryInterval:       toml.Duration(DefaultMaxRetryInterval),
+		MaxConsecutiveFailures: DefaultMaxConsecutiveFailures,
+		CheckpointInterval:     toml.Duration(DefaultCheckpointInterval),
+		MaxCatchUp:             toml.Duration(DefaultMaxCatchUp),
 	}
 }
 
@@ -50,6 +104,25 @@ func (c Config) Validate() error {
 		return errors.New("run-interval must be positive")
 	}
 
+	if c.MaxRetries < 0 {
+		return errors.New("max-retries must be greater than or equal to 0")
+	} else if c.MaxRetries > 0 {
+		if c.RetryInterval <= 0 {
+			return errors.New("retry-interval must be positive")
+		} else if c.MaxRetryInterval < c.RetryInterval {
+			return errors.New("max-retry-interval must be greater than or equal to retry-interval")
+		}
+	}
+	if c.MaxConsecutiveFailures < 0 {
+		return errors.New("max-consecutive-failures must be greater than or equal to 0")
+	}
+	if c.CheckpointInterval < 0 {
+		return errors.New("checkpoint-interval must be greater than or equal to 0")
+	}
+	if c.MaxCatchUp < 0 {
+		return errors.New("max-catch-up must be greater than or equal to 0")
+	}
+
 	return nil
 }
 
@@ -62,7 +135,13 @@ func (c Config) Diagnostics() (*diagnostics.Diagnostics, error) {
 	}
 
 	return diagnostics.RowFromMap(map[string]interface{}{
-		"enabled":      true,
-		"run-interval": c.RunInterval,
+		"enabled":                  true,
+		"run-interval":             c.RunInterval,
+		"max-retries":              c.MaxRetries,
+		"retry-interval":           c.RetryInterval,
+		"max-retry-interval":       c.MaxRetryInterval,
+		"max-consecutive-failures": c.MaxConsecutiveFailures,
+		"checkpoint-interval":      c.CheckpointInterval,
+		"max-catch-up":             c.MaxCatchUp,
 	}), nil
 }
@@ -14,6 +14,12 @@ func TestConfig_Parse(t *testing.T) {
 	if _, err := toml.Decode(`
 run-interval = "1m"
 enabled = true
+max-retries = 5
+retry-interval = "10s"
+max-retry-interval = "5m"
+max-consecutive-failures = 20
+checkpoint-interval = "30s"
+max-catch-up = "2h"
 `, &c); err != nil {
 		t.Fatal(err)
 	}
@@ -23,6 +29,18 @@ enabled = true
 		t.Fatalf("unexpected run interval: %v", c.RunInterval)
 	} else if c.Enabled != true {
 		t.Fatalf("unexpected enabled: %v", c.Enabled)
+	} else if c.MaxRetries != 5 {
+		t.Fatalf("unexpected max retries: %d", c.MaxRetries)
+	} else if time.Duration(c.RetryInterval) != 10*time.Second {
+		t.Fatalf("unexpected retry interval: %v", c.RetryInterval)
+	} else if time.Duration(c.MaxRetryInterval) != 5*time.Minute {
+		t.Fatalf("unexpected max retry interval: %v", c.MaxRetryInterval)
+	} else if c.MaxConsecutiveFailures != 20 {
+		t.Fatalf("unexpected max consecutive failures: %d", c.MaxConsecutiveFailures)
+	} else if time.Duration(c.CheckpointInterval) != 30*time.Second {
+		t.Fatalf("unexpected checkpoint interval: %v", c.CheckpointInterval)
+	} else if time.Duration(c.MaxCatchUp) != 2*time.Hour {
+		t.Fatalf("unexpected max catch up: %v", c.MaxCatchUp)
 	}
 }
 
@@ -43,4 +61,34 @@ func TestConfig_Validate(t *testing.T) {
 	if err := c.Validate(); err == nil {
 		t.Fatal("expected error for negative run-interval, got nil")
 	}
+
+	c = continuous_querier.NewConfig()
+	c.MaxRetries = -1
+	if err := c.Validate(); err == nil {
+		t.Fatal("expected error for negative max-retries, got nil")
+	}
+
+	c = continuous_querier.NewConfig()
+	c.MaxRetryInterval = c.RetryInterval / 2
+	if err := c.Validate(); err == nil {
+		t.Fatal("expected error for max-retry-interval shorter than retry-interval, got nil")
+	}
+
+	c = continuous_querier.NewConfig()
+	c.MaxConsecutiveFailures = -1
+	if err := c.Validate(); err == nil {
+		t.Fatal("expected error for negative max-consecutive-failures, got nil")
+	}
+
+	c = continuous_querier.NewConfig()
+	c.CheckpointInterval = -1
+	if err := c.Validate(); err == nil {
+		t.Fatal("expected error for negative checkpoint-interval, got nil")
+	}
+
+	c = continuous_querier.NewConfig()
+	c.MaxCatchUp = -1
+	if err := c.Validate(); err == nil {
+		t.Fatal("expected error for negative max-catch-up, got nil")
+	}
 }
@@ -28,8 +28,13 @@ const (
 
 // Statistics for the CQ service.
 const (
-	statQueryOK   = "queryOk"
-	statQueryFail = "queryFail"
+	statQueryOK       = "queryOk"
+	statQueryFail     = "queryFail"
+	statQueryRetry    = "queryRetry"
+	statQueryDisabled = "queryDisabled"
+
+	statConsecutiveFailures = "consecutiveFailures"
+	statDisabled            = "disabled"
 )
 
 // ContinuousQuerier represents a service that executes continuous queries.
@@ -43,6 +48,7 @@ type metaClient interface {
 	AcquireLease(name string) (l *meta.Lease, err error)
 	Databases() []meta.DatabaseInfo
 	Database(name string) *meta.DatabaseInfo
+	SetContinuousQueryLastRuns(lastRuns map[string]map[string]time.Time) error
 }
 
 // RunRequest is a request to run one or more CQs.
@@ -81,8 +87,17 @@ type Service struct {
 	// lastRuns maps CQ name to last time it was run.
 	mu       sync.RWMutex
 	lastRuns map[string]time.Time
-	stop     chan struct{}
-	wg       *sync.WaitGroup
+
+	// checkpoints holds the last runs not yet saved to the meta store, by
+	// database and CQ name. It is protected by mu.
+	checkpoints map[string]map[string]time.Time
+
+	// failures maps CQ name to the failure state of CQs whose last run failed.
+	failMu   sync.Mutex
+	failures map[string]*queryFailure
+
+	stop chan struct{}
+	wg   *sync.WaitGroup
 }
 
 // NewService returns a new instance of Service.
@@ -95,6 +110,8 @@ func NewService(c Config) *Service {
 		Logger:         zap.New(zap.NullEncoder()),
 		stats:          &Statistics{},
 		lastRuns:       map[string]time.Time{},
+		checkpoints:    map[string]map[string]time.Time{},
+		failures:       map[string]*queryFailure{},
 	}
 
 	return s
@@ -137,20 +154,43 @@ func (s *Service) WithLogger(log zap.Logger) {
 
 // Statistics maintains the statistics for the continuous query service.
 type Statistics struct {
-	QueryOK   int64
-	QueryFail int64
+	QueryOK    int64
+	QueryFail  int64
+	QueryRetry int64
 }
 
-// Statistics returns statistics for periodic monitoring.
+// Statistics returns statistics for periodic monitoring. Besides the service
+// totals, a statistic is returned for every CQ whose last run failed.
 func (s *Service) Statistics(tags map[string]string) []models.Statistic {
-	return []models.Statistic{{
+	s.failMu.Lock()
+	defer s.failMu.Unlock()
+
+	var disabled int64
+	statistics := make([]models.Statistic, 0, len(s.failures)+1)
+	for _, f := range s.failures {
+		if f.disabled {
+			disabled++
+		}
+		statistics = append(statistics, models.Statistic{
+			Name: "cq_query",
+			Tags: models.StatisticTags{"database": f.database, "name": f.name}.Merge(tags),
+			Values: map[string]interface{}{
+				statConsecutiveFailures: int64(f.n),
+				statDisabled:            f.disabled,
+			},
+		})
+	}
+
+	return append([]models.Statistic{{
 		Name: "cq",
 		Tags: tags,
 		Values: map[string]interface{}{
-			statQueryOK:   atomic.LoadInt64(&s.stats.QueryOK),
-			statQueryFail: atomic.LoadInt64(&s.stats.QueryFail),
+			statQueryOK:       atomic.LoadInt64(&s.stats.QueryOK),
+			statQueryFail:     atomic.LoadInt64(&s.stats.QueryFail),
+			statQueryRetry:    atomic.LoadInt64(&s.stats.QueryRetry),
+			statQueryDisabled: disabled,
 		},
-	}}
+	}}, statistics...)
 }
 
 // Run runs the specified continuous query, or all CQs if none is specified.
@@ -172,15 +212,20 @@ func (s *Service) Run(database, name string, t time.Time) error {
 	// Loop through databases.
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	s.failMu.Lock()
+	defer s.failMu.Unlock()
 	for _, db := range dbs {
 		// Loop through CQs in each DB executing the ones that match name.
 		for _, cq := range db.ContinuousQueries {
 			if name == "" || cq.Name == name {
-				// Remove the last run time for the CQ
+				// Reset the last run time for the CQ. A zero time is stored
+				// so the checkpoint in the meta store is ignored as well.
 				id := fmt.Sprintf("%s%s%s", db.Name, idDelimiter, cq.Name)
-				if _, ok := s.lastRuns[id]; ok {
-					delete(s.lastRuns, id)
-				}
+				s.lastRuns[id] = time.Time{}
+
+				// Running a CQ manually also clears its failures, which
+				// re-enables it if it was disabled.
+				delete(s.failures, id)
 			}
 		}
 	}
@@ -197,10 +242,12 @@ func (s *Service) backgroundLoop() {
 	t := time.NewTimer(s.RunInterval)
 	defer t.Stop()
 	defer s.wg.Done()
+	var lastCheckpoint time.Time
 	for {
 		select {
 		case <-s.stop:
 			s.Logger.Info("continuous query service terminating")
+			s.checkpoint()
 			return
 		case req := <-s.RunCh:
 			if !s.hasContinuousQueries() {
@@ -220,9 +267,55 @@ func (s *Service) backgroundLoop() {
 			}
 			t.Reset(s.RunInterval)
 		}
+
+		// Save the progress of the CQs at most once per checkpoint interval
+		// so the meta store is not written after every run.
+		if s.Config.CheckpointInterval > 0 && time.Since(lastCheckpoint) >= time.Duration(s.Config.CheckpointInterval) {
+			s.checkpoint()
+			lastCheckpoint = time.Now()
+		}
 	}
 }
 
+// checkpoint saves the last runs of the CQs that ran since the previous
+// checkpoint to the meta store in a single commit.
+func (s *Service) checkpoint() {
+	s.mu.Lock()
+	checkpoints := s.checkpoints
+	s.checkpoints = map[string]map[string]time.Time{}
+	s.mu.Unlock()
+
+	if len(checkpoints) == 0 {
+		return
+	}
+
+	if err := s.MetaClient.SetContinuousQueryLastRuns(checkpoints); err != nil {
+		s.Logger.Info(fmt.Sprintf("error checkpointing continuous queries: %s", err))
+
+		// Keep the checkpoints for the next attempt unless a CQ has run again.
+		s.mu.Lock()
+		for database, cqs := range checkpoints {
+			for name, t := range cqs {
+				if _, ok := s.checkpoints[database][name]; !ok {
+					s.setCheckpoint(database, name, t)
+				}
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// setCheckpoint records the last run of a CQ to be saved by the next
+// checkpoint. s.mu must be held.
+func (s *Service) setCheckpoint(database, name string, t time.Time) {
+	cqs := s.checkpoints[database]
+	if cqs == nil {
+		cqs = make(map[string]time.Time)
+		s.checkpoints[database] = cqs
+	}
+	cqs[name] = t
+}
+
 // hasContinuousQueries returns true if any CQs exist.
 func (s *Service) hasContinuousQueries() bool {
 	// Get list of all databases.
@@ -240,10 +333,12 @@ func (s *Service) hasContinuousQueries() bool {
 func (s *Service) runContinuousQueries(req *RunRequest) {
 	// Get list of all databases.
 	dbs := s.MetaClient.Databases()
+	ids := make(map[string]struct{})
 	// Loop through all databases executing CQs.
 	for _, db := range dbs {
 		// TODO: distribute across nodes
 		for _, cq := range db.ContinuousQueries {
+			ids[fmt.Sprintf("%s%s%s", db.Name, idDelimiter, cq.Name)] = struct{}{}
 			if !req.matches(&cq) {
 				continue
 			}
@@ -255,6 +350,15 @@ func (s *Service) runContinuousQueries(req *RunRequest) {
 			}
 		}
 	}
+
+	// Forget the failures of CQs that have been dropped.
+	s.failMu.Lock()
+	for id := range s.failures {
+		if _, ok := ids[id]; !ok {
+			delete(s.failures, id)
+		}
+	}
+	s.failMu.Unlock()
 }
 
 // ExecuteContinuousQuery may execute a single CQ. This will return false if there were no errors and the CQ was not run.
@@ -268,11 +372,29 @@ func (s *Service) ExecuteContinuousQuery(dbi *meta.DatabaseInfo, cqi *meta.Conti
 		return false, err
 	}
 
-	// Get the last time this CQ was run from the service's cache.
+	// Get the last time this CQ was run from the service's cache. If the
+	// service has not run the CQ since it started, resume from the checkpoint
+	// stored in the meta store.
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	id := fmt.Sprintf("%s%s%s", dbi.Name, idDelimiter, cqi.Name)
-	cq.LastRun, cq.HasRun = s.lastRuns[id]
+
+	// Skip disabled CQs and CQs waiting to be retried.
+	if !s.ready(id, now) {
+		return false, nil
+	}
+
+	prevLastRun, hasPrevLastRun := s.lastRuns[id]
+	if lastRun, ok := s.lastRuns[id]; ok {
+		cq.LastRun, cq.HasRun = lastRun, !lastRun.IsZero()
+	} else if s.Config.CheckpointInterval > 0 && !cqi.LastRun.IsZero() {
+		// Ignore a checkpoint that is too old so that a long outage does not
+		// turn into one huge query.
+		maxCatchUp := time.Duration(s.Config.MaxCatchUp)
+		if maxCatchUp == 0 || now.Sub(cqi.LastRun) <= maxCatchUp {
+			cq.LastRun, cq.HasRun = cqi.LastRun, true
+		}
+	}
 
 	// Set the retention policy to default if it wasn't specified in the query.
 	if cq.intoRP() == "" {
@@ -350,15 +472,99 @@ func (s *Service) ExecuteContinuousQuery(dbi *meta.DatabaseInfo, cqi *meta.Conti
 	// Do the actual processing of the query & writing of results.
 	if err := s.runContinuousQueryAndWriteResult(cq); err != nil {
 		s.Logger.Info(fmt.Sprintf("error: %s. running: %s\n", err, cq.q.String()))
+
+		// Restore the last run time if the window is retried so the next
+		// run covers it again.
+		if s.queryFailed(dbi.Name, cqi.Name, id, now) {
+			if hasPrevLastRun {
+				s.lastRuns[id] = prevLastRun
+			} else {
+				delete(s.lastRuns, id)
+			}
+		}
 		return false, err
 	}
+	s.querySucceeded(id)
 
 	if s.loggingEnabled {
 		s.Logger.Info(fmt.Sprintf("finished continuous query %s (%v to %v) in %s", cq.Info.Name, startTime, endTime, time.Since(start)))
 	}
+
+	// Checkpoint the window so a restart resumes after it.
+	if s.Config.CheckpointInterval > 0 {
+		s.setCheckpoint(dbi.Name, cqi.Name, cq.LastRun)
+	}
 	return true, nil
 }
 
+// queryFailure is the failure state of a CQ whose last run failed.
+type queryFailure struct {
+	database, name string
+
+	// n is the number of consecutive failed runs and retries is the number
+	// of times the current window has been retried.
+	n       int
+	retries int
+
+	// retryAt is the earliest time the failed window is retried.
+	retryAt time.Time
+
+	// disabled is set once the CQ has failed too many times in a row.
+	disabled bool
+}
+
+// ready returns true if the CQ is neither disabled nor waiting to be retried.
+func (s *Service) ready(id string, now time.Time) bool {
+	s.failMu.Lock()
+	defer s.failMu.Unlock()
+	f := s.failures[id]
+	return f == nil || (!f.disabled && !now.Before(f.retryAt))
+}
+
+// queryFailed records a failed run of a CQ and returns true if the failed
+// window should be retried. The CQ is disabled once it has failed
+// MaxConsecutiveFailures times in a row.
+func (s *Service) queryFailed(database, name, id string, now time.Time) bool {
+	s.failMu.Lock()
+	defer s.failMu.Unlock()
+
+	f := s.failures[id]
+	if f == nil {
+		f = &queryFailure{database: database, name: name}
+		s.failures[id] = f
+	}
+	f.n++
+
+	if max := s.Config.MaxConsecutiveFailures; max > 0 && f.n >= max {
+		f.disabled = true
+		s.Logger.Error(fmt.Sprintf("continuous query %s on %s disabled after %d consecutive failures", name, database, f.n))
+		return false
+	}
+
+	if f.retries >= s.Config.MaxRetries {
+		// Give up on the window and wait for the next scheduled run.
+		f.retries, f.retryAt = 0, time.Time{}
+		return false
+	}
+
+	f.retries++
+	wait := time.Duration(s.Config.RetryInterval) << uint(f.retries-1)
+	if max := time.Duration(s.Config.MaxRetryInterval); wait > max || wait <= 0 {
+		wait = max
+	}
+	f.retryAt = now.Add(wait)
+	atomic.AddInt64(&s.stats.QueryRetry, 1)
+	s.Logger.Info(fmt.Sprintf("retrying continuous query %s on %s in %s (retry %d of %d)", name, database, wait, f.retries, s.Config.MaxRetries))
+	return true
+}
+
+// querySucceeded clears the failures of a CQ after a successful run.
+func (s *Service) querySucceeded(id string) {
+	s.failMu.Lock()
+	delete(s.failures, id)
+	s.failMu.Unlock()
+}
+
 // runContinuousQueryAndWriteResult will run the query against the cluster and write the results back in
 func (s *Service) runContinuousQueryAndWriteResult(cq *ContinuousQuery) error {
 	// Wrap the CQ's inner SELECT statement in a Query for the QueryExecutor.
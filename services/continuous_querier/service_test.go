@@ -10,6 +10,7 @@ import (
 
 	"github.com/lucaswiersma/influxdb/influxql"
 	"github.com/lucaswiersma/influxdb/services/meta"
+	"github.com/lucaswiersma/influxdb/toml"
 	"go.uber.org/zap"
 )
 
@@ -376,6 +377,187 @@ func TestExecuteContinuousQuery_QueryExecutor_Error(t *testing.T) {
 	}
 }
 
+// Test ExecuteContinuousQuery retries a failed window and disables a CQ that
+// keeps failing.
+func TestExecuteContinuousQuery_Retry(t *testing.T) {
+	s := NewTestService(t)
+	s.Config.MaxRetries = 1
+	s.Config.RetryInterval = toml.Duration(time.Minute)
+	s.Config.MaxConsecutiveFailures = 3
+
+	var min time.Time
+	s.QueryExecutor.StatementExecutor = &StatementExecutor{
+		ExecuteStatementFn: func(stmt influxql.Statement, ctx influxql.ExecutionContext) error {
+			min, _, _ = influxql.TimeRange(stmt.(*influxql.SelectStatement).Condition)
+			return errExpected
+		},
+	}
+
+	dbis := s.MetaClient.Databases()
+	dbi := dbis[1]
+	cqi := dbi.ContinuousQueries[0]
+	cqi.LastRun = time.Now().UTC().Truncate(10 * time.Minute)
+	now := cqi.LastRun.Add(time.Minute)
+
+	if _, err := s.ExecuteContinuousQuery(&dbi, &cqi, now); err != errExpected {
+		t.Fatalf("exp = %s, got = %v", errExpected, err)
+	}
+	first := min
+
+	// The failed window is not retried before the retry interval.
+	if ok, err := s.ExecuteContinuousQuery(&dbi, &cqi, now.Add(time.Second)); err != nil || ok {
+		t.Fatalf("unexpected retry: ok=%v, err=%v", ok, err)
+	}
+
+	// The retry covers the failed window again.
+	min = time.Time{}
+	if _, err := s.ExecuteContinuousQuery(&dbi, &cqi, now.Add(time.Minute)); err != errExpected {
+		t.Fatalf("exp = %s, got = %v", errExpected, err)
+	} else if !min.Equal(first) {
+		t.Fatalf("unexpected retry window: got %s, exp %s", min, first)
+	}
+
+	// Retries are exhausted so the next failure is not retried and the third
+	// consecutive failure disables the CQ.
+	if _, err := s.ExecuteContinuousQuery(&dbi, &cqi, now.Add(3*time.Minute)); err != errExpected {
+		t.Fatalf("exp = %s, got = %v", errExpected, err)
+	}
+	if ok, err := s.ExecuteContinuousQuery(&dbi, &cqi, now.Add(time.Hour)); err != nil || ok {
+		t.Fatalf("unexpected run of disabled query: ok=%v, err=%v", ok, err)
+	}
+
+	stats := s.Statistics(nil)
+	if got, exp := stats[0].Values[statQueryRetry], int64(1); got != exp {
+		t.Fatalf("unexpected retries: got %v, exp %v", got, exp)
+	} else if got, exp := stats[0].Values[statQueryDisabled], int64(1); got != exp {
+		t.Fatalf("unexpected disabled queries: got %v, exp %v", got, exp)
+	} else if len(stats) != 2 || stats[1].Tags["name"] != "cq2" || stats[1].Values[statConsecutiveFailures] != int64(3) {
+		t.Fatalf("unexpected query statistics: %v", stats[1:])
+	}
+}
+
+// Test ExecuteContinuousQuery resumes from the checkpoint in the meta store.
+func TestExecuteContinuousQuery_Checkpoint(t *testing.T) {
+	s := NewTestService(t)
+
+	now := time.Now().UTC().Truncate(10 * time.Minute)
+	var min, max time.Time
+	s.QueryExecutor.StatementExecutor = &StatementExecutor{
+		ExecuteStatementFn: func(stmt influxql.Statement, ctx influxql.ExecutionContext) error {
+			var err error
+			min, max, err = influxql.TimeRange(stmt.(*influxql.SelectStatement).Condition)
+			if err != nil {
+				t.Errorf("unexpected error parsing time range: %s", err)
+			}
+			ctx.Results <- &influxql.Result{}
+			return nil
+		},
+	}
+
+	dbis := s.MetaClient.Databases()
+	dbi := dbis[1]
+	cqi := dbi.ContinuousQueries[0]
+	cqi.LastRun = now.Add(-3 * time.Minute)
+
+	if ok, err := s.ExecuteContinuousQuery(&dbi, &cqi, now); err != nil {
+		t.Fatal(err)
+	} else if !ok {
+		t.Fatal("expected continuous query to run")
+	}
+
+	// The missed windows since the checkpoint are processed.
+	if exp := now.Add(-3 * time.Minute); !min.Equal(exp) {
+		t.Fatalf("unexpected min time: got %s, exp %s", min, exp)
+	} else if exp := now.Add(-1); !max.Equal(exp) {
+		t.Fatalf("unexpected max time: got %s, exp %s", max, exp)
+	}
+
+	// The new checkpoint is only stored in the meta store by the next checkpoint.
+	if got := s.MetaClient.Database("db2").ContinuousQueries[0].LastRun; !got.IsZero() {
+		t.Fatalf("unexpected checkpoint before flush: %s", got)
+	}
+	s.checkpoint()
+	if got := s.MetaClient.Database("db2").ContinuousQueries[0].LastRun; !got.Equal(now) {
+		t.Fatalf("unexpected checkpoint: got %s, exp %s", got, now)
+	}
+}
+
+// Test the checkpoints of several CQ runs are saved in a single meta store commit.
+func TestExecuteContinuousQuery_Checkpoint_Batch(t *testing.T) {
+	s := NewTestService(t)
+	s.QueryExecutor.StatementExecutor = &StatementExecutor{
+		ExecuteStatementFn: func(stmt influxql.Statement, ctx influxql.ExecutionContext) error {
+			ctx.Results <- &influxql.Result{}
+			return nil
+		},
+	}
+
+	now := time.Now().UTC().Truncate(10 * time.Minute)
+	for _, dbi := range s.MetaClient.Databases() {
+		for _, cqi := range dbi.ContinuousQueries {
+			for i := 0; i < 3; i++ {
+				if _, err := s.ExecuteContinuousQuery(&dbi, &cqi, now.Add(time.Duration(i)*time.Minute)); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+	}
+
+	ms := s.MetaClient.(*MetaClient)
+	if ms.CheckpointN != 0 {
+		t.Fatalf("unexpected checkpoints before flush: %d", ms.CheckpointN)
+	}
+	s.checkpoint()
+	if ms.CheckpointN != 1 {
+		t.Fatalf("unexpected checkpoints: %d", ms.CheckpointN)
+	}
+	for _, dbi := range s.MetaClient.Databases() {
+		for _, cqi := range dbi.ContinuousQueries {
+			if exp := now.Add(2 * time.Minute); !cqi.LastRun.Equal(exp) {
+				t.Fatalf("unexpected checkpoint for %s: got %s, exp %s", cqi.Name, cqi.LastRun, exp)
+			}
+		}
+	}
+
+	// Nothing is written when no CQ ran since the last checkpoint.
+	s.checkpoint()
+	if ms.CheckpointN != 1 {
+		t.Fatalf("unexpected checkpoints: %d", ms.CheckpointN)
+	}
+}
+
+// Test a checkpoint older than max-catch-up is ignored.
+func TestExecuteContinuousQuery_Checkpoint_MaxCatchUp(t *testing.T) {
+	s := NewTestService(t)
+	s.Config.MaxCatchUp = toml.Duration(time.Hour)
+
+	var min time.Time
+	s.QueryExecutor.StatementExecutor = &StatementExecutor{
+		ExecuteStatementFn: func(stmt influxql.Statement, ctx influxql.ExecutionContext) error {
+			min, _, _ = influxql.TimeRange(stmt.(*influxql.SelectStatement).Condition)
+			ctx.Results <- &influxql.Result{}
+			return nil
+		},
+	}
+
+	dbis := s.MetaClient.Databases()
+	dbi := dbis[1]
+	cqi := dbi.ContinuousQueries[0]
+	now := time.Now().UTC().Truncate(10 * time.Minute)
+	cqi.LastRun = now.Add(-24 * time.Hour)
+
+	if ok, err := s.ExecuteContinuousQuery(&dbi, &cqi, now); err != nil {
+		t.Fatal(err)
+	} else if !ok {
+		t.Fatal("expected continuous query to run")
+	}
+
+	// Only the latest window is computed.
+	if exp := now.Add(-time.Minute); !min.Equal(exp) {
+		t.Fatalf("unexpected min time: got %s, exp %s", min, exp)
+	}
+}
+
 // NewTestService returns a new *Service with default mock object members.
 func NewTestService(t *testing.T) *Service {
 	s := NewService(NewConfig())
@@ -412,6 +594,9 @@ type MetaClient struct {
 	Err           error
 	t             *testing.T
 	nodeID        uint64
+
+	// CheckpointN is the number of calls to SetContinuousQueryLastRuns.
+	CheckpointN int
 }
 
 // NewMetaClient returns a *MetaClient.
@@ -517,6 +702,34 @@ func (ms *MetaClient) CreateContinuousQuery(database, name, query string) error
 	return nil
 }
 
+// SetContinuousQueryLastRuns records the last run times of CQs.
+func (ms *MetaClient) SetContinuousQueryLastRuns(lastRuns map[string]map[string]time.Time) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if ms.Err != nil {
+		return ms.Err
+	}
+	ms.CheckpointN++
+
+	for database, times := range lastRuns {
+		dbi := ms.database(database)
+		if dbi == nil {
+			continue
+		}
+
+		// Copy the CQs so callers iterating over a previous copy are not modified.
+		cqs := make([]meta.ContinuousQueryInfo, len(dbi.ContinuousQueries))
+		copy(cqs, dbi.ContinuousQueries)
+		for i := range cqs {
+			if t, ok := times[cqs[i].Name]; ok {
+				cqs[i].LastRun = t
+			}
+		}
+		dbi.ContinuousQueries = cqs
+	}
+	return nil
+}
+
 // StatementExecutor is a mock statement executor.
 type StatementExecutor struct {
 	ExecuteStatementFn func(stmt influxql.Statement, ctx influxql.ExecutionContext) error
@@ -48,6 +48,9 @@ const (
 	//     Linux:      sudo sysctl -w net.core.rmem_max=<read-buffer>
 	//     BSD/Darwin: sudo sysctl -w kern.ipc.maxsockbuf=<read-buffer>
 	DefaultUDPReadBuffer = 0
+
+	// DefaultCertificate is the default location of the certificate used when TLS is enabled.
+	DefaultCertificate = "/etc/ssl/influxdb.pem"
 )
 
 // Config represents the configuration for Graphite endpoints.
@@ -65,6 +68,14 @@ type Config struct {
 	Tags             []string      `toml:"tags"`
 	Separator        string        `toml:"separator"`
 	UDPReadBuffer    int           `toml:"udp-read-buffer"`
+
+	// TLSEnabled accepts TLS connections on a TCP listener. The private key
+	// is read from the certificate file unless PrivateKey is set. If ClientCA
+	// is set, clients must present a certificate signed by it.
+	TLSEnabled  bool   `toml:"tls-enabled"`
+	Certificate string `toml:"certificate"`
+	PrivateKey  string `toml:"private-key"`
+	ClientCA    string `toml:"client-ca"`
 }
 
 // NewConfig returns a new instance of Config with defaults.
@@ -78,6 +89,7 @@ func NewConfig() Config {
 		BatchTimeout:     toml.Duration(DefaultBatchTimeout),
 		ConsistencyLevel: DefaultConsistencyLevel,
 		Separator:        DefaultSeparator,
+		Certificate:      DefaultCertificate,
 	}
 }
 
@@ -112,6 +124,9 @@ func (c *Config) WithDefaults() *Config {
 	if d.UDPReadBuffer == 0 {
 		d.UDPReadBuffer = DefaultUDPReadBuffer
 	}
+	if d.Certificate == "" {
+		d.Certificate = DefaultCertificate
+	}
 	return &d
 }
 
@@ -135,6 +150,10 @@ func (c *Config) Validate() error {
 		return err
 	}
 
+	if c.TLSEnabled && c.Protocol != "" && strings.ToLower(c.Protocol) != "tcp" {
+		return fmt.Errorf("tls-enabled requires the tcp protocol, not %s", c.Protocol)
+	}
+
 	return nil
 }
 
@@ -261,7 +280,7 @@ type Configs []Config
 // Diagnostics returns one set of diagnostics for all of the Configs.
 func (c Configs) Diagnostics() (*diagnostics.Diagnostics, error) {
 	d := &diagnostics.Diagnostics{
-		Columns: []string{"enabled", "bind-address", "protocol", "database", "retention-policy", "batch-size", "batch-pending", "batch-timeout"},
+		Columns: []string{"enabled", "bind-address", "protocol", "database", "retention-policy", "batch-size", "batch-pending", "batch-timeout", "tls-enabled"},
 	}
 
 	for _, cc := range c {
@@ -270,7 +289,7 @@ func (c Configs) Diagnostics() (*diagnostics.Diagnostics, error) {
 			continue
 		}
 
-		r := []interface{}{true, cc.BindAddress, cc.Protocol, cc.Database, cc.RetentionPolicy, cc.BatchSize, cc.BatchPending, cc.BatchTimeout}
+		r := []interface{}{true, cc.BindAddress, cc.Protocol, cc.Database, cc.RetentionPolicy, cc.BatchSize, cc.BatchPending, cc.BatchTimeout, cc.TLSEnabled}
 		d.AddRow(r)
 	}
 
@@ -168,3 +168,15 @@ func TestConfigValidateFilterDuplicates(t *testing.T) {
 	}
 
 }
+
+func TestConfigValidateTLS(t *testing.T) {
+	c := &graphite.Config{Protocol: "tcp", TLSEnabled: true}
+	if err := c.Validate(); err != nil {
+		t.Errorf("config validate unexpected error: %s", err)
+	}
+
+	c.Protocol = "udp"
+	if err := c.Validate(); err == nil {
+		t.Errorf("config validate expected error. got nil")
+	}
+}
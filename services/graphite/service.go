@@ -3,6 +3,7 @@ package graphite // import "github.com/lucaswiersma/influxdb/services/graphite"
 
 import (
 	"bufio"
+	"crypto/tls"
 	"fmt"
 	"math"
 	"net"
@@ -13,6 +14,7 @@ import (
 
 	"github.com/lucaswiersma/influxdb/models"
 	"github.com/lucaswiersma/influxdb/monitor/diagnostics"
+	"github.com/lucaswiersma/influxdb/pkg/tlsconfig"
 	"github.com/lucaswiersma/influxdb/services/meta"
 	"github.com/lucaswiersma/influxdb/tsdb"
 	"go.uber.org/zap"
@@ -53,6 +55,11 @@ type Service struct {
 	batchTimeout    time.Duration
 	udpReadBuffer   int
 
+	tls         bool
+	certificate string
+	privateKey  string
+	clientCA    string
+
 	batcher *tsdb.PointBatcher
 	parser  *Parser
 
@@ -103,6 +110,10 @@ func NewService(c Config) (*Service, error) {
 		batchPending:    d.BatchPending,
 		udpReadBuffer:   d.UDPReadBuffer,
 		batchTimeout:    time.Duration(d.BatchTimeout),
+		tls:             d.TLSEnabled,
+		certificate:     d.Certificate,
+		privateKey:      d.PrivateKey,
+		clientCA:        d.ClientCA,
 		logger:          zap.New(zap.NullEncoder()),
 		stats:           &Statistics{},
 		defaultTags:     models.StatisticTags{"proto": d.Protocol, "bind": d.BindAddress},
@@ -159,7 +170,11 @@ func (s *Service) Open() error {
 		return err
 	}
 
-	s.logger.Info(fmt.Sprintf("Listening on %s: %s", strings.ToUpper(s.protocol), s.addr.String()))
+	if s.tls {
+		s.logger.Info(fmt.Sprintf("Listening on TLS: %s", s.addr.String()))
+	} else {
+		s.logger.Info(fmt.Sprintf("Listening on %s: %s", strings.ToUpper(s.protocol), s.addr.String()))
+	}
 	return nil
 }
 func (s *Service) closeAllConnections() {
@@ -297,10 +312,21 @@ func (s *Service) Addr() net.Addr {
 
 // openTCPServer opens the Graphite input in TCP mode and starts processing data.
 func (s *Service) openTCPServer() (net.Addr, error) {
+	var config *tls.Config
+	if s.tls {
+		var err error
+		if config, err = tlsconfig.New(s.certificate, s.privateKey, s.clientCA); err != nil {
+			return nil, err
+		}
+	}
+
 	ln, err := net.Listen("tcp", s.bindAddress)
 	if err != nil {
 		return nil, err
 	}
+	if config != nil {
+		ln = tls.NewListener(ln, config)
+	}
 	s.ln = ln
 
 	s.wg.Add(1)
@@ -1,6 +1,7 @@
 package graphite
 
 import (
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"net"
@@ -194,6 +195,75 @@ func Test_Service_TCP(t *testing.T) {
 	wg.Wait()
 }
 
+func Test_Service_TCP_TLS(t *testing.T) {
+	t.Parallel()
+
+	files, err := internal.NewTLSFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer files.Close()
+
+	now := time.Now().UTC().Round(time.Second)
+
+	config := Config{}
+	config.Database = "graphitedb"
+	config.BatchSize = 0 // No batching.
+	config.BatchTimeout = toml.Duration(time.Second)
+	config.BindAddress = "127.0.0.1:0"
+	config.TLSEnabled = true
+	config.Certificate = files.Certificate
+	config.PrivateKey = files.PrivateKey
+	config.ClientCA = files.CA
+
+	service := NewTestService(&config)
+
+	// Allow test to wait until points are written.
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	service.WritePointsFn = func(database, retentionPolicy string, consistencyLevel models.ConsistencyLevel, points []models.Point) error {
+		defer wg.Done()
+
+		if len(points) != 1 {
+			t.Fatalf("expected 1 point, got %d", len(points))
+		} else if exp := fmt.Sprintf("cpu value=23.456 %d", now.UnixNano()); points[0].String() != exp {
+			t.Fatalf("expected point %v, got %v", exp, points[0].String())
+		}
+		return nil
+	}
+
+	if err := service.Service.Open(); err != nil {
+		t.Fatalf("failed to open Graphite service: %s", err.Error())
+	}
+	defer service.Service.Close()
+
+	// Clients without a certificate are rejected.
+	conn, err := tls.Dial("tcp", service.Service.Addr().String(), files.ClientConfig(false))
+	if err == nil {
+		_, err = conn.Write([]byte(fmt.Sprintf("cpu 23.456 %d\n", now.Unix())))
+		if err == nil {
+			_, err = conn.Read(make([]byte, 1))
+		}
+		conn.Close()
+	}
+	if err == nil {
+		t.Fatal("expected handshake error")
+	}
+
+	conn, err = tls.Dial("tcp", service.Service.Addr().String(), files.ClientConfig(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = conn.Write([]byte(fmt.Sprintf("cpu 23.456 %d\n", now.Unix())))
+	conn.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wg.Wait()
+}
+
 func Test_Service_UDP(t *testing.T) {
 	t.Parallel()
 
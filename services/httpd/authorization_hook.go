@@ -0,0 +1,108 @@
+package httpd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// Actions sent to an external authorization hook.
+const (
+	AuthorizationActionQuery = "query"
+	AuthorizationActionWrite = "write"
+)
+
+// ErrAuthorizationHookDenied is returned when an external authorization hook
+// denies a request without giving a reason.
+var ErrAuthorizationHookDenied = errors.New("denied by authorization hook")
+
+// AuthorizationHookRequest is the JSON body sent to an external authorization hook.
+type AuthorizationHookRequest struct {
+	User      string `json:"user"`
+	Database  string `json:"database"`
+	Action    string `json:"action"`
+	Statement string `json:"statement,omitempty"`
+}
+
+// AuthorizationHookResponse is the JSON body expected back from an external
+// authorization hook.
+type AuthorizationHookResponse struct {
+	Allow  bool   `json:"allow"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// AuthorizationHook asks an external HTTP endpoint, such as a policy engine,
+// whether a query or write should be allowed to proceed.
+type AuthorizationHook struct {
+	URL string
+
+	// FailOpen allows requests through when the hook cannot be reached or
+	// returns an unexpected response. Otherwise those requests are denied.
+	FailOpen bool
+
+	client *http.Client
+}
+
+// NewAuthorizationHook returns a new AuthorizationHook that posts to url.
+func NewAuthorizationHook(url string, timeout time.Duration, failOpen bool) *AuthorizationHook {
+	return &AuthorizationHook{
+		URL:      url,
+		FailOpen: failOpen,
+		client:   &http.Client{Timeout: timeout},
+	}
+}
+
+// Authorize returns nil if the hook allows the request.
+func (a *AuthorizationHook) Authorize(req AuthorizationHookRequest) error {
+	resp, err := a.call(req)
+	if err != nil {
+		if a.FailOpen {
+			return nil
+		}
+		return fmt.Errorf("authorization hook: %s", err)
+	}
+
+	if !resp.Allow {
+		if resp.Reason != "" {
+			return fmt.Errorf("%s: %s", ErrAuthorizationHookDenied, resp.Reason)
+		}
+		return ErrAuthorizationHookDenied
+	}
+	return nil
+}
+
+func (a *AuthorizationHook) call(req AuthorizationHookRequest) (*AuthorizationHookResponse, error) {
+	b, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := a.client.Post(a.URL, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusForbidden, http.StatusUnauthorized:
+		// Treat an explicit rejection as a denial even without a body.
+		return &AuthorizationHookResponse{}, nil
+	default:
+		return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	var ar AuthorizationHookResponse
+	if err := json.NewDecoder(resp.Body).Decode(&ar); err != nil {
+		return nil, fmt.Errorf("invalid response: %s", err)
+	}
+	return &ar, nil
+}
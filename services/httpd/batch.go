@@ -0,0 +1,180 @@
+package httpd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/lucaswiersma/influxdb/influxql"
+	"github.com/lucaswiersma/influxdb/services/meta"
+)
+
+// BatchQueryRequest is the body of a request to /query/batch. Each query is a
+// single SELECT statement. Queries that differ only in the aggregates they
+// select, such as the panels of a dashboard that graph different fields of
+// the same measurement over the same time range, are executed together and
+// their aggregates are computed from a single scan of the data.
+type BatchQueryRequest struct {
+	// Database is the database queries without one in their sources read.
+	Database string `json:"db"`
+
+	// Epoch returns the timestamps of the results as epoch times in this
+	// precision, the same as the epoch parameter of /query.
+	Epoch string `json:"epoch,omitempty"`
+
+	// Queries are the queries of the batch.
+	Queries []string `json:"queries"`
+}
+
+// serveQueryBatch executes a batch of queries and returns a result for each
+// query, in the order of the queries. The statement_id of each result is the
+// position of its query in the batch.
+func (h *Handler) serveQueryBatch(w http.ResponseWriter, r *http.Request, user *meta.UserInfo) {
+	atomic.AddInt64(&h.stats.QueryRequests, 1)
+	atomic.AddInt64(&h.stats.QueryBatchRequests, 1)
+	defer func(start time.Time) {
+		atomic.AddInt64(&h.stats.QueryRequestDuration, time.Since(start).Nanoseconds())
+	}(time.Now())
+
+	// Retrieve the underlying ResponseWriter or initialize our own.
+	rw, ok := w.(ResponseWriter)
+	if !ok {
+		rw = NewResponseWriter(w, r)
+	}
+
+	var req BatchQueryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.httpError(rw, "error parsing batch: "+err.Error(), http.StatusBadRequest)
+		return
+	} else if len(req.Queries) == 0 {
+		h.httpError(rw, "batch has no queries", http.StatusBadRequest)
+		return
+	}
+
+	query := &influxql.Query{}
+	for i, s := range req.Queries {
+		q, err := influxql.ParseQuery(s)
+		if err != nil {
+			h.httpError(rw, fmt.Sprintf("error parsing query %d: %s", i, err), http.StatusBadRequest)
+			return
+		} else if len(q.Statements) != 1 {
+			h.httpError(rw, fmt.Sprintf("query %d must have a single statement", i), http.StatusBadRequest)
+			return
+		}
+
+		stmt, ok := q.Statements[0].(*influxql.SelectStatement)
+		if !ok || stmt.Target != nil {
+			h.httpError(rw, fmt.Sprintf("query %d must be a SELECT statement without INTO", i), http.StatusBadRequest)
+			return
+		}
+		query.Statements = append(query.Statements, stmt)
+	}
+
+	// Check authorization.
+	if h.Config.AuthEnabled {
+		if err := h.QueryAuthorizer.AuthorizeQuery(user, query, req.Database); err != nil {
+			if err, ok := err.(meta.ErrAuthorize); ok {
+				h.Logger.Info(fmt.Sprintf("Unauthorized request | user: %q | query: %q | database %q", err.User, err.Query.String(), err.Database))
+			}
+			h.httpError(rw, "error authorizing query: "+err.Error(), http.StatusForbidden)
+			return
+		}
+	}
+
+	if h.AuthorizationHook != nil {
+		if err := h.authorizeWithHook(user, req.Database, AuthorizationActionQuery, query.String()); err != nil {
+			h.httpError(rw, "error authorizing query: "+err.Error(), http.StatusForbidden)
+			return
+		}
+	}
+
+	batch := influxql.NewBatchQuery(query.Statements)
+	atomic.AddInt64(&h.stats.QueryBatchCombined, int64(batch.CombinedN()))
+
+	opts := influxql.ExecutionOptions{
+		Database:   req.Database,
+		ChunkSize:  DefaultChunkSize,
+		ReadOnly:   true,
+		ShareScans: true,
+	}
+
+	if h.Config.AuthEnabled {
+		// The current user determines the authorized actions.
+		opts.Authorizer = user
+	} else {
+		// Auth is disabled, so allow everything.
+		opts.Authorizer = influxql.OpenAuthorizer{}
+	}
+
+	// Make sure if the client disconnects we signal the query to abort
+	closing := make(chan struct{})
+	if notifier, ok := w.(http.CloseNotifier); ok {
+		done := make(chan struct{})
+		defer close(done)
+
+		notify := notifier.CloseNotify()
+		go func() {
+			select {
+			case <-done:
+			case <-notify:
+				close(closing)
+			}
+		}()
+		opts.AbortCh = done
+	} else {
+		defer close(closing)
+	}
+
+	rw.Header().Add("Connection", "close")
+	results := h.QueryExecutor.ExecuteQuery(batch.Query, opts, closing)
+
+	// The results of combined statements can only be split once they are
+	// complete, so every result is buffered in memory.
+	combined := make([]*influxql.Result, len(batch.Query.Statements))
+	rows := 0
+	for r := range results {
+		if r == nil || r.StatementID < 0 || r.StatementID >= len(combined) {
+			continue
+		}
+		rows = h.limitRows(r, rows)
+
+		if cr := combined[r.StatementID]; cr == nil || r.Err != nil {
+			combined[r.StatementID] = r
+		} else {
+			combineResult(cr, r)
+		}
+
+		if h.Config.MaxRowLimit > 0 && rows >= h.Config.MaxRowLimit {
+			// Do not signal to the client that more results will follow.
+			combined[r.StatementID].Partial = false
+			break
+		}
+	}
+
+	resp := Response{Results: make([]*influxql.Result, len(req.Queries))}
+	for _, r := range combined {
+		if r == nil {
+			continue
+		}
+		for _, r := range batch.Split(r) {
+			resp.Results[r.StatementID] = r
+		}
+	}
+	epoch := strings.TrimSpace(req.Epoch)
+	for i, r := range resp.Results {
+		if r == nil {
+			r = &influxql.Result{StatementID: i, Err: influxql.ErrNotExecuted}
+			resp.Results[i] = r
+		}
+		if epoch != "" {
+			convertToEpoch(r, epoch)
+		}
+	}
+
+	h.writeHeader(rw, http.StatusOK)
+	n, _ := rw.WriteResponse(resp)
+	atomic.AddInt64(&h.stats.QueryRequestBytesTransmitted, int64(n))
+}
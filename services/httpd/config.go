@@ -1,6 +1,13 @@
 package httpd
 
-import "github.com/lucaswiersma/influxdb/monitor/diagnostics"
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lucaswiersma/influxdb/monitor/diagnostics"
+	"github.com/lucaswiersma/influxdb/toml"
+)
 
 const (
 	// DefaultBindAddress is the default address to bind to.
@@ -11,6 +18,22 @@ const (
 
 	// DefaultBindSocket is the default unix socket to bind to.
 	DefaultBindSocket = "/var/run/influxdb.sock"
+
+	// DefaultAuthorizationHookTimeout is the default time to wait for a
+	// response from the external authorization hook.
+	DefaultAuthorizationHookTimeout = 5 * time.Second
+
+	// DefaultWriteIdempotencyMaxKeys is the default maximum number of write
+	// idempotency keys that are remembered at once.
+	DefaultWriteIdempotencyMaxKeys = 10000
+
+	// DefaultStreamBatchSize is the default number of points written at once
+	// from a streaming write connection.
+	DefaultStreamBatchSize = 5000
+
+	// DefaultStreamBatchTimeout is the default time a partial batch from a
+	// streaming write connection waits before it is written.
+	DefaultStreamBatchTimeout = time.Second
 )
 
 // Config represents a configuration for a HTTP service.
@@ -24,12 +47,65 @@ type Config struct {
 	HTTPSEnabled       bool   `toml:"https-enabled"`
 	HTTPSCertificate   string `toml:"https-certificate"`
 	HTTPSPrivateKey    string `toml:"https-private-key"`
+	HTTPSClientCA      string `toml:"https-client-ca"`
 	MaxRowLimit        int    `toml:"max-row-limit"`
 	MaxConnectionLimit int    `toml:"max-connection-limit"`
 	SharedSecret       string `toml:"shared-secret"`
 	Realm              string `toml:"realm"`
 	UnixSocketEnabled  bool   `toml:"unix-socket-enabled"`
 	BindSocket         string `toml:"bind-socket"`
+
+	// AuthorizationHookURL is an optional external endpoint consulted before
+	// every query and write. An empty URL disables the hook.
+	AuthorizationHookURL      string        `toml:"authorization-hook-url"`
+	AuthorizationHookTimeout  toml.Duration `toml:"authorization-hook-timeout"`
+	AuthorizationHookFailOpen bool          `toml:"authorization-hook-fail-open"`
+
+	// WriteIdempotencyWindow is how long the response to a write carrying an
+	// Idempotency-Key header is remembered. Retries with the same key within
+	// the window receive that response without writing the points again.
+	// A zero window disables idempotency keys.
+	WriteIdempotencyWindow  toml.Duration `toml:"write-idempotency-window"`
+	WriteIdempotencyMaxKeys int           `toml:"write-idempotency-max-keys"`
+
+	// StreamBatchSize and StreamBatchTimeout control how points streamed over
+	// a persistent connection to /write/stream are batched. An ack is sent
+	// to the client after each batch is written.
+	StreamBatchSize    int           `toml:"stream-batch-size"`
+	StreamBatchTimeout toml.Duration `toml:"stream-batch-timeout"`
+
+	// NormalizeNames lists the databases whose writes have the measurement,
+	// tag keys and field keys of each point converted to Unicode
+	// Normalization Form C, so differently encoded names are stored as one.
+	NormalizeNames []string `toml:"normalize-names"`
+
+	// FieldTypeCacheSize is the number of fields whose types are remembered
+	// by measurement to speed up parsing writes with repetitive schemas.
+	// Writes to databases listed in NormalizeNames don't use it. Zero
+	// disables the cache.
+	FieldTypeCacheSize int `toml:"field-type-cache-size"`
+
+	// ChunkFlushInterval and ChunkFlushSize coalesce the chunks of a chunked
+	// query response into larger network writes. Chunks are buffered until
+	// ChunkFlushSize bytes are pending or ChunkFlushInterval has passed.
+	// When both are zero each chunk is flushed as soon as it is written.
+	// Queries can override them with the flush_interval and flush_size
+	// query parameters.
+	ChunkFlushInterval toml.Duration `toml:"chunk-flush-interval"`
+	ChunkFlushSize     int           `toml:"chunk-flush-size"`
+
+	// JSONMappings convert arbitrary JSON documents written to /write/json
+	// into points. Requests select a mapping by name.
+	JSONMappings []JSONMapping `toml:"json-mapping"`
+
+	// GzipMinSize and GzipBestCompressionSize tune gzip compression of
+	// responses to their size. Responses smaller than GzipMinSize bytes are
+	// sent uncompressed and responses of at least GzipBestCompressionSize
+	// bytes are compressed with the best compression level. Up to the larger
+	// of the two is held back while the response size is unknown. Zero
+	// disables either threshold.
+	GzipMinSize             toml.Size `toml:"gzip-min-size"`
+	GzipBestCompressionSize toml.Size `toml:"gzip-best-compression-size"`
 }
 
 // NewConfig returns a new Config with default settings.
@@ -45,7 +121,34 @@ func NewConfig() Config {
 		Realm:             DefaultRealm,
 		UnixSocketEnabled: false,
 		BindSocket:        DefaultBindSocket,
+
+		AuthorizationHookTimeout: toml.Duration(DefaultAuthorizationHookTimeout),
+		WriteIdempotencyMaxKeys:  DefaultWriteIdempotencyMaxKeys,
+		StreamBatchSize:          DefaultStreamBatchSize,
+		StreamBatchTimeout:       toml.Duration(DefaultStreamBatchTimeout),
+	}
+}
+
+// Validate returns an error if the Config is invalid.
+func (c Config) Validate() error {
+	if c.GzipMinSize < 0 {
+		return errors.New("gzip-min-size must not be negative")
+	} else if c.GzipBestCompressionSize < 0 {
+		return errors.New("gzip-best-compression-size must not be negative")
+	} else if c.FieldTypeCacheSize < 0 {
+		return errors.New("field-type-cache-size must not be negative")
+	}
+
+	names := make(map[string]struct{}, len(c.JSONMappings))
+	for _, m := range c.JSONMappings {
+		if err := m.Validate(); err != nil {
+			return err
+		} else if _, ok := names[m.Name]; ok {
+			return fmt.Errorf("duplicate json mapping %s", m.Name)
+		}
+		names[m.Name] = struct{}{}
 	}
+	return nil
 }
 
 // Diagnostics returns a diagnostics representation of a subset of the Config.
@@ -57,10 +160,21 @@ func (c Config) Diagnostics() (*diagnostics.Diagnostics, error) {
 	}
 
 	return diagnostics.RowFromMap(map[string]interface{}{
-		"enabled":              true,
-		"bind-address":         c.BindAddress,
-		"https-enabled":        c.HTTPSEnabled,
-		"max-row-limit":        c.MaxRowLimit,
-		"max-connection-limit": c.MaxConnectionLimit,
+		"enabled":                    true,
+		"bind-address":               c.BindAddress,
+		"https-enabled":              c.HTTPSEnabled,
+		"max-row-limit":              c.MaxRowLimit,
+		"max-connection-limit":       c.MaxConnectionLimit,
+		"authorization-hook":         c.AuthorizationHookURL != "",
+		"write-idempotency-window":   c.WriteIdempotencyWindow,
+		"stream-batch-size":          c.StreamBatchSize,
+		"stream-batch-timeout":       c.StreamBatchTimeout,
+		"normalize-names":            c.NormalizeNames,
+		"field-type-cache-size":      c.FieldTypeCacheSize,
+		"chunk-flush-interval":       c.ChunkFlushInterval,
+		"chunk-flush-size":           c.ChunkFlushSize,
+		"json-mappings":              len(c.JSONMappings),
+		"gzip-min-size":              c.GzipMinSize,
+		"gzip-best-compression-size": c.GzipBestCompressionSize,
 	}), nil
 }
@@ -18,6 +18,7 @@ log-enabled = true
 write-tracing = true
 https-enabled = true
 https-certificate = "/dev/null"
+https-client-ca = "/etc/ssl/ca.pem"
 unix-socket-enabled = true
 bind-socket = "/var/run/influxdb.sock"
 `, &c); err != nil {
@@ -39,6 +40,8 @@ bind-socket = "/var/run/influxdb.sock"
 		t.Fatalf("unexpected https enabled: %v", c.HTTPSEnabled)
 	} else if c.HTTPSCertificate != "/dev/null" {
 		t.Fatalf("unexpected https certificate: %v", c.HTTPSCertificate)
+	} else if c.HTTPSClientCA != "/etc/ssl/ca.pem" {
+		t.Fatalf("unexpected https client ca: %v", c.HTTPSClientCA)
 	} else if c.UnixSocketEnabled != true {
 		t.Fatalf("unexpected unix socket enabled: %v", c.UnixSocketEnabled)
 	} else if c.BindSocket != "/var/run/influxdb.sock" {
@@ -53,3 +56,35 @@ func TestConfig_WriteTracing(t *testing.T) {
 		t.Fatalf("write tracing was not set")
 	}
 }
+
+func TestConfig_Validate_JSONMappings(t *testing.T) {
+	c := httpd.NewConfig()
+	if err := c.Validate(); err != nil {
+		t.Fatalf("unexpected validation fail from NewConfig: %s", err)
+	}
+
+	valid := httpd.JSONMapping{Name: "webhook", Measurement: "events", Fields: map[string]string{"value": "$.readings[0]"}}
+	c.JSONMappings = []httpd.JSONMapping{valid}
+	if err := c.Validate(); err != nil {
+		t.Fatalf("unexpected validation fail: %s", err)
+	}
+
+	c.JSONMappings = []httpd.JSONMapping{valid, valid}
+	if err := c.Validate(); err == nil {
+		t.Fatal("expected error for duplicate json mapping, got nil")
+	}
+
+	for _, m := range []httpd.JSONMapping{
+		{Measurement: "events", Fields: map[string]string{"value": "$.value"}},
+		{Name: "webhook", Measurement: "events"},
+		{Name: "webhook", Measurement: "events", Fields: map[string]string{"value": "value"}},
+		{Name: "webhook", Measurement: "events", Fields: map[string]string{"value": "$.readings[x]"}},
+		{Name: "webhook", Measurement: "$..event", Fields: map[string]string{"value": "$.value"}},
+		{Name: "webhook", Measurement: "events", Fields: map[string]string{"value": "$.value"}, TimePrecision: "h"},
+	} {
+		c.JSONMappings = []httpd.JSONMapping{m}
+		if err := c.Validate(); err == nil {
+			t.Errorf("expected error for json mapping %+v, got nil", m)
+		}
+	}
+}
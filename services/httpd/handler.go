@@ -1,12 +1,15 @@
 package httpd
 
 import (
+	"bufio"
 	"bytes"
 	"compress/gzip"
 	"encoding/json"
 	"errors"
 	"expvar"
 	"fmt"
+	"hash"
+	"hash/crc32"
 	"io"
 	"log"
 	"net/http"
@@ -38,6 +41,54 @@ const (
 	//
 	// This has no relation to the number of bytes that are returned.
 	DefaultChunkSize = 10000
+
+	// DefaultChunkFlushBufferSize is the size of the buffer chunks are
+	// coalesced in when only a flush interval is set.
+	DefaultChunkFlushBufferSize = 64 * 1024
+)
+
+// Representations of query results without any series, set with the empty
+// query parameter.
+const (
+	// EmptyResultOmit leaves the series out of the result entirely.
+	EmptyResultOmit = "omit"
+
+	// EmptyResultSeries includes a single series without any values.
+	EmptyResultSeries = "series"
+
+	// EmptyResultMessage includes a message stating there are no results.
+	EmptyResultMessage = "message"
+)
+
+// Checksums of the serialized query results, requested with the checksum
+// query parameter. The checksum is returned in the ChecksumTrailer trailer
+// as a hexadecimal string once the response is complete.
+const (
+	// ChecksumCRC32 is the CRC-32 checksum with the IEEE polynomial.
+	ChecksumCRC32 = "crc32"
+
+	// ChecksumCRC32C is the CRC-32 checksum with the Castagnoli polynomial.
+	ChecksumCRC32C = "crc32c"
+
+	// ChecksumTrailer is the trailer the checksum is returned in.
+	ChecksumTrailer = "X-Influxdb-Checksum"
+)
+
+// Formats of the series of query results, set with the series_format query
+// parameter.
+const (
+	// SeriesFormatTags returns the measurement as the name of a series and
+	// its tags as an object.
+	SeriesFormatTags = "tags"
+
+	// SeriesFormatKey returns the series key, the measurement followed by
+	// the tags as in line protocol, as the name of a series without tags.
+	SeriesFormatKey = "key"
+
+	// SeriesFormatTemplate returns the series_template query parameter as the
+	// name of a series, with "{measurement}" replaced by the measurement and
+	// "{key}" by the value of the tag key. The tags are returned as well.
+	SeriesFormatTemplate = "template"
 )
 
 // AuthenticationMethod defines the type of authentication used.
@@ -84,6 +135,12 @@ type Handler struct {
 		AuthorizeWrite(username, database string) error
 	}
 
+	// AuthorizationHook, if set, is consulted after the built-in authorization
+	// checks so that an external policy engine can veto queries and writes.
+	AuthorizationHook interface {
+		Authorize(req AuthorizationHookRequest) error
+	}
+
 	QueryExecutor *influxql.QueryExecutor
 
 	Monitor interface {
@@ -99,6 +156,17 @@ type Handler struct {
 	Logger    zap.Logger
 	CLFLogger *log.Logger
 	stats     *Statistics
+
+	// idempotencyKeys remembers the results of writes made with an
+	// Idempotency-Key header. It is nil if idempotency keys are disabled.
+	idempotencyKeys *idempotencyCache
+
+	// jsonMappers holds the compiled JSON write mappings keyed by name.
+	jsonMappers map[string]*jsonMapper
+
+	// fieldTypes remembers the types of written fields to speed up
+	// parsing, if enabled.
+	fieldTypes *models.FieldTypeCache
 }
 
 // NewHandler returns a new instance of handler with routes.
@@ -111,6 +179,26 @@ func NewHandler(c Config) *Handler {
 		stats:     &Statistics{},
 	}
 
+	if c.AuthorizationHookURL != "" {
+		h.AuthorizationHook = NewAuthorizationHook(c.AuthorizationHookURL, time.Duration(c.AuthorizationHookTimeout), c.AuthorizationHookFailOpen)
+	}
+
+	if c.WriteIdempotencyWindow > 0 {
+		h.idempotencyKeys = newIdempotencyCache(time.Duration(c.WriteIdempotencyWindow), c.WriteIdempotencyMaxKeys)
+	}
+
+	if c.FieldTypeCacheSize > 0 {
+		h.fieldTypes = models.NewFieldTypeCache(c.FieldTypeCacheSize)
+	}
+
+	// Invalid mappings are rejected by Config.Validate.
+	h.jsonMappers = make(map[string]*jsonMapper, len(c.JSONMappings))
+	for _, m := range c.JSONMappings {
+		if mapper, err := newJSONMapper(m); err == nil {
+			h.jsonMappers[m.Name] = mapper
+		}
+	}
+
 	h.AddRoutes([]Route{
 		Route{
 			"query-options", // Satisfy CORS checks.
@@ -124,13 +212,33 @@ func NewHandler(c Config) *Handler {
 			"query", // Query serving route.
 			"POST", "/query", true, true, h.serveQuery,
 		},
+		Route{
+			"query-batch", // Batched query serving route.
+			"POST", "/query/batch", true, true, h.serveQueryBatch,
+		},
 		Route{
 			"write-options", // Satisfy CORS checks.
 			"OPTIONS", "/write", false, true, h.serveOptions,
 		},
 		Route{
 			"write", // Data-ingest route.
-			"POST", "/write", true, true, h.serveWrite,
+			"POST", "/write", true, true, h.idempotent(h.serveWrite),
+		},
+		Route{
+			"write-sensu", // Sensu Go metrics ingest route.
+			"POST", "/write/sensu", true, true, h.idempotent(h.serveWriteSensu),
+		},
+		Route{
+			"write-otlp", // OpenTelemetry OTLP/HTTP metrics ingest route.
+			"POST", "/write/otlp", true, true, h.idempotent(h.serveWriteOTLP),
+		},
+		Route{
+			"write-json", // JSON document ingest route.
+			"POST", "/write/json", true, true, h.idempotent(h.serveWriteJSON),
+		},
+		Route{
+			"write-stream", // Streaming line protocol ingest route.
+			"POST", "/write/stream", false, true, h.serveWriteStream,
 		},
 		Route{ // Ping
 			"ping",
@@ -159,14 +267,25 @@ type Statistics struct {
 	CQRequests                   int64
 	QueryRequests                int64
 	WriteRequests                int64
+	SensuWriteRequests           int64
+	OTLPWriteRequests            int64
+	JSONWriteRequests            int64
+	JSONMappingFailures          int64
+	StreamWriteRequests          int64
 	PingRequests                 int64
 	StatusRequests               int64
 	WriteRequestBytesReceived    int64
 	QueryRequestBytesTransmitted int64
+	QueryRequestsMsgpack         int64
+	QueryBatchRequests           int64
+	QueryBatchCombined           int64
 	PointsWrittenOK              int64
 	PointsWrittenDropped         int64
 	PointsWrittenFail            int64
+	PointsNormalized             int64
 	AuthenticationFailures       int64
+	AuthorizationHookDenials     int64
+	IdempotentWriteHits          int64
 	RequestDuration              int64
 	QueryRequestDuration         int64
 	WriteRequestDuration         int64
@@ -185,14 +304,25 @@ func (h *Handler) Statistics(tags map[string]string) []models.Statistic {
 			statRequest:                      atomic.LoadInt64(&h.stats.Requests),
 			statQueryRequest:                 atomic.LoadInt64(&h.stats.QueryRequests),
 			statWriteRequest:                 atomic.LoadInt64(&h.stats.WriteRequests),
+			statSensuWriteRequest:            atomic.LoadInt64(&h.stats.SensuWriteRequests),
+			statOTLPWriteRequest:             atomic.LoadInt64(&h.stats.OTLPWriteRequests),
+			statJSONWriteRequest:             atomic.LoadInt64(&h.stats.JSONWriteRequests),
+			statJSONMappingFail:              atomic.LoadInt64(&h.stats.JSONMappingFailures),
+			statStreamWriteRequest:           atomic.LoadInt64(&h.stats.StreamWriteRequests),
 			statPingRequest:                  atomic.LoadInt64(&h.stats.PingRequests),
 			statStatusRequest:                atomic.LoadInt64(&h.stats.StatusRequests),
 			statWriteRequestBytesReceived:    atomic.LoadInt64(&h.stats.WriteRequestBytesReceived),
 			statQueryRequestBytesTransmitted: atomic.LoadInt64(&h.stats.QueryRequestBytesTransmitted),
+			statQueryRequestMsgpack:          atomic.LoadInt64(&h.stats.QueryRequestsMsgpack),
+			statQueryBatchRequest:            atomic.LoadInt64(&h.stats.QueryBatchRequests),
+			statQueryBatchCombined:           atomic.LoadInt64(&h.stats.QueryBatchCombined),
 			statPointsWrittenOK:              atomic.LoadInt64(&h.stats.PointsWrittenOK),
 			statPointsWrittenDropped:         atomic.LoadInt64(&h.stats.PointsWrittenDropped),
 			statPointsWrittenFail:            atomic.LoadInt64(&h.stats.PointsWrittenFail),
+			statPointsNormalized:             atomic.LoadInt64(&h.stats.PointsNormalized),
 			statAuthFail:                     atomic.LoadInt64(&h.stats.AuthenticationFailures),
+			statAuthHookDenied:               atomic.LoadInt64(&h.stats.AuthorizationHookDenials),
+			statIdempotentWriteHit:           atomic.LoadInt64(&h.stats.IdempotentWriteHits),
 			statRequestDuration:              atomic.LoadInt64(&h.stats.RequestDuration),
 			statQueryRequestDuration:         atomic.LoadInt64(&h.stats.QueryRequestDuration),
 			statWriteRequestDuration:         atomic.LoadInt64(&h.stats.WriteRequestDuration),
@@ -221,7 +351,7 @@ func (h *Handler) AddRoutes(routes ...Route) {
 
 		handler = h.responseWriter(handler)
 		if r.Gzipped {
-			handler = gzipFilter(handler)
+			handler = gzipFilter(handler, int(h.Config.GzipMinSize), int(h.Config.GzipBestCompressionSize))
 		}
 		handler = cors(handler)
 		handler = requestID(handler)
@@ -288,6 +418,9 @@ func (h *Handler) serveQuery(w http.ResponseWriter, r *http.Request, user *meta.
 	if !ok {
 		rw = NewResponseWriter(w, r)
 	}
+	if r.Header.Get("Accept") == "application/x-msgpack" {
+		atomic.AddInt64(&h.stats.QueryRequestsMsgpack, 1)
+	}
 
 	// Retrieve the node id the query should be executed on.
 	nodeID, _ := strconv.ParseUint(r.FormValue("node_id"), 10, 64)
@@ -371,6 +504,13 @@ func (h *Handler) serveQuery(w http.ResponseWriter, r *http.Request, user *meta.
 		}
 	}
 
+	if h.AuthorizationHook != nil {
+		if err := h.authorizeWithHook(user, db, AuthorizationActionQuery, query.String()); err != nil {
+			h.httpError(rw, "error authorizing query: "+err.Error(), http.StatusForbidden)
+			return
+		}
+	}
+
 	// Parse chunk size. Use default if not provided or unparsable.
 	chunked := r.FormValue("chunked") == "true"
 	chunkSize := DefaultChunkSize
@@ -380,14 +520,276 @@ func (h *Handler) serveQuery(w http.ResponseWriter, r *http.Request, user *meta.
 		}
 	}
 
+	// Parse how chunks are coalesced into larger network writes. Chunks are
+	// flushed once flushSize bytes are pending or flushInterval has passed.
+	flushInterval := time.Duration(h.Config.ChunkFlushInterval)
+	if s := r.FormValue("flush_interval"); s != "" {
+		d, err := influxql.ParseDuration(s)
+		if err != nil || d < 0 {
+			h.httpError(rw, fmt.Sprintf("invalid flush_interval value %q: must be a duration of at least 0s", s), http.StatusBadRequest)
+			return
+		}
+		flushInterval = d
+	}
+	flushSize := h.Config.ChunkFlushSize
+	if s := r.FormValue("flush_size"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			h.httpError(rw, fmt.Sprintf("invalid flush_size value %q: must be a number of bytes of at least 0", s), http.StatusBadRequest)
+			return
+		}
+		flushSize = n
+	}
+	coalesce := chunked && (flushInterval > 0 || flushSize > 0)
+
 	// Parse whether this is an async command.
 	async := r.FormValue("async") == "true"
 
+	// Parse how GROUP BY time() buckets are aligned.
+	var alignToStart bool
+	switch align := r.FormValue("align"); align {
+	case "", "epoch":
+	case "start":
+		alignToStart = true
+	default:
+		h.httpError(rw, fmt.Sprintf("invalid align value %q: must be epoch or start", align), http.StatusBadRequest)
+		return
+	}
+
+	// Parse the point budget for downsampling each series.
+	var maxPoints int
+	if s := r.FormValue("max_points"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			h.httpError(rw, fmt.Sprintf("invalid max_points value %q: must be a positive integer", s), http.StatusBadRequest)
+			return
+		}
+		maxPoints = n
+	}
+	maxPointsAgg := r.FormValue("max_points_agg")
+	switch maxPointsAgg {
+	case "", influxql.DownsampleAuto, influxql.DownsampleMean, influxql.DownsampleMin, influxql.DownsampleMax, influxql.DownsampleBand:
+	default:
+		h.httpError(rw, fmt.Sprintf("invalid max_points_agg value %q: must be auto, mean, min, max or band", maxPointsAgg), http.StatusBadRequest)
+		return
+	}
+
+	// Parse the precision of the result timestamps. It is the epoch the
+	// timestamps are returned in unless one is given, and points within the
+	// same interval of the precision are merged if requested.
+	var mergePrecision time.Duration
+	if precision := r.FormValue("precision"); precision != "" {
+		switch precision {
+		case "n", "u", "ms", "s", "m", "h":
+		default:
+			h.httpError(rw, fmt.Sprintf("invalid precision value %q: must be n, u, ms, s, m or h", precision), http.StatusBadRequest)
+			return
+		}
+		if epoch == "" {
+			epoch = precision
+		}
+		if r.FormValue("precision_merge") == "true" {
+			mergePrecision = time.Duration(models.GetPrecisionMultiplier(precision))
+		}
+	} else if r.FormValue("precision_merge") == "true" {
+		h.httpError(rw, "precision_merge requires the precision parameter", http.StatusBadRequest)
+		return
+	}
+
+	// Parse the window for reporting recently written data in the results.
+	var recentWrites time.Duration
+	if s := r.FormValue("recent_writes"); s != "" {
+		d, err := influxql.ParseDuration(s)
+		if err != nil || d <= 0 || d > tsdb.RecentWriteHorizon {
+			h.httpError(rw, fmt.Sprintf("invalid recent_writes value %q: must be a positive duration of at most %s", s, tsdb.RecentWriteHorizon), http.StatusBadRequest)
+			return
+		}
+		recentWrites = d
+	}
+
+	// Parse the timezone result timestamps are rendered in. Epoch timestamps
+	// are not affected. It takes precedence over the tz() clause of a
+	// statement.
+	var location *time.Location
+	if tz := r.FormValue("timezone"); tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			h.httpError(rw, fmt.Sprintf("invalid timezone %q: %s", tz, err), http.StatusBadRequest)
+			return
+		}
+		location = loc
+	}
+
+	// Parse how time literals at a leap second are handled.
+	leapSecond := r.FormValue("leap_second")
+	switch leapSecond {
+	case "", models.LeapSecondReject, models.LeapSecondClamp, models.LeapSecondNext:
+	default:
+		h.httpError(rw, fmt.Sprintf("invalid leap_second value %q: must be reject, clamp or next", leapSecond), http.StatusBadRequest)
+		return
+	}
+
+	// Parse the maximum number of series returned by each statement.
+	var maxGroups int
+	if s := r.FormValue("max_groups"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			h.httpError(rw, fmt.Sprintf("invalid max_groups value %q: must be a positive integer", s), http.StatusBadRequest)
+			return
+		}
+		maxGroups = n
+	}
+
+	// Parse the number of series each statement is sampled to and how they
+	// are ranked.
+	var sampleSeries int
+	if s := r.FormValue("sample_series"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			h.httpError(rw, fmt.Sprintf("invalid sample_series value %q: must be a positive integer", s), http.StatusBadRequest)
+			return
+		}
+		sampleSeries = n
+	}
+	sampleSeriesBy := r.FormValue("sample_series_by")
+	switch sampleSeriesBy {
+	case "", influxql.SampleSeriesPoints, influxql.SampleSeriesRecent:
+	default:
+		h.httpError(rw, fmt.Sprintf("invalid sample_series_by value %q: must be points or recent", sampleSeriesBy), http.StatusBadRequest)
+		return
+	}
+
+	// Parse how results without any series are represented.
+	empty := r.FormValue("empty")
+	switch empty {
+	case "", EmptyResultOmit, EmptyResultSeries, EmptyResultMessage:
+	default:
+		h.httpError(rw, fmt.Sprintf("invalid empty value %q: must be omit, series or message", empty), http.StatusBadRequest)
+		return
+	}
+
+	// Parse how fields stored with different types in different shards are
+	// read.
+	fieldTypes := r.FormValue("field_types")
+	switch fieldTypes {
+	case "", influxql.FieldTypePrecedence, influxql.FieldTypeNewest, influxql.FieldTypeFloat, influxql.FieldTypeTyped:
+	default:
+		h.httpError(rw, fmt.Sprintf("invalid field_types value %q: must be precedence, newest, float or typed", fieldTypes), http.StatusBadRequest)
+		return
+	}
+
+	// Parse which edge of a GROUP BY time() bucket includes points exactly
+	// on it.
+	bucketEdge := r.FormValue("bucket_edge")
+	switch bucketEdge {
+	case "", influxql.BucketEdgeStart, influxql.BucketEdgeEnd:
+	default:
+		h.httpError(rw, fmt.Sprintf("invalid bucket_edge value %q: must be start or end", bucketEdge), http.StatusBadRequest)
+		return
+	}
+
+	// Parse how statements with an empty time range are handled.
+	emptyTimeRange := r.FormValue("empty_time_range")
+	switch emptyTimeRange {
+	case "", influxql.EmptyTimeRangeIgnore, influxql.EmptyTimeRangeError:
+	default:
+		h.httpError(rw, fmt.Sprintf("invalid empty_time_range value %q: must be ignore or error", emptyTimeRange), http.StatusBadRequest)
+		return
+	}
+
+	// Parse the number of points iterators read ahead.
+	var iteratorBufferSize int
+	if s := r.FormValue("iterator_buffer_size"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > influxql.MaxIteratorBufferSize {
+			h.httpError(rw, fmt.Sprintf("invalid iterator_buffer_size value %q: must be an integer between 1 and %d", s, influxql.MaxIteratorBufferSize), http.StatusBadRequest)
+			return
+		}
+		iteratorBufferSize = n
+	}
+
+	// Parse the decimal places arithmetic in field expressions is rounded to.
+	var decimalPlaces int
+	if s := r.FormValue("decimal_places"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > influxql.MaxDecimalPlaces {
+			h.httpError(rw, fmt.Sprintf("invalid decimal_places value %q: must be an integer between 1 and %d", s, influxql.MaxDecimalPlaces), http.StatusBadRequest)
+			return
+		}
+		decimalPlaces = n
+	}
+
+	// Parse how the measurement and tags of each series are returned.
+	seriesFormat, seriesTemplate := r.FormValue("series_format"), r.FormValue("series_template")
+	switch seriesFormat {
+	case "", SeriesFormatTags, SeriesFormatKey:
+	case SeriesFormatTemplate:
+		if seriesTemplate == "" {
+			h.httpError(rw, "series_format=template requires a series_template", http.StatusBadRequest)
+			return
+		}
+	default:
+		h.httpError(rw, fmt.Sprintf("invalid series_format value %q: must be tags, key or template", seriesFormat), http.StatusBadRequest)
+		return
+	}
+
+	// Parse whether tags shared by every series are moved to the result.
+	omitConstantTags := r.FormValue("omit_constant_tags") == "true"
+
+	// Parse the checksum computed over the serialized results.
+	var checksum hash.Hash32
+	switch s := r.FormValue("checksum"); s {
+	case "":
+	case ChecksumCRC32:
+		checksum = crc32.NewIEEE()
+	case ChecksumCRC32C:
+		checksum = crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	default:
+		h.httpError(rw, fmt.Sprintf("invalid checksum value %q: must be crc32 or crc32c", s), http.StatusBadRequest)
+		return
+	}
+
+	// Parse the checkpoint a query resumes from. A checkpoint identifies a
+	// point of a single statement.
+	var resume *influxql.Checkpoint
+	if s := r.FormValue("resume"); s != "" {
+		cp, err := influxql.ParseCheckpoint(s)
+		if err != nil {
+			h.httpError(rw, fmt.Sprintf("invalid resume value %q: %s", s, err), http.StatusBadRequest)
+			return
+		} else if len(query.Statements) != 1 {
+			h.httpError(rw, "resume requires a query with a single statement", http.StatusBadRequest)
+			return
+		}
+		resume = cp
+	}
+
 	opts := influxql.ExecutionOptions{
-		Database:  db,
-		ChunkSize: chunkSize,
-		ReadOnly:  r.Method == "GET",
-		NodeID:    nodeID,
+		Database:           db,
+		ChunkSize:          chunkSize,
+		ReadOnly:           r.Method == "GET",
+		NodeID:             nodeID,
+		MarkFilled:         r.FormValue("mark_filled") == "true",
+		AlignToStart:       alignToStart,
+		MaxPoints:          maxPoints,
+		MaxPointsAggregate: maxPointsAgg,
+		MergePrecision:     mergePrecision,
+		RecentWrites:       recentWrites,
+		MaxGroups:          maxGroups,
+		SampleSeries:       sampleSeries,
+		SampleSeriesBy:     sampleSeriesBy,
+		Stats:              r.FormValue("stats") == "true",
+		DedupeSubqueries:   r.FormValue("dedupe_subqueries") == "true",
+		StableMerge:        r.FormValue("stable_merge") == "true",
+		FieldTypePolicy:    fieldTypes,
+		BucketEdge:         bucketEdge,
+		EmptyTimeRange:     emptyTimeRange,
+		DecimalPlaces:      decimalPlaces,
+		IteratorBufferSize: iteratorBufferSize,
+		NoDefaultLimit:     r.FormValue("no_default_limit") == "true",
+		Checkpoints:        chunked && r.FormValue("checkpoints") == "true",
+		Resume:             resume,
+		LeapSecond:         leapSecond,
 	}
 
 	if h.Config.AuthEnabled {
@@ -437,9 +839,33 @@ func (h *Handler) serveQuery(w http.ResponseWriter, r *http.Request, user *meta.
 		return
 	}
 
+	// Metadata queries may be rejected by the coordinator when they are run too
+	// frequently. Wait for the first result before writing the header so the
+	// rejection can be returned with the appropriate status code.
+	var first *influxql.Result
+	if len(query.Statements) > 0 && influxql.IsMetaQuery(query.Statements[0]) {
+		first = <-results
+		if first != nil && first.Err == influxql.ErrMetaQueryRateLimitExceeded {
+			h.httpError(rw, first.Err.Error(), http.StatusTooManyRequests)
+			return
+		}
+	}
+
 	// if we're not chunking, this will be the in memory buffer for all results before sending to client
 	resp := Response{Results: make([]*influxql.Result, 0)}
 
+	// The checksum can only be known once every result has been written, so
+	// it is sent as a trailer.
+	if checksum != nil {
+		if w, ok := rw.(*responseWriter); ok {
+			w.checksum = checksum
+			rw.Header().Set("Trailer", ChecksumTrailer)
+			defer func() {
+				rw.Header().Set(ChecksumTrailer, fmt.Sprintf("%08x", checksum.Sum32()))
+			}()
+		}
+	}
+
 	// Status header is OK once this point is reached.
 	// Attempt to flush the header immediately so the client gets the header information
 	// and knows the query was accepted.
@@ -448,9 +874,51 @@ func (h *Handler) serveQuery(w http.ResponseWriter, r *http.Request, user *meta.
 		w.Flush()
 	}
 
+	// When coalescing, chunks are buffered until enough are pending or the
+	// flush interval has passed, instead of being flushed one at a time.
+	var pending int
+	flush := func() {
+		pending = 0
+		if w, ok := rw.(http.Flusher); ok {
+			w.Flush()
+		}
+	}
+	var flushC <-chan time.Time
+	if coalesce {
+		if w, ok := rw.(*responseWriter); ok {
+			size := flushSize
+			if size == 0 {
+				size = DefaultChunkFlushBufferSize
+			}
+			w.buf = bufio.NewWriterSize(w.ResponseWriter, size)
+		}
+		if flushInterval > 0 {
+			ticker := time.NewTicker(flushInterval)
+			defer ticker.Stop()
+			flushC = ticker.C
+		}
+	}
+
 	// pull all results from the channel
 	rows := 0
-	for r := range results {
+	for {
+		r, ok := first, first != nil
+		if ok {
+			first = nil
+		} else {
+			select {
+			case r, ok = <-results:
+			case <-flushC:
+				if pending > 0 {
+					flush()
+				}
+				continue
+			}
+			if !ok {
+				break
+			}
+		}
+
 		// Ignore nil results.
 		if r == nil {
 			continue
@@ -459,15 +927,31 @@ func (h *Handler) serveQuery(w http.ResponseWriter, r *http.Request, user *meta.
 		// if requested, convert result timestamps to epoch
 		if epoch != "" {
 			convertToEpoch(r, epoch)
+		} else if loc := resultLocation(r, query, location); loc != nil {
+			convertToLocation(r, loc)
+		}
+
+		if empty != "" && empty != EmptyResultOmit {
+			representEmptyResult(r, query, empty)
+		}
+
+		if seriesFormat != "" && seriesFormat != SeriesFormatTags {
+			formatSeries(r, seriesFormat, seriesTemplate)
 		}
 
 		// Write out result immediately if chunked.
 		if chunked {
+			if omitConstantTags {
+				moveConstantTags(r)
+			}
 			n, _ := rw.WriteResponse(Response{
 				Results: []*influxql.Result{r},
 			})
 			atomic.AddInt64(&h.stats.QueryRequestBytesTransmitted, int64(n))
-			w.(http.Flusher).Flush()
+			pending += n
+			if !coalesce || (flushSize > 0 && pending >= flushSize) {
+				flush()
+			}
 			continue
 		}
 
@@ -475,30 +959,7 @@ func (h *Handler) serveQuery(w http.ResponseWriter, r *http.Request, user *meta.
 		// response.  This is to prevent the server from going OOM when
 		// returning a large response.  If you want to return more than the
 		// default chunk size, then use chunking to process multiple blobs.
-		// Iterate through the series in this result to count the rows and
-		// truncate any rows we shouldn't return.
-		if h.Config.MaxRowLimit > 0 {
-			for i, series := range r.Series {
-				n := h.Config.MaxRowLimit - rows
-				if n < len(series.Values) {
-					// We have reached the maximum number of values. Truncate
-					// the values within this row.
-					series.Values = series.Values[:n]
-					// Since this was truncated, it will always be a partial return.
-					// Add this so the client knows we truncated the response.
-					series.Partial = true
-				}
-				rows += len(series.Values)
-
-				if rows >= h.Config.MaxRowLimit {
-					// Drop any remaining series since we have already reached the row limit.
-					if i < len(r.Series) {
-						r.Series = r.Series[:i+1]
-					}
-					break
-				}
-			}
-		}
+		rows = h.limitRows(r, rows)
 
 		// It's not chunked so buffer results in memory.
 		// Results for statements need to be combined together.
@@ -513,27 +974,7 @@ func (h *Handler) serveQuery(w http.ResponseWriter, r *http.Request, user *meta.
 				continue
 			}
 
-			cr := resp.Results[l-1]
-			rowsMerged := 0
-			if len(cr.Series) > 0 {
-				lastSeries := cr.Series[len(cr.Series)-1]
-
-				for _, row := range r.Series {
-					if !lastSeries.SameSeries(row) {
-						// Next row is for a different series than last.
-						break
-					}
-					// Values are for the same series, so append them.
-					lastSeries.Values = append(lastSeries.Values, row.Values...)
-					rowsMerged++
-				}
-			}
-
-			// Append remaining rows as new rows.
-			r.Series = r.Series[rowsMerged:]
-			cr.Series = append(cr.Series, r.Series...)
-			cr.Messages = append(cr.Messages, r.Messages...)
-			cr.Partial = r.Partial
+			combineResult(resp.Results[l-1], r)
 		} else {
 			resp.Results = append(resp.Results, r)
 		}
@@ -553,13 +994,80 @@ func (h *Handler) serveQuery(w http.ResponseWriter, r *http.Request, user *meta.
 		}
 	}
 
+	// Send the chunks still waiting to be flushed.
+	if pending > 0 {
+		flush()
+	}
+
 	// If it's not chunked we buffered everything in memory, so write it out
 	if !chunked {
+		if omitConstantTags {
+			for _, r := range resp.Results {
+				moveConstantTags(r)
+			}
+		}
 		n, _ := rw.WriteResponse(resp)
 		atomic.AddInt64(&h.stats.QueryRequestBytesTransmitted, int64(n))
 	}
 }
 
+// limitRows truncates the series of r so no more than MaxRowLimit rows are
+// returned in total, given the number of rows returned before r. It returns
+// the number of rows returned including those of r.
+func (h *Handler) limitRows(r *influxql.Result, rows int) int {
+	if h.Config.MaxRowLimit <= 0 {
+		return rows
+	}
+
+	// Iterate through the series in this result to count the rows and
+	// truncate any rows we shouldn't return.
+	for i, series := range r.Series {
+		n := h.Config.MaxRowLimit - rows
+		if n < len(series.Values) {
+			// We have reached the maximum number of values. Truncate
+			// the values within this row.
+			series.Values = series.Values[:n]
+			// Since this was truncated, it will always be a partial return.
+			// Add this so the client knows we truncated the response.
+			series.Partial = true
+		}
+		rows += len(series.Values)
+
+		if rows >= h.Config.MaxRowLimit {
+			// Drop any remaining series since we have already reached the row limit.
+			if i < len(r.Series) {
+				r.Series = r.Series[:i+1]
+			}
+			break
+		}
+	}
+	return rows
+}
+
+// combineResult appends r, a later result of the same statement, to cr.
+func combineResult(cr, r *influxql.Result) {
+	rowsMerged := 0
+	if len(cr.Series) > 0 {
+		lastSeries := cr.Series[len(cr.Series)-1]
+
+		for _, row := range r.Series {
+			if !lastSeries.SameSeries(row) {
+				// Next row is for a different series than last.
+				break
+			}
+			// Values are for the same series, so append them.
+			lastSeries.Values = append(lastSeries.Values, row.Values...)
+			rowsMerged++
+		}
+	}
+
+	// Append remaining rows as new rows.
+	r.Series = r.Series[rowsMerged:]
+	cr.Series = append(cr.Series, r.Series...)
+	cr.Messages = append(cr.Messages, r.Messages...)
+	cr.Partial = r.Partial
+}
+
 // async drains the results from an async query and logs a message if it fails.
 func (h *Handler) async(query *influxql.Query, results <-chan *influxql.Result) {
 	for r := range results {
@@ -578,6 +1086,7 @@ func (h *Handler) async(query *influxql.Query, results <-chan *influxql.Result)
 
 // serveWrite receives incoming series data in line protocol format and writes it to the database.
 func (h *Handler) serveWrite(w http.ResponseWriter, r *http.Request, user *meta.UserInfo) {
+	receivedAt := time.Now().UTC()
 	atomic.AddInt64(&h.stats.WriteRequests, 1)
 	atomic.AddInt64(&h.stats.ActiveWriteRequests, 1)
 	defer func(start time.Time) {
@@ -585,36 +1094,113 @@ func (h *Handler) serveWrite(w http.ResponseWriter, r *http.Request, user *meta.
 		atomic.AddInt64(&h.stats.WriteRequestDuration, time.Since(start).Nanoseconds())
 	}(time.Now())
 
+	database, ok := h.authorizeWriteRequest(w, r, user)
+	if !ok {
+		return
+	}
+
+	buf, ok := h.readWriteBody(w, r)
+	if !ok {
+		return
+	}
+
+	// Points without a timestamp are assigned the time the body finished
+	// parsing. Clients may instead ask for the time the request was received
+	// so the assigned timestamp does not depend on how long the upload took.
+	defaultTime := time.Now().UTC()
+	if r.URL.Query().Get("uniform_ts") == "true" {
+		defaultTime = receivedAt
+	}
+
+	points, parseError := h.parsePoints(buf, defaultTime, h.writePrecision(r, database), database)
+	// Not points parsed correctly so return the error now
+	if parseError != nil && len(points) == 0 {
+		if parseError.Error() == "EOF" {
+			h.writeHeader(w, http.StatusOK)
+			return
+		}
+		h.httpError(w, parseError.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.writePoints(w, r, database, points, parseError)
+}
+
+// authorizeWriteRequest validates the database of a write request and checks
+// that user may write to it. It writes an error response and returns false if
+// the write should not proceed.
+func (h *Handler) authorizeWriteRequest(w http.ResponseWriter, r *http.Request, user *meta.UserInfo) (string, bool) {
 	database := r.URL.Query().Get("db")
 	if database == "" {
 		h.httpError(w, "database is required", http.StatusBadRequest)
-		return
+		return "", false
 	}
 
 	if di := h.MetaClient.Database(database); di == nil {
 		h.httpError(w, fmt.Sprintf("database not found: %q", database), http.StatusNotFound)
-		return
+		return "", false
 	}
 
 	if h.Config.AuthEnabled && user == nil {
 		h.httpError(w, fmt.Sprintf("user is required to write to database %q", database), http.StatusForbidden)
-		return
+		return "", false
 	}
 
 	if h.Config.AuthEnabled {
 		if err := h.WriteAuthorizer.AuthorizeWrite(user.Name, database); err != nil {
 			h.httpError(w, fmt.Sprintf("%q user is not authorized to write to database %q", user.Name, database), http.StatusForbidden)
-			return
+			return "", false
+		}
+	}
+
+	if h.AuthorizationHook != nil {
+		if err := h.authorizeWithHook(user, database, AuthorizationActionWrite, "rp="+r.URL.Query().Get("rp")); err != nil {
+			h.httpError(w, "error authorizing write: "+err.Error(), http.StatusForbidden)
+			return "", false
+		}
+	}
+	return database, true
+}
+
+// writePrecision returns the precision of the timestamps in a write request.
+// Requests that do not specify one use the default precision of the database.
+func (h *Handler) writePrecision(r *http.Request, database string) string {
+	if precision := r.URL.Query().Get("precision"); precision != "" {
+		return precision
+	}
+	if di := h.MetaClient.Database(database); di != nil {
+		return di.DefaultPrecision
+	}
+	return ""
+}
+
+// parsePoints parses the points of a write to database. Their names are
+// normalized if the database is configured for it. Otherwise the field type
+// cache is used, if enabled.
+func (h *Handler) parsePoints(buf []byte, defaultTime time.Time, precision, database string) ([]models.Point, error) {
+	for _, name := range h.Config.NormalizeNames {
+		if name == database {
+			points, n, err := models.ParsePointsNormalized(buf, defaultTime, precision)
+			atomic.AddInt64(&h.stats.PointsNormalized, int64(n))
+			return points, err
 		}
 	}
+	if h.fieldTypes != nil {
+		return models.ParsePointsWithFieldTypes(buf, defaultTime, precision, h.fieldTypes)
+	}
+	return models.ParsePointsWithPrecision(buf, defaultTime, precision)
+}
 
+// readWriteBody reads the body of a write request, decoding it if it is gzip
+// compressed. It writes an error response and returns false on failure.
+func (h *Handler) readWriteBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
 	// Handle gzip decoding of the body
 	body := r.Body
 	if r.Header.Get("Content-Encoding") == "gzip" {
 		b, err := gzip.NewReader(r.Body)
 		if err != nil {
 			h.httpError(w, err.Error(), http.StatusBadRequest)
-			return
+			return nil, false
 		}
 		defer b.Close()
 		body = b
@@ -636,25 +1222,20 @@ func (h *Handler) serveWrite(w http.ResponseWriter, r *http.Request, user *meta.
 			h.Logger.Info("Write handler unable to read bytes from request body")
 		}
 		h.httpError(w, err.Error(), http.StatusBadRequest)
-		return
+		return nil, false
 	}
 	atomic.AddInt64(&h.stats.WriteRequestBytesReceived, int64(buf.Len()))
 
 	if h.Config.WriteTracing {
 		h.Logger.Info(fmt.Sprintf("Write body received by handler: %s", buf.Bytes()))
 	}
+	return buf.Bytes(), true
+}
 
-	points, parseError := models.ParsePointsWithPrecision(buf.Bytes(), time.Now().UTC(), r.URL.Query().Get("precision"))
-	// Not points parsed correctly so return the error now
-	if parseError != nil && len(points) == 0 {
-		if parseError.Error() == "EOF" {
-			h.writeHeader(w, http.StatusOK)
-			return
-		}
-		h.httpError(w, parseError.Error(), http.StatusBadRequest)
-		return
-	}
-
+// writePoints writes the parsed points of a write request and responds to the
+// client. If parseError is set, some of the request could not be parsed and a
+// partial write is reported after the valid points are written.
+func (h *Handler) writePoints(w http.ResponseWriter, r *http.Request, database string, points []models.Point, parseError error) {
 	// Determine required consistency level.
 	level := r.URL.Query().Get("consistency")
 	consistency := models.ConsistencyLevelOne
@@ -684,8 +1265,8 @@ func (h *Handler) serveWrite(w http.ResponseWriter, r *http.Request, user *meta.
 	} else if parseError != nil {
 		// We wrote some of the points
 		atomic.AddInt64(&h.stats.PointsWrittenOK, int64(len(points)))
-		// The other points failed to parse which means the client sent invalid line protocol.  We return a 400
-		// response code as well as the lines that failed to parse.
+		// The other points failed to parse which means the client sent invalid data.  We return a 400
+		// response code as well as the points that failed to parse.
 		h.httpError(w, fmt.Sprintf("partial write:\n%v", parseError), http.StatusBadRequest)
 		return
 	}
@@ -694,6 +1275,59 @@ func (h *Handler) serveWrite(w http.ResponseWriter, r *http.Request, user *meta.
 	h.writeHeader(w, http.StatusNoContent)
 }
 
+// serveWriteSensu receives metrics in the Sensu Go metrics format and writes
+// them to the database.
+func (h *Handler) serveWriteSensu(w http.ResponseWriter, r *http.Request, user *meta.UserInfo) {
+	atomic.AddInt64(&h.stats.WriteRequests, 1)
+	atomic.AddInt64(&h.stats.SensuWriteRequests, 1)
+	atomic.AddInt64(&h.stats.ActiveWriteRequests, 1)
+	defer func(start time.Time) {
+		atomic.AddInt64(&h.stats.ActiveWriteRequests, -1)
+		atomic.AddInt64(&h.stats.WriteRequestDuration, time.Since(start).Nanoseconds())
+	}(time.Now())
+
+	database, ok := h.authorizeWriteRequest(w, r, user)
+	if !ok {
+		return
+	}
+
+	buf, ok := h.readWriteBody(w, r)
+	if !ok {
+		return
+	}
+
+	points, parseError := parseSensuPoints(buf, time.Now().UTC(), r.URL.Query().Get("precision"))
+	if parseError != nil && len(points) == 0 {
+		h.httpError(w, parseError.Error(), http.StatusBadRequest)
+		return
+	} else if len(points) == 0 {
+		h.writeHeader(w, http.StatusNoContent)
+		return
+	}
+
+	h.writePoints(w, r, database, points, parseError)
+}
+
+// authorizeWithHook asks the external authorization hook whether user may
+// perform action against database.
+func (h *Handler) authorizeWithHook(user *meta.UserInfo, database, action, statement string) error {
+	req := AuthorizationHookRequest{
+		Database:  database,
+		Action:    action,
+		Statement: statement,
+	}
+	if user != nil {
+		req.User = user.Name
+	}
+
+	if err := h.AuthorizationHook.Authorize(req); err != nil {
+		atomic.AddInt64(&h.stats.AuthorizationHookDenials, 1)
+		h.Logger.Info(fmt.Sprintf("Request denied by authorization hook | user: %q | action: %s | database: %q | %s", req.User, action, database, err))
+		return err
+	}
+	return nil
+}
+
 // serveOptions returns an empty response to comply with OPTIONS pre-flight requests
 func (h *Handler) serveOptions(w http.ResponseWriter, r *http.Request) {
 	h.writeHeader(w, http.StatusNoContent)
@@ -738,6 +1372,147 @@ func convertToEpoch(r *influxql.Result, epoch string) {
 	}
 }
 
+// resultLocation returns the location the timestamps of a result are rendered
+// in: loc if it is set, otherwise the tz() location of the statement that
+// returned the result.
+func resultLocation(r *influxql.Result, query *influxql.Query, loc *time.Location) *time.Location {
+	if loc != nil {
+		return loc
+	}
+	if r.StatementID >= 0 && r.StatementID < len(query.Statements) {
+		if stmt, ok := query.Statements[r.StatementID].(*influxql.SelectStatement); ok {
+			return stmt.Location
+		}
+	}
+	return nil
+}
+
+// convertToLocation converts result timestamps to the specified location so
+// they are rendered with its offset.
+func convertToLocation(r *influxql.Result, loc *time.Location) {
+	for _, s := range r.Series {
+		for _, v := range s.Values {
+			if ts, ok := v[0].(time.Time); ok {
+				v[0] = ts.In(loc)
+			}
+		}
+	}
+}
+
+// representEmptyResult adds the requested representation to a successful
+// result without any series.
+func representEmptyResult(r *influxql.Result, query *influxql.Query, empty string) {
+	if r.Err != nil || len(r.Series) > 0 {
+		return
+	}
+
+	switch empty {
+	case EmptyResultSeries:
+		row := &models.Row{}
+		if r.StatementID >= 0 && r.StatementID < len(query.Statements) {
+			if stmt, ok := query.Statements[r.StatementID].(*influxql.SelectStatement); ok {
+				row.Columns = stmt.ColumnNames()
+				if len(stmt.Sources) == 1 {
+					if m, ok := stmt.Sources[0].(*influxql.Measurement); ok && m.Regex == nil {
+						row.Name = m.Name
+					}
+				}
+			}
+		}
+		r.Series = models.Rows{row}
+	case EmptyResultMessage:
+		r.Messages = append(r.Messages, &influxql.Message{
+			Level: influxql.InfoLevel,
+			Text:  "no results",
+		})
+	}
+}
+
+// moveConstantTags moves the tags that have the same value in every series of
+// the result from the series to the result.
+func moveConstantTags(r *influxql.Result) {
+	if len(r.Series) == 0 {
+		return
+	}
+
+	var tags map[string]string
+	for k, v := range r.Series[0].Tags {
+		constant := true
+		for _, row := range r.Series[1:] {
+			if tv, ok := row.Tags[k]; !ok || tv != v {
+				constant = false
+				break
+			}
+		}
+		if constant {
+			if tags == nil {
+				tags = make(map[string]string)
+			}
+			tags[k] = v
+		}
+	}
+	if len(tags) == 0 {
+		return
+	}
+
+	// Copy the remaining tags since the maps may be shared between rows.
+	for _, row := range r.Series {
+		var remaining map[string]string
+		for k, v := range row.Tags {
+			if _, ok := tags[k]; ok {
+				continue
+			}
+			if remaining == nil {
+				remaining = make(map[string]string, len(row.Tags)-len(tags))
+			}
+			remaining[k] = v
+		}
+		row.Tags = remaining
+	}
+	r.Tags = tags
+}
+
+// formatSeries replaces the name of every series of the result according to
+// the series format.
+func formatSeries(r *influxql.Result, format, template string) {
+	for _, row := range r.Series {
+		switch format {
+		case SeriesFormatKey:
+			row.Name = string(models.MakeKey([]byte(row.Name), models.NewTags(row.Tags)))
+			row.Tags = nil
+		case SeriesFormatTemplate:
+			row.Name = expandSeriesTemplate(template, row.Name, row.Tags)
+		}
+	}
+}
+
+// expandSeriesTemplate replaces "{measurement}" in the template with the
+// measurement and every other "{key}" with the value of the tag key, or
+// nothing if the series doesn't have the tag.
+func expandSeriesTemplate(template, measurement string, tags map[string]string) string {
+	var buf bytes.Buffer
+	for {
+		i := strings.IndexByte(template, '{')
+		if i < 0 {
+			break
+		}
+		j := strings.IndexByte(template[i:], '}')
+		if j < 0 {
+			break
+		}
+
+		buf.WriteString(template[:i])
+		if key := template[i+1 : i+j]; key == "measurement" {
+			buf.WriteString(measurement)
+		} else {
+			buf.WriteString(tags[key])
+		}
+		template = template[i+j+1:]
+	}
+	buf.WriteString(template)
+	return buf.String()
+}
+
 // serveExpvar serves internal metrics in /debug/vars format over HTTP.
 func (h *Handler) serveExpvar(w http.ResponseWriter, r *http.Request) {
 	// Retrieve statistics from the monitor.
@@ -1058,47 +1833,123 @@ func authenticate(inner func(http.ResponseWriter, *http.Request, *meta.UserInfo)
 	})
 }
 
+// gzipResponseWriter compresses the response for clients that accept gzip.
+// The start of the response is held back until enough of it is known to
+// choose whether and how hard to compress it. Responses smaller than minSize
+// are sent uncompressed and responses that reach bestSize are compressed with
+// the best compression level. The choice is made once bestSize bytes, or
+// minSize bytes when bestSize is 0, have been written, or when the response is
+// finished or flushed after some of it has been written.
 type gzipResponseWriter struct {
-	io.Writer
 	http.ResponseWriter
+	minSize  int
+	bestSize int
+
+	code    int
+	buf     []byte
+	decided bool
+	w       io.Writer
+	gz      *gzip.Writer
+	level   int
 }
 
 // WriteHeader sets the provided code as the response status. If the
-// specified status is 204 No Content, then the Content-Encoding header
-// is removed from the response, to prevent clients expecting gzipped
-// encoded bodies from trying to deflate an empty response.
-func (w gzipResponseWriter) WriteHeader(code int) {
-	if code != http.StatusNoContent {
-		w.Header().Set("Content-Encoding", "gzip")
+// specified status is 204 No Content, then the response is not compressed,
+// to prevent clients expecting gzipped encoded bodies from trying to deflate
+// an empty response.
+func (w *gzipResponseWriter) WriteHeader(code int) {
+	if w.decided {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+
+	w.code = code
+	if code == http.StatusNoContent {
+		w.decide(false, 0)
+	} else if w.minSize == 0 && w.bestSize == 0 {
+		w.decide(true, gzip.DefaultCompression)
 	}
-	w.ResponseWriter.WriteHeader(code)
 }
 
-func (w gzipResponseWriter) Write(b []byte) (int, error) {
-	return w.Writer.Write(b)
+func (w *gzipResponseWriter) Write(b []byte) (int, error) {
+	if w.decided {
+		return w.w.Write(b)
+	}
+
+	w.buf = append(w.buf, b...)
+	if w.bestSize > 0 && len(w.buf) >= w.bestSize {
+		return len(b), w.decide(true, gzip.BestCompression)
+	} else if w.bestSize == 0 && len(w.buf) >= w.minSize {
+		return len(b), w.decide(true, gzip.DefaultCompression)
+	}
+	return len(b), nil
 }
 
-func (w gzipResponseWriter) Flush() {
-	w.Writer.(*gzip.Writer).Flush()
+func (w *gzipResponseWriter) Flush() {
+	if !w.decided {
+		// Nothing can be sent before the encoding is chosen, so a flush
+		// before any of the body has been written is deferred.
+		if len(w.buf) == 0 {
+			return
+		}
+		w.decide(len(w.buf) >= w.minSize, gzip.DefaultCompression)
+	}
+	if w.gz != nil {
+		w.gz.Flush()
+	}
 	if w, ok := w.ResponseWriter.(http.Flusher); ok {
 		w.Flush()
 	}
 }
 
-func (w gzipResponseWriter) CloseNotify() <-chan bool {
+func (w *gzipResponseWriter) CloseNotify() <-chan bool {
 	return w.ResponseWriter.(http.CloseNotifier).CloseNotify()
 }
 
-// gzipFilter determines if the client can accept compressed responses, and encodes accordingly.
-func gzipFilter(inner http.Handler) http.Handler {
+// decide writes the held back status and bytes of the response, compressing
+// them and the rest of the response at level if compress is set.
+func (w *gzipResponseWriter) decide(compress bool, level int) error {
+	w.decided = true
+	w.w = w.ResponseWriter
+	if compress && w.code != http.StatusNoContent {
+		w.gz, w.level = getGzipWriter(w.ResponseWriter, level), level
+		w.w = w.gz
+		w.Header().Set("Content-Encoding", "gzip")
+	}
+	if w.code != 0 {
+		w.ResponseWriter.WriteHeader(w.code)
+	}
+
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	_, err := w.w.Write(buf)
+	return err
+}
+
+// close finishes the response.
+func (w *gzipResponseWriter) close() {
+	if !w.decided {
+		w.decide(len(w.buf) >= w.minSize, gzip.DefaultCompression)
+	}
+	if w.gz != nil {
+		putGzipWriter(w.gz, w.level)
+	}
+}
+
+// gzipFilter determines if the client can accept compressed responses, and
+// encodes accordingly. See gzipResponseWriter for how minSize and bestSize
+// tune compression to the size of the response.
+func gzipFilter(inner http.Handler, minSize, bestSize int) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
 			inner.ServeHTTP(w, r)
 			return
 		}
-		gz := getGzipWriter(w)
-		defer putGzipWriter(gz)
-		gzw := gzipResponseWriter{Writer: gz, ResponseWriter: w}
+		gzw := &gzipResponseWriter{ResponseWriter: w, minSize: minSize, bestSize: bestSize}
+		defer gzw.close()
 		inner.ServeHTTP(gzw, r)
 	})
 }
@@ -1109,15 +1960,33 @@ var gzipWriterPool = sync.Pool{
 	},
 }
 
-func getGzipWriter(w io.Writer) *gzip.Writer {
-	gz := gzipWriterPool.Get().(*gzip.Writer)
+var gzipBestWriterPool = sync.Pool{
+	New: func() interface{} {
+		gz, _ := gzip.NewWriterLevel(nil, gzip.BestCompression)
+		return gz
+	},
+}
+
+func getGzipWriter(w io.Writer, level int) *gzip.Writer {
+	var gz *gzip.Writer
+	if level == gzip.BestCompression {
+		gz = gzipBestWriterPool.Get().(*gzip.Writer)
+	} else {
+		gz = gzipWriterPool.Get().(*gzip.Writer)
+	}
 	gz.Reset(w)
 	return gz
 }
 
-func putGzipWriter(gz *gzip.Writer) {
+// putGzipWriter closes gz and returns it to the pool for its level. Writers
+// keep their level when reset.
+func putGzipWriter(gz *gzip.Writer, level int) {
 	gz.Close()
-	gzipWriterPool.Put(gz)
+	if level == gzip.BestCompression {
+		gzipBestWriterPool.Put(gz)
+	} else {
+		gzipWriterPool.Put(gz)
+	}
 }
 
 // cors responds to incoming requests and adds the appropriate cors headers
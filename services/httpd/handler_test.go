@@ -1,16 +1,25 @@
 package httpd_test
 
 import (
+	"bufio"
 	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"hash/crc32"
 	"io"
 	"log"
+	"math"
 	"mime/multipart"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"reflect"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -19,6 +28,7 @@ import (
 	"github.com/lucaswiersma/influxdb/models"
 	"github.com/lucaswiersma/influxdb/services/httpd"
 	"github.com/lucaswiersma/influxdb/services/meta"
+	"github.com/lucaswiersma/influxdb/toml"
 )
 
 // Ensure the handler returns results from a query (including nil results).
@@ -267,6 +277,84 @@ func TestHandler_Query_MergeEmptyResults(t *testing.T) {
 	}
 }
 
+// Ensure the handler encodes query results as MessagePack when requested.
+func TestHandler_Query_MessagePack(t *testing.T) {
+	h := NewHandler(false)
+	h.StatementExecutor.ExecuteStatementFn = func(stmt influxql.Statement, ctx influxql.ExecutionContext) error {
+		ctx.Results <- &influxql.Result{StatementID: 1, Series: models.Rows([]*models.Row{{
+			Name:    "cpu",
+			Columns: []string{"time", "value"},
+			Values:  [][]interface{}{{time.Unix(0, 0).UTC(), 2.5}},
+		}})}
+		return nil
+	}
+
+	w := httptest.NewRecorder()
+	r := MustNewRequest("GET", "/query?db=foo&q=SELECT+*+FROM+bar", nil)
+	r.Header.Set("Accept", "application/x-msgpack")
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", w.Code)
+	} else if ct := w.Header().Get("Content-Type"); ct != "application/x-msgpack" {
+		t.Fatalf("unexpected content type: %s", ct)
+	} else if body, exp := w.Body.String(), "\x81\xa7results\x91\x82\xacstatement_id\x01\xa6series\x91"+
+		"\x83\xa4name\xa3cpu\xa7columns\x92\xa4time\xa5value\xa6values\x91\x92"+
+		"\xb41970-01-01T00:00:00Z\xcb\x40\x04\x00\x00\x00\x00\x00\x00"; body != exp {
+		t.Fatalf("unexpected body: %q", body)
+	}
+
+	if n := h.Statistics(nil)[0].Values["queryReqMsgpack"]; n != int64(1) {
+		t.Fatalf("unexpected msgpack request count: %v", n)
+	}
+}
+
+// Ensure a checkpoint survives a round trip through the MessagePack encoding.
+func TestHandler_Query_MessagePack_Checkpoint(t *testing.T) {
+	cp := &influxql.Checkpoint{Name: "cpu", Tags: map[string]string{"host": "A"}, Time: 10, N: 1}
+
+	h := NewHandler(false)
+	h.StatementExecutor.ExecuteStatementFn = func(stmt influxql.Statement, ctx influxql.ExecutionContext) error {
+		if !ctx.Checkpoints {
+			t.Fatalf("expected checkpoints")
+		}
+		ctx.Results <- &influxql.Result{StatementID: 1, Series: models.Rows([]*models.Row{{
+			Name:    "cpu",
+			Tags:    map[string]string{"host": "A"},
+			Columns: []string{"time", "value"},
+			Values:  [][]interface{}{{time.Unix(0, 10).UTC(), 2.5}},
+		}}), Checkpoint: cp.String()}
+		return nil
+	}
+
+	w := httptest.NewRecorder()
+	r := MustNewRequest("GET", "/query?db=foo&q=SELECT+*+FROM+bar&chunked=true&checkpoints=true", nil)
+	r.Header.Set("Accept", "application/x-msgpack")
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", w.Code)
+	}
+
+	v, rest, err := decodeMsgpack(w.Body.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	} else if len(rest) != 0 {
+		t.Fatalf("unexpected trailing bytes: %q", rest)
+	}
+	results, _ := v.(map[string]interface{})["results"].([]interface{})
+	if len(results) != 1 {
+		t.Fatalf("unexpected response: %#v", v)
+	}
+	token, ok := results[0].(map[string]interface{})["checkpoint"].(string)
+	if !ok {
+		t.Fatalf("missing checkpoint: %#v", results[0])
+	}
+	if other, err := influxql.ParseCheckpoint(token); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(other, cp) {
+		t.Fatalf("unexpected checkpoint: %#v", other)
+	}
+}
+
 // Ensure the handler can parse chunked and chunk size query parameters.
 func TestHandler_Query_Chunked(t *testing.T) {
 	h := NewHandler(false)
@@ -283,10 +371,599 @@ func TestHandler_Query_Chunked(t *testing.T) {
 	h.ServeHTTP(w, MustNewJSONRequest("GET", "/query?db=foo&q=SELECT+*+FROM+bar&chunked=true&chunk_size=2", nil))
 	if w.Code != http.StatusOK {
 		t.Fatalf("unexpected status: %d", w.Code)
-	} else if w.Body.String() != `{"results":[{"statement_id":1,"series":[{"name":"series0"}]}]}
-{"results":[{"statement_id":1,"series":[{"name":"series1"}]}]}
-` {
-		t.Fatalf("unexpected body: %s", w.Body.String())
+	} else if w.Body.String() != `{"results":[{"statement_id":1,"series":[{"name":"series0"}]}]}
+{"results":[{"statement_id":1,"series":[{"name":"series1"}]}]}
+` {
+		t.Fatalf("unexpected body: %s", w.Body.String())
+	}
+}
+
+// Ensure chunks are coalesced into fewer writes when a flush size is set.
+func TestHandler_Query_Chunked_FlushSize(t *testing.T) {
+	h := NewHandler(false)
+	h.StatementExecutor.ExecuteStatementFn = func(stmt influxql.Statement, ctx influxql.ExecutionContext) error {
+		for i := 0; i < 3; i++ {
+			ctx.Results <- &influxql.Result{StatementID: 1, Series: models.Rows([]*models.Row{{Name: fmt.Sprintf("series%d", i)}})}
+		}
+		return nil
+	}
+
+	exp := `{"results":[{"statement_id":1,"series":[{"name":"series0"}]}]}
+{"results":[{"statement_id":1,"series":[{"name":"series1"}]}]}
+{"results":[{"statement_id":1,"series":[{"name":"series2"}]}]}
+`
+	for _, tt := range []struct {
+		params string
+		writes int
+	}{
+		{params: "", writes: 6},
+		{params: "&flush_size=1048576", writes: 1},
+		{params: "&flush_interval=1h", writes: 1},
+	} {
+		w := &writeCountingRecorder{ResponseRecorder: httptest.NewRecorder()}
+		h.ServeHTTP(w, MustNewJSONRequest("GET", "/query?db=foo&q=SELECT+*+FROM+bar&chunked=true"+tt.params, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%q: unexpected status: %d", tt.params, w.Code)
+		} else if w.Body.String() != exp {
+			t.Fatalf("%q: unexpected body: %s", tt.params, w.Body.String())
+		} else if w.writes != tt.writes {
+			t.Fatalf("%q: unexpected writes: got %d, exp %d", tt.params, w.writes, tt.writes)
+		}
+	}
+
+	for _, params := range []string{"flush_size=-1", "flush_interval=soon"} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, MustNewJSONRequest("GET", "/query?db=foo&q=SELECT+*+FROM+bar&chunked=true&"+params, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("%s: unexpected status: %d", params, w.Code)
+		}
+	}
+}
+
+// Ensure a batch of queries is executed with similar queries combined.
+func TestHandler_Query_Batch(t *testing.T) {
+	h := NewHandler(false)
+	h.StatementExecutor.ExecuteStatementFn = func(stmt influxql.Statement, ctx influxql.ExecutionContext) error {
+		if !ctx.ShareScans {
+			t.Fatal("expected scans to be shared")
+		}
+		switch s := stmt.String(); s {
+		case `SELECT mean(value) AS f0, max(value) AS f1 FROM cpu WHERE time >= 0 AND time < 2m GROUP BY time(1m)`:
+			ctx.Results <- &influxql.Result{StatementID: ctx.StatementID, Series: models.Rows{{
+				Name:    "cpu",
+				Columns: []string{"time", "f0", "f1"},
+				Values: [][]interface{}{
+					{time.Unix(0, 0).UTC(), 1.5, float64(2)},
+					{time.Unix(60, 0).UTC(), 3.5, float64(4)},
+				},
+			}}}
+		case `SELECT count(value) FROM mem WHERE time >= 0 AND time < 2m GROUP BY time(1m)`:
+			ctx.Results <- &influxql.Result{StatementID: ctx.StatementID, Series: models.Rows{{
+				Name:    "mem",
+				Columns: []string{"time", "count"},
+				Values:  [][]interface{}{{time.Unix(0, 0).UTC(), int64(3)}},
+			}}}
+		default:
+			t.Fatalf("unexpected statement: %s", s)
+		}
+		return nil
+	}
+
+	body := `{"db": "foo", "epoch": "s", "queries": [
+		"SELECT mean(value) FROM cpu WHERE time >= 0 AND time < 2m GROUP BY time(1m)",
+		"SELECT count(value) FROM mem WHERE time >= 0 AND time < 2m GROUP BY time(1m)",
+		"SELECT max(value) FROM cpu WHERE time >= 0 AND time < 2m GROUP BY time(1m)"
+	]}`
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, MustNewJSONRequest("POST", "/query/batch", strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d: %s", w.Code, w.Body.String())
+	} else if body := strings.TrimSpace(w.Body.String()); body != `{"results":[`+
+		`{"statement_id":0,"series":[{"name":"cpu","columns":["time","mean"],"values":[[0,1.5],[60,3.5]]}]},`+
+		`{"statement_id":1,"series":[{"name":"mem","columns":["time","count"],"values":[[0,3]]}]},`+
+		`{"statement_id":2,"series":[{"name":"cpu","columns":["time","max"],"values":[[0,2],[60,4]]}]}]}` {
+		t.Fatalf("unexpected body: %s", body)
+	}
+
+	// Only SELECT statements can be batched.
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, MustNewJSONRequest("POST", "/query/batch", strings.NewReader(`{"db": "foo", "queries": ["DROP DATABASE foo"]}`)))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("unexpected status: %d", w.Code)
+	}
+}
+
+// Ensure responses are only compressed once they reach the minimum gzip size.
+func TestHandler_Query_GzipThresholds(t *testing.T) {
+	var n int
+	execute := func(stmt influxql.Statement, ctx influxql.ExecutionContext) error {
+		rows := make(models.Rows, n)
+		for i := range rows {
+			rows[i] = &models.Row{Name: fmt.Sprintf("series%d", i)}
+		}
+		ctx.Results <- &influxql.Result{StatementID: 1, Series: rows}
+		return nil
+	}
+
+	config := httpd.NewConfig()
+	config.GzipMinSize = 1024
+	config.GzipBestCompressionSize = 16 * 1024
+	h := NewHandlerWithConfig(config)
+	h.StatementExecutor.ExecuteStatementFn = execute
+
+	defaults := NewHandler(false)
+	defaults.StatementExecutor.ExecuteStatementFn = execute
+
+	for _, tt := range []struct {
+		h       *Handler
+		rows    int
+		gzipped bool
+	}{
+		{h: h, rows: 1, gzipped: false},
+		{h: h, rows: 100, gzipped: true},
+		{h: h, rows: 1000, gzipped: true},
+		{h: defaults, rows: 1, gzipped: true},
+	} {
+		n = tt.rows
+		req := MustNewJSONRequest("GET", "/query?db=foo&q=SELECT+*+FROM+bar", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		tt.h.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%d rows: unexpected status: %d", tt.rows, w.Code)
+		} else if got := w.Header().Get("Content-Encoding") == "gzip"; got != tt.gzipped {
+			t.Fatalf("%d rows: unexpected gzipped: got %v, exp %v", tt.rows, got, tt.gzipped)
+		}
+
+		body := io.Reader(w.Body)
+		if tt.gzipped {
+			gz, err := gzip.NewReader(w.Body)
+			if err != nil {
+				t.Fatalf("%d rows: %s", tt.rows, err)
+			}
+			body = gz
+		}
+		var resp httpd.Response
+		if err := json.NewDecoder(body).Decode(&resp); err != nil {
+			t.Fatalf("%d rows: unable to decode response: %s", tt.rows, err)
+		} else if len(resp.Results) != 1 || len(resp.Results[0].Series) != tt.rows {
+			t.Fatalf("%d rows: unexpected results: %+v", tt.rows, resp.Results)
+		}
+	}
+}
+
+// writeCountingRecorder counts the writes to the response body.
+type writeCountingRecorder struct {
+	*httptest.ResponseRecorder
+	writes int
+}
+
+func (w *writeCountingRecorder) Write(b []byte) (int, error) {
+	w.writes++
+	return w.ResponseRecorder.Write(b)
+}
+
+// Ensure the handler returns a 429 when a metadata query is rate limited.
+func TestHandler_Query_MetaQueryRateLimited(t *testing.T) {
+	h := NewHandler(false)
+	h.StatementExecutor.ExecuteStatementFn = func(stmt influxql.Statement, ctx influxql.ExecutionContext) error {
+		return influxql.ErrMetaQueryRateLimitExceeded
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, MustNewJSONRequest("GET", "/query?db=foo&q=SHOW+TAG+VALUES+WITH+KEY+%3D+host", nil))
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("unexpected status: %d", w.Code)
+	} else if body := strings.TrimSpace(w.Body.String()); body != `{"error":"max-meta-query-rate limit exceeded"}` {
+		t.Fatalf("unexpected body: %s", body)
+	}
+}
+
+// Ensure the handler parses leap seconds in time literals when requested.
+func TestHandler_Query_LeapSecond(t *testing.T) {
+	h := NewHandler(false)
+	h.StatementExecutor.ExecuteStatementFn = func(stmt influxql.Statement, ctx influxql.ExecutionContext) error {
+		if got, exp := stmt.String(), `SELECT * FROM bar WHERE time >= '2017-01-01T00:00:00Z'`; got != exp {
+			t.Fatalf("unexpected statement: %s", got)
+		}
+		ctx.Results <- &influxql.Result{StatementID: 1, Series: models.Rows([]*models.Row{{Name: "series0"}})}
+		return nil
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, MustNewJSONRequest("GET", "/query?db=foo&q=SELECT+*+FROM+bar+WHERE+time+%3E%3D+%272016-12-31T23%3A59%3A60Z%27&leap_second=next", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, MustNewJSONRequest("GET", "/query?db=foo&q=SELECT+*+FROM+bar&leap_second=smear", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("unexpected status: %d", w.Code)
+	}
+}
+
+// Ensure the handler passes the request to mark filled values to the executor.
+func TestHandler_Query_MarkFilled(t *testing.T) {
+	h := NewHandler(false)
+	h.StatementExecutor.ExecuteStatementFn = func(stmt influxql.Statement, ctx influxql.ExecutionContext) error {
+		if !ctx.MarkFilled {
+			t.Fatal("expected filled values to be marked")
+		}
+		ctx.Results <- &influxql.Result{StatementID: 1, Series: models.Rows([]*models.Row{{Name: "series0"}})}
+		return nil
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, MustNewJSONRequest("GET", "/query?db=foo&q=SELECT+*+FROM+bar&mark_filled=true", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", w.Code)
+	}
+}
+
+// Ensure the handler passes the point budget to the executor.
+func TestHandler_Query_MaxPoints(t *testing.T) {
+	h := NewHandler(false)
+	h.StatementExecutor.ExecuteStatementFn = func(stmt influxql.Statement, ctx influxql.ExecutionContext) error {
+		if ctx.MaxPoints != 100 || ctx.MaxPointsAggregate != influxql.DownsampleBand {
+			t.Fatalf("unexpected max points: %d %s", ctx.MaxPoints, ctx.MaxPointsAggregate)
+		}
+		ctx.Results <- &influxql.Result{StatementID: 1, Series: models.Rows([]*models.Row{{Name: "series0"}})}
+		return nil
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, MustNewJSONRequest("GET", "/query?db=foo&q=SELECT+*+FROM+bar&max_points=100&max_points_agg=band", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", w.Code)
+	}
+
+	for _, params := range []string{"max_points=0", "max_points=abc", "max_points=10&max_points_agg=median"} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, MustNewJSONRequest("GET", "/query?db=foo&q=SELECT+*+FROM+bar&"+params, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("%s: unexpected status: %d", params, w.Code)
+		}
+	}
+}
+
+func TestHandler_Query_IteratorBufferSize(t *testing.T) {
+	h := NewHandler(false)
+	h.StatementExecutor.ExecuteStatementFn = func(stmt influxql.Statement, ctx influxql.ExecutionContext) error {
+		if ctx.IteratorBufferSize != 1024 {
+			t.Fatalf("unexpected iterator buffer size: %d", ctx.IteratorBufferSize)
+		}
+		ctx.Results <- &influxql.Result{StatementID: 1, Series: models.Rows([]*models.Row{{Name: "series0"}})}
+		return nil
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, MustNewJSONRequest("GET", "/query?db=foo&q=SELECT+*+FROM+bar&iterator_buffer_size=1024", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", w.Code)
+	}
+
+	for _, params := range []string{"iterator_buffer_size=0", "iterator_buffer_size=abc", "iterator_buffer_size=65537"} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, MustNewJSONRequest("GET", "/query?db=foo&q=SELECT+*+FROM+bar&"+params, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("%s: unexpected status: %d", params, w.Code)
+		}
+	}
+}
+
+func TestHandler_Query_DecimalPlaces(t *testing.T) {
+	h := NewHandler(false)
+	h.StatementExecutor.ExecuteStatementFn = func(stmt influxql.Statement, ctx influxql.ExecutionContext) error {
+		if ctx.DecimalPlaces != 2 {
+			t.Fatalf("unexpected decimal places: %d", ctx.DecimalPlaces)
+		}
+		ctx.Results <- &influxql.Result{StatementID: 1, Series: models.Rows([]*models.Row{{Name: "series0"}})}
+		return nil
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, MustNewJSONRequest("GET", "/query?db=foo&q=SELECT+*+FROM+bar&decimal_places=2", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", w.Code)
+	}
+
+	for _, params := range []string{"decimal_places=0", "decimal_places=abc", "decimal_places=16"} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, MustNewJSONRequest("GET", "/query?db=foo&q=SELECT+*+FROM+bar&"+params, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("%s: unexpected status: %d", params, w.Code)
+		}
+	}
+}
+
+func TestHandler_Query_RecentWrites(t *testing.T) {
+	h := NewHandler(false)
+	h.StatementExecutor.ExecuteStatementFn = func(stmt influxql.Statement, ctx influxql.ExecutionContext) error {
+		if ctx.RecentWrites != 30*time.Second {
+			t.Fatalf("unexpected recent writes: %s", ctx.RecentWrites)
+		}
+		ctx.Results <- &influxql.Result{StatementID: 1, Series: models.Rows([]*models.Row{{Name: "series0"}})}
+		return nil
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, MustNewJSONRequest("GET", "/query?db=foo&q=SELECT+*+FROM+bar&recent_writes=30s", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", w.Code)
+	}
+
+	for _, params := range []string{"recent_writes=0s", "recent_writes=abc", "recent_writes=1h"} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, MustNewJSONRequest("GET", "/query?db=foo&q=SELECT+*+FROM+bar&"+params, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("%s: unexpected status: %d", params, w.Code)
+		}
+	}
+}
+
+func TestHandler_Query_Timezone(t *testing.T) {
+	h := NewHandler(false)
+	h.StatementExecutor.ExecuteStatementFn = func(stmt influxql.Statement, ctx influxql.ExecutionContext) error {
+		ctx.Results <- &influxql.Result{StatementID: 1, Series: models.Rows([]*models.Row{{
+			Name:    "cpu",
+			Columns: []string{"time", "value"},
+			Values:  [][]interface{}{{time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC), 1.5}},
+		}})}
+		return nil
+	}
+
+	for _, tt := range []struct {
+		params string
+		exp    string
+	}{
+		{params: "timezone=America/New_York", exp: `"2016-12-31T19:00:00-05:00"`},
+		{params: "timezone=UTC", exp: `"2017-01-01T00:00:00Z"`},
+		{params: "timezone=America/New_York&epoch=s", exp: `[1483228800,1.5]`},
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, MustNewJSONRequest("GET", "/query?db=foo&q=SELECT+*+FROM+bar&"+tt.params, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: unexpected status: %d", tt.params, w.Code)
+		} else if body := w.Body.String(); !strings.Contains(body, tt.exp) {
+			t.Fatalf("%s: unexpected body: %s", tt.params, body)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, MustNewJSONRequest("GET", "/query?db=foo&q=SELECT+*+FROM+bar&timezone=Mars/Olympus_Mons", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("unexpected status: %d", w.Code)
+	}
+}
+
+// Ensure results are rendered in the timezone of a statement's tz() clause
+// unless the timezone parameter is set.
+func TestHandler_Query_Timezone_Statement(t *testing.T) {
+	h := NewHandler(false)
+	h.StatementExecutor.ExecuteStatementFn = func(stmt influxql.Statement, ctx influxql.ExecutionContext) error {
+		// The daily windows of the statement begin at midnight in New York.
+		ctx.Results <- &influxql.Result{StatementID: 0, Series: models.Rows([]*models.Row{{
+			Name:    "cpu",
+			Columns: []string{"time", "mean"},
+			Values: [][]interface{}{
+				{time.Date(2017, 3, 11, 5, 0, 0, 0, time.UTC), 1.5},
+				{time.Date(2017, 3, 12, 5, 0, 0, 0, time.UTC), 2.5},
+				{time.Date(2017, 3, 13, 4, 0, 0, 0, time.UTC), 3.5},
+			},
+		}})}
+		return nil
+	}
+
+	q := url.QueryEscape(`SELECT mean(value) FROM cpu WHERE time >= '2017-03-11T05:00:00Z' AND time < '2017-03-14T04:00:00Z' GROUP BY time(1d) tz('America/New_York')`)
+	for _, tt := range []struct {
+		params string
+		exp    string
+	}{
+		{exp: `[["2017-03-11T00:00:00-05:00",1.5],["2017-03-12T00:00:00-05:00",2.5],["2017-03-13T00:00:00-04:00",3.5]]`},
+		{params: "&timezone=UTC", exp: `[["2017-03-11T05:00:00Z",1.5],["2017-03-12T05:00:00Z",2.5],["2017-03-13T04:00:00Z",3.5]]`},
+		{params: "&epoch=s", exp: `[[1489208400,1.5],[1489294800,2.5],[1489377600,3.5]]`},
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, MustNewJSONRequest("GET", "/query?db=foo&q="+q+tt.params, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: unexpected status: %d", tt.params, w.Code)
+		} else if body := w.Body.String(); !strings.Contains(body, tt.exp) {
+			t.Fatalf("%s: unexpected body: %s", tt.params, body)
+		}
+	}
+}
+
+func TestHandler_Query_Precision(t *testing.T) {
+	h := NewHandler(false)
+	var mergePrecision time.Duration
+	h.StatementExecutor.ExecuteStatementFn = func(stmt influxql.Statement, ctx influxql.ExecutionContext) error {
+		mergePrecision = ctx.MergePrecision
+		ctx.Results <- &influxql.Result{StatementID: 1, Series: models.Rows([]*models.Row{{
+			Name:    "cpu",
+			Columns: []string{"time", "value"},
+			Values:  [][]interface{}{{time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC), 1.5}},
+		}})}
+		return nil
+	}
+
+	for _, tt := range []struct {
+		params string
+		exp    string
+		merge  time.Duration
+	}{
+		{params: "precision=s", exp: `[1483228800,1.5]`},
+		{params: "precision=s&precision_merge=true", exp: `[1483228800,1.5]`, merge: time.Second},
+		{params: "precision=ms&epoch=s", exp: `[1483228800,1.5]`},
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, MustNewJSONRequest("GET", "/query?db=foo&q=SELECT+*+FROM+bar&"+tt.params, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: unexpected status: %d", tt.params, w.Code)
+		} else if body := w.Body.String(); !strings.Contains(body, tt.exp) {
+			t.Fatalf("%s: unexpected body: %s", tt.params, body)
+		} else if mergePrecision != tt.merge {
+			t.Fatalf("%s: unexpected merge precision: %s", tt.params, mergePrecision)
+		}
+	}
+
+	for _, params := range []string{"precision=d", "precision_merge=true"} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, MustNewJSONRequest("GET", "/query?db=foo&q=SELECT+*+FROM+bar&"+params, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("%s: unexpected status: %d", params, w.Code)
+		}
+	}
+}
+
+// Ensure the handler represents empty results as requested.
+func TestHandler_Query_Empty(t *testing.T) {
+	h := NewHandler(false)
+	h.StatementExecutor.ExecuteStatementFn = func(stmt influxql.Statement, ctx influxql.ExecutionContext) error {
+		ctx.Results <- &influxql.Result{StatementID: ctx.StatementID, Series: models.Rows{}}
+		return nil
+	}
+
+	for _, tt := range []struct {
+		params string
+		exp    string
+	}{
+		{params: "", exp: `{"results":[{"statement_id":0}]}`},
+		{params: "empty=omit", exp: `{"results":[{"statement_id":0}]}`},
+		{params: "empty=series", exp: `{"results":[{"statement_id":0,"series":[{"name":"bar","columns":["time","value"]}]}]}`},
+		{params: "empty=message", exp: `{"results":[{"statement_id":0,"messages":[{"level":"info","text":"no results"}]}]}`},
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, MustNewJSONRequest("GET", "/query?db=foo&q=SELECT+value+FROM+bar&"+tt.params, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: unexpected status: %d", tt.params, w.Code)
+		} else if body := strings.TrimSpace(w.Body.String()); body != tt.exp {
+			t.Fatalf("%s: unexpected body: %s", tt.params, body)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, MustNewJSONRequest("GET", "/query?db=foo&q=SELECT+value+FROM+bar&empty=null", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("unexpected status: %d", w.Code)
+	}
+}
+
+// Ensure the handler moves tags shared by every series to the result when requested.
+func TestHandler_Query_OmitConstantTags(t *testing.T) {
+	h := NewHandler(false)
+	h.StatementExecutor.ExecuteStatementFn = func(stmt influxql.Statement, ctx influxql.ExecutionContext) error {
+		ctx.Results <- &influxql.Result{StatementID: 1, Series: models.Rows([]*models.Row{
+			{Name: "cpu", Tags: map[string]string{"host": "server01", "region": "uswest"}, Columns: []string{"time", "value"}, Values: [][]interface{}{{int64(1), int64(2)}}},
+			{Name: "cpu", Tags: map[string]string{"host": "server02", "region": "uswest"}, Columns: []string{"time", "value"}, Values: [][]interface{}{{int64(1), int64(3)}}},
+		})}
+		return nil
+	}
+
+	for _, tt := range []struct {
+		params string
+		exp    string
+	}{
+		{params: "", exp: `{"results":[{"statement_id":1,"series":[{"name":"cpu","tags":{"host":"server01","region":"uswest"},"columns":["time","value"],"values":[[1,2]]},{"name":"cpu","tags":{"host":"server02","region":"uswest"},"columns":["time","value"],"values":[[1,3]]}]}]}`},
+		{params: "omit_constant_tags=true", exp: `{"results":[{"statement_id":1,"tags":{"region":"uswest"},"series":[{"name":"cpu","tags":{"host":"server01"},"columns":["time","value"],"values":[[1,2]]},{"name":"cpu","tags":{"host":"server02"},"columns":["time","value"],"values":[[1,3]]}]}]}`},
+		{params: "omit_constant_tags=true&chunked=true", exp: `{"results":[{"statement_id":1,"tags":{"region":"uswest"},"series":[{"name":"cpu","tags":{"host":"server01"},"columns":["time","value"],"values":[[1,2]]},{"name":"cpu","tags":{"host":"server02"},"columns":["time","value"],"values":[[1,3]]}]}]}`},
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, MustNewJSONRequest("GET", "/query?db=foo&q=SELECT+*+FROM+cpu+GROUP+BY+*&"+tt.params, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: unexpected status: %d", tt.params, w.Code)
+		} else if body := strings.TrimSpace(w.Body.String()); body != tt.exp {
+			t.Fatalf("%s: unexpected body: %s", tt.params, body)
+		}
+	}
+
+	// CSV has no result header so the tags are kept on every row.
+	w := httptest.NewRecorder()
+	req := MustNewRequest("GET", "/query?db=foo&q=SELECT+*+FROM+cpu+GROUP+BY+*&omit_constant_tags=true", nil)
+	req.Header.Add("Accept", "text/csv")
+	h.ServeHTTP(w, req)
+	if got, exp := w.Body.String(), "name,tags,time,value\ncpu,\"host=server01,region=uswest\",1,2\ncpu,\"host=server02,region=uswest\",1,3\n"; got != exp {
+		t.Fatalf("unexpected body:\n\texp = %q\n\tgot = %q", exp, got)
+	}
+}
+
+// Ensure the handler formats the name of each series when requested.
+func TestHandler_Query_SeriesFormat(t *testing.T) {
+	h := NewHandler(false)
+	h.StatementExecutor.ExecuteStatementFn = func(stmt influxql.Statement, ctx influxql.ExecutionContext) error {
+		ctx.Results <- &influxql.Result{StatementID: 1, Series: models.Rows([]*models.Row{
+			{Name: "cpu", Tags: map[string]string{"host": "server01", "region": "uswest"}, Columns: []string{"time", "value"}, Values: [][]interface{}{{int64(1), int64(2)}}},
+			{Name: "cpu", Tags: map[string]string{"region": "useast"}, Columns: []string{"time", "value"}, Values: [][]interface{}{{int64(1), int64(3)}}},
+		})}
+		return nil
+	}
+
+	for _, tt := range []struct {
+		params string
+		exp    string
+	}{
+		{params: "series_format=tags", exp: `{"results":[{"statement_id":1,"series":[{"name":"cpu","tags":{"host":"server01","region":"uswest"},"columns":["time","value"],"values":[[1,2]]},{"name":"cpu","tags":{"region":"useast"},"columns":["time","value"],"values":[[1,3]]}]}]}`},
+		{params: "series_format=key", exp: `{"results":[{"statement_id":1,"series":[{"name":"cpu,host=server01,region=uswest","columns":["time","value"],"values":[[1,2]]},{"name":"cpu,region=useast","columns":["time","value"],"values":[[1,3]]}]}]}`},
+		{params: "series_format=key&chunked=true", exp: `{"results":[{"statement_id":1,"series":[{"name":"cpu,host=server01,region=uswest","columns":["time","value"],"values":[[1,2]]},{"name":"cpu,region=useast","columns":["time","value"],"values":[[1,3]]}]}]}`},
+		{params: "series_format=template&series_template=%7Bregion%7D.%7Bmeasurement%7D.%7Bhost%7D", exp: `{"results":[{"statement_id":1,"series":[{"name":"uswest.cpu.server01","tags":{"host":"server01","region":"uswest"},"columns":["time","value"],"values":[[1,2]]},{"name":"useast.cpu.","tags":{"region":"useast"},"columns":["time","value"],"values":[[1,3]]}]}]}`},
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, MustNewJSONRequest("GET", "/query?db=foo&q=SELECT+*+FROM+cpu+GROUP+BY+*&"+tt.params, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: unexpected status: %d", tt.params, w.Code)
+		} else if body := strings.TrimSpace(w.Body.String()); body != tt.exp {
+			t.Fatalf("%s: unexpected body: %s", tt.params, body)
+		}
+	}
+
+	for _, params := range []string{"series_format=flat", "series_format=template"} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, MustNewJSONRequest("GET", "/query?db=foo&q=SELECT+*+FROM+cpu&"+params, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("%s: unexpected status: %d", params, w.Code)
+		}
+	}
+}
+
+// Ensure the handler returns a checksum of the results when requested.
+func TestHandler_Query_Checksum(t *testing.T) {
+	h := NewHandler(false)
+	h.StatementExecutor.ExecuteStatementFn = func(stmt influxql.Statement, ctx influxql.ExecutionContext) error {
+		ctx.Results <- &influxql.Result{StatementID: 1, Series: models.Rows([]*models.Row{{Name: "series0", Values: [][]interface{}{{1}}}})}
+		ctx.Results <- &influxql.Result{StatementID: 1, Series: models.Rows([]*models.Row{{Name: "series1", Values: [][]interface{}{{2}}}})}
+		return nil
+	}
+
+	for _, tt := range []struct {
+		params string
+		table  *crc32.Table
+	}{
+		{params: "checksum=crc32", table: crc32.IEEETable},
+		{params: "checksum=crc32c", table: crc32.MakeTable(crc32.Castagnoli)},
+		{params: "checksum=crc32&chunked=true", table: crc32.IEEETable},
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, MustNewJSONRequest("GET", "/query?db=foo&q=SELECT+*+FROM+bar&"+tt.params, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: unexpected status: %d", tt.params, w.Code)
+		} else if got, exp := w.HeaderMap.Get("Trailer"), httpd.ChecksumTrailer; got != exp {
+			t.Fatalf("%s: unexpected trailer: got %s, exp %s", tt.params, got, exp)
+		} else if got, exp := w.HeaderMap.Get(httpd.ChecksumTrailer), fmt.Sprintf("%08x", crc32.Checksum(w.Body.Bytes(), tt.table)); got != exp {
+			t.Fatalf("%s: unexpected checksum: got %s, exp %s", tt.params, got, exp)
+		}
+	}
+
+	// No checksum is computed unless requested.
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, MustNewJSONRequest("GET", "/query?db=foo&q=SELECT+*+FROM+bar", nil))
+	if got := w.HeaderMap.Get(httpd.ChecksumTrailer); got != "" {
+		t.Fatalf("unexpected checksum: %s", got)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, MustNewJSONRequest("GET", "/query?db=foo&q=SELECT+*+FROM+bar&checksum=md5", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("unexpected status: %d", w.Code)
 	}
 }
 
@@ -507,6 +1184,561 @@ func TestHandler_Query_CloseNotify(t *testing.T) {
 	}
 }
 
+// Ensure the handler consults the external authorization hook before running a query.
+func TestHandler_Query_AuthorizationHook(t *testing.T) {
+	var got httpd.AuthorizationHookRequest
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(`{"allow":false,"reason":"outside business hours"}`))
+	}))
+	defer hook.Close()
+
+	h := NewHandler(false)
+	h.AuthorizationHook = httpd.NewAuthorizationHook(hook.URL, time.Second, false)
+	h.StatementExecutor.ExecuteStatementFn = func(stmt influxql.Statement, ctx influxql.ExecutionContext) error {
+		t.Fatal("statement should not have been executed")
+		return nil
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, MustNewJSONRequest("GET", "/query?db=foo&q=SELECT+*+FROM+bar", nil))
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("unexpected status: %d", w.Code)
+	} else if body := strings.TrimSpace(w.Body.String()); body != `{"error":"error authorizing query: denied by authorization hook: outside business hours"}` {
+		t.Fatalf("unexpected body: %s", body)
+	}
+
+	exp := httpd.AuthorizationHookRequest{Database: "foo", Action: "query", Statement: "SELECT * FROM bar"}
+	if got != exp {
+		t.Fatalf("unexpected hook request: %+v", got)
+	}
+}
+
+// Ensure an unreachable authorization hook fails open or closed as configured.
+func TestHandler_Write_AuthorizationHookUnavailable(t *testing.T) {
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer hook.Close()
+
+	for _, tt := range []struct {
+		failOpen bool
+		code     int
+	}{
+		{failOpen: false, code: http.StatusForbidden},
+		{failOpen: true, code: http.StatusNoContent},
+	} {
+		h := NewHandler(false)
+		h.AuthorizationHook = httpd.NewAuthorizationHook(hook.URL, time.Second, tt.failOpen)
+		h.MetaClient.DatabaseFn = func(name string) *meta.DatabaseInfo {
+			return &meta.DatabaseInfo{}
+		}
+		h.Handler.PointsWriter = &HandlerPointsWriter{
+			WritePointsFn: func(database, retentionPolicy string, consistencyLevel models.ConsistencyLevel, points []models.Point) error {
+				return nil
+			},
+		}
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, MustNewRequest("POST", "/write?db=foo", strings.NewReader("cpu value=1 1")))
+		if w.Code != tt.code {
+			t.Fatalf("unexpected status (fail-open=%v): %d", tt.failOpen, w.Code)
+		}
+	}
+}
+
+// Ensure points without a timestamp get the request receipt time when requested.
+func TestHandler_Write_UniformTimestamp(t *testing.T) {
+	h := NewHandler(false)
+	h.MetaClient.DatabaseFn = func(name string) *meta.DatabaseInfo {
+		return &meta.DatabaseInfo{}
+	}
+
+	var written []models.Point
+	h.Handler.PointsWriter = &HandlerPointsWriter{
+		WritePointsFn: func(database, retentionPolicy string, consistencyLevel models.ConsistencyLevel, points []models.Point) error {
+			written = points
+			return nil
+		},
+	}
+
+	// Delay the body so parsing happens well after the request was received.
+	before := time.Now()
+	body := io.MultiReader(strings.NewReader("cpu value=1\n"), &slowReader{d: 50 * time.Millisecond}, strings.NewReader("cpu value=2\n"))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, MustNewRequest("POST", "/write?db=foo&uniform_ts=true", body))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("unexpected status: %d", w.Code)
+	} else if len(written) != 2 {
+		t.Fatalf("unexpected points written: %d", len(written))
+	}
+
+	if !written[0].Time().Equal(written[1].Time()) {
+		t.Fatalf("expected identical timestamps: %s != %s", written[0].Time(), written[1].Time())
+	} else if ts := written[0].Time(); ts.Sub(before) >= 50*time.Millisecond {
+		t.Fatalf("expected receipt time, got %s (request started at %s)", ts, before)
+	}
+}
+
+// Ensure writes without a precision use the default precision of the database.
+func TestHandler_Write_DefaultPrecision(t *testing.T) {
+	h := NewHandler(false)
+	h.MetaClient.DatabaseFn = func(name string) *meta.DatabaseInfo {
+		return &meta.DatabaseInfo{Name: name, DefaultPrecision: "s"}
+	}
+
+	var written []models.Point
+	h.Handler.PointsWriter = &HandlerPointsWriter{
+		WritePointsFn: func(database, retentionPolicy string, consistencyLevel models.ConsistencyLevel, points []models.Point) error {
+			written = points
+			return nil
+		},
+	}
+
+	for _, tt := range []struct {
+		url string
+		exp int64
+	}{
+		{url: "/write?db=foo", exp: 10 * int64(time.Second)},
+		{url: "/write?db=foo&precision=ms", exp: 10 * int64(time.Millisecond)},
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, MustNewRequest("POST", tt.url, strings.NewReader("cpu value=1 10\n")))
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("%s: unexpected status: %d", tt.url, w.Code)
+		} else if len(written) != 1 {
+			t.Fatalf("%s: unexpected points written: %d", tt.url, len(written))
+		} else if ts := written[0].UnixNano(); ts != tt.exp {
+			t.Fatalf("%s: unexpected timestamp: got %d, exp %d", tt.url, ts, tt.exp)
+		}
+	}
+}
+
+// Ensure the names of points written to databases configured for it are
+// normalized.
+func TestHandler_Write_NormalizeNames(t *testing.T) {
+	config := httpd.NewConfig()
+	config.NormalizeNames = []string{"foo"}
+	h := NewHandlerWithConfig(config)
+	h.MetaClient.DatabaseFn = func(name string) *meta.DatabaseInfo {
+		return &meta.DatabaseInfo{Name: name}
+	}
+
+	var written []models.Point
+	h.Handler.PointsWriter = &HandlerPointsWriter{
+		WritePointsFn: func(database, retentionPolicy string, consistencyLevel models.ConsistencyLevel, points []models.Point) error {
+			written = points
+			return nil
+		},
+	}
+
+	for _, tt := range []struct {
+		db  string
+		exp string
+	}{
+		{db: "foo", exp: "caf\u00e9"},
+		{db: "bar", exp: "cafe\u0301"},
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, MustNewRequest("POST", "/write?db="+tt.db, strings.NewReader("cafe\u0301 value=1\n")))
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("%s: unexpected status: %d", tt.db, w.Code)
+		} else if len(written) != 1 {
+			t.Fatalf("%s: unexpected points written: %d", tt.db, len(written))
+		} else if name := written[0].Name(); name != tt.exp {
+			t.Fatalf("%s: unexpected name: got %q, exp %q", tt.db, name, tt.exp)
+		}
+	}
+}
+
+// Ensure retried writes with the same idempotency key are only written once.
+func TestHandler_Write_IdempotencyKey(t *testing.T) {
+	config := httpd.NewConfig()
+	config.WriteIdempotencyWindow = toml.Duration(time.Minute)
+	h := NewHandlerWithConfig(config)
+	h.MetaClient.DatabaseFn = func(name string) *meta.DatabaseInfo {
+		return &meta.DatabaseInfo{}
+	}
+
+	var n int
+	h.Handler.PointsWriter = &HandlerPointsWriter{
+		WritePointsFn: func(database, retentionPolicy string, consistencyLevel models.ConsistencyLevel, points []models.Point) error {
+			n++
+			return nil
+		},
+	}
+
+	for i, key := range []string{"a", "a", "b", ""} {
+		req := MustNewRequest("POST", "/write?db=foo", strings.NewReader("cpu value=1 10\n"))
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("%d. unexpected status: %d", i, w.Code)
+		}
+	}
+
+	if n != 3 {
+		t.Fatalf("unexpected number of writes: %d", n)
+	} else if v := h.Statistics(nil)[0].Values["idempotentWriteHit"]; v != int64(1) {
+		t.Fatalf("unexpected idempotent write hits: %v", v)
+	}
+}
+
+// Ensure a write that failed with a server error is written again when retried.
+func TestHandler_Write_IdempotencyKey_ServerError(t *testing.T) {
+	config := httpd.NewConfig()
+	config.WriteIdempotencyWindow = toml.Duration(time.Minute)
+	h := NewHandlerWithConfig(config)
+	h.MetaClient.DatabaseFn = func(name string) *meta.DatabaseInfo {
+		return &meta.DatabaseInfo{}
+	}
+
+	var n int
+	h.Handler.PointsWriter = &HandlerPointsWriter{
+		WritePointsFn: func(database, retentionPolicy string, consistencyLevel models.ConsistencyLevel, points []models.Point) error {
+			if n++; n == 1 {
+				return errors.New("timeout")
+			}
+			return nil
+		},
+	}
+
+	for i, code := range []int{http.StatusInternalServerError, http.StatusNoContent, http.StatusNoContent} {
+		req := MustNewRequest("POST", "/write?db=foo", strings.NewReader("cpu value=1 10\n"))
+		req.Header.Set("Idempotency-Key", "a")
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != code {
+			t.Fatalf("%d. unexpected status: %d", i, w.Code)
+		}
+	}
+
+	if n != 2 {
+		t.Fatalf("unexpected number of writes: %d", n)
+	}
+}
+
+// Ensure the handler writes gzipped Sensu Go metrics and reports metrics that fail to parse.
+func TestHandler_Write_Sensu(t *testing.T) {
+	h := NewHandler(false)
+	h.MetaClient.DatabaseFn = func(name string) *meta.DatabaseInfo {
+		return &meta.DatabaseInfo{}
+	}
+
+	var written []models.Point
+	h.Handler.PointsWriter = &HandlerPointsWriter{
+		WritePointsFn: func(database, retentionPolicy string, consistencyLevel models.ConsistencyLevel, points []models.Point) error {
+			written = points
+			return nil
+		},
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write([]byte(`{"entity":{},"metrics":{"points":[` +
+		`{"name":"cpu.user","value":1.5,"timestamp":10,"tags":[{"name":"host","value":"serverA"}]},` +
+		`{"name":"","value":2,"timestamp":10},` +
+		`{"name":"cpu.idle","value":98,"timestamp":10}]}}`)); err != nil {
+		t.Fatal(err)
+	} else if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	req := MustNewRequest("POST", "/write/sensu?db=foo", &buf)
+	req.Header.Set("Content-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("unexpected status: %d", w.Code)
+	} else if body := w.Body.String(); !strings.Contains(body, "partial write") || !strings.Contains(body, "missing metric name") {
+		t.Fatalf("unexpected body: %s", body)
+	}
+
+	if len(written) != 2 {
+		t.Fatalf("unexpected points written: %d", len(written))
+	} else if got, exp := written[0].String(), "cpu.user,host=serverA value=1.5 10000000000"; got != exp {
+		t.Fatalf("unexpected point: got %s, exp %s", got, exp)
+	} else if got, exp := written[1].String(), "cpu.idle value=98 10000000000"; got != exp {
+		t.Fatalf("unexpected point: got %s, exp %s", got, exp)
+	}
+}
+
+// Ensure JSON documents are mapped to points and documents that cannot be
+// mapped are reported.
+func TestHandler_Write_JSON(t *testing.T) {
+	config := httpd.NewConfig()
+	config.JSONMappings = []httpd.JSONMapping{{
+		Name:          "webhook",
+		Measurement:   "$.event",
+		Tags:          map[string]string{"host": "$.host.name"},
+		Fields:        map[string]string{"value": "$.data.value", "ok": "$.data['ok']"},
+		Time:          "$.ts",
+		TimePrecision: "ms",
+	}}
+	h := NewHandlerWithConfig(config)
+	h.MetaClient.DatabaseFn = func(name string) *meta.DatabaseInfo {
+		return &meta.DatabaseInfo{}
+	}
+
+	var written []models.Point
+	h.Handler.PointsWriter = &HandlerPointsWriter{
+		WritePointsFn: func(database, retentionPolicy string, consistencyLevel models.ConsistencyLevel, points []models.Point) error {
+			written = points
+			return nil
+		},
+	}
+
+	body := `{"event":"deploy","host":{"name":"serverA"},"data":{"value":1.5,"ok":true},"ts":1000}
+[{"event":"deploy","data":{"value":2},"ts":"1970-01-01T00:00:02Z"},{"event":"deploy","host":{"name":"serverB"}}]
+{"event":{},"data":{"value":3}}
+`
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, MustNewRequest("POST", "/write/json?db=foo&mapping=webhook", strings.NewReader(body)))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("unexpected status: %d", w.Code)
+	} else if body := w.Body.String(); !strings.Contains(body, "partial write") ||
+		!strings.Contains(body, "unable to map document 2: no fields found") ||
+		!strings.Contains(body, "unable to map document 3: measurement is not a non-empty string") {
+		t.Fatalf("unexpected body: %s", body)
+	}
+
+	if len(written) != 2 {
+		t.Fatalf("unexpected points written: %d", len(written))
+	} else if got, exp := written[0].String(), "deploy,host=serverA ok=true,value=1.5 1000000000"; got != exp {
+		t.Fatalf("unexpected point: got %s, exp %s", got, exp)
+	} else if got, exp := written[1].String(), "deploy value=2 2000000000"; got != exp {
+		t.Fatalf("unexpected point: got %s, exp %s", got, exp)
+	}
+
+	// Unknown mappings are rejected.
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, MustNewRequest("POST", "/write/json?db=foo&mapping=missing", strings.NewReader(body)))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("unexpected status: %d", w.Code)
+	} else if body := w.Body.String(); !strings.Contains(body, "json mapping not found") {
+		t.Fatalf("unexpected body: %s", body)
+	}
+}
+
+// Ensure OTLP gauge and histogram data points are written and unsupported
+// metrics are reported as a partial success.
+func TestHandler_Write_OTLP(t *testing.T) {
+	h := NewHandler(false)
+	h.MetaClient.DatabaseFn = func(name string) *meta.DatabaseInfo {
+		return &meta.DatabaseInfo{}
+	}
+
+	var written []models.Point
+	h.Handler.PointsWriter = &HandlerPointsWriter{
+		WritePointsFn: func(database, retentionPolicy string, consistencyLevel models.ConsistencyLevel, points []models.Point) error {
+			written = points
+			return nil
+		},
+	}
+
+	// Minimal protobuf encoding of the request messages.
+	uvarint := func(b []byte, v uint64) []byte {
+		buf := make([]byte, binary.MaxVarintLen64)
+		return append(b, buf[:binary.PutUvarint(buf, v)]...)
+	}
+	varintField := func(b []byte, field int, v uint64) []byte {
+		return uvarint(uvarint(b, uint64(field<<3)), v)
+	}
+	bytesField := func(b []byte, field int, v []byte) []byte {
+		b = uvarint(uvarint(b, uint64(field<<3|2)), uint64(len(v)))
+		return append(b, v...)
+	}
+	fixed64 := func(b []byte, field int, v uint64) []byte {
+		b = uvarint(b, uint64(field<<3|1))
+		buf := make([]byte, 8)
+		binary.LittleEndian.PutUint64(buf, v)
+		return append(b, buf...)
+	}
+	attribute := func(key, value string) []byte {
+		kv := bytesField(nil, 1, []byte(key))
+		return bytesField(kv, 2, bytesField(nil, 1, []byte(value)))
+	}
+
+	// Gauge with a float data point.
+	dp := bytesField(nil, 7, attribute("cpu", "cpu0"))
+	dp = fixed64(dp, 3, uint64(10*time.Second))
+	dp = fixed64(dp, 4, math.Float64bits(1.5))
+	gauge := bytesField(nil, 1, []byte("cpu.user"))
+	gauge = bytesField(gauge, 5, bytesField(nil, 1, dp))
+
+	// Histogram with two explicit bounds.
+	dp = fixed64(nil, 3, uint64(10*time.Second))
+	dp = fixed64(dp, 4, 6)
+	dp = fixed64(dp, 5, math.Float64bits(12))
+	var counts, bounds []byte
+	for _, n := range []uint64{1, 2, 3} {
+		counts = fixed64(counts, 6, n)
+	}
+	for _, v := range []float64{0.5, 2} {
+		bounds = fixed64(bounds, 7, math.Float64bits(v))
+	}
+	dp = append(append(dp, counts...), bounds...)
+	hist := bytesField(nil, 1, []byte("latency"))
+	hist = bytesField(hist, 9, bytesField(nil, 1, dp))
+
+	// Summaries are not supported.
+	summary := bytesField(nil, 1, []byte("rpc"))
+	summary = bytesField(summary, 11, bytesField(nil, 1, fixed64(nil, 3, 1)))
+
+	var scope []byte
+	for _, m := range [][]byte{gauge, hist, summary} {
+		scope = bytesField(scope, 2, m)
+	}
+	rm := bytesField(nil, 1, bytesField(nil, 1, attribute("host", "serverA")))
+	rm = bytesField(rm, 2, scope)
+	body := bytesField(nil, 1, rm)
+
+	req := MustNewRequest("POST", "/write/otlp?db=foo", bytes.NewReader(body))
+	req.Header.Set("Content-Type", httpd.OTLPContentType)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d: %s", w.Code, w.Body.String())
+	}
+
+	var partial []byte
+	partial = varintField(partial, 1, 1)
+	partial = bytesField(partial, 2, []byte(`metric "rpc": unsupported metric type`))
+	if got, exp := w.Body.Bytes(), bytesField(nil, 1, partial); !bytes.Equal(got, exp) {
+		t.Fatalf("unexpected body: got %q, exp %q", got, exp)
+	}
+
+	if len(written) != 2 {
+		t.Fatalf("unexpected points written: %d", len(written))
+	} else if got, exp := written[0].String(), "cpu.user,cpu=cpu0,host=serverA value=1.5 10000000000"; got != exp {
+		t.Fatalf("unexpected point: got %s, exp %s", got, exp)
+	} else if got, exp := written[1].String(), "latency,host=serverA count=6i,le_+Inf=6i,le_0.5=1i,le_2=3i,sum=12 10000000000"; got != exp {
+		t.Fatalf("unexpected point: got %s, exp %s", got, exp)
+	}
+
+	// Other content types are rejected.
+	req = MustNewRequest("POST", "/write/otlp?db=foo", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("unexpected status: %d", w.Code)
+	}
+}
+
+// Ensure line protocol streamed over an upgraded connection is written in
+// batches and each batch is acked.
+func TestHandler_Write_Stream(t *testing.T) {
+	h := NewHandler(false)
+	h.Config.StreamBatchSize = 2
+	h.Config.StreamBatchTimeout = toml.Duration(time.Minute)
+	h.MetaClient.DatabaseFn = func(name string) *meta.DatabaseInfo {
+		return &meta.DatabaseInfo{}
+	}
+
+	var mu sync.Mutex
+	var written []string
+	h.Handler.PointsWriter = &HandlerPointsWriter{
+		WritePointsFn: func(database, retentionPolicy string, consistencyLevel models.ConsistencyLevel, points []models.Point) error {
+			mu.Lock()
+			defer mu.Unlock()
+			for _, p := range points {
+				written = append(written, p.String())
+			}
+			return nil
+		},
+	}
+
+	s := httptest.NewServer(h)
+	defer s.Close()
+
+	// Streaming requires the connection to be upgraded.
+	resp, err := http.Post(s.URL+"/write/stream?db=foo", "text/plain", strings.NewReader("cpu value=1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUpgradeRequired {
+		t.Fatalf("unexpected status: %d", resp.StatusCode)
+	}
+
+	conn, err := net.Dial("tcp", s.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if _, err := io.WriteString(conn, "POST /write/stream?db=foo&precision=s HTTP/1.1\r\nHost: localhost\r\nConnection: Upgrade\r\nUpgrade: influxdb-line-protocol\r\n\r\n"); err != nil {
+		t.Fatal(err)
+	}
+	br := bufio.NewReader(conn)
+	if resp, err := http.ReadResponse(br, nil); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("unexpected status: %d", resp.StatusCode)
+	}
+
+	// Lines split across writes are joined before they are parsed and the
+	// final line does not need a trailing newline.
+	for _, chunk := range []string{"cpu value=1 1\ncpu val", "ue=2 2\nbad line\n", "cpu value=3 3"} {
+		if _, err := io.WriteString(conn, chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := conn.(*net.TCPConn).CloseWrite(); err != nil {
+		t.Fatal(err)
+	}
+
+	type ack struct {
+		Written  int    `json:"written"`
+		Rejected int    `json:"rejected"`
+		Error    string `json:"error"`
+	}
+	var acks []ack
+	dec := json.NewDecoder(br)
+	for {
+		var a ack
+		if err := dec.Decode(&a); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		acks = append(acks, a)
+	}
+
+	if len(acks) != 2 {
+		t.Fatalf("unexpected acks: %+v", acks)
+	} else if acks[0] != (ack{Written: 2}) {
+		t.Fatalf("unexpected first ack: %+v", acks[0])
+	} else if acks[1].Written != 1 || acks[1].Rejected != 1 || !strings.Contains(acks[1].Error, "bad line") {
+		t.Fatalf("unexpected second ack: %+v", acks[1])
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if exp := []string{"cpu value=1 1000000000", "cpu value=2 2000000000", "cpu value=3 3000000000"}; !reflect.DeepEqual(written, exp) {
+		t.Fatalf("unexpected points written: %v", written)
+	}
+}
+
+// slowReader returns io.EOF after sleeping for d.
+type slowReader struct {
+	d time.Duration
+}
+
+func (r *slowReader) Read(p []byte) (int, error) {
+	time.Sleep(r.d)
+	return 0, io.EOF
+}
+
 // Ensure the handler handles ping requests correctly.
 // TODO: This should be expanded to verify the MetaClient check in servePing is working correctly
 func TestHandler_Ping(t *testing.T) {
@@ -623,7 +1855,11 @@ func NewHandler(requireAuthentication bool) *Handler {
 	config := httpd.NewConfig()
 	config.AuthEnabled = requireAuthentication
 	config.SharedSecret = "super secret key"
+	return NewHandlerWithConfig(config)
+}
 
+// NewHandlerWithConfig returns a new instance of Handler using config.
+func NewHandlerWithConfig(config httpd.Config) *Handler {
 	h := &Handler{
 		Handler: httpd.NewHandler(config),
 	}
@@ -686,6 +1922,15 @@ func (a *HandlerQueryAuthorizer) AuthorizeQuery(u *meta.UserInfo, query *influxq
 	return a.AuthorizeQueryFn(u, query, database)
 }
 
+// HandlerPointsWriter is a mock implementation of Handler.PointsWriter.
+type HandlerPointsWriter struct {
+	WritePointsFn func(database, retentionPolicy string, consistencyLevel models.ConsistencyLevel, points []models.Point) error
+}
+
+func (w *HandlerPointsWriter) WritePoints(database, retentionPolicy string, consistencyLevel models.ConsistencyLevel, points []models.Point) error {
+	return w.WritePointsFn(database, retentionPolicy, consistencyLevel, points)
+}
+
 // MustNewRequest returns a new HTTP request. Panic on error.
 func MustNewRequest(method, urlStr string, body io.Reader) *http.Request {
 	r, err := http.NewRequest(method, urlStr, body)
@@ -717,3 +1962,111 @@ func MustJWTToken(username, secret string, expired bool) (*jwt.Token, string) {
 	}
 	return token, signed
 }
+
+// decodeMsgpack decodes the subset of MessagePack written by the handler.
+// It returns the decoded value and the remaining bytes.
+func decodeMsgpack(b []byte) (interface{}, []byte, error) {
+	if len(b) == 0 {
+		return nil, nil, io.ErrUnexpectedEOF
+	}
+	c, b := b[0], b[1:]
+
+	// readN returns the next n bytes as a length or value prefix.
+	readN := func(n int) (uint64, error) {
+		if len(b) < n {
+			return 0, io.ErrUnexpectedEOF
+		}
+		var v uint64
+		for _, x := range b[:n] {
+			v = v<<8 | uint64(x)
+		}
+		b = b[n:]
+		return v, nil
+	}
+
+	var n uint64
+	var err error
+	switch {
+	case c <= 0x7f:
+		return int64(c), b, nil
+	case c >= 0xe0:
+		return int64(int8(c)), b, nil
+	case c&0xf0 == 0x80, c == 0xde, c == 0xdf:
+		if n = uint64(c & 0x0f); c == 0xde {
+			n, err = readN(2)
+		} else if c == 0xdf {
+			n, err = readN(4)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		m := make(map[string]interface{}, n)
+		for i := uint64(0); i < n; i++ {
+			var k, v interface{}
+			if k, b, err = decodeMsgpack(b); err != nil {
+				return nil, nil, err
+			} else if v, b, err = decodeMsgpack(b); err != nil {
+				return nil, nil, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, nil, fmt.Errorf("invalid map key: %#v", k)
+			}
+			m[key] = v
+		}
+		return m, b, nil
+	case c&0xf0 == 0x90, c == 0xdc, c == 0xdd:
+		if n = uint64(c & 0x0f); c == 0xdc {
+			n, err = readN(2)
+		} else if c == 0xdd {
+			n, err = readN(4)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		a := make([]interface{}, n)
+		for i := range a {
+			if a[i], b, err = decodeMsgpack(b); err != nil {
+				return nil, nil, err
+			}
+		}
+		return a, b, nil
+	case c&0xe0 == 0xa0, c == 0xd9, c == 0xda, c == 0xdb:
+		switch c {
+		case 0xd9:
+			n, err = readN(1)
+		case 0xda:
+			n, err = readN(2)
+		case 0xdb:
+			n, err = readN(4)
+		default:
+			n = uint64(c & 0x1f)
+		}
+		if err != nil {
+			return nil, nil, err
+		} else if uint64(len(b)) < n {
+			return nil, nil, io.ErrUnexpectedEOF
+		}
+		return string(b[:n]), b[n:], nil
+	case c == 0xc0:
+		return nil, b, nil
+	case c == 0xc2, c == 0xc3:
+		return c == 0xc3, b, nil
+	case c == 0xcb:
+		if n, err = readN(8); err != nil {
+			return nil, nil, err
+		}
+		return math.Float64frombits(n), b, nil
+	case c == 0xcf:
+		if n, err = readN(8); err != nil {
+			return nil, nil, err
+		}
+		return n, b, nil
+	case c == 0xd3:
+		if n, err = readN(8); err != nil {
+			return nil, nil, err
+		}
+		return int64(n), b, nil
+	}
+	return nil, nil, fmt.Errorf("unsupported msgpack type: 0x%02x", c)
+}
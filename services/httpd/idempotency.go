@@ -0,0 +1,187 @@
+package httpd
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lucaswiersma/influxdb/services/meta"
+)
+
+// idempotencyKeyHeader is the request header clients set to identify retries
+// of the same write.
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// idempotentResult is the response to a write made with an idempotency key.
+type idempotentResult struct {
+	key     string
+	expires time.Time
+
+	// done is closed once the response below has been recorded.
+	done chan struct{}
+
+	code int
+	resp *Response
+	body []byte
+}
+
+// replay writes the recorded response to w.
+func (res *idempotentResult) replay(h *Handler, w http.ResponseWriter) {
+	h.writeHeader(w, res.code)
+	if res.resp != nil {
+		if rw, ok := w.(ResponseWriter); ok {
+			rw.WriteResponse(*res.resp)
+			return
+		}
+	}
+	w.Write(res.body)
+}
+
+// idempotencyCache remembers the results of writes made with an idempotency
+// key for a fixed window. The oldest keys are evicted once it is full.
+type idempotencyCache struct {
+	mu      sync.Mutex
+	window  time.Duration
+	maxKeys int
+	results map[string]*idempotentResult
+
+	// queue holds results in the order they were added, which is also the
+	// order in which they expire.
+	queue []*idempotentResult
+
+	// now returns the current time. It can be replaced for testing.
+	now func() time.Time
+}
+
+// newIdempotencyCache returns a cache that remembers up to maxKeys results
+// for the given window.
+func newIdempotencyCache(window time.Duration, maxKeys int) *idempotencyCache {
+	return &idempotencyCache{
+		window:  window,
+		maxKeys: maxKeys,
+		results: make(map[string]*idempotentResult),
+		now:     time.Now,
+	}
+}
+
+// reserve returns the result for key if one has been recorded, or is being
+// recorded, within the window. Otherwise, a new pending result is added to the
+// cache and returned with ok set to false. The caller must then call complete.
+func (c *idempotencyCache) reserve(key string) (res *idempotentResult, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	c.evict(now)
+	if res := c.results[key]; res != nil {
+		return res, true
+	}
+
+	res = &idempotentResult{
+		key:     key,
+		expires: now.Add(c.window),
+		done:    make(chan struct{}),
+	}
+	c.results[key] = res
+	c.queue = append(c.queue, res)
+	return res, false
+}
+
+// complete records the response for a reserved result. Server errors are not
+// remembered so that a retry of the request is written again.
+func (c *idempotencyCache) complete(res *idempotentResult, code int, resp *Response, body []byte) {
+	res.code, res.resp, res.body = code, resp, body
+	close(res.done)
+
+	if code/100 == 5 {
+		c.mu.Lock()
+		if c.results[res.key] == res {
+			delete(c.results, res.key)
+		}
+		c.mu.Unlock()
+	}
+}
+
+// evict removes expired results and, if the cache is full, the oldest results
+// until there is room for another key.
+func (c *idempotencyCache) evict(now time.Time) {
+	for len(c.queue) > 0 {
+		res := c.queue[0]
+		if c.results[res.key] == res && now.Before(res.expires) && (c.maxKeys <= 0 || len(c.results) < c.maxKeys) {
+			break
+		}
+
+		if c.results[res.key] == res {
+			delete(c.results, res.key)
+		}
+		c.queue[0] = nil
+		c.queue = c.queue[1:]
+	}
+}
+
+// idempotencyRecorder records the response written by a handler while
+// passing it through to the client.
+type idempotencyRecorder struct {
+	ResponseWriter
+	code int
+	resp *Response
+	body bytes.Buffer
+}
+
+func (w *idempotencyRecorder) WriteHeader(code int) {
+	w.code = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *idempotencyRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *idempotencyRecorder) WriteResponse(resp Response) (int, error) {
+	w.resp = &resp
+	return w.ResponseWriter.WriteResponse(resp)
+}
+
+// idempotent wraps a write handler so that a retry of a request carrying an
+// Idempotency-Key header returns the response to the original request
+// instead of writing the points again.
+func (h *Handler) idempotent(fn func(http.ResponseWriter, *http.Request, *meta.UserInfo)) func(http.ResponseWriter, *http.Request, *meta.UserInfo) {
+	return func(w http.ResponseWriter, r *http.Request, user *meta.UserInfo) {
+		key := r.Header.Get(idempotencyKeyHeader)
+		rw, ok := w.(ResponseWriter)
+		if h.idempotencyKeys == nil || key == "" || !ok {
+			fn(w, r, user)
+			return
+		}
+
+		// Keys are scoped to the user, endpoint and database being written to.
+		var username string
+		if user != nil {
+			username = user.Name
+		}
+		key = strings.Join([]string{username, r.URL.Path, r.URL.Query().Get("db"), key}, "\x00")
+
+		res, ok := h.idempotencyKeys.reserve(key)
+		if ok {
+			<-res.done
+			atomic.AddInt64(&h.stats.IdempotentWriteHits, 1)
+			res.replay(h, w)
+			return
+		}
+
+		rec := &idempotencyRecorder{ResponseWriter: rw, code: http.StatusOK}
+		defer func() {
+			// Do not remember the response if the handler panicked.
+			if err := recover(); err != nil {
+				h.idempotencyKeys.complete(res, http.StatusInternalServerError, nil, nil)
+				panic(err)
+			}
+			h.idempotencyKeys.complete(res, rec.code, rec.resp, rec.body.Bytes())
+		}()
+		fn(rec, r, user)
+	}
+}
@@ -0,0 +1,347 @@
+package httpd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/lucaswiersma/influxdb/models"
+	"github.com/lucaswiersma/influxdb/services/meta"
+)
+
+// JSONMapping describes how the documents written to /write/json are
+// converted to points. Values are paths into a document such as
+// "$.host.name", "$.readings[0]" or "$['key.with.dots']". The measurement may
+// also be a literal name.
+type JSONMapping struct {
+	// Name selects the mapping with the mapping query parameter.
+	Name string `toml:"name"`
+
+	Measurement string            `toml:"measurement"`
+	Tags        map[string]string `toml:"tags"`
+	Fields      map[string]string `toml:"fields"`
+
+	// Time is the path to the timestamp of a document. String timestamps
+	// are parsed as RFC3339 and numeric timestamps are in TimePrecision,
+	// which defaults to seconds. Documents without a timestamp are assigned
+	// the time the request was received.
+	Time          string `toml:"time"`
+	TimePrecision string `toml:"time-precision"`
+}
+
+// Validate returns an error if the mapping is invalid.
+func (m JSONMapping) Validate() error {
+	_, err := newJSONMapper(m)
+	return err
+}
+
+// jsonMapper converts JSON documents to points using a JSONMapping.
+type jsonMapper struct {
+	measurement     string
+	measurementPath jsonPath
+	tags            map[string]jsonPath
+	fields          map[string]jsonPath
+	time            jsonPath
+	multiplier      int64
+}
+
+// newJSONMapper compiles the paths of a mapping.
+func newJSONMapper(m JSONMapping) (*jsonMapper, error) {
+	if m.Name == "" {
+		return nil, errors.New("json mapping must have a name")
+	} else if m.Measurement == "" {
+		return nil, fmt.Errorf("json mapping %s must have a measurement", m.Name)
+	} else if len(m.Fields) == 0 {
+		return nil, fmt.Errorf("json mapping %s must have at least one field", m.Name)
+	}
+
+	mapper := &jsonMapper{
+		tags:   make(map[string]jsonPath, len(m.Tags)),
+		fields: make(map[string]jsonPath, len(m.Fields)),
+	}
+
+	var err error
+	if strings.HasPrefix(m.Measurement, "$") {
+		if mapper.measurementPath, err = parseJSONPath(m.Measurement); err != nil {
+			return nil, fmt.Errorf("json mapping %s: %s", m.Name, err)
+		}
+	} else {
+		mapper.measurement = m.Measurement
+	}
+
+	for key, s := range m.Tags {
+		if mapper.tags[key], err = parseJSONPath(s); err != nil {
+			return nil, fmt.Errorf("json mapping %s: tag %s: %s", m.Name, key, err)
+		}
+	}
+	for key, s := range m.Fields {
+		if mapper.fields[key], err = parseJSONPath(s); err != nil {
+			return nil, fmt.Errorf("json mapping %s: field %s: %s", m.Name, key, err)
+		}
+	}
+
+	if m.Time != "" {
+		if mapper.time, err = parseJSONPath(m.Time); err != nil {
+			return nil, fmt.Errorf("json mapping %s: time: %s", m.Name, err)
+		}
+	}
+	if mapper.multiplier, err = sensuPrecisionMultiplier(m.TimePrecision); err != nil {
+		return nil, fmt.Errorf("json mapping %s: %s", m.Name, err)
+	}
+	return mapper, nil
+}
+
+// parsePoints converts the JSON documents in buf to points. The body may hold
+// a single document, an array of documents or a stream of documents such as
+// newline delimited JSON. Documents that cannot be mapped are skipped and
+// reported in failed, numbered by their position in the body.
+func (m *jsonMapper) parsePoints(buf []byte, defaultTime time.Time) (points []models.Point, failed []string) {
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+
+	var n int
+	for {
+		var v interface{}
+		if err := dec.Decode(&v); err == io.EOF {
+			return points, failed
+		} else if err != nil {
+			// The rest of the body cannot be read after a syntax error.
+			return points, append(failed, fmt.Sprintf("unable to parse document %d: %s", n, err))
+		}
+
+		docs, ok := v.([]interface{})
+		if !ok {
+			docs = []interface{}{v}
+		}
+		for _, doc := range docs {
+			pt, err := m.point(doc, defaultTime)
+			if err != nil {
+				failed = append(failed, fmt.Sprintf("unable to map document %d: %s", n, err))
+			} else {
+				points = append(points, pt)
+			}
+			n++
+		}
+	}
+}
+
+// point converts a single document to a point. Tags and fields whose path is
+// not found in the document are left out of the point.
+func (m *jsonMapper) point(doc interface{}, defaultTime time.Time) (models.Point, error) {
+	name := m.measurement
+	if m.measurementPath != nil {
+		v, ok := m.measurementPath.lookup(doc)
+		if !ok {
+			return nil, errors.New("measurement not found")
+		}
+		s, ok := v.(string)
+		if !ok || s == "" {
+			return nil, errors.New("measurement is not a non-empty string")
+		}
+		name = s
+	}
+
+	tags := make(map[string]string, len(m.tags))
+	for key, path := range m.tags {
+		v, ok := path.lookup(doc)
+		if !ok {
+			continue
+		}
+		switch v := v.(type) {
+		case string:
+			if v == "" {
+				// Empty tag values cannot be stored so drop the tag.
+				continue
+			}
+			tags[key] = v
+		case json.Number:
+			tags[key] = v.String()
+		case bool:
+			tags[key] = strconv.FormatBool(v)
+		default:
+			return nil, fmt.Errorf("tag %s is not a string, number or boolean", key)
+		}
+	}
+
+	fields := make(models.Fields, len(m.fields))
+	for key, path := range m.fields {
+		v, ok := path.lookup(doc)
+		if !ok {
+			continue
+		}
+		switch v := v.(type) {
+		case string, bool:
+			fields[key] = v
+		case json.Number:
+			f, err := v.Float64()
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %s", key, err)
+			}
+			fields[key] = f
+		default:
+			return nil, fmt.Errorf("field %s is not a string, number or boolean", key)
+		}
+	}
+	if len(fields) == 0 {
+		return nil, errors.New("no fields found")
+	}
+
+	t := defaultTime
+	if m.time != nil {
+		if v, ok := m.time.lookup(doc); ok {
+			var err error
+			if t, err = m.parseTime(v); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return models.NewPoint(name, models.NewTags(tags), fields, t)
+}
+
+// parseTime converts a timestamp found in a document to a time.
+func (m *jsonMapper) parseTime(v interface{}) (time.Time, error) {
+	switch v := v.(type) {
+	case string:
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid time: %s", err)
+		}
+		return t.UTC(), nil
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return time.Unix(0, i*m.multiplier).UTC(), nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid time: %s", err)
+		}
+		return time.Unix(0, int64(f*float64(m.multiplier))).UTC(), nil
+	default:
+		return time.Time{}, errors.New("time is not a string or number")
+	}
+}
+
+// jsonPath is a compiled path into a JSON document. Each element is either an
+// object key or an array index.
+type jsonPath []interface{}
+
+// parseJSONPath parses a path of the form "$.a.b[0]['c.d']".
+func parseJSONPath(s string) (jsonPath, error) {
+	if !strings.HasPrefix(s, "$") {
+		return nil, fmt.Errorf("path %q must start with $", s)
+	}
+
+	path := jsonPath{}
+	for rest := s[1:]; rest != ""; {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			i := strings.IndexAny(rest, ".[")
+			if i == -1 {
+				i = len(rest)
+			}
+			if i == 0 {
+				return nil, fmt.Errorf("path %q has an empty key", s)
+			}
+			path, rest = append(path, rest[:i]), rest[i:]
+		case '[':
+			i := strings.IndexByte(rest, ']')
+			if i == -1 {
+				return nil, fmt.Errorf("path %q has an unterminated [", s)
+			}
+			elem := rest[1:i]
+			if len(elem) >= 2 && (elem[0] == '\'' || elem[0] == '"') && elem[len(elem)-1] == elem[0] {
+				path = append(path, elem[1:len(elem)-1])
+			} else if n, err := strconv.Atoi(elem); err == nil && n >= 0 {
+				path = append(path, n)
+			} else {
+				return nil, fmt.Errorf("path %q has an invalid index %q", s, elem)
+			}
+			rest = rest[i+1:]
+		default:
+			return nil, fmt.Errorf("path %q has an unexpected %q", s, rest[0])
+		}
+	}
+	return path, nil
+}
+
+// lookup returns the value at the path in doc. It returns false if the path
+// does not exist or the value is null.
+func (p jsonPath) lookup(doc interface{}) (interface{}, bool) {
+	v := doc
+	for _, elem := range p {
+		switch elem := elem.(type) {
+		case string:
+			obj, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			if v, ok = obj[elem]; !ok {
+				return nil, false
+			}
+		case int:
+			arr, ok := v.([]interface{})
+			if !ok || elem >= len(arr) {
+				return nil, false
+			}
+			v = arr[elem]
+		}
+	}
+	return v, v != nil
+}
+
+// serveWriteJSON receives arbitrary JSON documents and writes them to the
+// database as points using the mapping named by the mapping query parameter.
+// Documents that cannot be mapped are reported in the response alongside the
+// points that were written.
+func (h *Handler) serveWriteJSON(w http.ResponseWriter, r *http.Request, user *meta.UserInfo) {
+	atomic.AddInt64(&h.stats.WriteRequests, 1)
+	atomic.AddInt64(&h.stats.JSONWriteRequests, 1)
+	atomic.AddInt64(&h.stats.ActiveWriteRequests, 1)
+	defer func(start time.Time) {
+		atomic.AddInt64(&h.stats.ActiveWriteRequests, -1)
+		atomic.AddInt64(&h.stats.WriteRequestDuration, time.Since(start).Nanoseconds())
+	}(time.Now())
+
+	database, ok := h.authorizeWriteRequest(w, r, user)
+	if !ok {
+		return
+	}
+
+	name := r.URL.Query().Get("mapping")
+	m, ok := h.jsonMappers[name]
+	if !ok {
+		h.httpError(w, fmt.Sprintf("json mapping not found: %q", name), http.StatusBadRequest)
+		return
+	}
+
+	buf, ok := h.readWriteBody(w, r)
+	if !ok {
+		return
+	}
+
+	points, failed := m.parsePoints(buf, time.Now().UTC())
+	atomic.AddInt64(&h.stats.JSONMappingFailures, int64(len(failed)))
+
+	var parseError error
+	if len(failed) > 0 {
+		parseError = errors.New(strings.Join(failed, "\n"))
+	}
+	if parseError != nil && len(points) == 0 {
+		h.httpError(w, parseError.Error(), http.StatusBadRequest)
+		return
+	} else if len(points) == 0 {
+		h.writeHeader(w, http.StatusNoContent)
+		return
+	}
+
+	h.writePoints(w, r, database, points, parseError)
+}
@@ -0,0 +1,283 @@
+package httpd
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/lucaswiersma/influxdb/influxql"
+	"github.com/lucaswiersma/influxdb/models"
+)
+
+// msgpackFormatter writes each response as a MessagePack map using the same
+// keys as the JSON encoding. Chunked responses are written as a stream of maps.
+type msgpackFormatter struct {
+	io.Writer
+}
+
+func (w *msgpackFormatter) WriteResponse(resp Response) (int, error) {
+	var b []byte
+	n := 0
+	if len(resp.Results) > 0 {
+		n++
+	}
+	if resp.Err != nil {
+		n++
+	}
+
+	b = appendMsgpackMapHeader(b, n)
+	if len(resp.Results) > 0 {
+		b = appendMsgpackString(b, "results")
+		b = appendMsgpackArrayHeader(b, len(resp.Results))
+		for _, r := range resp.Results {
+			b = appendMsgpackResult(b, r)
+		}
+	}
+	if resp.Err != nil {
+		b = appendMsgpackString(b, "error")
+		b = appendMsgpackString(b, resp.Err.Error())
+	}
+	return w.Write(b)
+}
+
+func appendMsgpackResult(b []byte, r *influxql.Result) []byte {
+	n := 1
+	if len(r.Tags) > 0 {
+		n++
+	}
+	if len(r.Series) > 0 {
+		n++
+	}
+	if len(r.Messages) > 0 {
+		n++
+	}
+	if r.Partial {
+		n++
+	}
+	if r.Checkpoint != "" {
+		n++
+	}
+	if r.Err != nil {
+		n++
+	}
+
+	b = appendMsgpackMapHeader(b, n)
+	b = appendMsgpackString(b, "statement_id")
+	b = appendMsgpackInt(b, int64(r.StatementID))
+	if len(r.Tags) > 0 {
+		b = appendMsgpackString(b, "tags")
+		b = appendMsgpackTags(b, r.Tags)
+	}
+	if len(r.Series) > 0 {
+		b = appendMsgpackString(b, "series")
+		b = appendMsgpackArrayHeader(b, len(r.Series))
+		for _, row := range r.Series {
+			b = appendMsgpackRow(b, row)
+		}
+	}
+	if len(r.Messages) > 0 {
+		b = appendMsgpackString(b, "messages")
+		b = appendMsgpackArrayHeader(b, len(r.Messages))
+		for _, m := range r.Messages {
+			b = appendMsgpackMapHeader(b, 2)
+			b = appendMsgpackString(b, "level")
+			b = appendMsgpackString(b, m.Level)
+			b = appendMsgpackString(b, "text")
+			b = appendMsgpackString(b, m.Text)
+		}
+	}
+	if r.Partial {
+		b = appendMsgpackString(b, "partial")
+		b = appendMsgpackBool(b, true)
+	}
+	if r.Checkpoint != "" {
+		b = appendMsgpackString(b, "checkpoint")
+		b = appendMsgpackString(b, r.Checkpoint)
+	}
+	if r.Err != nil {
+		b = appendMsgpackString(b, "error")
+		b = appendMsgpackString(b, r.Err.Error())
+	}
+	return b
+}
+
+func appendMsgpackRow(b []byte, row *models.Row) []byte {
+	n := 0
+	if row.Name != "" {
+		n++
+	}
+	if len(row.Tags) > 0 {
+		n++
+	}
+	if len(row.Columns) > 0 {
+		n++
+	}
+	if len(row.Values) > 0 {
+		n++
+	}
+	if row.Partial {
+		n++
+	}
+
+	b = appendMsgpackMapHeader(b, n)
+	if row.Name != "" {
+		b = appendMsgpackString(b, "name")
+		b = appendMsgpackString(b, row.Name)
+	}
+	if len(row.Tags) > 0 {
+		b = appendMsgpackString(b, "tags")
+		b = appendMsgpackTags(b, row.Tags)
+	}
+	if len(row.Columns) > 0 {
+		b = appendMsgpackString(b, "columns")
+		b = appendMsgpackArrayHeader(b, len(row.Columns))
+		for _, c := range row.Columns {
+			b = appendMsgpackString(b, c)
+		}
+	}
+	if len(row.Values) > 0 {
+		b = appendMsgpackString(b, "values")
+		b = appendMsgpackArrayHeader(b, len(row.Values))
+		for _, values := range row.Values {
+			b = appendMsgpackArrayHeader(b, len(values))
+			for _, v := range values {
+				b = appendMsgpackValue(b, v)
+			}
+		}
+	}
+	if row.Partial {
+		b = appendMsgpackString(b, "partial")
+		b = appendMsgpackBool(b, true)
+	}
+	return b
+}
+
+// appendMsgpackTags encodes a tag set as a map with sorted keys so the
+// encoding is deterministic.
+func appendMsgpackTags(b []byte, tags map[string]string) []byte {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	b = appendMsgpackMapHeader(b, len(keys))
+	for _, k := range keys {
+		b = appendMsgpackString(b, k)
+		b = appendMsgpackString(b, tags[k])
+	}
+	return b
+}
+
+// appendMsgpackValue encodes a single column value. Times are encoded as
+// RFC3339 strings to match the JSON encoding.
+func appendMsgpackValue(b []byte, v interface{}) []byte {
+	switch v := v.(type) {
+	case nil:
+		return append(b, 0xc0)
+	case float64:
+		return appendMsgpackFloat(b, v)
+	case int64:
+		return appendMsgpackInt(b, v)
+	case int:
+		return appendMsgpackInt(b, int64(v))
+	case uint64:
+		if v > math.MaxInt64 {
+			b = append(b, 0xcf)
+			return appendUint64(b, v)
+		}
+		return appendMsgpackInt(b, int64(v))
+	case string:
+		return appendMsgpackString(b, v)
+	case bool:
+		return appendMsgpackBool(b, v)
+	case time.Time:
+		return appendMsgpackString(b, v.Format(time.RFC3339Nano))
+	case []interface{}:
+		b = appendMsgpackArrayHeader(b, len(v))
+		for _, e := range v {
+			b = appendMsgpackValue(b, e)
+		}
+		return b
+	default:
+		return append(b, 0xc0)
+	}
+}
+
+func appendMsgpackMapHeader(b []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(b, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		return append(b, 0xde, byte(n>>8), byte(n))
+	default:
+		b = append(b, 0xdf)
+		return appendUint32(b, uint32(n))
+	}
+}
+
+func appendMsgpackArrayHeader(b []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(b, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		return append(b, 0xdc, byte(n>>8), byte(n))
+	default:
+		b = append(b, 0xdd)
+		return appendUint32(b, uint32(n))
+	}
+}
+
+func appendMsgpackString(b []byte, s string) []byte {
+	n := len(s)
+	switch {
+	case n < 32:
+		b = append(b, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		b = append(b, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		b = append(b, 0xda, byte(n>>8), byte(n))
+	default:
+		b = append(b, 0xdb)
+		b = appendUint32(b, uint32(n))
+	}
+	return append(b, s...)
+}
+
+func appendMsgpackInt(b []byte, v int64) []byte {
+	switch {
+	case v >= 0 && v <= 127:
+		return append(b, byte(v))
+	case v < 0 && v >= -32:
+		return append(b, byte(v))
+	default:
+		b = append(b, 0xd3)
+		return appendUint64(b, uint64(v))
+	}
+}
+
+func appendMsgpackFloat(b []byte, v float64) []byte {
+	b = append(b, 0xcb)
+	return appendUint64(b, math.Float64bits(v))
+}
+
+func appendMsgpackBool(b []byte, v bool) []byte {
+	if v {
+		return append(b, 0xc3)
+	}
+	return append(b, 0xc2)
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+func appendUint64(b []byte, v uint64) []byte {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], v)
+	return append(b, buf[:]...)
+}
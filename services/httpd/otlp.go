@@ -0,0 +1,555 @@
+package httpd
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/lucaswiersma/influxdb"
+	"github.com/lucaswiersma/influxdb/models"
+	"github.com/lucaswiersma/influxdb/services/meta"
+	"github.com/lucaswiersma/influxdb/tsdb"
+)
+
+// OTLPContentType is the content type of OTLP/HTTP protobuf requests and responses.
+const OTLPContentType = "application/x-protobuf"
+
+// Protobuf wire types used by the OTLP messages.
+const (
+	protoVarint  = 0
+	protoFixed64 = 1
+	protoBytes   = 2
+	protoFixed32 = 5
+)
+
+// serveWriteOTLP receives an OTLP/HTTP ExportMetricsServiceRequest and writes
+// its data points to the database. Data points that cannot be converted or
+// written are reported in the partial success of the response.
+func (h *Handler) serveWriteOTLP(w http.ResponseWriter, r *http.Request, user *meta.UserInfo) {
+	atomic.AddInt64(&h.stats.WriteRequests, 1)
+	atomic.AddInt64(&h.stats.OTLPWriteRequests, 1)
+	atomic.AddInt64(&h.stats.ActiveWriteRequests, 1)
+	defer func(start time.Time) {
+		atomic.AddInt64(&h.stats.ActiveWriteRequests, -1)
+		atomic.AddInt64(&h.stats.WriteRequestDuration, time.Since(start).Nanoseconds())
+	}(time.Now())
+
+	if ct := r.Header.Get("Content-Type"); ct != "" && ct != OTLPContentType {
+		h.httpError(w, fmt.Sprintf("unsupported content type %q: only %s is supported", ct, OTLPContentType), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	database, ok := h.authorizeWriteRequest(w, r, user)
+	if !ok {
+		return
+	}
+
+	consistency := models.ConsistencyLevelOne
+	if level := r.URL.Query().Get("consistency"); level != "" {
+		var err error
+		consistency, err = models.ParseConsistencyLevel(level)
+		if err != nil {
+			h.httpError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	buf, ok := h.readWriteBody(w, r)
+	if !ok {
+		return
+	}
+
+	p := &otlpParser{defaultTime: time.Now().UTC()}
+	if err := p.parseRequest(buf); err != nil {
+		h.httpError(w, fmt.Sprintf("unable to parse OTLP metrics: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	if len(p.points) > 0 {
+		err := h.PointsWriter.WritePoints(database, r.URL.Query().Get("rp"), consistency, p.points)
+		if influxdb.IsClientError(err) {
+			atomic.AddInt64(&h.stats.PointsWrittenFail, int64(len(p.points)))
+			h.httpError(w, err.Error(), http.StatusBadRequest)
+			return
+		} else if werr, ok := err.(tsdb.PartialWriteError); ok {
+			atomic.AddInt64(&h.stats.PointsWrittenOK, int64(len(p.points)-werr.Dropped))
+			atomic.AddInt64(&h.stats.PointsWrittenDropped, int64(werr.Dropped))
+			p.reject(werr.Dropped, fmt.Sprintf("partial write: %v", werr))
+		} else if err != nil {
+			atomic.AddInt64(&h.stats.PointsWrittenFail, int64(len(p.points)))
+			h.httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		} else {
+			atomic.AddInt64(&h.stats.PointsWrittenOK, int64(len(p.points)))
+		}
+	}
+
+	w.Header().Set("Content-Type", OTLPContentType)
+	h.writeHeader(w, http.StatusOK)
+	w.Write(p.response())
+}
+
+// otlpParser converts the data points of an ExportMetricsServiceRequest into
+// points. Each metric is written to the measurement with its name, tagged with
+// the attributes of its resource and data point.
+//
+// Gauge and sum data points have their value in the "value" field. Histogram
+// data points have "count", "sum", "min" and "max" fields along with a
+// cumulative count for each bucket in a field named by its upper bound, such
+// as "le_0.5" and "le_+Inf".
+type otlpParser struct {
+	defaultTime time.Time
+
+	points   []models.Point
+	rejected int
+	message  string
+}
+
+// reject records data points that could not be written. The first error
+// message is kept for the response.
+func (p *otlpParser) reject(n int, msg string) {
+	p.rejected += n
+	if p.message == "" {
+		p.message = msg
+	}
+}
+
+// response returns the encoded ExportMetricsServiceResponse.
+func (p *otlpParser) response() []byte {
+	if p.rejected == 0 {
+		return nil
+	}
+
+	var partial []byte
+	partial = appendProtoVarint(partial, 1, uint64(p.rejected))
+	partial = appendProtoBytes(partial, 2, []byte(p.message))
+	return appendProtoBytes(nil, 1, partial)
+}
+
+// parseRequest parses an ExportMetricsServiceRequest.
+func (p *otlpParser) parseRequest(b []byte) error {
+	r := protoReader{b: b}
+	for r.next() {
+		if r.field == 1 && r.wireType == protoBytes {
+			if err := p.parseResourceMetrics(r.bytes()); err != nil {
+				return err
+			}
+			continue
+		}
+		r.skip()
+	}
+	return r.err
+}
+
+// parseResourceMetrics parses a ResourceMetrics message. The deprecated
+// instrumentation library metrics of older exporters are read as scope metrics.
+func (p *otlpParser) parseResourceMetrics(b []byte) error {
+	var scopes [][]byte
+	tags := make(map[string]string)
+
+	r := protoReader{b: b}
+	for r.next() {
+		switch {
+		case r.field == 1 && r.wireType == protoBytes:
+			if err := parseOTLPResource(r.bytes(), tags); err != nil {
+				return err
+			}
+		case (r.field == 2 || r.field == 1000) && r.wireType == protoBytes:
+			scopes = append(scopes, r.bytes())
+		default:
+			r.skip()
+		}
+	}
+	if r.err != nil {
+		return r.err
+	}
+
+	for _, scope := range scopes {
+		r := protoReader{b: scope}
+		for r.next() {
+			if r.field == 2 && r.wireType == protoBytes {
+				if err := p.parseMetric(r.bytes(), tags); err != nil {
+					return err
+				}
+				continue
+			}
+			r.skip()
+		}
+		if r.err != nil {
+			return r.err
+		}
+	}
+	return nil
+}
+
+// parseMetric parses a Metric message.
+func (p *otlpParser) parseMetric(b []byte, tags map[string]string) error {
+	var name string
+	var kind int
+	var data []byte
+
+	r := protoReader{b: b}
+	for r.next() {
+		switch {
+		case r.field == 1 && r.wireType == protoBytes:
+			name = string(r.bytes())
+		case r.field >= 5 && r.field <= 11 && r.wireType == protoBytes:
+			kind, data = r.field, r.bytes()
+		default:
+			r.skip()
+		}
+	}
+	if r.err != nil {
+		return r.err
+	}
+
+	// Each kind of metric holds its data points in field 1.
+	var dataPoints [][]byte
+	r = protoReader{b: data}
+	for r.next() {
+		if r.field == 1 && r.wireType == protoBytes {
+			dataPoints = append(dataPoints, r.bytes())
+			continue
+		}
+		r.skip()
+	}
+	if r.err != nil {
+		return r.err
+	}
+
+	if name == "" {
+		p.reject(len(dataPoints), "missing metric name")
+		return nil
+	}
+
+	for _, dp := range dataPoints {
+		var err error
+		switch kind {
+		case 5, 7: // Gauge, Sum
+			err = p.parseNumberDataPoint(name, dp, tags)
+		case 9: // Histogram
+			err = p.parseHistogramDataPoint(name, dp, tags)
+		default:
+			p.reject(1, fmt.Sprintf("metric %q: unsupported metric type", name))
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseNumberDataPoint parses a NumberDataPoint of a gauge or sum.
+func (p *otlpParser) parseNumberDataPoint(name string, b []byte, resourceTags map[string]string) error {
+	tags := copyTags(resourceTags)
+	var ts int64
+	var value interface{}
+
+	r := protoReader{b: b}
+	for r.next() {
+		switch {
+		case r.field == 7 && r.wireType == protoBytes:
+			if err := parseOTLPAttributes(r.bytes(), tags); err != nil {
+				return err
+			}
+		case r.field == 3 && r.wireType == protoFixed64:
+			ts = int64(r.fixed64())
+		case r.field == 4 && r.wireType == protoFixed64:
+			value = math.Float64frombits(r.fixed64())
+		case r.field == 6 && r.wireType == protoFixed64:
+			value = int64(r.fixed64())
+		default:
+			r.skip()
+		}
+	}
+	if r.err != nil {
+		return r.err
+	}
+
+	if value == nil {
+		p.reject(1, fmt.Sprintf("metric %q: missing data point value", name))
+		return nil
+	}
+	p.addPoint(name, tags, models.Fields{"value": value}, ts)
+	return nil
+}
+
+// parseHistogramDataPoint parses a HistogramDataPoint.
+func (p *otlpParser) parseHistogramDataPoint(name string, b []byte, resourceTags map[string]string) error {
+	tags := copyTags(resourceTags)
+	var ts int64
+	var counts []uint64
+	var bounds []float64
+	fields := make(models.Fields)
+
+	r := protoReader{b: b}
+	for r.next() {
+		switch {
+		case r.field == 9 && r.wireType == protoBytes:
+			if err := parseOTLPAttributes(r.bytes(), tags); err != nil {
+				return err
+			}
+		case r.field == 3 && r.wireType == protoFixed64:
+			ts = int64(r.fixed64())
+		case r.field == 4 && r.wireType == protoFixed64:
+			fields["count"] = int64(r.fixed64())
+		case r.field == 5 && r.wireType == protoFixed64:
+			fields["sum"] = math.Float64frombits(r.fixed64())
+		case r.field == 11 && r.wireType == protoFixed64:
+			fields["min"] = math.Float64frombits(r.fixed64())
+		case r.field == 12 && r.wireType == protoFixed64:
+			fields["max"] = math.Float64frombits(r.fixed64())
+		case r.field == 6:
+			counts = append(counts, r.repeatedFixed64()...)
+		case r.field == 7:
+			for _, v := range r.repeatedFixed64() {
+				bounds = append(bounds, math.Float64frombits(v))
+			}
+		default:
+			r.skip()
+		}
+	}
+	if r.err != nil {
+		return r.err
+	}
+
+	if len(counts) > 0 && len(counts) != len(bounds)+1 {
+		p.reject(1, fmt.Sprintf("metric %q: %d bucket counts do not match %d explicit bounds", name, len(counts), len(bounds)))
+		return nil
+	}
+
+	var cumulative int64
+	for i, n := range counts {
+		cumulative += int64(n)
+		if i < len(bounds) {
+			fields["le_"+strconv.FormatFloat(bounds[i], 'g', -1, 64)] = cumulative
+		} else {
+			fields["le_+Inf"] = cumulative
+		}
+	}
+
+	if len(fields) == 0 {
+		p.reject(1, fmt.Sprintf("metric %q: missing histogram values", name))
+		return nil
+	}
+	p.addPoint(name, tags, fields, ts)
+	return nil
+}
+
+// addPoint adds a point for a data point, or rejects it if the point is invalid.
+func (p *otlpParser) addPoint(name string, tags map[string]string, fields models.Fields, ts int64) {
+	t := p.defaultTime
+	if ts != 0 {
+		t = time.Unix(0, ts)
+	}
+
+	pt, err := models.NewPoint(name, models.NewTags(tags), fields, t)
+	if err != nil {
+		p.reject(1, fmt.Sprintf("metric %q: %s", name, err))
+		return
+	}
+	p.points = append(p.points, pt)
+}
+
+// parseOTLPResource parses the attributes of a Resource message into tags.
+func parseOTLPResource(b []byte, tags map[string]string) error {
+	r := protoReader{b: b}
+	for r.next() {
+		if r.field == 1 && r.wireType == protoBytes {
+			if err := parseOTLPAttributes(r.bytes(), tags); err != nil {
+				return err
+			}
+			continue
+		}
+		r.skip()
+	}
+	return r.err
+}
+
+// parseOTLPAttributes parses a KeyValue message into tags. Attributes with
+// array or key/value list values are ignored.
+func parseOTLPAttributes(b []byte, tags map[string]string) error {
+	var key string
+	var value []byte
+
+	r := protoReader{b: b}
+	for r.next() {
+		switch {
+		case r.field == 1 && r.wireType == protoBytes:
+			key = string(r.bytes())
+		case r.field == 2 && r.wireType == protoBytes:
+			value = r.bytes()
+		default:
+			r.skip()
+		}
+	}
+	if r.err != nil {
+		return r.err
+	}
+
+	var s string
+	r = protoReader{b: value}
+	for r.next() {
+		switch {
+		case r.field == 1 && r.wireType == protoBytes:
+			s = string(r.bytes())
+		case r.field == 2 && r.wireType == protoVarint:
+			s = strconv.FormatBool(r.varint() != 0)
+		case r.field == 3 && r.wireType == protoVarint:
+			s = strconv.FormatInt(int64(r.varint()), 10)
+		case r.field == 4 && r.wireType == protoFixed64:
+			s = strconv.FormatFloat(math.Float64frombits(r.fixed64()), 'g', -1, 64)
+		case r.field == 7 && r.wireType == protoBytes:
+			s = base64.StdEncoding.EncodeToString(r.bytes())
+		default:
+			r.skip()
+		}
+	}
+	if r.err != nil {
+		return r.err
+	}
+
+	if key != "" && s != "" {
+		tags[key] = s
+	}
+	return nil
+}
+
+// copyTags returns a copy of tags.
+func copyTags(tags map[string]string) map[string]string {
+	other := make(map[string]string, len(tags))
+	for k, v := range tags {
+		other[k] = v
+	}
+	return other
+}
+
+// protoReader reads the fields of an encoded protobuf message.
+type protoReader struct {
+	b   []byte
+	err error
+
+	field    int
+	wireType int
+}
+
+// next reads the key of the next field. It returns false at the end of the
+// message or on error.
+func (r *protoReader) next() bool {
+	if r.err != nil || len(r.b) == 0 {
+		return false
+	}
+	key := r.varint()
+	if r.err != nil {
+		return false
+	}
+	r.field, r.wireType = int(key>>3), int(key&7)
+	return true
+}
+
+func (r *protoReader) varint() uint64 {
+	v, n := binary.Uvarint(r.b)
+	if n <= 0 {
+		r.fail()
+		return 0
+	}
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *protoReader) fixed64() uint64 {
+	if len(r.b) < 8 {
+		r.fail()
+		return 0
+	}
+	v := binary.LittleEndian.Uint64(r.b)
+	r.b = r.b[8:]
+	return v
+}
+
+func (r *protoReader) bytes() []byte {
+	n := r.varint()
+	if r.err != nil {
+		return nil
+	} else if n > uint64(len(r.b)) {
+		r.fail()
+		return nil
+	}
+	v := r.b[:n]
+	r.b = r.b[n:]
+	return v
+}
+
+// repeatedFixed64 reads a packed or unpacked element of a repeated fixed64
+// or double field.
+func (r *protoReader) repeatedFixed64() []uint64 {
+	switch r.wireType {
+	case protoFixed64:
+		return []uint64{r.fixed64()}
+	case protoBytes:
+		b := r.bytes()
+		if len(b)%8 != 0 {
+			r.fail()
+			return nil
+		}
+		values := make([]uint64, 0, len(b)/8)
+		for ; len(b) > 0; b = b[8:] {
+			values = append(values, binary.LittleEndian.Uint64(b))
+		}
+		return values
+	}
+	r.skip()
+	return nil
+}
+
+// skip skips the value of the current field.
+func (r *protoReader) skip() {
+	switch r.wireType {
+	case protoVarint:
+		r.varint()
+	case protoFixed64:
+		r.fixed64()
+	case protoBytes:
+		r.bytes()
+	case protoFixed32:
+		if len(r.b) < 4 {
+			r.fail()
+			return
+		}
+		r.b = r.b[4:]
+	default:
+		r.err = fmt.Errorf("unsupported wire type %d", r.wireType)
+	}
+}
+
+func (r *protoReader) fail() {
+	if r.err == nil {
+		r.err = errors.New("truncated message")
+	}
+}
+
+// appendProtoVarint appends a varint field to b.
+func appendProtoVarint(b []byte, field int, v uint64) []byte {
+	b = appendUvarint(b, uint64(field<<3|protoVarint))
+	return appendUvarint(b, v)
+}
+
+// appendProtoBytes appends a length delimited field to b.
+func appendProtoBytes(b []byte, field int, v []byte) []byte {
+	b = appendUvarint(b, uint64(field<<3|protoBytes))
+	b = appendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+	return append(b, buf[:n]...)
+}
@@ -1,6 +1,8 @@
 package httpd
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
@@ -27,6 +29,15 @@ func (l *responseLogger) CloseNotify() <-chan bool {
 	return make(<-chan bool)
 }
 
+func (l *responseLogger) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := l.w.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	l.status = http.StatusSwitchingProtocols
+	return hj.Hijack()
+}
+
 func (l *responseLogger) Header() http.Header {
 	return l.w.Header()
 }
@@ -1,9 +1,13 @@
 package httpd
 
 import (
+	"bufio"
 	"encoding/csv"
 	"encoding/json"
+	"errors"
+	"hash"
 	"io"
+	"net"
 	"net/http"
 	"strconv"
 	"time"
@@ -27,12 +31,15 @@ func NewResponseWriter(w http.ResponseWriter, r *http.Request) ResponseWriter {
 	switch r.Header.Get("Accept") {
 	case "application/csv", "text/csv":
 		w.Header().Add("Content-Type", "text/csv")
-		rw.formatter = &csvFormatter{statementID: -1, Writer: w}
+		rw.formatter = &csvFormatter{statementID: -1, Writer: rw}
+	case "application/x-msgpack":
+		w.Header().Add("Content-Type", "application/x-msgpack")
+		rw.formatter = &msgpackFormatter{Writer: rw}
 	case "application/json":
 		fallthrough
 	default:
 		w.Header().Add("Content-Type", "application/json")
-		rw.formatter = &jsonFormatter{Pretty: pretty, Writer: w}
+		rw.formatter = &jsonFormatter{Pretty: pretty, Writer: rw}
 	}
 	return rw
 }
@@ -48,6 +55,13 @@ type responseWriter struct {
 		WriteResponse(resp Response) (int, error)
 	}
 	http.ResponseWriter
+
+	// checksum, if set, is updated with everything written to the response.
+	checksum hash.Hash32
+
+	// buf, if set, holds what is written until the response is flushed so
+	// several chunks are sent with one network write.
+	buf *bufio.Writer
 }
 
 // WriteResponse writes the response using the formatter.
@@ -55,13 +69,41 @@ func (w *responseWriter) WriteResponse(resp Response) (int, error) {
 	return w.formatter.WriteResponse(resp)
 }
 
-// Flush flushes the ResponseWriter if it has a Flush() method.
+// Write writes b to the underlying http.ResponseWriter and adds it to the
+// checksum.
+func (w *responseWriter) Write(b []byte) (int, error) {
+	var n int
+	var err error
+	if w.buf != nil {
+		n, err = w.buf.Write(b)
+	} else {
+		n, err = w.ResponseWriter.Write(b)
+	}
+	if w.checksum != nil {
+		w.checksum.Write(b[:n])
+	}
+	return n, err
+}
+
+// Flush writes out any buffered data and flushes the ResponseWriter if it
+// has a Flush() method.
 func (w *responseWriter) Flush() {
+	if w.buf != nil {
+		w.buf.Flush()
+	}
 	if w, ok := w.ResponseWriter.(http.Flusher); ok {
 		w.Flush()
 	}
 }
 
+// Hijack hijacks the underlying http.ResponseWriter if it supports it.
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hj, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return hj.Hijack()
+	}
+	return nil, nil, errors.New("response writer does not support hijacking")
+}
+
 // CloseNotify calls CloseNotify on the underlying http.ResponseWriter if it
 // exists. Otherwise, it returns a nil channel that will never notify.
 func (w *responseWriter) CloseNotify() <-chan bool {
@@ -138,8 +180,22 @@ func (w *csvFormatter) WriteResponse(resp Response) (n int, err error) {
 
 		for _, row := range result.Series {
 			w.columns[0] = row.Name
-			if len(row.Tags) > 0 {
-				w.columns[1] = string(models.NewTags(row.Tags).HashKey()[1:])
+
+			// CSV has no place for the tags of the result, so they are
+			// written with the tags of every row.
+			tags := row.Tags
+			if len(result.Tags) > 0 {
+				tags = make(map[string]string, len(result.Tags)+len(row.Tags))
+				for k, v := range result.Tags {
+					tags[k] = v
+				}
+				for k, v := range row.Tags {
+					tags[k] = v
+				}
+			}
+
+			if len(tags) > 0 {
+				w.columns[1] = string(models.NewTags(tags).HashKey()[1:])
 			} else {
 				w.columns[1] = ""
 			}
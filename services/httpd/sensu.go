@@ -0,0 +1,120 @@
+package httpd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lucaswiersma/influxdb/models"
+)
+
+// sensuMetrics is the metrics section of a Sensu Go event.
+type sensuMetrics struct {
+	Points []sensuMetricPoint `json:"points"`
+}
+
+// sensuMetricPoint is a single metric point produced by a Sensu Go check.
+type sensuMetricPoint struct {
+	Name      string           `json:"name"`
+	Value     *float64         `json:"value"`
+	Timestamp int64            `json:"timestamp"`
+	Tags      []sensuMetricTag `json:"tags"`
+}
+
+// sensuMetricTag is a name/value pair attached to a Sensu Go metric point.
+type sensuMetricTag struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// parseSensuPoints parses a Sensu Go event, or the bare metrics section of an
+// event, into points. Each metric becomes a point in the measurement named by
+// the metric with its value in the "value" field. Timestamps are interpreted
+// using precision, defaulting to seconds, and metrics without a timestamp are
+// assigned defaultTime.
+//
+// Metrics that cannot be converted are skipped and reported in the returned
+// error alongside the points that were parsed successfully.
+func parseSensuPoints(buf []byte, defaultTime time.Time, precision string) ([]models.Point, error) {
+	var body struct {
+		Metrics *sensuMetrics      `json:"metrics"`
+		Points  []sensuMetricPoint `json:"points"`
+	}
+	if err := json.Unmarshal(buf, &body); err != nil {
+		return nil, fmt.Errorf("unable to parse sensu metrics: %s", err)
+	}
+
+	metrics := body.Points
+	if body.Metrics != nil {
+		metrics = body.Metrics.Points
+	}
+
+	multiplier, err := sensuPrecisionMultiplier(precision)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		points []models.Point
+		failed []string
+	)
+	for i, m := range metrics {
+		pt, err := m.point(defaultTime, multiplier)
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("unable to parse metric %d (%q): %s", i, m.Name, err))
+			continue
+		}
+		points = append(points, pt)
+	}
+
+	if len(failed) > 0 {
+		return points, errors.New(strings.Join(failed, "\n"))
+	}
+	return points, nil
+}
+
+// point converts the metric to a point.
+func (m *sensuMetricPoint) point(defaultTime time.Time, multiplier int64) (models.Point, error) {
+	if m.Name == "" {
+		return nil, errors.New("missing metric name")
+	} else if m.Value == nil {
+		return nil, errors.New("missing metric value")
+	}
+
+	tags := make(map[string]string, len(m.Tags))
+	for _, tag := range m.Tags {
+		if tag.Name == "" {
+			return nil, errors.New("missing tag name")
+		} else if tag.Value == "" {
+			// Empty tag values cannot be stored so drop the tag.
+			continue
+		}
+		tags[tag.Name] = tag.Value
+	}
+
+	t := defaultTime
+	if m.Timestamp != 0 {
+		t = time.Unix(0, m.Timestamp*multiplier).UTC()
+	}
+
+	return models.NewPoint(m.Name, models.NewTags(tags), models.Fields{"value": *m.Value}, t)
+}
+
+// sensuPrecisionMultiplier returns the number of nanoseconds in a unit of
+// precision. Sensu Go reports timestamps in seconds so that is the default.
+func sensuPrecisionMultiplier(precision string) (int64, error) {
+	switch precision {
+	case "n", "ns":
+		return 1, nil
+	case "u":
+		return int64(time.Microsecond), nil
+	case "ms":
+		return int64(time.Millisecond), nil
+	case "", "s":
+		return int64(time.Second), nil
+	default:
+		return 0, fmt.Errorf("unsupported precision %q", precision)
+	}
+}
@@ -14,6 +14,7 @@ import (
 	"time"
 
 	"github.com/lucaswiersma/influxdb/models"
+	"github.com/lucaswiersma/influxdb/pkg/tlsconfig"
 	"go.uber.org/zap"
 )
 
@@ -22,14 +23,25 @@ const (
 	statRequest                      = "req"                  // Number of HTTP requests served
 	statQueryRequest                 = "queryReq"             // Number of query requests served
 	statWriteRequest                 = "writeReq"             // Number of write requests serverd
+	statSensuWriteRequest            = "sensuWriteReq"        // Number of Sensu Go metrics write requests served
+	statOTLPWriteRequest             = "otlpWriteReq"         // Number of OTLP metrics write requests served
+	statJSONWriteRequest             = "jsonWriteReq"         // Number of JSON document write requests served
+	statJSONMappingFail              = "jsonMappingFail"      // Number of JSON documents that could not be mapped to a point
+	statStreamWriteRequest           = "streamWriteReq"       // Number of streaming write connections served
 	statPingRequest                  = "pingReq"              // Number of ping requests served
 	statStatusRequest                = "statusReq"            // Number of status requests served
 	statWriteRequestBytesReceived    = "writeReqBytes"        // Sum of all bytes in write requests
 	statQueryRequestBytesTransmitted = "queryRespBytes"       // Sum of all bytes returned in query reponses
+	statQueryRequestMsgpack          = "queryReqMsgpack"      // Number of query requests served as MessagePack
+	statQueryBatchRequest            = "queryBatchReq"        // Number of batched query requests served
+	statQueryBatchCombined           = "queryBatchCombined"   // Number of batched queries executed together with another query
 	statPointsWrittenOK              = "pointsWrittenOK"      // Number of points written OK
 	statPointsWrittenDropped         = "pointsWrittenDropped" // Number of points dropped by the storage engine
 	statPointsWrittenFail            = "pointsWrittenFail"    // Number of points that failed to be written
+	statPointsNormalized             = "pointsNormalized"     // Number of written points with names converted to NFC
 	statAuthFail                     = "authFail"             // Number of authentication failures
+	statAuthHookDenied               = "authHookDenied"       // Number of requests denied by the authorization hook
+	statIdempotentWriteHit           = "idempotentWriteHit"   // Number of writes answered from the idempotency key cache
 	statRequestDuration              = "reqDurationNs"        // Number of (wall-time) nanoseconds spent inside requests
 	statQueryRequestDuration         = "queryReqDurationNs"   // Number of (wall-time) nanoseconds spent inside query requests
 	statWriteRequestDuration         = "writeReqDurationNs"   // Number of (wall-time) nanoseconds spent inside write requests
@@ -46,6 +58,7 @@ type Service struct {
 	https bool
 	cert  string
 	key   string
+	ca    string
 	limit int
 	err   chan error
 
@@ -65,6 +78,7 @@ func NewService(c Config) *Service {
 		https:      c.HTTPSEnabled,
 		cert:       c.HTTPSCertificate,
 		key:        c.HTTPSPrivateKey,
+		ca:         c.HTTPSClientCA,
 		limit:      c.MaxConnectionLimit,
 		err:        make(chan error),
 		unixSocket: c.UnixSocketEnabled,
@@ -86,14 +100,12 @@ func (s *Service) Open() error {
 
 	// Open listener.
 	if s.https {
-		cert, err := tls.LoadX509KeyPair(s.cert, s.key)
+		config, err := tlsconfig.New(s.cert, s.key, s.ca)
 		if err != nil {
 			return err
 		}
 
-		listener, err := tls.Listen("tcp", s.addr, &tls.Config{
-			Certificates: []tls.Certificate{cert},
-		})
+		listener, err := tls.Listen("tcp", s.addr, config)
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,240 @@
+package httpd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/lucaswiersma/influxdb"
+	"github.com/lucaswiersma/influxdb/models"
+	"github.com/lucaswiersma/influxdb/services/meta"
+	"github.com/lucaswiersma/influxdb/tsdb"
+)
+
+const (
+	// StreamWriteProtocol is the Upgrade token a client sends to stream line
+	// protocol writes over a persistent connection.
+	StreamWriteProtocol = "influxdb-line-protocol"
+
+	// maxStreamLineSize is the longest line accepted on a streaming write
+	// connection. Longer lines close the connection.
+	maxStreamLineSize = 1024 * 1024
+)
+
+// streamAck is sent to a streaming write client after each batch is written.
+type streamAck struct {
+	Written  int    `json:"written"`
+	Rejected int    `json:"rejected,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// serveWriteStream upgrades the connection to a stream of newline delimited
+// line protocol. Points are written in batches of up to stream-batch-size
+// points, or after stream-batch-timeout, and an ack frame of JSON describing
+// each batch is written back to the client. The stream ends when the client
+// closes its side of the connection.
+func (h *Handler) serveWriteStream(w http.ResponseWriter, r *http.Request, user *meta.UserInfo) {
+	atomic.AddInt64(&h.stats.WriteRequests, 1)
+	atomic.AddInt64(&h.stats.StreamWriteRequests, 1)
+	atomic.AddInt64(&h.stats.ActiveWriteRequests, 1)
+	defer func(start time.Time) {
+		atomic.AddInt64(&h.stats.ActiveWriteRequests, -1)
+		atomic.AddInt64(&h.stats.WriteRequestDuration, time.Since(start).Nanoseconds())
+	}(time.Now())
+
+	if !strings.EqualFold(r.Header.Get("Upgrade"), StreamWriteProtocol) {
+		w.Header().Set("Upgrade", StreamWriteProtocol)
+		h.httpError(w, fmt.Sprintf("streaming writes require an Upgrade: %s header", StreamWriteProtocol), http.StatusUpgradeRequired)
+		return
+	}
+
+	database, ok := h.authorizeWriteRequest(w, r, user)
+	if !ok {
+		return
+	}
+
+	consistency := models.ConsistencyLevelOne
+	if level := r.URL.Query().Get("consistency"); level != "" {
+		var err error
+		consistency, err = models.ParseConsistencyLevel(level)
+		if err != nil {
+			h.httpError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		h.httpError(w, "streaming writes are not supported by this connection", http.StatusInternalServerError)
+		return
+	}
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		h.httpError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer conn.Close()
+
+	// The stream is long lived so remove any deadlines set by the server.
+	conn.SetDeadline(time.Time{})
+
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+	rw.WriteString("Upgrade: " + StreamWriteProtocol + "\r\n")
+	rw.WriteString("Connection: Upgrade\r\n")
+	rw.WriteString("X-Influxdb-Version: " + h.Version + "\r\n\r\n")
+	if err := rw.Flush(); err != nil {
+		return
+	}
+
+	s := &writeStream{
+		h:           h,
+		w:           rw.Writer,
+		database:    database,
+		rp:          r.URL.Query().Get("rp"),
+		precision:   h.writePrecision(r, database),
+		consistency: consistency,
+	}
+	s.serve(rw.Reader)
+}
+
+// writeStream writes the points streamed over a single connection.
+type writeStream struct {
+	h *Handler
+	w *bufio.Writer
+
+	database    string
+	rp          string
+	precision   string
+	consistency models.ConsistencyLevel
+
+	batch    []models.Point
+	rejected int
+	parseErr error
+}
+
+// serve reads lines from r until the client closes the stream, writing
+// batches as they fill or time out.
+func (s *writeStream) serve(r *bufio.Reader) {
+	lines := make(chan []byte)
+	readErr := make(chan error, 1)
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		defer close(lines)
+
+		// The scanner holds a partial line until the rest of it arrives, and
+		// a final line without a trailing newline is still returned at EOF.
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 0, 64*1024), maxStreamLineSize)
+		for scanner.Scan() {
+			line := scanner.Bytes()
+			atomic.AddInt64(&s.h.stats.WriteRequestBytesReceived, int64(len(line)+1))
+			if len(line) == 0 {
+				continue
+			}
+			select {
+			case lines <- append([]byte(nil), line...):
+			case <-done:
+				return
+			}
+		}
+		readErr <- scanner.Err()
+	}()
+
+	size, timeout := s.h.Config.StreamBatchSize, time.Duration(s.h.Config.StreamBatchTimeout)
+	if size <= 0 {
+		size = DefaultStreamBatchSize
+	}
+	if timeout <= 0 {
+		timeout = DefaultStreamBatchTimeout
+	}
+
+	timer := time.NewTimer(timeout)
+	timer.Stop()
+	var timerCh <-chan time.Time
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				if err := <-readErr; err != nil && s.parseErr == nil {
+					s.parseErr = err
+				}
+				s.flush()
+				return
+			}
+
+			if len(s.batch) == 0 && s.rejected == 0 {
+				timer.Reset(timeout)
+				timerCh = timer.C
+			}
+
+			points, err := s.h.parsePoints(line, time.Now().UTC(), s.precision, s.database)
+			if err != nil {
+				s.rejected++
+				if s.parseErr == nil {
+					s.parseErr = err
+				}
+			}
+			s.batch = append(s.batch, points...)
+
+			if len(s.batch) >= size {
+				timer.Stop()
+				timerCh = nil
+				if !s.flush() {
+					return
+				}
+			}
+		case <-timerCh:
+			timerCh = nil
+			if !s.flush() {
+				return
+			}
+		}
+	}
+}
+
+// flush writes the pending batch and sends its ack to the client. It returns
+// false if the ack could not be sent.
+func (s *writeStream) flush() bool {
+	if len(s.batch) == 0 && s.rejected == 0 && s.parseErr == nil {
+		return true
+	}
+
+	ack := streamAck{Rejected: s.rejected}
+	if s.parseErr != nil {
+		ack.Error = s.parseErr.Error()
+	}
+
+	if len(s.batch) > 0 {
+		stats := s.h.stats
+		err := s.h.PointsWriter.WritePoints(s.database, s.rp, s.consistency, s.batch)
+		if werr, ok := err.(tsdb.PartialWriteError); ok {
+			atomic.AddInt64(&stats.PointsWrittenOK, int64(len(s.batch)-werr.Dropped))
+			atomic.AddInt64(&stats.PointsWrittenDropped, int64(werr.Dropped))
+			ack.Written = len(s.batch) - werr.Dropped
+			ack.Rejected += werr.Dropped
+			ack.Error = fmt.Sprintf("partial write: %v", werr)
+		} else if err != nil {
+			atomic.AddInt64(&stats.PointsWrittenFail, int64(len(s.batch)))
+			ack.Rejected += len(s.batch)
+			ack.Error = err.Error()
+			if !influxdb.IsClientError(err) {
+				s.h.Logger.Info(fmt.Sprintf("Streaming write to %q failed: %s", s.database, err))
+			}
+		} else {
+			atomic.AddInt64(&stats.PointsWrittenOK, int64(len(s.batch)))
+			ack.Written = len(s.batch)
+		}
+	}
+	s.batch, s.rejected, s.parseErr = nil, 0, nil
+
+	b, _ := json.Marshal(ack)
+	s.w.Write(b)
+	s.w.WriteByte('\n')
+	return s.w.Flush() == nil
+}
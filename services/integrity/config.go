@@ -0,0 +1,89 @@
+package integrity
+
+import (
+	"errors"
+	"time"
+
+	"github.com/lucaswiersma/influxdb/monitor/diagnostics"
+	"github.com/lucaswiersma/influxdb/toml"
+)
+
+const (
+	// DefaultScanInterval is how long the service waits between scans if
+	// no interval is specified.
+	DefaultScanInterval = 24 * time.Hour
+
+	// DefaultScanRate is the default maximum number of bytes read per second.
+	DefaultScanRate = 8 * 1024 * 1024
+
+	// DefaultIdleDuration is how long a shard must not have been written to
+	// before it is scanned if no duration is specified.
+	DefaultIdleDuration = 10 * time.Minute
+)
+
+// Config represents the configuration for the integrity service.
+type Config struct {
+	Enabled bool `toml:"enabled"`
+
+	// ScanInterval is how long the service waits after scanning every shard
+	// before it starts the next scan.
+	ScanInterval toml.Duration `toml:"scan-interval"`
+
+	// ScanRate is the maximum number of bytes read per second while
+	// scanning. A value of 0 does not throttle the scan.
+	ScanRate toml.Size `toml:"scan-rate"`
+
+	// IdleDuration is how long a shard must not have been written to before
+	// it is scanned. Busier shards are left for the next scan. A value of 0
+	// scans every shard.
+	IdleDuration toml.Duration `toml:"idle-duration"`
+
+	// Quarantine removes files with corrupt blocks from their shards. They
+	// are kept in the shard's corrupt directory.
+	Quarantine bool `toml:"quarantine-corrupt-files"`
+}
+
+// NewConfig returns a new Config with defaults.
+func NewConfig() Config {
+	return Config{
+		Enabled:      false,
+		ScanInterval: toml.Duration(DefaultScanInterval),
+		ScanRate:     toml.Size(DefaultScanRate),
+		IdleDuration: toml.Duration(DefaultIdleDuration),
+	}
+}
+
+// Validate returns an error if the Config is invalid.
+func (c Config) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+
+	if c.ScanInterval <= 0 {
+		return errors.New("scan-interval must be positive")
+	}
+	if c.ScanRate < 0 {
+		return errors.New("scan-rate must be greater than or equal to 0")
+	}
+	if c.IdleDuration < 0 {
+		return errors.New("idle-duration must be greater than or equal to 0")
+	}
+	return nil
+}
+
+// Diagnostics returns a diagnostics representation of a subset of the Config.
+func (c Config) Diagnostics() (*diagnostics.Diagnostics, error) {
+	if !c.Enabled {
+		return diagnostics.RowFromMap(map[string]interface{}{
+			"enabled": false,
+		}), nil
+	}
+
+	return diagnostics.RowFromMap(map[string]interface{}{
+		"enabled":                  true,
+		"scan-interval":            c.ScanInterval,
+		"scan-rate":                c.ScanRate,
+		"idle-duration":            c.IdleDuration,
+		"quarantine-corrupt-files": c.Quarantine,
+	}), nil
+}
@@ -0,0 +1,63 @@
+package integrity_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/lucaswiersma/influxdb/services/integrity"
+)
+
+func TestConfig_Parse(t *testing.T) {
+	// Parse configuration.
+	var c integrity.Config
+	if _, err := toml.Decode(`
+enabled = true
+scan-interval = "12h"
+scan-rate = "16m"
+idle-duration = "1h"
+quarantine-corrupt-files = true
+`, &c); err != nil {
+		t.Fatal(err)
+	}
+
+	// Validate configuration.
+	if !c.Enabled {
+		t.Fatalf("unexpected enabled state: %v", c.Enabled)
+	} else if time.Duration(c.ScanInterval) != 12*time.Hour {
+		t.Fatalf("unexpected scan interval: %v", c.ScanInterval)
+	} else if c.ScanRate != 16*1024*1024 {
+		t.Fatalf("unexpected scan rate: %d", c.ScanRate)
+	} else if time.Duration(c.IdleDuration) != time.Hour {
+		t.Fatalf("unexpected idle duration: %v", c.IdleDuration)
+	} else if !c.Quarantine {
+		t.Fatalf("unexpected quarantine state: %v", c.Quarantine)
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	c := integrity.NewConfig()
+	c.Enabled = true
+	if err := c.Validate(); err != nil {
+		t.Fatalf("unexpected validation fail from NewConfig: %s", err)
+	}
+
+	c.ScanInterval = 0
+	if err := c.Validate(); err == nil {
+		t.Fatal("expected error for scan-interval = 0, got nil")
+	}
+
+	c = integrity.NewConfig()
+	c.Enabled = true
+	c.ScanRate = -1
+	if err := c.Validate(); err == nil {
+		t.Fatal("expected error for negative scan-rate, got nil")
+	}
+
+	c = integrity.NewConfig()
+	c.Enabled = true
+	c.IdleDuration = -1
+	if err := c.Validate(); err == nil {
+		t.Fatal("expected error for negative idle-duration, got nil")
+	}
+}
@@ -0,0 +1,257 @@
+// Package integrity provides a service that scans the local shards in the
+// background for corrupt blocks.
+package integrity // import "github.com/lucaswiersma/influxdb/services/integrity"
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lucaswiersma/influxdb/models"
+	"github.com/lucaswiersma/influxdb/tsdb"
+	"go.uber.org/zap"
+)
+
+// Statistics for the integrity service.
+const (
+	statScans            = "scans"
+	statScanErrors       = "scanErrors"
+	statScanProgress     = "scanProgress"
+	statShardsScanned    = "shardsScanned"
+	statShardsSkipped    = "shardsSkipped"
+	statFilesScanned     = "filesScanned"
+	statBlocksScanned    = "blocksScanned"
+	statBytesScanned     = "bytesScanned"
+	statCorruptBlocks    = "corruptBlocks"
+	statCorruptFiles     = "corruptFiles"
+	statQuarantinedFiles = "quarantinedFiles"
+)
+
+// errClosed stops a scan when the service is closed.
+var errClosed = errors.New("integrity service closed")
+
+// Service periodically checks the checksums of the blocks in the files of
+// every local shard. Scans are throttled to a maximum rate and skip shards
+// that are being written to.
+type Service struct {
+	TSDBStore interface {
+		ShardIDs() []uint64
+		ShardLastModified(id uint64) (time.Time, error)
+		VerifyShard(id uint64, wait func(n int) error, quarantine bool) (tsdb.VerifyStats, error)
+	}
+
+	interval   time.Duration
+	rate       int64
+	idle       time.Duration
+	quarantine bool
+
+	wg   sync.WaitGroup
+	done chan struct{}
+
+	stats  *Statistics
+	logger zap.Logger
+
+	// sleep waits for d or until the service is closed. It can be replaced
+	// for testing.
+	sleep func(d time.Duration) error
+}
+
+// NewService returns a configured integrity service.
+func NewService(c Config) *Service {
+	s := &Service{
+		interval:   time.Duration(c.ScanInterval),
+		rate:       int64(c.ScanRate),
+		idle:       time.Duration(c.IdleDuration),
+		quarantine: c.Quarantine,
+		done:       make(chan struct{}),
+		stats:      &Statistics{},
+		logger:     zap.New(zap.NullEncoder()),
+	}
+	s.sleep = s.wait
+	return s
+}
+
+// Open starts scanning the shards.
+func (s *Service) Open() error {
+	s.logger.Info(fmt.Sprintf("Starting integrity service with interval of %s and rate of %d bytes/s", s.interval, s.rate))
+	s.wg.Add(1)
+	go s.run()
+	return nil
+}
+
+// Close stops the service, interrupting a running scan.
+func (s *Service) Close() error {
+	s.logger.Info("integrity service terminating")
+	close(s.done)
+	s.wg.Wait()
+	return nil
+}
+
+// WithLogger sets the logger on the service.
+func (s *Service) WithLogger(log zap.Logger) {
+	s.logger = log.With(zap.String("service", "integrity"))
+}
+
+// Statistics maintains statistics for the integrity service.
+type Statistics struct {
+	Scans            int64
+	ScanErrors       int64
+	ShardsScanned    int64
+	ShardsSkipped    int64
+	FilesScanned     int64
+	BlocksScanned    int64
+	BytesScanned     int64
+	CorruptBlocks    int64
+	CorruptFiles     int64
+	QuarantinedFiles int64
+
+	// ScanShards is the number of shards in the running scan and ScanDone
+	// the number of them that have been scanned or skipped.
+	ScanShards int64
+	ScanDone   int64
+}
+
+// Statistics returns statistics for periodic monitoring.
+func (s *Service) Statistics(tags map[string]string) []models.Statistic {
+	// Progress is the percentage of the shards of the running scan that are
+	// done, or 100 if no scan is running.
+	progress := 100.0
+	if n := atomic.LoadInt64(&s.stats.ScanShards); n > 0 {
+		progress = float64(atomic.LoadInt64(&s.stats.ScanDone)) * 100 / float64(n)
+	}
+
+	return []models.Statistic{{
+		Name: "integrity",
+		Tags: tags,
+		Values: map[string]interface{}{
+			statScans:            atomic.LoadInt64(&s.stats.Scans),
+			statScanErrors:       atomic.LoadInt64(&s.stats.ScanErrors),
+			statScanProgress:     progress,
+			statShardsScanned:    atomic.LoadInt64(&s.stats.ShardsScanned),
+			statShardsSkipped:    atomic.LoadInt64(&s.stats.ShardsSkipped),
+			statFilesScanned:     atomic.LoadInt64(&s.stats.FilesScanned),
+			statBlocksScanned:    atomic.LoadInt64(&s.stats.BlocksScanned),
+			statBytesScanned:     atomic.LoadInt64(&s.stats.BytesScanned),
+			statCorruptBlocks:    atomic.LoadInt64(&s.stats.CorruptBlocks),
+			statCorruptFiles:     atomic.LoadInt64(&s.stats.CorruptFiles),
+			statQuarantinedFiles: atomic.LoadInt64(&s.stats.QuarantinedFiles),
+		},
+	}}
+}
+
+func (s *Service) run() {
+	defer s.wg.Done()
+
+	for {
+		if err := s.scan(time.Now()); err == errClosed {
+			return
+		}
+
+		select {
+		case <-s.done:
+			return
+		case <-time.After(s.interval):
+		}
+	}
+}
+
+// scan checks every local shard that has not been written to since the idle
+// duration before now.
+func (s *Service) scan(now time.Time) error {
+	ids := s.TSDBStore.ShardIDs()
+	atomic.StoreInt64(&s.stats.ScanDone, 0)
+	atomic.StoreInt64(&s.stats.ScanShards, int64(len(ids)))
+	defer atomic.StoreInt64(&s.stats.ScanShards, 0)
+
+	start := time.Now()
+	var corrupt int
+	for _, id := range ids {
+		n, err := s.scanShard(id, now)
+		atomic.AddInt64(&s.stats.ScanDone, 1)
+		if err == errClosed {
+			return err
+		} else if err != nil {
+			atomic.AddInt64(&s.stats.ScanErrors, 1)
+			s.logger.Info(fmt.Sprintf("error scanning shard %d: %s", id, err))
+		}
+		corrupt += n
+	}
+
+	atomic.AddInt64(&s.stats.Scans, 1)
+	s.logger.Info(fmt.Sprintf("integrity scan of %d shards complete in %s: %d corrupt files", len(ids), time.Since(start), corrupt))
+	return nil
+}
+
+// scanShard checks a shard unless it is being written to and returns the
+// number of corrupt files found.
+func (s *Service) scanShard(id uint64, now time.Time) (int, error) {
+	if s.idle > 0 {
+		modified, err := s.TSDBStore.ShardLastModified(id)
+		if err != nil {
+			return 0, err
+		} else if now.Sub(modified) < s.idle {
+			atomic.AddInt64(&s.stats.ShardsSkipped, 1)
+			return 0, nil
+		}
+	}
+
+	stats, err := s.TSDBStore.VerifyShard(id, s.throttle(), s.quarantine)
+	atomic.AddInt64(&s.stats.FilesScanned, stats.Files)
+	atomic.AddInt64(&s.stats.BlocksScanned, stats.Blocks)
+	atomic.AddInt64(&s.stats.CorruptBlocks, stats.CorruptBlocks)
+	atomic.AddInt64(&s.stats.CorruptFiles, int64(len(stats.CorruptFiles)))
+	atomic.AddInt64(&s.stats.QuarantinedFiles, int64(len(stats.QuarantinedFiles)))
+	if err != nil {
+		return len(stats.CorruptFiles), err
+	}
+	atomic.AddInt64(&s.stats.ShardsScanned, 1)
+
+	for _, path := range stats.CorruptFiles {
+		s.logger.Info(fmt.Sprintf("corrupt blocks found in shard %d: %s", id, path))
+	}
+	s.logger.Info(fmt.Sprintf("scanned shard %d: %d files, %d blocks, %d bytes, %d corrupt blocks (%d/%d shards)",
+		id, stats.Files, stats.Blocks, stats.Bytes, stats.CorruptBlocks,
+		atomic.LoadInt64(&s.stats.ScanDone)+1, atomic.LoadInt64(&s.stats.ScanShards)))
+	return len(stats.CorruptFiles), nil
+}
+
+// throttle returns a function, called with the size of each block read from
+// a shard, that sleeps as long as needed to keep the scan of the shard at the
+// configured rate.
+func (s *Service) throttle() func(n int) error {
+	start := time.Now()
+	var read int64
+	return func(n int) error {
+		atomic.AddInt64(&s.stats.BytesScanned, int64(n))
+		read += int64(n)
+
+		var d time.Duration
+		if s.rate > 0 {
+			d = time.Duration(float64(read)/float64(s.rate)*float64(time.Second)) - time.Since(start)
+		}
+		return s.sleep(d)
+	}
+}
+
+// wait waits for d, returning errClosed if the service is closed first.
+func (s *Service) wait(d time.Duration) error {
+	if d <= 0 {
+		select {
+		case <-s.done:
+			return errClosed
+		default:
+			return nil
+		}
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-s.done:
+		return errClosed
+	case <-timer.C:
+		return nil
+	}
+}
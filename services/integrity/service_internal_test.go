@@ -0,0 +1,125 @@
+package integrity
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lucaswiersma/influxdb/toml"
+	"github.com/lucaswiersma/influxdb/tsdb"
+)
+
+func TestService_Scan(t *testing.T) {
+	now := time.Date(2017, 6, 10, 0, 0, 0, 0, time.UTC)
+
+	store := &tsdbStore{
+		ids: []uint64{1, 2, 3},
+		modified: map[uint64]time.Time{
+			1: now.Add(-time.Hour),
+			// Written to too recently to be scanned.
+			2: now.Add(-time.Minute),
+			3: now.Add(-time.Hour),
+		},
+		stats: map[uint64]tsdb.VerifyStats{
+			1: {Files: 2, Blocks: 10, Bytes: 1000},
+			3: {Files: 1, Blocks: 5, Bytes: 500, CorruptBlocks: 2, CorruptFiles: []string{"000000001-000000001.tsm"}},
+		},
+	}
+	s := NewService(Config{
+		ScanInterval: toml.Duration(time.Hour),
+		IdleDuration: toml.Duration(10 * time.Minute),
+		Quarantine:   true,
+	})
+	s.TSDBStore = store
+
+	if err := s.scan(now); err != nil {
+		t.Fatal(err)
+	} else if exp := []uint64{1, 3}; !reflect.DeepEqual(store.verified, exp) {
+		t.Fatalf("unexpected shards scanned: got %v, exp %v", store.verified, exp)
+	} else if !store.quarantine {
+		t.Fatal("expected corrupt files to be quarantined")
+	}
+
+	if got, exp := s.stats.Scans, int64(1); got != exp {
+		t.Fatalf("unexpected scans: got %d, exp %d", got, exp)
+	} else if got, exp := s.stats.ShardsScanned, int64(2); got != exp {
+		t.Fatalf("unexpected shards scanned: got %d, exp %d", got, exp)
+	} else if got, exp := s.stats.ShardsSkipped, int64(1); got != exp {
+		t.Fatalf("unexpected shards skipped: got %d, exp %d", got, exp)
+	} else if got, exp := s.stats.FilesScanned, int64(3); got != exp {
+		t.Fatalf("unexpected files scanned: got %d, exp %d", got, exp)
+	} else if got, exp := s.stats.BytesScanned, int64(1500); got != exp {
+		t.Fatalf("unexpected bytes scanned: got %d, exp %d", got, exp)
+	} else if got, exp := s.stats.CorruptBlocks, int64(2); got != exp {
+		t.Fatalf("unexpected corrupt blocks: got %d, exp %d", got, exp)
+	} else if got, exp := s.stats.CorruptFiles, int64(1); got != exp {
+		t.Fatalf("unexpected corrupt files: got %d, exp %d", got, exp)
+	}
+
+	// A shard that fails to scan is counted and the scan continues.
+	store.verified = nil
+	store.err = errors.New("shard closed")
+	if err := s.scan(now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	} else if got, exp := s.stats.ScanErrors, int64(3); got != exp {
+		t.Fatalf("unexpected scan errors: got %d, exp %d", got, exp)
+	}
+}
+
+func TestService_Throttle(t *testing.T) {
+	s := NewService(Config{ScanRate: toml.Size(1000)})
+
+	var slept []time.Duration
+	s.sleep = func(d time.Duration) error {
+		slept = append(slept, d)
+		return nil
+	}
+
+	wait := s.throttle()
+	for i := 0; i < 3; i++ {
+		if err := wait(500); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The scan is held to 1000 bytes per second.
+	for i, d := range slept {
+		if exp := time.Duration(i+1) * 500 * time.Millisecond; d > exp || d < exp-time.Second/10 {
+			t.Fatalf("unexpected sleep %d: got %s, exp %s", i, d, exp)
+		}
+	}
+
+	// Closing the service stops the scan.
+	s.sleep = s.wait
+	close(s.done)
+	if err := wait(500); err != errClosed {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+type tsdbStore struct {
+	ids        []uint64
+	modified   map[uint64]time.Time
+	stats      map[uint64]tsdb.VerifyStats
+	err        error
+	verified   []uint64
+	quarantine bool
+}
+
+func (s *tsdbStore) ShardIDs() []uint64 { return s.ids }
+func (s *tsdbStore) ShardLastModified(id uint64) (time.Time, error) {
+	return s.modified[id], nil
+}
+func (s *tsdbStore) VerifyShard(id uint64, wait func(n int) error, quarantine bool) (tsdb.VerifyStats, error) {
+	s.verified = append(s.verified, id)
+	s.quarantine = quarantine
+	if s.err != nil {
+		return tsdb.VerifyStats{}, s.err
+	}
+	stats := s.stats[id]
+	if err := wait(int(stats.Bytes)); err != nil {
+		return stats, err
+	}
+	return stats, nil
+}
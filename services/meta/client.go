@@ -16,10 +16,12 @@ import (
 	"path/filepath"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/lucaswiersma/influxdb"
 	"github.com/lucaswiersma/influxdb/influxql"
+	"github.com/lucaswiersma/influxdb/models"
 	"go.uber.org/zap"
 
 	"golang.org/x/crypto/bcrypt"
@@ -36,6 +38,14 @@ const (
 	ShardGroupDeletedExpiration = -2 * 7 * 24 * time.Hour
 )
 
+// Statistics for the meta client.
+const (
+	statSnapshotSize      = "snapshotSize"
+	statLastSnapshot      = "lastSnapshot"
+	statCompactions       = "compactions"
+	statShardGroupsPruned = "shardGroupsPruned"
+)
+
 var (
 	// ErrServiceUnavailable is returned when the meta service is unavailable.
 	ErrServiceUnavailable = errors.New("meta service unavailable")
@@ -60,6 +70,20 @@ type Client struct {
 	path string
 
 	retentionAutoCreate bool
+
+	compactionInterval          time.Duration
+	deletedShardGroupExpiration time.Duration
+	wg                          sync.WaitGroup
+
+	stats *ClientStatistics
+}
+
+// ClientStatistics keeps statistics related to the meta store.
+type ClientStatistics struct {
+	SnapshotSize      int64
+	LastSnapshot      int64
+	Compactions       int64
+	ShardGroupsPruned int64
 }
 
 type authUser struct {
@@ -70,6 +94,11 @@ type authUser struct {
 
 // NewClient returns a new *Client.
 func NewClient(config *Config) *Client {
+	expiration := time.Duration(config.DeletedShardGroupExpiration)
+	if expiration == 0 {
+		expiration = -ShardGroupDeletedExpiration
+	}
+
 	return &Client{
 		cacheData: &Data{
 			ClusterID: uint64(rand.Int63()),
@@ -81,6 +110,11 @@ func NewClient(config *Config) *Client {
 		authCache:           make(map[string]authUser, 0),
 		path:                config.Dir,
 		retentionAutoCreate: config.RetentionAutoCreate,
+
+		compactionInterval:          time.Duration(config.CompactionInterval),
+		deletedShardGroupExpiration: expiration,
+
+		stats: &ClientStatistics{},
 	}
 }
 
@@ -96,18 +130,22 @@ func (c *Client) Open() error {
 
 	// If this is a brand new instance, persist to disk immediatly.
 	if c.cacheData.Index == 1 {
-		if err := snapshot(c.path, c.cacheData); err != nil {
+		if err := c.snapshot(c.cacheData); err != nil {
 			return err
 		}
 	}
 
+	if c.compactionInterval > 0 {
+		c.wg.Add(1)
+		go c.monitorCompaction()
+	}
+
 	return nil
 }
 
 // Close the meta service cluster connection.
 func (c *Client) Close() error {
 	c.mu.Lock()
-	defer c.mu.Unlock()
 
 	if t, ok := http.DefaultTransport.(*http.Transport); ok {
 		t.CloseIdleConnections()
@@ -115,11 +153,74 @@ func (c *Client) Close() error {
 
 	select {
 	case <-c.closing:
+		c.mu.Unlock()
 		return nil
 	default:
 		close(c.closing)
 	}
+	c.mu.Unlock()
+
+	// Compaction takes the lock, so wait for it after releasing the lock.
+	c.wg.Wait()
+	return nil
+}
+
+// Statistics returns statistics for periodic monitoring.
+func (c *Client) Statistics(tags map[string]string) []models.Statistic {
+	return []models.Statistic{{
+		Name: "meta",
+		Tags: tags,
+		Values: map[string]interface{}{
+			statSnapshotSize:      atomic.LoadInt64(&c.stats.SnapshotSize),
+			statLastSnapshot:      atomic.LoadInt64(&c.stats.LastSnapshot),
+			statCompactions:       atomic.LoadInt64(&c.stats.Compactions),
+			statShardGroupsPruned: atomic.LoadInt64(&c.stats.ShardGroupsPruned),
+		},
+	}}
+}
+
+// monitorCompaction compacts the meta store every compaction interval until
+// the client is closed.
+func (c *Client) monitorCompaction() {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(c.compactionInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.closing:
+			return
+		case <-ticker.C:
+			if err := c.Compact(); err != nil {
+				c.logger.Info(fmt.Sprintf("error compacting meta store: %s", err))
+			}
+		}
+	}
+}
+
+// Compact prunes shard groups deleted longer ago than the expiration from the
+// meta store and rewrites its snapshot on disk, so the snapshot only holds
+// the current meta data.
+func (c *Client) Compact() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data := c.cacheData.Clone()
+	if n := pruneShardGroups(data, time.Now().Add(-c.deletedShardGroupExpiration)); n > 0 {
+		if err := c.commit(data); err != nil {
+			return err
+		}
+		atomic.AddInt64(&c.stats.ShardGroupsPruned, int64(n))
+	} else if err := c.snapshot(c.cacheData); err != nil {
+		return err
+	}
 
+	// Remove a snapshot left behind by an interrupted write.
+	if err := os.Remove(filepath.Join(c.path, metaFile+"tmp")); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	atomic.AddInt64(&c.stats.Compactions, 1)
 	return nil
 }
 
@@ -678,13 +779,50 @@ func (c *Client) DropShard(id uint64) error {
 	return c.commit(data)
 }
 
+// RestoreShard re-adds a previously dropped shard to the meta store.
+func (c *Client) RestoreShard(database, policy string, groupID uint64, start, end time.Time, shardID uint64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data := c.cacheData.Clone()
+	if err := data.RestoreShard(database, policy, groupID, start, end, shardID); err != nil {
+		return err
+	}
+	return c.commit(data)
+}
+
+// MergeShardGroups extends the dst shard group over the adjacent src shard
+// group and deletes src.
+func (c *Client) MergeShardGroups(database, policy string, dstID, srcID uint64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data := c.cacheData.Clone()
+	if err := data.MergeShardGroups(database, policy, dstID, srcID); err != nil {
+		return err
+	}
+	return c.commit(data)
+}
+
 // PruneShardGroups remove deleted shard groups from the data store.
 func (c *Client) PruneShardGroups() error {
-	var changed bool
-	expiration := time.Now().Add(ShardGroupDeletedExpiration)
+	expiration := time.Now().Add(-c.deletedShardGroupExpiration)
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	data := c.cacheData.Clone()
+	if n := pruneShardGroups(data, expiration); n > 0 {
+		if err := c.commit(data); err != nil {
+			return err
+		}
+		atomic.AddInt64(&c.stats.ShardGroupsPruned, int64(n))
+	}
+	return nil
+}
+
+// pruneShardGroups removes shard groups deleted before expiration from data
+// and returns the number removed.
+func pruneShardGroups(data *Data, expiration time.Time) int {
+	var n int
 	for i, d := range data.Databases {
 		for j, rp := range d.RetentionPolicies {
 			var remainingShardGroups []ShardGroupInfo
@@ -693,22 +831,26 @@ func (c *Client) PruneShardGroups() error {
 					remainingShardGroups = append(remainingShardGroups, sgi)
 					continue
 				}
-				changed = true
+				n++
 			}
 			data.Databases[i].RetentionPolicies[j].ShardGroups = remainingShardGroups
 		}
 	}
-	if changed {
-		return c.commit(data)
-	}
-	return nil
+	return n
 }
 
 // CreateShardGroup creates a shard group on a database and policy for a given timestamp.
 func (c *Client) CreateShardGroup(database, policy string, timestamp time.Time) (*ShardGroupInfo, error) {
+	return c.CreateMeasurementShardGroup(database, policy, "", timestamp)
+}
+
+// CreateMeasurementShardGroup creates a shard group on a database and policy
+// that only holds a measurement for a given timestamp. An empty measurement
+// creates a shard group shared by the measurements that are not isolated.
+func (c *Client) CreateMeasurementShardGroup(database, policy, measurement string, timestamp time.Time) (*ShardGroupInfo, error) {
 	// Check under a read-lock
 	c.mu.RLock()
-	if sg, _ := c.cacheData.ShardGroupByTimestamp(database, policy, timestamp); sg != nil {
+	if sg, _ := c.cacheData.MeasurementShardGroupByTimestamp(database, policy, measurement, timestamp); sg != nil {
 		c.mu.RUnlock()
 		return sg, nil
 	}
@@ -719,11 +861,11 @@ func (c *Client) CreateShardGroup(database, policy string, timestamp time.Time)
 
 	// Check again under the write lock
 	data := c.cacheData.Clone()
-	if sg, _ := data.ShardGroupByTimestamp(database, policy, timestamp); sg != nil {
+	if sg, _ := data.MeasurementShardGroupByTimestamp(database, policy, measurement, timestamp); sg != nil {
 		return sg, nil
 	}
 
-	sgi, err := createShardGroup(data, database, policy, timestamp)
+	sgi, err := createShardGroup(data, database, policy, measurement, timestamp)
 	if err != nil {
 		return nil, err
 	}
@@ -735,13 +877,13 @@ func (c *Client) CreateShardGroup(database, policy string, timestamp time.Time)
 	return sgi, nil
 }
 
-func createShardGroup(data *Data, database, policy string, timestamp time.Time) (*ShardGroupInfo, error) {
+func createShardGroup(data *Data, database, policy, measurement string, timestamp time.Time) (*ShardGroupInfo, error) {
 	// It is the responsibility of the caller to check if it exists before calling this method.
-	if sg, _ := data.ShardGroupByTimestamp(database, policy, timestamp); sg != nil {
+	if sg, _ := data.MeasurementShardGroupByTimestamp(database, policy, measurement, timestamp); sg != nil {
 		return nil, ErrShardGroupExists
 	}
 
-	if err := data.CreateShardGroup(database, policy, timestamp); err != nil {
+	if err := data.CreateMeasurementShardGroup(database, policy, measurement, timestamp); err != nil {
 		return nil, err
 	}
 
@@ -752,7 +894,7 @@ func createShardGroup(data *Data, database, policy string, timestamp time.Time)
 		return nil, errors.New("retention policy deleted after shard group created")
 	}
 
-	sgi := rpi.ShardGroupByTimestamp(timestamp)
+	sgi := rpi.MeasurementShardGroupByTimestamp(measurement, timestamp)
 	return sgi, nil
 }
 
@@ -790,20 +932,29 @@ func (c *Client) PrecreateShardGroups(from, to time.Time) error {
 				// No data was ever written to this group, or all groups have been deleted.
 				continue
 			}
-			g := rp.ShardGroups[len(rp.ShardGroups)-1] // Get the last group in time.
-			if !g.Deleted() && g.EndTime.Before(to) && g.EndTime.After(from) {
-				// Group is not deleted, will end before the future time, but is still yet to expire.
-				// This last check is important, so the system doesn't create shards groups wholly
-				// in the past.
+
+			// Get the last group in time of the shared shard groups and of
+			// each isolated measurement.
+			for _, g := range lastShardGroups(rp.ShardGroups) {
+				if g.Measurement != "" && !rp.IsolatesMeasurement(g.Measurement) {
+					// The measurement is no longer isolated.
+					continue
+				}
+				if g.Deleted() || !g.EndTime.Before(to) || !g.EndTime.After(from) {
+					// Only precreate after groups that are not deleted, will end before the
+					// future time, but are still yet to expire. This last check is important,
+					// so the system doesn't create shards groups wholly in the past.
+					continue
+				}
 
 				// Create successive shard group.
 				nextShardGroupTime := g.EndTime.Add(1 * time.Nanosecond)
 				// if it already exists, continue
-				if sg, _ := data.ShardGroupByTimestamp(di.Name, rp.Name, nextShardGroupTime); sg != nil {
+				if sg, _ := data.MeasurementShardGroupByTimestamp(di.Name, rp.Name, g.Measurement, nextShardGroupTime); sg != nil {
 					c.logger.Info(fmt.Sprintf("shard group %d exists for database %s, retention policy %s", sg.ID, di.Name, rp.Name))
 					continue
 				}
-				newGroup, err := createShardGroup(data, di.Name, rp.Name, nextShardGroupTime)
+				newGroup, err := createShardGroup(data, di.Name, rp.Name, g.Measurement, nextShardGroupTime)
 				if err != nil {
 					c.logger.Info(fmt.Sprintf("failed to precreate successive shard group for group %d: %s", g.ID, err.Error()))
 					continue
@@ -823,6 +974,21 @@ func (c *Client) PrecreateShardGroups(from, to time.Time) error {
 	return nil
 }
 
+// lastShardGroups returns the last shard group in time of the shared shard
+// groups and of each isolated measurement. The groups must be sorted.
+func lastShardGroups(groups []ShardGroupInfo) []ShardGroupInfo {
+	var last []ShardGroupInfo
+	seen := make(map[string]struct{})
+	for i := len(groups) - 1; i >= 0; i-- {
+		if _, ok := seen[groups[i].Measurement]; ok {
+			continue
+		}
+		seen[groups[i].Measurement] = struct{}{}
+		last = append(last, groups[i])
+	}
+	return last
+}
+
 // ShardOwner returns the owning shard group info for a specific shard.
 func (c *Client) ShardOwner(shardID uint64) (database, policy string, sgi *ShardGroupInfo) {
 	c.mu.RLock()
@@ -885,6 +1051,54 @@ func (c *Client) DropContinuousQuery(database, name string) error {
 	return nil
 }
 
+// SetContinuousQueryLastRuns checkpoints the last time several continuous
+// queries ran successfully so they can resume from that point after a
+// restart. lastRuns maps a database name to the last run of each of its
+// continuous queries. The checkpoints are stored in a single commit and those
+// of queries dropped since they ran are ignored.
+func (c *Client) SetContinuousQueryLastRuns(lastRuns map[string]map[string]time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data := c.cacheData.Clone()
+
+	for database, cqs := range lastRuns {
+		if data.Database(database) == nil {
+			continue
+		}
+		for name, t := range cqs {
+			if err := data.SetContinuousQueryLastRun(database, name, t); err != nil && err != ErrContinuousQueryNotFound {
+				return err
+			}
+		}
+	}
+
+	if err := c.commit(data); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// SetDatabaseDefaultPrecision sets the precision of timestamps in writes to a
+// database that do not specify one.
+func (c *Client) SetDatabaseDefaultPrecision(name, precision string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data := c.cacheData.Clone()
+
+	if err := data.SetDatabaseDefaultPrecision(name, precision); err != nil {
+		return err
+	}
+
+	if err := c.commit(data); err != nil {
+		return err
+	}
+
+	return nil
+}
+
 // CreateSubscription creates a subscription against the given database and retention policy.
 func (c *Client) CreateSubscription(database, rp, name, mode string, destinations []string) error {
 	c.mu.Lock()
@@ -921,6 +1135,43 @@ func (c *Client) DropSubscription(database, rp, name string) error {
 	return nil
 }
 
+// CreateValidationRule adds a rule that points written to a database are
+// validated against.
+func (c *Client) CreateValidationRule(database string, rule ValidationRuleInfo) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data := c.cacheData.Clone()
+
+	if err := data.CreateValidationRule(database, rule); err != nil {
+		return err
+	}
+
+	if err := c.commit(data); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DropValidationRule removes the named validation rule from a database.
+func (c *Client) DropValidationRule(database, name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data := c.cacheData.Clone()
+
+	if err := data.DropValidationRule(database, name); err != nil {
+		return err
+	}
+
+	if err := c.commit(data); err != nil {
+		return err
+	}
+
+	return nil
+}
+
 // SetData overwrites the underlying data in the meta store.
 func (c *Client) SetData(data *Data) error {
 	c.mu.Lock()
@@ -963,7 +1214,7 @@ func (c *Client) commit(data *Data) error {
 	data.Index++
 
 	// try to write to disk before updating in memory
-	if err := snapshot(c.path, data); err != nil {
+	if err := c.snapshot(data); err != nil {
 		return err
 	}
 
@@ -991,38 +1242,50 @@ func (c *Client) WithLogger(log zap.Logger) {
 	c.logger = log.With(zap.String("service", "metaclient"))
 }
 
-// snapshot saves the current meta data to disk.
-func snapshot(path string, data *Data) error {
+// snapshot saves data to disk and records the size of the snapshot.
+// This method assumes c's mutex is already locked.
+func (c *Client) snapshot(data *Data) error {
+	n, err := snapshot(c.path, data)
+	if err != nil {
+		return err
+	}
+	atomic.StoreInt64(&c.stats.SnapshotSize, int64(n))
+	atomic.StoreInt64(&c.stats.LastSnapshot, time.Now().UnixNano())
+	return nil
+}
+
+// snapshot saves the current meta data to disk and returns its size.
+func snapshot(path string, data *Data) (int, error) {
 	file := filepath.Join(path, metaFile)
 	tmpFile := file + "tmp"
 
 	f, err := os.Create(tmpFile)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer f.Close()
 
 	var d []byte
 	if b, err := data.MarshalBinary(); err != nil {
-		return err
+		return 0, err
 	} else {
 		d = b
 	}
 
 	if _, err := f.Write(d); err != nil {
-		return err
+		return 0, err
 	}
 
 	if err = f.Sync(); err != nil {
-		return err
+		return 0, err
 	}
 
 	//close file handle before renaming to support Windows
 	if err = f.Close(); err != nil {
-		return err
+		return 0, err
 	}
 
-	return renameFile(tmpFile, file)
+	return len(d), renameFile(tmpFile, file)
 }
 
 // Load loads the current meta data from disk.
@@ -1046,6 +1309,11 @@ func (c *Client) Load() error {
 	if err := c.cacheData.UnmarshalBinary(data); err != nil {
 		return err
 	}
+
+	atomic.StoreInt64(&c.stats.SnapshotSize, int64(len(data)))
+	if fi, err := f.Stat(); err == nil {
+		atomic.StoreInt64(&c.stats.LastSnapshot, fi.ModTime().UnixNano())
+	}
 	return nil
 }
 
@@ -4,6 +4,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
 	"reflect"
 	"runtime"
 	"strings"
@@ -14,6 +15,7 @@ import (
 
 	"github.com/lucaswiersma/influxdb/influxql"
 	"github.com/lucaswiersma/influxdb/services/meta"
+	"github.com/lucaswiersma/influxdb/toml"
 )
 
 func TestMetaClient_CreateDatabaseOnly(t *testing.T) {
@@ -285,6 +287,42 @@ func TestMetaClient_DropDatabase(t *testing.T) {
 	}
 }
 
+func TestMetaClient_SetDatabaseDefaultPrecision(t *testing.T) {
+	t.Parallel()
+
+	cfg := newConfig()
+	defer os.RemoveAll(cfg.Dir)
+
+	c := meta.NewClient(cfg)
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.CreateDatabase("db0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetDatabaseDefaultPrecision("db0", "s"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetDatabaseDefaultPrecision("db1", "s"); err == nil {
+		t.Fatal("expected error for missing database")
+	}
+	c.Close()
+
+	// The precision must survive a restart.
+	c = meta.NewClient(cfg)
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if db := c.Database("db0"); db == nil {
+		t.Fatal("database not found")
+	} else if db.DefaultPrecision != "s" {
+		t.Fatalf("unexpected default precision: %q", db.DefaultPrecision)
+	}
+}
+
 func TestMetaClient_CreateRetentionPolicy(t *testing.T) {
 	t.Parallel()
 
@@ -1106,6 +1144,124 @@ func TestMetaClient_PruneShardGroups(t *testing.T) {
 	}
 }
 
+func TestMetaClient_Compact(t *testing.T) {
+	t.Parallel()
+
+	cfg := newConfig()
+	cfg.DeletedShardGroupExpiration = toml.Duration(time.Hour)
+	defer os.RemoveAll(cfg.Dir)
+
+	c := meta.NewClient(cfg)
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if _, err := c.CreateDatabase("db0"); err != nil {
+		t.Fatal(err)
+	}
+	for _, ts := range []time.Time{time.Now(), time.Now().Add(-7 * 24 * time.Hour)} {
+		if _, err := c.CreateShardGroup("db0", "autogen", ts); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only the shard group deleted before the expiration is pruned.
+	data := c.Data()
+	data.Databases[0].RetentionPolicies[0].ShardGroups[0].DeletedAt = time.Now().Add(-2 * time.Hour)
+	data.Databases[0].RetentionPolicies[0].ShardGroups[1].DeletedAt = time.Now().Add(-time.Minute)
+	if err := c.SetData(&data); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Compact(); err != nil {
+		t.Fatal(err)
+	}
+
+	data = c.Data()
+	if got, exp := len(data.Databases[0].RetentionPolicies[0].ShardGroups), 1; got != exp {
+		t.Fatalf("unexpected shard groups: got %d, exp %d", got, exp)
+	}
+
+	stats := c.Statistics(nil)[0].Values
+	if got := stats["compactions"]; got != int64(1) {
+		t.Fatalf("unexpected compactions: %v", got)
+	} else if got := stats["shardGroupsPruned"]; got != int64(1) {
+		t.Fatalf("unexpected shard groups pruned: %v", got)
+	}
+
+	// The snapshot on disk holds the compacted meta data.
+	fi, err := os.Stat(filepath.Join(cfg.Dir, "meta.db"))
+	if err != nil {
+		t.Fatal(err)
+	} else if got := stats["snapshotSize"]; got != fi.Size() {
+		t.Fatalf("unexpected snapshot size: got %v, exp %d", got, fi.Size())
+	} else if stats["lastSnapshot"].(int64) == 0 {
+		t.Fatal("expected last snapshot time")
+	}
+}
+
+func TestMetaClient_CreateMeasurementShardGroup(t *testing.T) {
+	t.Parallel()
+
+	cfg := newConfig()
+	defer os.RemoveAll(cfg.Dir)
+
+	c := meta.NewClient(cfg)
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if _, err := c.CreateDatabase("db0"); err != nil {
+		t.Fatal(err)
+	}
+	rpu := &meta.RetentionPolicyUpdate{IsolatedMeasurements: []string{"cpu", "cpu"}}
+	if err := c.UpdateRetentionPolicy("db0", "autogen", rpu, false); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	shared, err := c.CreateShardGroup("db0", "autogen", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	isolated, err := c.CreateMeasurementShardGroup("db0", "autogen", "cpu", now)
+	if err != nil {
+		t.Fatal(err)
+	} else if isolated.ID == shared.ID || isolated.Measurement != "cpu" {
+		t.Fatalf("unexpected isolated shard group: %+v", isolated)
+	}
+
+	// Creating the shard groups again returns the existing ones.
+	if sg, err := c.CreateMeasurementShardGroup("db0", "autogen", "cpu", now); err != nil {
+		t.Fatal(err)
+	} else if sg.ID != isolated.ID {
+		t.Fatalf("unexpected shard group: %d", sg.ID)
+	}
+	if sg, err := c.CreateShardGroup("db0", "autogen", now); err != nil {
+		t.Fatal(err)
+	} else if sg.ID != shared.ID {
+		t.Fatalf("unexpected shard group: %d", sg.ID)
+	}
+
+	// The isolated measurements and shard groups are persisted.
+	c2 := meta.NewClient(cfg)
+	if err := c2.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer c2.Close()
+
+	rp, err := c2.RetentionPolicy("db0", "autogen")
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(rp.IsolatedMeasurements, []string{"cpu"}) {
+		t.Fatalf("unexpected isolated measurements: %v", rp.IsolatedMeasurements)
+	} else if sg := rp.MeasurementShardGroupByTimestamp("cpu", now); sg == nil || sg.ID != isolated.ID {
+		t.Fatalf("unexpected isolated shard group: %+v", sg)
+	}
+}
+
 func TestMetaClient_PersistClusterIDAfterRestart(t *testing.T) {
 	t.Parallel()
 
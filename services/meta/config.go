@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/lucaswiersma/influxdb/monitor/diagnostics"
+	"github.com/lucaswiersma/influxdb/toml"
 )
 
 const (
@@ -13,6 +14,14 @@ const (
 
 	// DefaultLoggingEnabled determines if log messages are printed for the meta service.
 	DefaultLoggingEnabled = true
+
+	// DefaultCompactionInterval is the default interval at which the meta
+	// store is compacted.
+	DefaultCompactionInterval = time.Hour
+
+	// DefaultDeletedShardGroupExpiration is the default amount of time a
+	// deleted shard group is kept in the meta store.
+	DefaultDeletedShardGroupExpiration = 2 * 7 * 24 * time.Hour
 )
 
 // Config represents the meta configuration.
@@ -21,13 +30,23 @@ type Config struct {
 
 	RetentionAutoCreate bool `toml:"retention-autocreate"`
 	LoggingEnabled      bool `toml:"logging-enabled"`
+
+	// CompactionInterval is how often expired state is pruned from the meta
+	// store and its snapshot rewritten. Zero disables compaction.
+	CompactionInterval toml.Duration `toml:"compaction-interval"`
+
+	// DeletedShardGroupExpiration is how long deleted shard groups are kept
+	// in the meta store before they are pruned.
+	DeletedShardGroupExpiration toml.Duration `toml:"deleted-shard-group-expiration"`
 }
 
 // NewConfig builds a new configuration with default values.
 func NewConfig() *Config {
 	return &Config{
-		RetentionAutoCreate: true,
-		LoggingEnabled:      DefaultLoggingEnabled,
+		RetentionAutoCreate:         true,
+		LoggingEnabled:              DefaultLoggingEnabled,
+		CompactionInterval:          toml.Duration(DefaultCompactionInterval),
+		DeletedShardGroupExpiration: toml.Duration(DefaultDeletedShardGroupExpiration),
 	}
 }
 
@@ -35,6 +54,10 @@ func NewConfig() *Config {
 func (c *Config) Validate() error {
 	if c.Dir == "" {
 		return errors.New("Meta.Dir must be specified")
+	} else if c.CompactionInterval < 0 {
+		return errors.New("Meta.CompactionInterval must not be negative")
+	} else if c.DeletedShardGroupExpiration < 0 {
+		return errors.New("Meta.DeletedShardGroupExpiration must not be negative")
 	}
 	return nil
 }
@@ -42,6 +65,8 @@ func (c *Config) Validate() error {
 // Diagnostics returns a diagnostics representation of a subset of the Config.
 func (c *Config) Diagnostics() (*diagnostics.Diagnostics, error) {
 	return diagnostics.RowFromMap(map[string]interface{}{
-		"dir": c.Dir,
+		"dir":                            c.Dir,
+		"compaction-interval":            c.CompactionInterval,
+		"deleted-shard-group-expiration": c.DeletedShardGroupExpiration,
 	}), nil
 }
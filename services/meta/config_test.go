@@ -2,6 +2,7 @@ package meta_test
 
 import (
 	"testing"
+	"time"
 
 	"github.com/BurntSushi/toml"
 	"github.com/lucaswiersma/influxdb/services/meta"
@@ -13,6 +14,8 @@ func TestConfig_Parse(t *testing.T) {
 	if _, err := toml.Decode(`
 dir = "/tmp/foo"
 logging-enabled = false
+compaction-interval = "10m"
+deleted-shard-group-expiration = "24h"
 `, &c); err != nil {
 		t.Fatal(err)
 	}
@@ -22,5 +25,9 @@ logging-enabled = false
 		t.Fatalf("unexpected dir: %s", c.Dir)
 	} else if c.LoggingEnabled {
 		t.Fatalf("unexpected logging enabled: %v", c.LoggingEnabled)
+	} else if time.Duration(c.CompactionInterval) != 10*time.Minute {
+		t.Fatalf("unexpected compaction interval: %v", c.CompactionInterval)
+	} else if time.Duration(c.DeletedShardGroupExpiration) != 24*time.Hour {
+		t.Fatalf("unexpected deleted shard group expiration: %v", c.DeletedShardGroupExpiration)
 	}
 }
@@ -156,7 +156,7 @@ func (data *Data) CreateRetentionPolicy(database string, rpi *RetentionPolicyInf
 	// Normalise ShardDuration before comparing to any existing
 	// retention policies. The client is supposed to do this, but
 	// do it again to verify input.
-	rpi.ShardGroupDuration = normalisedShardDuration(rpi.ShardGroupDuration, rpi.Duration)
+	rpi.ShardGroupDuration = NormalisedShardDuration(rpi.ShardGroupDuration, rpi.Duration)
 
 	if rpi.Duration > 0 && rpi.Duration < rpi.ShardGroupDuration {
 		return ErrIncompatibleDurations
@@ -215,6 +215,10 @@ type RetentionPolicyUpdate struct {
 	Duration           *time.Duration
 	ReplicaN           *int
 	ShardGroupDuration *time.Duration
+
+	// IsolatedMeasurements replaces the measurements written to their own
+	// shard groups when it is not nil.
+	IsolatedMeasurements []string
 }
 
 // SetName sets the RetentionPolicyUpdate.Name.
@@ -273,7 +277,15 @@ func (data *Data) UpdateRetentionPolicy(database, name string, rpu *RetentionPol
 		rpi.ReplicaN = *rpu.ReplicaN
 	}
 	if rpu.ShardGroupDuration != nil {
-		rpi.ShardGroupDuration = normalisedShardDuration(*rpu.ShardGroupDuration, rpi.Duration)
+		rpi.ShardGroupDuration = NormalisedShardDuration(*rpu.ShardGroupDuration, rpi.Duration)
+	}
+	if rpu.IsolatedMeasurements != nil {
+		rpi.IsolatedMeasurements = nil
+		for _, name := range rpu.IsolatedMeasurements {
+			if !rpi.IsolatesMeasurement(name) {
+				rpi.IsolatedMeasurements = append(rpi.IsolatedMeasurements, name)
+			}
+		}
 	}
 
 	if di.DefaultRetentionPolicy != rpi.Name && makeDefault {
@@ -356,6 +368,13 @@ func (data *Data) ShardGroupsByTimeRange(database, policy string, tmin, tmax tim
 
 // ShardGroupByTimestamp returns the shard group on a database and policy for a given timestamp.
 func (data *Data) ShardGroupByTimestamp(database, policy string, timestamp time.Time) (*ShardGroupInfo, error) {
+	return data.MeasurementShardGroupByTimestamp(database, policy, "", timestamp)
+}
+
+// MeasurementShardGroupByTimestamp returns the shard group on a database and
+// policy that holds a measurement for a given timestamp. An empty measurement
+// returns the shard group shared by the measurements that are not isolated.
+func (data *Data) MeasurementShardGroupByTimestamp(database, policy, measurement string, timestamp time.Time) (*ShardGroupInfo, error) {
 	// Find retention policy.
 	rpi, err := data.RetentionPolicy(database, policy)
 	if err != nil {
@@ -364,11 +383,18 @@ func (data *Data) ShardGroupByTimestamp(database, policy string, timestamp time.
 		return nil, influxdb.ErrRetentionPolicyNotFound(policy)
 	}
 
-	return rpi.ShardGroupByTimestamp(timestamp), nil
+	return rpi.MeasurementShardGroupByTimestamp(measurement, timestamp), nil
 }
 
 // CreateShardGroup creates a shard group on a database and policy for a given timestamp.
 func (data *Data) CreateShardGroup(database, policy string, timestamp time.Time) error {
+	return data.CreateMeasurementShardGroup(database, policy, "", timestamp)
+}
+
+// CreateMeasurementShardGroup creates a shard group on a database and policy
+// that only holds a measurement for a given timestamp. An empty measurement
+// creates a shard group shared by the measurements that are not isolated.
+func (data *Data) CreateMeasurementShardGroup(database, policy, measurement string, timestamp time.Time) error {
 	// Find retention policy.
 	rpi, err := data.RetentionPolicy(database, policy)
 	if err != nil {
@@ -378,7 +404,7 @@ func (data *Data) CreateShardGroup(database, policy string, timestamp time.Time)
 	}
 
 	// Verify that shard group doesn't already exist for this timestamp.
-	if rpi.ShardGroupByTimestamp(timestamp) != nil {
+	if rpi.MeasurementShardGroupByTimestamp(measurement, timestamp) != nil {
 		return nil
 	}
 
@@ -386,6 +412,7 @@ func (data *Data) CreateShardGroup(database, policy string, timestamp time.Time)
 	data.MaxShardGroupID++
 	sgi := ShardGroupInfo{}
 	sgi.ID = data.MaxShardGroupID
+	sgi.Measurement = measurement
 	sgi.StartTime = timestamp.Truncate(rpi.ShardGroupDuration).UTC()
 	sgi.EndTime = sgi.StartTime.Add(rpi.ShardGroupDuration).UTC()
 	if sgi.EndTime.After(time.Unix(0, models.MaxNanoTime)) {
@@ -407,6 +434,90 @@ func (data *Data) CreateShardGroup(database, policy string, timestamp time.Time)
 	return nil
 }
 
+// RestoreShard re-adds a previously dropped shard to its shard group. If the
+// shard group has since been removed it is recreated with the given time range.
+func (data *Data) RestoreShard(database, policy string, groupID uint64, start, end time.Time, shardID uint64) error {
+	// Find retention policy.
+	rpi, err := data.RetentionPolicy(database, policy)
+	if err != nil {
+		return err
+	} else if rpi == nil {
+		return influxdb.ErrRetentionPolicyNotFound(policy)
+	}
+
+	for i := range rpi.ShardGroups {
+		sgi := &rpi.ShardGroups[i]
+		if sgi.ID != groupID {
+			continue
+		}
+
+		for _, sh := range sgi.Shards {
+			if sh.ID == shardID {
+				return nil
+			}
+		}
+		sgi.Shards = append(sgi.Shards, ShardInfo{ID: shardID})
+		sgi.DeletedAt = time.Time{}
+		return nil
+	}
+
+	rpi.ShardGroups = append(rpi.ShardGroups, ShardGroupInfo{
+		ID:        groupID,
+		StartTime: start.UTC(),
+		EndTime:   end.UTC(),
+		Shards:    []ShardInfo{{ID: shardID}},
+	})
+	sort.Sort(ShardGroupInfos(rpi.ShardGroups))
+
+	if groupID > data.MaxShardGroupID {
+		data.MaxShardGroupID = groupID
+	}
+	if shardID > data.MaxShardID {
+		data.MaxShardID = shardID
+	}
+	return nil
+}
+
+// MergeShardGroups extends the dst shard group to cover the time range of the
+// adjacent src shard group and marks src as deleted.
+func (data *Data) MergeShardGroups(database, policy string, dstID, srcID uint64) error {
+	// Find retention policy.
+	rpi, err := data.RetentionPolicy(database, policy)
+	if err != nil {
+		return err
+	} else if rpi == nil {
+		return influxdb.ErrRetentionPolicyNotFound(policy)
+	}
+
+	var dst, src *ShardGroupInfo
+	for i := range rpi.ShardGroups {
+		switch rpi.ShardGroups[i].ID {
+		case dstID:
+			dst = &rpi.ShardGroups[i]
+		case srcID:
+			src = &rpi.ShardGroups[i]
+		}
+	}
+	if dst == nil || src == nil || dst.Deleted() || src.Deleted() {
+		return ErrShardGroupNotFound
+	} else if dst.Truncated() || src.Truncated() {
+		return fmt.Errorf("cannot merge truncated shard groups %d and %d", dstID, srcID)
+	}
+
+	switch {
+	case dst.EndTime.Equal(src.StartTime):
+		dst.EndTime = src.EndTime
+	case src.EndTime.Equal(dst.StartTime):
+		dst.StartTime = src.StartTime
+	default:
+		return fmt.Errorf("shard groups %d and %d are not adjacent", dstID, srcID)
+	}
+	src.DeletedAt = time.Now().UTC()
+
+	sort.Sort(ShardGroupInfos(rpi.ShardGroups))
+	return nil
+}
+
 // DeleteShardGroup removes a shard group from a database and retention policy by id.
 func (data *Data) DeleteShardGroup(database, policy string, id uint64) error {
 	// Find retention policy.
@@ -473,6 +584,67 @@ func (data *Data) DropContinuousQuery(database, name string) error {
 	return ErrContinuousQueryNotFound
 }
 
+// SetContinuousQueryLastRun records the end of the last window successfully
+// processed by a continuous query.
+func (data *Data) SetContinuousQueryLastRun(database, name string, t time.Time) error {
+	di := data.Database(database)
+	if di == nil {
+		return influxdb.ErrDatabaseNotFound(database)
+	}
+
+	for i := range di.ContinuousQueries {
+		if di.ContinuousQueries[i].Name == name {
+			di.ContinuousQueries[i].LastRun = t.UTC()
+			return nil
+		}
+	}
+	return ErrContinuousQueryNotFound
+}
+
+// SetDatabaseDefaultPrecision sets the precision of timestamps in writes to a
+// database that do not specify one. An empty precision restores the nanosecond
+// default.
+func (data *Data) SetDatabaseDefaultPrecision(name, precision string) error {
+	di := data.Database(name)
+	if di == nil {
+		return influxdb.ErrDatabaseNotFound(name)
+	}
+	di.DefaultPrecision = precision
+	return nil
+}
+
+// CreateValidationRule adds a validation rule to a database.
+func (data *Data) CreateValidationRule(database string, rule ValidationRuleInfo) error {
+	di := data.Database(database)
+	if di == nil {
+		return influxdb.ErrDatabaseNotFound(database)
+	}
+
+	for i := range di.ValidationRules {
+		if di.ValidationRules[i].Name == rule.Name {
+			return ErrValidationRuleExists
+		}
+	}
+	di.ValidationRules = append(di.ValidationRules, rule)
+	return nil
+}
+
+// DropValidationRule removes a validation rule from a database.
+func (data *Data) DropValidationRule(database, name string) error {
+	di := data.Database(database)
+	if di == nil {
+		return influxdb.ErrDatabaseNotFound(database)
+	}
+
+	for i := range di.ValidationRules {
+		if di.ValidationRules[i].Name == name {
+			di.ValidationRules = append(di.ValidationRules[:i], di.ValidationRules[i+1:]...)
+			return nil
+		}
+	}
+	return ErrValidationRuleNotFound
+}
+
 // validateURL returns an error if the URL does not have a port or uses a scheme other than UDP or HTTP.
 func validateURL(input string) error {
 	u, err := url.Parse(input)
@@ -756,6 +928,14 @@ type DatabaseInfo struct {
 	DefaultRetentionPolicy string
 	RetentionPolicies      []RetentionPolicyInfo
 	ContinuousQueries      []ContinuousQueryInfo
+
+	// DefaultPrecision is the precision of timestamps in writes that do not
+	// specify one. It is empty if writes default to nanoseconds.
+	DefaultPrecision string
+
+	// ValidationRules are the rules points written to the database are
+	// validated against.
+	ValidationRules []ValidationRuleInfo
 }
 
 // RetentionPolicy returns a retention policy by name.
@@ -819,6 +999,12 @@ func (di DatabaseInfo) clone() DatabaseInfo {
 		}
 	}
 
+	// Copy validation rules.
+	if di.ValidationRules != nil {
+		other.ValidationRules = make([]ValidationRuleInfo, len(di.ValidationRules))
+		copy(other.ValidationRules, di.ValidationRules)
+	}
+
 	return other
 }
 
@@ -827,6 +1013,9 @@ func (di DatabaseInfo) marshal() *internal.DatabaseInfo {
 	pb := &internal.DatabaseInfo{}
 	pb.Name = proto.String(di.Name)
 	pb.DefaultRetentionPolicy = proto.String(di.DefaultRetentionPolicy)
+	if di.DefaultPrecision != "" {
+		pb.DefaultPrecision = proto.String(di.DefaultPrecision)
+	}
 
 	pb.RetentionPolicies = make([]*internal.RetentionPolicyInfo, len(di.RetentionPolicies))
 	for i := range di.RetentionPolicies {
@@ -837,6 +1026,11 @@ func (di DatabaseInfo) marshal() *internal.DatabaseInfo {
 	for i := range di.ContinuousQueries {
 		pb.ContinuousQueries[i] = di.ContinuousQueries[i].marshal()
 	}
+
+	pb.ValidationRules = make([]*internal.ValidationRuleInfo, len(di.ValidationRules))
+	for i := range di.ValidationRules {
+		pb.ValidationRules[i] = di.ValidationRules[i].marshal()
+	}
 	return pb
 }
 
@@ -844,6 +1038,7 @@ func (di DatabaseInfo) marshal() *internal.DatabaseInfo {
 func (di *DatabaseInfo) unmarshal(pb *internal.DatabaseInfo) {
 	di.Name = pb.GetName()
 	di.DefaultRetentionPolicy = pb.GetDefaultRetentionPolicy()
+	di.DefaultPrecision = pb.GetDefaultPrecision()
 
 	if len(pb.GetRetentionPolicies()) > 0 {
 		di.RetentionPolicies = make([]RetentionPolicyInfo, len(pb.GetRetentionPolicies()))
@@ -858,6 +1053,13 @@ func (di *DatabaseInfo) unmarshal(pb *internal.DatabaseInfo) {
 			di.ContinuousQueries[i].unmarshal(x)
 		}
 	}
+
+	if len(pb.GetValidationRules()) > 0 {
+		di.ValidationRules = make([]ValidationRuleInfo, len(pb.GetValidationRules()))
+		for i, x := range pb.GetValidationRules() {
+			di.ValidationRules[i].unmarshal(x)
+		}
+	}
 }
 
 // RetentionPolicySpec represents the specification for a new retention policy.
@@ -889,7 +1091,7 @@ func (s *RetentionPolicySpec) Matches(rpi *RetentionPolicyInfo) bool {
 	// Normalise ShardDuration before comparing to any existing retention policies.
 	// Normalize with the retention policy info's duration instead of the spec
 	// since they should be the same and we're performing a comparison.
-	sgDuration := normalisedShardDuration(s.ShardGroupDuration, rpi.Duration)
+	sgDuration := NormalisedShardDuration(s.ShardGroupDuration, rpi.Duration)
 	return sgDuration == rpi.ShardGroupDuration
 }
 
@@ -952,6 +1154,10 @@ type RetentionPolicyInfo struct {
 	ShardGroupDuration time.Duration
 	ShardGroups        []ShardGroupInfo
 	Subscriptions      []SubscriptionInfo
+
+	// IsolatedMeasurements are written to shard groups of their own instead
+	// of the shard groups shared by the other measurements.
+	IsolatedMeasurements []string
 }
 
 // NewRetentionPolicyInfo returns a new instance of RetentionPolicyInfo
@@ -987,16 +1193,24 @@ func (rpi *RetentionPolicyInfo) Apply(spec *RetentionPolicySpec) *RetentionPolic
 	if spec.Duration != nil {
 		rp.Duration = *spec.Duration
 	}
-	rp.ShardGroupDuration = normalisedShardDuration(spec.ShardGroupDuration, rp.Duration)
+	rp.ShardGroupDuration = NormalisedShardDuration(spec.ShardGroupDuration, rp.Duration)
 	return rp
 }
 
 // ShardGroupByTimestamp returns the shard group in the policy that contains the timestamp,
 // or nil if no shard group matches.
 func (rpi *RetentionPolicyInfo) ShardGroupByTimestamp(timestamp time.Time) *ShardGroupInfo {
+	return rpi.MeasurementShardGroupByTimestamp("", timestamp)
+}
+
+// MeasurementShardGroupByTimestamp returns the shard group in the policy that
+// holds the measurement and contains the timestamp, or nil if no shard group
+// matches. An empty measurement matches the shard groups shared by the
+// measurements that are not isolated.
+func (rpi *RetentionPolicyInfo) MeasurementShardGroupByTimestamp(measurement string, timestamp time.Time) *ShardGroupInfo {
 	for i := range rpi.ShardGroups {
 		sgi := &rpi.ShardGroups[i]
-		if sgi.Contains(timestamp) && !sgi.Deleted() && (!sgi.Truncated() || timestamp.Before(sgi.TruncatedAt)) {
+		if sgi.Measurement == measurement && sgi.Contains(timestamp) && !sgi.Deleted() && (!sgi.Truncated() || timestamp.Before(sgi.TruncatedAt)) {
 			return &rpi.ShardGroups[i]
 		}
 	}
@@ -1004,6 +1218,17 @@ func (rpi *RetentionPolicyInfo) ShardGroupByTimestamp(timestamp time.Time) *Shar
 	return nil
 }
 
+// IsolatesMeasurement returns true if the measurement is written to its own
+// shard groups.
+func (rpi *RetentionPolicyInfo) IsolatesMeasurement(name string) bool {
+	for _, m := range rpi.IsolatedMeasurements {
+		if m == name {
+			return true
+		}
+	}
+	return false
+}
+
 // ExpiredShardGroups returns the Shard Groups which are considered expired, for the given time.
 func (rpi *RetentionPolicyInfo) ExpiredShardGroups(t time.Time) []*ShardGroupInfo {
 	var groups = make([]*ShardGroupInfo, 0)
@@ -1048,6 +1273,8 @@ func (rpi *RetentionPolicyInfo) marshal() *internal.RetentionPolicyInfo {
 		pb.Subscriptions[i] = sub.marshal()
 	}
 
+	pb.IsolatedMeasurements = rpi.IsolatedMeasurements
+
 	return pb
 }
 
@@ -1070,6 +1297,10 @@ func (rpi *RetentionPolicyInfo) unmarshal(pb *internal.RetentionPolicyInfo) {
 			rpi.Subscriptions[i].unmarshal(x)
 		}
 	}
+	if len(pb.GetIsolatedMeasurements()) > 0 {
+		rpi.IsolatedMeasurements = make([]string, len(pb.GetIsolatedMeasurements()))
+		copy(rpi.IsolatedMeasurements, pb.GetIsolatedMeasurements())
+	}
 }
 
 // clone returns a deep copy of rpi.
@@ -1083,6 +1314,11 @@ func (rpi RetentionPolicyInfo) clone() RetentionPolicyInfo {
 		}
 	}
 
+	if rpi.IsolatedMeasurements != nil {
+		other.IsolatedMeasurements = make([]string, len(rpi.IsolatedMeasurements))
+		copy(other.IsolatedMeasurements, rpi.IsolatedMeasurements)
+	}
+
 	return other
 }
 
@@ -1111,8 +1347,9 @@ func shardGroupDuration(d time.Duration) time.Duration {
 	return 1 * time.Hour
 }
 
-// normalisedShardDuration returns normalised shard duration based on a policy duration.
-func normalisedShardDuration(sgd, d time.Duration) time.Duration {
+// NormalisedShardDuration returns the shard group duration a retention policy
+// of duration d uses when sgd is requested.
+func NormalisedShardDuration(sgd, d time.Duration) time.Duration {
 	// If it is zero, it likely wasn't specified, so we default to the shard group duration
 	if sgd == 0 {
 		return shardGroupDuration(d)
@@ -1136,6 +1373,11 @@ type ShardGroupInfo struct {
 	DeletedAt   time.Time
 	Shards      []ShardInfo
 	TruncatedAt time.Time
+
+	// Measurement is the only measurement written to the shard group. It is
+	// empty if the shard group is shared by the measurements that are not
+	// isolated.
+	Measurement string
 }
 
 // ShardGroupInfos implements sort.Interface on []ShardGroupInfo, based
@@ -1172,8 +1414,13 @@ func (sgi *ShardGroupInfo) Contains(timestamp time.Time) bool {
 	return !sgi.StartTime.After(timestamp) && sgi.EndTime.After(timestamp)
 }
 
-// Overlaps returns whether the shard group contains data for the time range between min and max
+// Overlaps returns whether the shard group contains data for the time range
+// between min and max, inclusive. An empty range, where max is before min,
+// overlaps no shard groups.
 func (sgi *ShardGroupInfo) Overlaps(min, max time.Time) bool {
+	if max.Before(min) {
+		return false
+	}
 	return !sgi.StartTime.After(max) && sgi.EndTime.After(min)
 }
 
@@ -1219,6 +1466,10 @@ func (sgi *ShardGroupInfo) marshal() *internal.ShardGroupInfo {
 		pb.TruncatedAt = proto.Int64(MarshalTime(sgi.TruncatedAt))
 	}
 
+	if sgi.Measurement != "" {
+		pb.Measurement = proto.String(sgi.Measurement)
+	}
+
 	pb.Shards = make([]*internal.ShardInfo, len(sgi.Shards))
 	for i := range sgi.Shards {
 		pb.Shards[i] = sgi.Shards[i].marshal()
@@ -1245,6 +1496,7 @@ func (sgi *ShardGroupInfo) unmarshal(pb *internal.ShardGroupInfo) {
 	if pb != nil && pb.TruncatedAt != nil {
 		sgi.TruncatedAt = UnmarshalTime(pb.GetTruncatedAt())
 	}
+	sgi.Measurement = pb.GetMeasurement()
 
 	if len(pb.GetShards()) > 0 {
 		sgi.Shards = make([]ShardInfo, len(pb.GetShards()))
@@ -1362,6 +1614,54 @@ func (si *SubscriptionInfo) unmarshal(pb *internal.SubscriptionInfo) {
 	}
 }
 
+// ValidationRuleInfo represents a rule that points written to a database are
+// validated against. A rule either requires a tag or bounds the values of a
+// field.
+type ValidationRuleInfo struct {
+	Name string
+
+	// Measurement the rule applies to. If blank, the rule applies to every
+	// measurement of the database.
+	Measurement string
+
+	// Tag is a tag the points are required to have.
+	Tag string
+
+	// Field is a field whose values must be between Min and Max, inclusive,
+	// if the points have it.
+	Field string
+	Min   float64
+	Max   float64
+}
+
+// marshal serializes to a protobuf representation.
+func (vi ValidationRuleInfo) marshal() *internal.ValidationRuleInfo {
+	pb := &internal.ValidationRuleInfo{
+		Name: proto.String(vi.Name),
+	}
+	if vi.Measurement != "" {
+		pb.Measurement = proto.String(vi.Measurement)
+	}
+	if vi.Tag != "" {
+		pb.Tag = proto.String(vi.Tag)
+	} else {
+		pb.Field = proto.String(vi.Field)
+		pb.Min = proto.Float64(vi.Min)
+		pb.Max = proto.Float64(vi.Max)
+	}
+	return pb
+}
+
+// unmarshal deserializes from a protobuf representation.
+func (vi *ValidationRuleInfo) unmarshal(pb *internal.ValidationRuleInfo) {
+	vi.Name = pb.GetName()
+	vi.Measurement = pb.GetMeasurement()
+	vi.Tag = pb.GetTag()
+	vi.Field = pb.GetField()
+	vi.Min = pb.GetMin()
+	vi.Max = pb.GetMax()
+}
+
 // ShardOwner represents a node that owns a shard.
 type ShardOwner struct {
 	NodeID uint64
@@ -1388,6 +1688,10 @@ func (so *ShardOwner) unmarshal(pb *internal.ShardOwner) {
 type ContinuousQueryInfo struct {
 	Name  string
 	Query string
+
+	// LastRun is the time the query last ran successfully. It is zero if the
+	// query has not run yet.
+	LastRun time.Time
 }
 
 // clone returns a deep copy of cqi.
@@ -1395,16 +1699,23 @@ func (cqi ContinuousQueryInfo) clone() ContinuousQueryInfo { return cqi }
 
 // marshal serializes to a protobuf representation.
 func (cqi ContinuousQueryInfo) marshal() *internal.ContinuousQueryInfo {
-	return &internal.ContinuousQueryInfo{
+	pb := &internal.ContinuousQueryInfo{
 		Name:  proto.String(cqi.Name),
 		Query: proto.String(cqi.Query),
 	}
+	if !cqi.LastRun.IsZero() {
+		pb.LastRun = proto.Int64(cqi.LastRun.UnixNano())
+	}
+	return pb
 }
 
 // unmarshal deserializes from a protobuf representation.
 func (cqi *ContinuousQueryInfo) unmarshal(pb *internal.ContinuousQueryInfo) {
 	cqi.Name = pb.GetName()
 	cqi.Query = pb.GetQuery()
+	if pb.LastRun != nil {
+		cqi.LastRun = time.Unix(0, pb.GetLastRun()).UTC()
+	}
 }
 
 // UserInfo represents metadata about a user in the system.
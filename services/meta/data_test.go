@@ -110,6 +110,84 @@ func Test_Data_CreateRetentionPolicy(t *testing.T) {
 	}
 }
 
+func Test_Data_RestoreShard(t *testing.T) {
+	data := meta.Data{}
+	if err := data.CreateDatabase("db0"); err != nil {
+		t.Fatal(err)
+	} else if err := data.CreateRetentionPolicy("db0", &meta.RetentionPolicyInfo{
+		Name:               "rp0",
+		ReplicaN:           1,
+		ShardGroupDuration: time.Hour,
+	}, false); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(0, 0).UTC()
+	if err := data.CreateShardGroup("db0", "rp0", now); err != nil {
+		t.Fatal(err)
+	}
+
+	// Dropping the only shard marks the group deleted; restoring revives it.
+	data.DropShard(1)
+	if err := data.RestoreShard("db0", "rp0", 1, now, now.Add(time.Hour), 1); err != nil {
+		t.Fatal(err)
+	}
+	rp, _ := data.RetentionPolicy("db0", "rp0")
+	if sg := rp.ShardGroups[0]; sg.Deleted() || len(sg.Shards) != 1 || sg.Shards[0].ID != 1 {
+		t.Fatalf("unexpected shard group: %+v", sg)
+	}
+
+	// Restoring into a group that no longer exists recreates it.
+	if err := data.RestoreShard("db0", "rp0", 5, now.Add(time.Hour), now.Add(2*time.Hour), 7); err != nil {
+		t.Fatal(err)
+	}
+	rp, _ = data.RetentionPolicy("db0", "rp0")
+	if len(rp.ShardGroups) != 2 || rp.ShardGroups[1].ID != 5 || rp.ShardGroups[1].Shards[0].ID != 7 {
+		t.Fatalf("unexpected shard groups: %+v", rp.ShardGroups)
+	} else if data.MaxShardID != 7 || data.MaxShardGroupID != 5 {
+		t.Fatalf("unexpected max ids: shard=%d group=%d", data.MaxShardID, data.MaxShardGroupID)
+	}
+}
+
+func Test_Data_MergeShardGroups(t *testing.T) {
+	data := meta.Data{}
+	if err := data.CreateDatabase("db0"); err != nil {
+		t.Fatal(err)
+	} else if err := data.CreateRetentionPolicy("db0", &meta.RetentionPolicyInfo{
+		Name:               "rp0",
+		ReplicaN:           1,
+		ShardGroupDuration: time.Hour,
+	}, false); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(0, 0).UTC()
+	for i := 0; i < 3; i++ {
+		if err := data.CreateShardGroup("db0", "rp0", now.Add(time.Duration(i)*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Groups that are not adjacent cannot be merged.
+	if err := data.MergeShardGroups("db0", "rp0", 1, 3); err == nil {
+		t.Fatal("expected error")
+	}
+
+	if err := data.MergeShardGroups("db0", "rp0", 1, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	rp, _ := data.RetentionPolicy("db0", "rp0")
+	if sg := rp.ShardGroupByTimestamp(now.Add(90 * time.Minute)); sg == nil || sg.ID != 1 {
+		t.Fatalf("unexpected shard group: %+v", sg)
+	} else if !sg.StartTime.Equal(now) || !sg.EndTime.Equal(now.Add(2*time.Hour)) {
+		t.Fatalf("unexpected time range: %s - %s", sg.StartTime, sg.EndTime)
+	}
+	if a := rp.DeletedShardGroups(); len(a) != 1 || a[0].ID != 2 {
+		t.Fatalf("unexpected deleted shard groups: %+v", a)
+	}
+}
+
 func TestUserInfo_AuthorizeDatabase(t *testing.T) {
 	emptyUser := &meta.UserInfo{}
 	if !emptyUser.AuthorizeDatabase(influxql.NoPrivileges, "anydb") {
@@ -95,6 +95,14 @@ var (
 	ErrSubscriptionNotFound = errors.New("subscription not found")
 )
 
+var (
+	// ErrValidationRuleExists is returned when creating an already existing validation rule.
+	ErrValidationRuleExists = errors.New("validation rule already exists")
+
+	// ErrValidationRuleNotFound is returned when removing a validation rule that doesn't exist.
+	ErrValidationRuleNotFound = errors.New("validation rule not found")
+)
+
 // ErrInvalidSubscriptionURL is returned when the subscription's destination URL is invalid.
 func ErrInvalidSubscriptionURL(url string) error {
 	return fmt.Errorf("invalid subscription URL: %s", url)
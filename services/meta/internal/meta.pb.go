@@ -52,6 +52,7 @@ It has these top-level messages:
 	Response
 	SetMetaNodeCommand
 	DropShardCommand
+	ValidationRuleInfo
 */
 package meta
 
@@ -321,6 +322,8 @@ type DatabaseInfo struct {
 	DefaultRetentionPolicy *string                `protobuf:"bytes,2,req,name=DefaultRetentionPolicy" json:"DefaultRetentionPolicy,omitempty"`
 	RetentionPolicies      []*RetentionPolicyInfo `protobuf:"bytes,3,rep,name=RetentionPolicies" json:"RetentionPolicies,omitempty"`
 	ContinuousQueries      []*ContinuousQueryInfo `protobuf:"bytes,4,rep,name=ContinuousQueries" json:"ContinuousQueries,omitempty"`
+	DefaultPrecision       *string                `protobuf:"bytes,5,opt,name=DefaultPrecision" json:"DefaultPrecision,omitempty"`
+	ValidationRules        []*ValidationRuleInfo  `protobuf:"bytes,6,rep,name=ValidationRules" json:"ValidationRules,omitempty"`
 	XXX_unrecognized       []byte                 `json:"-"`
 }
 
@@ -357,6 +360,20 @@ func (m *DatabaseInfo) GetContinuousQueries() []*ContinuousQueryInfo {
 	return nil
 }
 
+func (m *DatabaseInfo) GetDefaultPrecision() string {
+	if m != nil && m.DefaultPrecision != nil {
+		return *m.DefaultPrecision
+	}
+	return ""
+}
+
+func (m *DatabaseInfo) GetValidationRules() []*ValidationRuleInfo {
+	if m != nil {
+		return m.ValidationRules
+	}
+	return nil
+}
+
 type RetentionPolicySpec struct {
 	Name               *string `protobuf:"bytes,1,opt,name=Name" json:"Name,omitempty"`
 	Duration           *int64  `protobuf:"varint,2,opt,name=Duration" json:"Duration,omitempty"`
@@ -403,9 +420,10 @@ type RetentionPolicyInfo struct {
 	Duration           *int64              `protobuf:"varint,2,req,name=Duration" json:"Duration,omitempty"`
 	ShardGroupDuration *int64              `protobuf:"varint,3,req,name=ShardGroupDuration" json:"ShardGroupDuration,omitempty"`
 	ReplicaN           *uint32             `protobuf:"varint,4,req,name=ReplicaN" json:"ReplicaN,omitempty"`
-	ShardGroups        []*ShardGroupInfo   `protobuf:"bytes,5,rep,name=ShardGroups" json:"ShardGroups,omitempty"`
-	Subscriptions      []*SubscriptionInfo `protobuf:"bytes,6,rep,name=Subscriptions" json:"Subscriptions,omitempty"`
-	XXX_unrecognized   []byte              `json:"-"`
+	ShardGroups          []*ShardGroupInfo   `protobuf:"bytes,5,rep,name=ShardGroups" json:"ShardGroups,omitempty"`
+	Subscriptions        []*SubscriptionInfo `protobuf:"bytes,6,rep,name=Subscriptions" json:"Subscriptions,omitempty"`
+	IsolatedMeasurements []string            `protobuf:"bytes,7,rep,name=IsolatedMeasurements" json:"IsolatedMeasurements,omitempty"`
+	XXX_unrecognized     []byte              `json:"-"`
 }
 
 func (m *RetentionPolicyInfo) Reset()                    { *m = RetentionPolicyInfo{} }
@@ -455,6 +473,13 @@ func (m *RetentionPolicyInfo) GetSubscriptions() []*SubscriptionInfo {
 	return nil
 }
 
+func (m *RetentionPolicyInfo) GetIsolatedMeasurements() []string {
+	if m != nil {
+		return m.IsolatedMeasurements
+	}
+	return nil
+}
+
 type ShardGroupInfo struct {
 	ID               *uint64      `protobuf:"varint,1,req,name=ID" json:"ID,omitempty"`
 	StartTime        *int64       `protobuf:"varint,2,req,name=StartTime" json:"StartTime,omitempty"`
@@ -462,6 +487,7 @@ type ShardGroupInfo struct {
 	DeletedAt        *int64       `protobuf:"varint,4,req,name=DeletedAt" json:"DeletedAt,omitempty"`
 	Shards           []*ShardInfo `protobuf:"bytes,5,rep,name=Shards" json:"Shards,omitempty"`
 	TruncatedAt      *int64       `protobuf:"varint,6,opt,name=TruncatedAt" json:"TruncatedAt,omitempty"`
+	Measurement      *string      `protobuf:"bytes,7,opt,name=Measurement" json:"Measurement,omitempty"`
 	XXX_unrecognized []byte       `json:"-"`
 }
 
@@ -512,6 +538,13 @@ func (m *ShardGroupInfo) GetTruncatedAt() int64 {
 	return 0
 }
 
+func (m *ShardGroupInfo) GetMeasurement() string {
+	if m != nil && m.Measurement != nil {
+		return *m.Measurement
+	}
+	return ""
+}
+
 type ShardInfo struct {
 	ID               *uint64       `protobuf:"varint,1,req,name=ID" json:"ID,omitempty"`
 	OwnerIDs         []uint64      `protobuf:"varint,2,rep,name=OwnerIDs" json:"OwnerIDs,omitempty"`
@@ -598,6 +631,7 @@ func (m *ShardOwner) GetNodeID() uint64 {
 type ContinuousQueryInfo struct {
 	Name             *string `protobuf:"bytes,1,req,name=Name" json:"Name,omitempty"`
 	Query            *string `protobuf:"bytes,2,req,name=Query" json:"Query,omitempty"`
+	LastRun          *int64  `protobuf:"varint,3,opt,name=LastRun" json:"LastRun,omitempty"`
 	XXX_unrecognized []byte  `json:"-"`
 }
 
@@ -620,6 +654,13 @@ func (m *ContinuousQueryInfo) GetQuery() string {
 	return ""
 }
 
+func (m *ContinuousQueryInfo) GetLastRun() int64 {
+	if m != nil && m.LastRun != nil {
+		return *m.LastRun
+	}
+	return 0
+}
+
 type UserInfo struct {
 	Name             *string          `protobuf:"bytes,1,req,name=Name" json:"Name,omitempty"`
 	Hash             *string          `protobuf:"bytes,2,req,name=Hash" json:"Hash,omitempty"`
@@ -1786,6 +1827,62 @@ var E_DropShardCommand_Command = &proto.ExtensionDesc{
 	Tag:           "bytes,130,opt,name=command",
 }
 
+type ValidationRuleInfo struct {
+	Name             *string  `protobuf:"bytes,1,req,name=Name" json:"Name,omitempty"`
+	Measurement      *string  `protobuf:"bytes,2,opt,name=Measurement" json:"Measurement,omitempty"`
+	Tag              *string  `protobuf:"bytes,3,opt,name=Tag" json:"Tag,omitempty"`
+	Field            *string  `protobuf:"bytes,4,opt,name=Field" json:"Field,omitempty"`
+	Min              *float64 `protobuf:"fixed64,5,opt,name=Min" json:"Min,omitempty"`
+	Max              *float64 `protobuf:"fixed64,6,opt,name=Max" json:"Max,omitempty"`
+	XXX_unrecognized []byte   `json:"-"`
+}
+
+func (m *ValidationRuleInfo) Reset()         { *m = ValidationRuleInfo{} }
+func (m *ValidationRuleInfo) String() string { return proto.CompactTextString(m) }
+func (*ValidationRuleInfo) ProtoMessage()    {}
+
+func (m *ValidationRuleInfo) GetName() string {
+	if m != nil && m.Name != nil {
+		return *m.Name
+	}
+	return ""
+}
+
+func (m *ValidationRuleInfo) GetMeasurement() string {
+	if m != nil && m.Measurement != nil {
+		return *m.Measurement
+	}
+	return ""
+}
+
+func (m *ValidationRuleInfo) GetTag() string {
+	if m != nil && m.Tag != nil {
+		return *m.Tag
+	}
+	return ""
+}
+
+func (m *ValidationRuleInfo) GetField() string {
+	if m != nil && m.Field != nil {
+		return *m.Field
+	}
+	return ""
+}
+
+func (m *ValidationRuleInfo) GetMin() float64 {
+	if m != nil && m.Min != nil {
+		return *m.Min
+	}
+	return 0
+}
+
+func (m *ValidationRuleInfo) GetMax() float64 {
+	if m != nil && m.Max != nil {
+		return *m.Max
+	}
+	return 0
+}
+
 func init() {
 	proto.RegisterType((*Data)(nil), "meta.Data")
 	proto.RegisterType((*NodeInfo)(nil), "meta.NodeInfo")
@@ -1830,6 +1927,7 @@ func init() {
 	proto.RegisterType((*Response)(nil), "meta.Response")
 	proto.RegisterType((*SetMetaNodeCommand)(nil), "meta.SetMetaNodeCommand")
 	proto.RegisterType((*DropShardCommand)(nil), "meta.DropShardCommand")
+	proto.RegisterType((*ValidationRuleInfo)(nil), "meta.ValidationRuleInfo")
 	proto.RegisterEnum("meta.Command_Type", Command_Type_name, Command_Type_value)
 	proto.RegisterExtension(E_CreateNodeCommand_Command)
 	proto.RegisterExtension(E_DeleteNodeCommand_Command)
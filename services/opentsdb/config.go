@@ -42,6 +42,8 @@ type Config struct {
 	ConsistencyLevel string        `toml:"consistency-level"`
 	TLSEnabled       bool          `toml:"tls-enabled"`
 	Certificate      string        `toml:"certificate"`
+	PrivateKey       string        `toml:"private-key"`
+	ClientCA         string        `toml:"client-ca"`
 	BatchSize        int           `toml:"batch-size"`
 	BatchPending     int           `toml:"batch-pending"`
 	BatchTimeout     toml.Duration `toml:"batch-timeout"`
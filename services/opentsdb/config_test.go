@@ -17,6 +17,8 @@ database = "xxx"
 consistency-level ="all"
 tls-enabled = true
 certificate = "/etc/ssl/cert.pem"
+private-key = "/etc/ssl/key.pem"
+client-ca = "/etc/ssl/ca.pem"
 log-point-errors = true
 `, &c); err != nil {
 		t.Fatal(err)
@@ -35,6 +37,10 @@ log-point-errors = true
 		t.Fatalf("unexpected tls-enabled: %v", c.TLSEnabled)
 	} else if c.Certificate != "/etc/ssl/cert.pem" {
 		t.Fatalf("unexpected certificate: %s", c.Certificate)
+	} else if c.PrivateKey != "/etc/ssl/key.pem" {
+		t.Fatalf("unexpected private-key: %s", c.PrivateKey)
+	} else if c.ClientCA != "/etc/ssl/ca.pem" {
+		t.Fatalf("unexpected client-ca: %s", c.ClientCA)
 	} else if !c.LogPointErrors {
 		t.Fatalf("unexpected log-point-errors: %v", c.LogPointErrors)
 	}
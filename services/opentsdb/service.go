@@ -17,6 +17,7 @@ import (
 	"time"
 
 	"github.com/lucaswiersma/influxdb/models"
+	"github.com/lucaswiersma/influxdb/pkg/tlsconfig"
 	"github.com/lucaswiersma/influxdb/services/meta"
 	"github.com/lucaswiersma/influxdb/tsdb"
 	"go.uber.org/zap"
@@ -47,9 +48,11 @@ type Service struct {
 	ln     net.Listener  // main listener
 	httpln *chanListener // http channel-based listener
 
-	wg   sync.WaitGroup
-	tls  bool
-	cert string
+	wg       sync.WaitGroup
+	tls      bool
+	cert     string
+	key      string
+	clientCA string
 
 	mu    sync.RWMutex
 	ready bool          // Has the required database been created?
@@ -87,6 +90,8 @@ func NewService(c Config) (*Service, error) {
 	s := &Service{
 		tls:             d.TLSEnabled,
 		cert:            d.Certificate,
+		key:             d.PrivateKey,
+		clientCA:        d.ClientCA,
 		BindAddress:     d.BindAddress,
 		Database:        d.Database,
 		RetentionPolicy: d.RetentionPolicy,
@@ -122,14 +127,12 @@ func (s *Service) Open() error {
 
 	// Open listener.
 	if s.tls {
-		cert, err := tls.LoadX509KeyPair(s.cert, s.cert)
+		config, err := tlsconfig.New(s.cert, s.key, s.clientCA)
 		if err != nil {
 			return err
 		}
 
-		listener, err := tls.Listen("tcp", s.BindAddress, &tls.Config{
-			Certificates: []tls.Certificate{cert},
-		})
+		listener, err := tls.Listen("tcp", s.BindAddress, config)
 		if err != nil {
 			return err
 		}
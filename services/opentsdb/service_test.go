@@ -1,6 +1,7 @@
 package opentsdb
 
 import (
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"net"
@@ -198,6 +199,69 @@ func TestService_Telnet(t *testing.T) {
 	}
 }
 
+// Ensure a point can be written over TLS by clients with a trusted certificate.
+func TestService_TLS(t *testing.T) {
+	t.Parallel()
+
+	files, err := internal.NewTLSFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer files.Close()
+
+	s := NewTestService("db0", "127.0.0.1:0")
+	s.Service.tls, s.Service.cert, s.Service.key, s.Service.clientCA = true, files.Certificate, files.PrivateKey, files.CA
+	if err := s.Service.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Service.Close()
+
+	var called int32
+	s.WritePointsFn = func(database, retentionPolicy string, consistencyLevel models.ConsistencyLevel, points []models.Point) error {
+		atomic.StoreInt32(&called, 1)
+		return nil
+	}
+
+	// Clients without a certificate are rejected.
+	conn, err := tls.Dial("tcp", s.Service.Addr().String(), files.ClientConfig(false))
+	if err == nil {
+		_, err = conn.Write([]byte("put sys.cpu.user 1356998400 42.5 host=webserver01 cpu=0\n"))
+		if err == nil {
+			_, err = conn.Read(make([]byte, 1))
+		}
+		conn.Close()
+	}
+	if err == nil {
+		t.Fatal("expected handshake error")
+	}
+
+	conn, err = tls.Dial("tcp", s.Service.Addr().String(), files.ClientConfig(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Write([]byte("put sys.cpu.user 1356998400 42.5 host=webserver01 cpu=0")); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tick := time.Tick(10 * time.Millisecond)
+	timeout := time.After(10 * time.Second)
+
+	for {
+		select {
+		case <-tick:
+			// Verify that the writer was called.
+			if atomic.LoadInt32(&called) > 0 {
+				return
+			}
+		case <-timeout:
+			t.Fatal("points writer not called")
+		}
+	}
+}
+
 // Ensure a point can be written via the HTTP protocol.
 func TestService_HTTP(t *testing.T) {
 	t.Parallel()
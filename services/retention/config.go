@@ -2,6 +2,8 @@ package retention
 
 import (
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/lucaswiersma/influxdb/monitor/diagnostics"
@@ -12,6 +14,26 @@ import (
 type Config struct {
 	Enabled       bool          `toml:"enabled"`
 	CheckInterval toml.Duration `toml:"check-interval"`
+
+	// ShardMergeMaxSize is the combined on-disk size in bytes below which two
+	// adjacent shards in a retention policy are merged into one. A value of 0
+	// disables merging.
+	ShardMergeMaxSize toml.Size `toml:"shard-merge-max-size"`
+
+	// Precompact fully compacts the shards of a retention policy this long
+	// before they expire, so that queries rolling their data up into another
+	// retention policy read as few files as possible. Keys are of the form
+	// "database.retention_policy" and values are durations such as "1h".
+	Precompact map[string]string `toml:"precompact"`
+
+	// ArchiveDir is the directory that the data of archived retention
+	// policies is exported to, as gzipped line protocol, before their shards
+	// are deleted.
+	ArchiveDir string `toml:"archive-dir"`
+
+	// Archive lists the retention policies whose shards are archived before
+	// they are deleted. Entries are of the form "database.retention_policy".
+	Archive []string `toml:"archive"`
 }
 
 // NewConfig returns an instance of Config with defaults.
@@ -31,9 +53,45 @@ func (c Config) Validate() error {
 		return errors.New("check-interval must be positive")
 	}
 
+	if c.ShardMergeMaxSize < 0 {
+		return errors.New("shard-merge-max-size must not be negative")
+	}
+
+	if _, err := c.PrecompactDurations(); err != nil {
+		return err
+	}
+
+	for _, key := range c.Archive {
+		if !strings.Contains(key, ".") {
+			return fmt.Errorf("archive entry %s must be of the form database.retention_policy", key)
+		}
+	}
+	if len(c.Archive) > 0 && c.ArchiveDir == "" {
+		return errors.New("archive-dir must be set to archive retention policies")
+	}
+
 	return nil
 }
 
+// PrecompactDurations returns how long before they expire the shards of each
+// retention policy in Precompact are compacted.
+func (c Config) PrecompactDurations() (map[string]time.Duration, error) {
+	m := make(map[string]time.Duration, len(c.Precompact))
+	for key, v := range c.Precompact {
+		if !strings.Contains(key, ".") {
+			return nil, fmt.Errorf("precompact key %s must be of the form database.retention_policy", key)
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid precompact duration for %s: %s", key, err)
+		} else if d <= 0 {
+			return nil, fmt.Errorf("precompact duration for %s must be positive", key)
+		}
+		m[key] = d
+	}
+	return m, nil
+}
+
 // Diagnostics returns a diagnostics representation of a subset of the Config.
 func (c Config) Diagnostics() (*diagnostics.Diagnostics, error) {
 	if !c.Enabled {
@@ -43,7 +101,9 @@ func (c Config) Diagnostics() (*diagnostics.Diagnostics, error) {
 	}
 
 	return diagnostics.RowFromMap(map[string]interface{}{
-		"enabled":        true,
-		"check-interval": c.CheckInterval,
+		"enabled":              true,
+		"check-interval":       c.CheckInterval,
+		"shard-merge-max-size": c.ShardMergeMaxSize,
+		"archive-dir":          c.ArchiveDir,
 	}), nil
 }
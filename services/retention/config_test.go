@@ -14,6 +14,11 @@ func TestConfig_Parse(t *testing.T) {
 	if _, err := toml.Decode(`
 enabled = true
 check-interval = "1s"
+archive-dir = "/var/lib/influxdb/archive"
+archive = ["telegraf.autogen"]
+
+[precompact]
+"telegraf.autogen" = "1h"
 `, &c); err != nil {
 		t.Fatal(err)
 	}
@@ -23,6 +28,14 @@ check-interval = "1s"
 		t.Fatalf("unexpected enabled state: %v", c.Enabled)
 	} else if time.Duration(c.CheckInterval) != time.Second {
 		t.Fatalf("unexpected check interval: %v", c.CheckInterval)
+	} else if m, err := c.PrecompactDurations(); err != nil {
+		t.Fatal(err)
+	} else if d := m["telegraf.autogen"]; d != time.Hour {
+		t.Fatalf("unexpected precompact duration: %v", d)
+	} else if c.ArchiveDir != "/var/lib/influxdb/archive" {
+		t.Fatalf("unexpected archive dir: %s", c.ArchiveDir)
+	} else if len(c.Archive) != 1 || c.Archive[0] != "telegraf.autogen" {
+		t.Fatalf("unexpected archive: %v", c.Archive)
 	}
 }
 
@@ -43,4 +56,35 @@ func TestConfig_Validate(t *testing.T) {
 	if err := c.Validate(); err == nil {
 		t.Fatal("expected error for negative check-interval, got nil")
 	}
+
+	c = retention.NewConfig()
+	c.Precompact = map[string]string{"telegraf": "1h"}
+	if err := c.Validate(); err == nil {
+		t.Fatal("expected error for precompact key without retention policy, got nil")
+	}
+
+	c = retention.NewConfig()
+	c.Precompact = map[string]string{"telegraf.autogen": "0s"}
+	if err := c.Validate(); err == nil {
+		t.Fatal("expected error for zero precompact duration, got nil")
+	}
+
+	c = retention.NewConfig()
+	c.Precompact = map[string]string{"telegraf.autogen": "1 hour"}
+	if err := c.Validate(); err == nil {
+		t.Fatal("expected error for invalid precompact duration, got nil")
+	}
+
+	c = retention.NewConfig()
+	c.ArchiveDir = "/var/lib/influxdb/archive"
+	c.Archive = []string{"telegraf"}
+	if err := c.Validate(); err == nil {
+		t.Fatal("expected error for archive entry without retention policy, got nil")
+	}
+
+	c = retention.NewConfig()
+	c.Archive = []string{"telegraf.autogen"}
+	if err := c.Validate(); err == nil {
+		t.Fatal("expected error for archive without archive-dir, got nil")
+	}
 }
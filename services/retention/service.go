@@ -2,39 +2,91 @@
 package retention // import "github.com/lucaswiersma/influxdb/services/retention"
 
 import (
+	"compress/gzip"
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/lucaswiersma/influxdb/models"
 	"github.com/lucaswiersma/influxdb/services/meta"
 	"go.uber.org/zap"
 )
 
+// Statistics for the retention service.
+const (
+	statPrecompactions        = "precompactions"
+	statPrecompactionErrors   = "precompactionErrors"
+	statPrecompactionDuration = "precompactionDuration"
+	statArchivedShards        = "archivedShards"
+	statArchivedBytes         = "archivedBytes"
+	statArchiveErrors         = "archiveErrors"
+)
+
 // Service represents the retention policy enforcement service.
 type Service struct {
 	MetaClient interface {
 		Databases() []meta.DatabaseInfo
 		DeleteShardGroup(database, policy string, id uint64) error
+		MergeShardGroups(database, policy string, dstID, srcID uint64) error
 		PruneShardGroups() error
 	}
 	TSDBStore interface {
 		ShardIDs() []uint64
 		DeleteShard(shardID uint64) error
+		MergeShards(dst, src uint64) error
+		UnmergeShards(dst, src uint64, min, max int64) error
+		ShardDiskSize(id uint64) (int64, error)
+		PrecompactShard(id uint64) error
+		ExportShard(id uint64, w io.Writer) error
 	}
 
-	checkInterval time.Duration
-	wg            sync.WaitGroup
-	done          chan struct{}
+	checkInterval     time.Duration
+	shardMergeMaxSize int64
+	wg                sync.WaitGroup
+	done              chan struct{}
+
+	// precompact is how long before expiry the shards of each retention
+	// policy, keyed by "database.retention_policy", are fully compacted.
+	precompact map[string]time.Duration
+
+	// precompacted holds the shards that have already been precompacted.
+	precompacted map[uint64]struct{}
 
+	// archive holds the retention policies, keyed by
+	// "database.retention_policy", whose shards are exported to archiveDir
+	// before they are deleted.
+	archive    map[string]struct{}
+	archiveDir string
+
+	stats  *Statistics
 	logger zap.Logger
 }
 
 // NewService returns a configured retention policy enforcement service.
 func NewService(c Config) *Service {
+	// The config has been validated, so invalid entries are skipped.
+	precompact, _ := c.PrecompactDurations()
+
+	archive := make(map[string]struct{}, len(c.Archive))
+	for _, key := range c.Archive {
+		archive[key] = struct{}{}
+	}
+
 	return &Service{
-		checkInterval: time.Duration(c.CheckInterval),
-		done:          make(chan struct{}),
-		logger:        zap.New(zap.NullEncoder()),
+		checkInterval:     time.Duration(c.CheckInterval),
+		shardMergeMaxSize: int64(c.ShardMergeMaxSize),
+		done:              make(chan struct{}),
+		precompact:        precompact,
+		precompacted:      make(map[uint64]struct{}),
+		archive:           archive,
+		archiveDir:        c.ArchiveDir,
+		stats:             &Statistics{},
+		logger:            zap.New(zap.NullEncoder()),
 	}
 }
 
@@ -44,6 +96,14 @@ func (s *Service) Open() error {
 	s.wg.Add(2)
 	go s.deleteShardGroups()
 	go s.deleteShards()
+	if s.shardMergeMaxSize > 0 {
+		s.wg.Add(1)
+		go s.mergeShards()
+	}
+	if len(s.precompact) > 0 {
+		s.wg.Add(1)
+		go s.precompactShards()
+	}
 	return nil
 }
 
@@ -55,6 +115,32 @@ func (s *Service) Close() error {
 	return nil
 }
 
+// Statistics maintains statistics for the retention service.
+type Statistics struct {
+	Precompactions        int64
+	PrecompactionErrors   int64
+	PrecompactionDuration int64
+	ArchivedShards        int64
+	ArchivedBytes         int64
+	ArchiveErrors         int64
+}
+
+// Statistics returns statistics for periodic monitoring.
+func (s *Service) Statistics(tags map[string]string) []models.Statistic {
+	return []models.Statistic{{
+		Name: "retention",
+		Tags: tags,
+		Values: map[string]interface{}{
+			statPrecompactions:        atomic.LoadInt64(&s.stats.Precompactions),
+			statPrecompactionErrors:   atomic.LoadInt64(&s.stats.PrecompactionErrors),
+			statPrecompactionDuration: atomic.LoadInt64(&s.stats.PrecompactionDuration),
+			statArchivedShards:        atomic.LoadInt64(&s.stats.ArchivedShards),
+			statArchivedBytes:         atomic.LoadInt64(&s.stats.ArchivedBytes),
+			statArchiveErrors:         atomic.LoadInt64(&s.stats.ArchiveErrors),
+		},
+	}}
+}
+
 // WithLogger sets the logger on the service.
 func (s *Service) WithLogger(log zap.Logger) {
 	s.logger = log.With(zap.String("service", "retention"))
@@ -120,6 +206,9 @@ func (s *Service) deleteShards() {
 
 			for _, id := range s.TSDBStore.ShardIDs() {
 				if di, ok := deletedShardIDs[id]; ok {
+					if _, ok := s.archive[di.db+"."+di.rp]; ok {
+						s.archiveShard(di.db, di.rp, id)
+					}
 					if err := s.TSDBStore.DeleteShard(id); err != nil {
 						s.logger.Info(fmt.Sprintf("failed to delete shard ID %d from database %s, retention policy %s: %s",
 							id, di.db, di.rp, err.Error()))
@@ -135,3 +224,224 @@ func (s *Service) deleteShards() {
 		}
 	}
 }
+
+// archiveShard exports the data of a shard that is about to be deleted to
+// <archive-dir>/<database>/<retention_policy>/<id>.lp.gz. A failed export is
+// logged and the shard is deleted regardless, so that an unavailable archive
+// never holds up retention.
+func (s *Service) archiveShard(database, policy string, id uint64) {
+	path := filepath.Join(s.archiveDir, database, policy, fmt.Sprintf("%d.lp.gz", id))
+	n, err := s.writeArchive(path, id)
+	if err != nil {
+		atomic.AddInt64(&s.stats.ArchiveErrors, 1)
+		s.logger.Warn(fmt.Sprintf("failed to archive shard ID %d from database %s, retention policy %s, deleting it anyway: %s",
+			id, database, policy, err.Error()))
+		return
+	}
+
+	atomic.AddInt64(&s.stats.ArchivedShards, 1)
+	atomic.AddInt64(&s.stats.ArchivedBytes, n)
+	s.logger.Info(fmt.Sprintf("archived shard ID %d from database %s, retention policy %s, to %s (%d bytes)",
+		id, database, policy, path, n))
+}
+
+// writeArchive writes the data of a shard to path as gzipped line protocol
+// and returns the number of bytes written. The archive is written to a
+// temporary file first so that path never holds a partial export.
+func (s *Service) writeArchive(path string, id uint64) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return 0, err
+	}
+
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp)
+
+	if err := func() error {
+		defer f.Close()
+
+		zw := gzip.NewWriter(f)
+		if err := s.TSDBStore.ExportShard(id, zw); err != nil {
+			return err
+		} else if err := zw.Close(); err != nil {
+			return err
+		}
+		return f.Sync()
+	}(); err != nil {
+		return 0, err
+	}
+
+	fi, err := os.Stat(tmp)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
+
+func (s *Service) mergeShards() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.checkInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+
+		case <-ticker.C:
+			now := time.Now().UTC()
+			for _, d := range s.MetaClient.Databases() {
+				for _, r := range d.RetentionPolicies {
+					s.mergeRetentionPolicyShards(d.Name, &r, now)
+				}
+			}
+		}
+	}
+}
+
+// mergeRetentionPolicyShards merges pairs of adjacent, inactive shard groups
+// whose shards are together smaller than the configured maximum size.
+func (s *Service) mergeRetentionPolicyShards(database string, r *meta.RetentionPolicyInfo, now time.Time) {
+	// Only consider shard groups that have stopped receiving current writes,
+	// have not expired and hold a single local shard.
+	var groups []meta.ShardGroupInfo
+	for _, g := range r.ShardGroups {
+		if g.Deleted() || g.Truncated() || len(g.Shards) != 1 || !g.EndTime.Before(now) {
+			continue
+		} else if r.Duration != 0 && g.EndTime.Before(now.Add(-r.Duration)) {
+			continue
+		}
+		groups = append(groups, g)
+	}
+
+	// Shard groups of isolated measurements are only merged with each other.
+	sort.Stable(shardGroupsByMeasurement(groups))
+
+	for i := 0; i+1 < len(groups); i++ {
+		dst, src := groups[i], groups[i+1]
+		if !dst.EndTime.Equal(src.StartTime) || dst.Measurement != src.Measurement {
+			continue
+		}
+
+		dstID, srcID := dst.Shards[0].ID, src.Shards[0].ID
+		dstSize, err := s.TSDBStore.ShardDiskSize(dstID)
+		if err != nil {
+			continue
+		}
+		srcSize, err := s.TSDBStore.ShardDiskSize(srcID)
+		if err != nil || dstSize+srcSize >= s.shardMergeMaxSize {
+			continue
+		}
+
+		// Copy the data before updating the meta store so that a failure
+		// never leaves a shard group without its data.
+		if err := s.TSDBStore.MergeShards(dstID, srcID); err != nil {
+			s.logger.Info(fmt.Sprintf("failed to merge shard %d into shard %d in database %s, retention policy %s: %s",
+				srcID, dstID, database, r.Name, err.Error()))
+			continue
+		}
+		if err := s.MetaClient.MergeShardGroups(database, r.Name, dst.ID, src.ID); err != nil {
+			s.logger.Info(fmt.Sprintf("failed to merge shard group %d into shard group %d in database %s, retention policy %s: %s",
+				src.ID, dst.ID, database, r.Name, err.Error()))
+
+			// The source shard group is still in use so remove its copied
+			// data from the destination and let it accept writes again.
+			if err := s.TSDBStore.UnmergeShards(dstID, srcID, src.StartTime.UnixNano(), src.EndTime.UnixNano()-1); err != nil {
+				s.logger.Info(fmt.Sprintf("failed to undo merge of shard %d into shard %d in database %s, retention policy %s: %s",
+					srcID, dstID, database, r.Name, err.Error()))
+			}
+			continue
+		}
+		s.logger.Info(fmt.Sprintf("merged shard %d into shard %d in database %s, retention policy %s",
+			srcID, dstID, database, r.Name))
+
+		// The source group is gone so skip past it.
+		i++
+	}
+}
+
+func (s *Service) precompactShards() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.checkInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+
+		case <-ticker.C:
+			s.precompactExpiringShards(time.Now().UTC())
+		}
+	}
+}
+
+// precompactExpiringShards fully compacts the local shards of retention
+// policies with precompaction enabled once they are within the configured
+// duration of expiring. Each shard is only precompacted once.
+func (s *Service) precompactExpiringShards(now time.Time) {
+	local := make(map[uint64]struct{})
+	for _, id := range s.TSDBStore.ShardIDs() {
+		local[id] = struct{}{}
+	}
+
+	// Forget shards that no longer exist.
+	for id := range s.precompacted {
+		if _, ok := local[id]; !ok {
+			delete(s.precompacted, id)
+		}
+	}
+
+	for _, d := range s.MetaClient.Databases() {
+		for _, r := range d.RetentionPolicies {
+			lead, ok := s.precompact[d.Name+"."+r.Name]
+			if !ok || r.Duration == 0 {
+				continue
+			}
+
+			for _, g := range r.ShardGroups {
+				expiry := g.EndTime.Add(r.Duration)
+				if g.Deleted() || !now.Before(expiry) || now.Before(expiry.Add(-lead)) {
+					continue
+				}
+
+				for _, sh := range g.Shards {
+					if _, ok := local[sh.ID]; !ok {
+						continue
+					} else if _, ok := s.precompacted[sh.ID]; ok {
+						continue
+					}
+
+					start := time.Now()
+					err := s.TSDBStore.PrecompactShard(sh.ID)
+					atomic.AddInt64(&s.stats.PrecompactionDuration, time.Since(start).Nanoseconds())
+					if err != nil {
+						atomic.AddInt64(&s.stats.PrecompactionErrors, 1)
+						s.logger.Info(fmt.Sprintf("failed to precompact shard %d in database %s, retention policy %s: %s",
+							sh.ID, d.Name, r.Name, err.Error()))
+						continue
+					}
+
+					s.precompacted[sh.ID] = struct{}{}
+					atomic.AddInt64(&s.stats.Precompactions, 1)
+					s.logger.Info(fmt.Sprintf("precompacted shard %d in database %s, retention policy %s, expiring at %s, in %s",
+						sh.ID, d.Name, r.Name, expiry.Format(time.RFC3339), time.Since(start)))
+				}
+			}
+		}
+	}
+}
+
+// shardGroupsByMeasurement sorts shard groups by the measurement they are
+// isolated for.
+type shardGroupsByMeasurement []meta.ShardGroupInfo
+
+func (a shardGroupsByMeasurement) Len() int           { return len(a) }
+func (a shardGroupsByMeasurement) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a shardGroupsByMeasurement) Less(i, j int) bool { return a[i].Measurement < a[j].Measurement }
@@ -0,0 +1,202 @@
+package retention
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lucaswiersma/influxdb/services/meta"
+)
+
+func TestService_PrecompactExpiringShards(t *testing.T) {
+	now := time.Date(2017, 6, 10, 12, 0, 0, 0, time.UTC)
+	day := func(n int) time.Time { return now.Truncate(24*time.Hour).AddDate(0, 0, n) }
+
+	metaClient := &metaClient{dbs: []meta.DatabaseInfo{{
+		Name: "db0",
+		RetentionPolicies: []meta.RetentionPolicyInfo{
+			{
+				Name:     "raw",
+				Duration: 7 * 24 * time.Hour,
+				ShardGroups: []meta.ShardGroupInfo{
+					// Expires in 12 hours.
+					{ID: 1, StartTime: day(-8), EndTime: day(-7).Add(24 * time.Hour), Shards: []meta.ShardInfo{{ID: 10}}},
+					// Expires in 36 hours.
+					{ID: 2, StartTime: day(-6).Add(-24 * time.Hour), EndTime: day(-6).Add(24 * time.Hour), Shards: []meta.ShardInfo{{ID: 20}}},
+					// Expired.
+					{ID: 3, StartTime: day(-9), EndTime: day(-8), Shards: []meta.ShardInfo{{ID: 30}}},
+				},
+			},
+			{
+				Name:     "rollup",
+				Duration: 7 * 24 * time.Hour,
+				ShardGroups: []meta.ShardGroupInfo{
+					{ID: 4, StartTime: day(-8), EndTime: day(-7).Add(24 * time.Hour), Shards: []meta.ShardInfo{{ID: 40}}},
+				},
+			},
+		},
+	}}}
+	store := &tsdbStore{ids: []uint64{10, 20, 30, 40}}
+
+	s := NewService(Config{Precompact: map[string]string{"db0.raw": "24h"}})
+	s.MetaClient = metaClient
+	s.TSDBStore = store
+
+	// Only the shard of the opted in retention policy within a day of
+	// expiring is precompacted.
+	s.precompactExpiringShards(now)
+	if exp := []uint64{10}; !reflect.DeepEqual(store.precompacted, exp) {
+		t.Fatalf("unexpected precompacted shards: got %v, exp %v", store.precompacted, exp)
+	}
+
+	// Shards are only precompacted once.
+	s.precompactExpiringShards(now.Add(time.Hour))
+	if exp := []uint64{10}; !reflect.DeepEqual(store.precompacted, exp) {
+		t.Fatalf("unexpected precompacted shards: got %v, exp %v", store.precompacted, exp)
+	}
+
+	// Failed precompactions are retried on the next check.
+	store.err = errors.New("compaction in progress")
+	s.precompactExpiringShards(now.Add(13 * time.Hour))
+	store.err = nil
+	s.precompactExpiringShards(now.Add(14 * time.Hour))
+	if exp := []uint64{10, 20, 20}; !reflect.DeepEqual(store.precompacted, exp) {
+		t.Fatalf("unexpected precompacted shards: got %v, exp %v", store.precompacted, exp)
+	}
+
+	if got, exp := s.stats.Precompactions, int64(2); got != exp {
+		t.Fatalf("unexpected precompactions: got %d, exp %d", got, exp)
+	} else if got, exp := s.stats.PrecompactionErrors, int64(1); got != exp {
+		t.Fatalf("unexpected precompaction errors: got %d, exp %d", got, exp)
+	}
+}
+
+func TestService_MergeShards_MetaError(t *testing.T) {
+	now := time.Date(2017, 6, 10, 12, 0, 0, 0, time.UTC)
+	day := func(n int) time.Time { return now.Truncate(24*time.Hour).AddDate(0, 0, n) }
+
+	rp := meta.RetentionPolicyInfo{
+		Name: "rp0",
+		ShardGroups: []meta.ShardGroupInfo{
+			{ID: 1, StartTime: day(-3), EndTime: day(-2), Shards: []meta.ShardInfo{{ID: 10}}},
+			{ID: 2, StartTime: day(-2), EndTime: day(-1), Shards: []meta.ShardInfo{{ID: 20}}},
+		},
+	}
+	store := &tsdbStore{}
+	s := NewService(Config{ShardMergeMaxSize: 1024})
+	s.MetaClient = &metaClient{mergeErr: errors.New("meta unavailable")}
+	s.TSDBStore = store
+
+	// The merge of the shards is undone when the shard groups cannot be merged.
+	s.mergeRetentionPolicyShards("db0", &rp, now)
+	if exp := [][2]uint64{{10, 20}}; !reflect.DeepEqual(store.merged, exp) {
+		t.Fatalf("unexpected merged shards: got %v, exp %v", store.merged, exp)
+	} else if !reflect.DeepEqual(store.unmerged, exp) {
+		t.Fatalf("unexpected unmerged shards: got %v, exp %v", store.unmerged, exp)
+	} else if min, max := store.unmergedMin, store.unmergedMax; min != day(-2).UnixNano() || max != day(-1).UnixNano()-1 {
+		t.Fatalf("unexpected unmerged time range: %d-%d", min, max)
+	}
+}
+
+func TestService_ArchiveShard(t *testing.T) {
+	dir, err := ioutil.TempDir("", "retention")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store := &tsdbStore{export: "cpu,host=server01 value=1 1000000000\n"}
+	s := NewService(Config{ArchiveDir: dir, Archive: []string{"db0.rp0"}})
+	s.TSDBStore = store
+
+	s.archiveShard("db0", "rp0", 10)
+
+	path := filepath.Join(dir, "db0", "rp0", "10.lp.gz")
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf, err := ioutil.ReadAll(zr); err != nil {
+		t.Fatal(err)
+	} else if string(buf) != store.export {
+		t.Fatalf("unexpected archive contents: %q", buf)
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	} else if got, exp := s.stats.ArchivedBytes, fi.Size(); got != exp {
+		t.Fatalf("unexpected archived bytes: got %d, exp %d", got, exp)
+	} else if got, exp := s.stats.ArchivedShards, int64(1); got != exp {
+		t.Fatalf("unexpected archived shards: got %d, exp %d", got, exp)
+	}
+
+	// A failed export is counted and leaves nothing behind.
+	store.err = errors.New("shard closed")
+	s.archiveShard("db0", "rp0", 20)
+	if _, err := os.Stat(filepath.Join(dir, "db0", "rp0", "20.lp.gz")); !os.IsNotExist(err) {
+		t.Fatalf("expected no archive for failed export, got %v", err)
+	} else if _, err := os.Stat(filepath.Join(dir, "db0", "rp0", "20.lp.gz.tmp")); !os.IsNotExist(err) {
+		t.Fatalf("expected temporary archive to be removed, got %v", err)
+	} else if got, exp := s.stats.ArchiveErrors, int64(1); got != exp {
+		t.Fatalf("unexpected archive errors: got %d, exp %d", got, exp)
+	}
+}
+
+type metaClient struct {
+	dbs      []meta.DatabaseInfo
+	mergeErr error
+}
+
+func (c *metaClient) Databases() []meta.DatabaseInfo                                      { return c.dbs }
+func (c *metaClient) DeleteShardGroup(database, policy string, id uint64) error           { return nil }
+func (c *metaClient) MergeShardGroups(database, policy string, dstID, srcID uint64) error {
+	return c.mergeErr
+}
+func (c *metaClient) PruneShardGroups() error                                             { return nil }
+
+type tsdbStore struct {
+	ids          []uint64
+	err          error
+	precompacted []uint64
+	export       string
+	merged       [][2]uint64
+	unmerged     [][2]uint64
+	unmergedMin  int64
+	unmergedMax  int64
+}
+
+func (s *tsdbStore) ShardIDs() []uint64                     { return s.ids }
+func (s *tsdbStore) DeleteShard(shardID uint64) error       { return nil }
+func (s *tsdbStore) MergeShards(dst, src uint64) error {
+	s.merged = append(s.merged, [2]uint64{dst, src})
+	return nil
+}
+func (s *tsdbStore) UnmergeShards(dst, src uint64, min, max int64) error {
+	s.unmerged = append(s.unmerged, [2]uint64{dst, src})
+	s.unmergedMin, s.unmergedMax = min, max
+	return nil
+}
+func (s *tsdbStore) ShardDiskSize(id uint64) (int64, error) { return 0, nil }
+func (s *tsdbStore) ExportShard(id uint64, w io.Writer) error {
+	if s.err != nil {
+		return s.err
+	}
+	_, err := io.WriteString(w, s.export)
+	return err
+}
+func (s *tsdbStore) PrecompactShard(id uint64) error {
+	s.precompacted = append(s.precompacted, id)
+	return s.err
+}
@@ -7,6 +7,7 @@ import (
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net"
 	"strings"
 	"sync"
@@ -119,7 +120,7 @@ func (s *Service) handleConn(conn net.Conn) error {
 			return err
 		}
 	case RequestMetastoreBackup:
-		if err := s.writeMetaStore(conn); err != nil {
+		if err := s.WriteMetastoreBackup(conn); err != nil {
 			return err
 		}
 	case RequestDatabaseInfo:
@@ -133,7 +134,8 @@ func (s *Service) handleConn(conn net.Conn) error {
 	return nil
 }
 
-func (s *Service) writeMetaStore(conn net.Conn) error {
+// WriteMetastoreBackup writes a backup of the meta store and of the node to w.
+func (s *Service) WriteMetastoreBackup(w io.Writer) error {
 	// Retrieve and serialize the current meta data.
 	metaBlob, err := s.MetaClient.MarshalBinary()
 	if err != nil {
@@ -152,19 +154,19 @@ func (s *Service) writeMetaStore(conn net.Conn) error {
 	binary.BigEndian.PutUint64(numBytes[16:24], uint64(nodeBytes.Len()))
 
 	// backup header followed by meta blob length
-	if _, err := conn.Write(numBytes[:16]); err != nil {
+	if _, err := w.Write(numBytes[:16]); err != nil {
 		return err
 	}
 
-	if _, err := conn.Write(metaBlob); err != nil {
+	if _, err := w.Write(metaBlob); err != nil {
 		return err
 	}
 
-	if _, err := conn.Write(numBytes[16:24]); err != nil {
+	if _, err := w.Write(numBytes[16:24]); err != nil {
 		return err
 	}
 
-	if _, err := nodeBytes.WriteTo(conn); err != nil {
+	if _, err := nodeBytes.WriteTo(w); err != nil {
 		return err
 	}
 	return nil
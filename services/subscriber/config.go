@@ -42,6 +42,10 @@ type Config struct {
 
 	// The number of in-flight writes buffered in the write channel.
 	WriteBufferSize int `toml:"write-buffer-size"`
+
+	// The number of writer goroutines shared by all subscriptions. If zero,
+	// each subscription has write-concurrency goroutines of its own.
+	MaxConcurrentDeliveries int `toml:"max-concurrent-deliveries"`
 }
 
 // NewConfig returns a new instance of a subscriber config.
@@ -78,6 +82,10 @@ func (c Config) Validate() error {
 		return errors.New("write-concurrency must be greater than 0")
 	}
 
+	if c.MaxConcurrentDeliveries < 0 {
+		return errors.New("max-concurrent-deliveries must be greater than or equal to 0")
+	}
+
 	return nil
 }
 
@@ -95,9 +103,10 @@ func (c Config) Diagnostics() (*diagnostics.Diagnostics, error) {
 	}
 
 	return diagnostics.RowFromMap(map[string]interface{}{
-		"enabled":           true,
-		"http-timeout":      c.HTTPTimeout,
-		"write-concurrency": c.WriteConcurrency,
-		"write-buffer-size": c.WriteBufferSize,
+		"enabled":                   true,
+		"http-timeout":              c.HTTPTimeout,
+		"write-concurrency":         c.WriteConcurrency,
+		"write-buffer-size":         c.WriteBufferSize,
+		"max-concurrent-deliveries": c.MaxConcurrentDeliveries,
 	}), nil
 }
@@ -109,3 +109,16 @@ write-concurrency = 10
 		t.Errorf("Expected Validation to succeed. Instead was: %v", err)
 	}
 }
+
+func TestConfig_ValidateMaxConcurrentDeliveries(t *testing.T) {
+	c := subscriber.NewConfig()
+	c.MaxConcurrentDeliveries = -1
+	if err := c.Validate(); err == nil || err.Error() != "max-concurrent-deliveries must be greater than or equal to 0" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	c.MaxConcurrentDeliveries = 10
+	if err := c.Validate(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
@@ -19,9 +19,11 @@ import (
 
 // Statistics for the Subscriber service.
 const (
-	statCreateFailures = "createFailures"
-	statPointsWritten  = "pointsWritten"
-	statWriteFailures  = "writeFailures"
+	statCreateFailures     = "createFailures"
+	statPointsWritten      = "pointsWritten"
+	statWriteFailures      = "writeFailures"
+	statDeliveryQueueDepth = "deliveryQueueDepth"
+	statDeliveriesDropped  = "deliveriesDropped"
 )
 
 // PointsWriter is an interface for writing points to a subscription destination.
@@ -51,6 +53,7 @@ type Service struct {
 	update          chan struct{}
 	stats           *Statistics
 	points          chan *coordinator.WritePointsRequest
+	deliveries      chan delivery
 	wg              sync.WaitGroup
 	closed          bool
 	closing         chan struct{}
@@ -91,6 +94,13 @@ func (s *Service) Open() error {
 	s.update = make(chan struct{})
 	s.points = make(chan *coordinator.WritePointsRequest, 100)
 
+	// Writes for every subscription share the same writers if the number of
+	// concurrent deliveries is limited.
+	s.deliveries = nil
+	if s.conf.MaxConcurrentDeliveries > 0 {
+		s.deliveries = make(chan delivery, s.conf.WriteBufferSize)
+	}
+
 	s.wg.Add(2)
 	go func() {
 		defer s.wg.Done()
@@ -132,26 +142,36 @@ func (s *Service) WithLogger(log zap.Logger) {
 
 // Statistics maintains the statistics for the subscriber service.
 type Statistics struct {
-	CreateFailures int64
-	PointsWritten  int64
-	WriteFailures  int64
+	CreateFailures    int64
+	PointsWritten     int64
+	WriteFailures     int64
+	DeliveriesDropped int64
 }
 
 // Statistics returns statistics for periodic monitoring.
 func (s *Service) Statistics(tags map[string]string) []models.Statistic {
+	s.subMu.RLock()
+	defer s.subMu.RUnlock()
+
+	// Writes are queued in the shared queue or in the queue of each
+	// subscription.
+	depth := len(s.deliveries)
+	for _, sub := range s.subs {
+		depth += len(sub.writeRequests)
+	}
+
 	statistics := []models.Statistic{{
 		Name: "subscriber",
 		Tags: tags,
 		Values: map[string]interface{}{
-			statCreateFailures: atomic.LoadInt64(&s.stats.CreateFailures),
-			statPointsWritten:  atomic.LoadInt64(&s.stats.PointsWritten),
-			statWriteFailures:  atomic.LoadInt64(&s.stats.WriteFailures),
+			statCreateFailures:     atomic.LoadInt64(&s.stats.CreateFailures),
+			statPointsWritten:      atomic.LoadInt64(&s.stats.PointsWritten),
+			statWriteFailures:      atomic.LoadInt64(&s.stats.WriteFailures),
+			statDeliveryQueueDepth: int64(depth),
+			statDeliveriesDropped:  atomic.LoadInt64(&s.stats.DeliveriesDropped),
 		},
 	}}
 
-	s.subMu.RLock()
-	defer s.subMu.RUnlock()
-
 	for _, sub := range s.subs {
 		statistics = append(statistics, sub.Statistics(tags)...)
 	}
@@ -232,6 +252,16 @@ func (s *Service) Points() chan<- *coordinator.WritePointsRequest {
 func (s *Service) run() {
 	var wg sync.WaitGroup
 	s.subs = make(map[subEntry]chanWriter)
+
+	// Start the writers shared by all subscriptions.
+	for i := 0; i < s.conf.MaxConcurrentDeliveries; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.deliver()
+		}()
+	}
+
 	// Perform initial update
 	s.updateSubs(&wg)
 	for {
@@ -246,17 +276,41 @@ func (s *Service) run() {
 			}
 			for se, cw := range s.subs {
 				if p.Database == se.db && p.RetentionPolicy == se.rp {
-					select {
-					case cw.writeRequests <- p:
-					default:
-						atomic.AddInt64(&s.stats.WriteFailures, 1)
-					}
+					s.enqueue(cw, p)
 				}
 			}
 		}
 	}
 }
 
+// enqueue queues a write for a subscription. The write is dropped if the
+// queue is full.
+func (s *Service) enqueue(cw chanWriter, p *coordinator.WritePointsRequest) {
+	if s.deliveries != nil {
+		select {
+		case s.deliveries <- delivery{cw: cw, req: p}:
+			return
+		default:
+		}
+	} else {
+		select {
+		case cw.writeRequests <- p:
+			return
+		default:
+		}
+	}
+	atomic.AddInt64(&s.stats.WriteFailures, 1)
+	atomic.AddInt64(&s.stats.DeliveriesDropped, 1)
+}
+
+// deliver writes the queued writes of every subscription until the shared
+// queue is closed.
+func (s *Service) deliver() {
+	for d := range s.deliveries {
+		d.cw.write(d.req)
+	}
+}
+
 // close closes the existing channel writers.
 func (s *Service) close(wg *sync.WaitGroup) {
 	s.subMu.Lock()
@@ -265,6 +319,9 @@ func (s *Service) close(wg *sync.WaitGroup) {
 	for _, cw := range s.subs {
 		cw.Close()
 	}
+	if s.deliveries != nil {
+		close(s.deliveries)
+	}
 	// Wait for them to finish
 	wg.Wait()
 	s.subs = nil
@@ -300,18 +357,23 @@ func (s *Service) updateSubs(wg *sync.WaitGroup) {
 					continue
 				}
 				cw := chanWriter{
-					writeRequests: make(chan *coordinator.WritePointsRequest, s.conf.WriteBufferSize),
 					pw:            sub,
 					pointsWritten: &s.stats.PointsWritten,
 					failures:      &s.stats.WriteFailures,
 					logger:        s.Logger,
 				}
-				for i := 0; i < s.conf.WriteConcurrency; i++ {
-					wg.Add(1)
-					go func() {
-						defer wg.Done()
-						cw.Run()
-					}()
+
+				// Writes are queued for the shared writers if there are
+				// any, otherwise for writers of the subscription's own.
+				if s.deliveries == nil {
+					cw.writeRequests = make(chan *coordinator.WritePointsRequest, s.conf.WriteBufferSize)
+					for i := 0; i < s.conf.WriteConcurrency; i++ {
+						wg.Add(1)
+						go func() {
+							defer wg.Done()
+							cw.Run()
+						}()
+					}
 				}
 				s.subs[se] = cw
 				s.Logger.Info(fmt.Sprintf("added new subscription for %s %s", se.db, se.rp))
@@ -349,7 +411,14 @@ func (s *Service) newPointsWriter(u url.URL) (PointsWriter, error) {
 	}
 }
 
+// delivery is a write for a subscription queued for the shared writers.
+type delivery struct {
+	cw  chanWriter
+	req *coordinator.WritePointsRequest
+}
+
 // chanWriter sends WritePointsRequest to a PointsWriter received over a channel.
+// The channel is nil if writes are delivered by the shared writers.
 type chanWriter struct {
 	writeRequests chan *coordinator.WritePointsRequest
 	pw            PointsWriter
@@ -360,18 +429,25 @@ type chanWriter struct {
 
 // Close closes the chanWriter.
 func (c chanWriter) Close() {
-	close(c.writeRequests)
+	if c.writeRequests != nil {
+		close(c.writeRequests)
+	}
 }
 
 func (c chanWriter) Run() {
 	for wr := range c.writeRequests {
-		err := c.pw.WritePoints(wr)
-		if err != nil {
-			c.logger.Info(err.Error())
-			atomic.AddInt64(c.failures, 1)
-		} else {
-			atomic.AddInt64(c.pointsWritten, int64(len(wr.Points)))
-		}
+		c.write(wr)
+	}
+}
+
+// write sends a write to the subscription's PointsWriter.
+func (c chanWriter) write(wr *coordinator.WritePointsRequest) {
+	err := c.pw.WritePoints(wr)
+	if err != nil {
+		c.logger.Info(err.Error())
+		atomic.AddInt64(c.failures, 1)
+	} else {
+		atomic.AddInt64(c.pointsWritten, int64(len(wr.Points)))
 	}
 }
 
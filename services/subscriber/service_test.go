@@ -441,3 +441,80 @@ func TestService_WaitForDataChanged(t *testing.T) {
 
 	close(dataChanged)
 }
+
+func TestService_MaxConcurrentDeliveries(t *testing.T) {
+	dataChanged := make(chan struct{})
+	ms := MetaClient{}
+	ms.WaitForDataChangedFn = func() chan struct{} {
+		return dataChanged
+	}
+	ms.DatabasesFn = func() []meta.DatabaseInfo {
+		return []meta.DatabaseInfo{
+			{
+				Name: "db0",
+				RetentionPolicies: []meta.RetentionPolicyInfo{
+					{
+						Name: "rp0",
+						Subscriptions: []meta.SubscriptionInfo{
+							{Name: "s0", Mode: "ANY", Destinations: []string{"udp://h0:9093"}},
+						},
+					},
+				},
+			},
+		}
+	}
+
+	// Block the only writer until the test is done.
+	started := make(chan *coordinator.WritePointsRequest, 1)
+	release := make(chan struct{})
+	newPointsWriter := func(u url.URL) (subscriber.PointsWriter, error) {
+		sub := Subscription{}
+		sub.WritePointsFn = func(p *coordinator.WritePointsRequest) error {
+			started <- p
+			<-release
+			return nil
+		}
+		return sub, nil
+	}
+
+	c := subscriber.NewConfig()
+	c.MaxConcurrentDeliveries = 1
+	c.WriteBufferSize = 1
+	s := subscriber.NewService(c)
+	s.MetaClient = ms
+	s.NewPointsWriter = newPointsWriter
+	s.Open()
+	defer s.Close()
+	defer close(release)
+
+	expPR := &coordinator.WritePointsRequest{Database: "db0", RetentionPolicy: "rp0"}
+	s.Points() <- expPR
+	select {
+	case pr := <-started:
+		if pr != expPR {
+			t.Fatalf("unexpected points request: got %v, exp %v", pr, expPR)
+		}
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("expected points request")
+	}
+
+	// The next write is queued while the writer is busy and the rest are
+	// dropped.
+	for i := 0; i < 3; i++ {
+		s.Points() <- &coordinator.WritePointsRequest{Database: "db0", RetentionPolicy: "rp0"}
+	}
+
+	timeout := time.After(100 * time.Millisecond)
+	for {
+		values := s.Statistics(nil)[0].Values
+		if values["deliveriesDropped"] == int64(2) && values["deliveryQueueDepth"] == int64(1) {
+			break
+		}
+
+		select {
+		case <-timeout:
+			t.Fatalf("unexpected statistics: %v", values)
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
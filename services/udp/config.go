@@ -55,6 +55,10 @@ type Config struct {
 	ReadBuffer      int           `toml:"read-buffer"`
 	BatchTimeout    toml.Duration `toml:"batch-timeout"`
 	Precision       string        `toml:"precision"`
+
+	// NormalizeNames converts the measurement, tag keys and field keys of
+	// each point to Unicode Normalization Form C.
+	NormalizeNames bool `toml:"normalize-names"`
 }
 
 // NewConfig returns a new instance of Config with defaults.
@@ -28,6 +28,7 @@ const (
 	statPointsReceived      = "pointsRx"
 	statBytesReceived       = "bytesRx"
 	statPointsParseFail     = "pointsParseFail"
+	statPointsNormalized    = "pointsNormalized"
 	statReadFail            = "readFail"
 	statBatchesTransmitted  = "batchesTx"
 	statPointsTransmitted   = "pointsTx"
@@ -127,6 +128,7 @@ type Statistics struct {
 	PointsReceived      int64
 	BytesReceived       int64
 	PointsParseFail     int64
+	PointsNormalized    int64
 	ReadFail            int64
 	BatchesTransmitted  int64
 	PointsTransmitted   int64
@@ -142,6 +144,7 @@ func (s *Service) Statistics(tags map[string]string) []models.Statistic {
 			statPointsReceived:      atomic.LoadInt64(&s.stats.PointsReceived),
 			statBytesReceived:       atomic.LoadInt64(&s.stats.BytesReceived),
 			statPointsParseFail:     atomic.LoadInt64(&s.stats.PointsParseFail),
+			statPointsNormalized:    atomic.LoadInt64(&s.stats.PointsNormalized),
 			statReadFail:            atomic.LoadInt64(&s.stats.ReadFail),
 			statBatchesTransmitted:  atomic.LoadInt64(&s.stats.BatchesTransmitted),
 			statPointsTransmitted:   atomic.LoadInt64(&s.stats.PointsTransmitted),
@@ -211,7 +214,7 @@ func (s *Service) parser() {
 		case <-s.done:
 			return
 		case buf := <-s.parserChan:
-			points, err := models.ParsePointsWithPrecision(buf, time.Now().UTC(), s.config.Precision)
+			points, err := s.parsePoints(buf)
 			if err != nil {
 				atomic.AddInt64(&s.stats.PointsParseFail, 1)
 				s.Logger.Info(fmt.Sprintf("Failed to parse points: %s", err))
@@ -226,6 +229,17 @@ func (s *Service) parser() {
 	}
 }
 
+// parsePoints parses the points in buf, normalizing their names if the
+// service is configured to.
+func (s *Service) parsePoints(buf []byte) ([]models.Point, error) {
+	if !s.config.NormalizeNames {
+		return models.ParsePointsWithPrecision(buf, time.Now().UTC(), s.config.Precision)
+	}
+	points, n, err := models.ParsePointsNormalized(buf, time.Now().UTC(), s.config.Precision)
+	atomic.AddInt64(&s.stats.PointsNormalized, int64(n))
+	return points, err
+}
+
 // Close closes the service and the underlying listener.
 func (s *Service) Close() error {
 	s.mu.Lock()
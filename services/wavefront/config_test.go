@@ -0,0 +1,45 @@
+package wavefront_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/lucaswiersma/influxdb/services/wavefront"
+)
+
+func TestConfig_Parse(t *testing.T) {
+	// Parse configuration.
+	var c wavefront.Config
+	if _, err := toml.Decode(`
+enabled = true
+bind-address = ":9000"
+database = "xxx"
+retention-policy = "yyy"
+source-tag = "host"
+batch-size = 100
+batch-timeout = "5s"
+log-point-errors = false
+`, &c); err != nil {
+		t.Fatal(err)
+	}
+
+	// Validate configuration.
+	if c.Enabled != true {
+		t.Fatalf("unexpected enabled: %v", c.Enabled)
+	} else if c.BindAddress != ":9000" {
+		t.Fatalf("unexpected bind address: %s", c.BindAddress)
+	} else if c.Database != "xxx" {
+		t.Fatalf("unexpected database: %s", c.Database)
+	} else if c.RetentionPolicy != "yyy" {
+		t.Fatalf("unexpected retention policy: %s", c.RetentionPolicy)
+	} else if c.SourceTag != "host" {
+		t.Fatalf("unexpected source tag: %s", c.SourceTag)
+	} else if c.BatchSize != 100 {
+		t.Fatalf("unexpected batch size: %d", c.BatchSize)
+	} else if time.Duration(c.BatchTimeout) != 5*time.Second {
+		t.Fatalf("unexpected batch timeout: %v", c.BatchTimeout)
+	} else if c.LogPointErrors {
+		t.Fatalf("unexpected log-point-errors: %v", c.LogPointErrors)
+	}
+}
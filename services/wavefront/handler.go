@@ -0,0 +1,170 @@
+package wavefront
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/lucaswiersma/influxdb"
+	"github.com/lucaswiersma/influxdb/models"
+	"go.uber.org/zap"
+)
+
+// Handler is an http.Handler that accepts batches of lines in the Wavefront
+// data format.
+type Handler struct {
+	Database        string
+	RetentionPolicy string
+
+	PointsWriter interface {
+		WritePoints(database, retentionPolicy string, consistencyLevel models.ConsistencyLevel, points []models.Point) error
+	}
+
+	Parser         *Parser
+	LogPointErrors bool
+	Logger         zap.Logger
+
+	stats *Statistics
+}
+
+// ServeHTTP handles an HTTP request containing newline separated points.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/report":
+		h.serveReport(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// serveReport parses and writes a batch of lines. Lines that cannot be
+// parsed are dropped and reported in the response after the valid points
+// have been written.
+func (h *Handler) serveReport(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	// Require POST method.
+	if r.Method != "POST" {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Wrap reader if it's gzip encoded.
+	var body io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, "could not read gzip, "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		body = zr
+	}
+
+	var (
+		points   []models.Point
+		rejected int
+	)
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		atomic.AddInt64(&h.stats.LinesReceived, 1)
+		atomic.AddInt64(&h.stats.BytesReceived, int64(len(line)))
+
+		pt, err := h.Parser.Parse(line)
+		if err != nil {
+			atomic.AddInt64(&h.stats.LinesRejected, 1)
+			if h.LogPointErrors {
+				h.Logger.Info(fmt.Sprintf("unable to parse line: %s: %s", line, err))
+			}
+			rejected++
+			continue
+		}
+		atomic.AddInt64(&h.stats.LinesParsed, 1)
+		points = append(points, pt)
+	}
+	if err := scanner.Err(); err != nil {
+		http.Error(w, "error reading request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Write points.
+	if len(points) > 0 {
+		if err := h.PointsWriter.WritePoints(h.Database, h.RetentionPolicy, models.ConsistencyLevelAny, points); influxdb.IsClientError(err) {
+			h.Logger.Info(fmt.Sprint("write series error: ", err))
+			http.Error(w, "write series error: "+err.Error(), http.StatusBadRequest)
+			return
+		} else if err != nil {
+			h.Logger.Info(fmt.Sprint("write series error: ", err))
+			http.Error(w, "write series error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		atomic.AddInt64(&h.stats.BatchesTransmitted, 1)
+		atomic.AddInt64(&h.stats.PointsTransmitted, int64(len(points)))
+	}
+
+	if rejected > 0 {
+		http.Error(w, fmt.Sprintf("partial write: %d lines rejected", rejected), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// chanListener represents a listener that receives connections through a channel.
+type chanListener struct {
+	addr   net.Addr
+	ch     chan net.Conn
+	done   chan struct{}
+	closer sync.Once // closer ensures that Close is idempotent.
+}
+
+// newChanListener returns a new instance of chanListener.
+func newChanListener(addr net.Addr) *chanListener {
+	return &chanListener{
+		addr: addr,
+		ch:   make(chan net.Conn),
+		done: make(chan struct{}),
+	}
+}
+
+func (ln *chanListener) Accept() (net.Conn, error) {
+	errClosed := errors.New("network connection closed")
+	select {
+	case <-ln.done:
+		return nil, errClosed
+	case conn, ok := <-ln.ch:
+		if !ok {
+			return nil, errClosed
+		}
+		return conn, nil
+	}
+}
+
+// Close closes the chanListener.
+func (ln *chanListener) Close() error {
+	ln.closer.Do(func() {
+		close(ln.done)
+	})
+	return nil
+}
+
+// Addr returns the network address of the listener.
+func (ln *chanListener) Addr() net.Addr { return ln.addr }
+
+// readerConn represents a net.Conn with an assignable reader.
+type readerConn struct {
+	net.Conn
+	r io.Reader
+}
+
+// Read implements the io.Reader interface.
+func (conn *readerConn) Read(b []byte) (n int, err error) { return conn.r.Read(b) }
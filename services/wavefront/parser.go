@@ -0,0 +1,157 @@
+package wavefront
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lucaswiersma/influxdb/models"
+)
+
+var (
+	// ErrMissingValue is returned when a line has no metric value.
+	ErrMissingValue = errors.New("missing metric value")
+
+	// ErrUnterminatedQuote is returned when a quoted name or tag value is not closed.
+	ErrUnterminatedQuote = errors.New("unterminated quote")
+)
+
+// Parser encapsulates the logic of parsing lines in the Wavefront data format
+// into points. Each line has the form:
+//   <metricName> <metricValue> [<timestamp>] source=<source> [<tagKey>=<tagValue> ...]
+type Parser struct {
+	// SourceTag is the tag that the source of a point is stored in. The
+	// host tag is accepted as an alias for source.
+	SourceTag string
+
+	// Now returns the time used for lines without a timestamp.
+	Now func() time.Time
+}
+
+// NewParser returns a new instance of Parser.
+func NewParser(sourceTag string) *Parser {
+	if sourceTag == "" {
+		sourceTag = DefaultSourceTag
+	}
+	return &Parser{
+		SourceTag: sourceTag,
+		Now:       time.Now,
+	}
+}
+
+// Parse parses a single line in the Wavefront data format into a point.
+func (p *Parser) Parse(line string) (models.Point, error) {
+	fields, err := splitFields(line)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 || fields[0] == "" {
+		return nil, errors.New("missing metric name")
+	} else if len(fields) < 2 {
+		return nil, ErrMissingValue
+	}
+	name := fields[0]
+
+	value, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid metric value %q", fields[1])
+	} else if math.IsNaN(value) || math.IsInf(value, 0) {
+		return nil, fmt.Errorf("unsupported metric value %q", fields[1])
+	}
+
+	// The timestamp is optional and is the only field without an equals sign.
+	fields = fields[2:]
+	var ts time.Time
+	if len(fields) > 0 && !strings.Contains(fields[0], "=") {
+		if ts, err = parseTimestamp(fields[0]); err != nil {
+			return nil, err
+		}
+		fields = fields[1:]
+	} else {
+		ts = p.Now().UTC()
+	}
+
+	tags := make(map[string]string, len(fields))
+	for _, field := range fields {
+		i := strings.IndexByte(field, '=')
+		if i <= 0 || i == len(field)-1 {
+			return nil, fmt.Errorf("invalid tag %q", field)
+		}
+
+		k, v := field[:i], unquote(field[i+1:])
+		if k == "source" || k == "host" {
+			k = p.SourceTag
+		}
+		tags[k] = v
+	}
+
+	return models.NewPoint(name, models.NewTags(tags), models.Fields{"value": value}, ts)
+}
+
+// parseTimestamp parses an epoch timestamp. The precision is determined by
+// the magnitude of the timestamp so seconds, milliseconds, microseconds and
+// nanoseconds are all accepted.
+func parseTimestamp(s string) (time.Time, error) {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return time.Time{}, fmt.Errorf("invalid timestamp %q", s)
+	}
+
+	switch {
+	case n < 1e11:
+		return time.Unix(n, 0).UTC(), nil
+	case n < 1e14:
+		return time.Unix(0, n*int64(time.Millisecond)).UTC(), nil
+	case n < 1e17:
+		return time.Unix(0, n*int64(time.Microsecond)).UTC(), nil
+	default:
+		return time.Unix(0, n).UTC(), nil
+	}
+}
+
+// splitFields splits a line on whitespace. Metric names and tag values may
+// be double quoted to include whitespace. Quotes around a metric name are
+// removed while quotes around tag values are left for the caller to remove.
+func splitFields(line string) ([]string, error) {
+	var fields []string
+	for i := 0; i < len(line); {
+		if line[i] == ' ' || line[i] == '\t' {
+			i++
+			continue
+		}
+
+		start := i
+		var quoted bool
+		for ; i < len(line); i++ {
+			c := line[i]
+			if c == '"' {
+				quoted = !quoted
+			} else if c == '\\' && quoted && i+1 < len(line) {
+				i++
+			} else if (c == ' ' || c == '\t') && !quoted {
+				break
+			}
+		}
+		if quoted {
+			return nil, ErrUnterminatedQuote
+		}
+
+		field := line[start:i]
+		if len(fields) == 0 {
+			field = unquote(field)
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// unquote removes surrounding double quotes and escaped quotes from s.
+func unquote(s string) string {
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return s
+	}
+	return strings.Replace(s[1:len(s)-1], `\"`, `"`, -1)
+}
@@ -0,0 +1,87 @@
+package wavefront_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lucaswiersma/influxdb/models"
+	"github.com/lucaswiersma/influxdb/services/wavefront"
+)
+
+func TestParser_Parse(t *testing.T) {
+	now := time.Date(2017, 6, 10, 0, 0, 0, 0, time.UTC)
+
+	for _, tt := range []struct {
+		line string
+		name string
+		tags map[string]string
+		v    float64
+		ts   time.Time
+		err  string
+	}{
+		{
+			line: `cpu.load.1m 0.72 1497052800 source=web01 dc=lga`,
+			name: "cpu.load.1m",
+			tags: map[string]string{"source": "web01", "dc": "lga"},
+			v:    0.72,
+			ts:   time.Unix(1497052800, 0),
+		},
+		{
+			line: `cpu.load.1m 1 host=web01`,
+			name: "cpu.load.1m",
+			tags: map[string]string{"source": "web01"},
+			v:    1,
+			ts:   now,
+		},
+		{
+			line: `"disk used" -2.5e3 1497052800123 source="web 01"  path="/var/\"log\""`,
+			name: "disk used",
+			tags: map[string]string{"source": "web 01", "path": `/var/"log"`},
+			v:    -2500,
+			ts:   time.Unix(1497052800, 123*int64(time.Millisecond)),
+		},
+		{
+			line: `requests 10 1497052800000000000`,
+			name: "requests",
+			tags: map[string]string{},
+			v:    10,
+			ts:   time.Unix(1497052800, 0),
+		},
+		{line: `cpu.load.1m`, err: "missing metric value"},
+		{line: `cpu.load.1m high source=web01`, err: `invalid metric value "high"`},
+		{line: `cpu.load.1m NaN source=web01`, err: `unsupported metric value "NaN"`},
+		{line: `cpu.load.1m 1 yesterday source=web01`, err: `invalid timestamp "yesterday"`},
+		{line: `cpu.load.1m 1 source=`, err: `invalid tag "source="`},
+		{line: `cpu.load.1m 1 source="web01`, err: "unterminated quote"},
+	} {
+		p := wavefront.NewParser("")
+		p.Now = func() time.Time { return now }
+
+		pt, err := p.Parse(tt.line)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("%s: unexpected error: got %v, exp %s", tt.line, err, tt.err)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.line, err)
+			continue
+		}
+
+		exp := models.MustNewPoint(tt.name, models.NewTags(tt.tags), models.Fields{"value": tt.v}, tt.ts)
+		if pt.String() != exp.String() {
+			t.Errorf("%s: unexpected point:\ngot %s\nexp %s", tt.line, pt, exp)
+		}
+	}
+}
+
+func TestParser_Parse_SourceTag(t *testing.T) {
+	p := wavefront.NewParser("host")
+	pt, err := p.Parse(`cpu.load.1m 1 1497052800 source=web01`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := pt.Tags().GetString("host"); got != "web01" {
+		t.Fatalf("unexpected host tag: %q", got)
+	}
+}
@@ -0,0 +1,374 @@
+// Package wavefront provides a service for InfluxDB to ingest data in the Wavefront data format.
+package wavefront // import "github.com/lucaswiersma/influxdb/services/wavefront"
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lucaswiersma/influxdb/models"
+	"github.com/lucaswiersma/influxdb/services/meta"
+	"github.com/lucaswiersma/influxdb/tsdb"
+	"go.uber.org/zap"
+)
+
+// statistics gathered by the wavefront package.
+const (
+	statLinesReceived       = "linesRx"
+	statBytesReceived       = "bytesRx"
+	statLinesParsed         = "linesParsed"
+	statLinesRejected       = "linesRejected"
+	statHTTPRequests        = "httpReqs"
+	statBatchesTransmitted  = "batchesTx"
+	statPointsTransmitted   = "pointsTx"
+	statBatchesTransmitFail = "batchesTxFail"
+	statConnectionsActive   = "connsActive"
+	statConnectionsHandled  = "connsHandled"
+)
+
+// Service accepts lines in the Wavefront data format over TCP, one point per
+// line, and batches of lines over HTTP on the same port.
+type Service struct {
+	ln     net.Listener  // main listener
+	httpln *chanListener // http channel-based listener
+
+	wg sync.WaitGroup
+
+	mu    sync.RWMutex
+	ready bool          // Has the required database been created?
+	done  chan struct{} // Is the service closing or closed?
+
+	BindAddress     string
+	Database        string
+	RetentionPolicy string
+
+	PointsWriter interface {
+		WritePoints(database, retentionPolicy string, consistencyLevel models.ConsistencyLevel, points []models.Point) error
+	}
+	MetaClient interface {
+		CreateDatabase(name string) (*meta.DatabaseInfo, error)
+	}
+
+	parser *Parser
+
+	// Points received over TCP are batched.
+	batchSize    int
+	batchPending int
+	batchTimeout time.Duration
+	batcher      *tsdb.PointBatcher
+
+	LogPointErrors bool
+	Logger         zap.Logger
+
+	stats       *Statistics
+	defaultTags models.StatisticTags
+}
+
+// NewService returns a new instance of Service.
+func NewService(c Config) (*Service, error) {
+	// Use defaults where necessary.
+	d := c.WithDefaults()
+
+	s := &Service{
+		BindAddress:     d.BindAddress,
+		Database:        d.Database,
+		RetentionPolicy: d.RetentionPolicy,
+		parser:          NewParser(d.SourceTag),
+		batchSize:       d.BatchSize,
+		batchPending:    d.BatchPending,
+		batchTimeout:    time.Duration(d.BatchTimeout),
+		Logger:          zap.New(zap.NullEncoder()),
+		LogPointErrors:  d.LogPointErrors,
+		stats:           &Statistics{},
+		defaultTags:     models.StatisticTags{"bind": d.BindAddress},
+	}
+	return s, nil
+}
+
+// Open starts the service.
+func (s *Service) Open() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.closed() {
+		return nil // Already open.
+	}
+	s.done = make(chan struct{})
+
+	s.Logger.Info(fmt.Sprintf("Starting Wavefront service, batch size %d, batch timeout %s", s.batchSize, s.batchTimeout))
+
+	s.batcher = tsdb.NewPointBatcher(s.batchSize, s.batchPending, s.batchTimeout)
+	s.batcher.Start()
+
+	// Start processing batches.
+	s.wg.Add(1)
+	go func() { defer s.wg.Done(); s.processBatches(s.batcher) }()
+
+	// Open listener.
+	listener, err := net.Listen("tcp", s.BindAddress)
+	if err != nil {
+		return err
+	}
+	s.Logger.Info(fmt.Sprint("Listening on: ", listener.Addr().String()))
+	s.ln = listener
+	s.httpln = newChanListener(s.ln.Addr())
+
+	// Begin listening for connections.
+	s.wg.Add(2)
+	go func() { defer s.wg.Done(); s.serve() }()
+	go func() { defer s.wg.Done(); s.serveHTTP() }()
+
+	return nil
+}
+
+// Close closes the Wavefront service.
+func (s *Service) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed() {
+		return nil // Already closed.
+	}
+	close(s.done)
+
+	// Close the listeners.
+	if err := s.ln.Close(); err != nil {
+		return err
+	}
+	if err := s.httpln.Close(); err != nil {
+		return err
+	}
+
+	s.wg.Wait()
+	s.done = nil
+
+	if s.batcher != nil {
+		s.batcher.Stop()
+	}
+
+	return nil
+}
+
+// Closed returns true if the service is currently closed.
+func (s *Service) Closed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed()
+}
+
+func (s *Service) closed() bool {
+	select {
+	case <-s.done:
+		// Service is closing.
+		return true
+	default:
+		return s.done == nil
+	}
+}
+
+// createInternalStorage ensures that the required database has been created.
+func (s *Service) createInternalStorage() error {
+	s.mu.RLock()
+	ready := s.ready
+	s.mu.RUnlock()
+	if ready {
+		return nil
+	}
+
+	if _, err := s.MetaClient.CreateDatabase(s.Database); err != nil {
+		return err
+	}
+
+	// The service is now ready.
+	s.mu.Lock()
+	s.ready = true
+	s.mu.Unlock()
+	return nil
+}
+
+// WithLogger sets the logger for the service.
+func (s *Service) WithLogger(log zap.Logger) {
+	s.Logger = log.With(
+		zap.String("service", "wavefront"),
+		zap.String("addr", s.BindAddress),
+	)
+}
+
+// Statistics maintains statistics for the Wavefront service.
+type Statistics struct {
+	LinesReceived       int64
+	BytesReceived       int64
+	LinesParsed         int64
+	LinesRejected       int64
+	HTTPRequests        int64
+	BatchesTransmitted  int64
+	PointsTransmitted   int64
+	BatchesTransmitFail int64
+	ActiveConnections   int64
+	HandledConnections  int64
+}
+
+// Statistics returns statistics for periodic monitoring.
+func (s *Service) Statistics(tags map[string]string) []models.Statistic {
+	return []models.Statistic{{
+		Name: "wavefront",
+		Tags: s.defaultTags.Merge(tags),
+		Values: map[string]interface{}{
+			statLinesReceived:       atomic.LoadInt64(&s.stats.LinesReceived),
+			statBytesReceived:       atomic.LoadInt64(&s.stats.BytesReceived),
+			statLinesParsed:         atomic.LoadInt64(&s.stats.LinesParsed),
+			statLinesRejected:       atomic.LoadInt64(&s.stats.LinesRejected),
+			statHTTPRequests:        atomic.LoadInt64(&s.stats.HTTPRequests),
+			statBatchesTransmitted:  atomic.LoadInt64(&s.stats.BatchesTransmitted),
+			statPointsTransmitted:   atomic.LoadInt64(&s.stats.PointsTransmitted),
+			statBatchesTransmitFail: atomic.LoadInt64(&s.stats.BatchesTransmitFail),
+			statConnectionsActive:   atomic.LoadInt64(&s.stats.ActiveConnections),
+			statConnectionsHandled:  atomic.LoadInt64(&s.stats.HandledConnections),
+		},
+	}}
+}
+
+// Addr returns the listener's address. Returns nil if listener is closed.
+func (s *Service) Addr() net.Addr {
+	if s.ln == nil {
+		return nil
+	}
+	return s.ln.Addr()
+}
+
+// serve serves the handler from the listener.
+func (s *Service) serve() {
+	for {
+		// Wait for next connection.
+		conn, err := s.ln.Accept()
+		if opErr, ok := err.(*net.OpError); ok && !opErr.Temporary() {
+			s.Logger.Info("Wavefront TCP listener closed")
+			return
+		} else if err != nil {
+			s.Logger.Info(fmt.Sprint("error accepting Wavefront connection: ", err.Error()))
+			continue
+		}
+
+		// Handle connection in separate goroutine.
+		go s.handleConn(conn)
+	}
+}
+
+// handleConn processes conn. This is run in a separate goroutine.
+func (s *Service) handleConn(conn net.Conn) {
+	defer atomic.AddInt64(&s.stats.ActiveConnections, -1)
+	atomic.AddInt64(&s.stats.ActiveConnections, 1)
+	atomic.AddInt64(&s.stats.HandledConnections, 1)
+
+	// Read header into buffer to check if it's HTTP.
+	var buf bytes.Buffer
+	r := bufio.NewReader(io.TeeReader(conn, &buf))
+
+	// Attempt to parse connection as HTTP.
+	_, err := http.ReadRequest(r)
+
+	// Rebuild connection from buffer and remaining connection data.
+	bufr := bufio.NewReader(io.MultiReader(&buf, conn))
+	conn = &readerConn{Conn: conn, r: bufr}
+
+	// If no HTTP parsing error occurred then process as HTTP.
+	if err == nil {
+		atomic.AddInt64(&s.stats.HTTPRequests, 1)
+		s.httpln.ch <- conn
+		return
+	}
+
+	// Otherwise handle as a stream of lines.
+	s.wg.Add(1)
+	s.handleTCPConn(conn)
+	s.wg.Done()
+}
+
+// handleTCPConn reads one point per line from conn, such as:
+//   cpu.load.1m 0.72 1497052800 source=web01 dc=lga
+func (s *Service) handleTCPConn(conn net.Conn) {
+	defer conn.Close()
+
+	remoteAddr := conn.RemoteAddr().String()
+
+	reader := bufio.NewReader(conn)
+	for {
+		buf, err := reader.ReadBytes('\n')
+		if len(buf) > 0 {
+			atomic.AddInt64(&s.stats.BytesReceived, int64(len(buf)))
+			s.handleLine(strings.TrimSpace(string(buf)), remoteAddr)
+		}
+		if err != nil {
+			if err != io.EOF {
+				s.Logger.Info(fmt.Sprint("error reading from Wavefront connection ", err.Error()))
+			}
+			return
+		}
+	}
+}
+
+// handleLine parses a single line and queues the point for writing.
+func (s *Service) handleLine(line, remoteAddr string) {
+	if line == "" {
+		return
+	}
+	atomic.AddInt64(&s.stats.LinesReceived, 1)
+
+	pt, err := s.parser.Parse(line)
+	if err != nil {
+		atomic.AddInt64(&s.stats.LinesRejected, 1)
+		if s.LogPointErrors {
+			s.Logger.Info(fmt.Sprintf("unable to parse line '%s' from %s: %s", line, remoteAddr, err))
+		}
+		return
+	}
+	atomic.AddInt64(&s.stats.LinesParsed, 1)
+
+	s.batcher.In() <- pt
+}
+
+// serveHTTP handles connections in HTTP format.
+func (s *Service) serveHTTP() {
+	handler := &Handler{
+		Database:        s.Database,
+		RetentionPolicy: s.RetentionPolicy,
+		PointsWriter:    s.PointsWriter,
+		Parser:          s.parser,
+		LogPointErrors:  s.LogPointErrors,
+		Logger:          s.Logger,
+		stats:           s.stats,
+	}
+	srv := &http.Server{Handler: handler}
+	srv.Serve(s.httpln)
+}
+
+// processBatches continually drains the given batcher and writes the batches to the database.
+func (s *Service) processBatches(batcher *tsdb.PointBatcher) {
+	for {
+		select {
+		case <-s.done:
+			return
+		case batch := <-batcher.Out():
+			// Will attempt to create database if not yet created.
+			if err := s.createInternalStorage(); err != nil {
+				s.Logger.Info(fmt.Sprintf("Required database %s does not yet exist: %s", s.Database, err.Error()))
+				continue
+			}
+
+			if err := s.PointsWriter.WritePoints(s.Database, s.RetentionPolicy, models.ConsistencyLevelAny, batch); err == nil {
+				atomic.AddInt64(&s.stats.BatchesTransmitted, 1)
+				atomic.AddInt64(&s.stats.PointsTransmitted, int64(len(batch)))
+			} else {
+				s.Logger.Info(fmt.Sprintf("failed to write point batch to database %q: %s", s.Database, err))
+				atomic.AddInt64(&s.stats.BatchesTransmitFail, 1)
+			}
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package wavefront
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lucaswiersma/influxdb/internal"
+	"github.com/lucaswiersma/influxdb/models"
+	"github.com/lucaswiersma/influxdb/services/meta"
+	"go.uber.org/zap"
+)
+
+func Test_Service_OpenClose(t *testing.T) {
+	// Let the OS assign a random port since we are only opening and closing the service,
+	// not actually connecting to it.
+	service := NewTestService("db0", "127.0.0.1:0")
+
+	// Closing a closed service is fine.
+	if err := service.Service.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := service.Service.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Opening an already open service is fine.
+	if err := service.Service.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reopening a previously opened service is fine.
+	if err := service.Service.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := service.Service.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Tidy up.
+	if err := service.Service.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Ensure points can be written over TCP and malformed lines are counted.
+func TestService_TCP(t *testing.T) {
+	t.Parallel()
+
+	s := NewTestService("db0", "127.0.0.1:0")
+	if err := s.Service.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Service.Close()
+
+	// Mock points writer.
+	var called int32
+	s.WritePointsFn = func(database, retentionPolicy string, consistencyLevel models.ConsistencyLevel, points []models.Point) error {
+		atomic.StoreInt32(&called, 1)
+
+		if database != "db0" {
+			t.Errorf("unexpected database: %s", database)
+		} else if retentionPolicy != "" {
+			t.Errorf("unexpected retention policy: %s", retentionPolicy)
+		} else if len(points) != 1 || points[0].String() != `cpu.load.1m,dc=lga,source=web01 value=0.72 1497052800000000000` {
+			t.Errorf("unexpected points: %v", points)
+		}
+		return nil
+	}
+
+	// Open connection to the service.
+	conn, err := net.Dial("tcp", s.Service.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// Write lines and close.
+	if _, err := conn.Write([]byte("cpu.load.1m 0.72 1497052800 source=web01 dc=lga\ncpu.load.1m high\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tick := time.Tick(10 * time.Millisecond)
+	timeout := time.After(10 * time.Second)
+
+	for {
+		select {
+		case <-tick:
+			// Verify that the writer was called.
+			if atomic.LoadInt32(&called) > 0 {
+				if got := atomic.LoadInt64(&s.Service.stats.LinesParsed); got != 1 {
+					t.Fatalf("unexpected lines parsed: %d", got)
+				} else if got := atomic.LoadInt64(&s.Service.stats.LinesRejected); got != 1 {
+					t.Fatalf("unexpected lines rejected: %d", got)
+				}
+				return
+			}
+		case <-timeout:
+			t.Fatal("points writer not called")
+		}
+	}
+}
+
+// Ensure a batch of points can be written over HTTP.
+func TestService_HTTP(t *testing.T) {
+	t.Parallel()
+
+	s := NewTestService("db0", "127.0.0.1:0")
+	if err := s.Service.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Service.Close()
+
+	// Mock points writer.
+	var written int
+	s.WritePointsFn = func(database, retentionPolicy string, consistencyLevel models.ConsistencyLevel, points []models.Point) error {
+		written += len(points)
+		return nil
+	}
+
+	body := "cpu.load.1m 0.72 1497052800 source=web01\ncpu.load.1m 0.64 1497052810 source=web01\n"
+	resp, err := http.Post("http://"+s.Service.Addr().String()+"/report", "text/plain", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("unexpected status code: %d", resp.StatusCode)
+	} else if written != 2 {
+		t.Fatalf("unexpected points written: %d", written)
+	}
+
+	// Valid lines are written even when others are rejected.
+	resp, err = http.Post("http://"+s.Service.Addr().String()+"/report", "text/plain", strings.NewReader(body+"cpu.load.1m\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("unexpected status code: %d", resp.StatusCode)
+	} else if written != 4 {
+		t.Fatalf("unexpected points written: %d", written)
+	}
+}
+
+type TestService struct {
+	Service       *Service
+	MetaClient    *internal.MetaClientMock
+	WritePointsFn func(database, retentionPolicy string, consistencyLevel models.ConsistencyLevel, points []models.Point) error
+}
+
+// NewTestService returns a new instance of Service.
+func NewTestService(database string, bind string) *TestService {
+	s, err := NewService(Config{
+		BindAddress: bind,
+		Database:    database,
+	})
+
+	if err != nil {
+		panic(err)
+	}
+
+	service := &TestService{
+		Service:    s,
+		MetaClient: &internal.MetaClientMock{},
+	}
+
+	service.MetaClient.CreateDatabaseFn = func(db string) (*meta.DatabaseInfo, error) {
+		if got, exp := db, database; got != exp {
+			return nil, fmt.Errorf("got %v, expected %v", got, exp)
+		}
+		return nil, nil
+	}
+
+	if testing.Verbose() {
+		service.Service.WithLogger(zap.New(
+			zap.NewTextEncoder(),
+			zap.Output(os.Stderr),
+		))
+	}
+
+	service.Service.MetaClient = service.MetaClient
+	service.Service.PointsWriter = service
+	return service
+}
+
+func (s *TestService) WritePoints(database, retentionPolicy string, consistencyLevel models.ConsistencyLevel, points []models.Point) error {
+	return s.WritePointsFn(database, retentionPolicy, consistencyLevel, points)
+}
@@ -13,6 +13,7 @@ import (
 
 	"github.com/lucaswiersma/influxdb/coordinator"
 	"github.com/lucaswiersma/influxdb/models"
+	"github.com/lucaswiersma/influxdb/toml"
 )
 
 // Global server used by benchmarks
@@ -4661,6 +4662,135 @@ func TestServer_Query_Aggregates_IdenticalTime(t *testing.T) {
 	}
 }
 
+// Ensure materialized query results are read back and kept out of the database
+// they are computed from.
+func TestServer_Query_ReadRollups(t *testing.T) {
+	t.Parallel()
+	c := NewConfig()
+	c.Coordinator.ReadRollupsEnabled = true
+	c.Coordinator.ReadRollupMinRange = toml.Duration(time.Hour)
+	s := OpenServer(c)
+	defer s.Close()
+
+	if err := s.CreateDatabaseAndRetentionPolicy("db0", newRetentionPolicySpec("rp0", 1, 0), true); err != nil {
+		t.Fatal(err)
+	}
+
+	writes := []string{
+		fmt.Sprintf(`cpu value=1 %d`, mustParseTime(time.RFC3339Nano, "2000-01-01T00:00:00Z").UnixNano()),
+		fmt.Sprintf(`cpu value=3 %d`, mustParseTime(time.RFC3339Nano, "2000-01-01T00:30:00Z").UnixNano()),
+		fmt.Sprintf(`cpu value=5 %d`, mustParseTime(time.RFC3339Nano, "2000-01-01T01:00:00Z").UnixNano()),
+	}
+
+	test := NewTest("db0", "rp0")
+	test.writes = Writes{
+		&Write{data: strings.Join(writes, "\n")},
+	}
+
+	test.addQueries([]*Query{
+		&Query{
+			name:    "materialize the result",
+			params:  url.Values{"db": []string{"db0"}},
+			command: `SELECT mean(value) FROM cpu WHERE time >= '2000-01-01T00:00:00Z' AND time < '2000-01-01T02:00:00Z' GROUP BY time(1h)`,
+			exp:     `{"results":[{"statement_id":0,"series":[{"name":"cpu","columns":["time","mean"],"values":[["2000-01-01T00:00:00Z",2],["2000-01-01T01:00:00Z",5]]}]}]}`,
+		},
+		&Query{
+			name:    "read the result from the rollup",
+			params:  url.Values{"db": []string{"db0"}},
+			command: `SELECT mean(value) FROM cpu WHERE time >= '2000-01-01T00:00:00Z' AND time < '2000-01-01T02:00:00Z' GROUP BY time(1h)`,
+			exp:     `{"results":[{"statement_id":0,"series":[{"name":"cpu","columns":["time","mean"],"values":[["2000-01-01T00:00:00Z",2],["2000-01-01T01:00:00Z",5]]}]}]}`,
+		},
+		&Query{
+			name:    "the rollup is not a measurement of the source database",
+			params:  url.Values{"db": []string{"db0"}},
+			command: `SHOW MEASUREMENTS`,
+			exp:     `{"results":[{"statement_id":0,"series":[{"name":"measurements","columns":["name"],"values":[["cpu"]]}]}]}`,
+		},
+	}...)
+
+	for i, query := range test.queries {
+		if i == 0 {
+			if err := test.init(s); err != nil {
+				t.Fatalf("test init failed: %s", err)
+			}
+		}
+		if err := query.Execute(s); err != nil {
+			t.Error(query.Error(err))
+		} else if !query.success() {
+			t.Error(query.failureMessage())
+		}
+	}
+
+	if results, err := s.QueryWithParams(`SHOW MEASUREMENTS`, url.Values{"db": []string{coordinator.ReadRollupDatabase}}); err != nil {
+		t.Fatal(err)
+	} else if !strings.Contains(results, `"_rollup_`) {
+		t.Fatalf("expected a rollup in the rollup database: %s", results)
+	}
+}
+
+// Ensure GROUP BY time() windows follow the timezone of a tz() clause across
+// daylight saving time and results are rendered in it.
+func TestServer_Query_GroupByTime_Timezone(t *testing.T) {
+	t.Parallel()
+	s := OpenServer(NewConfig())
+	defer s.Close()
+
+	if err := s.CreateDatabaseAndRetentionPolicy("db0", newRetentionPolicySpec("rp0", 1, 0), true); err != nil {
+		t.Fatal(err)
+	}
+
+	writes := []string{
+		fmt.Sprintf(`cpu value=1 %d`, mustParseTime(time.RFC3339Nano, "2017-03-11T12:00:00Z").UnixNano()),
+		fmt.Sprintf(`cpu value=2 %d`, mustParseTime(time.RFC3339Nano, "2017-03-12T04:30:00Z").UnixNano()),
+		fmt.Sprintf(`cpu value=3 %d`, mustParseTime(time.RFC3339Nano, "2017-03-12T05:30:00Z").UnixNano()),
+		fmt.Sprintf(`cpu value=4 %d`, mustParseTime(time.RFC3339Nano, "2017-03-13T03:30:00Z").UnixNano()),
+		fmt.Sprintf(`cpu value=5 %d`, mustParseTime(time.RFC3339Nano, "2017-03-13T04:30:00Z").UnixNano()),
+	}
+
+	test := NewTest("db0", "rp0")
+	test.writes = Writes{
+		&Write{data: strings.Join(writes, "\n")},
+	}
+
+	test.addQueries([]*Query{
+		&Query{
+			name:    "daily windows across the start of daylight saving time",
+			params:  url.Values{"db": []string{"db0"}},
+			command: `SELECT sum(value) FROM cpu WHERE time >= '2017-03-11T05:00:00Z' AND time < '2017-03-14T04:00:00Z' GROUP BY time(1d) tz('America/New_York')`,
+			exp:     `{"results":[{"statement_id":0,"series":[{"name":"cpu","columns":["time","sum"],"values":[["2017-03-11T00:00:00-05:00",3],["2017-03-12T00:00:00-05:00",7],["2017-03-13T00:00:00-04:00",5]]}]}]}`,
+		},
+		&Query{
+			name:    "filled daily windows across the start of daylight saving time",
+			params:  url.Values{"db": []string{"db0"}},
+			command: `SELECT sum(value) FROM cpu WHERE value < 3 AND time >= '2017-03-11T05:00:00Z' AND time < '2017-03-15T04:00:00Z' GROUP BY time(1d) fill(0) tz('America/New_York')`,
+			exp:     `{"results":[{"statement_id":0,"series":[{"name":"cpu","columns":["time","sum"],"values":[["2017-03-11T00:00:00-05:00",3],["2017-03-12T00:00:00-05:00",0],["2017-03-13T00:00:00-04:00",0],["2017-03-14T00:00:00-04:00",0]]}]}]}`,
+		},
+		&Query{
+			name:    "timezone parameter takes precedence over tz()",
+			params:  url.Values{"db": []string{"db0"}, "timezone": []string{"UTC"}},
+			command: `SELECT sum(value) FROM cpu WHERE time >= '2017-03-11T05:00:00Z' AND time < '2017-03-14T04:00:00Z' GROUP BY time(1d) tz('America/New_York')`,
+			exp:     `{"results":[{"statement_id":0,"series":[{"name":"cpu","columns":["time","sum"],"values":[["2017-03-11T05:00:00Z",3],["2017-03-12T05:00:00Z",7],["2017-03-13T04:00:00Z",5]]}]}]}`,
+		},
+	}...)
+
+	for i, query := range test.queries {
+		if i == 0 {
+			if err := test.init(s); err != nil {
+				t.Fatalf("test init failed: %s", err)
+			}
+		}
+		if query.skip {
+			t.Logf("SKIP:: %s", query.name)
+			continue
+		}
+		if err := query.Execute(s); err != nil {
+			t.Error(query.Error(err))
+		} else if !query.success() {
+			t.Error(query.failureMessage())
+		}
+	}
+}
+
 // This will test that when using a group by, that it observes the time you asked for
 // but will only put the values in the bucket that match the time range
 func TestServer_Query_GroupByTimeCutoffs(t *testing.T) {
@@ -6868,7 +6998,7 @@ func TestServer_ContinuousQuery(t *testing.T) {
 		&Query{
 			name:    `show continuous queries`,
 			command: `SHOW CONTINUOUS QUERIES`,
-			exp:     `{"results":[{"statement_id":0,"series":[{"name":"db0","columns":["name","query"],"values":[["cq1","CREATE CONTINUOUS QUERY cq1 ON db0 BEGIN SELECT count(value) INTO db0.rp1.:MEASUREMENT FROM db0.rp0./[cg]pu/ GROUP BY time(5s) END"],["cq2","CREATE CONTINUOUS QUERY cq2 ON db0 BEGIN SELECT count(value) INTO db0.rp2.:MEASUREMENT FROM db0.rp0./[cg]pu/ GROUP BY time(5s), * END"]]}]}]}`,
+			exp:     `{"results":[{"statement_id":0,"series":[{"name":"db0","columns":["name","query","last_run"],"values":[["cq1","CREATE CONTINUOUS QUERY cq1 ON db0 BEGIN SELECT count(value) INTO db0.rp1.:MEASUREMENT FROM db0.rp0./[cg]pu/ GROUP BY time(5s) END",null],["cq2","CREATE CONTINUOUS QUERY cq2 ON db0 BEGIN SELECT count(value) INTO db0.rp2.:MEASUREMENT FROM db0.rp0./[cg]pu/ GROUP BY time(5s), * END",null]]}]}]}`,
 		},
 	}...)
 
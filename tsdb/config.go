@@ -30,6 +30,18 @@ const (
 	// the shard hasn't received writes or deletes
 	DefaultCacheSnapshotWriteColdDuration = time.Duration(10 * time.Minute)
 
+	// DefaultCacheEvictionPolicy is the default policy for relieving memory
+	// pressure in the cache before it reaches its maximum size.
+	DefaultCacheEvictionPolicy = CacheEvictionNone
+
+	// DefaultCacheEvictionThreshold is the fraction of the cache's maximum
+	// size at which the least recently written series start being evicted.
+	DefaultCacheEvictionThreshold = 0.8
+
+	// DefaultCacheEvictionTarget is the fraction of the cache's maximum size
+	// that eviction reduces the cache to.
+	DefaultCacheEvictionTarget = 0.6
+
 	// DefaultCompactFullWriteColdDuration is the duration at which the engine
 	// will compact all TSM files in a shard if it hasn't received a write or delete
 	DefaultCompactFullWriteColdDuration = time.Duration(4 * time.Hour)
@@ -43,6 +55,180 @@ const (
 
 	// DefaultMaxValuesPerTag is the maximum number of values a tag can have within a measurement.
 	DefaultMaxValuesPerTag = 100000
+
+	// DefaultDuplicatePointPolicy is the default policy applied to points within
+	// a single batch that share a series and timestamp but carry different values.
+	DefaultDuplicatePointPolicy = DuplicatePointLast
+
+	// DefaultCompactionMode is the default way compactions write TSM blocks.
+	DefaultCompactionMode = CompactionModeDefault
+
+	// DefaultTSMIndexLoad is the default strategy for accessing TSM file indexes.
+	DefaultTSMIndexLoad = TSMIndexLoadMmap
+
+	// DefaultMaxFieldValueSize is the largest string field value, in bytes,
+	// written without special handling. 0 disables the check.
+	DefaultMaxFieldValueSize = 0
+
+	// DefaultOversizedFieldPolicy is the default policy for string field values
+	// larger than the max-field-value-size.
+	DefaultOversizedFieldPolicy = OversizedFieldReject
+
+	// DefaultMaxTagValueLength is the longest tag value, in bytes, written
+	// without special handling. 0 disables the check.
+	DefaultMaxTagValueLength = 0
+
+	// DefaultLongTagValuePolicy is the default policy for tag values longer
+	// than the max-tag-value-length.
+	DefaultLongTagValuePolicy = LongTagValueReject
+
+	// DefaultDeleteCompactionThreshold is the number of series keys a delete
+	// must remove from a shard to compact it immediately. 0 disables it.
+	DefaultDeleteCompactionThreshold = 0
+
+	// DefaultCompactionBackoffQueries is the number of running queries at
+	// which compactions back off. 0 disables it.
+	DefaultCompactionBackoffQueries = 0
+
+	// DefaultCompactionResumeQueries is the number of running queries at or
+	// below which backed off compactions resume.
+	DefaultCompactionResumeQueries = 0
+
+	// DefaultCompactionMaxBackoff is the longest compactions back off before
+	// they resume regardless of the query load.
+	DefaultCompactionMaxBackoff = 10 * time.Minute
+
+	// DefaultSeriesEvictionPeriod is how long a series must go without writes
+	// before it is evicted, when series eviction is enabled.
+	DefaultSeriesEvictionPeriod = 30 * 24 * time.Hour
+
+	// DefaultSeriesEvictionCheckInterval is how often databases are checked
+	// for stale series, when series eviction is enabled.
+	DefaultSeriesEvictionCheckInterval = time.Hour
+
+	// DefaultCompactionRetainDuration is how long TSM files replaced by a
+	// compaction are kept for debugging. 0 removes them right away.
+	DefaultCompactionRetainDuration = 0
+
+	// DefaultCompactionRetainMaxSize is the most bytes of replaced TSM files
+	// each shard keeps for debugging.
+	DefaultCompactionRetainMaxSize = 1024 * 1024 * 1024 // 1GB
+
+	// DefaultWriteHotspotSampleRate is the fraction of written points
+	// sampled to find write hotspots. 0 disables hotspot tracking.
+	DefaultWriteHotspotSampleRate = 0
+
+	// DefaultWriteHotspotSeriesN is the number of highest-write-rate series
+	// reported as write hotspots.
+	DefaultWriteHotspotSeriesN = 10
+
+	// DefaultWriteHotspotInterval is the window over which series write
+	// rates are measured.
+	DefaultWriteHotspotInterval = time.Minute
+
+	// DefaultWALFailurePolicy is the default policy for shards whose WAL
+	// could not be written.
+	DefaultWALFailurePolicy = WALFailureReadOnly
+
+	// DefaultWALRecoveryCheckInterval is how often a read-only shard checks
+	// whether its WAL can be written again.
+	DefaultWALRecoveryCheckInterval = 10 * time.Second
+)
+
+// Policies for handling writes that fail to be written to the WAL.
+const (
+	// WALFailureError returns the failed write to the client and keeps
+	// accepting writes to the shard.
+	WALFailureError = "error"
+
+	// WALFailureReadOnly additionally stops writes to the shard until its
+	// WAL directory can be written again. The shard can still be queried.
+	WALFailureReadOnly = "read-only"
+)
+
+// Policies for relieving memory pressure in the cache.
+const (
+	// CacheEvictionNone only snapshots the whole cache, once it reaches
+	// cache-snapshot-memory-size or stops receiving writes.
+	CacheEvictionNone = "none"
+
+	// CacheEvictionLRW additionally snapshots the least recently written
+	// series once the cache passes cache-eviction-threshold of its maximum
+	// size, so memory is released gradually instead of all at once.
+	CacheEvictionLRW = "lrw"
+)
+
+// Strategies for accessing the index of a TSM file.
+const (
+	// TSMIndexLoadMmap reads the index through the mmap of the file, letting
+	// the OS page it in and out as needed.
+	TSMIndexLoadMmap = "mmap"
+
+	// TSMIndexLoadMemory copies the whole index onto the heap when the file
+	// is opened so lookups never fault.
+	TSMIndexLoadMemory = "memory"
+)
+
+// Modes controlling whether compactions merge or rewrite TSM blocks.
+//
+// There is no per retention policy encoder effort. The TSM block encoders have
+// no effort setting: each picks the most compact of its encodings for every
+// block, and snappy has no compression levels. How full the blocks are is the
+// only trade between CPU and storage, so that is what the modes control.
+const (
+	// CompactionModeFast favors compaction speed. Compactions merge existing
+	// blocks as-is without re-encoding them into full blocks.
+	CompactionModeFast = "fast"
+
+	// CompactionModeDefault merges blocks as-is during lower level and optimize
+	// compactions and rewrites them during full compactions.
+	CompactionModeDefault = "default"
+
+	// CompactionModeRewrite favors storage size. Every compaction decodes and
+	// re-encodes blocks so they are as full as possible.
+	CompactionModeRewrite = "rewrite"
+)
+
+// Policies for handling string field values larger than max-field-value-size.
+const (
+	// OversizedFieldReject drops points with an oversized value and returns
+	// a partial write error.
+	OversizedFieldReject = "reject"
+
+	// OversizedFieldIsolate accepts oversized values and splits TSM string
+	// blocks by size so each one is written in a block of its own, instead of
+	// inflating the blocks holding the values around it. The value itself is
+	// never split, so its block is still as large as the value.
+	OversizedFieldIsolate = "isolate"
+)
+
+// Policies for handling tag values longer than max-tag-value-length.
+const (
+	// LongTagValueReject drops points with a long tag value and returns a
+	// partial write error.
+	LongTagValueReject = "reject"
+
+	// LongTagValueTruncate shortens long tag values to the limit and flags
+	// the point with the TruncatedTagKey tag.
+	LongTagValueTruncate = "truncate"
+)
+
+// Policies for handling points in the same batch that collide on series and time.
+const (
+	// DuplicatePointLast keeps the last point written, matching the historical
+	// last-write-wins behavior.
+	DuplicatePointLast = "last"
+
+	// DuplicatePointFirst keeps the first point written and drops later ones.
+	DuplicatePointFirst = "first"
+
+	// DuplicatePointReject keeps the first point written, drops the later
+	// colliding points and returns a partial write error naming them.
+	DuplicatePointReject = "reject"
+
+	// DuplicatePointSequence keeps every colliding point by adding a sequence
+	// tag to all but the first, so each lands in its own series.
+	DuplicatePointSequence = "sequence"
 )
 
 // Config holds the configuration for the tsbd package.
@@ -58,6 +244,12 @@ type Config struct {
 	// disks or when WAL write contention is seen.  A value of 0 fsyncs every write to the WAL.
 	WALFsyncDelay toml.Duration `toml:"wal-fsync-delay"`
 
+	// WALFailurePolicy controls what happens to a shard when a write to its WAL
+	// fails. Valid values are "error" and "read-only". A read-only shard checks
+	// every WALRecoveryCheckInterval whether its WAL can be written again.
+	WALFailurePolicy         string        `toml:"wal-failure-policy"`
+	WALRecoveryCheckInterval toml.Duration `toml:"wal-recovery-check-interval"`
+
 	// Query logging
 	QueryLogEnabled bool `toml:"query-log-enabled"`
 
@@ -67,6 +259,47 @@ type Config struct {
 	CacheSnapshotWriteColdDuration toml.Duration `toml:"cache-snapshot-write-cold-duration"`
 	CompactFullWriteColdDuration   toml.Duration `toml:"compact-full-write-cold-duration"`
 
+	// CacheEvictionPolicy controls whether the least recently written series
+	// are snapshotted early when the cache approaches cache-max-memory-size.
+	// Eviction starts at CacheEvictionThreshold and stops at
+	// CacheEvictionTarget, both fractions of cache-max-memory-size.
+	CacheEvictionPolicy    string  `toml:"cache-eviction-policy"`
+	CacheEvictionThreshold float64 `toml:"cache-eviction-threshold"`
+	CacheEvictionTarget    float64 `toml:"cache-eviction-target"`
+
+	// DeleteCompactionThreshold is the number of series keys a single DELETE
+	// or DROP SERIES must remove from a shard's TSM files to schedule a full
+	// compaction of the shard right away, rewriting the files without the
+	// deleted data to reclaim its space. A value of 0 leaves deleted data on
+	// disk until the normal compactions rewrite it.
+	DeleteCompactionThreshold int `toml:"delete-compaction-threshold"`
+
+	// CompactionBackoffQueries is the number of queries running on the node
+	// at which level 2 and 3, full and delete compactions back off so they
+	// don't compete with the queries for disk and CPU. They resume once the
+	// number of running queries drops to CompactionResumeQueries or they
+	// have backed off for CompactionMaxBackoff. Cache snapshots and level 1
+	// compactions always run. A value of 0 disables it.
+	CompactionBackoffQueries int           `toml:"compaction-backoff-queries"`
+	CompactionResumeQueries  int           `toml:"compaction-resume-queries"`
+	CompactionMaxBackoff     toml.Duration `toml:"compaction-max-backoff"`
+
+	// CompactionRetainDuration is how long the TSM files replaced by a
+	// compaction are kept in the shard's retained directory instead of being
+	// removed, so they can be recovered if a compaction is suspected of
+	// losing data. Each shard keeps at most CompactionRetainMaxSize bytes of
+	// replaced files, removing the oldest first. A value of 0 removes
+	// replaced files right away.
+	CompactionRetainDuration toml.Duration `toml:"compaction-retain-duration"`
+	CompactionRetainMaxSize  uint64        `toml:"compaction-retain-max-size"`
+
+	// CompactionMeasurementStats reports the blocks and bytes of each
+	// measurement rewritten by the compactions of a shard. A measurement
+	// that dominates the compactions of its shards can be moved to shard
+	// groups of its own with ISOLATE MEASUREMENTS so it is compacted
+	// separately from the other measurements.
+	CompactionMeasurementStats bool `toml:"compaction-measurement-stats"`
+
 	// Limits
 
 	// MaxSeriesPerDatabase is the maximum number of series a node can hold per database.
@@ -74,11 +307,116 @@ type Config struct {
 	// A value of 0 disables the limit.
 	MaxSeriesPerDatabase int `toml:"max-series-per-database"`
 
+	// MaxSeriesPerRetentionPolicy limits the number of series held by the shards
+	// of individual retention policies. Keys are of the form
+	// "database.retention_policy". A value of 0 disables the limit.
+	MaxSeriesPerRetentionPolicy map[string]int `toml:"max-series-per-retention-policy"`
+
 	// MaxValuesPerTag is the maximum number of tag values a single tag key can have within
 	// a measurement.  When the limit is execeeded, writes return an error.
 	// A value of 0 disables the limit.
 	MaxValuesPerTag int `toml:"max-values-per-tag"`
 
+	// DuplicatePointPolicy controls how points within a single write that share
+	// a series and timestamp but carry different field values are handled.
+	// Valid values are "last", "first", "reject" and "sequence".
+	DuplicatePointPolicy string `toml:"duplicate-point-policy"`
+
+	// MaxFieldValueSize is the largest string field value, in bytes, that is
+	// written without special handling. Larger values are handled according
+	// to OversizedFieldPolicy. A value of 0 disables the check.
+	MaxFieldValueSize int `toml:"max-field-value-size"`
+
+	// OversizedFieldPolicy controls how values larger than MaxFieldValueSize
+	// are handled. Valid values are "reject" and "isolate".
+	OversizedFieldPolicy string `toml:"oversized-field-policy"`
+
+	// MaxTagValueLength is the longest tag value, in bytes, that is written
+	// without special handling. Longer values are handled according to
+	// LongTagValuePolicy. A value of 0 disables the check.
+	MaxTagValueLength int `toml:"max-tag-value-length"`
+
+	// LongTagValuePolicy controls how tag values longer than
+	// MaxTagValueLength are handled. Valid values are "reject" and "truncate".
+	LongTagValuePolicy string `toml:"long-tag-value-policy"`
+
+	// DatabaseMaxTagValueLength and DatabaseLongTagValuePolicy override
+	// MaxTagValueLength and LongTagValuePolicy for individual databases.
+	DatabaseMaxTagValueLength  map[string]int    `toml:"database-max-tag-value-length"`
+	DatabaseLongTagValuePolicy map[string]string `toml:"database-long-tag-value-policy"`
+
+	// CompactionMode controls whether compactions merge existing TSM blocks or
+	// rewrite them when no retention policy specific mode is configured.
+	// Valid values are "fast", "default" and "rewrite".
+	CompactionMode string `toml:"compaction-mode"`
+
+	// RetentionPolicyCompactionModes overrides CompactionMode for individual
+	// retention policies. Keys are of the form "database.retention_policy".
+	RetentionPolicyCompactionModes map[string]string `toml:"retention-policy-compaction-modes"`
+
+	// StringDictionaryMeasurements lists the measurements whose string fields
+	// are dictionary encoded in TSM files. Dictionary encoding stores each
+	// distinct value of a block once, which suits low cardinality strings.
+	StringDictionaryMeasurements []string `toml:"string-dictionary-measurements"`
+
+	// MonotonicMeasurements lists the measurements whose points must be
+	// written in timestamp order. A point older than the newest point of its
+	// series in the shard is dropped with a partial write error. Ordering is
+	// only checked per shard: a point that falls in an older shard group is
+	// accepted even if newer shard groups hold later points of its series.
+	MonotonicMeasurements []string `toml:"monotonic-measurements"`
+
+	// ShardQuarantineDuration is how long a dropped shard is kept on disk so it
+	// can be restored with UNDROP SHARD. A value of 0 deletes shards immediately.
+	// Only DROP SHARD quarantines shards: DROP DATABASE and DROP RETENTION
+	// POLICY delete theirs, and a quarantined shard cannot be restored once its
+	// database, retention policy or shard group is gone.
+	ShardQuarantineDuration toml.Duration `toml:"shard-quarantine-duration"`
+
+	// SeriesEvictionEnabled drops series that have not been written to for
+	// SeriesEvictionPeriod from the index and deletes their data, checking
+	// every SeriesEvictionCheckInterval. Series loaded from disk when the
+	// store opens count as written at that time.
+	SeriesEvictionEnabled       bool          `toml:"series-eviction-enabled"`
+	SeriesEvictionPeriod        toml.Duration `toml:"series-eviction-period"`
+	SeriesEvictionCheckInterval toml.Duration `toml:"series-eviction-check-interval"`
+
+	// SeriesEvictionDatabases limits series eviction to the listed databases.
+	// All databases are checked when it is empty.
+	SeriesEvictionDatabases []string `toml:"series-eviction-databases"`
+
+	// WriteHotspotSampleRate is the fraction of written points, between 0
+	// and 1, sampled to estimate the write rate of each series. The
+	// WriteHotspotSeriesN series with the highest rates over each
+	// WriteHotspotInterval are reported by SHOW DIAGNOSTICS. A value of 0
+	// disables hotspot tracking.
+	WriteHotspotSampleRate float64       `toml:"write-hotspot-sample-rate"`
+	WriteHotspotSeriesN    int           `toml:"write-hotspot-series"`
+	WriteHotspotInterval   toml.Duration `toml:"write-hotspot-interval"`
+
+	// TSMIndexLoad controls how TSM file indexes are accessed. "mmap" bounds
+	// memory use on nodes with many shards while "memory" trades RAM for
+	// faster index lookups.
+	TSMIndexLoad string `toml:"tsm-index-load"`
+
+	// WarmOnPromotion reads the TSM file indexes of a shard into the page
+	// cache in the background when it receives a write after not being
+	// written to for CacheSnapshotWriteColdDuration, so the first queries
+	// after it becomes hot again, such as during a backfill, aren't slowed
+	// down by reading the indexes from disk.
+	WarmOnPromotion bool `toml:"warm-on-promotion"`
+
+	// TSMRecoverOnOpen moves TSM files that cannot be opened, or whose
+	// blocks fail their checksums, into the shard's corrupt directory when
+	// the shard is opened instead of failing to open the shard. Only the
+	// files of the newest generation, the ones being written when the
+	// server stopped, have their blocks verified.
+	TSMRecoverOnOpen bool `toml:"tsm-recover-on-open"`
+
+	// MaxConcurrentShardOpens is the maximum number of shards opened at once
+	// when the store starts. A value of 0 uses the number of available CPUs.
+	MaxConcurrentShardOpens int `toml:"max-concurrent-shard-opens"`
+
 	TraceLoggingEnabled bool `toml:"trace-logging-enabled"`
 }
 
@@ -89,14 +427,41 @@ func NewConfig() Config {
 
 		QueryLogEnabled: true,
 
+		WALFailurePolicy:         DefaultWALFailurePolicy,
+		WALRecoveryCheckInterval: toml.Duration(DefaultWALRecoveryCheckInterval),
+
 		CacheMaxMemorySize:             DefaultCacheMaxMemorySize,
 		CacheSnapshotMemorySize:        DefaultCacheSnapshotMemorySize,
 		CacheSnapshotWriteColdDuration: toml.Duration(DefaultCacheSnapshotWriteColdDuration),
 		CompactFullWriteColdDuration:   toml.Duration(DefaultCompactFullWriteColdDuration),
+		CacheEvictionPolicy:            DefaultCacheEvictionPolicy,
+		CacheEvictionThreshold:         DefaultCacheEvictionThreshold,
+		CacheEvictionTarget:            DefaultCacheEvictionTarget,
+		DeleteCompactionThreshold:      DefaultDeleteCompactionThreshold,
+		CompactionBackoffQueries:       DefaultCompactionBackoffQueries,
+		CompactionResumeQueries:        DefaultCompactionResumeQueries,
+		CompactionMaxBackoff:           toml.Duration(DefaultCompactionMaxBackoff),
+		CompactionRetainDuration:       toml.Duration(DefaultCompactionRetainDuration),
+		CompactionRetainMaxSize:        DefaultCompactionRetainMaxSize,
+
+		SeriesEvictionPeriod:        toml.Duration(DefaultSeriesEvictionPeriod),
+		SeriesEvictionCheckInterval: toml.Duration(DefaultSeriesEvictionCheckInterval),
+
+		WriteHotspotSampleRate: DefaultWriteHotspotSampleRate,
+		WriteHotspotSeriesN:    DefaultWriteHotspotSeriesN,
+		WriteHotspotInterval:   toml.Duration(DefaultWriteHotspotInterval),
 
 		MaxSeriesPerDatabase: DefaultMaxSeriesPerDatabase,
 		MaxValuesPerTag:      DefaultMaxValuesPerTag,
 
+		DuplicatePointPolicy: DefaultDuplicatePointPolicy,
+		MaxFieldValueSize:    DefaultMaxFieldValueSize,
+		OversizedFieldPolicy: DefaultOversizedFieldPolicy,
+		MaxTagValueLength:    DefaultMaxTagValueLength,
+		LongTagValuePolicy:   DefaultLongTagValuePolicy,
+		CompactionMode:       DefaultCompactionMode,
+		TSMIndexLoad:         DefaultTSMIndexLoad,
+
 		TraceLoggingEnabled: false,
 	}
 }
@@ -120,20 +485,221 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("unrecognized engine %s", c.Engine)
 	}
 
+	switch c.WALFailurePolicy {
+	case "", WALFailureError:
+	case WALFailureReadOnly:
+		if c.WALRecoveryCheckInterval <= 0 {
+			return errors.New("wal-recovery-check-interval must be greater than 0")
+		}
+	default:
+		return fmt.Errorf("unrecognized wal-failure-policy %s", c.WALFailurePolicy)
+	}
+
+	switch c.DuplicatePointPolicy {
+	case "", DuplicatePointLast, DuplicatePointFirst, DuplicatePointReject, DuplicatePointSequence:
+	default:
+		return fmt.Errorf("unrecognized duplicate-point-policy %s", c.DuplicatePointPolicy)
+	}
+
+	if c.MaxFieldValueSize < 0 {
+		return errors.New("max-field-value-size must not be negative")
+	}
+	switch c.OversizedFieldPolicy {
+	case "", OversizedFieldReject, OversizedFieldIsolate:
+	default:
+		return fmt.Errorf("unrecognized oversized-field-policy %s", c.OversizedFieldPolicy)
+	}
+
+	if c.MaxTagValueLength < 0 {
+		return errors.New("max-tag-value-length must not be negative")
+	}
+	if !validLongTagValuePolicy(c.LongTagValuePolicy) {
+		return fmt.Errorf("unrecognized long-tag-value-policy %s", c.LongTagValuePolicy)
+	}
+	for db, n := range c.DatabaseMaxTagValueLength {
+		if n < 0 {
+			return fmt.Errorf("max tag value length for database %s must not be negative", db)
+		}
+	}
+	for db, policy := range c.DatabaseLongTagValuePolicy {
+		if !validLongTagValuePolicy(policy) {
+			return fmt.Errorf("unrecognized long tag value policy %s for database %s", policy, db)
+		}
+	}
+
+	if !validCompactionMode(c.CompactionMode) {
+		return fmt.Errorf("unrecognized compaction-mode %s", c.CompactionMode)
+	}
+	for rp, mode := range c.RetentionPolicyCompactionModes {
+		if !validCompactionMode(mode) {
+			return fmt.Errorf("unrecognized compaction mode %s for retention policy %s", mode, rp)
+		}
+	}
+
+	for rp, n := range c.MaxSeriesPerRetentionPolicy {
+		if n < 0 {
+			return fmt.Errorf("max series for retention policy %s must not be negative", rp)
+		}
+	}
+
+	switch c.CacheEvictionPolicy {
+	case "", CacheEvictionNone:
+	case CacheEvictionLRW:
+		if c.CacheEvictionThreshold <= 0 || c.CacheEvictionThreshold > 1 {
+			return errors.New("cache-eviction-threshold must be greater than 0 and at most 1")
+		} else if c.CacheEvictionTarget <= 0 || c.CacheEvictionTarget >= c.CacheEvictionThreshold {
+			return errors.New("cache-eviction-target must be greater than 0 and less than cache-eviction-threshold")
+		}
+	default:
+		return fmt.Errorf("unrecognized cache-eviction-policy %s", c.CacheEvictionPolicy)
+	}
+
+	if c.DeleteCompactionThreshold < 0 {
+		return errors.New("delete-compaction-threshold must not be negative")
+	}
+
+	if c.CompactionBackoffQueries < 0 {
+		return errors.New("compaction-backoff-queries must not be negative")
+	}
+	if c.CompactionBackoffQueries > 0 {
+		if c.CompactionResumeQueries < 0 || c.CompactionResumeQueries >= c.CompactionBackoffQueries {
+			return errors.New("compaction-resume-queries must not be negative and must be less than compaction-backoff-queries")
+		}
+		if c.CompactionMaxBackoff < 0 {
+			return errors.New("compaction-max-backoff must not be negative")
+		}
+	}
+
+	if c.CompactionRetainDuration < 0 {
+		return errors.New("compaction-retain-duration must not be negative")
+	}
+
+	if c.SeriesEvictionEnabled {
+		if c.SeriesEvictionPeriod <= 0 {
+			return errors.New("series-eviction-period must be greater than 0")
+		} else if c.SeriesEvictionCheckInterval <= 0 {
+			return errors.New("series-eviction-check-interval must be greater than 0")
+		}
+	}
+
+	if c.WriteHotspotSampleRate < 0 || c.WriteHotspotSampleRate > 1 {
+		return errors.New("write-hotspot-sample-rate must be between 0 and 1")
+	} else if c.WriteHotspotSampleRate > 0 {
+		if c.WriteHotspotSeriesN <= 0 {
+			return errors.New("write-hotspot-series must be greater than 0")
+		} else if c.WriteHotspotInterval <= 0 {
+			return errors.New("write-hotspot-interval must be greater than 0")
+		}
+	}
+
+	switch c.TSMIndexLoad {
+	case "", TSMIndexLoadMmap, TSMIndexLoadMemory:
+	default:
+		return fmt.Errorf("unrecognized tsm-index-load %s", c.TSMIndexLoad)
+	}
+
+	if c.ShardQuarantineDuration < 0 {
+		return errors.New("shard-quarantine-duration must not be negative")
+	}
+
+	if c.MaxConcurrentShardOpens < 0 {
+		return errors.New("max-concurrent-shard-opens must not be negative")
+	}
+
 	return nil
 }
 
+// CompactionModeFor returns the compaction mode to use for shards belonging
+// to the given database and retention policy.
+func (c Config) CompactionModeFor(database, retentionPolicy string) string {
+	if mode, ok := c.RetentionPolicyCompactionModes[database+"."+retentionPolicy]; ok && mode != "" {
+		return mode
+	}
+	if c.CompactionMode == "" {
+		return DefaultCompactionMode
+	}
+	return c.CompactionMode
+}
+
+// MaxSeriesFor returns the maximum number of series for the given database and
+// retention policy. A value of 0 means there is no limit.
+func (c Config) MaxSeriesFor(database, retentionPolicy string) int {
+	return c.MaxSeriesPerRetentionPolicy[database+"."+retentionPolicy]
+}
+
+// TagValueLimitFor returns the max tag value length and the long tag value
+// policy for the given database. A length of 0 means there is no limit.
+func (c Config) TagValueLimitFor(database string) (int, string) {
+	n, ok := c.DatabaseMaxTagValueLength[database]
+	if !ok {
+		n = c.MaxTagValueLength
+	}
+	policy := c.DatabaseLongTagValuePolicy[database]
+	if policy == "" {
+		policy = c.LongTagValuePolicy
+	}
+	if policy == "" {
+		policy = DefaultLongTagValuePolicy
+	}
+	return n, policy
+}
+
+func validLongTagValuePolicy(policy string) bool {
+	switch policy {
+	case "", LongTagValueReject, LongTagValueTruncate:
+		return true
+	}
+	return false
+}
+
+func validCompactionMode(mode string) bool {
+	switch mode {
+	case "", CompactionModeFast, CompactionModeDefault, CompactionModeRewrite:
+		return true
+	}
+	return false
+}
+
 // Diagnostics returns a diagnostics representation of a subset of the Config.
 func (c Config) Diagnostics() (*diagnostics.Diagnostics, error) {
 	return diagnostics.RowFromMap(map[string]interface{}{
 		"dir":                                c.Dir,
 		"wal-dir":                            c.WALDir,
 		"wal-fsync-delay":                    c.WALFsyncDelay,
+		"wal-failure-policy":                 c.WALFailurePolicy,
+		"wal-recovery-check-interval":        c.WALRecoveryCheckInterval,
 		"cache-max-memory-size":              c.CacheMaxMemorySize,
 		"cache-snapshot-memory-size":         c.CacheSnapshotMemorySize,
 		"cache-snapshot-write-cold-duration": c.CacheSnapshotWriteColdDuration,
 		"compact-full-write-cold-duration":   c.CompactFullWriteColdDuration,
+		"cache-eviction-policy":              c.CacheEvictionPolicy,
+		"cache-eviction-threshold":           c.CacheEvictionThreshold,
+		"cache-eviction-target":              c.CacheEvictionTarget,
+		"delete-compaction-threshold":        c.DeleteCompactionThreshold,
+		"compaction-backoff-queries":         c.CompactionBackoffQueries,
+		"compaction-resume-queries":          c.CompactionResumeQueries,
+		"compaction-max-backoff":             c.CompactionMaxBackoff,
+		"compaction-retain-duration":         c.CompactionRetainDuration,
+		"compaction-retain-max-size":         c.CompactionRetainMaxSize,
+		"compaction-measurement-stats":       c.CompactionMeasurementStats,
+		"series-eviction-enabled":            c.SeriesEvictionEnabled,
+		"series-eviction-period":             c.SeriesEvictionPeriod,
+		"series-eviction-check-interval":     c.SeriesEvictionCheckInterval,
+		"write-hotspot-sample-rate":          c.WriteHotspotSampleRate,
+		"write-hotspot-series":               c.WriteHotspotSeriesN,
+		"write-hotspot-interval":             c.WriteHotspotInterval,
 		"max-series-per-database":            c.MaxSeriesPerDatabase,
 		"max-values-per-tag":                 c.MaxValuesPerTag,
+		"duplicate-point-policy":             c.DuplicatePointPolicy,
+		"max-field-value-size":               c.MaxFieldValueSize,
+		"oversized-field-policy":             c.OversizedFieldPolicy,
+		"max-tag-value-length":               c.MaxTagValueLength,
+		"long-tag-value-policy":              c.LongTagValuePolicy,
+		"compaction-mode":                    c.CompactionMode,
+		"shard-quarantine-duration":          c.ShardQuarantineDuration,
+		"tsm-index-load":                     c.TSMIndexLoad,
+		"warm-on-promotion":                  c.WarmOnPromotion,
+		"tsm-recover-on-open":                c.TSMRecoverOnOpen,
+		"max-concurrent-shard-opens":         c.MaxConcurrentShardOpens,
 	}), nil
 }
@@ -51,4 +51,177 @@ func TestConfig_Validate_Error(t *testing.T) {
 	if err := c.Validate(); err == nil || err.Error() != "unrecognized engine fake1" {
 		t.Errorf("unexpected error: %s", err)
 	}
+
+	c.Engine = tsdb.DefaultEngine
+	c.MaxConcurrentShardOpens = -1
+	if err := c.Validate(); err == nil || err.Error() != "max-concurrent-shard-opens must not be negative" {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	c.MaxConcurrentShardOpens = 0
+	c.OversizedFieldPolicy = "truncate"
+	if err := c.Validate(); err == nil || err.Error() != "unrecognized oversized-field-policy truncate" {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	c.OversizedFieldPolicy = tsdb.OversizedFieldIsolate
+	c.LongTagValuePolicy = "chunk"
+	if err := c.Validate(); err == nil || err.Error() != "unrecognized long-tag-value-policy chunk" {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	c.LongTagValuePolicy = tsdb.LongTagValueTruncate
+	c.DatabaseLongTagValuePolicy = map[string]string{"db0": "drop"}
+	if err := c.Validate(); err == nil || err.Error() != "unrecognized long tag value policy drop for database db0" {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	c.DatabaseLongTagValuePolicy = map[string]string{"db0": tsdb.LongTagValueReject}
+	c.CacheEvictionPolicy = "fifo"
+	if err := c.Validate(); err == nil || err.Error() != "unrecognized cache-eviction-policy fifo" {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	c.CacheEvictionPolicy = tsdb.CacheEvictionLRW
+	c.CacheEvictionTarget = 0.9
+	if err := c.Validate(); err == nil || err.Error() != "cache-eviction-target must be greater than 0 and less than cache-eviction-threshold" {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	c.CacheEvictionTarget = tsdb.DefaultCacheEvictionTarget
+	c.DeleteCompactionThreshold = -1
+	if err := c.Validate(); err == nil || err.Error() != "delete-compaction-threshold must not be negative" {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	c.DeleteCompactionThreshold = 0
+	c.CompactionBackoffQueries = 4
+	c.CompactionResumeQueries = 4
+	if err := c.Validate(); err == nil || err.Error() != "compaction-resume-queries must not be negative and must be less than compaction-backoff-queries" {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	c.CompactionBackoffQueries = 0
+	c.CompactionResumeQueries = 0
+	c.SeriesEvictionEnabled = true
+	c.SeriesEvictionPeriod = 0
+	if err := c.Validate(); err == nil || err.Error() != "series-eviction-period must be greater than 0" {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	c.SeriesEvictionEnabled = false
+	c.WriteHotspotSampleRate = 1.5
+	if err := c.Validate(); err == nil || err.Error() != "write-hotspot-sample-rate must be between 0 and 1" {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	c.WriteHotspotSampleRate = 0.5
+	c.WriteHotspotSeriesN = 0
+	if err := c.Validate(); err == nil || err.Error() != "write-hotspot-series must be greater than 0" {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	c.WriteHotspotSampleRate = 0
+	c.WALFailurePolicy = "panic"
+	if err := c.Validate(); err == nil || err.Error() != "unrecognized wal-failure-policy panic" {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	c.WALFailurePolicy = tsdb.WALFailureReadOnly
+	c.WALRecoveryCheckInterval = 0
+	if err := c.Validate(); err == nil || err.Error() != "wal-recovery-check-interval must be greater than 0" {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
+func TestConfig_CompactionModeFor(t *testing.T) {
+	c := tsdb.NewConfig()
+	if _, err := toml.Decode(`
+dir = "/var/lib/influxdb/data"
+wal-dir = "/var/lib/influxdb/wal"
+compaction-mode = "fast"
+
+[retention-policy-compaction-modes]
+"db0.archive" = "rewrite"
+`, &c); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Validate(); err != nil {
+		t.Fatalf("unexpected validate error: %s", err)
+	}
+
+	if got, exp := c.CompactionModeFor("db0", "archive"), tsdb.CompactionModeRewrite; got != exp {
+		t.Errorf("unexpected compaction mode: got %s, exp %s", got, exp)
+	}
+	if got, exp := c.CompactionModeFor("db0", "autogen"), tsdb.CompactionModeFast; got != exp {
+		t.Errorf("unexpected compaction mode: got %s, exp %s", got, exp)
+	}
+
+	c.RetentionPolicyCompactionModes["db0.archive"] = "best"
+	if err := c.Validate(); err == nil || err.Error() != "unrecognized compaction mode best for retention policy db0.archive" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestConfig_MaxSeriesFor(t *testing.T) {
+	c := tsdb.NewConfig()
+	if _, err := toml.Decode(`
+dir = "/var/lib/influxdb/data"
+wal-dir = "/var/lib/influxdb/wal"
+
+[max-series-per-retention-policy]
+"db0.realtime" = 500000
+`, &c); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Validate(); err != nil {
+		t.Fatalf("unexpected validate error: %s", err)
+	}
+
+	if got, exp := c.MaxSeriesFor("db0", "realtime"), 500000; got != exp {
+		t.Errorf("unexpected max series: got %d, exp %d", got, exp)
+	}
+	if got, exp := c.MaxSeriesFor("db0", "autogen"), 0; got != exp {
+		t.Errorf("unexpected max series: got %d, exp %d", got, exp)
+	}
+
+	c.MaxSeriesPerRetentionPolicy["db0.realtime"] = -1
+	if err := c.Validate(); err == nil || err.Error() != "max series for retention policy db0.realtime must not be negative" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestConfig_TagValueLimitFor(t *testing.T) {
+	c := tsdb.NewConfig()
+	if _, err := toml.Decode(`
+dir = "/var/lib/influxdb/data"
+wal-dir = "/var/lib/influxdb/wal"
+max-tag-value-length = 1024
+
+[database-max-tag-value-length]
+"db0" = 64
+
+[database-long-tag-value-policy]
+"db0" = "truncate"
+`, &c); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Validate(); err != nil {
+		t.Fatalf("unexpected validate error: %s", err)
+	}
+
+	if n, policy := c.TagValueLimitFor("db0"); n != 64 || policy != tsdb.LongTagValueTruncate {
+		t.Errorf("unexpected tag value limit: got %d/%s, exp 64/%s", n, policy, tsdb.LongTagValueTruncate)
+	}
+	if n, policy := c.TagValueLimitFor("db1"); n != 1024 || policy != tsdb.LongTagValueReject {
+		t.Errorf("unexpected tag value limit: got %d/%s, exp 1024/%s", n, policy, tsdb.LongTagValueReject)
+	}
+
+	c.DatabaseMaxTagValueLength["db0"] = -1
+	if err := c.Validate(); err == nil || err.Error() != "max tag value length for database db0 must not be negative" {
+		t.Errorf("unexpected error: %v", err)
+	}
 }
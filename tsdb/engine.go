@@ -33,6 +33,8 @@ type Engine interface {
 
 	Backup(w io.Writer, basePath string, since time.Time) error
 	Restore(r io.Reader, basePath string) error
+	Import(r io.Reader, basePath string) error
+	Export(w io.Writer) error
 
 	CreateIterator(measurement string, opt influxql.IteratorOptions) (influxql.Iterator, error)
 	WritePoints(points []models.Point) error
@@ -40,8 +42,13 @@ type Engine interface {
 	DeleteSeries(keys []string) error
 	DeleteSeriesRange(keys []string, min, max int64) error
 	DeleteMeasurement(name string, seriesKeys []string) error
+	MigrateFieldType(measurement, field string, typ influxql.DataType) (migrated, dropped int64, err error)
+	Verify(wait func(n int) error, quarantine bool) (VerifyStats, error)
+	Defragment() (before, after Fragmentation, err error)
+	Precompact() error
 	SeriesCount() (n int, err error)
 	MeasurementFields(measurement string) *MeasurementFields
+	LastTimestamp(measurement, seriesKey string) (int64, bool)
 	CreateSnapshot() (string, error)
 	SetEnabled(enabled bool)
 
@@ -55,6 +62,49 @@ type Engine interface {
 	io.WriterTo
 }
 
+// VerifyStats summarizes a scan of the checksums of the blocks in the files
+// of a shard.
+type VerifyStats struct {
+	Files         int64
+	Blocks        int64
+	Bytes         int64
+	CorruptBlocks int64
+
+	// CorruptFiles are the paths of the files with corrupt blocks, and
+	// QuarantinedFiles those of them that were removed from the shard.
+	CorruptFiles     []string
+	QuarantinedFiles []string
+}
+
+// Fragmentation describes how the series keys of a shard are spread across
+// its files and blocks.
+type Fragmentation struct {
+	Files  int64
+	Keys   int64
+	Blocks int64
+
+	// Fragments is the number of runs of contiguous blocks, each in a file
+	// of its own, the keys are stored in. It equals Keys if the blocks of
+	// every key are contiguous.
+	Fragments int64
+}
+
+// FilesPerKey returns the average number of files each key is stored in.
+func (f Fragmentation) FilesPerKey() float64 {
+	if f.Keys == 0 {
+		return 0
+	}
+	return float64(f.Fragments) / float64(f.Keys)
+}
+
+// BlocksPerKey returns the average number of blocks of each key.
+func (f Fragmentation) BlocksPerKey() float64 {
+	if f.Keys == 0 {
+		return 0
+	}
+	return float64(f.Blocks) / float64(f.Keys)
+}
+
 // EngineFormat represents the format for an engine.
 type EngineFormat int
 
@@ -120,6 +170,10 @@ type EngineOptions struct {
 	ShardID       uint64
 
 	Config Config
+
+	// ActiveQueries returns the number of queries running on the node. It
+	// is used to back off compactions under query load and may be nil.
+	ActiveQueries func() int64
 }
 
 // NewEngineOptions returns the default options.
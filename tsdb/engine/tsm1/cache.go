@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"math"
 	"os"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -33,6 +34,10 @@ func ErrCacheMemorySizeLimitExceeded(n, limit uint64) error {
 
 // entry is a set of values and some metadata.
 type entry struct {
+	// lastWrite is the time of the most recent write in nanoseconds. It is
+	// first in the struct so it is 64-bit aligned for atomic access.
+	lastWrite int64
+
 	mu     sync.RWMutex
 	values Values // All stored values.
 
@@ -52,7 +57,7 @@ func newEntryValues(values []Value, hint int) (*entry, error) {
 		hint = 32
 	}
 
-	e := &entry{}
+	e := &entry{lastWrite: time.Now().UnixNano()}
 	if len(values) > hint {
 		e.values = make(Values, 0, len(values))
 	} else {
@@ -91,6 +96,7 @@ func (e *entry) add(values []Value) error {
 			return tsdb.ErrFieldTypeConflict
 		}
 	}
+	atomic.StoreInt64(&e.lastWrite, time.Now().UnixNano())
 
 	// entry currently has no values, so add the new ones and we're done.
 	e.mu.Lock()
@@ -164,6 +170,9 @@ const (
 	statCacheWriteOK      = "writeOk"
 	statCacheWriteErr     = "writeErr"
 	statCacheWriteDropped = "writeDropped"
+
+	statCacheEvictions    = "evictionCount" // counter: Number of eviction snapshots taken.
+	statCacheEvictedBytes = "evictedBytes"  // counter: Total number of bytes written into eviction snapshots.
 )
 
 // storer is the interface that descibes a cache's store.
@@ -232,6 +241,8 @@ type CacheStatistics struct {
 	WriteOK             int64
 	WriteErr            int64
 	WriteDropped        int64
+	Evictions           int64
+	EvictedBytes        int64
 }
 
 // Statistics returns statistics for periodic monitoring.
@@ -249,6 +260,8 @@ func (c *Cache) Statistics(tags map[string]string) []models.Statistic {
 			statCacheWriteOK:        atomic.LoadInt64(&c.stats.WriteOK),
 			statCacheWriteErr:       atomic.LoadInt64(&c.stats.WriteErr),
 			statCacheWriteDropped:   atomic.LoadInt64(&c.stats.WriteDropped),
+			statCacheEvictions:      atomic.LoadInt64(&c.stats.Evictions),
+			statCacheEvictedBytes:   atomic.LoadInt64(&c.stats.EvictedBytes),
 		},
 	}}
 }
@@ -379,6 +392,117 @@ func (c *Cache) Snapshot() (*Cache, error) {
 	return c.snapshot, nil
 }
 
+// EvictionSnapshot takes a snapshot of the least recently written series in
+// the cache, totalling at least size bytes. Unlike Snapshot, the rest of the
+// cache stays in place. All fields of a series are evicted together. A nil
+// snapshot is returned if the cache is empty.
+func (c *Cache) EvictionSnapshot(size uint64) (*Cache, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.snapshotting {
+		return nil, ErrSnapshotInProgress
+	}
+
+	// Did a prior snapshot exist that failed?  If so, return the existing
+	// snapshot to retry.
+	if c.snapshot != nil && c.snapshot.Size() > 0 {
+		c.snapshotting = true
+		c.snapshotAttempts++
+		return c.snapshot, nil
+	}
+
+	groups := c.seriesGroups()
+	if len(groups) == 0 {
+		return nil, nil
+	}
+	sort.Sort(groups)
+
+	if c.snapshot == nil {
+		store, err := newring(ringShards)
+		if err != nil {
+			return nil, err
+		}
+
+		c.snapshot = &Cache{
+			store: store,
+		}
+	}
+
+	c.snapshotting = true
+	c.snapshotAttempts++
+
+	// Move the coldest series into the snapshot until enough has been evicted.
+	var evicted uint64
+	for _, g := range groups {
+		if evicted >= size {
+			break
+		}
+		for _, key := range g.keys {
+			e, ok := c.store.entry(key)
+			if !ok {
+				continue
+			}
+			c.snapshot.store.add(key, e)
+			c.store.remove(key)
+		}
+		evicted += g.size
+	}
+	if sz := c.Size(); evicted > sz {
+		evicted = sz
+	}
+
+	atomic.StoreUint64(&c.snapshot.size, evicted)
+	atomic.StoreUint64(&c.snapshotSize, evicted)
+	c.decreaseSize(evicted)
+
+	atomic.AddInt64(&c.stats.Evictions, 1)
+	atomic.AddInt64(&c.stats.EvictedBytes, int64(evicted))
+	c.updateCachedBytes(evicted)
+	c.updateSnapshots()
+
+	return c.snapshot, nil
+}
+
+// seriesGroups returns the keys in the cache grouped by series.
+func (c *Cache) seriesGroups() cacheSeriesGroups {
+	m := make(map[string]*cacheSeriesGroup)
+	_ = c.store.applySerial(func(key string, e *entry) error {
+		series, _ := SeriesAndFieldFromCompositeKey([]byte(key))
+		g := m[string(series)]
+		if g == nil {
+			g = &cacheSeriesGroup{}
+			m[string(series)] = g
+		}
+		g.keys = append(g.keys, key)
+		g.size += uint64(e.size())
+		if t := atomic.LoadInt64(&e.lastWrite); t > g.lastWrite {
+			g.lastWrite = t
+		}
+		return nil
+	})
+
+	groups := make(cacheSeriesGroups, 0, len(m))
+	for _, g := range m {
+		groups = append(groups, g)
+	}
+	return groups
+}
+
+// cacheSeriesGroup is the set of cache keys for the fields of a series.
+type cacheSeriesGroup struct {
+	keys      []string
+	size      uint64
+	lastWrite int64
+}
+
+// cacheSeriesGroups sorts series groups from least to most recently written.
+type cacheSeriesGroups []*cacheSeriesGroup
+
+func (a cacheSeriesGroups) Len() int           { return len(a) }
+func (a cacheSeriesGroups) Less(i, j int) bool { return a[i].lastWrite < a[j].lastWrite }
+func (a cacheSeriesGroups) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+
 // Deduplicate sorts the snapshot before returning it. The compactor and any queries
 // coming in while it writes will need the values sorted.
 func (c *Cache) Deduplicate() {
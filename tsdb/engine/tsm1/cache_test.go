@@ -482,6 +482,70 @@ func TestCache_CacheEmptySnapshot(t *testing.T) {
 	}
 }
 
+func TestCache_EvictionSnapshot(t *testing.T) {
+	c := NewCache(0, "")
+
+	for key, lastWrite := range map[string]int64{
+		"cpu,host=a#!~#value": 1,
+		"cpu,host=a#!~#idle":  1,
+		"cpu,host=b#!~#value": 3,
+		"cpu,host=c#!~#value": 2,
+	} {
+		if err := c.Write(key, Values{NewValue(1, 1.0)}); err != nil {
+			t.Fatal(err)
+		}
+		e, _ := c.store.entry(key)
+		atomic.StoreInt64(&e.lastWrite, lastWrite)
+	}
+
+	// The least recently written series is evicted with all of its fields.
+	snapshot, err := c.EvictionSnapshot(20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, exp := snapshot.Keys(), []string{"cpu,host=a#!~#idle", "cpu,host=a#!~#value"}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("unexpected snapshot keys: got %v, exp %v", got, exp)
+	}
+	if got, exp := c.Keys(), []string{"cpu,host=b#!~#value", "cpu,host=c#!~#value"}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("unexpected cache keys: got %v, exp %v", got, exp)
+	}
+	if got, exp := c.Size(), uint64(32); got != exp {
+		t.Fatalf("unexpected cache size: got %v, exp %v", got, exp)
+	}
+	if got, exp := snapshot.Size(), uint64(32); got != exp {
+		t.Fatalf("unexpected snapshot size: got %v, exp %v", got, exp)
+	}
+
+	// Evicted series can still be read while the snapshot is written.
+	if got := c.Values("cpu,host=a#!~#value"); len(got) != 1 {
+		t.Fatalf("unexpected values: %v", got)
+	}
+
+	if _, err := c.EvictionSnapshot(20); err != ErrSnapshotInProgress {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c.ClearSnapshot(true)
+
+	// Evict the remaining series in order.
+	if snapshot, err = c.EvictionSnapshot(20); err != nil {
+		t.Fatal(err)
+	} else if got, exp := snapshot.Keys(), []string{"cpu,host=b#!~#value", "cpu,host=c#!~#value"}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("unexpected snapshot keys: got %v, exp %v", got, exp)
+	}
+	c.ClearSnapshot(true)
+
+	if got, exp := c.stats.Evictions, int64(2); got != exp {
+		t.Fatalf("unexpected evictions: got %v, exp %v", got, exp)
+	} else if got, exp := c.stats.EvictedBytes, int64(64); got != exp {
+		t.Fatalf("unexpected evicted bytes: got %v, exp %v", got, exp)
+	}
+
+	// An empty cache has nothing to evict.
+	if snapshot, err := c.EvictionSnapshot(20); err != nil || snapshot != nil {
+		t.Fatalf("unexpected snapshot: %v, %v", snapshot, err)
+	}
+}
+
 func TestCache_CacheWriteMemoryExceeded(t *testing.T) {
 	v0 := NewValue(1, 1.0)
 	v1 := NewValue(2, 2.0)
@@ -23,11 +23,19 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/lucaswiersma/influxdb/models"
 	"github.com/lucaswiersma/influxdb/tsdb"
 )
 
 const maxTSMFileSize = uint32(2048 * 1024 * 1024) // 2GB
 
+// Statistics gathered by the Compactor for each measurement.
+const (
+	statMeasurementCompactions     = "compactions"
+	statMeasurementCompactedBlocks = "compactedBlocks"
+	statMeasurementCompactedBytes  = "compactedBytes"
+)
+
 const (
 	// CompactionTempExtension is the extension used for temporary files created during compaction.
 	CompactionTempExtension = "tmp"
@@ -506,11 +514,93 @@ type Compactor struct {
 		NextGeneration() int
 	}
 
+	// DictionaryMeasurements are the measurements whose string fields are
+	// dictionary encoded when written by snapshots and compactions.
+	DictionaryMeasurements map[string]struct{}
+
+	// MaxBlockValueSize splits string blocks so the values of each block
+	// total at most this many bytes, unless the block holds a single value.
+	// A value of 0 disables splitting.
+	MaxBlockValueSize int
+
+	// MeasurementStats records how many blocks and bytes of each measurement
+	// compactions rewrite, so measurements that dominate the compactions of
+	// a shard can be found and isolated in shards of their own.
+	MeasurementStats bool
+
 	mu                 sync.RWMutex
 	snapshotsEnabled   bool
 	compactionsEnabled bool
 
 	files map[string]struct{}
+
+	statsMu          sync.Mutex
+	measurementStats map[string]*measurementCompactionStats
+
+	rawBytes  int64 // Counter of uncompressed bytes of the values written to TSM files.
+	diskBytes int64 // Counter of bytes of the TSM files written.
+}
+
+// measurementCompactionStats holds the compaction activity of a measurement.
+type measurementCompactionStats struct {
+	Compactions int64 // Counter of compactions that rewrote the measurement.
+	Blocks      int64 // Counter of blocks of the measurement written by compactions.
+	Bytes       int64 // Counter of bytes of the measurement written by compactions.
+}
+
+// Statistics returns the compaction activity of each measurement when
+// MeasurementStats is enabled.
+func (c *Compactor) Statistics(tags map[string]string) []models.Statistic {
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+
+	names := make([]string, 0, len(c.measurementStats))
+	for name := range c.measurementStats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	statistics := make([]models.Statistic, 0, len(names))
+	for _, name := range names {
+		s := c.measurementStats[name]
+		statistics = append(statistics, models.Statistic{
+			Name: "tsm1_measurement_compaction",
+			Tags: models.StatisticTags{"measurement": name}.Merge(tags),
+			Values: map[string]interface{}{
+				statMeasurementCompactions:     s.Compactions,
+				statMeasurementCompactedBlocks: s.Blocks,
+				statMeasurementCompactedBytes:  s.Bytes,
+			},
+		})
+	}
+	return statistics
+}
+
+// writtenBytes returns the uncompressed size of the values written by
+// snapshots and compactions and the size of the TSM files holding them.
+func (c *Compactor) writtenBytes() (raw, disk int64) {
+	return atomic.LoadInt64(&c.rawBytes), atomic.LoadInt64(&c.diskBytes)
+}
+
+// addMeasurementStats adds the activity of a compaction to the totals of
+// each measurement.
+func (c *Compactor) addMeasurementStats(stats map[string]*measurementCompactionStats) {
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+
+	if c.measurementStats == nil {
+		c.measurementStats = make(map[string]*measurementCompactionStats, len(stats))
+	}
+	for name, s := range stats {
+		total := c.measurementStats[name]
+		if total == nil {
+			total = &measurementCompactionStats{}
+			c.measurementStats[name] = total
+		}
+		total.Compactions += s.Compactions
+		total.Blocks += s.Blocks
+		total.Bytes += s.Bytes
+	}
 }
 
 // Open initializes the Compactor.
@@ -575,7 +665,7 @@ func (c *Compactor) WriteSnapshot(cache *Cache) ([]string, error) {
 		return nil, errSnapshotsDisabled
 	}
 
-	iter := NewCacheKeyIterator(cache, tsdb.DefaultMaxPointsPerBlock)
+	iter := c.dictionaryKeyIterator(c.splitKeyIterator(NewCacheKeyIterator(cache, tsdb.DefaultMaxPointsPerBlock)))
 	files, err := c.writeNewFiles(c.FileStore.NextGeneration(), 0, iter)
 
 	// See if we were disabled while writing a snapshot
@@ -591,7 +681,8 @@ func (c *Compactor) WriteSnapshot(cache *Cache) ([]string, error) {
 }
 
 // compact writes multiple smaller TSM files into 1 or more larger files.
-func (c *Compactor) compact(fast bool, tsmFiles []string) ([]string, error) {
+// If contiguous is true, the blocks of a key are never split across files.
+func (c *Compactor) compact(fast, contiguous bool, tsmFiles []string) ([]string, error) {
 	size := c.Size
 	if size <= 0 {
 		size = tsdb.DefaultMaxPointsPerBlock
@@ -641,7 +732,41 @@ func (c *Compactor) compact(fast bool, tsmFiles []string) ([]string, error) {
 		return nil, err
 	}
 
-	return c.writeNewFiles(maxGeneration, maxSequence, tsm)
+	iter := c.dictionaryKeyIterator(c.splitKeyIterator(tsm))
+
+	var counts *measurementKeyIterator
+	if c.MeasurementStats {
+		counts = &measurementKeyIterator{KeyIterator: iter, stats: make(map[string]*measurementCompactionStats)}
+		iter = counts
+	}
+
+	if contiguous {
+		iter = &contiguousKeyIterator{KeyIterator: iter}
+	}
+
+	files, err := c.writeNewFiles(maxGeneration, maxSequence, iter)
+	if err == nil && counts != nil {
+		c.addMeasurementStats(counts.stats)
+	}
+	return files, err
+}
+
+// splitKeyIterator wraps iter so string blocks are split at MaxBlockValueSize.
+// It returns iter unchanged if splitting is disabled.
+func (c *Compactor) splitKeyIterator(iter KeyIterator) KeyIterator {
+	if c.MaxBlockValueSize <= 0 {
+		return iter
+	}
+	return &splitKeyIterator{KeyIterator: iter, maxSize: c.MaxBlockValueSize}
+}
+
+// dictionaryKeyIterator wraps iter so the string blocks of DictionaryMeasurements
+// are dictionary encoded. It returns iter unchanged if there are none.
+func (c *Compactor) dictionaryKeyIterator(iter KeyIterator) KeyIterator {
+	if len(c.DictionaryMeasurements) == 0 {
+		return iter
+	}
+	return &dictionaryKeyIterator{KeyIterator: iter, measurements: c.DictionaryMeasurements}
 }
 
 // CompactFull writes multiple smaller TSM files into 1 or more larger files.
@@ -659,7 +784,7 @@ func (c *Compactor) CompactFull(tsmFiles []string) ([]string, error) {
 	}
 	defer c.remove(tsmFiles)
 
-	files, err := c.compact(false, tsmFiles)
+	files, err := c.compact(false, false, tsmFiles)
 
 	// See if we were disabled while writing a snapshot
 	c.mu.RLock()
@@ -688,7 +813,7 @@ func (c *Compactor) CompactFast(tsmFiles []string) ([]string, error) {
 	}
 	defer c.remove(tsmFiles)
 
-	files, err := c.compact(true, tsmFiles)
+	files, err := c.compact(true, false, tsmFiles)
 
 	// See if we were disabled while writing a snapshot
 	c.mu.RLock()
@@ -703,11 +828,44 @@ func (c *Compactor) CompactFast(tsmFiles []string) ([]string, error) {
 
 }
 
+// CompactDefrag rewrites TSM files so that each key is written to a single
+// file with its values combined into maximally sized blocks. Unlike a full
+// compaction, a file is only rotated between keys, so the blocks of every key
+// are contiguous.
+func (c *Compactor) CompactDefrag(tsmFiles []string) ([]string, error) {
+	c.mu.RLock()
+	enabled := c.compactionsEnabled
+	c.mu.RUnlock()
+
+	if !enabled {
+		return nil, errCompactionsDisabled
+	}
+
+	if !c.add(tsmFiles) {
+		return nil, errCompactionInProgress
+	}
+	defer c.remove(tsmFiles)
+
+	files, err := c.compact(false, true, tsmFiles)
+
+	// See if we were disabled while writing the files
+	c.mu.RLock()
+	enabled = c.compactionsEnabled
+	c.mu.RUnlock()
+
+	if !enabled {
+		return nil, errCompactionsDisabled
+	}
+
+	return files, err
+}
+
 // writeNewFiles writes from the iterator into new TSM files, rotating
 // to a new file once it has reached the max TSM file size.
 func (c *Compactor) writeNewFiles(generation, sequence int, iter KeyIterator) ([]string, error) {
 	// These are the new TSM files written
 	var files []string
+	var rawBytes int64
 
 	for {
 		sequence++
@@ -715,7 +873,8 @@ func (c *Compactor) writeNewFiles(generation, sequence int, iter KeyIterator) ([
 		fileName := filepath.Join(c.Dir, fmt.Sprintf("%09d-%09d.%s.tmp", generation, sequence, TSMFileExtension))
 
 		// Write as much as possible to this file
-		err := c.write(fileName, iter)
+		n, err := c.write(fileName, iter)
+		rawBytes += n
 
 		// We've hit the max file limit and there is more to write.  Create a new file
 		// and continue.
@@ -740,19 +899,30 @@ func (c *Compactor) writeNewFiles(generation, sequence int, iter KeyIterator) ([
 		break
 	}
 
+	var diskBytes int64
+	for _, f := range files {
+		if fi, err := os.Stat(f); err == nil {
+			diskBytes += fi.Size()
+		}
+	}
+	atomic.AddInt64(&c.rawBytes, rawBytes)
+	atomic.AddInt64(&c.diskBytes, diskBytes)
+
 	return files, nil
 }
 
-func (c *Compactor) write(path string, iter KeyIterator) (err error) {
+// write writes blocks from iter to a new TSM file at path and returns the
+// uncompressed size of the values written.
+func (c *Compactor) write(path string, iter KeyIterator) (rawBytes int64, err error) {
 	fd, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_EXCL, 0666)
 	if err != nil {
-		return errCompactionInProgress
+		return 0, errCompactionInProgress
 	}
 
 	// Create the write for the new TSM file.
 	w, err := NewTSMWriter(fd)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer func() {
 		closeErr := w.Close()
@@ -767,42 +937,53 @@ func (c *Compactor) write(path string, iter KeyIterator) (err error) {
 		c.mu.RUnlock()
 
 		if !enabled {
-			return errCompactionAborted
+			return rawBytes, errCompactionAborted
 		}
 		// Each call to read returns the next sorted key (or the prior one if there are
 		// more values to write).  The size of values will be less than or equal to our
 		// chunk size (1000)
 		key, minTime, maxTime, block, err := iter.Read()
 		if err != nil {
-			return err
+			return rawBytes, err
 		}
 
 		// Write the key and value
 		if err := w.WriteBlock(key, minTime, maxTime, block); err == ErrMaxBlocksExceeded {
 			if err := w.WriteIndex(); err != nil {
-				return err
+				return rawBytes, err
 			}
-			return err
+			return rawBytes, err
 		} else if err != nil {
-			return err
+			return rawBytes, err
 		}
 
+		n, err := blockValuesSize(block)
+		if err != nil {
+			return rawBytes, err
+		}
+		rawBytes += int64(n)
+
 		// If we have a max file size configured and we're over it, close out the file
-		// and return the error.
+		// and return the error.  Files written by a contiguous iterator are
+		// only rotated once all the blocks of the key are written.
 		if w.Size() > maxTSMFileSize {
+			if itr, ok := iter.(*contiguousKeyIterator); ok && itr.peekKey() == key {
+				continue
+			}
+
 			if err := w.WriteIndex(); err != nil {
-				return err
+				return rawBytes, err
 			}
 
-			return errMaxFileExceeded
+			return rawBytes, errMaxFileExceeded
 		}
 	}
 
 	// We're all done.  Close out the file.
 	if err := w.WriteIndex(); err != nil {
-		return err
+		return rawBytes, err
 	}
-	return nil
+	return rawBytes, nil
 }
 
 func (c *Compactor) add(files []string) bool {
@@ -1116,6 +1297,194 @@ func (k *tsmKeyIterator) Close() error {
 	return nil
 }
 
+// dictionaryKeyIterator re-encodes the string blocks of a set of measurements
+// read from the underlying KeyIterator using dictionary encoding. Timestamps
+// are copied as-is and blocks that are already dictionary encoded, or that do
+// not compress better with a dictionary, are returned unchanged.
+type dictionaryKeyIterator struct {
+	KeyIterator
+	measurements map[string]struct{}
+}
+
+func (k *dictionaryKeyIterator) Read() (string, int64, int64, []byte, error) {
+	key, minTime, maxTime, block, err := k.KeyIterator.Read()
+	if err != nil || len(block) == 0 || block[0] != BlockString {
+		return key, minTime, maxTime, block, err
+	}
+
+	seriesKey, _ := SeriesAndFieldFromCompositeKey([]byte(key))
+	if _, ok := k.measurements[tsdb.MeasurementFromSeriesKey(string(seriesKey))]; !ok {
+		return key, minTime, maxTime, block, nil
+	}
+
+	block, err = encodeStringBlockDictionary(block)
+	return key, minTime, maxTime, block, err
+}
+
+// measurementKeyIterator counts the blocks and bytes read from the underlying
+// KeyIterator by measurement.
+type measurementKeyIterator struct {
+	KeyIterator
+	stats map[string]*measurementCompactionStats
+
+	// The stats of the last key read, so the measurement is only parsed
+	// once for all the blocks of a key.
+	lastKey string
+	last    *measurementCompactionStats
+}
+
+func (k *measurementKeyIterator) Read() (string, int64, int64, []byte, error) {
+	key, minTime, maxTime, block, err := k.KeyIterator.Read()
+	if err != nil {
+		return key, minTime, maxTime, block, err
+	}
+
+	if k.last == nil || key != k.lastKey {
+		seriesKey, _ := SeriesAndFieldFromCompositeKey([]byte(key))
+		name := tsdb.MeasurementFromSeriesKey(string(seriesKey))
+		s := k.stats[name]
+		if s == nil {
+			s = &measurementCompactionStats{Compactions: 1}
+			k.stats[name] = s
+		}
+		k.lastKey, k.last = key, s
+	}
+	k.last.Blocks++
+	k.last.Bytes += int64(len(block))
+	return key, minTime, maxTime, block, nil
+}
+
+// splitKeyIterator splits the string blocks read from the underlying
+// KeyIterator whose values total more than maxSize bytes. Large values end up
+// in blocks of their own instead of inflating the blocks of the values
+// around them. A single value is never split, so a value larger than maxSize
+// is isolated in a block larger than maxSize.
+type splitKeyIterator struct {
+	KeyIterator
+	maxSize int
+
+	blocks []*block
+	err    error
+}
+
+func (k *splitKeyIterator) Next() bool {
+	if len(k.blocks) > 1 {
+		k.blocks = k.blocks[1:]
+		return true
+	}
+	k.blocks, k.err = nil, nil
+
+	if !k.KeyIterator.Next() {
+		return false
+	}
+
+	key, minTime, maxTime, b, err := k.KeyIterator.Read()
+	if err != nil || len(b) == 0 || b[0] != BlockString {
+		k.blocks, k.err = []*block{{key: key, minTime: minTime, maxTime: maxTime, b: b}}, err
+		return true
+	}
+
+	k.blocks, k.err = k.split(key, minTime, maxTime, b)
+	return true
+}
+
+// split returns the block split into blocks of at most maxSize bytes of
+// values, except for values larger than maxSize which get a block each.
+func (k *splitKeyIterator) split(key string, minTime, maxTime int64, b []byte) ([]*block, error) {
+	values, err := DecodeStringBlock(b, &[]StringValue{})
+	if err != nil {
+		return nil, err
+	}
+
+	var blocks []*block
+	var start, size int
+	for i := 0; i <= len(values); i++ {
+		if i < len(values) {
+			sz := len(values[i].value)
+			if i == start || size+sz <= k.maxSize {
+				size += sz
+				continue
+			}
+		}
+
+		// Keep the original block if it does not need to be split.
+		if start == 0 && i == len(values) {
+			return []*block{{key: key, minTime: minTime, maxTime: maxTime, b: b}}, nil
+		}
+
+		chunk := values[start:i]
+		cb, err := StringValues(chunk).Encode(nil)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, &block{
+			key:     key,
+			minTime: chunk[0].UnixNano(),
+			maxTime: chunk[len(chunk)-1].UnixNano(),
+			b:       cb,
+		})
+
+		if i < len(values) {
+			start, size = i, len(values[i].value)
+		}
+	}
+	return blocks, nil
+}
+
+func (k *splitKeyIterator) Read() (string, int64, int64, []byte, error) {
+	if k.err != nil {
+		return "", 0, 0, nil, k.err
+	}
+	blk := k.blocks[0]
+	return blk.key, blk.minTime, blk.maxTime, blk.b, nil
+}
+
+// contiguousKeyIterator reads one block ahead of the KeyIterator it wraps so
+// that writers can tell whether the next block belongs to the same key.
+type contiguousKeyIterator struct {
+	KeyIterator
+
+	// peeked is the block read ahead, if any.
+	peeked *peekedBlock
+}
+
+type peekedBlock struct {
+	key              string
+	minTime, maxTime int64
+	b                []byte
+	err              error
+}
+
+// Next returns true if there are any blocks remaining in the iterator.
+func (k *contiguousKeyIterator) Next() bool {
+	if k.peeked != nil {
+		return true
+	}
+	return k.KeyIterator.Next()
+}
+
+// Read returns the next block.
+func (k *contiguousKeyIterator) Read() (string, int64, int64, []byte, error) {
+	if p := k.peeked; p != nil {
+		k.peeked = nil
+		return p.key, p.minTime, p.maxTime, p.b, p.err
+	}
+	return k.KeyIterator.Read()
+}
+
+// peekKey returns the key of the next block without consuming it, or an
+// empty string if there are no blocks left.
+func (k *contiguousKeyIterator) peekKey() string {
+	if k.peeked == nil {
+		if !k.KeyIterator.Next() {
+			return ""
+		}
+		key, minTime, maxTime, b, err := k.KeyIterator.Read()
+		k.peeked = &peekedBlock{key: key, minTime: minTime, maxTime: maxTime, b: b, err: err}
+	}
+	return k.peeked.key
+}
+
 type cacheKeyIterator struct {
 	cache *Cache
 	size  int
@@ -5,6 +5,7 @@ import (
 	"math"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -87,6 +88,115 @@ func TestCompactor_Snapshot(t *testing.T) {
 	}
 }
 
+// Ensures that string fields of dictionary measurements can be read back
+// after being written by a snapshot.
+func TestCompactor_Snapshot_Dictionary(t *testing.T) {
+	dir := MustTempDir()
+	defer os.RemoveAll(dir)
+
+	var statuses, hosts []tsm1.Value
+	for i := 0; i < 100; i++ {
+		statuses = append(statuses, tsm1.NewValue(int64(i), []string{"ok", "warn", "crit"}[i%3]))
+		hosts = append(hosts, tsm1.NewValue(int64(i), "server"))
+	}
+
+	c := tsm1.NewCache(0, "")
+	if err := c.Write("checks,host=A#!~#status", statuses); err != nil {
+		t.Fatalf("failed to write key to cache: %s", err.Error())
+	}
+	if err := c.Write("cpu,host=A#!~#host", hosts); err != nil {
+		t.Fatalf("failed to write key to cache: %s", err.Error())
+	}
+
+	compactor := &tsm1.Compactor{
+		Dir:                    dir,
+		FileStore:              &fakeFileStore{},
+		DictionaryMeasurements: map[string]struct{}{"checks": struct{}{}},
+	}
+	compactor.Open()
+
+	files, err := compactor.WriteSnapshot(c)
+	if err != nil {
+		t.Fatalf("unexpected error writing snapshot: %v", err)
+	}
+
+	r := MustOpenTSMReader(files[0])
+	defer r.Close()
+
+	for key, points := range map[string][]tsm1.Value{
+		"checks,host=A#!~#status": statuses,
+		"cpu,host=A#!~#host":      hosts,
+	} {
+		values, err := r.ReadAll(key)
+		if err != nil {
+			t.Fatalf("unexpected error reading: %v", err)
+		}
+
+		if got, exp := len(values), len(points); got != exp {
+			t.Fatalf("values length mismatch: got %v, exp %v", got, exp)
+		}
+
+		for i, point := range points {
+			assertValueEqual(t, values[i], point)
+		}
+	}
+}
+
+// Ensures that large string values are written in blocks of their own when
+// blocks are split by size.
+func TestCompactor_Snapshot_MaxBlockValueSize(t *testing.T) {
+	dir := MustTempDir()
+	defer os.RemoveAll(dir)
+
+	points := []tsm1.Value{
+		tsm1.NewValue(1, "0123456789"),
+		tsm1.NewValue(2, "0123456789"),
+		tsm1.NewValue(3, strings.Repeat("x", 100)),
+		tsm1.NewValue(4, "0123456789"),
+	}
+
+	c := tsm1.NewCache(0, "")
+	if err := c.Write("log,host=A#!~#msg", points); err != nil {
+		t.Fatalf("failed to write key to cache: %s", err.Error())
+	}
+
+	compactor := &tsm1.Compactor{
+		Dir:               dir,
+		FileStore:         &fakeFileStore{},
+		MaxBlockValueSize: 25,
+	}
+	compactor.Open()
+
+	files, err := compactor.WriteSnapshot(c)
+	if err != nil {
+		t.Fatalf("unexpected error writing snapshot: %v", err)
+	}
+
+	r := MustOpenTSMReader(files[0])
+	defer r.Close()
+
+	entries := r.Entries("log,host=A#!~#msg")
+	if got, exp := len(entries), 3; got != exp {
+		t.Fatalf("block count mismatch: got %v, exp %v", got, exp)
+	}
+	for i, exp := range [][2]int64{{1, 2}, {3, 3}, {4, 4}} {
+		if entries[i].MinTime != exp[0] || entries[i].MaxTime != exp[1] {
+			t.Fatalf("unexpected block %d time range: %d-%d", i, entries[i].MinTime, entries[i].MaxTime)
+		}
+	}
+
+	values, err := r.ReadAll("log,host=A#!~#msg")
+	if err != nil {
+		t.Fatalf("unexpected error reading: %v", err)
+	}
+	if got, exp := len(values), len(points); got != exp {
+		t.Fatalf("values length mismatch: got %v, exp %v", got, exp)
+	}
+	for i, point := range points {
+		assertValueEqual(t, values[i], point)
+	}
+}
+
 // Ensures that a compaction will properly merge multiple TSM files
 func TestCompactor_CompactFull(t *testing.T) {
 	dir := MustTempDir()
@@ -190,6 +300,55 @@ func TestCompactor_CompactFull(t *testing.T) {
 	}
 }
 
+// Ensure the compaction activity of each measurement is reported.
+func TestCompactor_CompactFull_MeasurementStats(t *testing.T) {
+	dir := MustTempDir()
+	defer os.RemoveAll(dir)
+
+	f1 := MustWriteTSM(dir, 1, map[string][]tsm1.Value{
+		"cpu,host=A#!~#value": []tsm1.Value{tsm1.NewValue(1, 1.1)},
+		"mem,host=A#!~#value": []tsm1.Value{tsm1.NewValue(1, 2.1)},
+	})
+	f2 := MustWriteTSM(dir, 2, map[string][]tsm1.Value{
+		"cpu,host=A#!~#value": []tsm1.Value{tsm1.NewValue(2, 1.2)},
+		"cpu,host=B#!~#value": []tsm1.Value{tsm1.NewValue(1, 3.1)},
+	})
+
+	compactor := &tsm1.Compactor{
+		Dir:              dir,
+		FileStore:        &fakeFileStore{},
+		MeasurementStats: true,
+	}
+	compactor.Open()
+
+	if _, err := compactor.CompactFull([]string{f1, f2}); err != nil {
+		t.Fatalf("unexpected error compacting: %v", err)
+	}
+
+	stats := compactor.Statistics(map[string]string{"id": "1"})
+	if got, exp := len(stats), 2; got != exp {
+		t.Fatalf("statistics length mismatch: got %v, exp %v", got, exp)
+	}
+	for i, exp := range []struct {
+		name   string
+		blocks int64
+	}{
+		{name: "cpu", blocks: 2},
+		{name: "mem", blocks: 1},
+	} {
+		s := stats[i]
+		if s.Name != "tsm1_measurement_compaction" || s.Tags["measurement"] != exp.name || s.Tags["id"] != "1" {
+			t.Fatalf("unexpected statistic: %v", s)
+		} else if got := s.Values["compactions"]; got != int64(1) {
+			t.Fatalf("%s: unexpected compactions: %v", exp.name, got)
+		} else if got := s.Values["compactedBlocks"]; got != exp.blocks {
+			t.Fatalf("%s: unexpected compacted blocks: %v", exp.name, got)
+		} else if got := s.Values["compactedBytes"].(int64); got <= 0 {
+			t.Fatalf("%s: unexpected compacted bytes: %v", exp.name, got)
+		}
+	}
+}
+
 // Ensures that a compaction will properly merge multiple TSM files
 func TestCompactor_Compact_OverlappingBlocks(t *testing.T) {
 	dir := MustTempDir()
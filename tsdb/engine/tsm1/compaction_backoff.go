@@ -0,0 +1,82 @@
+package tsm1
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// compactionBackoffGrace is how long compactions run after backing off for
+// the maximum duration before they can back off again, so the compactions
+// that were waiting get planned and started.
+const compactionBackoffGrace = time.Minute
+
+// compactionBackoff decides when the expensive compactions of an engine back
+// off because of the number of queries running on the node. Compactions back
+// off once the number of queries reaches backoffN and resume once it drops
+// to resumeN, or once they have backed off for maxDuration.
+type compactionBackoff struct {
+	activeQueries func() int64
+	backoffN      int64
+	resumeN       int64
+	maxDuration   time.Duration
+
+	mu    sync.Mutex
+	since time.Time // start of the current backoff, zero when not backed off
+	grace time.Time // no backoff before this time
+	now   func() time.Time
+
+	stats *EngineStatistics
+}
+
+// newCompactionBackoff returns a backoff that updates the backoff statistics
+// of stats. A maxDuration of 0 backs off for as long as the load lasts.
+func newCompactionBackoff(activeQueries func() int64, backoffN, resumeN int, maxDuration time.Duration, stats *EngineStatistics) *compactionBackoff {
+	return &compactionBackoff{
+		activeQueries: activeQueries,
+		backoffN:      int64(backoffN),
+		resumeN:       int64(resumeN),
+		maxDuration:   maxDuration,
+		now:           time.Now,
+		stats:         stats,
+	}
+}
+
+// backedOff returns true if the expensive compactions should not be planned
+// right now. It is safe to call on a nil backoff, which never backs off.
+func (b *compactionBackoff) backedOff() bool {
+	if b == nil {
+		return false
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n, now := b.activeQueries(), b.now()
+	if b.since.IsZero() {
+		if n < b.backoffN || now.Before(b.grace) {
+			return false
+		}
+		b.since = now
+		atomic.StoreInt64(&b.stats.CompactionBackoff, 1)
+		atomic.AddInt64(&b.stats.CompactionBackoffs, 1)
+		return true
+	}
+
+	if n <= b.resumeN {
+		b.resume(now)
+		return false
+	} else if b.maxDuration > 0 && now.Sub(b.since) >= b.maxDuration {
+		b.resume(now)
+		b.grace = now.Add(compactionBackoffGrace)
+		return false
+	}
+	return true
+}
+
+// resume ends the current backoff. b.mu must be held.
+func (b *compactionBackoff) resume(now time.Time) {
+	atomic.AddInt64(&b.stats.CompactionBackoffDuration, now.Sub(b.since).Nanoseconds())
+	atomic.StoreInt64(&b.stats.CompactionBackoff, 0)
+	b.since = time.Time{}
+}
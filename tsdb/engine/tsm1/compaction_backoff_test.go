@@ -0,0 +1,63 @@
+package tsm1
+
+import (
+	"testing"
+	"time"
+)
+
+// Ensure compactions back off under query load and resume when it drops or
+// the backoff reaches its maximum duration.
+func TestCompactionBackoff(t *testing.T) {
+	var queries int64
+	now := time.Unix(0, 0)
+	stats := &EngineStatistics{}
+	b := newCompactionBackoff(func() int64 { return queries }, 4, 1, 10*time.Minute, stats)
+	b.now = func() time.Time { return now }
+
+	check := func(step string, queries int64, exp bool) {
+		if got := b.backedOff(); got != exp {
+			t.Fatalf("%s: backedOff() with %d queries = %v, exp %v", step, queries, got, exp)
+		}
+	}
+
+	queries = 3
+	check("below threshold", queries, false)
+
+	queries = 4
+	check("at threshold", queries, true)
+	if stats.CompactionBackoff != 1 || stats.CompactionBackoffs != 1 {
+		t.Fatalf("unexpected stats while backed off: %+v", stats)
+	}
+
+	// Compactions stay backed off until the load drops to the resume threshold.
+	now = now.Add(time.Minute)
+	queries = 2
+	check("above resume threshold", queries, true)
+
+	now = now.Add(time.Minute)
+	queries = 1
+	check("at resume threshold", queries, false)
+	if stats.CompactionBackoff != 0 || stats.CompactionBackoffDuration != int64(2*time.Minute) {
+		t.Fatalf("unexpected stats after resuming: %+v", stats)
+	}
+
+	// Compactions resume after backing off for the maximum duration and
+	// don't back off again during the grace period.
+	queries = 8
+	check("backoff again", queries, true)
+	now = now.Add(10 * time.Minute)
+	check("max backoff", queries, false)
+	now = now.Add(compactionBackoffGrace / 2)
+	check("grace period", queries, false)
+	now = now.Add(compactionBackoffGrace / 2)
+	check("after grace period", queries, true)
+	if stats.CompactionBackoffs != 3 {
+		t.Fatalf("unexpected backoffs: %d", stats.CompactionBackoffs)
+	}
+
+	// A nil backoff never backs off.
+	var nb *compactionBackoff
+	if nb.backedOff() {
+		t.Fatal("nil backoff backed off")
+	}
+}
@@ -0,0 +1,86 @@
+package tsm1
+
+import (
+	"fmt"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/lucaswiersma/influxdb/tsdb"
+)
+
+// Defragment rewrites the TSM files of the engine so that the blocks of each
+// series key are contiguous in a single file, which makes scans of a series
+// sequential. The cache is written to disk first so all of the shard's data
+// is rewritten. It returns the fragmentation of the files before and after.
+func (e *Engine) Defragment() (before, after tsdb.Fragmentation, err error) {
+	if e.Cache.Size() > 0 {
+		if err := e.WriteSnapshot(); err != nil {
+			return before, after, err
+		}
+	}
+
+	before = e.FileStore.fragmentation()
+	if before.Fragments == before.Keys {
+		return before, before, nil
+	}
+
+	var files []string
+	for _, st := range e.FileStore.Stats() {
+		files = append(files, st.Path)
+	}
+	sort.Strings(files)
+
+	start := time.Now()
+	e.logger.Info(fmt.Sprintf("beginning defragmentation of %d TSM files in %s", len(files), e.path))
+
+	newFiles, err := func() ([]string, error) {
+		atomic.AddInt64(&e.stats.TSMFullCompactionsActive, 1)
+		defer atomic.AddInt64(&e.stats.TSMFullCompactionsActive, -1)
+		defer func() { atomic.AddInt64(&e.stats.TSMFullCompactionDuration, time.Since(start).Nanoseconds()) }()
+
+		newFiles, err := e.Compactor.CompactDefrag(files)
+		if err != nil {
+			return nil, err
+		}
+		return newFiles, e.FileStore.Replace(files, newFiles)
+	}()
+	if err != nil {
+		if err != errCompactionsDisabled && err != errCompactionInProgress {
+			atomic.AddInt64(&e.stats.TSMFullCompactionErrors, 1)
+		}
+		return before, after, err
+	}
+	atomic.AddInt64(&e.stats.TSMFullCompactions, 1)
+
+	after = e.FileStore.fragmentation()
+	e.logger.Info(fmt.Sprintf("defragmented %d files into %d files in %s: %.2f files and %.2f blocks per key before, %.2f and %.2f after",
+		len(files), len(newFiles), time.Since(start),
+		before.FilesPerKey(), before.BlocksPerKey(), after.FilesPerKey(), after.BlocksPerKey()))
+	return before, after, nil
+}
+
+// fragmentation measures how the series keys of the store are spread across
+// its TSM files and blocks.
+func (f *FileStore) fragmentation() tsdb.Fragmentation {
+	files := f.acquire()
+	defer func() {
+		for _, file := range files {
+			file.Unref()
+		}
+	}()
+
+	frag := tsdb.Fragmentation{Files: int64(len(files))}
+	keys := make(map[string]struct{})
+	for _, file := range files {
+		n := file.KeyCount()
+		for i := 0; i < n; i++ {
+			key, _ := file.KeyAt(i)
+			keys[string(key)] = struct{}{}
+			frag.Blocks += int64(len(file.Entries(string(key))))
+		}
+		frag.Fragments += int64(n)
+	}
+	frag.Keys = int64(len(keys))
+	return frag
+}
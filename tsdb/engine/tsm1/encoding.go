@@ -231,6 +231,44 @@ func BlockCount(block []byte) int {
 	return CountTimestamps(tb)
 }
 
+// blockValuesSize returns the uncompressed size of the values encoded in block,
+// as reported by their Size method. The values are counted without decoding
+// them, so the size of string values is an estimate.
+func blockValuesSize(block []byte) (int, error) {
+	if len(block) <= encodedBlockHeaderSize {
+		return 0, fmt.Errorf("blockValuesSize: short block: got %v, exp > %v", len(block), encodedBlockHeaderSize)
+	}
+	blockType, err := BlockType(block)
+	if err != nil {
+		return 0, err
+	}
+
+	// first byte is the block type
+	tb, vb, err := unpackBlock(block[1:])
+	if err != nil {
+		return 0, err
+	}
+	n, err := countTimestamps(tb)
+	if err != nil {
+		return 0, err
+	}
+
+	switch blockType {
+	case BlockFloat64:
+		return n * FloatValue{}.Size(), nil
+	case BlockInteger:
+		return n * IntegerValue{}.Size(), nil
+	case BlockBoolean:
+		return n * BooleanValue{}.Size(), nil
+	}
+
+	sz, err := stringsLen(vb, n)
+	if err != nil {
+		return 0, err
+	}
+	return n*8 + sz, nil
+}
+
 // DecodeBlock takes a byte slice and decodes it into values of the appropriate type
 // based on the block.
 func DecodeBlock(block []byte, vals []Value) ([]Value, error) {
@@ -793,6 +831,37 @@ func DecodeStringBlock(block []byte, a *[]StringValue) ([]StringValue, error) {
 	return (*a)[:i], err
 }
 
+// encodeStringBlockDictionary re-encodes the values of an encoded string block
+// using dictionary encoding, keeping its timestamps.
+func encodeStringBlockDictionary(block []byte) ([]byte, error) {
+	tb, vb, err := unpackBlock(block[1:])
+	if err != nil {
+		return nil, err
+	} else if len(vb) == 0 || vb[0]>>4 == stringCompressedDictionary {
+		return block, nil
+	}
+
+	vdec := stringDecoderPool.Get(0).(*StringDecoder)
+	defer stringDecoderPool.Put(vdec)
+	if err := vdec.SetBytes(vb); err != nil {
+		return nil, err
+	}
+
+	vEnc := NewDictionaryStringEncoder(len(vb))
+	for vdec.Next() {
+		vEnc.Write(vdec.Read())
+	}
+	if err := vdec.Error(); err != nil {
+		return nil, err
+	}
+
+	vb, err = vEnc.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	return packBlock(nil, BlockString, tb, vb), nil
+}
+
 func packBlock(buf []byte, typ byte, ts []byte, values []byte) []byte {
 	// We encode the length of the timestamp block using a variable byte encoding.
 	// This allows small byte slices to take up 1 byte while larger ones use 2 or more.
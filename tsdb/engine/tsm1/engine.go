@@ -12,6 +12,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -19,6 +20,7 @@ import (
 
 	"github.com/lucaswiersma/influxdb/influxql"
 	"github.com/lucaswiersma/influxdb/models"
+	"github.com/lucaswiersma/influxdb/pkg/escape"
 	"github.com/lucaswiersma/influxdb/tsdb"
 	"go.uber.org/zap"
 )
@@ -48,6 +50,15 @@ const (
 	statCacheCompactionError    = "cacheCompactionErr"
 	statCacheCompactionDuration = "cacheCompactionDuration"
 
+	statCacheSnapshotsSizeTriggered  = "cacheSnapshotsSizeTriggered"
+	statCacheSnapshotsColdTriggered  = "cacheSnapshotsColdTriggered"
+	statCacheSnapshotsEvictTriggered = "cacheSnapshotsEvictTriggered"
+
+	statPromotionWarms        = "promotionWarms"
+	statPromotionWarmDuration = "promotionWarmDuration"
+
+	statTempFilesRemoved = "tempFilesRemoved"
+
 	statTSMLevel1Compactions        = "tsmLevel1Compactions"
 	statTSMLevel1CompactionsActive  = "tsmLevel1CompactionsActive"
 	statTSMLevel1CompactionError    = "tsmLevel1CompactionErr"
@@ -72,6 +83,19 @@ const (
 	statTSMFullCompactionsActive  = "tsmFullCompactionsActive"
 	statTSMFullCompactionError    = "tsmFullCompactionErr"
 	statTSMFullCompactionDuration = "tsmFullCompactionDuration"
+
+	statTSMDeleteCompactions        = "tsmDeleteCompactions"
+	statTSMDeleteCompactionsActive  = "tsmDeleteCompactionsActive"
+	statTSMDeleteCompactionError    = "tsmDeleteCompactionErr"
+	statTSMDeleteCompactionDuration = "tsmDeleteCompactionDuration"
+
+	statCompactedRawBytes  = "compactedRawBytes"
+	statCompactedDiskBytes = "compactedDiskBytes"
+	statCompressionRatio   = "compressionRatio"
+
+	statCompactionBackoff         = "compactionBackoff"
+	statCompactionBackoffs        = "compactionBackoffs"
+	statCompactionBackoffDuration = "compactionBackoffDuration"
 )
 
 // Engine represents a storage engine with compressed blocks.
@@ -105,6 +129,15 @@ type Engine struct {
 	fieldsMu          sync.RWMutex
 	measurementFields map[string]*tsdb.MeasurementFields
 
+	// migrateMu is held for writing while a field type migration swaps in
+	// its converted data so iterators never see a mix of types.
+	migrateMu sync.RWMutex
+
+	// deleteMu is held for writing for the whole of a field type migration so
+	// deletes cannot tombstone the files being rewritten, which would bring
+	// the deleted data back once the rewritten files are swapped in.
+	deleteMu sync.RWMutex
+
 	WAL            *WAL
 	Cache          *Cache
 	Compactor      *Compactor
@@ -113,6 +146,10 @@ type Engine struct {
 
 	MaxPointsPerBlock int
 
+	// CompactionMode controls whether compactions merge existing blocks or
+	// rewrite them. See the tsdb.CompactionMode constants.
+	CompactionMode string
+
 	// CacheFlushMemorySizeThreshold specifies the minimum size threshodl for
 	// the cache when the engine should write a snapshot to a TSM file
 	CacheFlushMemorySizeThreshold uint64
@@ -122,6 +159,34 @@ type Engine struct {
 	// a snapshot of the cache to a TSM file
 	CacheFlushWriteColdDuration time.Duration
 
+	// CacheEvictionThreshold is the size of the cache, including any snapshot
+	// being written, above which the least recently written series are
+	// snapshotted until the cache is back down to CacheEvictionTarget. A
+	// value of 0 disables eviction.
+	CacheEvictionThreshold uint64
+	CacheEvictionTarget    uint64
+
+	// DeleteCompactionThreshold is the number of keys a delete must remove
+	// from the TSM files to schedule a compaction of all of them. A value of
+	// 0 disables delete compactions.
+	DeleteCompactionThreshold int
+
+	// deleteCompactionPending is set to 1 by a delete over the threshold and
+	// cleared once no TSM files have tombstones.
+	deleteCompactionPending int32
+
+	// WarmOnPromotion reads the TSM file indexes into the page cache when
+	// the engine is written to after CacheFlushWriteColdDuration without
+	// writes.
+	WarmOnPromotion bool
+
+	// warming is set to 1 while the TSM file indexes are being warmed.
+	warming int32
+
+	// compactionBackoff holds off level 2 and 3, full and delete compactions
+	// while many queries are running. It is nil when disabled.
+	compactionBackoff *compactionBackoff
+
 	// Controls whether to enabled compactions when the engine is open
 	enableCompactionsOnOpen bool
 
@@ -134,12 +199,32 @@ func NewEngine(id uint64, path string, walPath string, opt tsdb.EngineOptions) t
 	w.syncDelay = time.Duration(opt.Config.WALFsyncDelay)
 
 	fs := NewFileStore(path)
+	fs.indexInMemory = opt.Config.TSMIndexLoad == tsdb.TSMIndexLoadMemory
+	fs.recoverOnOpen = opt.Config.TSMRecoverOnOpen
+	fs.RetainReplacedFiles(time.Duration(opt.Config.CompactionRetainDuration), int64(opt.Config.CompactionRetainMaxSize))
 	cache := NewCache(uint64(opt.Config.CacheMaxMemorySize), path)
+	db, rp := tsdb.DecodeStorePath(path)
+
+	var evictThreshold, evictTarget uint64
+	if opt.Config.CacheEvictionPolicy == tsdb.CacheEvictionLRW {
+		evictThreshold = uint64(float64(opt.Config.CacheMaxMemorySize) * opt.Config.CacheEvictionThreshold)
+		evictTarget = uint64(float64(opt.Config.CacheMaxMemorySize) * opt.Config.CacheEvictionTarget)
+	}
 
 	c := &Compactor{
 		Dir:       path,
 		FileStore: fs,
 	}
+	c.MeasurementStats = opt.Config.CompactionMeasurementStats
+	if opt.Config.OversizedFieldPolicy == tsdb.OversizedFieldIsolate {
+		c.MaxBlockValueSize = opt.Config.MaxFieldValueSize
+	}
+	if len(opt.Config.StringDictionaryMeasurements) > 0 {
+		c.DictionaryMeasurements = make(map[string]struct{}, len(opt.Config.StringDictionaryMeasurements))
+		for _, name := range opt.Config.StringDictionaryMeasurements {
+			c.DictionaryMeasurements[name] = struct{}{}
+		}
+	}
 
 	logger := zap.New(zap.NullEncoder())
 	e := &Engine{
@@ -161,12 +246,22 @@ func NewEngine(id uint64, path string, walPath string, opt tsdb.EngineOptions) t
 			CompactFullWriteColdDuration: time.Duration(opt.Config.CompactFullWriteColdDuration),
 		},
 
+		CompactionMode:                opt.Config.CompactionModeFor(db, rp),
 		CacheFlushMemorySizeThreshold: opt.Config.CacheSnapshotMemorySize,
 		CacheFlushWriteColdDuration:   time.Duration(opt.Config.CacheSnapshotWriteColdDuration),
+		CacheEvictionThreshold:        evictThreshold,
+		CacheEvictionTarget:           evictTarget,
+		DeleteCompactionThreshold:     opt.Config.DeleteCompactionThreshold,
+		WarmOnPromotion:               opt.Config.WarmOnPromotion && !fs.indexInMemory,
 		enableCompactionsOnOpen:       true,
 		stats: &EngineStatistics{},
 	}
 
+	if opt.ActiveQueries != nil && opt.Config.CompactionBackoffQueries > 0 {
+		e.compactionBackoff = newCompactionBackoff(opt.ActiveQueries, opt.Config.CompactionBackoffQueries,
+			opt.Config.CompactionResumeQueries, time.Duration(opt.Config.CompactionMaxBackoff), e.stats)
+	}
+
 	if e.traceLogging {
 		fs.enableTraceLogging(true)
 		w.enableTraceLogging(true)
@@ -311,6 +406,25 @@ func (e *Engine) MeasurementFields(measurement string) *tsdb.MeasurementFields {
 	return m
 }
 
+// LastTimestamp returns the time of the newest value of any field of a
+// series, or false if the series has no values.
+func (e *Engine) LastTimestamp(measurement, seriesKey string) (int64, bool) {
+	var max int64
+	var ok bool
+	for name := range e.MeasurementFields(measurement).FieldSet() {
+		key := SeriesFieldKey(seriesKey, name)
+		if values := e.Cache.Values(key); len(values) > 0 {
+			if ts := values[len(values)-1].UnixNano(); !ok || ts > max {
+				max, ok = ts, true
+			}
+		}
+		if ts, found := e.FileStore.MaxTime(key); found && (!ok || ts > max) {
+			max, ok = ts, true
+		}
+	}
+	return max, ok
+}
+
 // Format returns the format type of this engine.
 func (e *Engine) Format() tsdb.EngineFormat {
 	return tsdb.TSM1Format
@@ -323,6 +437,15 @@ type EngineStatistics struct {
 	CacheCompactionErrors   int64 // Counter of cache compactions that have failed due to error.
 	CacheCompactionDuration int64 // Counter of number of wall nanoseconds spent in cache compactions.
 
+	CacheSnapshotsSizeTriggered  int64 // Counter of cache snapshots triggered by the cache reaching its snapshot size.
+	CacheSnapshotsColdTriggered  int64 // Counter of cache snapshots triggered by the shard going write cold.
+	CacheSnapshotsEvictTriggered int64 // Counter of eviction snapshots triggered by the cache nearing its maximum size.
+
+	PromotionWarms        int64 // Counter of index warms triggered by writes to an idle shard.
+	PromotionWarmDuration int64 // Counter of number of wall nanoseconds spent warming indexes.
+
+	TempFilesRemoved int64 // Counter of incomplete TSM temp files removed when the engine was opened.
+
 	TSMCompactions        [3]int64 // Counter of TSM compactions (by level) that have ever run.
 	TSMCompactionsActive  [3]int64 // Gauge of TSM compactions (by level) currently running.
 	TSMCompactionErrors   [3]int64 // Counter of TSM compcations (by level) that have failed due to error.
@@ -337,10 +460,27 @@ type EngineStatistics struct {
 	TSMFullCompactionsActive  int64 // Gauge of full compactions currently running.
 	TSMFullCompactionErrors   int64 // Counter of full compactions that have failed due to error.
 	TSMFullCompactionDuration int64 // Counter of number of wall nanoseconds spent in full compactions.
+
+	TSMDeleteCompactions        int64 // Counter of compactions triggered by large deletes that have ever run.
+	TSMDeleteCompactionsActive  int64 // Gauge of delete compactions currently running.
+	TSMDeleteCompactionErrors   int64 // Counter of delete compactions that have failed due to error.
+	TSMDeleteCompactionDuration int64 // Counter of number of wall nanoseconds spent in delete compactions.
+
+	CompactionBackoff         int64 // Gauge of whether compactions are backed off under query load.
+	CompactionBackoffs        int64 // Counter of times compactions have backed off under query load.
+	CompactionBackoffDuration int64 // Counter of number of wall nanoseconds compactions were backed off.
 }
 
 // Statistics returns statistics for periodic monitoring.
 func (e *Engine) Statistics(tags map[string]string) []models.Statistic {
+	// The compression ratio covers every TSM file written by snapshots and
+	// compactions of any level.
+	rawBytes, diskBytes := e.Compactor.writtenBytes()
+	var ratio float64
+	if diskBytes > 0 {
+		ratio = float64(rawBytes) / float64(diskBytes)
+	}
+
 	statistics := make([]models.Statistic, 0, 4)
 	statistics = append(statistics, models.Statistic{
 		Name: "tsm1_engine",
@@ -351,6 +491,15 @@ func (e *Engine) Statistics(tags map[string]string) []models.Statistic {
 			statCacheCompactionError:    atomic.LoadInt64(&e.stats.CacheCompactionErrors),
 			statCacheCompactionDuration: atomic.LoadInt64(&e.stats.CacheCompactionDuration),
 
+			statCacheSnapshotsSizeTriggered:  atomic.LoadInt64(&e.stats.CacheSnapshotsSizeTriggered),
+			statCacheSnapshotsColdTriggered:  atomic.LoadInt64(&e.stats.CacheSnapshotsColdTriggered),
+			statCacheSnapshotsEvictTriggered: atomic.LoadInt64(&e.stats.CacheSnapshotsEvictTriggered),
+
+			statPromotionWarms:        atomic.LoadInt64(&e.stats.PromotionWarms),
+			statPromotionWarmDuration: atomic.LoadInt64(&e.stats.PromotionWarmDuration),
+
+			statTempFilesRemoved: atomic.LoadInt64(&e.stats.TempFilesRemoved),
+
 			statTSMLevel1Compactions:        atomic.LoadInt64(&e.stats.TSMCompactions[0]),
 			statTSMLevel1CompactionsActive:  atomic.LoadInt64(&e.stats.TSMCompactionsActive[0]),
 			statTSMLevel1CompactionError:    atomic.LoadInt64(&e.stats.TSMCompactionErrors[0]),
@@ -375,11 +524,25 @@ func (e *Engine) Statistics(tags map[string]string) []models.Statistic {
 			statTSMFullCompactionsActive:  atomic.LoadInt64(&e.stats.TSMFullCompactionsActive),
 			statTSMFullCompactionError:    atomic.LoadInt64(&e.stats.TSMFullCompactionErrors),
 			statTSMFullCompactionDuration: atomic.LoadInt64(&e.stats.TSMFullCompactionDuration),
+
+			statTSMDeleteCompactions:        atomic.LoadInt64(&e.stats.TSMDeleteCompactions),
+			statTSMDeleteCompactionsActive:  atomic.LoadInt64(&e.stats.TSMDeleteCompactionsActive),
+			statTSMDeleteCompactionError:    atomic.LoadInt64(&e.stats.TSMDeleteCompactionErrors),
+			statTSMDeleteCompactionDuration: atomic.LoadInt64(&e.stats.TSMDeleteCompactionDuration),
+
+			statCompactedRawBytes:  rawBytes,
+			statCompactedDiskBytes: diskBytes,
+			statCompressionRatio:   ratio,
+
+			statCompactionBackoff:         atomic.LoadInt64(&e.stats.CompactionBackoff),
+			statCompactionBackoffs:        atomic.LoadInt64(&e.stats.CompactionBackoffs),
+			statCompactionBackoffDuration: atomic.LoadInt64(&e.stats.CompactionBackoffDuration),
 		},
 	})
 	statistics = append(statistics, e.Cache.Statistics(tags)...)
 	statistics = append(statistics, e.FileStore.Statistics(tags)...)
 	statistics = append(statistics, e.WAL.Statistics(tags)...)
+	statistics = append(statistics, e.Compactor.Statistics(tags)...)
 	return statistics
 }
 
@@ -548,6 +711,87 @@ func (e *Engine) writeFileToBackup(f os.FileInfo, shardRelativePath, fullPath st
 	return err
 }
 
+// Export writes the data in every TSM file of the engine to w as line
+// protocol. Like Backup, it snapshots the WAL first and reads from hard links
+// to the TSM files, so compactions can continue while the export is running.
+// Points stored in more than one file may be written more than once.
+func (e *Engine) Export(w io.Writer) error {
+	path, err := e.CreateSnapshot()
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(path)
+
+	files, err := filepath.Glob(filepath.Join(path, fmt.Sprintf("*.%s", TSMFileExtension)))
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+
+	for _, file := range files {
+		if err := e.exportFile(file, w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportFile writes the values in a TSM file to w as line protocol.
+func (e *Engine) exportFile(path string, w io.Writer) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	r, err := NewTSMReader(f)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	defer r.Close()
+
+	var buf []byte
+	for i := 0; i < r.KeyCount(); i++ {
+		key, _ := r.KeyAt(i)
+		values, err := r.ReadAll(string(key))
+		if err != nil {
+			return err
+		}
+
+		// Measurements are stored escaped, field names are not.
+		seriesKey, field := SeriesAndFieldFromCompositeKey(key)
+		buf = append(append(append(buf[:0], seriesKey...), ' '), escape.String(field)...)
+		buf = append(buf, '=')
+		prefixLen := len(buf)
+
+		for _, value := range values {
+			buf = buf[:prefixLen]
+			switch v := value.Value().(type) {
+			case float64:
+				buf = strconv.AppendFloat(buf, v, 'g', -1, 64)
+			case int64:
+				buf = strconv.AppendInt(buf, v, 10)
+				buf = append(buf, 'i')
+			case bool:
+				buf = strconv.AppendBool(buf, v)
+			case string:
+				buf = append(buf, '"')
+				buf = append(buf, models.EscapeStringField(v)...)
+				buf = append(buf, '"')
+			default:
+				buf = append(buf, fmt.Sprintf("%v", v)...)
+			}
+			buf = append(buf, ' ')
+			buf = strconv.AppendInt(buf, value.UnixNano(), 10)
+			buf = append(buf, '\n')
+			if _, err := w.Write(buf); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 // Restore reads a tar archive generated by Backup().
 // Only files that match basePath will be copied into the directory. This obtains
 // a write lock so no operations can be performed while restoring.
@@ -594,7 +838,56 @@ func (e *Engine) readFileFromBackup(tr *tar.Reader, shardRelativePath string) er
 		return err
 	}
 
-	destPath := filepath.Join(e.path, path)
+	return writeFileFromArchive(tr, hdr.Size, filepath.Join(e.path, path))
+}
+
+// Import reads a tar archive generated by Backup() and adds each file matching
+// basePath to the engine. Unlike Restore, imported files are given new
+// generations so they never replace existing files. The engine must be
+// reopened for the imported files to be loaded.
+func (e *Engine) Import(r io.Reader, basePath string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	// TSM files and their tombstones share a generation.
+	generations := make(map[int]int)
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		nativeFileName := filepath.FromSlash(hdr.Name)
+		if !filepath.HasPrefix(nativeFileName, basePath) {
+			continue
+		}
+
+		generation, sequence, err := ParseTSMFileName(nativeFileName)
+		if err != nil {
+			return err
+		}
+
+		newGeneration, ok := generations[generation]
+		if !ok {
+			newGeneration = e.FileStore.NextGeneration()
+			generations[generation] = newGeneration
+		}
+
+		name := fmt.Sprintf("%09d-%09d%s", newGeneration, sequence, filepath.Ext(nativeFileName))
+		if err := writeFileFromArchive(tr, hdr.Size, filepath.Join(e.path, name)); err != nil {
+			return err
+		}
+	}
+
+	return syncDir(e.path)
+}
+
+// writeFileFromArchive copies size bytes from r to a new file at destPath.
+func writeFileFromArchive(r io.Reader, size int64, destPath string) error {
 	tmp := destPath + ".tmp"
 
 	// Create new file on disk.
@@ -605,7 +898,7 @@ func (e *Engine) readFileFromBackup(tr *tar.Reader, shardRelativePath string) er
 	defer f.Close()
 
 	// Copy from archive to the file.
-	if _, err := io.CopyN(f, tr, hdr.Size); err != nil {
+	if _, err := io.CopyN(f, r, size); err != nil {
 		return err
 	}
 
@@ -646,7 +939,7 @@ func (e *Engine) addToIndexFromKey(shardID uint64, key []byte, fieldType influxq
 	ss := index.SeriesBytes(seriesKey)
 	if ss != nil {
 		// Add this shard to the existing series
-		ss.AssignShard(shardID)
+		index.AssignSeriesShard(ss, shardID)
 		return nil
 	}
 
@@ -655,8 +948,8 @@ func (e *Engine) addToIndexFromKey(shardID uint64, key []byte, fieldType influxq
 	_, tags, _ := models.ParseKey(seriesKey)
 
 	s := tsdb.NewSeries(string(seriesKey), tags)
-	index.CreateSeriesIndexIfNotExists(measurement, s, false)
-	s.AssignShard(shardID)
+	s = index.CreateSeriesIndexIfNotExists(measurement, s, false)
+	index.AssignSeriesShard(s, shardID)
 
 	return nil
 }
@@ -707,14 +1000,49 @@ func (e *Engine) WritePoints(points []models.Point) error {
 	e.mu.RLock()
 	defer e.mu.RUnlock()
 
+	// A write to a shard that has gone write cold promotes it back to hot.
+	if e.WarmOnPromotion && time.Since(e.WAL.LastWriteTime()) > e.CacheFlushWriteColdDuration {
+		e.warmIndexes()
+	}
+
 	// first try to write to the cache
 	err := e.Cache.WriteMulti(values)
 	if err != nil {
 		return err
 	}
 
-	_, err = e.WAL.WritePoints(values)
-	return err
+	if _, err := e.WAL.WritePoints(values); err != nil {
+		if err == ErrWALClosed {
+			return err
+		}
+		return tsdb.WALWriteError{Err: err}
+	}
+	return nil
+}
+
+// warmIndexes reads the keys of every TSM file in the background so the pages
+// of their indexes are in the page cache before queries need them. It does
+// nothing if the indexes are already being warmed.
+func (e *Engine) warmIndexes() {
+	if len(e.FileStore.Files()) == 0 || !atomic.CompareAndSwapInt32(&e.warming, 0, 1) {
+		return
+	}
+	atomic.AddInt64(&e.stats.PromotionWarms, 1)
+
+	go func() {
+		defer atomic.StoreInt32(&e.warming, 0)
+
+		start := time.Now()
+		var n int
+		if err := e.FileStore.WalkKeys(func(key []byte, typ byte) error {
+			n++
+			return nil
+		}); err != nil {
+			e.logger.Info(fmt.Sprintf("error warming indexes for %s: %v", e.path, err))
+		}
+		atomic.AddInt64(&e.stats.PromotionWarmDuration, time.Since(start).Nanoseconds())
+		e.traceLogger.Info(fmt.Sprintf("Warmed %d keys for %s in %s", n, e.path, time.Since(start)))
+	}()
 }
 
 // ContainsSeries returns a map of keys indicating whether the key exists and
@@ -755,6 +1083,10 @@ func (e *Engine) DeleteSeriesRange(seriesKeys []string, min, max int64) error {
 		return nil
 	}
 
+	// Wait for any field type migration to finish.
+	e.deleteMu.RLock()
+	defer e.deleteMu.RUnlock()
+
 	// Disable and abort running compactions so that tombstones added existing tsm
 	// files don't get removed.  This would cause deleted measurements/series to
 	// re-appear once the compaction completed.  We only disable the level compactions
@@ -797,6 +1129,11 @@ func (e *Engine) DeleteSeriesRange(seriesKeys []string, min, max int64) error {
 		return err
 	}
 
+	// Compact the files right away to reclaim the space of a large delete.
+	if e.DeleteCompactionThreshold > 0 && len(deleteKeys) >= e.DeleteCompactionThreshold {
+		atomic.StoreInt32(&e.deleteCompactionPending, 1)
+	}
+
 	// find the keys in the cache and remove them
 	walKeys := deleteKeys[:0]
 
@@ -911,6 +1248,33 @@ func (e *Engine) WriteSnapshot() error {
 	return e.writeSnapshotAndCommit(closedFiles, snapshot)
 }
 
+// writeEvictionSnapshot snapshots the least recently written series in the
+// cache, totalling at least size bytes, and writes them to a new TSM file.
+// The closed WAL segments are kept since they still hold writes for the
+// series remaining in the cache.
+func (e *Engine) writeEvictionSnapshot(size uint64) error {
+	start := time.Now()
+	snapshot, err := func() (*Cache, error) {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		return e.Cache.EvictionSnapshot(size)
+	}()
+	if err != nil {
+		return err
+	} else if snapshot == nil {
+		return nil
+	}
+
+	snapshot.Deduplicate()
+	if err := e.writeSnapshotAndCommit(nil, snapshot); err != nil {
+		return err
+	}
+
+	e.Cache.UpdateCompactTime(time.Since(start))
+	e.logger.Info(fmt.Sprintf("Eviction snapshot of %d bytes for path %s written in %v", snapshot.Size(), e.path, time.Since(start)))
+	return nil
+}
+
 // CreateSnapshot will create a temp directory that holds
 // temporary hardlinks to the underylyng shard files.
 func (e *Engine) CreateSnapshot() (string, error) {
@@ -961,6 +1325,7 @@ func (e *Engine) writeSnapshotAndCommit(closedFiles []string, snapshot *Cache) (
 func (e *Engine) compactCache(quit <-chan struct{}) {
 	t := time.NewTicker(time.Second)
 	defer t.Stop()
+	lastPrune := time.Now()
 	for {
 		select {
 		case <-quit:
@@ -968,7 +1333,20 @@ func (e *Engine) compactCache(quit <-chan struct{}) {
 
 		case <-t.C:
 			e.Cache.UpdateAge()
+
+			// Expire retained TSM files even if the shard stops compacting.
+			if e.FileStore.retainDuration > 0 && time.Since(lastPrune) >= retainedPruneInterval {
+				e.FileStore.pruneRetained()
+				lastPrune = time.Now()
+			}
+
 			if e.ShouldCompactCache(e.WAL.LastWriteTime()) {
+				if e.Cache.Size() > e.CacheFlushMemorySizeThreshold {
+					atomic.AddInt64(&e.stats.CacheSnapshotsSizeTriggered, 1)
+				} else {
+					atomic.AddInt64(&e.stats.CacheSnapshotsColdTriggered, 1)
+				}
+
 				start := time.Now()
 				e.traceLogger.Info(fmt.Sprintf("Compacting cache for %s", e.path))
 				err := e.WriteSnapshot()
@@ -979,6 +1357,19 @@ func (e *Engine) compactCache(quit <-chan struct{}) {
 					atomic.AddInt64(&e.stats.CacheCompactions, 1)
 				}
 				atomic.AddInt64(&e.stats.CacheCompactionDuration, time.Since(start).Nanoseconds())
+			} else if n := e.cacheEvictionSize(); n > 0 {
+				atomic.AddInt64(&e.stats.CacheSnapshotsEvictTriggered, 1)
+
+				start := time.Now()
+				e.traceLogger.Info(fmt.Sprintf("Evicting %d bytes from cache for %s", n, e.path))
+				err := e.writeEvictionSnapshot(n)
+				if err != nil && err != errCompactionsDisabled {
+					e.logger.Info(fmt.Sprintf("error writing eviction snapshot: %v", err))
+					atomic.AddInt64(&e.stats.CacheCompactionErrors, 1)
+				} else {
+					atomic.AddInt64(&e.stats.CacheCompactions, 1)
+				}
+				atomic.AddInt64(&e.stats.CacheCompactionDuration, time.Since(start).Nanoseconds())
 			}
 		}
 	}
@@ -997,6 +1388,27 @@ func (e *Engine) ShouldCompactCache(lastWriteTime time.Time) bool {
 		time.Since(lastWriteTime) > e.CacheFlushWriteColdDuration
 }
 
+// cacheEvictionSize returns the number of bytes of the least recently written
+// series that should be evicted from the cache, or 0 if the cache is below the
+// eviction threshold.
+func (e *Engine) cacheEvictionSize() uint64 {
+	if e.CacheEvictionThreshold == 0 {
+		return 0
+	}
+
+	sz := e.Cache.Size()
+	total := sz + atomic.LoadUint64(&e.Cache.snapshotSize)
+	if total <= e.CacheEvictionThreshold {
+		return 0
+	}
+
+	n := total - e.CacheEvictionTarget
+	if n > sz {
+		n = sz
+	}
+	return n
+}
+
 func (e *Engine) compactTSMLevel(fast bool, level int, quit <-chan struct{}) {
 	t := time.NewTicker(time.Second)
 	defer t.Stop()
@@ -1007,6 +1419,11 @@ func (e *Engine) compactTSMLevel(fast bool, level int, quit <-chan struct{}) {
 			return
 
 		case <-t.C:
+			// Level 1 compactions keep the number of TSM files in check
+			// so they run even when compactions are backed off.
+			if level > 1 && e.compactionBackoff.backedOff() {
+				continue
+			}
 			s := e.levelCompactionStrategy(fast, level)
 			if s != nil {
 				s.Apply()
@@ -1025,7 +1442,13 @@ func (e *Engine) compactTSMFull(quit <-chan struct{}) {
 			return
 
 		case <-t.C:
-			s := e.fullCompactionStrategy()
+			if e.compactionBackoff.backedOff() {
+				continue
+			}
+			s := e.deleteCompactionStrategy()
+			if s == nil {
+				s = e.fullCompactionStrategy()
+			}
 			if s != nil {
 				s.Apply()
 			}
@@ -1133,7 +1556,7 @@ func (e *Engine) levelCompactionStrategy(fast bool, level int) *compactionStrate
 		logger:           e.logger,
 		fileStore:        e.FileStore,
 		compactor:        e.Compactor,
-		fast:             fast,
+		fast:             e.compactFast(fast),
 
 		description:  fmt.Sprintf("level %d", level),
 		activeStat:   &e.stats.TSMCompactionsActive[level-1],
@@ -1143,6 +1566,18 @@ func (e *Engine) levelCompactionStrategy(fast bool, level int) *compactionStrate
 	}
 }
 
+// compactFast adjusts whether a compaction should use fast block merging based
+// on the engine's compaction mode.
+func (e *Engine) compactFast(fast bool) bool {
+	switch e.CompactionMode {
+	case tsdb.CompactionModeFast:
+		return true
+	case tsdb.CompactionModeRewrite:
+		return false
+	}
+	return fast
+}
+
 // fullCompactionStrategy returns a compactionStrategy for higher level generations of TSM files.
 // It returns nil if there are no TSM files to compact.
 func (e *Engine) fullCompactionStrategy() *compactionStrategy {
@@ -1163,7 +1598,7 @@ func (e *Engine) fullCompactionStrategy() *compactionStrategy {
 		logger:           e.logger,
 		fileStore:        e.FileStore,
 		compactor:        e.Compactor,
-		fast:             optimize,
+		fast:             e.compactFast(optimize),
 	}
 
 	if optimize {
@@ -1183,6 +1618,87 @@ func (e *Engine) fullCompactionStrategy() *compactionStrategy {
 	return s
 }
 
+// deleteCompactionStrategy returns a compactionStrategy that compacts all of
+// the TSM files together after a large delete so the deleted data is removed
+// from disk. It returns nil if no delete compaction is pending.
+func (e *Engine) deleteCompactionStrategy() *compactionStrategy {
+	if atomic.LoadInt32(&e.deleteCompactionPending) == 0 {
+		return nil
+	}
+
+	// The compaction is retried until the tombstones have been applied.
+	var files []string
+	var tombstones bool
+	for _, st := range e.FileStore.Stats() {
+		files = append(files, st.Path)
+		tombstones = tombstones || st.HasTombstone
+	}
+	if !tombstones {
+		atomic.StoreInt32(&e.deleteCompactionPending, 0)
+		return nil
+	}
+	sort.Strings(files)
+
+	return &compactionStrategy{
+		compactionGroups: []CompactionGroup{files},
+		logger:           e.logger,
+		fileStore:        e.FileStore,
+		compactor:        e.Compactor,
+		fast:             e.compactFast(false),
+
+		description:  "delete",
+		activeStat:   &e.stats.TSMDeleteCompactionsActive,
+		successStat:  &e.stats.TSMDeleteCompactions,
+		errorStat:    &e.stats.TSMDeleteCompactionErrors,
+		durationStat: &e.stats.TSMDeleteCompactionDuration,
+	}
+}
+
+// Precompact writes the cache to a TSM file and compacts all of the shard's
+// TSM files together, regardless of their level, so the shard can be read from
+// as few files as possible. It is counted as a full compaction.
+func (e *Engine) Precompact() error {
+	if e.Cache.Size() > 0 {
+		if err := e.WriteSnapshot(); err != nil {
+			return err
+		}
+	}
+
+	var files []string
+	for _, st := range e.FileStore.Stats() {
+		files = append(files, st.Path)
+	}
+	if len(files) <= 1 {
+		return nil
+	}
+	sort.Strings(files)
+
+	start := time.Now()
+	e.logger.Info(fmt.Sprintf("beginning precompaction of %d TSM files in %s", len(files), e.path))
+
+	newFiles, err := func() ([]string, error) {
+		atomic.AddInt64(&e.stats.TSMFullCompactionsActive, 1)
+		defer atomic.AddInt64(&e.stats.TSMFullCompactionsActive, -1)
+		defer func() { atomic.AddInt64(&e.stats.TSMFullCompactionDuration, time.Since(start).Nanoseconds()) }()
+
+		newFiles, err := e.Compactor.CompactFull(files)
+		if err != nil {
+			return nil, err
+		}
+		return newFiles, e.FileStore.Replace(files, newFiles)
+	}()
+	if err != nil {
+		if err != errCompactionsDisabled && err != errCompactionInProgress {
+			atomic.AddInt64(&e.stats.TSMFullCompactionErrors, 1)
+		}
+		return err
+	}
+
+	atomic.AddInt64(&e.stats.TSMFullCompactions, 1)
+	e.logger.Info(fmt.Sprintf("precompacted %d files into %d files in %s", len(files), len(newFiles), time.Since(start)))
+	return nil
+}
+
 // reloadCache reads the WAL segment files and loads them into the cache.
 func (e *Engine) reloadCache() error {
 	now := time.Now()
@@ -1239,6 +1755,10 @@ func (e *Engine) cleanupTempTSMFiles() error {
 		if err := os.Remove(f); err != nil {
 			return fmt.Errorf("error removing temp compaction files: %v", err)
 		}
+		atomic.AddInt64(&e.stats.TempFilesRemoved, 1)
+	}
+	if len(files) > 0 {
+		e.logger.Info(fmt.Sprintf("removed %d incomplete TSM temp files from %s", len(files), e.path))
 	}
 	return nil
 }
@@ -1250,6 +1770,9 @@ func (e *Engine) KeyCursor(key string, t int64, ascending bool) *KeyCursor {
 
 // CreateIterator returns an iterator for the measurement based on opt.
 func (e *Engine) CreateIterator(measurement string, opt influxql.IteratorOptions) (influxql.Iterator, error) {
+	e.migrateMu.RLock()
+	defer e.migrateMu.RUnlock()
+
 	if call, ok := opt.Expr.(*influxql.Call); ok {
 		if opt.Interval.IsZero() {
 			if call.Name == "first" || call.Name == "last" {
@@ -1529,7 +2052,11 @@ func (e *Engine) createVarRefSeriesIterator(ref *influxql.VarRef, mm *tsdb.Measu
 		for i, ref := range opt.Aux {
 			// Create cursor from field if a tag wasn't requested.
 			if ref.Type != influxql.Tag {
-				cur := e.buildCursor(mm.Name, seriesKey, &ref, opt)
+				// Typed columns only hold values stored with their type.
+				var cur cursor
+				if opt.FieldTypePolicy != influxql.FieldTypeTyped || e.fieldType(mm.Name, ref.Val) == ref.Type {
+					cur = e.buildCursor(mm.Name, seriesKey, &ref, opt)
+				}
 				if cur != nil {
 					aux[i] = newBufCursor(cur, opt.Ascending)
 					continue
@@ -1636,6 +2163,21 @@ func (e *Engine) createVarRefSeriesIterator(ref *influxql.VarRef, mm *tsdb.Measu
 }
 
 // buildCursor creates an untyped cursor for a field.
+// fieldType returns the type of a field in the measurement, or Unknown if the
+// field does not exist.
+func (e *Engine) fieldType(measurement, field string) influxql.DataType {
+	e.fieldsMu.RLock()
+	mf := e.measurementFields[measurement]
+	e.fieldsMu.RUnlock()
+
+	if mf == nil {
+		return influxql.Unknown
+	} else if f := mf.Field(field); f != nil {
+		return f.Type
+	}
+	return influxql.Unknown
+}
+
 func (e *Engine) buildCursor(measurement, seriesKey string, ref *influxql.VarRef, opt influxql.IteratorOptions) cursor {
 	// Look up fields for measurement.
 	e.fieldsMu.RLock()
@@ -1661,6 +2203,16 @@ func (e *Engine) buildCursor(measurement, seriesKey string, ref *influxql.VarRef
 			case influxql.Integer:
 				cur := e.buildIntegerCursor(measurement, seriesKey, ref.Val, opt)
 				return &floatCastIntegerCursor{cursor: cur}
+			case influxql.String:
+				if opt.FieldTypePolicy == influxql.FieldTypeFloat {
+					cur := e.buildStringCursor(measurement, seriesKey, ref.Val, opt)
+					return &floatCastStringCursor{cursor: cur}
+				}
+			case influxql.Boolean:
+				if opt.FieldTypePolicy == influxql.FieldTypeFloat {
+					cur := e.buildBooleanCursor(measurement, seriesKey, ref.Val, opt)
+					return &floatCastBooleanCursor{cursor: cur}
+				}
 			}
 		case influxql.Integer:
 			switch f.Type {
@@ -10,6 +10,7 @@ import (
 	"path/filepath"
 	"reflect"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
 	"testing"
@@ -18,6 +19,7 @@ import (
 	"github.com/lucaswiersma/influxdb/influxql"
 	"github.com/lucaswiersma/influxdb/models"
 	"github.com/lucaswiersma/influxdb/pkg/deep"
+	"github.com/lucaswiersma/influxdb/toml"
 	"github.com/lucaswiersma/influxdb/tsdb"
 	"github.com/lucaswiersma/influxdb/tsdb/engine/tsm1"
 )
@@ -215,6 +217,60 @@ func TestEngine_Backup(t *testing.T) {
 }
 
 // Ensure engine can create an ascending iterator for cached values.
+// Ensure the engine exports the data in its TSM files and cache as line protocol.
+func TestEngine_Export(t *testing.T) {
+	// Generate temporary file.
+	f, _ := ioutil.TempFile("", "tsm")
+	f.Close()
+	os.Remove(f.Name())
+	walPath := filepath.Join(f.Name(), "wal")
+	os.MkdirAll(walPath, 0777)
+	defer os.RemoveAll(f.Name())
+
+	e := tsm1.NewEngine(1, f.Name(), walPath, tsdb.NewEngineOptions()).(*tsm1.Engine)
+
+	// mock the planner so compactions don't run during the test
+	e.CompactionPlan = &mockPlanner{}
+
+	if err := e.Open(); err != nil {
+		t.Fatalf("failed to open tsm1 engine: %s", err.Error())
+	}
+	defer e.Close()
+
+	if err := e.WritePoints([]models.Point{
+		MustParsePointString("cpu,host=A value=1.1 1000000000"),
+		MustParsePointString(`cpu,host=A count=2i,ok=true,msg="say \"hi\"" 2000000000`),
+	}); err != nil {
+		t.Fatalf("failed to write points: %s", err.Error())
+	}
+	if err := e.WriteSnapshot(); err != nil {
+		t.Fatalf("failed to snapshot: %s", err.Error())
+	}
+
+	// Points still in the cache are exported as well.
+	if err := e.WritePoints([]models.Point{MustParsePointString("mem,host=B free=3 3000000000")}); err != nil {
+		t.Fatalf("failed to write points: %s", err.Error())
+	}
+
+	var buf bytes.Buffer
+	if err := e.Export(&buf); err != nil {
+		t.Fatalf("failed to export: %s", err.Error())
+	}
+
+	got := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	sort.Strings(got)
+	exp := []string{
+		`cpu,host=A count=2i 2000000000`,
+		`cpu,host=A msg="say \"hi\"" 2000000000`,
+		`cpu,host=A ok=true 2000000000`,
+		`cpu,host=A value=1.1 1000000000`,
+		`mem,host=B free=3 3000000000`,
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Fatalf("unexpected export:\n\tgot: %q\n\texp: %q", got, exp)
+	}
+}
+
 func TestEngine_CreateIterator_Cache_Ascending(t *testing.T) {
 	t.Parallel()
 
@@ -604,6 +660,554 @@ func TestEngine_DeleteSeries(t *testing.T) {
 
 }
 
+// Ensure a delete over the threshold compacts the TSM files to remove the
+// deleted data from disk.
+func TestEngine_DeleteSeries_Compaction(t *testing.T) {
+	root, err := ioutil.TempDir("", "tsm1-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	opt := tsdb.NewEngineOptions()
+	opt.Config.DeleteCompactionThreshold = 2
+	e := tsm1.NewEngine(1, filepath.Join(root, "data"), filepath.Join(root, "wal"), opt).(*tsm1.Engine)
+
+	// mock the planner so only delete compactions run during the test
+	e.CompactionPlan = &mockPlanner{}
+
+	if err := e.Open(); err != nil {
+		t.Fatalf("failed to open tsm1 engine: %s", err.Error())
+	}
+	defer e.Close()
+
+	if err := e.WritePoints([]models.Point{
+		MustParsePointString("cpu,host=A value=1.1 1000000000"),
+		MustParsePointString("cpu,host=B value=1.2 2000000000"),
+		MustParsePointString("cpu,host=C value=1.3 3000000000"),
+	}); err != nil {
+		t.Fatalf("failed to write points: %s", err.Error())
+	}
+	if err := e.WriteSnapshot(); err != nil {
+		t.Fatalf("failed to snapshot: %s", err.Error())
+	}
+
+	deleteCompactions := func() int64 {
+		return e.Statistics(nil)[0].Values["tsmDeleteCompactions"].(int64)
+	}
+
+	// Deleting fewer keys than the threshold leaves the tombstone in place.
+	if err := e.DeleteSeries([]string{"cpu,host=A"}); err != nil {
+		t.Fatalf("failed to delete series: %v", err)
+	}
+	time.Sleep(1500 * time.Millisecond)
+	if n := deleteCompactions(); n != 0 {
+		t.Fatalf("unexpected delete compactions: %d", n)
+	} else if stats := e.FileStore.Stats(); len(stats) != 1 || !stats[0].HasTombstone {
+		t.Fatalf("unexpected files: %v", stats)
+	}
+
+	// A large delete compacts the files and applies all of the tombstones.
+	if err := e.DeleteSeries([]string{"cpu,host=B", "cpu,host=C"}); err != nil {
+		t.Fatalf("failed to delete series: %v", err)
+	}
+	for i := 0; deleteCompactions() == 0; i++ {
+		if i == 50 {
+			t.Fatal("timed out waiting for delete compaction")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	for _, st := range e.FileStore.Stats() {
+		if st.HasTombstone {
+			t.Fatalf("unexpected tombstone: %s", st.Path)
+		}
+	}
+	if keys := e.FileStore.Keys(); len(keys) != 0 {
+		t.Fatalf("unexpected keys: %v", keys)
+	}
+}
+
+// Ensure the compression ratio covers the files written by compactions as
+// well as snapshots.
+func TestEngine_Statistics_CompressionRatio(t *testing.T) {
+	root, err := ioutil.TempDir("", "tsm1-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	e := tsm1.NewEngine(1, filepath.Join(root, "data"), filepath.Join(root, "wal"), tsdb.NewEngineOptions()).(*tsm1.Engine)
+
+	// mock the planner so compactions only run when requested
+	e.CompactionPlan = &mockPlanner{}
+
+	if err := e.Open(); err != nil {
+		t.Fatalf("failed to open tsm1 engine: %s", err.Error())
+	}
+	defer e.Close()
+
+	for _, p := range []string{
+		`cpu,host=A value=1.1,status="ok" 1000000000`,
+		`cpu,host=A value=1.2,status="ok" 2000000000`,
+	} {
+		if err := e.WritePoints([]models.Point{MustParsePointString(p)}); err != nil {
+			t.Fatalf("failed to write points: %s", err.Error())
+		}
+		if err := e.WriteSnapshot(); err != nil {
+			t.Fatalf("failed to snapshot: %s", err.Error())
+		}
+	}
+
+	stats := func() (int64, int64, float64) {
+		values := e.Statistics(nil)[0].Values
+		return values["compactedRawBytes"].(int64), values["compactedDiskBytes"].(int64), values["compressionRatio"].(float64)
+	}
+
+	// Each snapshot writes a float value of 16 bytes and a string value of 10 bytes.
+	raw, disk, ratio := stats()
+	if raw != 52 {
+		t.Fatalf("unexpected raw bytes after snapshots: %d", raw)
+	} else if disk == 0 {
+		t.Fatal("expected disk bytes after snapshots")
+	} else if exp := float64(raw) / float64(disk); ratio != exp {
+		t.Fatalf("unexpected compression ratio: got %v, exp %v", ratio, exp)
+	}
+
+	if err := e.Precompact(); err != nil {
+		t.Fatalf("failed to precompact: %s", err.Error())
+	}
+
+	raw2, disk2, ratio2 := stats()
+	if raw2 != raw+52 {
+		t.Fatalf("unexpected raw bytes after compaction: %d", raw2)
+	} else if disk2 <= disk {
+		t.Fatalf("unexpected disk bytes after compaction: got %d, had %d", disk2, disk)
+	} else if exp := float64(raw2) / float64(disk2); ratio2 != exp {
+		t.Fatalf("unexpected compression ratio: got %v, exp %v", ratio2, exp)
+	}
+}
+
+// Ensure the indexes are warmed when an idle engine is written to again.
+func TestEngine_WarmOnPromotion(t *testing.T) {
+	root, err := ioutil.TempDir("", "tsm1-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	opt := tsdb.NewEngineOptions()
+	opt.Config.WarmOnPromotion = true
+	opt.Config.CacheSnapshotWriteColdDuration = toml.Duration(100 * time.Millisecond)
+	e := tsm1.NewEngine(1, filepath.Join(root, "data"), filepath.Join(root, "wal"), opt).(*tsm1.Engine)
+	e.CompactionPlan = &mockPlanner{}
+
+	if err := e.Open(); err != nil {
+		t.Fatalf("failed to open tsm1 engine: %s", err.Error())
+	}
+	defer e.Close()
+
+	warms := func() int64 {
+		return e.Statistics(nil)[0].Values["promotionWarms"].(int64)
+	}
+
+	// There is nothing to warm before the first snapshot.
+	if err := e.WritePoints([]models.Point{MustParsePointString("cpu,host=A value=1.1 1000000000")}); err != nil {
+		t.Fatalf("failed to write points: %s", err.Error())
+	}
+	if err := e.WriteSnapshot(); err != nil {
+		t.Fatalf("failed to snapshot: %s", err.Error())
+	} else if n := warms(); n != 0 {
+		t.Fatalf("unexpected warms: %d", n)
+	}
+
+	// The first write after the engine goes cold warms the indexes.
+	time.Sleep(200 * time.Millisecond)
+	if err := e.WritePoints([]models.Point{MustParsePointString("cpu,host=A value=1.2 2000000000")}); err != nil {
+		t.Fatalf("failed to write points: %s", err.Error())
+	} else if n := warms(); n != 1 {
+		t.Fatalf("unexpected warms: %d", n)
+	}
+
+	// Writes while the engine is hot don't.
+	if err := e.WritePoints([]models.Point{MustParsePointString("cpu,host=A value=1.3 3000000000")}); err != nil {
+		t.Fatalf("failed to write points: %s", err.Error())
+	} else if n := warms(); n != 1 {
+		t.Fatalf("unexpected warms: %d", n)
+	}
+}
+
+// Ensure temp files left by an interrupted TSM write are removed on open.
+func TestEngine_Open_RemoveTempFiles(t *testing.T) {
+	root, err := ioutil.TempDir("", "tsm1-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	dir := filepath.Join(root, "data")
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		t.Fatal(err)
+	}
+	tmp := filepath.Join(dir, "000000001-000000001.tsm.tmp")
+	if err := ioutil.WriteFile(tmp, []byte{0x16, 0xd1, 0x16}, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	e := tsm1.NewEngine(1, dir, filepath.Join(root, "wal"), tsdb.NewEngineOptions()).(*tsm1.Engine)
+	if err := e.Open(); err != nil {
+		t.Fatalf("failed to open tsm1 engine: %s", err.Error())
+	}
+	defer e.Close()
+
+	if _, err := os.Stat(tmp); !os.IsNotExist(err) {
+		t.Fatalf("expected temp file to be removed: %v", err)
+	}
+	if got := e.Statistics(nil)[0].Values["tempFilesRemoved"]; got != int64(1) {
+		t.Fatalf("unexpected temp files removed: %v", got)
+	}
+}
+
+// Ensure TSM files that were partially written when the server stopped are
+// moved aside when the engine is opened with TSMRecoverOnOpen.
+func TestEngine_Open_RecoverTSMFiles(t *testing.T) {
+	root, err := ioutil.TempDir("", "tsm1-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	dir, walDir := filepath.Join(root, "data"), filepath.Join(root, "wal")
+	opt := tsdb.NewEngineOptions()
+	e := tsm1.NewEngine(1, dir, walDir, opt).(*tsm1.Engine)
+	e.CompactionPlan = &mockPlanner{}
+	if err := e.Open(); err != nil {
+		t.Fatalf("failed to open tsm1 engine: %s", err.Error())
+	}
+
+	// Write three generations of TSM files.
+	for i := 1; i <= 3; i++ {
+		p := MustParsePointString(fmt.Sprintf("cpu,host=A value=%d.1 %d000000000", i, i))
+		if err := e.WritePoints([]models.Point{p}); err != nil {
+			t.Fatalf("failed to write points: %s", err.Error())
+		}
+		if err := e.WriteSnapshot(); err != nil {
+			t.Fatalf("failed to snapshot: %s", err.Error())
+		}
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.tsm"))
+	if err != nil {
+		t.Fatal(err)
+	} else if len(files) != 3 {
+		t.Fatalf("unexpected files: %v", files)
+	}
+
+	// Flip a byte in the block of the second file and truncate the last
+	// file, as if the server crashed while they were being written.
+	b, err := ioutil.ReadFile(files[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	b[10] ^= 0xff
+	if err := ioutil.WriteFile(files[1], b, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(files[2], 8); err != nil {
+		t.Fatal(err)
+	}
+
+	// The shard fails to open without recovery.
+	e = tsm1.NewEngine(1, dir, walDir, opt).(*tsm1.Engine)
+	e.CompactionPlan = &mockPlanner{}
+	if err := e.Open(); err == nil {
+		t.Fatal("expected error opening engine")
+	}
+	e.Close()
+
+	opt.Config.TSMRecoverOnOpen = true
+	e = tsm1.NewEngine(1, dir, walDir, opt).(*tsm1.Engine)
+	e.CompactionPlan = &mockPlanner{}
+	if err := e.Open(); err != nil {
+		t.Fatalf("failed to open tsm1 engine: %s", err.Error())
+	}
+	defer e.Close()
+
+	if got, exp := e.FileStore.Count(), 1; got != exp {
+		t.Fatalf("file count mismatch: got %v, exp %v", got, exp)
+	}
+	if got := e.FileStore.Statistics(nil)[0].Values["recoveredFiles"]; got != int64(2) {
+		t.Fatalf("unexpected recovered files: %v", got)
+	}
+	for _, f := range files[1:] {
+		if _, err := os.Stat(filepath.Join(dir, "corrupt", filepath.Base(f))); err != nil {
+			t.Fatalf("expected file in corrupt directory: %v", err)
+		}
+	}
+}
+
+// Ensure engine can migrate a field to a new type across TSM files and the cache.
+func TestEngine_MigrateFieldType(t *testing.T) {
+	t.Parallel()
+
+	e := MustOpenEngine()
+	defer e.Close()
+
+	e.Index().CreateMeasurementIndexIfNotExists("cpu")
+	e.MeasurementFields("cpu").CreateFieldIfNotExists("value", influxql.Integer, false)
+	si := e.Index().CreateSeriesIndexIfNotExists("cpu", tsdb.NewSeries("cpu,host=A", models.NewTags(map[string]string{"host": "A"})), false)
+	si.AssignShard(1)
+
+	if err := e.WritePointsString(
+		`cpu,host=A value=1i 1000000000`,
+		`cpu,host=A value=2i 2000000000`,
+	); err != nil {
+		t.Fatalf("failed to write points: %s", err.Error())
+	}
+	e.MustWriteSnapshot()
+
+	if err := e.WritePointsString(`cpu,host=A value=3i 3000000000`); err != nil {
+		t.Fatalf("failed to write points: %s", err.Error())
+	}
+
+	migrated, dropped, err := e.MigrateFieldType("cpu", "value", influxql.Float)
+	if err != nil {
+		t.Fatal(err)
+	} else if migrated != 3 || dropped != 0 {
+		t.Fatalf("unexpected counts: migrated=%d dropped=%d", migrated, dropped)
+	}
+
+	if typ := e.MeasurementFields("cpu").Field("value").Type; typ != influxql.Float {
+		t.Fatalf("unexpected field type: %s", typ)
+	} else if typ, err := e.FileStore.Type("cpu,host=A#!~#value"); err != nil {
+		t.Fatal(err)
+	} else if typ != tsm1.BlockFloat64 {
+		t.Fatalf("unexpected block type: %d", typ)
+	}
+
+	itr, err := e.CreateIterator("cpu", influxql.IteratorOptions{
+		Expr:       influxql.MustParseExpr(`value`),
+		Dimensions: []string{"host"},
+		StartTime:  influxql.MinTime,
+		EndTime:    influxql.MaxTime,
+		Ascending:  true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fitr := itr.(influxql.FloatIterator)
+
+	for i, v := range []float64{1, 2, 3} {
+		if p, err := fitr.Next(); err != nil {
+			t.Fatalf("unexpected error(%d): %v", i, err)
+		} else if !reflect.DeepEqual(p, &influxql.FloatPoint{Name: "cpu", Tags: ParseTags("host=A"), Time: int64(i+1) * 1000000000, Value: v}) {
+			t.Fatalf("unexpected point(%d): %v", i, p)
+		}
+	}
+	if p, err := fitr.Next(); err != nil {
+		t.Fatalf("expected eof, got error: %v", err)
+	} else if p != nil {
+		t.Fatalf("expected eof: %v", p)
+	}
+}
+
+// Ensure series deleted while a field is being migrated are not brought back
+// by the migrated files.
+func TestEngine_MigrateFieldType_ConcurrentDelete(t *testing.T) {
+	t.Parallel()
+
+	e := MustOpenEngine()
+	defer e.Close()
+
+	e.Index().CreateMeasurementIndexIfNotExists("cpu")
+	e.MeasurementFields("cpu").CreateFieldIfNotExists("value", influxql.Integer, false)
+	for _, host := range []string{"A", "B"} {
+		si := e.Index().CreateSeriesIndexIfNotExists("cpu", tsdb.NewSeries("cpu,host="+host, models.NewTags(map[string]string{"host": host})), false)
+		si.AssignShard(1)
+	}
+
+	for i := 0; i < 4; i++ {
+		var points []string
+		for j := 0; j < 1000; j++ {
+			ts := (i*1000 + j + 1) * 1000000000
+			points = append(points,
+				fmt.Sprintf("cpu,host=A value=%di %d", j, ts),
+				fmt.Sprintf("cpu,host=B value=%di %d", j, ts),
+			)
+		}
+		if err := e.WritePointsString(points...); err != nil {
+			t.Fatalf("failed to write points: %s", err.Error())
+		}
+		e.MustWriteSnapshot()
+	}
+
+	errC := make(chan error, 1)
+	go func() {
+		_, _, err := e.MigrateFieldType("cpu", "value", influxql.Float)
+		errC <- err
+	}()
+	if err := e.DeleteSeries([]string{"cpu,host=B"}); err != nil {
+		t.Fatalf("failed to delete series: %v", err)
+	}
+	if err := <-errC; err != nil {
+		t.Fatal(err)
+	}
+
+	itr, err := e.CreateIterator("cpu", influxql.IteratorOptions{
+		Expr:       influxql.MustParseExpr(`value`),
+		Dimensions: []string{"host"},
+		StartTime:  influxql.MinTime,
+		EndTime:    influxql.MaxTime,
+		Ascending:  true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fitr := itr.(influxql.FloatIterator)
+
+	var n int
+	for {
+		p, err := fitr.Next()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		} else if p == nil {
+			break
+		} else if host := p.Tags.KeyValues()["host"]; host != "A" {
+			t.Fatalf("unexpected point for deleted series: %v", p)
+		}
+		n++
+	}
+	if n != 4000 {
+		t.Fatalf("unexpected point count: %d", n)
+	}
+}
+
+// Ensure engine can rewrite its TSM files so the blocks of each key are contiguous.
+func TestEngine_Defragment(t *testing.T) {
+	t.Parallel()
+
+	e := MustOpenEngine()
+	defer e.Close()
+
+	e.Index().CreateMeasurementIndexIfNotExists("cpu")
+	e.MeasurementFields("cpu").CreateFieldIfNotExists("value", influxql.Float, false)
+	for _, host := range []string{"A", "B"} {
+		si := e.Index().CreateSeriesIndexIfNotExists("cpu", tsdb.NewSeries("cpu,host="+host, models.NewTags(map[string]string{"host": host})), false)
+		si.AssignShard(1)
+	}
+
+	// Scatter both series across two files.
+	for i := 1; i <= 2; i++ {
+		if err := e.WritePointsString(
+			fmt.Sprintf(`cpu,host=A value=%d.1 %d000000000`, i, i),
+			fmt.Sprintf(`cpu,host=B value=%d.2 %d000000000`, i, i),
+		); err != nil {
+			t.Fatalf("failed to write points: %s", err.Error())
+		}
+		e.MustWriteSnapshot()
+	}
+
+	before, after, err := e.Defragment()
+	if err != nil {
+		t.Fatal(err)
+	} else if exp := (tsdb.Fragmentation{Files: 2, Keys: 2, Blocks: 4, Fragments: 4}); before != exp {
+		t.Fatalf("unexpected fragmentation before: got %+v, exp %+v", before, exp)
+	} else if exp := (tsdb.Fragmentation{Files: 1, Keys: 2, Blocks: 2, Fragments: 2}); after != exp {
+		t.Fatalf("unexpected fragmentation after: got %+v, exp %+v", after, exp)
+	} else if after.FilesPerKey() != 1 || after.BlocksPerKey() != 1 {
+		t.Fatalf("unexpected ratios after: %v files and %v blocks per key", after.FilesPerKey(), after.BlocksPerKey())
+	}
+
+	// Each key holds the values of both files in a single block.
+	f := e.FileStore.Files()[0]
+	for _, key := range []string{"cpu,host=A#!~#value", "cpu,host=B#!~#value"} {
+		if values, err := f.Read(key, 1000000000); err != nil {
+			t.Fatal(err)
+		} else if len(values) != 2 {
+			t.Fatalf("unexpected values for %s: %v", key, values)
+		}
+	}
+
+	// Contiguous files are left as they are.
+	if _, again, err := e.Defragment(); err != nil {
+		t.Fatal(err)
+	} else if again != after {
+		t.Fatalf("unexpected fragmentation: got %+v, exp %+v", again, after)
+	}
+}
+
+// Ensure engine can find and quarantine TSM files with corrupt blocks.
+func TestEngine_Verify(t *testing.T) {
+	t.Parallel()
+
+	e := MustOpenEngine()
+	defer e.Close()
+
+	e.Index().CreateMeasurementIndexIfNotExists("cpu")
+	e.MeasurementFields("cpu").CreateFieldIfNotExists("value", influxql.Float, false)
+	si := e.Index().CreateSeriesIndexIfNotExists("cpu", tsdb.NewSeries("cpu,host=A", models.NewTags(map[string]string{"host": "A"})), false)
+	si.AssignShard(1)
+
+	if err := e.WritePointsString(
+		`cpu,host=A value=1.1 1000000000`,
+		`cpu,host=A value=1.2 2000000000`,
+	); err != nil {
+		t.Fatalf("failed to write points: %s", err.Error())
+	}
+	e.MustWriteSnapshot()
+
+	var read int
+	wait := func(n int) error {
+		read += n
+		return nil
+	}
+
+	stats, err := e.Verify(wait, true)
+	if err != nil {
+		t.Fatal(err)
+	} else if stats.Files != 1 || stats.Blocks != 1 || stats.CorruptBlocks != 0 || len(stats.CorruptFiles) != 0 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	} else if int64(read) != stats.Bytes {
+		t.Fatalf("unexpected bytes waited for: got %d, exp %d", read, stats.Bytes)
+	}
+
+	// Flip the bits of the first byte of the block, after the file header and
+	// the block checksum.
+	path := e.FileStore.Files()[0].Path()
+	f, err := os.OpenFile(path, os.O_RDWR, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 1)
+	if _, err := f.ReadAt(b, 9); err != nil {
+		t.Fatal(err)
+	}
+	b[0] ^= 0xff
+	if _, err := f.WriteAt(b, 9); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	stats, err = e.Verify(wait, true)
+	if err != nil {
+		t.Fatal(err)
+	} else if stats.CorruptBlocks != 1 {
+		t.Fatalf("unexpected corrupt blocks: %d", stats.CorruptBlocks)
+	} else if exp := []string{path}; !reflect.DeepEqual(stats.CorruptFiles, exp) {
+		t.Fatalf("unexpected corrupt files: got %v, exp %v", stats.CorruptFiles, exp)
+	} else if !reflect.DeepEqual(stats.QuarantinedFiles, exp) {
+		t.Fatalf("unexpected quarantined files: got %v, exp %v", stats.QuarantinedFiles, exp)
+	}
+
+	if n := len(e.FileStore.Files()); n != 0 {
+		t.Fatalf("unexpected file count: %d", n)
+	} else if _, err := os.Stat(filepath.Join(filepath.Dir(path), "corrupt", filepath.Base(path))); err != nil {
+		t.Fatalf("corrupt file not kept: %s", err)
+	}
+}
+
 func TestEngine_LastModified(t *testing.T) {
 	// Generate temporary file.
 	dir, _ := ioutil.TempDir("", "tsm")
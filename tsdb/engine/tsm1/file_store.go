@@ -14,6 +14,7 @@ import (
 	"time"
 
 	"github.com/lucaswiersma/influxdb/models"
+	"github.com/lucaswiersma/influxdb/tsdb"
 	"go.uber.org/zap"
 )
 
@@ -84,6 +85,12 @@ type TSMFile interface {
 	// Size returns the size of the file on disk in bytes.
 	Size() uint32
 
+	// IndexSize returns the size of the index in bytes.
+	IndexSize() uint32
+
+	// IndexInMemory returns true if the index is held on the heap.
+	IndexInMemory() bool
+
 	// Rename renames the existing TSM file to a new name and replaces the mmap backing slice using the new
 	// file name.  Index and Reader state are not re-initialized.
 	Rename(path string) error
@@ -117,8 +124,12 @@ type dereferencer interface {
 
 // Statistics gathered by the FileStore.
 const (
-	statFileStoreBytes = "diskBytes"
-	statFileStoreCount = "numFiles"
+	statFileStoreBytes         = "diskBytes"
+	statFileStoreCount         = "numFiles"
+	statFileStoreIndexBytes    = "indexBytes"
+	statFileStoreIndexMemBytes = "indexMemBytes"
+	statFileStoreRetainedBytes = "retainedBytes"
+	statFileStoreRecovered     = "recoveredFiles"
 )
 
 // FileStore is an abstraction around multiple TSM files.
@@ -144,6 +155,22 @@ type FileStore struct {
 	currentTempDirID int
 
 	dereferencer dereferencer
+
+	// indexInMemory loads the index of each TSM file onto the heap instead
+	// of reading it through the mmap.
+	indexInMemory bool
+
+	// recoverOnOpen moves TSM files that cannot be opened, and files of the
+	// newest generation with corrupt blocks, to the corrupt directory when
+	// the file store is opened instead of failing to open.
+	recoverOnOpen bool
+
+	// retainDuration is how long TSM files replaced by compactions are kept
+	// in the retained directory. Replaced files are removed right away when
+	// it is 0. The retained files are also bounded by retainMaxSize bytes.
+	retainDuration time.Duration
+	retainMaxSize  int64
+	retainMu       sync.Mutex
 }
 
 // FileStat holds information about a TSM file on disk.
@@ -207,20 +234,44 @@ func (f *FileStore) WithLogger(log zap.Logger) {
 	}
 }
 
+// RetainReplacedFiles keeps the TSM files replaced by Replace in the retained
+// directory for d instead of removing them, up to maxSize bytes. It must be
+// called before the file store is opened.
+func (f *FileStore) RetainReplacedFiles(d time.Duration, maxSize int64) {
+	f.retainDuration = d
+	f.retainMaxSize = maxSize
+}
+
 // FileStoreStatistics keeps statistics about the file store.
 type FileStoreStatistics struct {
-	DiskBytes int64
-	FileCount int64
+	DiskBytes     int64
+	FileCount     int64
+	RetainedBytes int64
+	Recovered     int64
 }
 
 // Statistics returns statistics for periodic monitoring.
 func (f *FileStore) Statistics(tags map[string]string) []models.Statistic {
+	var indexBytes, indexMemBytes int64
+	f.mu.RLock()
+	for _, file := range f.files {
+		indexBytes += int64(file.IndexSize())
+		if file.IndexInMemory() {
+			indexMemBytes += int64(file.IndexSize())
+		}
+	}
+	f.mu.RUnlock()
+
 	return []models.Statistic{{
 		Name: "tsm1_filestore",
 		Tags: tags,
 		Values: map[string]interface{}{
-			statFileStoreBytes: atomic.LoadInt64(&f.stats.DiskBytes),
-			statFileStoreCount: atomic.LoadInt64(&f.stats.FileCount),
+			statFileStoreBytes:         atomic.LoadInt64(&f.stats.DiskBytes),
+			statFileStoreCount:         atomic.LoadInt64(&f.stats.FileCount),
+			statFileStoreIndexBytes:    indexBytes,
+			statFileStoreIndexMemBytes: indexMemBytes,
+			statFileStoreRetainedBytes: atomic.LoadInt64(&f.stats.RetainedBytes),
+			statFileStoreRecovered:     atomic.LoadInt64(&f.stats.Recovered),
 		},
 	}}
 }
@@ -239,6 +290,20 @@ func (f *FileStore) Files() []TSMFile {
 	return f.files
 }
 
+// acquire returns the TSM files of the store, marked as in use so they are
+// not closed until each is released with Unref.
+func (f *FileStore) acquire() []TSMFile {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	files := make([]TSMFile, len(f.files))
+	copy(files, f.files)
+	for _, file := range files {
+		file.Ref()
+	}
+	return files
+}
+
 // CurrentGeneration returns the current generation of the TSM files.
 func (f *FileStore) CurrentGeneration() int {
 	f.mu.RLock()
@@ -392,8 +457,9 @@ func (f *FileStore) Open() error {
 
 	// struct to hold the result of opening each reader in a goroutine
 	type res struct {
-		r   *TSMReader
-		err error
+		r    *TSMReader
+		path string
+		err  error
 	}
 
 	readerC := make(chan *res)
@@ -424,29 +490,51 @@ func (f *FileStore) Open() error {
 
 		go func(idx int, file *os.File) {
 			start := time.Now()
-			df, err := NewTSMReader(file)
+			df, err := NewTSMReader(file, WithIndexInMemory(f.indexInMemory))
 			f.logger.Info(fmt.Sprintf("%s (#%d) opened in %v", file.Name(), idx, time.Since(start)))
 
 			if err != nil {
-				readerC <- &res{r: df, err: fmt.Errorf("error opening memory map for file %s: %v", file.Name(), err)}
+				file.Close()
+				readerC <- &res{r: df, path: file.Name(), err: fmt.Errorf("error opening memory map for file %s: %v", file.Name(), err)}
 				return
 			}
 			readerC <- &res{r: df}
 		}(i, file)
 	}
 
+	var failed []string
 	for range files {
 		res := <-readerC
 		if res.err != nil {
-
-			return res.err
+			if !f.recoverOnOpen {
+				return res.err
+			}
+			f.logger.Info(res.err.Error())
+			failed = append(failed, res.path)
+			continue
 		}
 		f.files = append(f.files, res.r)
 	}
 	close(readerC)
 
+	for _, path := range failed {
+		if err := f.moveCorrupt(path); err != nil {
+			return err
+		}
+	}
+
 	sort.Sort(tsmReaders(f.files))
+
+	if f.recoverOnOpen {
+		if err := f.verifyNewestGeneration(); err != nil {
+			return err
+		}
+	}
 	atomic.StoreInt64(&f.stats.FileCount, int64(len(f.files)))
+
+	// Expire files retained before the restart, or remove them all if files
+	// are no longer retained.
+	f.pruneRetained()
 	return nil
 }
 
@@ -493,6 +581,26 @@ func (f *FileStore) Read(key string, t int64) ([]Value, error) {
 	return nil, nil
 }
 
+// MaxTime returns the newest time of the blocks of key across the files, or
+// false if no file contains key.
+func (f *FileStore) MaxTime(key string) (int64, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	var max int64
+	var ok bool
+	var entries []IndexEntry
+	for _, fd := range f.files {
+		fd.ReadEntries(key, &entries)
+		for _, ie := range entries {
+			if !ok || ie.MaxTime > max {
+				max, ok = ie.MaxTime, true
+			}
+		}
+	}
+	return max, ok
+}
+
 // KeyCursor returns a KeyCursor for key and t across the files in the FileStore.
 func (f *FileStore) KeyCursor(key string, t int64, ascending bool) *KeyCursor {
 	f.mu.RLock()
@@ -561,7 +669,7 @@ func (f *FileStore) Replace(oldFiles, newFiles []string) error {
 			}
 		}
 
-		tsm, err := NewTSMReader(fd)
+		tsm, err := NewTSMReader(fd, WithIndexInMemory(f.indexInMemory))
 		if err != nil {
 			return err
 		}
@@ -578,6 +686,20 @@ func (f *FileStore) Replace(oldFiles, newFiles []string) error {
 
 	updated = append(updated, f.files...)
 
+	// Keep the replaced files for debugging before they are removed.
+	if f.retainDuration > 0 {
+		var retired []TSMFile
+		for _, file := range updated {
+			for _, remove := range oldFiles {
+				if remove == file.Path() {
+					retired = append(retired, file)
+					break
+				}
+			}
+		}
+		f.retain(retired)
+	}
+
 	// We need to prune our set of active files now
 	var active, inuse []TSMFile
 	for _, file := range updated {
@@ -1240,3 +1362,203 @@ type tsmReaders []TSMFile
 func (a tsmReaders) Len() int           { return len(a) }
 func (a tsmReaders) Less(i, j int) bool { return a[i].Path() < a[j].Path() }
 func (a tsmReaders) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+
+// retainedDir is the directory of a shard holding the TSM files replaced by
+// compactions while they are retained. Each replacement is kept in a
+// directory named after the time, in unix nanoseconds, it happened.
+const retainedDir = "retained"
+
+// corruptDir is the directory of a shard holding the TSM files, and their
+// tombstones, that were removed from the store because they are corrupt.
+const corruptDir = "corrupt"
+
+// Quarantine removes a corrupt TSM file from the store. The file and its
+// tombstones are hard linked into the corrupt directory first so they can
+// be inspected or repaired.
+func (f *FileStore) Quarantine(path string) error {
+	var file TSMFile
+	for _, tf := range f.Files() {
+		if tf.Path() == path {
+			file = tf
+			break
+		}
+	}
+	if file == nil {
+		return fmt.Errorf("quarantine %s: file not found", path)
+	}
+
+	dir := filepath.Join(f.dir, corruptDir)
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+
+	paths := []string{path}
+	for _, t := range file.TombstoneFiles() {
+		paths = append(paths, t.Path)
+	}
+	for _, p := range paths {
+		if err := os.Link(p, filepath.Join(dir, filepath.Base(p))); err != nil && !os.IsExist(err) {
+			return err
+		}
+	}
+
+	return f.Replace([]string{path}, nil)
+}
+
+// verifyNewestGeneration checks the blocks of the files of the newest
+// generation, which may have been partially written if the server crashed,
+// and moves the files with corrupt blocks to the corrupt directory. It must
+// be called while opening the file store.
+func (f *FileStore) verifyNewestGeneration() error {
+	if len(f.files) == 0 {
+		return nil
+	}
+
+	newest, _, err := ParseTSMFileName(f.files[len(f.files)-1].Path())
+	if err != nil {
+		return err
+	}
+
+	files := f.files[:0]
+	for _, file := range f.files {
+		if generation, _, _ := ParseTSMFileName(file.Path()); generation != newest {
+			files = append(files, file)
+			continue
+		}
+
+		corrupt, _ := verifyFile(file, func(int) error { return nil }, &tsdb.VerifyStats{})
+		if corrupt == 0 {
+			files = append(files, file)
+			continue
+		}
+
+		f.logger.Info(fmt.Sprintf("%s has %d corrupt blocks", file.Path(), corrupt))
+		if err := file.Close(); err != nil {
+			return err
+		}
+		if err := f.moveCorrupt(file.Path()); err != nil {
+			return err
+		}
+	}
+	f.files = files
+	return nil
+}
+
+// moveCorrupt moves the TSM file at path, and its tombstone, to the corrupt
+// directory so the file store can open without it.
+func (f *FileStore) moveCorrupt(path string) error {
+	dir := filepath.Join(f.dir, corruptDir)
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+
+	if fi, err := os.Stat(path); err == nil {
+		atomic.AddInt64(&f.stats.DiskBytes, -fi.Size())
+	}
+
+	paths := []string{path, (&Tombstoner{Path: path}).tombstonePath()}
+	for _, p := range paths {
+		if err := os.Rename(p, filepath.Join(dir, filepath.Base(p))); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	atomic.AddInt64(&f.stats.Recovered, 1)
+	f.logger.Info(fmt.Sprintf("moved %s to %s", path, dir))
+	return nil
+}
+
+// retainedPruneInterval is how often retained files are expired when the
+// shard is not being compacted.
+const retainedPruneInterval = time.Minute
+
+// retain hard links the replaced files, and their tombstones, into a new
+// retained directory so they can be recovered after they are removed. Errors
+// are logged rather than failing the replacement.
+func (f *FileStore) retain(files []TSMFile) {
+	if len(files) == 0 {
+		return
+	}
+
+	dir := filepath.Join(f.dir, retainedDir, strconv.FormatInt(time.Now().UnixNano(), 10))
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		f.logger.Info(fmt.Sprintf("error retaining replaced TSM files: %v", err))
+		return
+	}
+
+	for _, file := range files {
+		paths := []string{file.Path()}
+		for _, t := range file.TombstoneFiles() {
+			paths = append(paths, t.Path)
+		}
+		for _, path := range paths {
+			if err := os.Link(path, filepath.Join(dir, filepath.Base(path))); err != nil {
+				f.logger.Info(fmt.Sprintf("error retaining replaced TSM file: %v", err))
+			}
+		}
+	}
+	f.logger.Info(fmt.Sprintf("retained %d replaced TSM files in %s", len(files), dir))
+
+	f.pruneRetained()
+}
+
+// pruneRetained removes retained files older than the retain duration, then
+// the oldest retained files until the rest fit in the retain max size, and
+// updates the retained bytes statistic.
+func (f *FileStore) pruneRetained() {
+	f.retainMu.Lock()
+	defer f.retainMu.Unlock()
+
+	root := filepath.Join(f.dir, retainedDir)
+	fis, err := ioutil.ReadDir(root)
+	if os.IsNotExist(err) {
+		atomic.StoreInt64(&f.stats.RetainedBytes, 0)
+		return
+	} else if err != nil {
+		f.logger.Info(fmt.Sprintf("error reading retained TSM files: %v", err))
+		return
+	}
+
+	type retained struct {
+		path string
+		at   time.Time
+		size int64
+	}
+
+	// Directories are named after their time so they are read oldest first.
+	var dirs []retained
+	var total int64
+	for _, fi := range fis {
+		ns, err := strconv.ParseInt(fi.Name(), 10, 64)
+		if err != nil || !fi.IsDir() {
+			continue
+		}
+
+		r := retained{path: filepath.Join(root, fi.Name()), at: time.Unix(0, ns)}
+		filepath.Walk(r.path, func(_ string, fi os.FileInfo, err error) error {
+			if err == nil && !fi.IsDir() {
+				r.size += fi.Size()
+			}
+			return nil
+		})
+		dirs = append(dirs, r)
+		total += r.size
+	}
+
+	expired := time.Now().Add(-f.retainDuration)
+	for _, r := range dirs {
+		if f.retainDuration > 0 && r.at.After(expired) && (f.retainMaxSize <= 0 || total <= f.retainMaxSize) {
+			break
+		}
+		if err := os.RemoveAll(r.path); err != nil {
+			f.logger.Info(fmt.Sprintf("error removing retained TSM files: %v", err))
+			continue
+		}
+		total -= r.size
+	}
+
+	if f.retainDuration <= 0 && total == 0 {
+		os.Remove(root)
+	}
+	atomic.StoreInt64(&f.stats.RetainedBytes, total)
+}
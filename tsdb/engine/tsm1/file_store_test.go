@@ -2044,6 +2044,78 @@ func TestFileStore_Remove(t *testing.T) {
 	}
 }
 
+// Tests that replaced files are retained when configured.
+func TestFileStore_Replace_Retain(t *testing.T) {
+	dir := MustTempDir()
+	defer os.RemoveAll(dir)
+
+	data := []keyValues{
+		keyValues{"cpu", []tsm1.Value{tsm1.NewValue(0, 1.0)}},
+		keyValues{"cpu", []tsm1.Value{tsm1.NewValue(1, 2.0)}},
+		keyValues{"cpu", []tsm1.Value{tsm1.NewValue(2, 3.0)}},
+	}
+
+	files, err := newFileDir(dir, data...)
+	if err != nil {
+		fatal(t, "creating test files", err)
+	}
+
+	replacement := files[2] + ".tmp"
+	os.Rename(files[2], replacement)
+
+	fs := tsm1.NewFileStore(dir)
+	fs.RetainReplacedFiles(time.Hour, 1024*1024)
+	if err := fs.Open(); err != nil {
+		fatal(t, "opening file store", err)
+	}
+	defer fs.Close()
+
+	if err := fs.Replace(files[:2], []string{replacement}); err != nil {
+		t.Fatalf("replace: %v", err)
+	}
+
+	// The replaced files are removed from the shard but kept in the retained directory.
+	retained, err := filepath.Glob(filepath.Join(dir, "retained", "*", "*.tsm"))
+	if err != nil {
+		t.Fatal(err)
+	} else if len(retained) != 2 {
+		t.Fatalf("unexpected retained files: %v", retained)
+	}
+	for i, path := range retained {
+		if got, exp := filepath.Base(path), filepath.Base(files[i]); got != exp {
+			t.Fatalf("retained file mismatch: got %v, exp %v", got, exp)
+		} else if _, err := os.Stat(files[i]); !os.IsNotExist(err) {
+			t.Fatalf("expected replaced file to be removed: %v", err)
+		}
+	}
+
+	var size int64
+	for _, path := range retained {
+		fi, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		size += fi.Size()
+	}
+	if got := fs.Statistics(nil)[0].Values["retainedBytes"]; got != size {
+		t.Fatalf("retained bytes mismatch: got %v, exp %v", got, size)
+	}
+
+	// Reopening without retention removes the retained files.
+	fs.Close()
+	fs2 := tsm1.NewFileStore(dir)
+	if err := fs2.Open(); err != nil {
+		fatal(t, "opening file store", err)
+	}
+	defer fs2.Close()
+
+	if _, err := os.Stat(filepath.Join(dir, "retained")); !os.IsNotExist(err) {
+		t.Fatalf("expected retained files to be removed: %v", err)
+	} else if got := fs2.Statistics(nil)[0].Values["retainedBytes"]; got != int64(0) {
+		t.Fatalf("retained bytes mismatch: got %v, exp 0", got)
+	}
+}
+
 func TestFileStore_Replace(t *testing.T) {
 	dir := MustTempDir()
 	defer os.RemoveAll(dir)
@@ -2,8 +2,10 @@ package tsm1
 
 import (
 	"fmt"
+	"strconv"
 
 	"github.com/lucaswiersma/influxdb/influxql"
+	"github.com/lucaswiersma/influxdb/tsdb"
 )
 
 func newLimitIterator(input influxql.Iterator, opt influxql.IteratorOptions) influxql.Iterator {
@@ -34,6 +36,44 @@ func (c *floatCastIntegerCursor) nextFloat() (int64, float64) {
 	return t, float64(v)
 }
 
+// floatCastStringCursor reads strings holding numbers as floats. Strings that
+// do not hold a number are skipped.
+type floatCastStringCursor struct {
+	cursor stringCursor
+}
+
+func (c *floatCastStringCursor) close() error { return c.cursor.close() }
+
+func (c *floatCastStringCursor) next() (t int64, v interface{}) { return c.nextFloat() }
+
+func (c *floatCastStringCursor) nextFloat() (int64, float64) {
+	for {
+		t, v := c.cursor.nextString()
+		if t == tsdb.EOF {
+			return t, 0
+		} else if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return t, f
+		}
+	}
+}
+
+// floatCastBooleanCursor reads booleans as floats, true as 1 and false as 0.
+type floatCastBooleanCursor struct {
+	cursor booleanCursor
+}
+
+func (c *floatCastBooleanCursor) close() error { return c.cursor.close() }
+
+func (c *floatCastBooleanCursor) next() (t int64, v interface{}) { return c.nextFloat() }
+
+func (c *floatCastBooleanCursor) nextFloat() (int64, float64) {
+	t, v := c.cursor.nextBoolean()
+	if v {
+		return t, 1
+	}
+	return t, 0
+}
+
 type integerCastFloatCursor struct {
 	cursor floatCursor
 }
@@ -0,0 +1,423 @@
+package tsm1
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/lucaswiersma/influxdb/influxql"
+	"github.com/lucaswiersma/influxdb/tsdb"
+)
+
+// MigrateFieldType rewrites the stored values of a field to typ and updates
+// the field's type once all of its values have been converted. Values that
+// cannot be represented as typ are dropped. It returns the number of values
+// that were converted and the number that were dropped.
+//
+// The TSM files holding the field are rewritten in the background while
+// queries and writes continue against the existing data. The new files, the
+// converted cache and the new field type are then swapped in together so that
+// iterators always see the field with a single type. Deletes block until the
+// migration completes.
+func (e *Engine) MigrateFieldType(measurement, field string, typ influxql.DataType) (migrated, dropped int64, err error) {
+	// Hold off deletes so no tombstones are written to the files being
+	// rewritten, as the rewritten files would not include them.
+	e.deleteMu.Lock()
+	defer e.deleteMu.Unlock()
+
+	f := e.MeasurementFields(measurement).Field(field)
+	if f == nil || f.Type == typ {
+		return 0, 0, nil
+	}
+
+	start := time.Now()
+	e.logger.Info(fmt.Sprintf("migrating field %s on measurement %s to %s in %s", field, measurement, typ, e.path))
+
+	// Stop level compactions so the set of TSM files only changes through
+	// snapshots while the field is being rewritten.
+	e.disableLevelCompactions(true)
+	defer e.enableLevelCompactions(true)
+
+	keys := e.migrationKeys(measurement, field)
+	oldFiles := e.filesContainingKeys(keys, nil)
+	newFiles, migrated, dropped, err := e.writeMigratedFiles(oldFiles, keys, typ)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// Wait for any running snapshot to finish and hold off new ones so the
+	// cache can be converted without a snapshot writing out the old type.
+	e.disableSnapshotCompactions()
+	defer e.enableSnapshotCompactions()
+
+	// Block writes and the creation of new iterators while swapping in the
+	// migrated data.
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.migrateMu.Lock()
+	defer e.migrateMu.Unlock()
+
+	// Pick up series created, and snapshots written, while the existing files
+	// were being rewritten.
+	keys = e.migrationKeys(measurement, field)
+	snapshotFiles := e.filesContainingKeys(keys, oldFiles)
+	files, n, d, err := e.writeMigratedFiles(snapshotFiles, keys, typ)
+	if err != nil {
+		e.removeTempFiles(newFiles)
+		return 0, 0, err
+	}
+	migrated, dropped = migrated+n, dropped+d
+	newFiles = append(newFiles, files...)
+
+	if err := e.FileStore.Replace(append(oldFiles, snapshotFiles...), newFiles); err != nil {
+		e.removeTempFiles(newFiles)
+		return 0, 0, err
+	}
+
+	n, d, err = e.migrateCacheValues(keys, typ)
+	if err != nil {
+		return 0, 0, err
+	}
+	migrated, dropped = migrated+n, dropped+d
+
+	if err := e.MeasurementFields(measurement).SetFieldType(field, typ); err != nil {
+		return 0, 0, err
+	}
+
+	e.logger.Info(fmt.Sprintf("migrated field %s on measurement %s to %s in %s: %d values converted, %d dropped (%v)",
+		field, measurement, typ, e.path, migrated, dropped, time.Since(start)))
+	return migrated, dropped, nil
+}
+
+// migrationKeys returns the set of series field keys for field on measurement.
+func (e *Engine) migrationKeys(measurement, field string) map[string]struct{} {
+	keys := make(map[string]struct{})
+	if m := e.index.Measurement(measurement); m != nil {
+		for _, seriesKey := range m.SeriesKeys() {
+			keys[SeriesFieldKey(seriesKey, field)] = struct{}{}
+		}
+	}
+	return keys
+}
+
+// filesContainingKeys returns the paths of the TSM files that contain any of
+// keys, excluding the files in skip.
+func (e *Engine) filesContainingKeys(keys map[string]struct{}, skip []string) []string {
+	skipped := make(map[string]struct{}, len(skip))
+	for _, path := range skip {
+		skipped[path] = struct{}{}
+	}
+
+	var paths []string
+	for _, f := range e.FileStore.Files() {
+		if _, ok := skipped[f.Path()]; ok {
+			continue
+		}
+		for key := range keys {
+			if f.Contains(key) {
+				paths = append(paths, f.Path())
+				break
+			}
+		}
+	}
+	return paths
+}
+
+// writeMigratedFiles compacts tsmFiles into new TSM files with the values for
+// keys converted to typ. The new files are written with temporary names and
+// must be passed to FileStore.Replace to become active.
+func (e *Engine) writeMigratedFiles(tsmFiles []string, keys map[string]struct{}, typ influxql.DataType) (files []string, migrated, dropped int64, err error) {
+	if len(tsmFiles) == 0 {
+		return nil, 0, 0, nil
+	}
+
+	// The new files take the place of the old ones so they are written to the
+	// highest generation being replaced, as with a regular compaction.
+	var generation, sequence int
+	for _, f := range tsmFiles {
+		gen, seq, err := ParseTSMFileName(f)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		if gen > generation || (gen == generation && seq > sequence) {
+			generation, sequence = gen, seq
+		}
+	}
+
+	var trs []*TSMReader
+	for _, file := range tsmFiles {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+
+		tr, err := NewTSMReader(f)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		defer tr.Close()
+		trs = append(trs, tr)
+	}
+
+	size := e.Compactor.Size
+	if size <= 0 {
+		size = tsdb.DefaultMaxPointsPerBlock
+	}
+	tsm, err := NewTSMKeyIterator(size, false, trs...)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	iter := &fieldTypeMigrationIterator{KeyIterator: tsm, keys: keys, typ: typ}
+
+	for {
+		sequence++
+		fileName := filepath.Join(e.path, fmt.Sprintf("%09d-%09d.%s.tmp", generation, sequence, TSMFileExtension))
+
+		// Unlike Compactor.write, the migration must complete even though
+		// compactions are disabled while it runs.
+		err := writeTSMFile(fileName, iter)
+		if err == errMaxFileExceeded || err == ErrMaxBlocksExceeded {
+			files = append(files, fileName)
+			continue
+		} else if err == ErrNoValues {
+			if err := os.RemoveAll(fileName); err != nil {
+				return nil, 0, 0, err
+			}
+			break
+		} else if err != nil {
+			os.RemoveAll(fileName)
+			e.removeTempFiles(files)
+			return nil, 0, 0, err
+		}
+
+		files = append(files, fileName)
+		break
+	}
+
+	return files, iter.migrated, iter.dropped, nil
+}
+
+// writeTSMFile writes blocks from iter to a new TSM file at path until iter is
+// exhausted or the file reaches its maximum size.
+func writeTSMFile(path string, iter KeyIterator) (err error) {
+	fd, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_EXCL, 0666)
+	if err != nil {
+		return err
+	}
+
+	w, err := NewTSMWriter(fd)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		closeErr := w.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+
+	for iter.Next() {
+		key, minTime, maxTime, block, err := iter.Read()
+		if err != nil {
+			return err
+		}
+
+		if err := w.WriteBlock(key, minTime, maxTime, block); err == ErrMaxBlocksExceeded {
+			if err := w.WriteIndex(); err != nil {
+				return err
+			}
+			return err
+		} else if err != nil {
+			return err
+		}
+
+		if w.Size() > maxTSMFileSize {
+			if err := w.WriteIndex(); err != nil {
+				return err
+			}
+			return errMaxFileExceeded
+		}
+	}
+
+	return w.WriteIndex()
+}
+
+// removeTempFiles removes TSM files written by an aborted migration.
+func (e *Engine) removeTempFiles(files []string) {
+	for _, f := range files {
+		if err := os.RemoveAll(f); err != nil {
+			e.logger.Info(fmt.Sprintf("error removing migrated TSM file %s: %v", f, err))
+		}
+	}
+}
+
+// migrateCacheValues converts the cached values for keys to typ. The WAL is
+// updated to match so the old values are not reloaded on restart. The engine
+// lock must be held by the caller.
+func (e *Engine) migrateCacheValues(keys map[string]struct{}, typ influxql.DataType) (migrated, dropped int64, err error) {
+	values := make(map[string][]Value)
+	var cacheKeys []string
+	for _, key := range e.Cache.Keys() {
+		if _, ok := keys[key]; !ok {
+			continue
+		}
+		cacheKeys = append(cacheKeys, key)
+
+		a, d := convertValues(e.Cache.Values(key), typ)
+		migrated, dropped = migrated+int64(len(a)), dropped+d
+		if len(a) > 0 {
+			values[key] = a
+		}
+	}
+	if len(cacheKeys) == 0 {
+		return 0, 0, nil
+	}
+
+	e.Cache.DeleteRange(cacheKeys, math.MinInt64, math.MaxInt64)
+	if _, err := e.WAL.DeleteRange(cacheKeys, math.MinInt64, math.MaxInt64); err != nil {
+		return 0, 0, err
+	}
+	if len(values) == 0 {
+		return migrated, dropped, nil
+	}
+
+	if err := e.Cache.WriteMulti(values); err != nil {
+		return 0, 0, err
+	}
+	if _, err := e.WAL.WritePoints(values); err != nil {
+		return 0, 0, err
+	}
+	return migrated, dropped, nil
+}
+
+// fieldTypeMigrationIterator is a KeyIterator that converts the blocks for a
+// set of keys to a new type while passing other blocks through unchanged.
+type fieldTypeMigrationIterator struct {
+	KeyIterator
+	keys map[string]struct{}
+	typ  influxql.DataType
+
+	key              string
+	minTime, maxTime int64
+	block            []byte
+	err              error
+
+	migrated, dropped int64
+}
+
+// Next returns true if there is another block to read.
+func (itr *fieldTypeMigrationIterator) Next() bool {
+	for itr.KeyIterator.Next() {
+		itr.key, itr.minTime, itr.maxTime, itr.block, itr.err = itr.KeyIterator.Read()
+		if itr.err != nil {
+			return true
+		} else if _, ok := itr.keys[itr.key]; !ok {
+			return true
+		}
+
+		values, err := DecodeBlock(itr.block, nil)
+		if err != nil {
+			itr.err = err
+			return true
+		}
+
+		values, dropped := convertValues(values, itr.typ)
+		itr.migrated, itr.dropped = itr.migrated+int64(len(values)), itr.dropped+dropped
+		if len(values) == 0 {
+			continue
+		}
+
+		itr.minTime, itr.maxTime = values[0].UnixNano(), values[len(values)-1].UnixNano()
+		itr.block, itr.err = Values(values).Encode(nil)
+		return true
+	}
+	return false
+}
+
+// Read returns the current block.
+func (itr *fieldTypeMigrationIterator) Read() (string, int64, int64, []byte, error) {
+	return itr.key, itr.minTime, itr.maxTime, itr.block, itr.err
+}
+
+// convertValues converts values to typ, returning the converted values and the
+// number of values that could not be converted.
+func convertValues(values []Value, typ influxql.DataType) ([]Value, int64) {
+	a := make([]Value, 0, len(values))
+	for _, v := range values {
+		if cv := convertValue(v, typ); cv != nil {
+			a = append(a, cv)
+		}
+	}
+	return a, int64(len(values) - len(a))
+}
+
+// convertValue converts v to typ. Returns nil if the value cannot be
+// represented by typ.
+func convertValue(v Value, typ influxql.DataType) Value {
+	t := v.UnixNano()
+	switch typ {
+	case influxql.Float:
+		switch v := v.Value().(type) {
+		case float64:
+			return NewFloatValue(t, v)
+		case int64:
+			return NewFloatValue(t, float64(v))
+		case bool:
+			if v {
+				return NewFloatValue(t, 1)
+			}
+			return NewFloatValue(t, 0)
+		case string:
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				return NewFloatValue(t, f)
+			}
+		}
+	case influxql.Integer:
+		switch v := v.Value().(type) {
+		case int64:
+			return NewIntegerValue(t, v)
+		case float64:
+			// Floats are truncated, as with a cast, unless they are out of range.
+			if !math.IsNaN(v) && v >= math.MinInt64 && v < math.MaxInt64 {
+				return NewIntegerValue(t, int64(v))
+			}
+		case bool:
+			if v {
+				return NewIntegerValue(t, 1)
+			}
+			return NewIntegerValue(t, 0)
+		case string:
+			if i, err := strconv.ParseInt(v, 10, 64); err == nil {
+				return NewIntegerValue(t, i)
+			}
+		}
+	case influxql.String:
+		switch v := v.Value().(type) {
+		case string:
+			return NewStringValue(t, v)
+		case float64:
+			return NewStringValue(t, strconv.FormatFloat(v, 'f', -1, 64))
+		case int64:
+			return NewStringValue(t, strconv.FormatInt(v, 10))
+		case bool:
+			return NewStringValue(t, strconv.FormatBool(v))
+		}
+	case influxql.Boolean:
+		switch v := v.Value().(type) {
+		case bool:
+			return NewBooleanValue(t, v)
+		case float64:
+			return NewBooleanValue(t, v != 0)
+		case int64:
+			return NewBooleanValue(t, v != 0)
+		case string:
+			if b, err := strconv.ParseBool(v); err == nil {
+				return NewBooleanValue(t, b)
+			}
+		}
+	}
+	return nil
+}
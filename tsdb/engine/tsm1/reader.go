@@ -36,6 +36,22 @@ type TSMReader struct {
 
 	// lastModified is the last time this file was modified on disk
 	lastModified int64
+
+	// indexInMemory copies the index onto the heap instead of reading it
+	// through the mmap.
+	indexInMemory bool
+}
+
+// tsmReaderOption is a functional option used when creating a TSMReader.
+type tsmReaderOption func(r *TSMReader)
+
+// WithIndexInMemory sets whether the index of the TSM file is fully loaded
+// into memory. Loading the index avoids page faults when searching it at the
+// cost of holding the whole index on the heap.
+func WithIndexInMemory(enabled bool) tsmReaderOption {
+	return func(r *TSMReader) {
+		r.indexInMemory = enabled
+	}
 }
 
 // TSMIndex represent the index section of a TSM file.  The index records all
@@ -179,8 +195,11 @@ type blockAccessor interface {
 }
 
 // NewTSMReader returns a new TSMReader from the given file.
-func NewTSMReader(f *os.File) (*TSMReader, error) {
+func NewTSMReader(f *os.File, options ...tsmReaderOption) (*TSMReader, error) {
 	t := &TSMReader{}
+	for _, option := range options {
+		option(t)
+	}
 
 	stat, err := f.Stat()
 	if err != nil {
@@ -189,7 +208,8 @@ func NewTSMReader(f *os.File) (*TSMReader, error) {
 	t.size = stat.Size()
 	t.lastModified = stat.ModTime().UnixNano()
 	t.accessor = &mmapAccessor{
-		f: f,
+		f:         f,
+		loadIndex: t.indexInMemory,
 	}
 
 	index, err := t.accessor.init()
@@ -453,6 +473,12 @@ func (t *TSMReader) IndexSize() uint32 {
 	return t.index.Size()
 }
 
+// IndexInMemory returns true if the index is held on the heap rather than
+// read through the mmap.
+func (t *TSMReader) IndexInMemory() bool {
+	return t.indexInMemory
+}
+
 // Size returns the size of the underlying file in bytes.
 func (t *TSMReader) Size() uint32 {
 	t.mu.RLock()
@@ -975,6 +1001,9 @@ type mmapAccessor struct {
 	f     *os.File
 	b     []byte
 	index *indirectIndex
+
+	// loadIndex copies the index out of the mmap so lookups never fault.
+	loadIndex bool
 }
 
 func (m *mmapAccessor) init() (*indirectIndex, error) {
@@ -1010,8 +1039,14 @@ func (m *mmapAccessor) init() (*indirectIndex, error) {
 		return nil, fmt.Errorf("mmapAccessor: invalid indexStart")
 	}
 
+	index := m.b[indexStart:indexOfsPos]
+	if m.loadIndex {
+		index = make([]byte, len(index))
+		copy(index, m.b[indexStart:indexOfsPos])
+	}
+
 	m.index = NewIndirectIndex()
-	if err := m.index.UnmarshalBinary(m.b[indexStart:indexOfsPos]); err != nil {
+	if err := m.index.UnmarshalBinary(index); err != nil {
 		return nil, err
 	}
 
@@ -131,6 +131,58 @@ func TestTSMReader_MMAP_ReadAll(t *testing.T) {
 	}
 }
 
+func TestTSMReader_IndexInMemory(t *testing.T) {
+	dir := MustTempDir()
+	defer os.RemoveAll(dir)
+	f := MustTempFile(dir)
+
+	w, err := tsm1.NewTSMWriter(f)
+	if err != nil {
+		t.Fatalf("unexpected error creating writer: %v", err)
+	}
+
+	values := []tsm1.Value{tsm1.NewValue(0, 1.0), tsm1.NewValue(1, 2.0)}
+	if err := w.Write("cpu", values); err != nil {
+		t.Fatalf("unexpected error writing: %v", err)
+	}
+	if err := w.WriteIndex(); err != nil {
+		t.Fatalf("unexpected error writing index: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("unexpected error closing: %v", err)
+	}
+
+	f, err = os.Open(f.Name())
+	if err != nil {
+		t.Fatalf("unexpected error opening: %v", err)
+	}
+	r, err := tsm1.NewTSMReader(f, tsm1.WithIndexInMemory(true))
+	if err != nil {
+		t.Fatalf("unexpected error created reader: %v", err)
+	}
+	defer r.Close()
+
+	if !r.IndexInMemory() {
+		t.Fatalf("expected index to be held in memory")
+	} else if r.IndexSize() == 0 {
+		t.Fatalf("expected non-zero index size")
+	}
+
+	readValues, err := r.ReadAll("cpu")
+	if err != nil {
+		t.Fatalf("unexpected error reading: %v", err)
+	}
+
+	if exp, got := len(values), len(readValues); exp != got {
+		t.Fatalf("read values length mismatch: got %v, exp %v", got, exp)
+	}
+	for i, v := range values {
+		if v.Value() != readValues[i].Value() {
+			t.Fatalf("read value mismatch(%d): got %v, exp %v", i, readValues[i].Value(), v.Value())
+		}
+	}
+}
+
 func TestTSMReader_MMAP_Read(t *testing.T) {
 	dir := MustTempDir()
 	defer os.RemoveAll(dir)
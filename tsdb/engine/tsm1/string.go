@@ -4,6 +4,11 @@ package tsm1
 // appended to byte slice prefixed with a variable byte length followed by the string
 // bytes.  The bytes are compressed using snappy compressor and a 1 byte header is used
 // to indicate the type of encoding.
+//
+// Blocks of low cardinality strings can instead be dictionary encoded.  The distinct
+// strings of the block are written once, as a variable byte count followed by each
+// length prefixed string, and every value is written as a variable byte index into
+// that dictionary.  The result is also compressed using snappy.
 
 import (
 	"encoding/binary"
@@ -19,12 +24,19 @@ const (
 
 	// stringCompressedSnappy is a compressed encoding using Snappy compression
 	stringCompressedSnappy = 1
+
+	// stringCompressedDictionary is a dictionary encoding of the block's distinct
+	// strings, compressed using Snappy compression
+	stringCompressedDictionary = 2
 )
 
 // StringEncoder encodes multiple strings into a byte slice.
 type StringEncoder struct {
 	// The encoded bytes
 	bytes []byte
+
+	// dictionary enables dictionary encoding when it produces a smaller block.
+	dictionary bool
 }
 
 // NewStringEncoder returns a new StringEncoder with an initial buffer ready to hold sz bytes.
@@ -34,6 +46,15 @@ func NewStringEncoder(sz int) StringEncoder {
 	}
 }
 
+// NewDictionaryStringEncoder returns a new StringEncoder that dictionary encodes
+// its strings if that is smaller than compressing them as-is.
+func NewDictionaryStringEncoder(sz int) StringEncoder {
+	return StringEncoder{
+		bytes:      make([]byte, 0, sz),
+		dictionary: true,
+	}
+}
+
 // Flush is no-op
 func (e *StringEncoder) Flush() {}
 
@@ -58,29 +79,156 @@ func (e *StringEncoder) Bytes() ([]byte, error) {
 	// Compress the currently appended bytes using snappy and prefix with
 	// a 1 byte header for future extension
 	data := snappy.Encode(nil, e.bytes)
-	return append([]byte{stringCompressedSnappy << 4}, data...), nil
+	b := append([]byte{stringCompressedSnappy << 4}, data...)
+
+	if e.dictionary {
+		dict, err := e.encodeDictionary()
+		if err != nil {
+			return nil, err
+		}
+		if dict != nil && len(dict) < len(b) {
+			return dict, nil
+		}
+	}
+	return b, nil
+}
+
+// encodeDictionary returns the appended strings dictionary encoded. It returns
+// nil if every string is distinct, since a dictionary cannot be smaller.
+func (e *StringEncoder) encodeDictionary() ([]byte, error) {
+	var dict []string
+	indexes := make(map[string]uint64)
+	var values []uint64
+
+	for i := 0; i < len(e.bytes); {
+		length, n := binary.Uvarint(e.bytes[i:])
+		if n <= 0 || i+n+int(length) > len(e.bytes) {
+			return nil, fmt.Errorf("StringEncoder: invalid encoded string length")
+		}
+		s := string(e.bytes[i+n : i+n+int(length)])
+		i += n + int(length)
+
+		idx, ok := indexes[s]
+		if !ok {
+			idx = uint64(len(dict))
+			indexes[s] = idx
+			dict = append(dict, s)
+		}
+		values = append(values, idx)
+	}
+
+	if len(dict) == len(values) {
+		return nil, nil
+	}
+
+	b := make([]byte, binary.MaxVarintLen64)
+	buf := make([]byte, 0, len(e.bytes))
+	buf = append(buf, b[:binary.PutUvarint(b, uint64(len(dict)))]...)
+	for _, s := range dict {
+		buf = append(buf, b[:binary.PutUvarint(b, uint64(len(s)))]...)
+		buf = append(buf, s...)
+	}
+	for _, idx := range values {
+		buf = append(buf, b[:binary.PutUvarint(b, idx)]...)
+	}
+
+	data := snappy.Encode(nil, buf)
+	return append([]byte{stringCompressedDictionary << 4}, data...), nil
+}
+
+// stringsLen returns the total length of the n strings encoded in b without
+// decoding them. The length of snappy encoded strings is derived from the
+// decompressed size, assuming the length prefix of every string takes a
+// single byte. Dictionary encoded strings are decompressed but not copied.
+func stringsLen(b []byte, n int) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+
+	switch b[0] >> 4 {
+	case stringCompressedSnappy:
+		sz, err := snappy.DecodedLen(b[1:])
+		if err != nil {
+			return 0, fmt.Errorf("failed to decode string block: %v", err.Error())
+		}
+		if sz < n {
+			return 0, fmt.Errorf("StringDecoder: not enough data to represent %d strings", n)
+		}
+		return sz - n, nil
+	case stringCompressedDictionary:
+		data, err := snappy.Decode(nil, b[1:])
+		if err != nil {
+			return 0, fmt.Errorf("failed to decode string block: %v", err.Error())
+		}
+
+		// Read the length of every string of the dictionary.
+		size, i := binary.Uvarint(data)
+		if i <= 0 {
+			return 0, fmt.Errorf("StringDecoder: invalid dictionary size")
+		}
+		data = data[i:]
+		var lengths []int
+		for j := uint64(0); j < size; j++ {
+			length, i := binary.Uvarint(data)
+			if i <= 0 {
+				return 0, fmt.Errorf("StringDecoder: invalid encoded string length")
+			}
+			if uint64(len(data)-i) < length {
+				return 0, fmt.Errorf("StringDecoder: not enough data to represent encoded string")
+			}
+			lengths = append(lengths, int(length))
+			data = data[i+int(length):]
+		}
+
+		// Sum the lengths of the strings referenced by the indexes.
+		var sz int
+		for len(data) > 0 {
+			idx, i := binary.Uvarint(data)
+			if i <= 0 {
+				return 0, fmt.Errorf("StringDecoder: invalid dictionary index")
+			} else if idx >= uint64(len(lengths)) {
+				return 0, fmt.Errorf("StringDecoder: dictionary index out of range")
+			}
+			sz += lengths[idx]
+			data = data[i:]
+		}
+		return sz, nil
+	default:
+		return 0, fmt.Errorf("unknown string encoding %v", b[0]>>4)
+	}
 }
 
 // StringDecoder decodes a byte slice into strings.
 type StringDecoder struct {
-	b   []byte
-	l   int
-	i   int
-	err error
+	b    []byte
+	dict []string
+	l    int
+	i    int
+	err  error
 }
 
 // SetBytes initializes the decoder with bytes to read from.
 // This must be called before calling any other method.
 func (e *StringDecoder) SetBytes(b []byte) error {
-	// First byte stores the encoding type, only have snappy format
-	// currently so ignore for now.
+	// First byte stores the encoding type.
 	var data []byte
+	e.dict = e.dict[:0]
 	if len(b) > 0 {
 		var err error
 		data, err = snappy.Decode(nil, b[1:])
 		if err != nil {
 			return fmt.Errorf("failed to decode string block: %v", err.Error())
 		}
+
+		switch b[0] >> 4 {
+		case stringCompressedSnappy:
+		case stringCompressedDictionary:
+			if data, err = e.readDictionary(data); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unknown string encoding %v", b[0]>>4)
+		}
 	}
 
 	e.b = data
@@ -101,8 +249,45 @@ func (e *StringDecoder) Next() bool {
 	return e.i < len(e.b)
 }
 
+// readDictionary reads the dictionary at the start of data into e.dict and
+// returns the encoded indexes that follow it.
+func (e *StringDecoder) readDictionary(data []byte) ([]byte, error) {
+	n, i := binary.Uvarint(data)
+	if i <= 0 {
+		return nil, fmt.Errorf("StringDecoder: invalid dictionary size")
+	}
+	data = data[i:]
+
+	for j := uint64(0); j < n; j++ {
+		length, i := binary.Uvarint(data)
+		if i <= 0 {
+			return nil, fmt.Errorf("StringDecoder: invalid encoded string length")
+		}
+		if uint64(len(data)-i) < length {
+			return nil, fmt.Errorf("StringDecoder: not enough data to represent encoded string")
+		}
+		e.dict = append(e.dict, string(data[i:i+int(length)]))
+		data = data[i+int(length):]
+	}
+	return data, nil
+}
+
 // Read returns the next value from the decoder.
 func (e *StringDecoder) Read() string {
+	if len(e.dict) > 0 {
+		idx, n := binary.Uvarint(e.b[e.i:])
+		if n <= 0 {
+			e.err = fmt.Errorf("StringDecoder: invalid dictionary index")
+			return ""
+		}
+		e.l = n
+		if idx >= uint64(len(e.dict)) {
+			e.err = fmt.Errorf("StringDecoder: dictionary index out of range")
+			return ""
+		}
+		return e.dict[idx]
+	}
+
 	// Read the length of the string
 	length, n := binary.Uvarint(e.b[e.i:])
 	if n <= 0 {
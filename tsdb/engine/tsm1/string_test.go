@@ -126,6 +126,101 @@ func Test_StringEncoder_Quick(t *testing.T) {
 	}, nil)
 }
 
+func Test_StringEncoder_Dictionary(t *testing.T) {
+	enc := NewDictionaryStringEncoder(1024)
+
+	values := make([]string, 100)
+	for i := range values {
+		values[i] = fmt.Sprintf("status %d", i%3)
+		enc.Write(values[i])
+	}
+
+	b, err := enc.Bytes()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := b[0] >> 4; got != stringCompressedDictionary {
+		t.Fatalf("unexpected encoding: got %v, exp %v", got, stringCompressedDictionary)
+	}
+
+	var dec StringDecoder
+	if err := dec.SetBytes(b); err != nil {
+		t.Fatalf("unexpected error creating string decoder: %v", err)
+	}
+
+	for i, v := range values {
+		if !dec.Next() {
+			t.Fatalf("unexpected next value: got false, exp true")
+		}
+		if v != dec.Read() {
+			t.Fatalf("unexpected value at pos %d: got %v, exp %v", i, dec.Read(), v)
+		}
+	}
+
+	if dec.Next() {
+		t.Fatalf("unexpected next value: got true, exp false")
+	}
+	if err := dec.Error(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func Test_StringEncoder_Dictionary_Distinct(t *testing.T) {
+	enc := NewDictionaryStringEncoder(1024)
+	for i := 0; i < 10; i++ {
+		enc.Write(fmt.Sprintf("value %d", i))
+	}
+
+	b, err := enc.Bytes()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Distinct values fall back to the snappy encoding.
+	if got := b[0] >> 4; got != stringCompressedSnappy {
+		t.Fatalf("unexpected encoding: got %v, exp %v", got, stringCompressedSnappy)
+	}
+}
+
+func Test_StringEncoder_Dictionary_Quick(t *testing.T) {
+	quick.Check(func(values []string) bool {
+		// Repeat the values so the dictionary is used.
+		values = append(values, values...)
+
+		enc := NewDictionaryStringEncoder(1024)
+		for _, v := range values {
+			enc.Write(v)
+		}
+		buf, err := enc.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got []string
+		var dec StringDecoder
+		if err := dec.SetBytes(buf); err != nil {
+			t.Fatal(err)
+		}
+		for dec.Next() {
+			got = append(got, dec.Read())
+		}
+		if err := dec.Error(); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(got) != len(values) {
+			t.Fatalf("mismatch:\n\nexp=%#v\n\ngot=%#v\n\n", values, got)
+		}
+		for i := range values {
+			if got[i] != values[i] {
+				t.Fatalf("mismatch:\n\nexp=%#v\n\ngot=%#v\n\n", values, got)
+			}
+		}
+		return true
+	}, nil)
+}
+
 func Test_StringDecoder_Empty(t *testing.T) {
 	var dec StringDecoder
 	if err := dec.SetBytes([]byte{}); err != nil {
@@ -175,3 +270,49 @@ func Test_StringDecoder_CorruptSetBytes(t *testing.T) {
 		}
 	}
 }
+
+func Test_stringsLen(t *testing.T) {
+	values := []string{"a", "bb", "ccc", "a", "bb", "a"}
+	for _, enc := range []StringEncoder{NewStringEncoder(1024), NewDictionaryStringEncoder(1024)} {
+		for _, v := range values {
+			enc.Write(v)
+		}
+		b, err := enc.Bytes()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if n, err := stringsLen(b, len(values)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		} else if n != 10 {
+			t.Fatalf("unexpected length for encoding %v: got %v, exp %v", b[0]>>4, n, 10)
+		}
+	}
+}
+
+func Test_blockValuesSize(t *testing.T) {
+	values := Values{NewValue(0, "a"), NewValue(1, "bb"), NewValue(2, "ccc")}
+	b, err := values.Encode(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if n, err := blockValuesSize(b); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if exp := values.Size(); n != exp {
+		t.Fatalf("unexpected size: got %v, exp %v", n, exp)
+	}
+
+	// Corrupt blocks return an error rather than panicking.
+	for _, block := range [][]byte{
+		nil,
+		{BlockString},
+		{BlockString, 0x05, 0x20},
+		{BlockFloat64, 0x01, timeCompressedRLE << 4},
+		{BlockString, 0x00, stringCompressedSnappy << 4, 0x80},
+	} {
+		if _, err := blockValuesSize(block); err == nil {
+			t.Fatalf("expected error for block %q", block)
+		}
+	}
+}
@@ -368,9 +368,18 @@ func (d *TimeDecoder) decodeRaw(b []byte) {
 	}
 }
 
+// CountTimestamps returns the number of timestamps encoded in b. It returns 0
+// if b is malformed.
 func CountTimestamps(b []byte) int {
+	n, _ := countTimestamps(b)
+	return n
+}
+
+// countTimestamps returns the number of timestamps encoded in b, or an error
+// if b is malformed.
+func countTimestamps(b []byte) (int, error) {
 	if len(b) == 0 {
-		return 0
+		return 0, nil
 	}
 
 	// Encoding type is stored in the 4 high bits of the first byte
@@ -378,21 +387,36 @@ func CountTimestamps(b []byte) int {
 	switch encoding {
 	case timeUncompressed:
 		// Uncompressed timestamps are just 8 bytes each
-		return len(b[1:]) / 8
+		return len(b[1:]) / 8, nil
 	case timeCompressedRLE:
+		if len(b) < 9 {
+			return 0, fmt.Errorf("TimeDecoder: not enough data to count RLE timestamps")
+		}
 		// First 9 bytes are the starting timestamp and scaling factor, skip over them
 		i := 9
 		// Next 1-10 bytes is our (scaled down by factor of 10) run length values
 		_, n := binary.Uvarint(b[9:])
+		if n <= 0 {
+			return 0, fmt.Errorf("TimeDecoder: invalid run length in RLE timestamps")
+		}
 		i += n
 		// Last 1-10 bytes is how many times the value repeats
-		count, _ := binary.Uvarint(b[i:])
-		return int(count)
+		count, n := binary.Uvarint(b[i:])
+		if n <= 0 {
+			return 0, fmt.Errorf("TimeDecoder: invalid repeat count in RLE timestamps")
+		}
+		return int(count), nil
 	case timeCompressedPackedSimple:
+		if len(b) < 9 {
+			return 0, fmt.Errorf("TimeDecoder: not enough data to count packed timestamps")
+		}
 		// First 9 bytes are the starting timestamp and scaling factor, skip over them
-		count, _ := simple8b.CountBytes(b[9:])
-		return count + 1 // +1 is for the first uncompressed timestamp, starting timestamep in b[1:9]
+		count, err := simple8b.CountBytes(b[9:])
+		if err != nil {
+			return 0, err
+		}
+		return count + 1, nil // +1 is for the first uncompressed timestamp, starting timestamep in b[1:9]
 	default:
-		return 0
+		return 0, fmt.Errorf("unknown encoding: %v", encoding)
 	}
 }
@@ -544,6 +544,22 @@ func TestTimeDecoder_Corrupt(t *testing.T) {
 	}
 }
 
+func Test_countTimestamps_Corrupt(t *testing.T) {
+	cases := []string{
+		"\x10\x14",         // Packed: not enough data
+		"\x20\x00",         // RLE: not enough data for starting timestamp
+		"\x2012345678\x90", // RLE: initial timestamp but invalid uvarint encoding
+		"\x2012345678\x7f", // RLE: timestamp, RLE but invalid repeat
+		"\x30",              // Unknown encoding
+	}
+
+	for _, c := range cases {
+		if _, err := countTimestamps([]byte(c)); err == nil {
+			t.Fatalf("exp an err, got nil: %q", c)
+		}
+	}
+}
+
 func BenchmarkTimeEncoder(b *testing.B) {
 	enc := NewTimeEncoder(1024)
 	x := make([]int64, 1024)
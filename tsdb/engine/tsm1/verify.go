@@ -0,0 +1,77 @@
+package tsm1
+
+import (
+	"fmt"
+	"hash/crc32"
+
+	"github.com/lucaswiersma/influxdb/tsdb"
+)
+
+// Verify checks the checksum of every block in the TSM files of the engine.
+// wait is called with the size of each block once it has been read so the
+// caller can throttle the scan, and the scan stops if it returns an error.
+// Files with corrupt blocks are logged and, if quarantine is true, removed
+// from the engine into the corrupt directory of the shard.
+func (e *Engine) Verify(wait func(n int) error, quarantine bool) (tsdb.VerifyStats, error) {
+	var stats tsdb.VerifyStats
+
+	// Hold references to the files so compactions replacing them while they
+	// are being read don't close them.
+	files := e.FileStore.acquire()
+	var corrupt []string
+	var err error
+	for _, f := range files {
+		if err == nil {
+			var n int
+			n, err = verifyFile(f, wait, &stats)
+			if n > 0 {
+				e.logger.Info(fmt.Sprintf("found %d corrupt blocks in %s", n, f.Path()))
+				corrupt = append(corrupt, f.Path())
+			}
+		}
+		f.Unref()
+	}
+	stats.CorruptFiles = corrupt
+
+	if !quarantine || len(corrupt) == 0 {
+		return stats, err
+	}
+
+	// Keep level compactions from rewriting the corrupt files while they are
+	// being removed.
+	e.disableLevelCompactions(true)
+	defer e.enableLevelCompactions(true)
+
+	for _, path := range corrupt {
+		if err := e.FileStore.Quarantine(path); err != nil {
+			e.logger.Info(fmt.Sprintf("error quarantining corrupt TSM file %s: %v", path, err))
+			continue
+		}
+		e.logger.Info(fmt.Sprintf("quarantined corrupt TSM file %s", path))
+		stats.QuarantinedFiles = append(stats.QuarantinedFiles, path)
+	}
+	return stats, err
+}
+
+// verifyFile checks the checksum of every block of f, adding to stats, and
+// returns the number of corrupt blocks. Blocks that cannot be read are
+// counted as corrupt.
+func verifyFile(f TSMFile, wait func(n int) error, stats *tsdb.VerifyStats) (int, error) {
+	var corrupt int
+	itr := f.BlockIterator()
+	for itr.Next() {
+		_, _, _, _, checksum, buf, err := itr.Read()
+		if err != nil || crc32.ChecksumIEEE(buf) != checksum {
+			corrupt++
+		}
+		stats.Blocks++
+		stats.Bytes += int64(len(buf))
+
+		if err := wait(len(buf)); err != nil {
+			return corrupt, err
+		}
+	}
+	stats.Files++
+	stats.CorruptBlocks += int64(corrupt)
+	return corrupt, nil
+}
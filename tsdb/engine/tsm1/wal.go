@@ -86,6 +86,11 @@ type WAL struct {
 	currentSegmentID     int
 	currentSegmentWriter *WALSegmentWriter
 
+	// currentSegmentFailed is set when a write to the current segment fails.
+	// The segment may end with a partially written entry, so the next write
+	// starts a new segment.
+	currentSegmentFailed bool
+
 	// cache and flush variables
 	closing chan struct{}
 	// goroutines waiting for the next fsync
@@ -388,6 +393,7 @@ func (l *WAL) writeToLog(entry WALEntry) (int, error) {
 
 		// write and sync
 		if err := l.currentSegmentWriter.Write(entry.Type(), compressed); err != nil {
+			l.currentSegmentFailed = true
 			return -1, fmt.Errorf("error writing WAL entry: %v", err)
 		}
 
@@ -406,12 +412,30 @@ func (l *WAL) writeToLog(entry WALEntry) (int, error) {
 
 	// schedule an fsync and wait for it to complete
 	l.sync()
-	return segID, <-syncErr
+	if err := <-syncErr; err != nil {
+		l.mu.Lock()
+		l.currentSegmentFailed = true
+		l.mu.Unlock()
+		return segID, err
+	}
+	return segID, nil
 }
 
 // rollSegment checks if the current segment is due to roll over to a new segment;
 // and if so, opens a new segment file for future writes.
 func (l *WAL) rollSegment() error {
+	if l.currentSegmentFailed && l.currentSegmentWriter != nil {
+		// Sync the entries written before the failure for the writers
+		// waiting on them and stop writing to the segment.
+		err := l.currentSegmentWriter.sync()
+		for len(l.syncWaiters) > 0 {
+			errC := <-l.syncWaiters
+			errC <- err
+		}
+		l.currentSegmentWriter.close()
+		l.currentSegmentWriter = nil
+	}
+
 	if l.currentSegmentWriter == nil || l.currentSegmentWriter.size > DefaultSegmentSize {
 		if err := l.newSegmentFile(); err != nil {
 			// A drop database or RP call could trigger this error if writes were in-flight
@@ -517,6 +541,7 @@ func (l *WAL) newSegmentFile() error {
 		return err
 	}
 	l.currentSegmentWriter = NewWALSegmentWriter(fd)
+	l.currentSegmentFailed = false
 
 	if stat, err := fd.Stat(); err == nil {
 		l.lastWriteTime = stat.ModTime()
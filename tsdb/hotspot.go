@@ -0,0 +1,222 @@
+package tsdb
+
+import (
+	"container/heap"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lucaswiersma/influxdb/models"
+)
+
+// writeHotspotCandidatesPerSeries is the number of series tracked for each
+// reported hotspot. Tracking more candidates than are reported keeps series
+// with a steady write rate from being displaced by bursts of new series.
+const writeHotspotCandidatesPerSeries = 10
+
+// WriteHotspot is a series with one of the highest write rates.
+type WriteHotspot struct {
+	Database string
+	Series   string
+
+	// Writes is the estimated number of points written to the series
+	// during the window, and Rate is the estimate in points per second.
+	Writes int64
+	Rate   float64
+}
+
+// writeHotspotTracker estimates the series with the highest write rates
+// using the Space-Saving algorithm over a sample of the written points.
+// Memory use is bounded by the number of tracked candidates, not by the
+// number of series written to.
+type writeHotspotTracker struct {
+	mu sync.Mutex
+
+	sampleRate float64
+	n          int
+	interval   time.Duration
+	rand       *rand.Rand
+
+	counters map[hotspotKey]*hotspotCounter
+	heap     hotspotHeap
+	start    time.Time
+
+	// last holds the hotspots of the last complete window. It is nil
+	// until the first window completes.
+	last []WriteHotspot
+
+	now func() time.Time
+}
+
+// newWriteHotspotTracker returns a tracker reporting the n series with the
+// highest write rates over each interval, sampling sampleRate of the points.
+func newWriteHotspotTracker(sampleRate float64, n int, interval time.Duration) *writeHotspotTracker {
+	t := &writeHotspotTracker{
+		sampleRate: sampleRate,
+		n:          n,
+		interval:   interval,
+		rand:       rand.New(rand.NewSource(time.Now().UnixNano())),
+		counters:   make(map[hotspotKey]*hotspotCounter),
+		now:        time.Now,
+	}
+	t.start = t.now()
+	return t
+}
+
+// Add samples points written to a shard of database.
+func (t *writeHotspotTracker) Add(database string, points []models.Point) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.rotate(t.now())
+
+	// Each sampled point stands for 1/sampleRate written points.
+	weight := 1 / t.sampleRate
+	for _, p := range points {
+		if t.sampleRate < 1 && t.rand.Float64() >= t.sampleRate {
+			continue
+		}
+		t.observe(hotspotKey{database: database, series: string(p.Key())}, weight)
+	}
+}
+
+// observe adds weight to the count of key, replacing the candidate with the
+// lowest count when key is not tracked and there is no room for it.
+func (t *writeHotspotTracker) observe(key hotspotKey, weight float64) {
+	if c := t.counters[key]; c != nil {
+		c.count += weight
+		heap.Fix(&t.heap, c.index)
+		return
+	}
+
+	if len(t.heap) < t.n*writeHotspotCandidatesPerSeries {
+		c := &hotspotCounter{key: key, count: weight}
+		t.counters[key] = c
+		heap.Push(&t.heap, c)
+		return
+	}
+
+	// The new series inherits the count of the one it replaces, which
+	// overestimates its count by at most that much.
+	c := t.heap[0]
+	delete(t.counters, c.key)
+	c.key = key
+	c.count += weight
+	t.counters[key] = c
+	heap.Fix(&t.heap, 0)
+}
+
+// rotate starts a new window when the current one has ended.
+func (t *writeHotspotTracker) rotate(now time.Time) {
+	elapsed := now.Sub(t.start)
+	if elapsed < t.interval {
+		return
+	}
+
+	// Nothing was written during the previous window if more than one
+	// window has passed since the current one started.
+	if elapsed < 2*t.interval {
+		t.last = t.top(t.interval)
+		t.start = t.start.Add(t.interval)
+	} else {
+		t.last = []WriteHotspot{}
+		t.start = now
+	}
+	t.counters = make(map[hotspotKey]*hotspotCounter)
+	t.heap = t.heap[:0]
+}
+
+// top returns the n candidates with the highest counts in the current
+// window, computing rates over d.
+func (t *writeHotspotTracker) top(d time.Duration) []WriteHotspot {
+	counters := make(hotspotCounters, len(t.heap))
+	copy(counters, t.heap)
+	sort.Sort(counters)
+	if len(counters) > t.n {
+		counters = counters[:t.n]
+	}
+
+	a := make([]WriteHotspot, len(counters))
+	for i, c := range counters {
+		a[i] = WriteHotspot{
+			Database: c.key.database,
+			Series:   c.key.series,
+			Writes:   int64(c.count + 0.5),
+			Rate:     c.count / d.Seconds(),
+		}
+	}
+	return a
+}
+
+// Hotspots returns the series with the highest write rates during the last
+// complete window, or so far during the first window, in descending order.
+func (t *writeHotspotTracker) Hotspots() []WriteHotspot {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	t.rotate(now)
+	if t.last != nil {
+		a := make([]WriteHotspot, len(t.last))
+		copy(a, t.last)
+		return a
+	}
+
+	d := now.Sub(t.start)
+	if d <= 0 {
+		d = time.Nanosecond
+	}
+	return t.top(d)
+}
+
+// hotspotKey identifies a series across databases.
+type hotspotKey struct {
+	database string
+	series   string
+}
+
+// hotspotCounter is the estimated number of points written to a series.
+type hotspotCounter struct {
+	key   hotspotKey
+	count float64
+	index int
+}
+
+// hotspotCounters sorts counters by descending count.
+type hotspotCounters []*hotspotCounter
+
+func (a hotspotCounters) Len() int      { return len(a) }
+func (a hotspotCounters) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a hotspotCounters) Less(i, j int) bool {
+	if a[i].count != a[j].count {
+		return a[i].count > a[j].count
+	} else if a[i].key.database != a[j].key.database {
+		return a[i].key.database < a[j].key.database
+	}
+	return a[i].key.series < a[j].key.series
+}
+
+// hotspotHeap is a min-heap of counters ordered by count.
+type hotspotHeap []*hotspotCounter
+
+func (h hotspotHeap) Len() int           { return len(h) }
+func (h hotspotHeap) Less(i, j int) bool { return h[i].count < h[j].count }
+func (h hotspotHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *hotspotHeap) Push(x interface{}) {
+	c := x.(*hotspotCounter)
+	c.index = len(*h)
+	*h = append(*h, c)
+}
+
+func (h *hotspotHeap) Pop() interface{} {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
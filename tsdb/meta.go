@@ -7,6 +7,7 @@ import (
 	"sort"
 	"sync"
 	"sync/atomic"
+	"time"
 	"unsafe"
 
 	"github.com/lucaswiersma/influxdb/influxql"
@@ -24,6 +25,9 @@ const (
 	statDatabaseMeasurements        = "numMeasurements"        // number of measurements in this database
 	statDatabaseSeriesDropped       = "numSeriesDropped"       // number of series dropped from database
 	statDatabaseMeasurementsDropped = "numMeasurementsDropped" // number of measurements dropped from database
+	statDatabaseSeriesEvicted       = "numSeriesEvicted"       // number of stale series evicted from database
+
+	statRetentionPolicySeries = "numSeries" // number of series in the shards of this retention policy
 )
 
 // DatabaseIndex is the in memory index of a collection of measurements, time series, and their tags.
@@ -37,6 +41,12 @@ type DatabaseIndex struct {
 
 	name string // name of the database represented by this index
 
+	// rpMu guards the retention policy of each shard and the number of series
+	// assigned to at least one shard of each retention policy.
+	rpMu              sync.Mutex
+	retentionPolicies map[uint64]string
+	rpSeriesN         map[string]int
+
 	stats       *IndexStatistics
 	defaultTags models.StatisticTags
 }
@@ -49,6 +59,9 @@ func NewDatabaseIndex(name string) *DatabaseIndex {
 		name:         name,
 		stats:        &IndexStatistics{},
 		defaultTags:  models.StatisticTags{"database": name},
+
+		retentionPolicies: make(map[uint64]string),
+		rpSeriesN:         make(map[string]int),
 	}
 }
 
@@ -58,11 +71,12 @@ type IndexStatistics struct {
 	NumMeasurements        int64
 	NumSeriesDropped       int64
 	NumMeasurementsDropped int64
+	NumSeriesEvicted       int64
 }
 
 // Statistics returns statistics for periodic monitoring.
 func (d *DatabaseIndex) Statistics(tags map[string]string) []models.Statistic {
-	return []models.Statistic{{
+	statistics := []models.Statistic{{
 		Name: "database",
 		Tags: d.defaultTags.Merge(tags),
 		Values: map[string]interface{}{
@@ -70,8 +84,35 @@ func (d *DatabaseIndex) Statistics(tags map[string]string) []models.Statistic {
 			statDatabaseMeasurements:        atomic.LoadInt64(&d.stats.NumMeasurements),
 			statDatabaseSeriesDropped:       atomic.LoadInt64(&d.stats.NumSeriesDropped),
 			statDatabaseMeasurementsDropped: atomic.LoadInt64(&d.stats.NumMeasurementsDropped),
+			statDatabaseSeriesEvicted:       atomic.LoadInt64(&d.stats.NumSeriesEvicted),
 		},
 	}}
+	return append(statistics, d.retentionPolicyStatistics(tags)...)
+}
+
+// retentionPolicyStatistics returns the number of series of each retention
+// policy with shards in the index.
+func (d *DatabaseIndex) retentionPolicyStatistics(tags map[string]string) []models.Statistic {
+	d.rpMu.Lock()
+	defer d.rpMu.Unlock()
+
+	names := make([]string, 0, len(d.rpSeriesN))
+	for rp := range d.rpSeriesN {
+		names = append(names, rp)
+	}
+	sort.Strings(names)
+
+	statistics := make([]models.Statistic, 0, len(names))
+	for _, rp := range names {
+		statistics = append(statistics, models.Statistic{
+			Name: "retentionPolicy",
+			Tags: models.StatisticTags{"database": d.name, "retentionPolicy": rp}.Merge(tags),
+			Values: map[string]interface{}{
+				statRetentionPolicySeries: int64(d.rpSeriesN[rp]),
+			},
+		})
+	}
+	return statistics
 }
 
 // Series returns a series by key.
@@ -178,6 +219,7 @@ func (d *DatabaseIndex) CreateSeriesIndexIfNotExists(measurementName string, ser
 	d.lastID++
 
 	series.measurement = m
+	series.Touch(time.Now().UnixNano())
 
 	// Clone the tags to dereference any short-term buffers
 	if forceCopy {
@@ -226,10 +268,83 @@ func (d *DatabaseIndex) CreateMeasurementIndexIfNotExists(name string) *Measurem
 func (d *DatabaseIndex) AssignShard(k string, shardID uint64) {
 	ss := d.Series(k)
 	if ss != nil {
-		ss.AssignShard(shardID)
+		d.AssignSeriesShard(ss, shardID)
+	}
+}
+
+// AssignSeriesShard updates the index to indicate that the series exists in
+// the given shardID.
+func (d *DatabaseIndex) AssignSeriesShard(ss *Series, shardID uint64) {
+	d.rpMu.Lock()
+	defer d.rpMu.Unlock()
+
+	if ss.Assigned(shardID) {
+		return
+	}
+	if rp, ok := d.retentionPolicies[shardID]; ok && !d.inRetentionPolicy(ss, rp) {
+		d.rpSeriesN[rp]++
+	}
+	ss.AssignShard(shardID)
+}
+
+// unassignSeriesShard removes shardID from the shards of the series.
+func (d *DatabaseIndex) unassignSeriesShard(ss *Series, shardID uint64) {
+	d.rpMu.Lock()
+	defer d.rpMu.Unlock()
+
+	ss.UnassignShard(shardID)
+	if rp, ok := d.retentionPolicies[shardID]; ok && !d.inRetentionPolicy(ss, rp) {
+		d.decrRetentionPolicySeriesN(rp)
 	}
 }
 
+// SetShardRetentionPolicy records the retention policy of a shard so that the
+// series assigned to it are counted towards the retention policy.
+func (d *DatabaseIndex) SetShardRetentionPolicy(shardID uint64, rp string) {
+	d.rpMu.Lock()
+	d.retentionPolicies[shardID] = rp
+	d.rpMu.Unlock()
+}
+
+// RetentionPolicySeriesN returns the number of series assigned to at least one
+// shard of the retention policy.
+func (d *DatabaseIndex) RetentionPolicySeriesN(rp string) int {
+	d.rpMu.Lock()
+	defer d.rpMu.Unlock()
+	return d.rpSeriesN[rp]
+}
+
+// SeriesInRetentionPolicy returns true if the series is assigned to a shard of
+// the retention policy.
+func (d *DatabaseIndex) SeriesInRetentionPolicy(ss *Series, rp string) bool {
+	d.rpMu.Lock()
+	defer d.rpMu.Unlock()
+	return d.inRetentionPolicy(ss, rp)
+}
+
+// inRetentionPolicy returns true if the series is assigned to a shard of rp.
+// The caller must hold rpMu.
+func (d *DatabaseIndex) inRetentionPolicy(ss *Series, rp string) bool {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+	for _, id := range ss.shardIDs {
+		if d.retentionPolicies[id] == rp {
+			return true
+		}
+	}
+	return false
+}
+
+// decrRetentionPolicySeriesN removes a series from the count of rp. The caller
+// must hold rpMu.
+func (d *DatabaseIndex) decrRetentionPolicySeriesN(rp string) {
+	if d.rpSeriesN[rp] <= 1 {
+		delete(d.rpSeriesN, rp)
+		return
+	}
+	d.rpSeriesN[rp]--
+}
+
 // UnassignShard updates the index to indicate that series k does not exist in
 // the given shardID.
 func (d *DatabaseIndex) UnassignShard(k string, shardID uint64) {
@@ -237,7 +352,7 @@ func (d *DatabaseIndex) UnassignShard(k string, shardID uint64) {
 	if ss != nil {
 		if ss.Assigned(shardID) {
 			// Remove the shard from any series
-			ss.UnassignShard(shardID)
+			d.unassignSeriesShard(ss, shardID)
 
 			// If this series no longer has shards assigned, remove the series
 			if ss.ShardN() == 0 {
@@ -263,6 +378,22 @@ func (d *DatabaseIndex) UnassignShard(k string, shardID uint64) {
 	}
 }
 
+// StaleSeriesKeys returns the sorted keys of the series last written before t,
+// in unix nanoseconds.
+func (d *DatabaseIndex) StaleSeriesKeys(t int64) []string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	var keys []string
+	for k, ss := range d.series {
+		if ss.LastWrite() < t {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 // RemoveShard removes all references to shardID from any series or measurements
 // in the index.  If the shard was the only owner of data for the series, the series
 // is removed from the index.
@@ -270,6 +401,10 @@ func (d *DatabaseIndex) RemoveShard(shardID uint64) {
 	for _, k := range d.SeriesKeys() {
 		d.UnassignShard(k, shardID)
 	}
+
+	d.rpMu.Lock()
+	delete(d.retentionPolicies, shardID)
+	d.rpMu.Unlock()
 }
 
 // TagsForSeries returns the tag map for the passed in series
@@ -526,6 +661,7 @@ func (d *DatabaseIndex) DropSeries(keys []string) {
 		}
 		series.measurement.DropSeries(series)
 		delete(d.series, k)
+		d.dropRetentionPolicySeries(series)
 		nDeleted++
 
 		// If there are no more series in the measurement then we'll
@@ -542,6 +678,26 @@ func (d *DatabaseIndex) DropSeries(keys []string) {
 	atomic.AddInt64(&d.stats.NumSeriesDropped, nDeleted)
 }
 
+// dropRetentionPolicySeries removes a dropped series from the count of each
+// retention policy it is assigned to.
+func (d *DatabaseIndex) dropRetentionPolicySeries(ss *Series) {
+	d.rpMu.Lock()
+	defer d.rpMu.Unlock()
+
+	ss.mu.RLock()
+	rps := make(map[string]struct{})
+	for _, id := range ss.shardIDs {
+		if rp, ok := d.retentionPolicies[id]; ok {
+			rps[rp] = struct{}{}
+		}
+	}
+	ss.mu.RUnlock()
+
+	for rp := range rps {
+		d.decrRetentionPolicySeriesN(rp)
+	}
+}
+
 // Dereference removes all references to data within b and moves them to the heap.
 func (d *DatabaseIndex) Dereference(b []byte) {
 	d.mu.RLock()
@@ -1432,6 +1588,8 @@ func (a Measurements) union(other Measurements) Measurements {
 
 // Series belong to a Measurement and represent unique time series in a database.
 type Series struct {
+	lastWrite int64 // unix nanoseconds, accessed atomically
+
 	mu          sync.RWMutex
 	Key         string
 	tags        models.Tags
@@ -1448,6 +1606,16 @@ func NewSeries(key string, tags models.Tags) *Series {
 	}
 }
 
+// Touch records that the series was written at t, in unix nanoseconds.
+func (s *Series) Touch(t int64) {
+	atomic.StoreInt64(&s.lastWrite, t)
+}
+
+// LastWrite returns when the series was last written, in unix nanoseconds.
+func (s *Series) LastWrite() int64 {
+	return atomic.LoadInt64(&s.lastWrite)
+}
+
 // AssignShard adds shardID to the list of shards this series is assigned to.
 func (s *Series) AssignShard(shardID uint64) {
 	s.mu.Lock()
@@ -1607,6 +1775,22 @@ func (a SeriesIDs) Equals(other SeriesIDs) bool {
 	return true
 }
 
+// intersects returns true if the two collections have a series id in common.
+// The two collections must already be sorted.
+func (a SeriesIDs) intersects(other SeriesIDs) bool {
+	// Search the longer collection for each id of the shorter one.
+	l, r := a, other
+	if len(other) < len(a) {
+		l, r = other, a
+	}
+	for _, id := range l {
+		if i := sort.Search(len(r), func(i int) bool { return r[i] >= id }); i < len(r) && r[i] == id {
+			return true
+		}
+	}
+	return false
+}
+
 // Intersect returns a new collection of series ids in sorted order that is the intersection of the two.
 // The two collections must already be sorted.
 func (a SeriesIDs) Intersect(other SeriesIDs) SeriesIDs {
@@ -1853,6 +2037,32 @@ func (m *Measurement) TagValues(key string) []string {
 	return values
 }
 
+// WalkTagValues calls fn for each value of the given tag keys that is set on
+// at least one of the series in ids. Keys are walked in the order given and
+// the values of each key in sorted order. Walking stops when fn returns false.
+func (m *Measurement) WalkTagValues(keys []string, ids SeriesIDs, fn func(k, v string) bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, k := range keys {
+		valueMap := m.seriesByTagKeyValue[k]
+		values := make([]string, 0, len(valueMap))
+		for v := range valueMap {
+			values = append(values, v)
+		}
+		sort.Strings(values)
+
+		for _, v := range values {
+			if !valueMap[v].intersects(ids) {
+				continue
+			}
+			if !fn(k, v) {
+				return
+			}
+		}
+	}
+}
+
 // SetFieldName adds the field name to the measurement.
 func (m *Measurement) SetFieldName(name string) {
 	m.mu.RLock()
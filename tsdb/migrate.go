@@ -0,0 +1,178 @@
+package tsdb
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/lucaswiersma/influxdb/influxql"
+	"github.com/lucaswiersma/influxdb/models"
+)
+
+// ErrFieldMigrationInProgress is returned when a field is already being migrated.
+var ErrFieldMigrationInProgress = errors.New("field migration already in progress")
+
+// FieldMigration tracks the progress of migrating a field to a new type
+// across the shards of a database.
+type FieldMigration struct {
+	// Counters are accessed atomically and must stay 64-bit aligned.
+	ShardsDone     int64
+	PointsMigrated int64
+	PointsDropped  int64
+
+	Database    string
+	Measurement string
+	Field       string
+	Type        influxql.DataType
+	ShardsTotal int
+	StartedAt   time.Time
+
+	done int32
+	err  atomic.Value
+}
+
+// Done returns true once every shard has been migrated or the migration failed.
+func (m *FieldMigration) Done() bool { return atomic.LoadInt32(&m.done) == 1 }
+
+// Err returns the error that stopped the migration, if any.
+func (m *FieldMigration) Err() error {
+	err, _ := m.err.Load().(error)
+	return err
+}
+
+// status returns a description of the state of the migration.
+func (m *FieldMigration) status() string {
+	if !m.Done() {
+		return "running"
+	} else if m.Err() != nil {
+		return "failed"
+	}
+	return "done"
+}
+
+// MigrateFieldType starts rewriting the stored values of a field in every
+// shard of database to typ. The migration runs in the background and its
+// progress is reported by FieldMigration and the store's statistics.
+//
+// Shards are migrated one at a time. Each shard presents a single type for
+// the field, but until the migration is done a query spanning several shards
+// reads the new type from migrated shards and the old type from the rest.
+func (s *Store) MigrateFieldType(database, measurement, field string, typ influxql.DataType) (*FieldMigration, error) {
+	s.mu.RLock()
+	db := s.databaseIndexes[database]
+	s.mu.RUnlock()
+	if db == nil {
+		return nil, influxql.ErrDatabaseNotFound(database)
+	}
+
+	m := db.Measurement(measurement)
+	if m == nil {
+		return nil, influxql.ErrMeasurementNotFound(measurement)
+	} else if !m.HasField(field) {
+		return nil, ErrFieldNotFound
+	}
+
+	s.mu.RLock()
+	shards := s.filterShards(func(sh *Shard) bool {
+		return sh.database == database
+	})
+	s.mu.RUnlock()
+
+	migration := &FieldMigration{
+		Database:    database,
+		Measurement: m.Name,
+		Field:       field,
+		Type:        typ,
+		ShardsTotal: len(shards),
+		StartedAt:   time.Now().UTC(),
+	}
+
+	key := fieldMigrationKey(database, m.Name, field)
+	s.migrationsMu.Lock()
+	if prev := s.migrations[key]; prev != nil && !prev.Done() {
+		s.migrationsMu.Unlock()
+		return nil, ErrFieldMigrationInProgress
+	}
+	if s.migrations == nil {
+		s.migrations = make(map[string]*FieldMigration)
+	}
+	s.migrations[key] = migration
+	s.migrationsMu.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.migrateFieldType(migration, shards)
+	}()
+
+	return migration, nil
+}
+
+// migrateFieldType migrates the field in each shard in turn, stopping early
+// if the store is closed.
+func (s *Store) migrateFieldType(migration *FieldMigration, shards []*Shard) {
+	defer atomic.StoreInt32(&migration.done, 1)
+
+	for _, sh := range shards {
+		select {
+		case <-s.closing:
+			migration.err.Store(ErrStoreClosed)
+			return
+		default:
+		}
+
+		migrated, dropped, err := sh.MigrateFieldType(migration.Measurement, migration.Field, migration.Type)
+		if err == ErrEngineClosed {
+			// The shard was dropped while the migration was running.
+			atomic.AddInt64(&migration.ShardsDone, 1)
+			continue
+		} else if err != nil {
+			s.Logger.Info(fmt.Sprintf("error migrating field %s on measurement %s in shard %d: %s", migration.Field, migration.Measurement, sh.id, err))
+			migration.err.Store(fmt.Errorf("shard %d: %s", sh.id, err))
+			return
+		}
+
+		atomic.AddInt64(&migration.PointsMigrated, migrated)
+		atomic.AddInt64(&migration.PointsDropped, dropped)
+		atomic.AddInt64(&migration.ShardsDone, 1)
+	}
+}
+
+// migrationStatistics returns a statistic for each field migration.
+func (s *Store) migrationStatistics(tags map[string]string) []models.Statistic {
+	s.migrationsMu.Lock()
+	defer s.migrationsMu.Unlock()
+
+	statistics := make([]models.Statistic, 0, len(s.migrations))
+	for _, m := range s.migrations {
+		values := map[string]interface{}{
+			"type":           m.Type.String(),
+			"status":         m.status(),
+			"startedAt":      m.StartedAt.UnixNano(),
+			"shardsTotal":    int64(m.ShardsTotal),
+			"shardsDone":     atomic.LoadInt64(&m.ShardsDone),
+			"pointsMigrated": atomic.LoadInt64(&m.PointsMigrated),
+			"pointsDropped":  atomic.LoadInt64(&m.PointsDropped),
+		}
+		if err := m.Err(); err != nil {
+			values["error"] = err.Error()
+		}
+
+		statistics = append(statistics, models.Statistic{
+			Name: "field_migration",
+			Tags: models.StatisticTags{
+				"database":    m.Database,
+				"measurement": m.Measurement,
+				"field":       m.Field,
+			}.Merge(tags),
+			Values: values,
+		})
+	}
+	return statistics
+}
+
+// fieldMigrationKey returns the key a migration is tracked under.
+func fieldMigrationKey(database, measurement, field string) string {
+	return database + "\x00" + measurement + "\x00" + field
+}
@@ -0,0 +1,256 @@
+package tsdb
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lucaswiersma/influxdb/models"
+)
+
+// quarantineDir is the name of the directory, under both the data and WAL
+// directories, where dropped shards are held until they are purged.
+const quarantineDir = ".quarantine"
+
+// quarantinePurgeInterval is how often the store checks for quarantined
+// shards whose grace period has expired.
+const quarantinePurgeInterval = time.Minute
+
+// ErrShardNotQuarantined is returned when restoring a shard that is not in quarantine.
+var ErrShardNotQuarantined = fmt.Errorf("shard not quarantined")
+
+// QuarantinedShard describes a dropped shard that is held on disk until its
+// purge time so it can still be restored.
+type QuarantinedShard struct {
+	ID              uint64    `json:"id"`
+	Database        string    `json:"database"`
+	RetentionPolicy string    `json:"retentionPolicy"`
+	ShardGroupID    uint64    `json:"shardGroupID"`
+	StartTime       time.Time `json:"startTime"`
+	EndTime         time.Time `json:"endTime"`
+	DroppedAt       time.Time `json:"droppedAt"`
+	PurgeAt         time.Time `json:"purgeAt"`
+}
+
+// QuarantineShard closes the shard described by q and moves its files into
+// quarantine where they are kept for the configured shard-quarantine-duration.
+// If quarantining is disabled the shard is deleted immediately.
+func (s *Store) QuarantineShard(q QuarantinedShard) error {
+	d := time.Duration(s.EngineOptions.Config.ShardQuarantineDuration)
+	if d <= 0 {
+		return s.DeleteShard(q.ID)
+	}
+
+	sh := s.Shard(q.ID)
+	if sh == nil {
+		return nil
+	}
+
+	sh.UnloadIndex()
+	if err := sh.Close(); err != nil {
+		return err
+	}
+
+	dataPath, walPath := s.quarantinePaths(q.ID)
+	if err := os.MkdirAll(filepath.Dir(dataPath), 0700); err != nil {
+		return err
+	} else if err := os.MkdirAll(filepath.Dir(walPath), 0700); err != nil {
+		return err
+	}
+
+	if err := os.Rename(sh.path, dataPath); err != nil {
+		return err
+	}
+	if err := os.Rename(sh.walPath, walPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	q.Database, q.RetentionPolicy = sh.database, sh.retentionPolicy
+	q.DroppedAt = time.Now().UTC()
+	q.PurgeAt = q.DroppedAt.Add(d)
+
+	b, err := json.Marshal(q)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(dataPath+".json", b, 0600); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	delete(s.shards, q.ID)
+	s.mu.Unlock()
+
+	s.Logger.Info(fmt.Sprintf("shard %d quarantined until %s", q.ID, q.PurgeAt.Format(time.RFC3339)))
+	return nil
+}
+
+// UndropShard moves a quarantined shard back into place and reopens it. The
+// returned QuarantinedShard describes where the shard belonged so callers can
+// restore its meta data.
+func (s *Store) UndropShard(id uint64) (*QuarantinedShard, error) {
+	q, err := s.QuarantinedShard(id)
+	if err != nil {
+		return nil, err
+	}
+	dataPath, walPath := s.quarantinePaths(id)
+
+	rpPath := filepath.Join(s.path, q.Database, q.RetentionPolicy)
+	walRPPath := filepath.Join(s.EngineOptions.Config.WALDir, q.Database, q.RetentionPolicy)
+	if err := os.MkdirAll(rpPath, 0700); err != nil {
+		return nil, err
+	} else if err := os.MkdirAll(walRPPath, 0700); err != nil {
+		return nil, err
+	}
+
+	name := strconv.FormatUint(id, 10)
+	if err := os.Rename(dataPath, filepath.Join(rpPath, name)); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(walPath, filepath.Join(walRPPath, name)); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err := os.Remove(dataPath + ".json"); err != nil {
+		return nil, err
+	}
+
+	if err := s.CreateShard(q.Database, q.RetentionPolicy, id, true); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// QuarantinedShard returns the shard with id held in quarantine.
+func (s *Store) QuarantinedShard(id uint64) (*QuarantinedShard, error) {
+	dataPath, _ := s.quarantinePaths(id)
+	q, err := readQuarantineManifest(dataPath + ".json")
+	if os.IsNotExist(err) {
+		return nil, ErrShardNotQuarantined
+	}
+	return q, err
+}
+
+// QuarantinedShards returns all shards currently held in quarantine, ordered by ID.
+func (s *Store) QuarantinedShards() ([]QuarantinedShard, error) {
+	dir := filepath.Join(s.path, quarantineDir)
+	fis, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var a []QuarantinedShard
+	for _, fi := range fis {
+		if fi.IsDir() || !strings.HasSuffix(fi.Name(), ".json") {
+			continue
+		}
+		q, err := readQuarantineManifest(filepath.Join(dir, fi.Name()))
+		if err != nil {
+			return nil, err
+		}
+		a = append(a, *q)
+	}
+	sort.Sort(quarantinedShards(a))
+	return a, nil
+}
+
+// PurgeQuarantinedShards permanently deletes quarantined shards whose purge
+// time has passed.
+func (s *Store) PurgeQuarantinedShards() error {
+	shards, err := s.QuarantinedShards()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, q := range shards {
+		if now.Before(q.PurgeAt) {
+			continue
+		}
+
+		dataPath, walPath := s.quarantinePaths(q.ID)
+		if err := os.RemoveAll(dataPath); err != nil {
+			return err
+		} else if err := os.RemoveAll(walPath); err != nil {
+			return err
+		} else if err := os.Remove(dataPath + ".json"); err != nil {
+			return err
+		}
+		s.Logger.Info(fmt.Sprintf("purged quarantined shard %d", q.ID))
+	}
+	return nil
+}
+
+// monitorQuarantine periodically purges expired quarantined shards.
+func (s *Store) monitorQuarantine() {
+	t := time.NewTicker(quarantinePurgeInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-s.closing:
+			return
+		case <-t.C:
+			if err := s.PurgeQuarantinedShards(); err != nil {
+				s.Logger.Info(fmt.Sprintf("error purging quarantined shards: %s", err))
+			}
+		}
+	}
+}
+
+// quarantineStatistics returns a statistic for each quarantined shard.
+func (s *Store) quarantineStatistics(tags map[string]string) []models.Statistic {
+	shards, err := s.QuarantinedShards()
+	if err != nil {
+		return nil
+	}
+
+	statistics := make([]models.Statistic, 0, len(shards))
+	for _, q := range shards {
+		statistics = append(statistics, models.Statistic{
+			Name: "quarantined_shard",
+			Tags: models.StatisticTags{
+				"id":              strconv.FormatUint(q.ID, 10),
+				"database":        q.Database,
+				"retentionPolicy": q.RetentionPolicy,
+			}.Merge(tags),
+			Values: map[string]interface{}{
+				"droppedAt": q.DroppedAt.UnixNano(),
+				"purgeAt":   q.PurgeAt.UnixNano(),
+			},
+		})
+	}
+	return statistics
+}
+
+// quarantinePaths returns the quarantine locations for a shard's data and WAL.
+func (s *Store) quarantinePaths(id uint64) (dataPath, walPath string) {
+	name := strconv.FormatUint(id, 10)
+	return filepath.Join(s.path, quarantineDir, name),
+		filepath.Join(s.EngineOptions.Config.WALDir, quarantineDir, name)
+}
+
+type quarantinedShards []QuarantinedShard
+
+func (a quarantinedShards) Len() int           { return len(a) }
+func (a quarantinedShards) Less(i, j int) bool { return a[i].ID < a[j].ID }
+func (a quarantinedShards) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+
+func readQuarantineManifest(path string) (*QuarantinedShard, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var q QuarantinedShard
+	if err := json.Unmarshal(b, &q); err != nil {
+		return nil, fmt.Errorf("invalid quarantine manifest %s: %s", path, err)
+	}
+	return &q, nil
+}
@@ -0,0 +1,67 @@
+package tsdb
+
+import (
+	"sync"
+	"time"
+)
+
+// RecentWriteHorizon is how long a shard remembers the time ranges of the
+// points written to it.
+const RecentWriteHorizon = 10 * time.Minute
+
+// recentWrite is the time range of the points written to a shard within
+// a single second.
+type recentWrite struct {
+	at       int64 // unix seconds
+	min, max int64 // unix nanoseconds
+}
+
+// recentWrites tracks the time ranges of points recently written to a shard
+// so queries can tell if data in their time range may still be arriving.
+// Writes within the same second are coalesced so at most one entry per
+// second of the horizon is kept.
+type recentWrites struct {
+	mu     sync.Mutex
+	writes []recentWrite
+}
+
+// add records that points between min and max were written at now.
+func (r *recentWrites) add(now time.Time, min, max int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	at := now.Unix()
+	if n := len(r.writes); n > 0 && r.writes[n-1].at == at {
+		w := &r.writes[n-1]
+		if min < w.min {
+			w.min = min
+		}
+		if max > w.max {
+			w.max = max
+		}
+		return
+	}
+
+	// Drop writes that have fallen out of the horizon.
+	expired := at - int64(RecentWriteHorizon/time.Second)
+	i := 0
+	for i < len(r.writes) && r.writes[i].at < expired {
+		i++
+	}
+	r.writes = append(r.writes[i:], recentWrite{at: at, min: min, max: max})
+}
+
+// overlaps returns true if points between min and max were written since
+// the given time.
+func (r *recentWrites) overlaps(since time.Time, min, max int64) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	at := since.Unix()
+	for i := len(r.writes) - 1; i >= 0 && r.writes[i].at >= at; i-- {
+		if w := r.writes[i]; w.min <= max && w.max >= min {
+			return true
+		}
+	}
+	return false
+}
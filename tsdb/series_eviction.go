@@ -0,0 +1,88 @@
+package tsdb
+
+import (
+	"fmt"
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// EvictStaleSeries drops the series of a database that have not been written
+// to since before the given time from the index and deletes their data from
+// every shard. Returns the number of series evicted.
+func (s *Store) EvictStaleSeries(database string, before time.Time) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	db := s.databaseIndexes[database]
+	if db == nil {
+		return 0, nil
+	}
+
+	keys := db.StaleSeriesKeys(before.UnixNano())
+	if len(keys) == 0 {
+		return 0, nil
+	}
+
+	if err := s.deleteSeries(database, keys, math.MinInt64, math.MaxInt64); err != nil {
+		return 0, err
+	}
+
+	// Series written to while they were deleted stay in the index.
+	var n int
+	for _, k := range keys {
+		if db.Series(k) == nil {
+			n++
+		}
+	}
+	atomic.AddInt64(&db.stats.NumSeriesEvicted, int64(n))
+	return n, nil
+}
+
+// monitorSeriesEviction periodically evicts the stale series of each database
+// series eviction is enabled for.
+func (s *Store) monitorSeriesEviction() {
+	t := time.NewTicker(time.Duration(s.EngineOptions.Config.SeriesEvictionCheckInterval))
+	defer t.Stop()
+	for {
+		select {
+		case <-s.closing:
+			return
+		case <-t.C:
+			s.evictStaleSeries()
+		}
+	}
+}
+
+// evictStaleSeries evicts the series that have not been written to within the
+// series eviction period.
+func (s *Store) evictStaleSeries() {
+	before := time.Now().Add(-time.Duration(s.EngineOptions.Config.SeriesEvictionPeriod))
+	for _, database := range s.Databases() {
+		if !s.seriesEvictionEnabled(database) {
+			continue
+		}
+
+		n, err := s.EvictStaleSeries(database, before)
+		if err != nil {
+			s.Logger.Info(fmt.Sprintf("error evicting stale series from database %s: %s", database, err))
+		} else if n > 0 {
+			s.Logger.Info(fmt.Sprintf("evicted %d stale series from database %s", n, database))
+		}
+	}
+}
+
+// seriesEvictionEnabled returns true if stale series are evicted from the
+// database.
+func (s *Store) seriesEvictionEnabled(database string) bool {
+	databases := s.EngineOptions.Config.SeriesEvictionDatabases
+	if len(databases) == 0 {
+		return true
+	}
+	for _, name := range databases {
+		if name == database {
+			return true
+		}
+	}
+	return false
+}
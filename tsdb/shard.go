@@ -5,14 +5,17 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gogo/protobuf/proto"
 	"github.com/lucaswiersma/influxdb/influxql"
@@ -34,8 +37,16 @@ const (
 	statWritePointsErr     = "writePointsErr"
 	statWritePointsDropped = "writePointsDropped"
 	statWritePointsOK      = "writePointsOk"
+	statWritePointsDup     = "writePointsDuplicate"
+	statWritePointsOOO     = "writePointsOutOfOrder"
+	statOversizedRejected  = "writeOversizedRejected"
+	statOversizedIsolated  = "writeOversizedIsolated"
+	statLongTagRejected    = "writeLongTagValueRejected"
+	statLongTagTruncated   = "writeLongTagValueTruncated"
 	statWriteBytes         = "writeBytes"
 	statDiskBytes          = "diskBytes"
+	statWriteWALErr        = "writeWALErr"
+	statReadOnly           = "readOnly"
 )
 
 var (
@@ -59,6 +70,10 @@ var (
 	// ErrShardDisabled is returned when a the shard is not available for
 	// queries or writes.
 	ErrShardDisabled = errors.New("shard is disabled")
+
+	// ErrShardReadOnly is returned when writing to a shard that stopped
+	// accepting writes after a write to its WAL failed.
+	ErrShardReadOnly = errors.New("shard is read-only after a WAL write failure")
 )
 
 var (
@@ -66,6 +81,14 @@ var (
 	timeBytes = []byte("time")
 )
 
+// DuplicateSequenceTagKey is the tag key added to colliding points when the
+// "sequence" duplicate point policy is in use.
+const DuplicateSequenceTagKey = "_seq"
+
+// TruncatedTagKey is the tag key added to points whose tag values were
+// shortened by the "truncate" long tag value policy.
+const TruncatedTagKey = "_truncated"
+
 // A ShardError implements the error interface, and contains extra
 // context about the shard that generated the error.
 type ShardError struct {
@@ -97,6 +120,16 @@ func (e PartialWriteError) Error() string {
 	return fmt.Sprintf("%s dropped=%d", e.Reason, e.Dropped)
 }
 
+// WALWriteError is returned by an engine when points could not be written to
+// its WAL, for example because the disk is full.
+type WALWriteError struct {
+	Err error
+}
+
+func (e WALWriteError) Error() string {
+	return fmt.Sprintf("WAL write failed: %s", e.Err)
+}
+
 // Shard represents a self-contained time series database. An inverted index of
 // the measurement and tag data is kept along with the raw time series data.
 // Data can be split across many shards. The query engine in TSDB is responsible
@@ -117,10 +150,22 @@ type Shard struct {
 	closing chan struct{}
 	enabled bool
 
+	// readOnly is 1 while writes are rejected after a WAL write failure.
+	// Accessed atomically.
+	readOnly int32
+
 	// expvar-based stats.
 	stats       *ShardStatistics
 	defaultTags models.StatisticTags
 
+	// recent holds the time ranges of recently written points.
+	recent recentWrites
+
+	// monotonic is the set of measurements whose points must be written in
+	// timestamp order, and maxTimes the newest timestamp of their series.
+	monotonic map[string]struct{}
+	maxTimes  seriesMaxTimes
+
 	baseLogger zap.Logger
 	logger     zap.Logger
 
@@ -131,6 +176,15 @@ type Shard struct {
 func NewShard(id uint64, index *DatabaseIndex, path string, walPath string, options EngineOptions) *Shard {
 	db, rp := DecodeStorePath(path)
 	logger := zap.New(zap.NullEncoder())
+
+	var monotonic map[string]struct{}
+	if len(options.Config.MonotonicMeasurements) > 0 {
+		monotonic = make(map[string]struct{}, len(options.Config.MonotonicMeasurements))
+		for _, name := range options.Config.MonotonicMeasurements {
+			monotonic[name] = struct{}{}
+		}
+	}
+
 	s := &Shard{
 		index:   index,
 		id:      id,
@@ -151,6 +205,7 @@ func NewShard(id uint64, index *DatabaseIndex, path string, walPath string, opti
 
 		database:        db,
 		retentionPolicy: rp,
+		monotonic:       monotonic,
 
 		logger:       logger,
 		baseLogger:   logger,
@@ -181,6 +236,14 @@ func (s *Shard) SetEnabled(enabled bool) {
 	s.mu.Unlock()
 }
 
+// setWritesEnabled enables or disables writes and queries to the shard while
+// leaving its engine running, so it can still be snapshotted.
+func (s *Shard) setWritesEnabled(enabled bool) {
+	s.mu.Lock()
+	s.enabled = enabled
+	s.mu.Unlock()
+}
+
 // ShardStatistics maintains statistics for a shard.
 type ShardStatistics struct {
 	WriteReq           int64
@@ -191,8 +254,15 @@ type ShardStatistics struct {
 	WritePointsErr     int64
 	WritePointsDropped int64
 	WritePointsOK      int64
+	WritePointsDup     int64
+	WritePointsOOO     int64
+	OversizedRejected  int64
+	OversizedIsolated  int64
+	LongTagRejected    int64
+	LongTagTruncated   int64
 	BytesWritten       int64
 	DiskBytes          int64
+	WriteWALErr        int64
 }
 
 // Statistics returns statistics for periodic monitoring.
@@ -215,8 +285,16 @@ func (s *Shard) Statistics(tags map[string]string) []models.Statistic {
 			statWritePointsErr:     atomic.LoadInt64(&s.stats.WritePointsErr),
 			statWritePointsDropped: atomic.LoadInt64(&s.stats.WritePointsDropped),
 			statWritePointsOK:      atomic.LoadInt64(&s.stats.WritePointsOK),
+			statWritePointsDup:     atomic.LoadInt64(&s.stats.WritePointsDup),
+			statWritePointsOOO:     atomic.LoadInt64(&s.stats.WritePointsOOO),
+			statOversizedRejected:  atomic.LoadInt64(&s.stats.OversizedRejected),
+			statOversizedIsolated:  atomic.LoadInt64(&s.stats.OversizedIsolated),
+			statLongTagRejected:    atomic.LoadInt64(&s.stats.LongTagRejected),
+			statLongTagTruncated:   atomic.LoadInt64(&s.stats.LongTagTruncated),
 			statWriteBytes:         atomic.LoadInt64(&s.stats.BytesWritten),
 			statDiskBytes:          atomic.LoadInt64(&s.stats.DiskBytes),
+			statWriteWALErr:        atomic.LoadInt64(&s.stats.WriteWALErr),
+			statReadOnly:           int64(atomic.LoadInt32(&s.readOnly)),
 		},
 	}}
 	statistics = append(statistics, s.engine.Statistics(tags)...)
@@ -256,6 +334,7 @@ func (s *Shard) Open() error {
 
 		// Load metadata index.
 		start := time.Now()
+		s.index.SetShardRetentionPolicy(s.id, s.retentionPolicy)
 		if err := e.LoadMetadataIndex(s.id, s.index); err != nil {
 			return err
 		}
@@ -389,6 +468,10 @@ func (s *Shard) WritePoints(points []models.Point) error {
 	if err := s.ready(); err != nil {
 		return err
 	}
+	if atomic.LoadInt32(&s.readOnly) == 1 {
+		atomic.AddInt64(&s.stats.WriteReqErr, 1)
+		return ErrShardReadOnly
+	}
 
 	var writeError error
 
@@ -417,14 +500,82 @@ func (s *Shard) WritePoints(points []models.Point) error {
 	if err := s.engine.WritePoints(points); err != nil {
 		atomic.AddInt64(&s.stats.WritePointsErr, int64(len(points)))
 		atomic.AddInt64(&s.stats.WriteReqErr, 1)
+		if _, ok := err.(WALWriteError); ok {
+			s.walWriteFailed(err)
+		}
 		return fmt.Errorf("engine: %s", err)
 	}
 	atomic.AddInt64(&s.stats.WritePointsOK, int64(len(points)))
 	atomic.AddInt64(&s.stats.WriteReqOK, 1)
 
+	if len(points) > 0 {
+		min, max := points[0].UnixNano(), points[0].UnixNano()
+		for _, p := range points[1:] {
+			if ts := p.UnixNano(); ts < min {
+				min = ts
+			} else if ts > max {
+				max = ts
+			}
+		}
+		s.recent.add(time.Now(), min, max)
+	}
+
 	return writeError
 }
 
+// walWriteFailed records a failed WAL write and, depending on the WAL failure
+// policy, stops writes to the shard until the WAL can be written again.
+func (s *Shard) walWriteFailed(err error) {
+	atomic.AddInt64(&s.stats.WriteWALErr, 1)
+	if s.options.Config.WALFailurePolicy != WALFailureReadOnly {
+		return
+	}
+	if atomic.CompareAndSwapInt32(&s.readOnly, 0, 1) {
+		s.logger.Info(fmt.Sprintf("shard %d is read-only until its WAL can be written: %s", s.id, err))
+	}
+}
+
+// checkWAL makes a read-only shard writable again once a file can be written
+// to its WAL directory.
+func (s *Shard) checkWAL() {
+	if atomic.LoadInt32(&s.readOnly) == 0 {
+		return
+	}
+
+	if err := writeProbeFile(s.walPath); err != nil {
+		s.logger.Info(fmt.Sprintf("shard %d WAL is still not writable: %s", s.id, err))
+		return
+	}
+	if atomic.CompareAndSwapInt32(&s.readOnly, 1, 0) {
+		s.logger.Info(fmt.Sprintf("shard %d WAL is writable again, accepting writes", s.id))
+	}
+}
+
+// writeProbeFile writes and syncs a temporary file in dir.
+func writeProbeFile(dir string) error {
+	f, err := ioutil.TempFile(dir, "probe")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(make([]byte, 4096)); err != nil {
+		f.Close()
+		return err
+	} else if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// WrittenSince returns true if points between min and max were written to
+// the shard since the given time. Writes are only remembered for the
+// RecentWriteHorizon.
+func (s *Shard) WrittenSince(since, min, max time.Time) bool {
+	return s.recent.overlaps(since, min.UnixNano(), max.UnixNano())
+}
+
 // ContainsSeries determines if the shard contains the provided series keys. The
 // returned map contains all the provided keys that are in the shard, and the
 // value for each key will be true if the shard has values for that key.
@@ -444,6 +595,7 @@ func (s *Shard) DeleteSeries(seriesKeys []string) error {
 	if err := s.engine.DeleteSeries(seriesKeys); err != nil {
 		return err
 	}
+	s.maxTimes.reset()
 	return nil
 }
 
@@ -456,6 +608,7 @@ func (s *Shard) DeleteSeriesRange(seriesKeys []string, min, max int64) error {
 	if err := s.engine.DeleteSeriesRange(seriesKeys, min, max); err != nil {
 		return err
 	}
+	s.maxTimes.reset()
 
 	return nil
 }
@@ -469,10 +622,50 @@ func (s *Shard) DeleteMeasurement(name string, seriesKeys []string) error {
 	if err := s.engine.DeleteMeasurement(name, seriesKeys); err != nil {
 		return err
 	}
+	s.maxTimes.reset()
 
 	return nil
 }
 
+// MigrateFieldType rewrites the stored values of a field to a new type.
+// It returns the number of values converted and the number dropped because
+// they could not be represented by the new type.
+func (s *Shard) MigrateFieldType(measurement, field string, typ influxql.DataType) (migrated, dropped int64, err error) {
+	if err := s.ready(); err != nil {
+		return 0, 0, err
+	}
+	return s.engine.MigrateFieldType(measurement, field, typ)
+}
+
+// Defragment rewrites the shard's files so the blocks of each series are
+// contiguous. It returns the fragmentation of the files before and after.
+func (s *Shard) Defragment() (before, after Fragmentation, err error) {
+	if err := s.ready(); err != nil {
+		return before, after, err
+	}
+	return s.engine.Defragment()
+}
+
+// Verify checks the checksums of the blocks in the shard's files. wait is
+// called with the size of each block read and can throttle or stop the scan.
+// Files with corrupt blocks are removed from the shard if quarantine is true.
+func (s *Shard) Verify(wait func(n int) error, quarantine bool) (VerifyStats, error) {
+	if err := s.ready(); err != nil {
+		return VerifyStats{}, err
+	}
+	return s.engine.Verify(wait, quarantine)
+}
+
+// Precompact writes the shard's cache to disk and compacts all of its files
+// together. It is used before a shard expires so that queries rolling up its
+// data read as few files as possible.
+func (s *Shard) Precompact() error {
+	if err := s.ready(); err != nil {
+		return err
+	}
+	return s.engine.Precompact()
+}
+
 func (s *Shard) createFieldsAndMeasurements(fieldsToCreate []*FieldCreate) error {
 	if len(fieldsToCreate) == 0 {
 		return nil
@@ -495,6 +688,13 @@ func (s *Shard) createFieldsAndMeasurements(fieldsToCreate []*FieldCreate) error
 	return nil
 }
 
+// maxSeriesPerRetentionPolicyReason returns the reason a point is dropped when
+// the series limit of the shard's retention policy is exceeded.
+func (s *Shard) maxSeriesPerRetentionPolicyReason(maxSeries int) string {
+	return fmt.Sprintf("max-series-per-retention-policy limit exceeded: db=%s rp=%s (%d/%d)",
+		s.database, s.retentionPolicy, s.index.RetentionPolicySeriesN(s.retentionPolicy), maxSeries)
+}
+
 // validateSeriesAndFields checks which series and fields are new and whose metadata should be saved and indexed.
 func (s *Shard) validateSeriesAndFields(points []models.Point) ([]models.Point, []*FieldCreate, error) {
 	var (
@@ -503,6 +703,27 @@ func (s *Shard) validateSeriesAndFields(points []models.Point) ([]models.Point,
 		dropped, n     int
 		reason         string
 	)
+
+	if maxLen, policy := s.options.Config.TagValueLimitFor(s.database); maxLen > 0 {
+		points, dropped, reason = s.checkTagValueLengths(points, maxLen, policy)
+	}
+
+	var duplicates int
+	var duplicateReason string
+	if points, duplicates, duplicateReason = s.resolveDuplicatePoints(points); duplicates > 0 {
+		dropped += duplicates
+		reason = duplicateReason
+	}
+
+	if s.options.Config.MaxFieldValueSize > 0 {
+		var oversized int
+		var oversizedReason string
+		if points, oversized, oversizedReason = s.checkFieldValueSizes(points); oversized > 0 {
+			dropped += oversized
+			reason = oversizedReason
+		}
+	}
+
 	if s.options.Config.MaxValuesPerTag > 0 {
 		// Validate that all the new points would not exceed any limits, if so, we drop them
 		// and record why/increment counters
@@ -544,6 +765,8 @@ func (s *Shard) validateSeriesAndFields(points []models.Point) ([]models.Point,
 	// get the shard mutex for locally defined fields
 	n = 0
 	var skip bool
+	now := time.Now().UnixNano()
+	maxSeries := s.options.Config.MaxSeriesFor(s.database, s.retentionPolicy)
 	for i, p := range points {
 		skip = false
 		// verify the tags and fields
@@ -582,12 +805,33 @@ func (s *Shard) validateSeriesAndFields(points []models.Point) ([]models.Point,
 				continue
 			}
 
+			if maxSeries > 0 && s.index.RetentionPolicySeriesN(s.retentionPolicy)+1 > maxSeries {
+				atomic.AddInt64(&s.stats.WritePointsDropped, 1)
+				dropped++
+				reason = s.maxSeriesPerRetentionPolicyReason(maxSeries)
+				continue
+			}
+
 			ss = s.index.CreateSeriesIndexIfNotExists(p.Name(), NewSeries(string(p.Key()), tags), true)
 			atomic.AddInt64(&s.stats.SeriesCreated, 1)
 		}
 
 		if !ss.Assigned(s.id) {
-			ss.AssignShard(s.id)
+			// The series may already count towards the retention policy
+			// through another of its shards.
+			if maxSeries > 0 && !s.index.SeriesInRetentionPolicy(ss, s.retentionPolicy) &&
+				s.index.RetentionPolicySeriesN(s.retentionPolicy)+1 > maxSeries {
+				atomic.AddInt64(&s.stats.WritePointsDropped, 1)
+				dropped++
+				reason = s.maxSeriesPerRetentionPolicyReason(maxSeries)
+				continue
+			}
+			s.index.AssignSeriesShard(ss, s.id)
+		}
+
+		// Record the write so the series isn't evicted as stale.
+		if s.options.Config.SeriesEvictionEnabled {
+			ss.Touch(now)
 		}
 
 		// see if the field definitions need to be saved to the shard
@@ -668,6 +912,15 @@ func (s *Shard) validateSeriesAndFields(points []models.Point) ([]models.Point,
 	}
 	points = points[:n]
 
+	if s.monotonic != nil {
+		var outOfOrder int
+		var outOfOrderReason string
+		if points, outOfOrder, outOfOrderReason = s.checkTimestampOrder(points); outOfOrder > 0 {
+			dropped += outOfOrder
+			reason = outOfOrderReason
+		}
+	}
+
 	if dropped > 0 {
 		err = PartialWriteError{Reason: reason, Dropped: dropped}
 	}
@@ -675,6 +928,184 @@ func (s *Shard) validateSeriesAndFields(points []models.Point) ([]models.Point,
 	return points, fieldsToCreate, err
 }
 
+// resolveDuplicatePoints applies the configured duplicate point policy to points
+// in the batch that share a series key and timestamp but have different field
+// values. Identical duplicates are left alone since they can't lose data. It
+// returns the remaining points along with the number dropped and the reason.
+func (s *Shard) resolveDuplicatePoints(points []models.Point) ([]models.Point, int, string) {
+	policy := s.options.Config.DuplicatePointPolicy
+	if policy == "" || policy == DuplicatePointLast || len(points) < 2 {
+		return points, 0, ""
+	}
+
+	type seriesTime struct {
+		key string
+		ts  int64
+	}
+
+	var (
+		dropped int
+		reason  string
+		n       int
+	)
+	seen := make(map[seriesTime]int, len(points))
+	seq := make(map[seriesTime]int)
+	for i, p := range points {
+		k := seriesTime{key: string(p.Key()), ts: p.UnixNano()}
+		j, ok := seen[k]
+		if !ok {
+			seen[k] = n
+			points[n] = points[i]
+			n++
+			continue
+		}
+
+		if equalPointFields(points[j], p) {
+			points[n] = points[i]
+			n++
+			continue
+		}
+		atomic.AddInt64(&s.stats.WritePointsDup, 1)
+
+		switch policy {
+		case DuplicatePointSequence:
+			seq[k]++
+			p.AddTag(DuplicateSequenceTagKey, strconv.Itoa(seq[k]))
+			points[n] = p
+			n++
+		case DuplicatePointReject:
+			atomic.AddInt64(&s.stats.WritePointsDropped, 1)
+			dropped++
+			reason = fmt.Sprintf("duplicate point rejected: series=%q time=%d", k.key, k.ts)
+		default:
+			// Keep-first silently discards the later point.
+			atomic.AddInt64(&s.stats.WritePointsDropped, 1)
+		}
+	}
+	return points[:n], dropped, reason
+}
+
+// checkFieldValueSizes applies the oversized field policy to points with a
+// string field value larger than the max-field-value-size. It returns the
+// remaining points along with the number dropped and the reason.
+func (s *Shard) checkFieldValueSizes(points []models.Point) ([]models.Point, int, string) {
+	var (
+		dropped int
+		reason  string
+		n       int
+	)
+	maxSize := s.options.Config.MaxFieldValueSize
+	for _, p := range points {
+		var oversized bool
+		iter := p.FieldIterator()
+		for iter.Next() {
+			if iter.Type() != models.String {
+				continue
+			}
+			if sz := len(iter.StringValue()); sz > maxSize {
+				oversized = true
+				reason = fmt.Sprintf("max-field-value-size limit exceeded (%d/%d): measurement=%q field=%q", sz, maxSize, p.Name(), iter.FieldKey())
+				break
+			}
+		}
+
+		if oversized {
+			if s.options.Config.OversizedFieldPolicy == OversizedFieldIsolate {
+				atomic.AddInt64(&s.stats.OversizedIsolated, 1)
+			} else {
+				atomic.AddInt64(&s.stats.OversizedRejected, 1)
+				atomic.AddInt64(&s.stats.WritePointsDropped, 1)
+				dropped++
+				continue
+			}
+		}
+		points[n] = p
+		n++
+	}
+
+	if dropped == 0 {
+		reason = ""
+	}
+	return points[:n], dropped, reason
+}
+
+// checkTagValueLengths applies the long tag value policy to points with a tag
+// value longer than maxLen bytes. It returns the remaining points along with
+// the number dropped and the reason.
+func (s *Shard) checkTagValueLengths(points []models.Point, maxLen int, policy string) ([]models.Point, int, string) {
+	var (
+		dropped int
+		reason  string
+		n       int
+	)
+	for _, p := range points {
+		tags := p.Tags()
+		long := -1
+		for i, t := range tags {
+			if len(t.Value) > maxLen {
+				long = i
+				break
+			}
+		}
+
+		if long >= 0 {
+			if policy == LongTagValueTruncate {
+				truncated := make(models.Tags, len(tags))
+				copy(truncated, tags)
+				for i, t := range truncated {
+					if len(t.Value) > maxLen {
+						truncated[i].Value = truncateTagValue(t.Value, maxLen)
+					}
+				}
+				truncated.Set([]byte(TruncatedTagKey), []byte("true"))
+				p.SetTags(truncated)
+				atomic.AddInt64(&s.stats.LongTagTruncated, 1)
+			} else {
+				reason = fmt.Sprintf("max-tag-value-length limit exceeded (%d/%d): measurement=%q tag=%q",
+					len(tags[long].Value), maxLen, p.Name(), tags[long].Key)
+				atomic.AddInt64(&s.stats.LongTagRejected, 1)
+				atomic.AddInt64(&s.stats.WritePointsDropped, 1)
+				dropped++
+				continue
+			}
+		}
+		points[n] = p
+		n++
+	}
+	return points[:n], dropped, reason
+}
+
+// truncateTagValue returns the first n bytes of v, or fewer so a multi-byte
+// UTF-8 character is not split unless it is longer than n.
+func truncateTagValue(v []byte, n int) []byte {
+	i := n
+	for i > 0 && !utf8.RuneStart(v[i]) {
+		i--
+	}
+	if i == 0 {
+		i = n
+	}
+	return v[:i:i]
+}
+
+// equalPointFields returns true if a and b have the same field set.
+func equalPointFields(a, b models.Point) bool {
+	af, err := a.Fields()
+	if err != nil {
+		return false
+	}
+	bf, err := b.Fields()
+	if err != nil || len(af) != len(bf) {
+		return false
+	}
+	for k, v := range af {
+		if bv, ok := bf[k]; !ok || bv != v {
+			return false
+		}
+	}
+	return true
+}
+
 // SeriesCount returns the number of series buckets on the shard.
 func (s *Shard) SeriesCount() (int, error) {
 	if err := s.ready(); err != nil {
@@ -780,6 +1211,35 @@ func (s *Shard) FieldDimensions(measurements []string) (fields map[string]influx
 	return
 }
 
+// SeriesN returns the number of series of the measurement stored in the
+// shard that match the tag filters in condition. Field and time filters
+// are ignored so the count is an upper bound for the series a query reads.
+func (s *Shard) SeriesN(measurement string, condition influxql.Expr) (int, error) {
+	var n int
+	err := s.walkSeries(measurement, condition, func(*Series) { n++ })
+	return n, err
+}
+
+// walkSeries calls fn for each series of the measurement stored in the shard
+// that matches the tag filters in condition.
+func (s *Shard) walkSeries(measurement string, condition influxql.Expr, fn func(*Series)) error {
+	mm := s.index.Measurement(measurement)
+	if mm == nil {
+		return nil
+	}
+
+	ids, err := mm.SeriesIDsAllOrByExpr(condition)
+	if err != nil {
+		return err
+	}
+	for _, ss := range mm.SeriesByIDSlice(ids) {
+		if ss != nil && ss.Assigned(s.id) {
+			fn(ss)
+		}
+	}
+	return nil
+}
+
 func (s *Shard) MeasurementsByRegex(re *regexp.Regexp) []string {
 	mms := s.index.MeasurementsByRegex(re)
 	names := make([]string, len(mms))
@@ -901,6 +1361,39 @@ func (s *Shard) Restore(r io.Reader, basePath string) error {
 	return s.Open()
 }
 
+// Import imports data to the underlying engine for the shard, keeping any
+// existing data. The shard is reopened after import.
+func (s *Shard) Import(r io.Reader, basePath string) error {
+	s.mu.Lock()
+
+	// Import to engine.
+	if err := s.engine.Import(r, basePath); err != nil {
+		s.mu.Unlock()
+		return err
+	}
+
+	s.mu.Unlock()
+
+	// Close shard.
+	if err := s.Close(); err != nil {
+		return err
+	}
+
+	// Reopen engine.
+	return s.Open()
+}
+
+// Export writes the shard's data to w as line protocol. Disabled shards can
+// still be exported.
+func (s *Shard) Export(w io.Writer) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.engine == nil {
+		return ErrEngineClosed
+	}
+	return s.engine.Export(w)
+}
+
 // CreateSnapshot will return a path to a temp directory
 // containing hard links to the underlying shard files.
 func (s *Shard) CreateSnapshot() (string, error) {
@@ -916,6 +1409,14 @@ func (s *Shard) monitor() {
 	defer t2.Stop()
 	var changed time.Time
 
+	// Read-only shards check whether their WAL can be written again.
+	var walCheck <-chan time.Time
+	if s.options.Config.WALFailurePolicy == WALFailureReadOnly {
+		t3 := time.NewTicker(time.Duration(s.options.Config.WALRecoveryCheckInterval))
+		defer t3.Stop()
+		walCheck = t3.C
+	}
+
 	for {
 		select {
 		case <-s.closing:
@@ -936,6 +1437,8 @@ func (s *Shard) monitor() {
 			}
 			atomic.StoreInt64(&s.stats.DiskBytes, size)
 			changed = lm
+		case <-walCheck:
+			s.checkWAL()
 		case <-t2.C:
 			if s.options.Config.MaxValuesPerTag == 0 {
 				continue
@@ -966,8 +1469,11 @@ type ShardGroup interface {
 	MeasurementsByRegex(re *regexp.Regexp) []string
 	FieldDimensions(measurements []string) (fields map[string]influxql.DataType, dimensions map[string]struct{}, err error)
 	MapType(measurement, field string) influxql.DataType
+	FieldTypes(measurement, field string) []influxql.DataType
 	CreateIterator(measurement string, opt influxql.IteratorOptions) (influxql.Iterator, error)
 	ExpandSources(sources influxql.Sources) (influxql.Sources, error)
+	SeriesN(measurement string, condition influxql.Expr) (int, error)
+	WrittenSince(since, min, max time.Time) bool
 }
 
 // Shards represents a sortable list of shards.
@@ -1034,6 +1540,18 @@ func (a Shards) MapType(measurement, field string) influxql.DataType {
 	return typ
 }
 
+// FieldTypes returns the type of a field in each shard that has it, in the
+// order of the shards.
+func (a Shards) FieldTypes(measurement, field string) []influxql.DataType {
+	var types []influxql.DataType
+	for _, sh := range a {
+		if t := sh.MapType(measurement, field); t != influxql.Unknown {
+			types = append(types, t)
+		}
+	}
+	return types
+}
+
 func (a Shards) CreateIterator(measurement string, opt influxql.IteratorOptions) (influxql.Iterator, error) {
 	itrs := make([]influxql.Iterator, 0, len(a))
 	for _, sh := range a {
@@ -1058,6 +1576,31 @@ func (a Shards) CreateIterator(measurement string, opt influxql.IteratorOptions)
 	return influxql.Iterators(itrs).Merge(opt)
 }
 
+// SeriesN returns the number of distinct series of the measurement across
+// all shards that match the tag filters in condition.
+func (a Shards) SeriesN(measurement string, condition influxql.Expr) (int, error) {
+	set := make(map[*Series]struct{})
+	for _, sh := range a {
+		if err := sh.walkSeries(measurement, condition, func(ss *Series) {
+			set[ss] = struct{}{}
+		}); err != nil {
+			return 0, err
+		}
+	}
+	return len(set), nil
+}
+
+// WrittenSince returns true if points between min and max were written to
+// any of the shards since the given time.
+func (a Shards) WrittenSince(since, min, max time.Time) bool {
+	for _, sh := range a {
+		if sh.WrittenSince(since, min, max) {
+			return true
+		}
+	}
+	return false
+}
+
 func (a Shards) ExpandSources(sources influxql.Sources) (influxql.Sources, error) {
 	// Use a map as a set to prevent duplicates.
 	set := map[string]influxql.Source{}
@@ -1176,6 +1719,23 @@ func (m *MeasurementFields) CreateFieldIfNotExists(name string, typ influxql.Dat
 	return nil
 }
 
+// SetFieldType changes the type of an existing field. Returns ErrFieldNotFound
+// if the field does not exist.
+func (m *MeasurementFields) SetFieldType(name string, typ influxql.DataType) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f := m.fields[name]
+	if f == nil {
+		return ErrFieldNotFound
+	}
+
+	// Replace the field rather than updating it in place since callers read
+	// the type of a returned field without holding the lock.
+	m.fields[name] = &Field{ID: f.ID, Name: f.Name, Type: typ}
+	return nil
+}
+
 // Field returns the field for name, or nil if there is no field for name.
 func (m *MeasurementFields) Field(name string) *Field {
 	m.mu.RLock()
@@ -8,6 +8,7 @@ import (
 	"path"
 	"path/filepath"
 	"reflect"
+	"sort"
 	"strings"
 	"sync"
 	"testing"
@@ -17,6 +18,7 @@ import (
 	"github.com/lucaswiersma/influxdb/influxql"
 	"github.com/lucaswiersma/influxdb/models"
 	"github.com/lucaswiersma/influxdb/pkg/deep"
+	"github.com/lucaswiersma/influxdb/toml"
 	"github.com/lucaswiersma/influxdb/tsdb"
 	_ "github.com/lucaswiersma/influxdb/tsdb/engine"
 	"go.uber.org/zap"
@@ -150,6 +152,142 @@ func TestMaxSeriesLimit(t *testing.T) {
 	sh.Close()
 }
 
+func TestShard_MaxSeriesPerRetentionPolicyLimit(t *testing.T) {
+	tmpDir, _ := ioutil.TempDir("", "shard_test")
+	defer os.RemoveAll(tmpDir)
+	tmpWal := path.Join(tmpDir, "wal")
+
+	index := tsdb.NewDatabaseIndex("db")
+	opts := tsdb.NewEngineOptions()
+	opts.Config.WALDir = filepath.Join(tmpDir, "wal")
+	opts.Config.MaxSeriesPerRetentionPolicy = map[string]int{"db.rp": 2}
+
+	// Shards 1 and 2 belong to the limited retention policy, shard 3 does not.
+	sh1 := tsdb.NewShard(1, index, path.Join(tmpDir, "db", "rp", "1"), tmpWal, opts)
+	sh2 := tsdb.NewShard(2, index, path.Join(tmpDir, "db", "rp", "2"), tmpWal, opts)
+	sh3 := tsdb.NewShard(3, index, path.Join(tmpDir, "db", "other", "3"), tmpWal, opts)
+	for _, sh := range []*tsdb.Shard{sh1, sh2, sh3} {
+		if err := sh.Open(); err != nil {
+			t.Fatalf("error opening shard: %s", err.Error())
+		}
+		defer sh.Close()
+	}
+
+	point := func(host string) models.Point {
+		return models.MustNewPoint(
+			"cpu",
+			models.Tags{{Key: []byte("host"), Value: []byte(host)}},
+			map[string]interface{}{"value": 1.0},
+			time.Unix(1, 2),
+		)
+	}
+
+	if err := sh1.WritePoints([]models.Point{point("server0"), point("server1")}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Series of the retention policy can be written to its other shards.
+	if err := sh2.WritePoints([]models.Point{point("server0")}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A third series exceeds the limit.
+	err := sh2.WritePoints([]models.Point{point("server2")})
+	if err == nil {
+		t.Fatal("expected error")
+	} else if exp, got := `max-series-per-retention-policy limit exceeded: db=db rp=rp (2/2) dropped=1`, err.Error(); exp != got {
+		t.Fatalf("unexpected error message:\n\texp = %s\n\tgot = %s", exp, got)
+	}
+
+	// Other retention policies are not limited.
+	if err := sh3.WritePoints([]models.Point{point("server1"), point("server2"), point("server3")}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, exp := index.RetentionPolicySeriesN("rp"), 2; got != exp {
+		t.Fatalf("unexpected series for rp: got %d, exp %d", got, exp)
+	} else if got, exp := index.RetentionPolicySeriesN("other"), 3; got != exp {
+		t.Fatalf("unexpected series for other: got %d, exp %d", got, exp)
+	}
+
+	// Removing a shard only removes the series not held by the other shards
+	// of the retention policy.
+	sh1.UnloadIndex()
+	if got, exp := index.RetentionPolicySeriesN("rp"), 1; got != exp {
+		t.Fatalf("unexpected series for rp: got %d, exp %d", got, exp)
+	}
+}
+
+// Ensure a shard stops accepting writes after a WAL write fails and accepts
+// them again once the WAL can be written.
+func TestShard_WALWriteFailure(t *testing.T) {
+	tmpDir, _ := ioutil.TempDir("", "shard_test")
+	defer os.RemoveAll(tmpDir)
+	tmpShard := path.Join(tmpDir, "db", "rp", "1")
+	tmpWal := path.Join(tmpDir, "wal")
+
+	index := tsdb.NewDatabaseIndex("db")
+	opts := tsdb.NewEngineOptions()
+	opts.Config.WALDir = filepath.Join(tmpDir, "wal")
+	opts.Config.WALRecoveryCheckInterval = toml.Duration(10 * time.Millisecond)
+
+	sh := tsdb.NewShard(1, index, tmpShard, tmpWal, opts)
+	if err := sh.Open(); err != nil {
+		t.Fatalf("error opening shard: %s", err.Error())
+	}
+	defer sh.Close()
+
+	pt := models.MustNewPoint(
+		"cpu",
+		models.Tags{{Key: []byte("host"), Value: []byte("server")}},
+		map[string]interface{}{"value": 1.0},
+		time.Unix(1, 2),
+	)
+
+	// The first write creates the WAL segment, which fails without the
+	// WAL directory.
+	if err := os.RemoveAll(tmpWal); err != nil {
+		t.Fatal(err)
+	}
+	if err := sh.WritePoints([]models.Point{pt}); err == nil || !strings.Contains(err.Error(), "WAL write failed") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := sh.WritePoints([]models.Point{pt}); err != tsdb.ErrShardReadOnly {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	stats := sh.Statistics(nil)[0].Values
+	if got, exp := stats["writeWALErr"], int64(1); got != exp {
+		t.Fatalf("unexpected WAL errors: got %v, exp %v", got, exp)
+	} else if got, exp := stats["readOnly"], int64(1); got != exp {
+		t.Fatalf("unexpected read-only state: got %v, exp %v", got, exp)
+	}
+
+	// Writes are accepted again once the WAL directory is restored.
+	if err := os.MkdirAll(tmpWal, 0777); err != nil {
+		t.Fatal(err)
+	}
+	timeout := time.After(5 * time.Second)
+	for {
+		err := sh.WritePoints([]models.Point{pt})
+		if err == nil {
+			break
+		} else if err != tsdb.ErrShardReadOnly {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		select {
+		case <-timeout:
+			t.Fatal("timed out waiting for the shard to accept writes")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	if got, exp := sh.Statistics(nil)[0].Values["readOnly"], int64(0); got != exp {
+		t.Fatalf("unexpected read-only state: got %v, exp %v", got, exp)
+	}
+}
+
 func TestShard_MaxTagValuesLimit(t *testing.T) {
 	tmpDir, _ := ioutil.TempDir("", "shard_test")
 	defer os.RemoveAll(tmpDir)
@@ -203,6 +341,262 @@ func TestShard_MaxTagValuesLimit(t *testing.T) {
 	sh.Close()
 }
 
+func TestShard_WritePoints_DuplicatePointPolicy(t *testing.T) {
+	for _, tt := range []struct {
+		policy     string
+		err        string
+		seriesN    int
+		duplicates int64
+		values     []float64
+	}{
+		{policy: tsdb.DuplicatePointLast, seriesN: 1, values: []float64{2}},
+		{policy: tsdb.DuplicatePointFirst, seriesN: 1, duplicates: 1, values: []float64{1}},
+		{policy: tsdb.DuplicatePointReject, seriesN: 1, duplicates: 1, values: []float64{1}, err: `duplicate point rejected: series="cpu,host=serverA" time=1000000002 dropped=1`},
+		{policy: tsdb.DuplicatePointSequence, seriesN: 2, duplicates: 1, values: []float64{1, 2}},
+	} {
+		t.Run(tt.policy, func(t *testing.T) {
+			tmpDir, _ := ioutil.TempDir("", "shard_test")
+			defer os.RemoveAll(tmpDir)
+			tmpShard := path.Join(tmpDir, "db", "rp", "1")
+			tmpWal := path.Join(tmpDir, "wal")
+
+			index := tsdb.NewDatabaseIndex("db")
+			opts := tsdb.NewEngineOptions()
+			opts.Config.WALDir = filepath.Join(tmpDir, "wal")
+			opts.Config.DuplicatePointPolicy = tt.policy
+
+			sh := tsdb.NewShard(1, index, tmpShard, tmpWal, opts)
+			if err := sh.Open(); err != nil {
+				t.Fatalf("error opening shard: %s", err.Error())
+			}
+			defer sh.Close()
+
+			tags := models.Tags{{Key: []byte("host"), Value: []byte("serverA")}}
+			err := sh.WritePoints([]models.Point{
+				models.MustNewPoint("cpu", tags, map[string]interface{}{"value": 1.0}, time.Unix(1, 2)),
+				models.MustNewPoint("cpu", tags, map[string]interface{}{"value": 1.0}, time.Unix(1, 2)),
+				models.MustNewPoint("cpu", tags, map[string]interface{}{"value": 2.0}, time.Unix(1, 2)),
+			})
+			if tt.err == "" && err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			} else if tt.err != "" && (err == nil || err.Error() != tt.err) {
+				t.Fatalf("unexpected error message:\n\texp = %s\n\tgot = %v", tt.err, err)
+			}
+
+			if got := index.SeriesN(); got != tt.seriesN {
+				t.Fatalf("unexpected series count: got %d, exp %d", got, tt.seriesN)
+			}
+			if got := sh.Statistics(nil)[0].Values["writePointsDuplicate"]; got != tt.duplicates {
+				t.Fatalf("unexpected writePointsDuplicate: got %v, exp %d", got, tt.duplicates)
+			}
+
+			itr, err := sh.CreateIterator("cpu", influxql.IteratorOptions{
+				Expr:       influxql.MustParseExpr(`value`),
+				Dimensions: []string{},
+				Ascending:  true,
+				StartTime:  influxql.MinTime,
+				EndTime:    influxql.MaxTime,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer itr.Close()
+
+			var values []float64
+			fitr := itr.(influxql.FloatIterator)
+			for {
+				p, err := fitr.Next()
+				if err != nil {
+					t.Fatal(err)
+				} else if p == nil {
+					break
+				}
+				values = append(values, p.Value)
+			}
+			sort.Float64s(values)
+			if !reflect.DeepEqual(values, tt.values) {
+				t.Fatalf("unexpected values: got %v, exp %v", values, tt.values)
+			}
+		})
+	}
+}
+
+func TestShard_WritePoints_OversizedFieldPolicy(t *testing.T) {
+	for _, tt := range []struct {
+		policy  string
+		err     string
+		seriesN int
+		stat    string
+	}{
+		{policy: tsdb.OversizedFieldReject, seriesN: 1, stat: "writeOversizedRejected", err: `max-field-value-size limit exceeded (11/10): measurement="log" field="msg" dropped=1`},
+		{policy: tsdb.OversizedFieldIsolate, seriesN: 2, stat: "writeOversizedIsolated"},
+	} {
+		t.Run(tt.policy, func(t *testing.T) {
+			tmpDir, _ := ioutil.TempDir("", "shard_test")
+			defer os.RemoveAll(tmpDir)
+			tmpShard := path.Join(tmpDir, "db", "rp", "1")
+			tmpWal := path.Join(tmpDir, "wal")
+
+			index := tsdb.NewDatabaseIndex("db")
+			opts := tsdb.NewEngineOptions()
+			opts.Config.WALDir = filepath.Join(tmpDir, "wal")
+			opts.Config.MaxFieldValueSize = 10
+			opts.Config.OversizedFieldPolicy = tt.policy
+
+			sh := tsdb.NewShard(1, index, tmpShard, tmpWal, opts)
+			if err := sh.Open(); err != nil {
+				t.Fatalf("error opening shard: %s", err.Error())
+			}
+			defer sh.Close()
+
+			err := sh.WritePoints([]models.Point{
+				models.MustNewPoint("log", models.NewTags(map[string]string{"host": "serverA"}), map[string]interface{}{"msg": "short"}, time.Unix(1, 0)),
+				models.MustNewPoint("log", models.NewTags(map[string]string{"host": "serverB"}), map[string]interface{}{"msg": "much longer"}, time.Unix(1, 0)),
+			})
+			if tt.err == "" && err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			} else if tt.err != "" && (err == nil || err.Error() != tt.err) {
+				t.Fatalf("unexpected error message:\n\texp = %s\n\tgot = %v", tt.err, err)
+			}
+
+			if got := index.SeriesN(); got != tt.seriesN {
+				t.Fatalf("unexpected series count: got %d, exp %d", got, tt.seriesN)
+			}
+			if got := sh.Statistics(nil)[0].Values[tt.stat]; got != int64(1) {
+				t.Fatalf("unexpected %s: %v", tt.stat, got)
+			}
+		})
+	}
+}
+
+func TestShard_WritePoints_LongTagValuePolicy(t *testing.T) {
+	for _, tt := range []struct {
+		policy string
+		err    string
+		series []string
+		stat   string
+	}{
+		{
+			policy: tsdb.LongTagValueReject,
+			stat:   "writeLongTagValueRejected",
+			err:    `max-tag-value-length limit exceeded (11/8): measurement="cpu" tag="host" dropped=1`,
+			series: []string{"cpu,host=serverA"},
+		},
+		{
+			policy: tsdb.LongTagValueTruncate,
+			stat:   "writeLongTagValueTruncated",
+			series: []string{"cpu,_truncated=true,host=server1", "cpu,host=serverA"},
+		},
+	} {
+		t.Run(tt.policy, func(t *testing.T) {
+			tmpDir, _ := ioutil.TempDir("", "shard_test")
+			defer os.RemoveAll(tmpDir)
+			tmpShard := path.Join(tmpDir, "db", "rp", "1")
+			tmpWal := path.Join(tmpDir, "wal")
+
+			index := tsdb.NewDatabaseIndex("db")
+			opts := tsdb.NewEngineOptions()
+			opts.Config.WALDir = filepath.Join(tmpDir, "wal")
+			opts.Config.MaxTagValueLength = 1024
+			opts.Config.DatabaseMaxTagValueLength = map[string]int{"db": 8}
+			opts.Config.DatabaseLongTagValuePolicy = map[string]string{"db": tt.policy}
+
+			sh := tsdb.NewShard(1, index, tmpShard, tmpWal, opts)
+			if err := sh.Open(); err != nil {
+				t.Fatalf("error opening shard: %s", err.Error())
+			}
+			defer sh.Close()
+
+			// The 8 byte limit falls inside the first two byte character,
+			// which is dropped whole by truncating to 7 bytes instead.
+			err := sh.WritePoints([]models.Point{
+				models.MustNewPoint("cpu", models.NewTags(map[string]string{"host": "serverA"}), map[string]interface{}{"value": 1.0}, time.Unix(1, 0)),
+				models.MustNewPoint("cpu", models.NewTags(map[string]string{"host": "server1\u00e9\u00e9"}), map[string]interface{}{"value": 1.0}, time.Unix(1, 0)),
+			})
+			if tt.err == "" && err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			} else if tt.err != "" && (err == nil || err.Error() != tt.err) {
+				t.Fatalf("unexpected error message:\n\texp = %s\n\tgot = %v", tt.err, err)
+			}
+
+			if got := index.SeriesN(); got != len(tt.series) {
+				t.Fatalf("unexpected series count: got %d, exp %d", got, len(tt.series))
+			}
+			for _, key := range tt.series {
+				if index.Series(key) == nil {
+					t.Fatalf("series not found: %q", key)
+				}
+			}
+			if got := sh.Statistics(nil)[0].Values[tt.stat]; got != int64(1) {
+				t.Fatalf("unexpected %s: %v", tt.stat, got)
+			}
+		})
+	}
+}
+
+func TestShard_WritePoints_MonotonicMeasurements(t *testing.T) {
+	tmpDir, _ := ioutil.TempDir("", "shard_test")
+	defer os.RemoveAll(tmpDir)
+	tmpShard := path.Join(tmpDir, "db", "rp", "1")
+	tmpWal := path.Join(tmpDir, "wal")
+
+	opts := tsdb.NewEngineOptions()
+	opts.Config.WALDir = filepath.Join(tmpDir, "wal")
+	opts.Config.MonotonicMeasurements = []string{"cpu"}
+
+	sh := tsdb.NewShard(1, tsdb.NewDatabaseIndex("db"), tmpShard, tmpWal, opts)
+	if err := sh.Open(); err != nil {
+		t.Fatalf("error opening shard: %s", err.Error())
+	}
+
+	hostA := models.NewTags(map[string]string{"host": "serverA"})
+	hostB := models.NewTags(map[string]string{"host": "serverB"})
+	value := map[string]interface{}{"value": 1.0}
+	if err := sh.WritePoints([]models.Point{
+		models.MustNewPoint("cpu", hostA, value, time.Unix(10, 0)),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the older point of the series is dropped. Other series and
+	// measurements are not affected.
+	exp := `out-of-order point rejected: measurement="cpu" series="cpu,host=serverA" time 5000000000 is older than 10000000000 dropped=1`
+	if err := sh.WritePoints([]models.Point{
+		models.MustNewPoint("cpu", hostA, value, time.Unix(5, 0)),
+		models.MustNewPoint("cpu", hostA, value, time.Unix(10, 0)),
+		models.MustNewPoint("cpu", hostB, value, time.Unix(1, 0)),
+		models.MustNewPoint("mem", hostA, value, time.Unix(1, 0)),
+		models.MustNewPoint("mem", hostA, value, time.Unix(0, 0)),
+	}); err == nil || err.Error() != exp {
+		t.Fatalf("unexpected error message:\n\texp = %s\n\tgot = %v", exp, err)
+	}
+	if got := sh.Statistics(nil)[0].Values["writePointsOutOfOrder"]; got != int64(1) {
+		t.Fatalf("unexpected writePointsOutOfOrder: %v", got)
+	}
+	sh.Close()
+
+	// The newest timestamp of a series is read from the engine after the
+	// shard is reopened.
+	sh = tsdb.NewShard(1, tsdb.NewDatabaseIndex("db"), tmpShard, tmpWal, opts)
+	if err := sh.Open(); err != nil {
+		t.Fatalf("error opening shard: %s", err.Error())
+	}
+	defer sh.Close()
+
+	if err := sh.WritePoints([]models.Point{
+		models.MustNewPoint("cpu", hostA, value, time.Unix(9, 0)),
+	}); err == nil {
+		t.Fatal("expected out-of-order error")
+	} else if _, ok := err.(tsdb.PartialWriteError); !ok {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := sh.WritePoints([]models.Point{
+		models.MustNewPoint("cpu", hostA, value, time.Unix(11, 0)),
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestWriteTimeTag(t *testing.T) {
 	tmpDir, _ := ioutil.TempDir("", "shard_test")
 	defer os.RemoveAll(tmpDir)
@@ -887,6 +1281,77 @@ mem,host=serverB value=50i,val3=t 10
 	}
 }
 
+func TestShard_SeriesN(t *testing.T) {
+	sh := NewShard()
+
+	if err := sh.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer sh.Close()
+
+	sh.MustWritePointsString(`
+cpu,host=serverA,region=uswest value=100 0
+cpu,host=serverA,region=uswest value=50 10
+cpu,host=serverB,region=uswest value=25 0
+cpu,host=serverC,region=useast value=25 0
+mem,host=serverA value=25i 0
+`)
+
+	for _, tt := range []struct {
+		measurement string
+		condition   string
+		n           int
+	}{
+		{measurement: "cpu", n: 3},
+		{measurement: "cpu", condition: `region = 'uswest'`, n: 2},
+		{measurement: "cpu", condition: `host = 'serverC' AND time > 0`, n: 1},
+		{measurement: "cpu", condition: `value > 30`, n: 3},
+		{measurement: "disk", n: 0},
+	} {
+		var cond influxql.Expr
+		if tt.condition != "" {
+			cond = influxql.MustParseExpr(tt.condition)
+		}
+
+		n, err := sh.SeriesN(tt.measurement, cond)
+		if err != nil {
+			t.Fatalf("%s %s: unexpected error: %v", tt.measurement, tt.condition, err)
+		} else if n != tt.n {
+			t.Errorf("%s %s: unexpected series count: got %d, exp %d", tt.measurement, tt.condition, n, tt.n)
+		}
+	}
+}
+
+func TestShard_WrittenSince(t *testing.T) {
+	sh := NewShard()
+
+	if err := sh.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer sh.Close()
+
+	start := time.Now()
+	sh.MustWritePointsString(`
+cpu,host=serverA value=100 10
+cpu,host=serverB value=50 20
+`)
+
+	for _, tt := range []struct {
+		since    time.Time
+		min, max int64
+		exp      bool
+	}{
+		{since: start.Add(-time.Second), min: 0, max: 15e9, exp: true},
+		{since: start.Add(-time.Second), min: 20e9, max: 30e9, exp: true},
+		{since: start.Add(-time.Second), min: 21e9, max: 30e9, exp: false},
+		{since: start.Add(time.Minute), min: 0, max: 30e9, exp: false},
+	} {
+		if got := sh.WrittenSince(tt.since, time.Unix(0, tt.min), time.Unix(0, tt.max)); got != tt.exp {
+			t.Errorf("WrittenSince(%s, %d, %d): got %v, exp %v", tt.since, tt.min, tt.max, got, tt.exp)
+		}
+	}
+}
+
 func BenchmarkWritePoints_NewSeries_1K(b *testing.B)   { benchmarkWritePoints(b, 38, 3, 3, 1) }
 func BenchmarkWritePoints_NewSeries_100K(b *testing.B) { benchmarkWritePoints(b, 32, 5, 5, 1) }
 func BenchmarkWritePoints_NewSeries_250K(b *testing.B) { benchmarkWritePoints(b, 80, 5, 5, 1) }
@@ -12,10 +12,12 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/lucaswiersma/influxdb/influxql"
 	"github.com/lucaswiersma/influxdb/models"
+	"github.com/lucaswiersma/influxdb/monitor/diagnostics"
 	"github.com/lucaswiersma/influxdb/pkg/limiter"
 	"go.uber.org/zap"
 )
@@ -25,6 +27,9 @@ var (
 	ErrShardNotFound = fmt.Errorf("shard not found")
 	// ErrStoreClosed is returned when trying to use a closed Store.
 	ErrStoreClosed = fmt.Errorf("store is closed")
+	// ErrShardUnreadable is returned when trying to recreate a shard that
+	// failed to open.
+	ErrShardUnreadable = fmt.Errorf("shard is unreadable")
 )
 
 // Store manages shards and indexes for databases.
@@ -37,10 +42,24 @@ type Store struct {
 	// shards is a map of shard IDs to the associated Shard.
 	shards map[uint64]*Shard
 
+	// unreadable is a map of shard IDs to the shards that failed to open.
+	// They are left on disk until they are deleted.
+	unreadable map[uint64]*unreadableShard
+
 	EngineOptions EngineOptions
 	baseLogger    zap.Logger
 	Logger        zap.Logger
 
+	// migrations tracks the progress of field type migrations by key.
+	migrationsMu sync.Mutex
+	migrations   map[string]*FieldMigration
+
+	stats StoreStatistics
+
+	// hotspots tracks the series with the highest write rates. It is nil
+	// when hotspot tracking is disabled.
+	hotspots *writeHotspotTracker
+
 	closing chan struct{}
 	wg      sync.WaitGroup
 	opened  bool
@@ -69,9 +88,44 @@ func (s *Store) WithLogger(log zap.Logger) {
 	}
 }
 
+// unreadableShard is a shard that failed to open.
+type unreadableShard struct {
+	database, retentionPolicy string
+	path, walPath             string
+	err                       error
+}
+
+// Statistics for the Store.
+const (
+	statShardsTotal       = "shardsTotal"         // Number of shards found when the store was opened
+	statShardsOpened      = "shardsOpened"        // Number of shards opened successfully when the store was opened
+	statShardOpenErrors   = "shardOpenErrors"     // Number of shards that failed to open when the store was opened
+	statShardOpenDuration = "shardOpenDurationNs" // Time spent opening all shards when the store was opened
+	statShardsUnreadable  = "shardsUnreadable"    // Number of shards that failed to open and have not been deleted
+)
+
+// StoreStatistics keeps statistics related to the Store.
+type StoreStatistics struct {
+	ShardsTotal       int64
+	ShardsOpened      int64
+	ShardOpenErrors   int64
+	ShardOpenDuration int64
+}
+
 // Statistics returns statistics for period monitoring.
 func (s *Store) Statistics(tags map[string]string) []models.Statistic {
-	var statistics []models.Statistic
+	// The store statistics are read before taking the lock so shard-open
+	// progress can be monitored while the store is being opened.
+	statistics := []models.Statistic{{
+		Name: "store",
+		Tags: tags,
+		Values: map[string]interface{}{
+			statShardsTotal:       atomic.LoadInt64(&s.stats.ShardsTotal),
+			statShardsOpened:      atomic.LoadInt64(&s.stats.ShardsOpened),
+			statShardOpenErrors:   atomic.LoadInt64(&s.stats.ShardOpenErrors),
+			statShardOpenDuration: atomic.LoadInt64(&s.stats.ShardOpenDuration),
+		},
+	}}
 
 	s.mu.RLock()
 	indexes := make([]models.Statistic, 0, len(s.databaseIndexes))
@@ -79,13 +133,19 @@ func (s *Store) Statistics(tags map[string]string) []models.Statistic {
 		indexes = append(indexes, dbi.Statistics(tags)...)
 	}
 	shards := s.shardsSlice()
+	unreadable := s.unreadableStatistics(tags)
 	s.mu.RUnlock()
 
+	statistics[0].Values[statShardsUnreadable] = int64(len(unreadable))
+	statistics = append(statistics, unreadable...)
+
 	for _, shard := range shards {
 		statistics = append(statistics, shard.Statistics(tags)...)
 	}
 
 	statistics = append(statistics, indexes...)
+	statistics = append(statistics, s.quarantineStatistics(tags)...)
+	statistics = append(statistics, s.migrationStatistics(tags)...)
 	return statistics
 }
 
@@ -101,8 +161,13 @@ func (s *Store) Open() error {
 	s.closing = make(chan struct{})
 
 	s.shards = map[uint64]*Shard{}
+	s.unreadable = map[uint64]*unreadableShard{}
 	s.databaseIndexes = map[string]*DatabaseIndex{}
 
+	if c := s.EngineOptions.Config; c.WriteHotspotSampleRate > 0 {
+		s.hotspots = newWriteHotspotTracker(c.WriteHotspotSampleRate, c.WriteHotspotSeriesN, time.Duration(c.WriteHotspotInterval))
+	}
+
 	s.Logger.Info(fmt.Sprintf("Using data dir: %v", s.Path()))
 
 	// Create directory.
@@ -121,6 +186,20 @@ func (s *Store) Open() error {
 
 	s.opened = true
 
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.monitorQuarantine()
+	}()
+
+	if s.EngineOptions.Config.SeriesEvictionEnabled {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.monitorSeriesEviction()
+		}()
+	}
+
 	return nil
 }
 
@@ -130,6 +209,9 @@ func (s *Store) loadIndexes() error {
 		return err
 	}
 	for _, db := range dbs {
+		if db.Name() == quarantineDir {
+			continue
+		}
 		if !db.IsDir() {
 			s.Logger.Info(fmt.Sprintf("Skipping database dir: %s. Not a directory", db.Name()))
 			continue
@@ -144,12 +226,18 @@ func (s *Store) loadShards() error {
 	type res struct {
 		s   *Shard
 		err error
-	}
 
-	t := limiter.NewFixed(runtime.GOMAXPROCS(0))
+		// The shard that failed to open.
+		id         uint64
+		unreadable *unreadableShard
+	}
 
-	resC := make(chan *res)
-	var n int
+	// Find all shards before opening any so progress can be reported.
+	type shardDir struct {
+		db, rp, sh string
+		id         uint64
+	}
+	var dirs []shardDir
 
 	// loop through the current database indexes
 	for db := range s.databaseIndexes {
@@ -159,6 +247,10 @@ func (s *Store) loadShards() error {
 		}
 
 		for _, rp := range rps {
+			if rp.Name() == quarantineDir {
+				continue
+			}
+
 			// retention policies should be directories.  Skip anything that is not a dir.
 			if !rp.IsDir() {
 				s.Logger.Info(fmt.Sprintf("Skipping retention policy dir: %s. Not a directory", rp.Name()))
@@ -170,47 +262,88 @@ func (s *Store) loadShards() error {
 				return err
 			}
 			for _, sh := range shards {
-				n++
-				go func(index *DatabaseIndex, db, rp, sh string) {
-					t.Take()
-					defer t.Release()
-
-					start := time.Now()
-					path := filepath.Join(s.path, db, rp, sh)
-					walPath := filepath.Join(s.EngineOptions.Config.WALDir, db, rp, sh)
-
-					// Shard file names are numeric shardIDs
-					shardID, err := strconv.ParseUint(sh, 10, 64)
-					if err != nil {
-						resC <- &res{err: fmt.Errorf("%s is not a valid ID. Skipping shard.", sh)}
-						return
-					}
-
-					shard := NewShard(shardID, s.databaseIndexes[db], path, walPath, s.EngineOptions)
-					shard.WithLogger(s.baseLogger)
-
-					err = shard.Open()
-					if err != nil {
-						resC <- &res{err: fmt.Errorf("Failed to open shard: %d: %s", shardID, err)}
-						return
-					}
-
-					resC <- &res{s: shard}
-					s.Logger.Info(fmt.Sprintf("%s opened in %s", path, time.Since(start)))
-				}(s.databaseIndexes[db], db, rp.Name(), sh.Name())
+				// Shard file names are numeric shardIDs
+				shardID, err := strconv.ParseUint(sh.Name(), 10, 64)
+				if err != nil {
+					s.Logger.Info(fmt.Sprintf("%s is not a valid ID. Skipping shard.", sh.Name()))
+					continue
+				}
+				dirs = append(dirs, shardDir{db: db, rp: rp.Name(), sh: sh.Name(), id: shardID})
 			}
 		}
 	}
 
-	for i := 0; i < n; i++ {
+	concurrency := s.EngineOptions.Config.MaxConcurrentShardOpens
+	if concurrency <= 0 {
+		concurrency = runtime.GOMAXPROCS(0)
+	}
+	t := limiter.NewFixed(concurrency)
+
+	loadStart := time.Now()
+	atomic.StoreInt64(&s.stats.ShardsTotal, int64(len(dirs)))
+	atomic.StoreInt64(&s.stats.ShardsOpened, 0)
+	atomic.StoreInt64(&s.stats.ShardOpenErrors, 0)
+	s.Logger.Info(fmt.Sprintf("Opening %d shards with concurrency %d", len(dirs), concurrency))
+
+	resC := make(chan *res)
+	for _, dir := range dirs {
+		go func(db, rp, sh string, shardID uint64) {
+			t.Take()
+			defer t.Release()
+
+			start := time.Now()
+			path := filepath.Join(s.path, db, rp, sh)
+			walPath := filepath.Join(s.EngineOptions.Config.WALDir, db, rp, sh)
+
+			shard := NewShard(shardID, s.databaseIndexes[db], path, walPath, s.EngineOptions)
+			shard.WithLogger(s.baseLogger)
+
+			if err := shard.Open(); err != nil {
+				resC <- &res{
+					err: fmt.Errorf("Failed to open shard: %d: %s", shardID, err),
+					id:  shardID,
+					unreadable: &unreadableShard{
+						database:        db,
+						retentionPolicy: rp,
+						path:            path,
+						walPath:         walPath,
+						err:             err,
+					},
+				}
+				return
+			}
+
+			resC <- &res{s: shard}
+			s.Logger.Info(fmt.Sprintf("%s opened in %s", path, time.Since(start)))
+		}(dir.db, dir.rp, dir.sh, dir.id)
+	}
+
+	// Report progress roughly every tenth of the shards.
+	step := len(dirs) / 10
+	if step < 1 {
+		step = 1
+	}
+
+	for i := 0; i < len(dirs); i++ {
 		res := <-resC
 		if res.err != nil {
+			atomic.AddInt64(&s.stats.ShardOpenErrors, 1)
 			s.Logger.Info(res.err.Error())
-			continue
+			s.unreadable[res.id] = res.unreadable
+		} else {
+			atomic.AddInt64(&s.stats.ShardsOpened, 1)
+			s.shards[res.s.id] = res.s
+		}
+
+		if n := i + 1; n%step == 0 && n < len(dirs) {
+			s.Logger.Info(fmt.Sprintf("Loaded %d/%d shards in %s", n, len(dirs), time.Since(loadStart)))
 		}
-		s.shards[res.s.id] = res.s
 	}
 	close(resC)
+
+	d := time.Since(loadStart)
+	atomic.StoreInt64(&s.stats.ShardOpenDuration, d.Nanoseconds())
+	s.Logger.Info(fmt.Sprintf("Opened %d/%d shards in %s", len(s.shards), len(dirs), d))
 	return nil
 }
 
@@ -272,6 +405,62 @@ func (s *Store) Shards(ids []uint64) []*Shard {
 	return a
 }
 
+// UnreadableShards returns the IDs in ids of shards that failed to open.
+func (s *Store) UnreadableShards(ids []uint64) []uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var a []uint64
+	for _, id := range ids {
+		if _, ok := s.unreadable[id]; ok {
+			a = append(a, id)
+		}
+	}
+	return a
+}
+
+// deleteUnreadableShard removes the files of a shard that failed to open.
+func (s *Store) deleteUnreadableShard(shardID uint64) error {
+	s.mu.RLock()
+	u := s.unreadable[shardID]
+	s.mu.RUnlock()
+	if u == nil {
+		return nil
+	}
+
+	if err := os.RemoveAll(u.path); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(u.walPath); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	delete(s.unreadable, shardID)
+	s.mu.Unlock()
+	return nil
+}
+
+// unreadableStatistics returns a statistic for each shard that failed to
+// open. The store must be locked.
+func (s *Store) unreadableStatistics(tags map[string]string) []models.Statistic {
+	statistics := make([]models.Statistic, 0, len(s.unreadable))
+	for id, u := range s.unreadable {
+		statistics = append(statistics, models.Statistic{
+			Name: "unreadable_shard",
+			Tags: models.StatisticTags{
+				"id":              strconv.FormatUint(id, 10),
+				"database":        u.database,
+				"retentionPolicy": u.retentionPolicy,
+			}.Merge(tags),
+			Values: map[string]interface{}{
+				"error": u.err.Error(),
+			},
+		})
+	}
+	return statistics
+}
+
 // ShardGroup returns a ShardGroup with a list of shards by id.
 func (s *Store) ShardGroup(ids []uint64) ShardGroup {
 	return Shards(s.Shards(ids))
@@ -300,6 +489,11 @@ func (s *Store) CreateShard(database, retentionPolicy string, shardID uint64, en
 		return nil
 	}
 
+	// Do not replace a shard that failed to open with an empty one.
+	if _, ok := s.unreadable[shardID]; ok {
+		return ErrShardUnreadable
+	}
+
 	// created the db and retention policy dirs if they don't exist
 	if err := os.MkdirAll(filepath.Join(s.path, database, retentionPolicy), 0700); err != nil {
 		return err
@@ -357,7 +551,7 @@ func (s *Store) SetShardEnabled(shardID uint64, enabled bool) error {
 func (s *Store) DeleteShard(shardID uint64) error {
 	sh := s.Shard(shardID)
 	if sh == nil {
-		return nil
+		return s.deleteUnreadableShard(shardID)
 	}
 
 	// Remove the shard from the database indexes before closing the shard.
@@ -655,6 +849,26 @@ func (s *Store) BackupShard(id uint64, since time.Time, w io.Writer) error {
 	return shard.engine.Backup(w, path, since)
 }
 
+// DefragmentShard rewrites the files of a shard so the blocks of each series
+// are contiguous, returning the fragmentation before and after.
+func (s *Store) DefragmentShard(id uint64) (before, after Fragmentation, err error) {
+	sh := s.Shard(id)
+	if sh == nil {
+		return before, after, ErrShardNotFound
+	}
+	return sh.Defragment()
+}
+
+// VerifyShard checks the checksums of the blocks in the files of a shard,
+// optionally quarantining files with corrupt blocks.
+func (s *Store) VerifyShard(id uint64, wait func(n int) error, quarantine bool) (VerifyStats, error) {
+	shard := s.Shard(id)
+	if shard == nil {
+		return VerifyStats{}, ErrShardNotFound
+	}
+	return shard.Verify(wait, quarantine)
+}
+
 // RestoreShard restores a backup from r to a given shard.
 // This will only overwrite files included in the backup.
 func (s *Store) RestoreShard(id uint64, r io.Reader) error {
@@ -671,6 +885,122 @@ func (s *Store) RestoreShard(id uint64, r io.Reader) error {
 	return shard.Restore(r, path)
 }
 
+// MergeShards copies all data from the src shard into the dst shard. Both
+// shards must belong to the same database and retention policy. The src shard
+// is disabled for writes and left in place for the caller to remove.
+func (s *Store) MergeShards(dst, src uint64) error {
+	dstShard, srcShard := s.Shard(dst), s.Shard(src)
+	if dstShard == nil {
+		return fmt.Errorf("shard %d doesn't exist on this server", dst)
+	} else if srcShard == nil {
+		return fmt.Errorf("shard %d doesn't exist on this server", src)
+	} else if dstShard.database != srcShard.database || dstShard.retentionPolicy != srcShard.retentionPolicy {
+		return fmt.Errorf("shards %d and %d belong to different retention policies", dst, src)
+	}
+
+	path, err := relativePath(s.path, srcShard.path)
+	if err != nil {
+		return err
+	}
+
+	// Reject writes to the source so nothing is written after it is copied.
+	// The engine stays enabled since the backup snapshots its cache.
+	srcShard.setWritesEnabled(false)
+
+	pr, pw := io.Pipe()
+	errC := make(chan error, 1)
+	go func() {
+		err := srcShard.engine.Backup(pw, path, time.Time{})
+		pw.CloseWithError(err)
+		errC <- err
+	}()
+
+	importErr := dstShard.Import(pr, path)
+	io.Copy(ioutil.Discard, pr)
+	if err := <-errC; err != nil {
+		srcShard.setWritesEnabled(true)
+		return err
+	} else if importErr != nil {
+		srcShard.setWritesEnabled(true)
+		return importErr
+	}
+	return nil
+}
+
+// UnmergeShards undoes MergeShards when the shard groups of the shards could
+// not be merged. The data copied from the src shard, which lies between min
+// and max, is deleted from the dst shard and writes to the src shard are
+// enabled again.
+func (s *Store) UnmergeShards(dst, src uint64, min, max int64) error {
+	dstShard, srcShard := s.Shard(dst), s.Shard(src)
+	if dstShard == nil {
+		return fmt.Errorf("shard %d doesn't exist on this server", dst)
+	} else if srcShard == nil {
+		return fmt.Errorf("shard %d doesn't exist on this server", src)
+	}
+	srcShard.setWritesEnabled(true)
+
+	s.mu.RLock()
+	db := s.databaseIndexes[dstShard.database]
+	s.mu.RUnlock()
+	if db == nil {
+		return influxql.ErrDatabaseNotFound(dstShard.database)
+	}
+
+	seriesKeys := db.SeriesKeys()
+	if err := dstShard.DeleteSeriesRange(seriesKeys, min, max); err != nil {
+		return err
+	}
+
+	// Series only copied from the src shard no longer exist in the dst shard.
+	existing, err := dstShard.ContainsSeries(seriesKeys)
+	if err != nil {
+		return err
+	}
+	for k, exists := range existing {
+		if !exists {
+			db.UnassignShard(k, dst)
+		}
+	}
+	return nil
+}
+
+// ShardDiskSize returns the size on disk of a shard.
+func (s *Store) ShardDiskSize(id uint64) (int64, error) {
+	sh := s.Shard(id)
+	if sh == nil {
+		return 0, ErrShardNotFound
+	}
+	return sh.DiskSize()
+}
+
+// ShardLastModified returns the last time a shard was written to.
+func (s *Store) ShardLastModified(id uint64) (time.Time, error) {
+	sh := s.Shard(id)
+	if sh == nil {
+		return time.Time{}, ErrShardNotFound
+	}
+	return sh.LastModified(), nil
+}
+
+// PrecompactShard fully compacts a shard ahead of it expiring.
+func (s *Store) PrecompactShard(id uint64) error {
+	sh := s.Shard(id)
+	if sh == nil {
+		return ErrShardNotFound
+	}
+	return sh.Precompact()
+}
+
+// ExportShard writes the data of a shard to w as line protocol.
+func (s *Store) ExportShard(id uint64, w io.Writer) error {
+	sh := s.Shard(id)
+	if sh == nil {
+		return ErrShardNotFound
+	}
+	return sh.Export(w)
+}
+
 // ShardRelativePath will return the relative path to the shard. i.e. <database>/<retention>/<id>.
 func (s *Store) ShardRelativePath(id uint64) (string, error) {
 	shard := s.Shard(id)
@@ -811,11 +1141,39 @@ func (s *Store) WriteToShard(shardID uint64, points []models.Point) error {
 		s.mu.RUnlock()
 		return ErrShardNotFound
 	}
+	hotspots := s.hotspots
 	s.mu.RUnlock()
 
+	if hotspots != nil {
+		hotspots.Add(sh.database, points)
+	}
+
 	return sh.WritePoints(points)
 }
 
+// WriteHotspots returns the series with the highest write rates over the last
+// write-hotspot-interval, in descending order of rate. It returns nil when
+// hotspot tracking is disabled.
+func (s *Store) WriteHotspots() []WriteHotspot {
+	s.mu.RLock()
+	hotspots := s.hotspots
+	s.mu.RUnlock()
+
+	if hotspots == nil {
+		return nil
+	}
+	return hotspots.Hotspots()
+}
+
+// WriteHotspotDiagnostics returns the write hotspots as diagnostics.
+func (s *Store) WriteHotspotDiagnostics() (*diagnostics.Diagnostics, error) {
+	d := diagnostics.NewDiagnostics([]string{"database", "series", "writes", "rate"})
+	for _, h := range s.WriteHotspots() {
+		d.AddRow([]interface{}{h.Database, h.Series, h.Writes, h.Rate})
+	}
+	return d, nil
+}
+
 // Measurements returns a slice of sorted measurement names in the given database,
 // matching the given condition.
 func (s *Store) Measurements(database string, cond influxql.Expr) ([]string, error) {
@@ -854,7 +1212,10 @@ type TagValues struct {
 }
 
 // TagValues returns the tag keys and values in the given database, matching the condition.
-func (s *Store) TagValues(database string, cond influxql.Expr) ([]TagValues, error) {
+// The values of each measurement are sorted by key and value. The first offset values of
+// each measurement are skipped and, if limit is positive, at most limit values are returned
+// for each measurement. The index is only walked as far as needed.
+func (s *Store) TagValues(database string, cond influxql.Expr, offset, limit int) ([]TagValues, error) {
 	if cond == nil {
 		return nil, errors.New("a condition is required")
 	}
@@ -914,39 +1275,34 @@ func (s *Store) TagValues(database string, cond influxql.Expr) ([]TagValues, err
 		ids, err := mm.SeriesIDsAllOrByExpr(filterExpr)
 		if err != nil {
 			return nil, err
+		} else if len(ids) == 0 {
+			continue
 		}
-		ss := mm.SeriesByIDSlice(ids)
 
 		// Determine a list of keys from condition.
 		keySet, ok, err := mm.TagKeysByExpr(cond)
 		if err != nil {
 			return nil, err
 		}
-
-		// Loop over all keys for each series.
-		m := make(map[KeyValue]struct{}, len(ss))
-		for _, series := range ss {
-			series.ForEachTag(func(t models.Tag) {
-				if !ok {
-					// nop
-				} else if _, exists := keySet[string(t.Key)]; !exists {
-					return
-				}
-				m[KeyValue{string(t.Key), string(t.Value)}] = struct{}{}
-			})
-		}
-
-		// Return an empty slice if there are no key/value matches.
-		if len(m) == 0 {
-			continue
+		keys := mm.TagKeys()
+		if ok {
+			keys = keys[:0]
+			for k := range keySet {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
 		}
 
-		// Sort key/value set.
-		a := make([]KeyValue, 0, len(m))
-		for kv := range m {
-			a = append(a, kv)
-		}
-		sort.Sort(KeyValues(a))
+		// Walk the values in sorted order until the limit is reached.
+		var a []KeyValue
+		n := 0
+		mm.WalkTagValues(keys, ids, func(k, v string) bool {
+			if n++; n <= offset {
+				return true
+			}
+			a = append(a, KeyValue{k, v})
+			return limit <= 0 || len(a) < limit
+		})
 		tagValues[i].Values = a
 	}
 
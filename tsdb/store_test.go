@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -14,6 +15,7 @@ import (
 	"github.com/lucaswiersma/influxdb/influxql"
 	"github.com/lucaswiersma/influxdb/models"
 	"github.com/lucaswiersma/influxdb/pkg/deep"
+	"github.com/lucaswiersma/influxdb/toml"
 	"github.com/lucaswiersma/influxdb/tsdb"
 )
 
@@ -137,6 +139,212 @@ func TestStore_DeleteShard(t *testing.T) {
 	}
 }
 
+// Ensure a dropped shard is held in quarantine and can be restored.
+func TestStore_QuarantineShard(t *testing.T) {
+	s := MustOpenStore()
+	defer s.Close()
+	s.EngineOptions.Config.ShardQuarantineDuration = toml.Duration(time.Hour)
+
+	s.MustCreateShardWithData("db0", "rp0", 1, `cpu value=1 0`)
+
+	if err := s.QuarantineShard(tsdb.QuarantinedShard{ID: 1, ShardGroupID: 2}); err != nil {
+		t.Fatal(err)
+	} else if sh := s.Shard(1); sh != nil {
+		t.Fatal("expected shard to be removed")
+	}
+
+	if a, err := s.QuarantinedShards(); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 1 || a[0].ID != 1 || a[0].Database != "db0" || a[0].RetentionPolicy != "rp0" || a[0].ShardGroupID != 2 {
+		t.Fatalf("unexpected quarantined shards: %+v", a)
+	}
+
+	// Quarantined shards must not be loaded on open.
+	s.Store.Close()
+	s.Store = tsdb.NewStore(s.Path())
+	s.EngineOptions.Config.WALDir = filepath.Join(s.Path(), "wal")
+	s.EngineOptions.Config.ShardQuarantineDuration = toml.Duration(time.Hour)
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	} else if sh := s.Shard(1); sh != nil {
+		t.Fatal("expected quarantined shard to stay closed")
+	}
+
+	if q, err := s.UndropShard(1); err != nil {
+		t.Fatal(err)
+	} else if q.Database != "db0" || q.RetentionPolicy != "rp0" {
+		t.Fatalf("unexpected shard owner: %+v", q)
+	} else if sh := s.Shard(1); sh == nil {
+		t.Fatal("expected shard to be restored")
+	} else if n, err := sh.SeriesCount(); err != nil {
+		t.Fatal(err)
+	} else if n != 1 {
+		t.Fatalf("unexpected series count: %d", n)
+	}
+
+	if _, err := s.UndropShard(1); err != tsdb.ErrShardNotQuarantined {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure the store evicts series that have not been written to recently.
+func TestStore_EvictStaleSeries(t *testing.T) {
+	s := MustOpenStore()
+	defer s.Close()
+	s.EngineOptions.Config.SeriesEvictionEnabled = true
+
+	s.MustCreateShardWithData("db0", "rp0", 1, `cpu,host=serverA value=1 0`, `cpu,host=serverB value=1 0`)
+	time.Sleep(time.Millisecond)
+	before := time.Now()
+	time.Sleep(time.Millisecond)
+	s.MustWriteToShardString(1, `cpu,host=serverB value=2 10`)
+
+	if n, err := s.EvictStaleSeries("db0", before); err != nil {
+		t.Fatal(err)
+	} else if n != 1 {
+		t.Fatalf("unexpected evicted series: %d", n)
+	}
+
+	if db := s.DatabaseIndex("db0"); db.Series("cpu,host=serverA") != nil {
+		t.Fatal("expected stale series to be evicted")
+	} else if db.Series("cpu,host=serverB") == nil {
+		t.Fatal("expected recently written series to remain")
+	} else if n, err := s.Shard(1).SeriesCount(); err != nil {
+		t.Fatal(err)
+	} else if n != 1 {
+		t.Fatalf("unexpected series count: %d", n)
+	}
+}
+
+// Ensure the store reports the series with the highest write rates.
+func TestStore_WriteHotspots(t *testing.T) {
+	s := NewStore()
+	s.EngineOptions.Config.WriteHotspotSampleRate = 1
+	s.EngineOptions.Config.WriteHotspotSeriesN = 2
+	s.EngineOptions.Config.WriteHotspotInterval = toml.Duration(time.Hour)
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	s.MustCreateShardWithData("db0", "rp0", 1,
+		`cpu,host=serverA value=1 0`, `cpu,host=serverA value=2 10`, `cpu,host=serverA value=3 20`,
+		`cpu,host=serverB value=1 0`,
+		`cpu,host=serverC value=1 0`, `cpu,host=serverC value=2 10`,
+	)
+
+	hotspots := s.WriteHotspots()
+	if len(hotspots) != 2 {
+		t.Fatalf("unexpected hotspots: %s", spew.Sdump(hotspots))
+	} else if h := hotspots[0]; h.Database != "db0" || h.Series != "cpu,host=serverA" || h.Writes != 3 || h.Rate <= 0 {
+		t.Fatalf("unexpected hotspot: %s", spew.Sdump(h))
+	} else if h := hotspots[1]; h.Series != "cpu,host=serverC" || h.Writes != 2 {
+		t.Fatalf("unexpected hotspot: %s", spew.Sdump(h))
+	}
+
+	if d, err := s.WriteHotspotDiagnostics(); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(d.Columns, []string{"database", "series", "writes", "rate"}) || len(d.Rows) != 2 {
+		t.Fatalf("unexpected diagnostics: %s", spew.Sdump(d))
+	}
+}
+
+// Ensure tag values are returned in order and paged by offset and limit.
+func TestStore_TagValues(t *testing.T) {
+	s := MustOpenStore()
+	defer s.Close()
+
+	s.MustCreateShardWithData("db0", "rp0", 1,
+		`cpu,host=serverC,region=west value=1 0`,
+		`cpu,host=serverA,region=east value=1 0`,
+		`cpu,host=serverB,region=east value=1 0`,
+		`cpu,host=serverD,region=west value=1 0`,
+	)
+
+	for _, tt := range []struct {
+		cond          string
+		offset, limit int
+		exp           []tsdb.KeyValue
+	}{
+		{cond: `_tagKey = 'host'`, exp: []tsdb.KeyValue{{"host", "serverA"}, {"host", "serverB"}, {"host", "serverC"}, {"host", "serverD"}}},
+		{cond: `_tagKey = 'host'`, offset: 1, limit: 2, exp: []tsdb.KeyValue{{"host", "serverB"}, {"host", "serverC"}}},
+		{cond: `_tagKey = 'host' AND region = 'west'`, limit: 1, exp: []tsdb.KeyValue{{"host", "serverC"}}},
+		{cond: `_tagKey =~ /.*/`, offset: 3, limit: 2, exp: []tsdb.KeyValue{{"host", "serverD"}, {"region", "east"}}},
+		{cond: `_tagKey = 'host'`, offset: 4},
+	} {
+		tagValues, err := s.TagValues("db0", influxql.MustParseExpr(tt.cond), tt.offset, tt.limit)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(tagValues) != 1 || tagValues[0].Measurement != "cpu" {
+			t.Fatalf("%s: unexpected tag values: %v", tt.cond, tagValues)
+		} else if !reflect.DeepEqual(tagValues[0].Values, tt.exp) {
+			t.Fatalf("%s: unexpected values: got %v, exp %v", tt.cond, tagValues[0].Values, tt.exp)
+		}
+	}
+}
+
+// Ensure the store can merge one shard's data into another.
+func TestStore_MergeShards(t *testing.T) {
+	s := MustOpenStore()
+	defer s.Close()
+
+	s.MustCreateShardWithData("db0", "rp0", 1, `cpu,host=serverA value=1 0`)
+	s.MustCreateShardWithData("db0", "rp0", 2, `cpu,host=serverB value=2 10`, `mem,host=serverB value=3 20`)
+
+	if err := s.MergeShards(1, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := s.Shard(1).SeriesCount(); err != nil {
+		t.Fatal(err)
+	} else if n != 3 {
+		t.Fatalf("unexpected series count: %d", n)
+	}
+
+	// The source shard no longer accepts writes.
+	if err := s.WriteToShard(2, []models.Point{models.MustNewPoint("cpu", nil, map[string]interface{}{"value": 1.0}, time.Unix(30, 0))}); err != tsdb.ErrShardDisabled {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Shards in different retention policies cannot be merged.
+	s.MustCreateShardWithData("db0", "rp1", 3, `cpu,host=serverA value=1 0`)
+	if err := s.MergeShards(1, 3); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+// Ensure the store can undo a merge of one shard into another.
+func TestStore_UnmergeShards(t *testing.T) {
+	s := MustOpenStore()
+	defer s.Close()
+
+	s.MustCreateShardWithData("db0", "rp0", 1, `cpu,host=serverA value=1 0`)
+	s.MustCreateShardWithData("db0", "rp0", 2, `cpu,host=serverB value=2 10`, `mem,host=serverB value=3 20`)
+
+	if err := s.MergeShards(1, 2); err != nil {
+		t.Fatal(err)
+	} else if err := s.UnmergeShards(1, 2, int64(10*time.Second), int64(30*time.Second)-1); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the data of the destination shard is left in it.
+	if exists, err := s.Shard(1).ContainsSeries([]string{"cpu,host=serverA", "cpu,host=serverB", "mem,host=serverB"}); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(exists, map[string]bool{"cpu,host=serverA": true, "cpu,host=serverB": false, "mem,host=serverB": false}) {
+		t.Fatalf("unexpected series: %v", exists)
+	}
+	if ss := s.DatabaseIndex("db0").Series("mem,host=serverB"); ss == nil {
+		t.Fatal("expected series to exist")
+	} else if ss.Assigned(1) {
+		t.Fatal("expected series to be unassigned from shard 1")
+	}
+
+	// The source shard accepts writes again.
+	if err := s.WriteToShard(2, []models.Point{models.MustNewPoint("cpu", nil, map[string]interface{}{"value": 1.0}, time.Unix(30, 0))}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
 // Ensure the store can create a snapshot to a shard.
 func TestStore_CreateShardSnapShot(t *testing.T) {
 	s := MustOpenStore()
@@ -160,6 +368,83 @@ func TestStore_CreateShardSnapShot(t *testing.T) {
 	}
 }
 
+// Ensure the store opens shards with a limited concurrency and reports progress.
+func TestStore_Open_MaxConcurrentShardOpens(t *testing.T) {
+	s := MustOpenStore()
+	defer s.Close()
+
+	for i := 1; i <= 5; i++ {
+		s.MustCreateShardWithData("db0", "rp0", i, fmt.Sprintf(`cpu,host=server%d value=1 0`, i))
+	}
+
+	// Reopen the store with a limit on the number of shards opened at once.
+	if err := s.Store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	s.Store = tsdb.NewStore(s.Path())
+	s.EngineOptions.Config.WALDir = filepath.Join(s.Path(), "wal")
+	s.EngineOptions.Config.MaxConcurrentShardOpens = 2
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	} else if n := s.ShardN(); n != 5 {
+		t.Fatalf("unexpected shard count: %d", n)
+	}
+
+	stats := s.Statistics(nil)[0]
+	if stats.Name != "store" {
+		t.Fatalf("unexpected statistic: %s", stats.Name)
+	} else if v := stats.Values["shardsOpened"]; v != int64(5) {
+		t.Fatalf("unexpected shards opened: %v", v)
+	} else if v := stats.Values["shardOpenErrors"]; v != int64(0) {
+		t.Fatalf("unexpected shard open errors: %v", v)
+	} else if v := stats.Values["shardOpenDurationNs"]; v.(int64) <= 0 {
+		t.Fatalf("unexpected shard open duration: %v", v)
+	}
+}
+
+// Ensure shards that fail to open are tracked until they are deleted.
+func TestStore_Open_UnreadableShard(t *testing.T) {
+	s := MustOpenStore()
+	defer s.Close()
+
+	s.MustCreateShardWithData("db0", "rp0", 1, `cpu value=1 0`)
+
+	// A file in place of the shard directory can not be opened.
+	path := filepath.Join(s.Path(), "db0", "rp0", "2")
+	if err := ioutil.WriteFile(path, []byte("corrupt"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Reopen(); err != nil {
+		t.Fatal(err)
+	} else if n := s.ShardN(); n != 1 {
+		t.Fatalf("unexpected shard count: %d", n)
+	} else if ids := s.UnreadableShards([]uint64{1, 2, 3}); !deep.Equal(ids, []uint64{2}) {
+		t.Fatalf("unexpected unreadable shards: %v", ids)
+	}
+
+	stats := s.Statistics(nil)
+	if v := stats[0].Values["shardsUnreadable"]; v != int64(1) {
+		t.Fatalf("unexpected unreadable shards statistic: %v", v)
+	} else if stats[1].Name != "unreadable_shard" || stats[1].Tags["id"] != "2" || stats[1].Tags["database"] != "db0" {
+		t.Fatalf("unexpected statistic: %v", stats[1])
+	}
+
+	// The shard must not be replaced with an empty one.
+	if err := s.CreateShard("db0", "rp0", 2, true); err != tsdb.ErrShardUnreadable {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Deleting the shard removes its files.
+	if err := s.DeleteShard(2); err != nil {
+		t.Fatal(err)
+	} else if ids := s.UnreadableShards([]uint64{2}); len(ids) != 0 {
+		t.Fatalf("unexpected unreadable shards: %v", ids)
+	} else if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected shard to be removed: %v", err)
+	}
+}
+
 // Ensure the store reports an error when it can't open a database directory.
 func TestStore_Open_InvalidDatabaseFile(t *testing.T) {
 	s := NewStore()
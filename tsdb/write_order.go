@@ -0,0 +1,81 @@
+package tsdb
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/lucaswiersma/influxdb/models"
+)
+
+// seriesMaxTimes tracks the newest timestamp written to each series of the
+// measurements with monotonic timestamps. A series is looked up in the engine
+// the first time it is written after the shard opens or after a delete.
+type seriesMaxTimes struct {
+	mu    sync.Mutex
+	times map[string]int64
+}
+
+// reset forgets the timestamps of every series.
+func (m *seriesMaxTimes) reset() {
+	m.mu.Lock()
+	m.times = nil
+	m.mu.Unlock()
+}
+
+// checkTimestampOrder drops the points of measurements with monotonic
+// timestamps that are older than the newest point written to their series,
+// including earlier points of the same batch. It returns the remaining points
+// along with the number dropped and the reason.
+//
+// The newest timestamp of a series is advanced as its points are accepted,
+// so it also covers points that fail to be written afterwards.
+//
+// The check only covers this shard. A point that falls in an older shard
+// group is accepted even when newer shard groups hold later points of its
+// series, since a shard does not know about the other shards of its
+// retention policy.
+func (s *Shard) checkTimestampOrder(points []models.Point) ([]models.Point, int, string) {
+	var (
+		dropped int
+		reason  string
+		n       int
+	)
+
+	m := &s.maxTimes
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, p := range points {
+		name := p.Name()
+		if _, ok := s.monotonic[name]; !ok {
+			points[n] = p
+			n++
+			continue
+		}
+
+		if m.times == nil {
+			m.times = make(map[string]int64)
+		}
+		key := string(p.Key())
+		max, ok := m.times[key]
+		if !ok {
+			max, ok = s.engine.LastTimestamp(name, key)
+		}
+
+		ts := p.UnixNano()
+		if ok && ts < max {
+			m.times[key] = max
+			atomic.AddInt64(&s.stats.WritePointsOOO, 1)
+			atomic.AddInt64(&s.stats.WritePointsDropped, 1)
+			dropped++
+			reason = fmt.Sprintf("out-of-order point rejected: measurement=%q series=%q time %d is older than %d", name, key, ts, max)
+			continue
+		}
+		m.times[key] = ts
+
+		points[n] = p
+		n++
+	}
+	return points[:n], dropped, reason
+}